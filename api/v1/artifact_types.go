@@ -61,6 +61,25 @@ type Artifact struct {
 	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
+// ArtifactGC configures the garbage collection of the Artifacts of a Source,
+// overriding the retention defaults of the controller.
+type ArtifactGC struct {
+	// RetainRecords is the maximum number of Artifacts to be kept in storage
+	// after a garbage collection. Defaults to the value of the controller's
+	// --artifact-retention-records flag.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RetainRecords *int32 `json:"retainRecords,omitempty"`
+
+	// RetainTTL is the duration of time that Artifacts from previous
+	// reconciliations are kept in storage before being garbage collected.
+	// Defaults to the value of the controller's --artifact-retention-ttl flag.
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:Pattern="^([0-9]+(\\.[0-9]+)?(ms|s|m|h))+$"
+	// +optional
+	RetainTTL *metav1.Duration `json:"retainTTL,omitempty"`
+}
+
 // HasRevision returns if the given revision matches the current Revision of
 // the Artifact.
 func (in *Artifact) HasRevision(revision string) bool {
@@ -60,6 +60,31 @@ const (
 	// This is a "negative polarity" or "abnormal-true" type, and is only
 	// present on the resource if it is True.
 	StorageOperationFailedCondition string = "StorageOperationFailed"
+
+	// NewerVersionAvailableCondition indicates a newer version of a chart is
+	// available in the Source than the version the chart was resolved to.
+	// This is a "negative polarity" or "abnormal-true" type, and is only
+	// present on the resource if it is True.
+	NewerVersionAvailableCondition string = "NewerVersionAvailable"
+
+	// RepositoryArtifactStaleCondition indicates the artifact of the Source a
+	// chart is resolved against is older than the configured maximum age.
+	// This is a "negative polarity" or "abnormal-true" type, and is only
+	// present on the resource if it is True.
+	RepositoryArtifactStaleCondition string = "RepositoryArtifactStale"
+
+	// DeprecatedCondition indicates the chart version a chart is resolved to
+	// is marked as deprecated in the Source.
+	// This is a "negative polarity" or "abnormal-true" type, and is only
+	// present on the resource if it is True.
+	DeprecatedCondition string = "Deprecated"
+
+	// ChartValidatedCondition indicates a chart version was resolved in, and
+	// downloaded from the Source, without being stored as an Artifact.
+	// If True, the chart is available in the Source.
+	// This Condition is only present on the resource while it is reconciled
+	// in validation only mode.
+	ChartValidatedCondition string = "ChartValidated"
 )
 
 // Reasons are provided as utility, and not part of the declarative API.
@@ -67,6 +92,10 @@ const (
 	// URLInvalidReason signals that a given Source has an invalid URL.
 	URLInvalidReason string = "URLInvalid"
 
+	// URLSchemeNotAllowedReason signals that the scheme of the URL of a given
+	// Source is not allowed by the controller.
+	URLSchemeNotAllowedReason string = "URLSchemeNotAllowed"
+
 	// AuthenticationFailedReason signals that a Secret does not have the
 	// required fields, or the provided credentials do not match.
 	AuthenticationFailedReason string = "AuthenticationFailed"
@@ -104,4 +133,61 @@ const (
 
 	// CacheOperationFailedReason signals a failure in cache operation.
 	CacheOperationFailedReason string = "CacheOperationFailed"
+
+	// PolicyRejectedReason signals that the Artifact was rejected by the
+	// pre-store policy webhook, and was not written to the storage.
+	PolicyRejectedReason string = "PolicyRejected"
+
+	// IndexTooLargeReason signals that the downloaded index exceeds the
+	// maximum allowed size or number of entries.
+	IndexTooLargeReason string = "IndexTooLarge"
+
+	// ArtifactURLUpdatedReason signals that the URL of the Artifact was
+	// updated to match the hostname of the storage.
+	ArtifactURLUpdatedReason string = "ArtifactURLUpdated"
+
+	// ArtifactDigestMismatchReason signals that the file of the Artifact in
+	// the storage does not match the digest of the Artifact.
+	ArtifactDigestMismatchReason string = "ArtifactDigestMismatch"
+
+	// NewChartVersionReason signals that a newer version of a chart is
+	// available than the resolved version.
+	NewChartVersionReason string = "NewChartVersion"
+
+	// ChartDeprecatedReason signals that the resolved version of a chart is
+	// marked as deprecated.
+	ChartDeprecatedReason string = "ChartDeprecated"
+
+	// ArtifactAgeExceededReason signals that the age of an Artifact exceeds
+	// the configured maximum age.
+	ArtifactAgeExceededReason string = "ArtifactAgeExceeded"
+
+	// TooManyRedirectsReason signals that a request was redirected more often
+	// than the maximum allowed number of redirects.
+	TooManyRedirectsReason string = "TooManyRedirects"
+
+	// EmptyRepositoryReason signals that the repository of a Source does not
+	// contain any commits yet.
+	EmptyRepositoryReason string = "EmptyRepository"
+
+	// SecretNotFoundReason signals that a Secret referenced by the object
+	// does not exist.
+	SecretNotFoundReason string = "SecretNotFound"
+
+	// SecretInvalidReason signals that a Secret referenced by the object does
+	// not contain the data expected for its use.
+	SecretInvalidReason string = "SecretInvalid"
+
+	// CloneSizeExceededReason signals that the size of the clone of a
+	// repository on disk exceeds the maximum allowed size.
+	CloneSizeExceededReason string = "CloneSizeExceeded"
+
+	// InsufficientStorageReason signals that there is not enough free space
+	// in the storage to write the artifact.
+	InsufficientStorageReason string = "InsufficientStorage"
+
+	// MaliciousArchiveReason signals that an archive contains entries with
+	// absolute paths or parent directory references, which could escape the
+	// directory it is extracted to.
+	MaliciousArchiveReason string = "MaliciousArchive"
 )
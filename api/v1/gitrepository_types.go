@@ -36,13 +36,48 @@ const (
 	// This is a "negative polarity" or "abnormal-true" type, and is only
 	// present on the resource if it is True.
 	IncludeUnavailableCondition string = "IncludeUnavailable"
+
+	// PendingApprovalCondition indicates the Artifact of the GitRepository
+	// has been stored, but is awaiting approval through the
+	// ApprovedRevisionAnnotation before the GitRepository is marked as ready.
+	// This is a "negative polarity" or "abnormal-true" type, and is only
+	// present on the resource if it is True.
+	PendingApprovalCondition string = "PendingApproval"
+)
+
+const (
+	// AwaitingApprovalReason signals that the Artifact has not been approved
+	// yet.
+	AwaitingApprovalReason string = "AwaitingApproval"
+)
+
+const (
+	// ApprovalRequiredAnnotation is the annotation which, when set to
+	// "true", requires the Artifact of the GitRepository to be approved
+	// before the GitRepository is marked as ready.
+	ApprovalRequiredAnnotation string = "source.toolkit.fluxcd.io/approval-required"
+
+	// ApprovedRevisionAnnotation is the annotation used to approve the
+	// Artifact with the revision equal to its value.
+	ApprovedRevisionAnnotation string = "source.toolkit.fluxcd.io/approved-revision"
+)
+
+const (
+	// SymlinkPolicyIgnore skips symlinks while archiving the Artifact.
+	SymlinkPolicyIgnore string = "ignore"
+	// SymlinkPolicyFollow includes the contents of the target of a symlink
+	// while archiving the Artifact, and refuses targets outside the source.
+	SymlinkPolicyFollow string = "follow"
+	// SymlinkPolicyError refuses to archive an Artifact containing symlinks.
+	SymlinkPolicyError string = "error"
 )
 
 // GitRepositorySpec specifies the required configuration to produce an
 // Artifact for a Git repository.
 type GitRepositorySpec struct {
-	// URL specifies the Git repository URL, it can be an HTTP/S or SSH address.
-	// +kubebuilder:validation:Pattern="^(http|https|ssh)://.*$"
+	// URL specifies the Git repository URL, it can be an HTTP/S, SSH or
+	// anonymous Git protocol (git://) address.
+	// +kubebuilder:validation:Pattern="^(http|https|ssh|git)://.*$"
 	// +required
 	URL string `json:"url"`
 
@@ -84,6 +119,28 @@ type GitRepositorySpec struct {
 	// +optional
 	Ignore *string `json:"ignore,omitempty"`
 
+	// SymlinkPolicy specifies how symlinks in the repository are handled
+	// while archiving the Artifact. 'ignore' skips them, 'follow' includes the
+	// contents of their target and refuses targets outside the repository,
+	// and 'error' refuses to produce an Artifact containing symlinks.
+	// Defaults to 'ignore'.
+	// +kubebuilder:validation:Enum=ignore;follow;error
+	// +kubebuilder:default:=ignore
+	// +optional
+	SymlinkPolicy string `json:"symlinkPolicy,omitempty"`
+
+	// GC overrides the garbage collection retention of the controller for
+	// the Artifacts of this GitRepository.
+	// +optional
+	GC *ArtifactGC `json:"gc,omitempty"`
+
+	// DigestAlgorithm overrides the algorithm of the controller for the digest
+	// of the Artifacts of this GitRepository. Changing it results in a new
+	// Artifact.
+	// +kubebuilder:validation:Enum=sha256;sha384;sha512;blake3
+	// +optional
+	DigestAlgorithm string `json:"digestAlgorithm,omitempty"`
+
 	// Suspend tells the controller to suspend the reconciliation of this
 	// GitRepository.
 	// +optional
@@ -200,19 +257,65 @@ type GitRepositoryStatus struct {
 	// +optional
 	ObservedIgnore *string `json:"observedIgnore,omitempty"`
 
+	// IgnoredPathsCount is the number of paths which were excluded from the
+	// current Artifact by the ignore rules. The contents of an ignored
+	// directory are not counted separately.
+	// +optional
+	IgnoredPathsCount int64 `json:"ignoredPathsCount,omitempty"`
+
+	// IgnoredPathsSample contains a sample of the paths which were excluded
+	// from the current Artifact by the ignore rules. It is only recorded when
+	// the controller is configured with --ignored-paths-sample-size.
+	// +optional
+	IgnoredPathsSample []string `json:"ignoredPathsSample,omitempty"`
+
 	// ObservedRecurseSubmodules is the observed resource submodules
 	// configuration used to produce the current Artifact.
 	// +optional
 	ObservedRecurseSubmodules bool `json:"observedRecurseSubmodules,omitempty"`
 
+	// ObservedSymlinkPolicy is the observed symlink policy used to produce
+	// the current Artifact.
+	// +optional
+	ObservedSymlinkPolicy string `json:"observedSymlinkPolicy,omitempty"`
+
 	// ObservedInclude is the observed list of GitRepository resources used to
 	// produce the current Artifact.
 	// +optional
 	ObservedInclude []GitRepositoryInclude `json:"observedInclude,omitempty"`
 
+	// ObservedAuthDigest is a digest of the authentication configuration
+	// which was used for the last successful fetch from the remote. It is
+	// used to detect the rotation of credentials, and can not be used to
+	// derive the credentials.
+	// +optional
+	ObservedAuthDigest string `json:"observedAuthDigest,omitempty"`
+
+	// LastCommit contains metadata of the last checked out Git commit.
+	// +optional
+	LastCommit *GitCommitMetadata `json:"lastCommit,omitempty"`
+
 	meta.ReconcileRequestStatus `json:",inline"`
 }
 
+// GitCommitMetadata contains metadata about a Git commit.
+type GitCommitMetadata struct {
+	// Revision of the commit, in the same format as the revision of the
+	// Artifact.
+	// +required
+	Revision string `json:"revision"`
+
+	// Message is the subject line of the commit message, truncated to 50
+	// characters.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Author is the name and email address of the author of the commit,
+	// truncated to 256 characters.
+	// +optional
+	Author string `json:"author,omitempty"`
+}
+
 const (
 	// GitOperationSucceedReason signals that a Git operation (e.g. clone,
 	// checkout, etc.) succeeded.
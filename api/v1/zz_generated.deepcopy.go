@@ -55,6 +55,46 @@ func (in *Artifact) DeepCopy() *Artifact {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArtifactGC) DeepCopyInto(out *ArtifactGC) {
+	*out = *in
+	if in.RetainRecords != nil {
+		in, out := &in.RetainRecords, &out.RetainRecords
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RetainTTL != nil {
+		in, out := &in.RetainTTL, &out.RetainTTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArtifactGC.
+func (in *ArtifactGC) DeepCopy() *ArtifactGC {
+	if in == nil {
+		return nil
+	}
+	out := new(ArtifactGC)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitCommitMetadata) DeepCopyInto(out *GitCommitMetadata) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitCommitMetadata.
+func (in *GitCommitMetadata) DeepCopy() *GitCommitMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(GitCommitMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GitRepository) DeepCopyInto(out *GitRepository) {
 	*out = *in
@@ -174,6 +214,11 @@ func (in *GitRepositorySpec) DeepCopyInto(out *GitRepositorySpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.GC != nil {
+		in, out := &in.GC, &out.GC
+		*out = new(ArtifactGC)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Include != nil {
 		in, out := &in.Include, &out.Include
 		*out = make([]GitRepositoryInclude, len(*in))
@@ -222,11 +267,21 @@ func (in *GitRepositoryStatus) DeepCopyInto(out *GitRepositoryStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.IgnoredPathsSample != nil {
+		in, out := &in.IgnoredPathsSample, &out.IgnoredPathsSample
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.ObservedInclude != nil {
 		in, out := &in.ObservedInclude, &out.ObservedInclude
 		*out = make([]GitRepositoryInclude, len(*in))
 		copy(*out, *in)
 	}
+	if in.LastCommit != nil {
+		in, out := &in.LastCommit, &out.LastCommit
+		*out = new(GitCommitMetadata)
+		**out = **in
+	}
 	out.ReconcileRequestStatus = in.ReconcileRequestStatus
 }
 
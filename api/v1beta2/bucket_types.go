@@ -46,6 +46,42 @@ const (
 	AzureBucketProvider string = "azure"
 )
 
+const (
+	// BucketRevisionStrategyEtag computes the revision of a Bucket from the
+	// etags of the objects.
+	BucketRevisionStrategyEtag string = "Etag"
+	// BucketRevisionStrategyContent computes the revision of a Bucket from
+	// the digests of the content of the objects, ignoring any metadata.
+	BucketRevisionStrategyContent string = "Content"
+)
+
+const (
+	// BucketCaseCollisionPolicyAllow includes all objects of a Bucket in the
+	// Artifact, including objects with keys which only differ in case.
+	BucketCaseCollisionPolicyAllow string = "Allow"
+	// BucketCaseCollisionPolicyFail fails the reconciliation of a Bucket
+	// containing objects with keys which only differ in case.
+	BucketCaseCollisionPolicyFail string = "Fail"
+	// BucketCaseCollisionPolicyKeepFirst only includes the object of which the
+	// key sorts first in byte order of the objects with keys which only differ
+	// in case.
+	BucketCaseCollisionPolicyKeepFirst string = "KeepFirst"
+)
+
+// BucketPathRewrite is a rule which rewrites the keys of the objects of a
+// Bucket to the paths at which they are stored in the Artifact.
+type BucketPathRewrite struct {
+	// Match is a regular expression (RE2 syntax) which is matched against
+	// the object key.
+	// +required
+	Match string `json:"match"`
+
+	// Replace is the replacement for the matches of Match. It may refer to
+	// capture groups of Match, e.g. '$1' or '${name}'.
+	// +optional
+	Replace string `json:"replace,omitempty"`
+}
+
 // BucketSpec specifies the required configuration to produce an Artifact for
 // an object storage bucket.
 type BucketSpec struct {
@@ -61,6 +97,13 @@ type BucketSpec struct {
 	// +required
 	BucketName string `json:"bucketName"`
 
+	// Prefix limits the objects of the bucket to those with a key under the
+	// given path, e.g. 'clusters/prod/', to which a trailing slash is added
+	// when missing. The keys of the objects, and of the .sourceignore file,
+	// are relative to the prefix, as are the paths in the Artifact.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
 	// Endpoint is the object storage address the BucketName is located at.
 	// +required
 	Endpoint string `json:"endpoint"`
@@ -78,6 +121,10 @@ type BucketSpec struct {
 	// +optional
 	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
 
+	// Proxy specifies the HTTP/S proxy to connect to the Endpoint through.
+	// +optional
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+
 	// Interval at which to check the Endpoint for updates.
 	// +kubebuilder:validation:Type=string
 	// +kubebuilder:validation:Pattern="^([0-9]+(\\.[0-9]+)?(ms|s|m|h))+$"
@@ -91,12 +138,81 @@ type BucketSpec struct {
 	// +optional
 	Timeout *metav1.Duration `json:"timeout,omitempty"`
 
+	// Weight is the relative share of the global connection slots of the
+	// controller given to this Bucket when its requests have to wait for a
+	// slot. Every Bucket is charged for the time it holds a slot divided by
+	// its weight, and the Bucket which has been charged the least is handed
+	// the next slot. Requires the controller to be started with
+	// --max-global-connections, a Warning event is recorded when it is set
+	// without. Defaults to 1 when omitted.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	Weight int32 `json:"weight,omitempty"`
+
 	// Ignore overrides the set of excluded patterns in the .sourceignore format
 	// (which is the same as .gitignore). If not provided, a default will be used,
 	// consult the documentation for your version to find out what those are.
 	// +optional
 	Ignore *string `json:"ignore,omitempty"`
 
+	// RevisionStrategy determines how the revision of the Artifact is
+	// computed. Valid values are ('Etag', 'Content').
+	// 'Etag' computes the revision from the etags of the objects, which may
+	// change when only the metadata of an object changes.
+	// 'Content' computes the revision from the digests of the content of the
+	// objects, ignoring any metadata. This requires all objects to be
+	// downloaded on every reconciliation.
+	// Defaults to Etag when omitted.
+	// +kubebuilder:validation:Enum=Etag;Content
+	// +kubebuilder:default:=Etag
+	// +optional
+	RevisionStrategy string `json:"revisionStrategy,omitempty"`
+
+	// CaseCollisionPolicy determines how objects with keys which only differ
+	// in case are handled, as these collide on case-insensitive file systems.
+	// Valid values are ('Allow', 'Fail', 'KeepFirst').
+	// 'Allow' includes all objects in the Artifact.
+	// 'Fail' fails the reconciliation, reporting the colliding keys.
+	// 'KeepFirst' only includes the object of which the key sorts first in
+	// byte order, and excludes the others.
+	// Defaults to Allow when omitted.
+	// +kubebuilder:validation:Enum=Allow;Fail;KeepFirst
+	// +kubebuilder:default:=Allow
+	// +optional
+	CaseCollisionPolicy string `json:"caseCollisionPolicy,omitempty"`
+
+	// ConsistencyRetries is the maximum number of times the objects are
+	// listed again after a short delay to confirm the listing, for object
+	// storages of which the listings are eventually consistent. An Artifact
+	// is only produced once two consecutive listings agree, and the
+	// reconciliation fails when they do not within the retries.
+	// Defaults to 0 when omitted, which does not confirm the listing.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	ConsistencyRetries int32 `json:"consistencyRetries,omitempty"`
+
+	// PathRewrite is a list of rules which rewrite the keys of the objects
+	// to the paths at which they are stored in the Artifact. The rules are
+	// applied in order to the keys of the objects which are not ignored,
+	// with each rule replacing all matches in the result of the previous
+	// rule. Objects of which the key is rewritten to an empty path are
+	// excluded from the Artifact.
+	// +optional
+	PathRewrite []BucketPathRewrite `json:"pathRewrite,omitempty"`
+
+	// GC overrides the garbage collection retention of the controller for
+	// the Artifacts of this Bucket.
+	// +optional
+	GC *apiv1.ArtifactGC `json:"gc,omitempty"`
+
+	// DigestAlgorithm overrides the algorithm of the controller for the digest
+	// of the Artifacts of this Bucket. Changing it results in a new Artifact.
+	// +kubebuilder:validation:Enum=sha256;sha384;sha512;blake3
+	// +optional
+	DigestAlgorithm string `json:"digestAlgorithm,omitempty"`
+
 	// Suspend tells the controller to suspend the reconciliation of this
 	// Bucket.
 	// +optional
@@ -134,6 +250,18 @@ type BucketStatus struct {
 	// +optional
 	ObservedIgnore *string `json:"observedIgnore,omitempty"`
 
+	// IgnoredPathsCount is the number of paths which were excluded from the
+	// current Artifact by the ignore rules. The contents of an ignored
+	// directory are not counted separately.
+	// +optional
+	IgnoredPathsCount int64 `json:"ignoredPathsCount,omitempty"`
+
+	// IgnoredPathsSample contains a sample of the paths which were excluded
+	// from the current Artifact by the ignore rules. It is only recorded when
+	// the controller is configured with --ignored-paths-sample-size.
+	// +optional
+	IgnoredPathsSample []string `json:"ignoredPathsSample,omitempty"`
+
 	meta.ReconcileRequestStatus `json:",inline"`
 }
 
@@ -145,6 +273,20 @@ const (
 	// BucketOperationFailedReason signals that the Bucket listing or fetch
 	// operations failed.
 	BucketOperationFailedReason string = "BucketOperationFailed"
+
+	// KeyCaseCollisionReason signals that the Bucket contains objects with
+	// keys which only differ in case.
+	KeyCaseCollisionReason string = "KeyCaseCollision"
+
+	// PathRewriteFailedReason signals that the path rewrite rules of the
+	// Bucket are invalid, or rewrite the keys of multiple objects to the same
+	// path.
+	PathRewriteFailedReason string = "PathRewriteFailed"
+
+	// WeightIgnoredReason signals that the weight of the Bucket has no
+	// effect, as the controller does not limit the number of global
+	// connections.
+	WeightIgnoredReason string = "WeightIgnored"
 )
 
 // GetConditions returns the status conditions of the object.
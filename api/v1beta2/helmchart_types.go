@@ -19,6 +19,7 @@ package v1beta2
 import (
 	"time"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/fluxcd/pkg/apis/acl"
@@ -36,6 +37,13 @@ type HelmChartSpec struct {
 	// +required
 	Chart string `json:"chart"`
 
+	// ChartPath is the path of a chart relative to the path specified in
+	// Chart, which is packaged instead, e.g. 'charts/redis' to select a
+	// subchart. The path must contain a Chart.yaml file. Only supported for
+	// GitRepository and Bucket sources. Ignored when omitted.
+	// +optional
+	ChartPath string `json:"chartPath,omitempty"`
+
 	// Version is the chart version semver expression, ignored for charts from
 	// GitRepository and Bucket sources. Defaults to latest when omitted.
 	// +kubebuilder:default:=*
@@ -53,14 +61,26 @@ type HelmChartSpec struct {
 	Interval metav1.Duration `json:"interval"`
 
 	// ReconcileStrategy determines what enables the creation of a new artifact.
-	// Valid values are ('ChartVersion', 'Revision').
+	// Valid values are ('ChartVersion', 'Revision', 'Validate').
 	// See the documentation of the values for an explanation on their behavior.
 	// Defaults to ChartVersion when omitted.
-	// +kubebuilder:validation:Enum=ChartVersion;Revision
+	// +kubebuilder:validation:Enum=ChartVersion;Revision;Validate
 	// +kubebuilder:default:=ChartVersion
 	// +optional
 	ReconcileStrategy string `json:"reconcileStrategy,omitempty"`
 
+	// VersionMismatchPolicy determines how a chart is handled of which the
+	// version declared in its Chart.yaml differs from the version of its entry
+	// in the HelmRepository index.
+	// 'warn' emits a warning event, and stores the chart with the version of
+	// the index entry.
+	// 'error' fails the reconciliation with a VersionMismatch reason.
+	// Only supported for HelmRepository sources. Defaults to warn when omitted.
+	// +kubebuilder:validation:Enum=warn;error
+	// +kubebuilder:default:=warn
+	// +optional
+	VersionMismatchPolicy string `json:"versionMismatchPolicy,omitempty"`
+
 	// ValuesFiles is an alternative list of values files to use as the chart
 	// values (values.yaml is not included by default), expected to be a
 	// relative path in the SourceRef.
@@ -77,6 +97,24 @@ type HelmChartSpec struct {
 	// +deprecated
 	ValuesFile string `json:"valuesFile,omitempty"`
 
+	// Values holds the values for this Helm chart, which are merged on top of
+	// the chart's default values and the ValuesFiles (if any). Changes to the
+	// values result in a new chart version, as a hash of the values is
+	// included in the version metadata. Ignored when omitted.
+	// +optional
+	Values *apiextensionsv1.JSON `json:"values,omitempty"`
+
+	// GC overrides the garbage collection retention of the controller for
+	// the Artifacts of this HelmChart.
+	// +optional
+	GC *apiv1.ArtifactGC `json:"gc,omitempty"`
+
+	// DigestAlgorithm overrides the algorithm of the controller for the digest
+	// of the Artifacts of this HelmChart. Changing it results in a new Artifact.
+	// +kubebuilder:validation:Enum=sha256;sha384;sha512;blake3
+	// +optional
+	DigestAlgorithm string `json:"digestAlgorithm,omitempty"`
+
 	// Suspend tells the controller to suspend the reconciliation of this
 	// source.
 	// +optional
@@ -91,10 +129,52 @@ type HelmChartSpec struct {
 	// Verify contains the secret name containing the trusted public keys
 	// used to verify the signature and specifies which provider to use to check
 	// whether OCI image is authentic.
-	// This field is only supported when using HelmRepository source with spec.type 'oci'.
+	// The 'cosign' provider is only supported when using HelmRepository source
+	// with spec.type 'oci'. The 'helm' provider verifies the provenance file of
+	// the chart against the OpenPGP keyring in the secret, and is only supported
+	// when using HelmRepository source with spec.type 'default'.
 	// Chart dependencies, which are not bundled in the umbrella chart artifact, are not verified.
 	// +optional
 	Verify *OCIRepositoryVerification `json:"verify,omitempty"`
+
+	// MaxRepositoryArtifactAge is the maximum age of the artifact of a
+	// HelmRepository source, after which the RepositoryArtifactStale condition
+	// is set to warn the chart is resolved against a potentially outdated
+	// index. The chart is still resolved against the stale index.
+	// Only supported for HelmRepository sources which are not of type 'oci'.
+	// Ignored when omitted.
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:Pattern="^([0-9]+(\\.[0-9]+)?(ms|s|m|h))+$"
+	// +optional
+	MaxRepositoryArtifactAge *metav1.Duration `json:"maxRepositoryArtifactAge,omitempty"`
+
+	// Push configures the push of the packaged chart to an OCI registry,
+	// after it has been stored as an Artifact. Ignored when omitted.
+	// +optional
+	Push *HelmChartPush `json:"push,omitempty"`
+
+	// ExtractValues enables storing the default values file of the chart
+	// in the Artifact next to it, allowing consumers to retrieve the default
+	// values without unpacking the chart.
+	// +optional
+	ExtractValues bool `json:"extractValues,omitempty"`
+}
+
+// HelmChartPush defines the OCI repository the packaged chart of a HelmChart
+// is pushed to.
+type HelmChartPush struct {
+	// OCIRef is the OCI repository the chart is pushed to, in the format
+	// 'oci://<host>[:<port>]/<path>'. As with 'helm push', the name and
+	// version of the chart are appended to it as repository name and tag.
+	// +kubebuilder:validation:Pattern="^oci://.*$"
+	// +required
+	OCIRef string `json:"ociRef"`
+
+	// SecretRef specifies the Secret containing the credentials for the
+	// registry. The Secret must either contain 'username' and 'password'
+	// fields, or be of type 'kubernetes.io/dockerconfigjson'.
+	// +optional
+	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
 }
 
 const (
@@ -103,6 +183,23 @@ const (
 
 	// ReconcileStrategyRevision reconciles when the Revision of the source is different.
 	ReconcileStrategyRevision string = "Revision"
+
+	// ReconcileStrategyValidate only validates the Helm chart version can be
+	// resolved and downloaded, without creating an artifact. Only supported
+	// for HelmRepository sources.
+	ReconcileStrategyValidate string = "Validate"
+)
+
+const (
+	// VersionMismatchPolicyWarn warns about a chart of which the version
+	// declared in its metadata differs from the version in the repository
+	// index, and stores it with the version of the index.
+	VersionMismatchPolicyWarn string = "warn"
+
+	// VersionMismatchPolicyError fails the reconciliation of a chart of which
+	// the version declared in its metadata differs from the version in the
+	// repository index.
+	VersionMismatchPolicyError string = "error"
 )
 
 // LocalHelmChartSourceReference contains enough information to let you locate
@@ -140,6 +237,12 @@ type HelmChartStatus struct {
 	// +optional
 	ObservedChartName string `json:"observedChartName,omitempty"`
 
+	// LatestVersion is the latest version of the chart available in the
+	// HelmRepository, as observed while resolving the version of the chart.
+	// It is empty for charts from a GitRepository or Bucket.
+	// +optional
+	LatestVersion string `json:"latestVersion,omitempty"`
+
 	// Conditions holds the conditions for the HelmChart.
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
@@ -154,9 +257,68 @@ type HelmChartStatus struct {
 	// +optional
 	Artifact *apiv1.Artifact `json:"artifact,omitempty"`
 
+	// Push records the last successful push of the Artifact to the OCI
+	// repository configured in HelmChartSpec.Push.
+	// +optional
+	Push *HelmChartPushStatus `json:"push,omitempty"`
+
+	// SignerKeyID is the ID of the OpenPGP key the provenance of the
+	// Artifact was signed with, as verified with the 'helm' provider of
+	// HelmChartSpec.Verify.
+	// +optional
+	SignerKeyID string `json:"signerKeyID,omitempty"`
+
+	// ChartMetadata is the metadata of the chart in the Artifact.
+	// +optional
+	ChartMetadata *HelmChartMetadata `json:"chartMetadata,omitempty"`
+
+	// ValuesURL is the fetch link for the default values file of the chart
+	// in the Artifact. It is only set when HelmChartSpec.ExtractValues is
+	// enabled.
+	// +optional
+	ValuesURL string `json:"valuesURL,omitempty"`
+
+	// ValuesDigest is the digest of the default values file of the chart
+	// in the Artifact, which changes when the default values change. It is
+	// only set when HelmChartSpec.ExtractValues is enabled.
+	// +optional
+	ValuesDigest string `json:"valuesDigest,omitempty"`
+
 	meta.ReconcileRequestStatus `json:",inline"`
 }
 
+// HelmChartPushStatus records the push of a HelmChart Artifact to an OCI
+// repository.
+type HelmChartPushStatus struct {
+	// Ref is the OCI reference the chart was pushed to.
+	// +required
+	Ref string `json:"ref"`
+
+	// Digest is the digest of the manifest of the pushed chart.
+	// +required
+	Digest string `json:"digest"`
+
+	// ArtifactDigest is the digest of the Artifact which was pushed.
+	// +required
+	ArtifactDigest string `json:"artifactDigest"`
+}
+
+// HelmChartMetadata is the metadata of a chart in a HelmChart Artifact.
+type HelmChartMetadata struct {
+	// Name of the chart.
+	// +required
+	Name string `json:"name"`
+
+	// Version of the chart, including any build metadata added for the
+	// HelmChartSpec.ReconcileStrategy.
+	// +required
+	Version string `json:"version"`
+
+	// AppVersion is the version of the app contained in the chart.
+	// +optional
+	AppVersion string `json:"appVersion,omitempty"`
+}
+
 const (
 	// ChartPullSucceededReason signals that the pull of the Helm chart
 	// succeeded.
@@ -165,6 +327,43 @@ const (
 	// ChartPackageSucceededReason signals that the package of the Helm
 	// chart succeeded.
 	ChartPackageSucceededReason string = "ChartPackageSucceeded"
+
+	// ChartPushSucceededReason signals that the push of the packaged Helm
+	// chart to an OCI repository succeeded.
+	ChartPushSucceededReason string = "ChartPushSucceeded"
+
+	// ChartPushFailedReason signals that the push of the packaged Helm chart
+	// to an OCI repository failed.
+	ChartPushFailedReason string = "ChartPushFailed"
+
+	// VersionMismatchReason signals that the version declared in the metadata
+	// of the Helm chart differs from the version in the repository index.
+	VersionMismatchReason string = "VersionMismatch"
+
+	// UnsupportedChartReason signals that the API version of the Helm chart
+	// is not in the list of allowed chart API versions.
+	UnsupportedChartReason string = "UnsupportedChart"
+
+	// MissingDigestReason signals that the entry of the Helm chart version
+	// in the repository index has no digest.
+	MissingDigestReason string = "MissingDigest"
+
+	// VerificationFailedReason signals that the verification of the
+	// provenance of the Helm chart failed.
+	VerificationFailedReason string = "VerificationFailed"
+
+	// UnsupportedSourceKindReason signals that the kind of the SourceRef of
+	// the HelmChart is not a supported Source kind.
+	UnsupportedSourceKindReason string = "UnsupportedSourceKind"
+
+	// ValidationOnlyReason signals that the Helm chart was validated without
+	// being stored as an Artifact, as the HelmChart is reconciled with the
+	// Validate reconcile strategy.
+	ValidationOnlyReason string = "ValidationOnly"
+
+	// UnsupportedReconcileStrategyReason signals that the ReconcileStrategy
+	// of the HelmChart is not supported for the kind of its SourceRef.
+	UnsupportedReconcileStrategyReason string = "UnsupportedReconcileStrategy"
 )
 
 // GetConditions returns the status conditions of the object.
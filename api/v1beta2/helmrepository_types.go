@@ -47,6 +47,14 @@ type HelmRepositorySpec struct {
 	// +required
 	URL string `json:"url"`
 
+	// Mirrors is a list of equivalent HTTP/S Helm repository URLs, which are
+	// used as an alternative to URL to fetch the repository index from.
+	// The URL with the best recent health (the fewest failures and lowest
+	// latency) is preferred, automatically failing over to the others.
+	// This field is not supported for OCI Helm repositories.
+	// +optional
+	Mirrors []string `json:"mirrors,omitempty"`
+
 	// SecretRef specifies the Secret containing authentication credentials
 	// for the HelmRepository.
 	// For HTTP/S basic auth the secret must contain 'username' and 'password'
@@ -56,6 +64,13 @@ type HelmRepositorySpec struct {
 	// +optional
 	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
 
+	// Proxy specifies the HTTP/S proxy to fetch the repository index and
+	// charts through. When set, the proxy configuration of the SecretRef is
+	// ignored.
+	// This field is not supported for OCI Helm repositories.
+	// +optional
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+
 	// PassCredentials allows the credentials from the SecretRef to be passed
 	// on to a host that does not match the host as defined in URL.
 	// This may be required if the host of the advertised chart URLs in the
@@ -65,6 +80,24 @@ type HelmRepositorySpec struct {
 	// +optional
 	PassCredentials bool `json:"passCredentials,omitempty"`
 
+	// TLSServerName overrides the server name sent in the TLS handshake (SNI)
+	// and used to verify the certificate of the server, for when it differs
+	// from the host of the URL, e.g. when the repository is served behind a
+	// shared TLS frontend. It applies to the index and chart downloads of
+	// HTTP/S Helm repositories.
+	// +optional
+	TLSServerName string `json:"tlsServerName,omitempty"`
+
+	// Insecure disables the verification of the TLS certificate of the
+	// server, for the index and chart downloads of an HTTPS Helm repository
+	// serving a certificate which can not be verified, e.g. a self-signed one.
+	// Enabling this should be done with caution, as it makes the connection
+	// vulnerable to MITM-attacks. It is mutually exclusive with a 'caFile' in
+	// the SecretRef.
+	// This field is not supported for OCI Helm repositories.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
 	// Interval at which to check the URL for updates.
 	// +kubebuilder:validation:Type=string
 	// +kubebuilder:validation:Pattern="^([0-9]+(\\.[0-9]+)?(ms|s|m|h))+$"
@@ -72,7 +105,8 @@ type HelmRepositorySpec struct {
 	Interval metav1.Duration `json:"interval"`
 
 	// Timeout is used for the index fetch operation for an HTTPS helm repository,
-	// and for remote OCI Repository operations like pulling for an OCI helm repository.
+	// for downloading charts from it, and for remote OCI Repository operations
+	// like pulling for an OCI helm repository.
 	// Its default value is 60s.
 	// +kubebuilder:default:="60s"
 	// +kubebuilder:validation:Type=string
@@ -80,6 +114,29 @@ type HelmRepositorySpec struct {
 	// +optional
 	Timeout *metav1.Duration `json:"timeout,omitempty"`
 
+	// GC overrides the garbage collection retention of the controller for
+	// the Artifacts of this HelmRepository.
+	// +optional
+	GC *apiv1.ArtifactGC `json:"gc,omitempty"`
+
+	// DigestAlgorithm overrides the algorithm of the controller for the digest
+	// of the Artifacts of this HelmRepository. Changing it results in a new
+	// Artifact.
+	// This field is not supported for OCI Helm repositories.
+	// +kubebuilder:validation:Enum=sha256;sha384;sha512;blake3
+	// +optional
+	DigestAlgorithm string `json:"digestAlgorithm,omitempty"`
+
+	// FetchRetries is the number of times the fetch of the index of an HTTP/S
+	// Helm repository is retried after a transient error, like a timeout or
+	// an HTTP 503 response, with an exponential backoff between the attempts.
+	// Errors which are not transient, like an HTTP 404 response, are not
+	// retried. Its default value is 2.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	FetchRetries *int32 `json:"fetchRetries,omitempty"`
+
 	// Suspend tells the controller to suspend the reconciliation of this
 	// HelmRepository.
 	// +optional
@@ -123,6 +180,25 @@ type HelmRepositoryStatus struct {
 	// +optional
 	URL string `json:"url,omitempty"`
 
+	// RawIndexURL is the fetch link for the index exactly as downloaded from
+	// the Helm repository, before any processing. It is only set when the
+	// controller is configured to keep raw indexes.
+	// +optional
+	RawIndexURL string `json:"rawIndexURL,omitempty"`
+
+	// IndexETag is the ETag of the index of the Artifact, as served by the
+	// Helm repository. It is used to make a conditional request for the
+	// index, which is not downloaded again if it has not been modified.
+	// +optional
+	IndexETag string `json:"indexETag,omitempty"`
+
+	// IndexLastModified is the Last-Modified time of the index of the
+	// Artifact, as served by the Helm repository. It is used to make a
+	// conditional request for the index, which is not downloaded again if it
+	// has not been modified.
+	// +optional
+	IndexLastModified string `json:"indexLastModified,omitempty"`
+
 	// Artifact represents the last successful HelmRepository reconciliation.
 	// +optional
 	Artifact *apiv1.Artifact `json:"artifact,omitempty"`
@@ -134,6 +210,29 @@ const (
 	// IndexationFailedReason signals that the HelmRepository index fetch
 	// failed.
 	IndexationFailedReason string = "IndexationFailed"
+
+	// UnknownIndexAPIVersionReason signals that the HelmRepository index has
+	// an API version which is not recognized.
+	UnknownIndexAPIVersionReason string = "UnknownIndexAPIVersion"
+
+	// InsecureSkipVerifyReason signals that the verification of the TLS
+	// certificate of the HelmRepository is disabled.
+	InsecureSkipVerifyReason string = "InsecureSkipVerify"
+
+	// InvalidTLSConfigReason signals that the TLS configuration of the
+	// HelmRepository is invalid, e.g. because it both disables the
+	// verification of the TLS certificate and provides a CA certificate.
+	InvalidTLSConfigReason string = "InvalidTLSConfig"
+)
+
+const (
+	// IndexCompatibilityWarningCondition indicates the HelmRepository index
+	// has an API version which is not recognized, and has been parsed on a
+	// best-effort basis.
+	// This is a "negative polarity" or "abnormal-true" type, and is only
+	// present on the resource if it is True. It does not affect the
+	// readiness of the resource.
+	IndexCompatibilityWarningCondition string = "IndexCompatibilityWarning"
 )
 
 // GetConditions returns the status conditions of the object.
@@ -152,6 +251,25 @@ func (in HelmRepository) GetRequeueAfter() time.Duration {
 	return in.Spec.Interval.Duration
 }
 
+// GetTimeout returns the timeout duration used for various operations related
+// to this HelmRepository, defaulting to 60s if it is not set.
+func (in *HelmRepository) GetTimeout() time.Duration {
+	if in.Spec.Timeout != nil {
+		return in.Spec.Timeout.Duration
+	}
+	return 60 * time.Second
+}
+
+// GetFetchRetries returns the number of times the fetch of the index of this
+// HelmRepository is retried after a transient error, defaulting to 2 if it is
+// not set.
+func (in *HelmRepository) GetFetchRetries() int {
+	if in.Spec.FetchRetries != nil {
+		return int(*in.Spec.FetchRetries)
+	}
+	return 2
+}
+
 // GetArtifact returns the latest artifact from the source if present in the
 // status sub-resource.
 func (in *HelmRepository) GetArtifact() *apiv1.Artifact {
@@ -134,6 +134,18 @@ type OCIRepositorySpec struct {
 	// +optional
 	Insecure bool `json:"insecure,omitempty"`
 
+	// GC overrides the garbage collection retention of the controller for
+	// the Artifacts of this OCIRepository.
+	// +optional
+	GC *apiv1.ArtifactGC `json:"gc,omitempty"`
+
+	// DigestAlgorithm overrides the algorithm of the controller for the digest
+	// of the Artifacts of this OCIRepository. Changing it results in a new
+	// Artifact.
+	// +kubebuilder:validation:Enum=sha256;sha384;sha512;blake3
+	// +optional
+	DigestAlgorithm string `json:"digestAlgorithm,omitempty"`
+
 	// This flag tells the controller to suspend the reconciliation of this source.
 	// +optional
 	Suspend bool `json:"suspend,omitempty"`
@@ -176,7 +188,8 @@ type OCILayerSelector struct {
 // OCIRepositoryVerification verifies the authenticity of an OCI Artifact
 type OCIRepositoryVerification struct {
 	// Provider specifies the technology used to sign the OCI Artifact.
-	// +kubebuilder:validation:Enum=cosign
+	// The 'helm' provider is only supported by HelmChart.
+	// +kubebuilder:validation:Enum=cosign;helm
 	// +kubebuilder:default:=cosign
 	Provider string `json:"provider"`
 
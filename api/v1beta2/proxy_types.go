@@ -0,0 +1,42 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+)
+
+// ProxyConfig specifies the HTTP/S proxy to connect to a source through,
+// instead of the proxy configured in the environment of the controller.
+type ProxyConfig struct {
+	// URL of the HTTP/S proxy, e.g. 'http://proxy.example.com:3128'.
+	// +kubebuilder:validation:Pattern="^https?://.*$"
+	// +required
+	URL string `json:"url"`
+
+	// SecretRef specifies the Secret containing the credentials to
+	// authenticate with the proxy. The secret must contain 'username' and
+	// 'password' fields.
+	// +optional
+	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// NoProxy is a list of hosts which are connected to directly instead of
+	// through the proxy, in the format of the NO_PROXY environment variable,
+	// e.g. 'example.com', '.example.com', '10.0.0.0/8' or '*'.
+	// +optional
+	NoProxy []string `json:"noProxy,omitempty"`
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/fluxcd/pkg/apis/acl"
 	"github.com/fluxcd/pkg/apis/meta"
 	apiv1 "github.com/fluxcd/source-controller/api/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -116,6 +117,21 @@ func (in *BucketList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketPathRewrite) DeepCopyInto(out *BucketPathRewrite) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketPathRewrite.
+func (in *BucketPathRewrite) DeepCopy() *BucketPathRewrite {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketPathRewrite)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BucketSpec) DeepCopyInto(out *BucketSpec) {
 	*out = *in
@@ -124,6 +140,11 @@ func (in *BucketSpec) DeepCopyInto(out *BucketSpec) {
 		*out = new(meta.LocalObjectReference)
 		**out = **in
 	}
+	if in.Proxy != nil {
+		in, out := &in.Proxy, &out.Proxy
+		*out = new(ProxyConfig)
+		(*in).DeepCopyInto(*out)
+	}
 	out.Interval = in.Interval
 	if in.Timeout != nil {
 		in, out := &in.Timeout, &out.Timeout
@@ -135,6 +156,16 @@ func (in *BucketSpec) DeepCopyInto(out *BucketSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.PathRewrite != nil {
+		in, out := &in.PathRewrite, &out.PathRewrite
+		*out = make([]BucketPathRewrite, len(*in))
+		copy(*out, *in)
+	}
+	if in.GC != nil {
+		in, out := &in.GC, &out.GC
+		*out = new(apiv1.ArtifactGC)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.AccessFrom != nil {
 		in, out := &in.AccessFrom, &out.AccessFrom
 		*out = new(acl.AccessFrom)
@@ -172,6 +203,11 @@ func (in *BucketStatus) DeepCopyInto(out *BucketStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.IgnoredPathsSample != nil {
+		in, out := &in.IgnoredPathsSample, &out.IgnoredPathsSample
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	out.ReconcileRequestStatus = in.ReconcileRequestStatus
 }
 
@@ -450,6 +486,56 @@ func (in *HelmChartList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmChartMetadata) DeepCopyInto(out *HelmChartMetadata) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmChartMetadata.
+func (in *HelmChartMetadata) DeepCopy() *HelmChartMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmChartMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmChartPush) DeepCopyInto(out *HelmChartPush) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(meta.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmChartPush.
+func (in *HelmChartPush) DeepCopy() *HelmChartPush {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmChartPush)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmChartPushStatus) DeepCopyInto(out *HelmChartPushStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmChartPushStatus.
+func (in *HelmChartPushStatus) DeepCopy() *HelmChartPushStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmChartPushStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmChartSpec) DeepCopyInto(out *HelmChartSpec) {
 	*out = *in
@@ -460,6 +546,16 @@ func (in *HelmChartSpec) DeepCopyInto(out *HelmChartSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = new(apiextensionsv1.JSON)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GC != nil {
+		in, out := &in.GC, &out.GC
+		*out = new(apiv1.ArtifactGC)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.AccessFrom != nil {
 		in, out := &in.AccessFrom, &out.AccessFrom
 		*out = new(acl.AccessFrom)
@@ -470,6 +566,16 @@ func (in *HelmChartSpec) DeepCopyInto(out *HelmChartSpec) {
 		*out = new(OCIRepositoryVerification)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.MaxRepositoryArtifactAge != nil {
+		in, out := &in.MaxRepositoryArtifactAge, &out.MaxRepositoryArtifactAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Push != nil {
+		in, out := &in.Push, &out.Push
+		*out = new(HelmChartPush)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmChartSpec.
@@ -497,6 +603,16 @@ func (in *HelmChartStatus) DeepCopyInto(out *HelmChartStatus) {
 		*out = new(apiv1.Artifact)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Push != nil {
+		in, out := &in.Push, &out.Push
+		*out = new(HelmChartPushStatus)
+		**out = **in
+	}
+	if in.ChartMetadata != nil {
+		in, out := &in.ChartMetadata, &out.ChartMetadata
+		*out = new(HelmChartMetadata)
+		**out = **in
+	}
 	out.ReconcileRequestStatus = in.ReconcileRequestStatus
 }
 
@@ -572,17 +688,37 @@ func (in *HelmRepositoryList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmRepositorySpec) DeepCopyInto(out *HelmRepositorySpec) {
 	*out = *in
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.SecretRef != nil {
 		in, out := &in.SecretRef, &out.SecretRef
 		*out = new(meta.LocalObjectReference)
 		**out = **in
 	}
+	if in.Proxy != nil {
+		in, out := &in.Proxy, &out.Proxy
+		*out = new(ProxyConfig)
+		(*in).DeepCopyInto(*out)
+	}
 	out.Interval = in.Interval
 	if in.Timeout != nil {
 		in, out := &in.Timeout, &out.Timeout
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.GC != nil {
+		in, out := &in.GC, &out.GC
+		*out = new(apiv1.ArtifactGC)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FetchRetries != nil {
+		in, out := &in.FetchRetries, &out.FetchRetries
+		*out = new(int32)
+		**out = **in
+	}
 	if in.AccessFrom != nil {
 		in, out := &in.AccessFrom, &out.AccessFrom
 		*out = new(acl.AccessFrom)
@@ -771,6 +907,11 @@ func (in *OCIRepositorySpec) DeepCopyInto(out *OCIRepositorySpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.GC != nil {
+		in, out := &in.GC, &out.GC
+		*out = new(apiv1.ArtifactGC)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OCIRepositorySpec.
@@ -840,3 +981,28 @@ func (in *OCIRepositoryVerification) DeepCopy() *OCIRepositoryVerification {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxyConfig) DeepCopyInto(out *ProxyConfig) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(meta.LocalObjectReference)
+		**out = **in
+	}
+	if in.NoProxy != nil {
+		in, out := &in.NoProxy, &out.NoProxy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxyConfig.
+func (in *ProxyConfig) DeepCopy() *ProxyConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxyConfig)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package connlimit provides a semaphore bounding the number of concurrent
+// outbound network operations, which can be shared by all reconcilers.
+package connlimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limiter is a semaphore bounding the number of concurrent outbound network
+// operations. It is safe for concurrent use. A nil Limiter does not limit
+// anything.
+//
+// When operations have to wait for a slot, the slots are handed out using
+// weighted fair queuing over the keys passed to AcquireFor, or set on the
+// context of requests using WithKey: every key is charged for the time it
+// held a slot, divided by its weight, and the waiting operation of which the
+// key has been charged the least goes first. This prevents a few keys holding
+// slots for a long time from starving others.
+// Operations of the same key, and operations acquired using Acquire, are
+// handed out in the order they started waiting.
+type Limiter struct {
+	mu    sync.Mutex
+	max   int
+	inUse int
+	// vtime is the virtual time of the last operation which was handed a
+	// slot. Keys which have not been charged beyond it start from it.
+	vtime float64
+	// flows holds the virtual time of the keys which have been charged.
+	flows   map[string]*flow
+	waiters []*waiter
+	seq     uint64
+	now     func() time.Time
+}
+
+// flow is the accounting of a key of the Limiter.
+type flow struct {
+	// vtime is the virtual time up to which the key has been charged.
+	vtime float64
+	// active is the number of waiting and acquired operations of the key.
+	active int
+}
+
+// waiter is an operation which waits for a slot.
+type waiter struct {
+	key    string
+	seq    uint64
+	ready  chan struct{}
+	vstart float64
+}
+
+// New returns a new Limiter which allows at most max concurrent operations.
+// When max is zero or negative, it returns nil, which does not limit.
+func New(max int) *Limiter {
+	if max <= 0 {
+		return nil
+	}
+	return &Limiter{
+		max:   max,
+		flows: make(map[string]*flow),
+		now:   time.Now,
+	}
+}
+
+// Acquire blocks until a slot for an operation is available, or the given
+// context is done. On success, it returns a function which must be called to
+// release the slot once the operation has finished. Calling it more than once
+// has no effect.
+// The operation is not accounted to any key, and is handed a slot before any
+// key which has been charged beyond the current virtual time of the Limiter.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	return l.AcquireFor(ctx, "", 1)
+}
+
+// AcquireFor is like Acquire, but accounts the operation to the given key
+// with the given weight. A key with a higher weight is handed slots more
+// often than a key with a lower weight, relative to the time the operations
+// of the keys hold a slot. A weight lower than 1 is treated as 1. An empty
+// key is equal to Acquire.
+func (l *Limiter) AcquireFor(ctx context.Context, key string, weight int) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if weight < 1 {
+		weight = 1
+	}
+
+	l.mu.Lock()
+	if key != "" {
+		f, ok := l.flows[key]
+		if !ok {
+			f = &flow{vtime: l.vtime}
+			l.flows[key] = f
+		}
+		f.active++
+	}
+	l.seq++
+	w := &waiter{key: key, seq: l.seq, ready: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	l.dispatch()
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		l.mu.Lock()
+		select {
+		case <-w.ready:
+			// Handed a slot while the context was done, give it back.
+			l.mu.Unlock()
+			l.release(w, weight, l.now())
+		default:
+			l.remove(w)
+			l.forget(w.key)
+			l.mu.Unlock()
+		}
+		return nil, fmt.Errorf("failed to acquire connection slot: %w", ctx.Err())
+	}
+
+	start := l.now()
+	var once sync.Once
+	return func() { once.Do(func() { l.release(w, weight, start) }) }, nil
+}
+
+// InUse returns the number of currently acquired slots.
+func (l *Limiter) InUse() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inUse
+}
+
+// release releases the slot of the given waiter, and charges its key for the
+// time since start.
+func (l *Limiter) release(w *waiter, weight int, start time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if f, ok := l.flows[w.key]; ok {
+		if f.vtime < w.vstart {
+			f.vtime = w.vstart
+		}
+		f.vtime += l.now().Sub(start).Seconds() / float64(weight)
+	}
+	l.forget(w.key)
+	l.inUse--
+	l.dispatch()
+}
+
+// dispatch hands the available slots to the waiters of which the key has
+// been charged the least, in order of the time they started waiting. It must
+// be called with the lock held.
+func (l *Limiter) dispatch() {
+	for l.inUse < l.max && len(l.waiters) > 0 {
+		next := 0
+		nextStart := l.vstart(l.waiters[0])
+		for i, w := range l.waiters[1:] {
+			if s := l.vstart(w); s < nextStart {
+				next, nextStart = i+1, s
+			}
+		}
+
+		w := l.waiters[next]
+		l.waiters = append(l.waiters[:next], l.waiters[next+1:]...)
+		w.vstart = nextStart
+		if nextStart > l.vtime {
+			l.vtime = nextStart
+			l.prune()
+		}
+		l.inUse++
+		close(w.ready)
+	}
+}
+
+// prune drops the accounting of the keys without operations which have not
+// been charged beyond the virtual time of the Limiter. It must be called with
+// the lock held.
+func (l *Limiter) prune() {
+	for k, f := range l.flows {
+		if f.active == 0 && f.vtime <= l.vtime {
+			delete(l.flows, k)
+		}
+	}
+}
+
+// vstart returns the virtual time at which the given waiter would start. It
+// must be called with the lock held.
+func (l *Limiter) vstart(w *waiter) float64 {
+	if f, ok := l.flows[w.key]; ok && f.vtime > l.vtime {
+		return f.vtime
+	}
+	return l.vtime
+}
+
+// remove removes the given waiter from the waiters. It must be called with
+// the lock held.
+func (l *Limiter) remove(w *waiter) {
+	for i := range l.waiters {
+		if l.waiters[i] == w {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// forget marks an operation of the given key as done, and drops the
+// accounting of the key once it has no operations left and has not been
+// charged beyond the virtual time of the Limiter, as it would start from it
+// again. It must be called with the lock held.
+func (l *Limiter) forget(key string) {
+	f, ok := l.flows[key]
+	if !ok {
+		return
+	}
+	if f.active--; f.active == 0 && f.vtime <= l.vtime {
+		delete(l.flows, key)
+	}
+}
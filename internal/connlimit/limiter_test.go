@@ -0,0 +1,305 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connlimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNew(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(New(0)).To(BeNil())
+	g.Expect(New(-1)).To(BeNil())
+	g.Expect(New(1)).ToNot(BeNil())
+}
+
+func TestLimiter_Acquire(t *testing.T) {
+	t.Run("never exceeds bound under load", func(t *testing.T) {
+		g := NewWithT(t)
+
+		const max = 5
+		l := New(max)
+
+		var current, peak int32
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := l.Acquire(context.TODO())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer release()
+
+				n := atomic.AddInt32(&current, 1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&current, -1)
+			}()
+		}
+		wg.Wait()
+
+		g.Expect(atomic.LoadInt32(&peak)).To(BeNumerically("<=", max))
+		g.Expect(atomic.LoadInt32(&peak)).To(BeNumerically(">", 1))
+		g.Expect(l.InUse()).To(BeZero())
+	})
+
+	t.Run("blocks until released", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l := New(1)
+		release, err := l.Acquire(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+
+		acquired := make(chan struct{})
+		go func() {
+			r, err := l.Acquire(context.TODO())
+			if err == nil {
+				defer r()
+			}
+			close(acquired)
+		}()
+		g.Consistently(acquired, 50*time.Millisecond).ShouldNot(BeClosed())
+
+		release()
+		release()
+		g.Eventually(acquired).Should(BeClosed())
+	})
+
+	t.Run("returns error on done context", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l := New(1)
+		_, err := l.Acquire(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+		defer cancel()
+		_, err = l.Acquire(ctx)
+		g.Expect(err).To(MatchError(context.DeadlineExceeded))
+		g.Expect(l.InUse()).To(Equal(1))
+	})
+
+	t.Run("nil limiter", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var l *Limiter
+		release, err := l.Acquire(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+		release()
+		g.Expect(l.InUse()).To(BeZero())
+	})
+}
+
+func TestLimiter_AcquireFor(t *testing.T) {
+	// fakeClock is a clock which only advances when told to.
+	type fakeClock struct {
+		mu  sync.Mutex
+		now time.Time
+	}
+	newLimiter := func(max int) (*Limiter, func(time.Duration)) {
+		c := &fakeClock{now: time.Now()}
+		l := New(max)
+		l.now = func() time.Time {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.now
+		}
+		return l, func(d time.Duration) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.now = c.now.Add(d)
+		}
+	}
+	// hold acquires a slot for the key and holds it for d.
+	hold := func(g *WithT, l *Limiter, advance func(time.Duration), key string, weight int, d time.Duration) {
+		release, err := l.AcquireFor(context.TODO(), key, weight)
+		g.Expect(err).ToNot(HaveOccurred())
+		advance(d)
+		release()
+	}
+	// enqueue starts waiting for a slot for each of the keys in order, and
+	// returns a channel receiving the keys in the order they were handed a
+	// slot, while releasing each slot immediately.
+	enqueue := func(g *WithT, l *Limiter, weight int, keys ...string) <-chan string {
+		order := make(chan string, len(keys))
+		for i, key := range keys {
+			key := key
+			go func() {
+				release, err := l.AcquireFor(context.TODO(), key, weight)
+				if err != nil {
+					return
+				}
+				order <- key
+				release()
+			}()
+			g.Eventually(func() int {
+				l.mu.Lock()
+				defer l.mu.Unlock()
+				return len(l.waiters)
+			}).Should(Equal(i + 1))
+		}
+		return order
+	}
+	received := func(order <-chan string, n int) []string {
+		var keys []string
+		for i := 0; i < n; i++ {
+			keys = append(keys, <-order)
+		}
+		return keys
+	}
+
+	t.Run("hands slot to least charged key first", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l, advance := newLimiter(1)
+		hold(g, l, advance, "heavy", 1, 10*time.Second)
+		hold(g, l, advance, "light", 1, time.Second)
+
+		blocker, err := l.Acquire(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+		order := enqueue(g, l, 1, "heavy", "light", "new")
+		blocker()
+
+		g.Expect(received(order, 3)).To(Equal([]string{"new", "light", "heavy"}))
+	})
+
+	t.Run("higher weight reduces charge", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l, advance := newLimiter(1)
+		hold(g, l, advance, "a", 1, 10*time.Second)
+		hold(g, l, advance, "b", 4, 10*time.Second)
+
+		blocker, err := l.Acquire(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+		order := enqueue(g, l, 1, "a", "b")
+		blocker()
+
+		g.Expect(received(order, 2)).To(Equal([]string{"b", "a"}))
+	})
+
+	t.Run("hands slots of same key in order", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l, _ := newLimiter(1)
+		blocker, err := l.Acquire(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var keys []string
+		for i := 0; i < 5; i++ {
+			keys = append(keys, "same")
+		}
+		order := enqueue(g, l, 1, keys...)
+		blocker()
+
+		g.Expect(received(order, 5)).To(HaveLen(5))
+		g.Expect(l.InUse()).To(BeZero())
+	})
+
+	t.Run("drops accounting of idle keys", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l, advance := newLimiter(1)
+		hold(g, l, advance, "a", 1, 0)
+		g.Expect(l.flows).To(BeEmpty())
+
+		hold(g, l, advance, "b", 1, time.Second)
+		g.Expect(l.flows).To(HaveKey("b"))
+		hold(g, l, advance, "c", 1, 2*time.Second)
+		hold(g, l, advance, "c", 1, 0)
+		g.Expect(l.flows).ToNot(HaveKey("b"))
+	})
+
+	t.Run("removes waiter on done context", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l, _ := newLimiter(1)
+		release, err := l.Acquire(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+		defer cancel()
+		_, err = l.AcquireFor(ctx, "key", 1)
+		g.Expect(err).To(MatchError(context.DeadlineExceeded))
+		g.Expect(l.waiters).To(BeEmpty())
+		g.Expect(l.flows).To(BeEmpty())
+
+		release()
+		g.Expect(l.InUse()).To(BeZero())
+	})
+
+	t.Run("light key is not starved by heavy keys", func(t *testing.T) {
+		g := NewWithT(t)
+
+		const heavyHold = 50 * time.Millisecond
+		l := New(1)
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			key := fmt.Sprintf("heavy-%d", i)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					release, err := l.AcquireFor(ctx, key, 1)
+					if err != nil {
+						return
+					}
+					time.Sleep(heavyHold)
+					release()
+				}
+			}()
+		}
+
+		// Let every heavy key hold a slot once, after which the light key
+		// would wait for all of them on every acquisition without fair
+		// queuing.
+		time.Sleep(4 * heavyHold)
+		var maxWait time.Duration
+		for i := 0; i < 5; i++ {
+			start := time.Now()
+			release, err := l.AcquireFor(context.TODO(), "light", 1)
+			g.Expect(err).ToNot(HaveOccurred())
+			if wait := time.Since(start); wait > maxWait {
+				maxWait = wait
+			}
+			release()
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		wg.Wait()
+
+		g.Expect(maxWait).To(BeNumerically("<", 3*heavyHold))
+	})
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connlimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+type keyContextKey struct{}
+
+// keyWeight is the key and weight operations are accounted to.
+type keyWeight struct {
+	key    string
+	weight int
+}
+
+// WithKey returns a copy of the given context, of which the requests sent
+// through the RoundTripper of a Limiter are accounted to the given key with
+// the given weight, as with AcquireFor.
+func WithKey(ctx context.Context, key string, weight int) context.Context {
+	return context.WithValue(ctx, keyContextKey{}, keyWeight{key: key, weight: weight})
+}
+
+// keyFromContext returns the key and weight set on the given context using
+// WithKey, or an empty key.
+func keyFromContext(ctx context.Context) (string, int) {
+	kw, _ := ctx.Value(keyContextKey{}).(keyWeight)
+	return kw.key, kw.weight
+}
+
+// RoundTripper returns an http.RoundTripper which acquires a slot of the
+// Limiter for every request sent through rt, accounted to the key set on the
+// context of the request using WithKey. The slot is released once the body
+// of the response has been read or closed, or when the request fails.
+// A nil Limiter returns rt as is.
+func (l *Limiter) RoundTripper(rt http.RoundTripper) http.RoundTripper {
+	if l == nil {
+		return rt
+	}
+	return &limitRoundTripper{l: l, rt: rt}
+}
+
+type limitRoundTripper struct {
+	l  *Limiter
+	rt http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *limitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, weight := keyFromContext(req.Context())
+	release, err := t.l.AcquireFor(req.Context(), key, weight)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	res, err := t.rt.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	res.Body = &releaseBody{ReadCloser: res.Body, release: release}
+	return res, nil
+}
+
+// releaseBody calls release once the ReadCloser has been read to the end,
+// failed to be read, or has been closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+// Read implements io.Reader.
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connlimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestLimiter_RoundTripper(t *testing.T) {
+	t.Run("nil limiter returns round tripper", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var l *Limiter
+		g.Expect(l.RoundTripper(http.DefaultTransport)).To(Equal(http.DefaultTransport))
+	})
+
+	t.Run("bounds concurrent requests under load", func(t *testing.T) {
+		g := NewWithT(t)
+
+		const max = 3
+		var active, peak int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		l := New(max)
+		client := &http.Client{Transport: l.RoundTripper(http.DefaultTransport)}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := client.Get(server.URL)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_, _ = io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+			}()
+		}
+		wg.Wait()
+
+		g.Expect(atomic.LoadInt32(&peak)).To(BeNumerically("<=", max))
+		g.Expect(atomic.LoadInt32(&peak)).To(BeNumerically(">", 1))
+		g.Expect(l.InUse()).To(BeZero())
+	})
+
+	t.Run("holds slot until body is read or closed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l := New(1)
+		rt := l.RoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(&io.LimitedReader{R: zeroReader{}, N: 4})}, nil
+		}))
+
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		res, err := rt.RoundTrip(req)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(l.InUse()).To(Equal(1))
+
+		_, err = io.ReadAll(res.Body)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(l.InUse()).To(BeZero())
+
+		res, err = rt.RoundTrip(req)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(l.InUse()).To(Equal(1))
+		g.Expect(res.Body.Close()).To(Succeed())
+		g.Expect(l.InUse()).To(BeZero())
+	})
+
+	t.Run("releases slot on failed request", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l := New(1)
+		rt := l.RoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("failed")
+		}))
+
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		g.Expect(err).To(MatchError("failed"))
+		g.Expect(l.InUse()).To(BeZero())
+	})
+
+	t.Run("fails when context is done while waiting", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l := New(1)
+		release, err := l.Acquire(context.TODO())
+		g.Expect(err).ToNot(HaveOccurred())
+		defer release()
+
+		var called bool
+		rt := l.RoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			called = true
+			return nil, nil
+		}))
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		g.Expect(err).To(MatchError(context.DeadlineExceeded))
+		g.Expect(called).To(BeFalse())
+		g.Expect(l.InUse()).To(Equal(1))
+	})
+
+	t.Run("accounts requests to key of context", func(t *testing.T) {
+		g := NewWithT(t)
+
+		l := New(1)
+		now := time.Unix(0, 0)
+		l.now = func() time.Time { return now }
+
+		rt := l.RoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			now = now.Add(time.Second)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}))
+
+		req, err := http.NewRequestWithContext(WithKey(context.TODO(), "heavy", 2), http.MethodGet, "http://example.com", nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		res, err := rt.RoundTrip(req)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(l.flows).To(HaveKey("heavy"))
+		g.Expect(res.Body.Close()).To(Succeed())
+		g.Expect(l.flows["heavy"].vtime).To(Equal(0.5))
+	})
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -16,7 +16,12 @@ limitations under the License.
 
 package controller
 
-import sourcev1 "github.com/fluxcd/source-controller/api/v1"
+import (
+	"github.com/opencontainers/go-digest"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	intdigest "github.com/fluxcd/source-controller/internal/digest"
+)
 
 type artifactSet []*sourcev1.Artifact
 
@@ -37,3 +42,16 @@ outer:
 	}
 	return false
 }
+
+// digestAlgorithmChanged returns true if the digest of the given artifact was
+// calculated with another algorithm than the given .spec.digestAlgorithm of
+// its object. An empty algorithm never results in a change, which prevents
+// all artifacts from being rebuilt when the default algorithm of the
+// controller is changed.
+func digestAlgorithmChanged(artifact *sourcev1.Artifact, algorithm string) bool {
+	if algorithm == "" || artifact == nil || artifact.Digest == "" {
+		return false
+	}
+	d, err := intdigest.Parse(artifact.Digest)
+	return err != nil || d.Algorithm() != digest.Algorithm(algorithm)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/fluxcd/source-controller/api/v1beta2"
+	"github.com/fluxcd/source-controller/internal/tree"
+)
+
+// ArtifactTTLSweeper removes the files in the Storage which are older than
+// the TTL, and do not belong to the current artifact of any Source object.
+// Independent of the garbage collection of each object, this bounds the
+// growth of the Storage by artifacts of objects which no longer exist, e.g.
+// because they were deleted or renamed while the controller was not running.
+type ArtifactTTLSweeper struct {
+	// Client is used to list the Source objects.
+	Client client.Reader
+	// Storage is the Storage to remove the expired artifacts from.
+	Storage *Storage
+	// TTL is the duration after the last modification of a file after which
+	// it expires.
+	TTL time.Duration
+	// Interval is the interval at which Start calls Sweep.
+	Interval time.Duration
+}
+
+// Start calls Sweep at the Interval, until the context is cancelled.
+// It implements manager.Runnable.
+func (s *ArtifactTTLSweeper) Start(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("artifact-ttl-sweeper")
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			removed, err := s.Sweep(ctx)
+			if err != nil {
+				log.Error(err, "failed to remove expired artifacts")
+			}
+			if len(removed) > 0 {
+				log.Info(fmt.Sprintf("removed %d expired artifact files", len(removed)))
+			}
+		}
+	}
+}
+
+// Sweep removes the files in the Storage which are older than the TTL, and
+// do not belong to the current artifact of any Source object. It returns
+// the removed files. Symlinks, lock files and the markers of deferred
+// removals are never removed, and the sweep is aborted if the Source objects
+// can not be listed.
+func (s *ArtifactTTLSweeper) Sweep(ctx context.Context) ([]string, error) {
+	current, err := s.currentArtifactFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	var errs []error
+	expiry := time.Now().Add(-s.TTL)
+	_ = filepath.Walk(s.Storage.BasePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if !info.Mode().IsRegular() || strings.HasSuffix(path, ".lock") || current[path] ||
+			info.Name() == deferredRemovalMarker {
+			return nil
+		}
+		if !info.ModTime().Before(expiry) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		removed = append(removed, path)
+		return nil
+	})
+	sort.Strings(removed)
+	return removed, kerrors.NewAggregate(errs)
+}
+
+// currentArtifactFiles returns the set of local paths of the files which
+// belong to the current artifact of a Source object.
+func (s *ArtifactTTLSweeper) currentArtifactFiles(ctx context.Context) (map[string]bool, error) {
+	lists := []client.ObjectList{
+		&sourcev1.GitRepositoryList{},
+		&v1beta2.BucketList{},
+		&v1beta2.HelmRepositoryList{},
+		&v1beta2.HelmChartList{},
+		&v1beta2.OCIRepositoryList{},
+	}
+
+	current := make(map[string]bool)
+	for _, list := range lists {
+		if err := s.Client.List(ctx, list); err != nil {
+			return nil, fmt.Errorf("failed to list Source objects: %w", err)
+		}
+		if err := apimeta.EachListItem(list, func(obj runtime.Object) error {
+			source, ok := obj.(sourcev1.Source)
+			if !ok {
+				return nil
+			}
+			artifact := source.GetArtifact()
+			if artifact == nil {
+				return nil
+			}
+			localPath := s.Storage.LocalPath(*artifact)
+			if localPath == "" {
+				return nil
+			}
+			current[localPath] = true
+			current[tree.SidecarPath(localPath)] = true
+			current[filepath.Join(filepath.Dir(localPath), rawIndexFileName)] = true
+			current[filepath.Join(filepath.Dir(localPath), valuesFileName)] = true
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
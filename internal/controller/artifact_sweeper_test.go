@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/fluxcd/source-controller/api/v1beta2"
+	"github.com/fluxcd/source-controller/internal/tree"
+)
+
+func TestArtifactTTLSweeper_Sweep(t *testing.T) {
+	g := NewWithT(t)
+
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	gitArtifact := sourcev1.Artifact{Path: "gitrepository/default/current/revision.tar.gz"}
+	helmRepoArtifact := sourcev1.Artifact{Path: "helmrepository/default/current/index-abc.yaml"}
+	objs := []*sourcev1.GitRepository{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "current", Namespace: "default"},
+			Status:     sourcev1.GitRepositoryStatus{Artifact: &gitArtifact},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "without-artifact", Namespace: "default"},
+		},
+	}
+	helmRepo := &v1beta2.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "current", Namespace: "default"},
+		Status:     v1beta2.HelmRepositoryStatus{Artifact: &helmRepoArtifact},
+	}
+
+	const ttl = time.Hour
+	expired := time.Now().Add(-2 * ttl)
+	files := map[string]bool{
+		// Files of current artifacts are kept, even when expired.
+		storage.LocalPath(gitArtifact):                                                      false,
+		tree.SidecarPath(storage.LocalPath(gitArtifact)):                                    false,
+		storage.LocalPath(helmRepoArtifact):                                                 false,
+		filepath.Join(storage.BasePath, "helmrepository/default/current", rawIndexFileName): false,
+		// Lock files are kept.
+		filepath.Join(storage.BasePath, "gitrepository/default/deleted/revision.tar.gz.lock"): false,
+		// Markers of deferred removals are kept.
+		filepath.Join(storage.BasePath, "gitrepository/default/deleted", deferredRemovalMarker): false,
+		// Expired files which are not current are removed.
+		filepath.Join(storage.BasePath, "gitrepository/default/current/previous.tar.gz"): true,
+		filepath.Join(storage.BasePath, "gitrepository/default/deleted/revision.tar.gz"): true,
+		filepath.Join(storage.BasePath, "helmchart/other/deleted/chart-0.1.0.tgz"):       true,
+	}
+	for p := range files {
+		g.Expect(os.MkdirAll(filepath.Dir(p), 0o700)).To(Succeed())
+		g.Expect(os.WriteFile(p, []byte(p), 0o600)).To(Succeed())
+		g.Expect(os.Chtimes(p, expired, expired)).To(Succeed())
+	}
+
+	// Files which are not expired are kept.
+	fresh := filepath.Join(storage.BasePath, "gitrepository/default/deleted/fresh.tar.gz")
+	g.Expect(os.WriteFile(fresh, []byte("fresh"), 0o600)).To(Succeed())
+	files[fresh] = false
+
+	// Symlinks are kept.
+	symlink := filepath.Join(storage.BasePath, "gitrepository/default/deleted/latest.tar.gz")
+	g.Expect(os.Symlink(filepath.Join(storage.BasePath, "gitrepository/default/deleted/revision.tar.gz"), symlink)).To(Succeed())
+
+	builder := fake.NewClientBuilder().WithScheme(testEnv.GetScheme()).WithObjects(helmRepo)
+	for _, obj := range objs {
+		builder.WithObjects(obj)
+	}
+	s := &ArtifactTTLSweeper{
+		Client:  builder.Build(),
+		Storage: storage,
+		TTL:     ttl,
+	}
+
+	removed, err := s.Sweep(context.TODO())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	var wantRemoved []string
+	for p, remove := range files {
+		if remove {
+			wantRemoved = append(wantRemoved, p)
+			g.Expect(p).ToNot(BeAnExistingFile())
+			continue
+		}
+		g.Expect(p).To(BeARegularFile())
+	}
+	g.Expect(removed).To(ConsistOf(wantRemoved))
+	_, err = os.Lstat(symlink)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// A subsequent sweep has nothing left to remove.
+	removed, err = s.Sweep(context.TODO())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(removed).To(BeEmpty())
+}
@@ -18,6 +18,8 @@ package controller
 
 import (
 	"testing"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 )
 
 func Test_artifactSet_Diff(t *testing.T) {
@@ -122,3 +124,55 @@ func Test_artifactSet_Diff(t *testing.T) {
 		})
 	}
 }
+
+func Test_digestAlgorithmChanged(t *testing.T) {
+	tests := []struct {
+		name      string
+		artifact  *sourcev1.Artifact
+		algorithm string
+		want      bool
+	}{
+		{
+			name:      "no algorithm",
+			artifact:  &sourcev1.Artifact{Digest: "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+			algorithm: "",
+			want:      false,
+		},
+		{
+			name:      "no artifact",
+			algorithm: "sha512",
+			want:      false,
+		},
+		{
+			name:      "artifact without digest",
+			artifact:  &sourcev1.Artifact{},
+			algorithm: "sha512",
+			want:      false,
+		},
+		{
+			name:      "same algorithm",
+			artifact:  &sourcev1.Artifact{Digest: "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+			algorithm: "sha256",
+			want:      false,
+		},
+		{
+			name:      "different algorithm",
+			artifact:  &sourcev1.Artifact{Digest: "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+			algorithm: "sha512",
+			want:      true,
+		},
+		{
+			name:      "invalid digest",
+			artifact:  &sourcev1.Artifact{Digest: "invalid"},
+			algorithm: "sha256",
+			want:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := digestAlgorithmChanged(tt.artifact, tt.algorithm); got != tt.want {
+				t.Errorf("digestAlgorithmChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
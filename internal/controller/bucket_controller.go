@@ -21,16 +21,20 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/opencontainers/go-digest"
-	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	kuberecorder "k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -51,18 +55,26 @@ import (
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	bucketv1 "github.com/fluxcd/source-controller/api/v1beta2"
+	"github.com/fluxcd/source-controller/internal/connlimit"
 	intdigest "github.com/fluxcd/source-controller/internal/digest"
 	serror "github.com/fluxcd/source-controller/internal/error"
+	"github.com/fluxcd/source-controller/internal/features"
 	"github.com/fluxcd/source-controller/internal/index"
+	"github.com/fluxcd/source-controller/internal/latency"
 	sreconcile "github.com/fluxcd/source-controller/internal/reconcile"
 	"github.com/fluxcd/source-controller/internal/reconcile/summarize"
+	"github.com/fluxcd/source-controller/internal/sourcemetrics"
+	"github.com/fluxcd/source-controller/internal/tracing"
+	"github.com/fluxcd/source-controller/internal/transport"
+	"github.com/fluxcd/source-controller/internal/util"
+	"github.com/fluxcd/source-controller/internal/webhook"
 	"github.com/fluxcd/source-controller/pkg/azure"
 	"github.com/fluxcd/source-controller/pkg/gcp"
 	"github.com/fluxcd/source-controller/pkg/minio"
 )
 
-// maxConcurrentBucketFetches is the upper bound on the goroutines used to
-// fetch bucket objects. It's important to have a bound, to avoid
+// defaultMaxConcurrentBucketFetches is the default upper bound on the
+// goroutines used to fetch bucket objects. It's important to have a bound, to avoid
 // using arbitrary amounts of memory; the actual number is chosen
 // according to the queueing rule of thumb with some conservative
 // parameters:
@@ -71,7 +83,7 @@ import (
 // r (service time -- fetch duration) = 0.01s (~ a megabyte file over 1Gb/s)
 // T (total time available) = 1s
 // -> s > 100
-const maxConcurrentBucketFetches = 100
+const defaultMaxConcurrentBucketFetches = 100
 
 // bucketReadyCondition contains the information required to summarize a
 // v1beta2.Bucket Ready Condition.
@@ -123,12 +135,47 @@ type BucketReconciler struct {
 	Storage        *Storage
 	ControllerName string
 
+	PreStoreWebhook *webhook.PreStore
+
+	// LatencyRecorder records the sliding-window reconcile latency
+	// percentiles.
+	LatencyRecorder *latency.Recorder
+
+	// SourceMetrics records the reconcile duration, Artifact size and
+	// fetch failure metrics.
+	SourceMetrics *sourcemetrics.Recorder
+
+	// ConnectionLimiter bounds the number of concurrent outbound network
+	// operations across all reconcilers.
+	ConnectionLimiter *connlimit.Limiter
+
+	// AllowedSchemes is the list of URL schemes sources are allowed to use.
+	// Any scheme is allowed when empty.
+	AllowedSchemes []string
+
+	// ListPageSize is the maximum number of objects requested per page while
+	// listing the objects in a bucket. The default of the provider is used
+	// when zero. The objects are processed as the pages are received, but
+	// the keys and etags of all objects are kept in the index to calculate
+	// the revision.
+	ListPageSize int
+
+	// IgnoredPathsSampleSize is the maximum number of object keys excluded by
+	// the ignore rules which are recorded in the status of an object.
+	IgnoredPathsSampleSize int
+
+	maxConcurrentFetches int
+
+	features     map[string]bool
 	patchOptions []patch.Option
 }
 
 type BucketReconcilerOptions struct {
 	MaxConcurrentReconciles int
 	RateLimiter             ratelimiter.RateLimiter
+	// MaxConcurrentBucketFetches is the maximum number of objects fetched
+	// concurrently per reconciliation. Defaults to 100 when zero.
+	MaxConcurrentBucketFetches int
 }
 
 // BucketProvider is an interface for fetching objects from a storage provider
@@ -165,6 +212,12 @@ func (r *BucketReconciler) SetupWithManager(mgr ctrl.Manager) error {
 func (r *BucketReconciler) SetupWithManagerAndOptions(mgr ctrl.Manager, opts BucketReconcilerOptions) error {
 	r.patchOptions = getPatchOptions(bucketReadyCondition.Owned, r.ControllerName)
 
+	r.maxConcurrentFetches = opts.MaxConcurrentBucketFetches
+
+	if r.features == nil {
+		r.features = features.FeatureGates()
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&bucketv1.Bucket{}).
 		WithEventFilter(predicate.Or(predicate.GenerationChangedPredicate{}, predicates.ReconcileRequestedPredicate{})).
@@ -179,6 +232,11 @@ func (r *BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 	start := time.Now()
 	log := ctrl.LoggerFrom(ctx)
 
+	ctx, span := tracing.StartReconcile(ctx, bucketv1.BucketKind, req.Namespace, req.Name)
+	defer func() {
+		tracing.End(span, retErr)
+	}()
+
 	// Fetch the Bucket
 	obj := &bucketv1.Bucket{}
 	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
@@ -215,6 +273,8 @@ func (r *BucketReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		// Always record readiness and duration metrics
 		r.Metrics.RecordReadiness(ctx, obj)
 		r.Metrics.RecordDuration(ctx, obj, start)
+		r.LatencyRecorder.Observe(bucketv1.BucketKind, time.Since(start))
+		r.SourceMetrics.Record(bucketv1.BucketKind, obj, time.Since(start), retErr)
 	}()
 
 	// Add finalizer first if not exist to avoid the race condition between init and delete
@@ -299,7 +359,9 @@ func (r *BucketReconciler) reconcile(ctx context.Context, sp *patch.SerialPatche
 	)
 
 	for _, rec := range reconcilers {
-		recResult, err := rec(ctx, sp, obj, index, tmpDir)
+		recCtx, recSpan := tracing.StartFunc(ctx, rec)
+		recResult, err := rec(recCtx, sp, obj, index, tmpDir)
+		tracing.End(recSpan, err)
 		// Exit immediately on ResultRequeue.
 		if recResult == sreconcile.ResultRequeue {
 			return sreconcile.ResultRequeue, nil
@@ -365,7 +427,7 @@ func (r *BucketReconciler) reconcileStorage(ctx context.Context, sp *patch.Seria
 
 	// Determine if the advertised artifact is still in storage
 	var artifactMissing bool
-	if artifact := obj.GetArtifact(); artifact != nil && !r.Storage.ArtifactExist(*artifact) {
+	if artifact := obj.GetArtifact(); artifact != nil && r.Storage.ArtifactMissing(*artifact) {
 		obj.Status.Artifact = nil
 		obj.Status.URL = ""
 		artifactMissing = true
@@ -373,12 +435,26 @@ func (r *BucketReconciler) reconcileStorage(ctx context.Context, sp *patch.Seria
 		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
 	}
 
+	// Determine if the advertised artifact still matches its digest
+	var artifactMismatch bool
+	if err := r.Storage.ArtifactDigestMismatch(obj.GetArtifact()); err != nil {
+		r.eventLogf(ctx, obj, corev1.EventTypeWarning, sourcev1.ArtifactDigestMismatchReason,
+			"failed to verify integrity of artifact: %s", err.Error())
+		obj.Status.Artifact = nil
+		obj.Status.URL = ""
+		artifactMismatch = true
+		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
+	}
+
 	// Record that we do not have an artifact
 	if obj.GetArtifact() == nil {
 		msg := "building artifact"
 		if artifactMissing {
 			msg += ": disappeared from storage"
 		}
+		if artifactMismatch {
+			msg += ": digest mismatch in storage"
+		}
 		rreconcile.ProgressiveStatus(true, obj, meta.ProgressingReason, msg)
 		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
 		if err := sp.Patch(ctx, obj, r.patchOptions...); err != nil {
@@ -387,9 +463,12 @@ func (r *BucketReconciler) reconcileStorage(ctx context.Context, sp *patch.Seria
 		return sreconcile.ResultSuccess, nil
 	}
 
-	// Always update URLs to ensure hostname is up-to-date
-	// TODO(hidde): we may want to send out an event only if we notice the URL has changed
-	r.Storage.SetArtifactURL(obj.GetArtifact())
+	// Always update URLs to ensure hostname is up-to-date, and notify about
+	// corrected URLs of e.g. a changed storage hostname
+	if previousURL, ok := r.Storage.UpdateArtifactURL(obj.GetArtifact()); ok {
+		r.eventLogf(ctx, obj, corev1.EventTypeNormal, sourcev1.ArtifactURLUpdatedReason,
+			"artifact URL updated from '%s' to '%s' to match the storage hostname", previousURL, obj.GetArtifact().URL)
+	}
 	obj.Status.URL = r.Storage.SetHostname(obj.Status.URL)
 
 	return sreconcile.ResultSuccess, nil
@@ -401,6 +480,47 @@ func (r *BucketReconciler) reconcileStorage(ctx context.Context, sp *patch.Seria
 // the provider. If this fails, it records v1beta2.FetchFailedCondition=True on
 // the object and returns early.
 func (r *BucketReconciler) reconcileSource(ctx context.Context, sp *patch.SerialPatcher, obj *bucketv1.Bucket, index *index.Digester, dir string) (sreconcile.Result, error) {
+	// Validate the referenced secrets before any network operation
+	if r.features[features.PreflightSecrets] {
+		if e := preflightSecrets(ctx, r.Client, obj.GetNamespace(), bucketSecretReferences(obj)...); e != nil {
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return sreconcile.ResultEmpty, e
+		}
+	}
+
+	// The weight only applies to the connection slots of the limiter, warn
+	// about it being set without one once for every change of the spec
+	if obj.Spec.Weight > 1 && r.ConnectionLimiter == nil && obj.Generation != obj.Status.ObservedGeneration {
+		r.eventLogf(ctx, obj, corev1.EventTypeWarning, bucketv1.WeightIgnoredReason,
+			"weight %d has no effect: the controller is not started with --max-global-connections", obj.Spec.Weight)
+	}
+
+	// Share the connection slots of the requests to the provider fairly
+	// between Buckets according to their weight
+	ctx = connlimit.WithKey(ctx, fmt.Sprintf("%s/%s/%s", bucketv1.BucketKind, obj.Namespace, obj.Name), int(obj.Spec.Weight))
+
+	// The endpoint does not contain a scheme, it is determined by the
+	// Insecure flag instead
+	scheme := "https"
+	if obj.Spec.Insecure {
+		scheme = "http"
+	}
+	if err := util.ValidateURLScheme(scheme+"://"+obj.Spec.Endpoint, r.AllowedSchemes); err != nil {
+		e := serror.NewStalling(
+			fmt.Errorf("invalid endpoint '%s': %w", obj.Spec.Endpoint, err),
+			sourcev1.URLSchemeNotAllowedReason,
+		)
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
+	rewrites, err := newPathRewrites(obj.Spec.PathRewrite)
+	if err != nil {
+		e := serror.NewStalling(err, bucketv1.PathRewriteFailedReason)
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
 	secret, err := r.getBucketSecret(ctx, obj)
 	if err != nil {
 		e := &serror.Event{Err: err, Reason: sourcev1.AuthenticationFailedReason}
@@ -409,6 +529,19 @@ func (r *BucketReconciler) reconcileSource(ctx context.Context, sp *patch.Serial
 		return sreconcile.ResultEmpty, e
 	}
 
+	proxy, err := proxyFromConfig(ctx, r.Client, obj.GetNamespace(), obj.Spec.Proxy)
+	if errors.Is(err, errInvalidProxyURL) {
+		e := serror.NewStalling(err, sourcev1.URLInvalidReason)
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+		return sreconcile.ResultEmpty, e
+	}
+	if err != nil {
+		e := &serror.Event{Err: fmt.Errorf("failed to configure proxy: %w", err), Reason: sourcev1.AuthenticationFailedReason}
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+		// Return error as the content of the secret may change
+		return sreconcile.ResultEmpty, e
+	}
+
 	// Construct provider client
 	var provider BucketProvider
 	switch obj.Spec.Provider {
@@ -418,47 +551,126 @@ func (r *BucketReconciler) reconcileSource(ctx context.Context, sp *patch.Serial
 			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
 			return sreconcile.ResultEmpty, e
 		}
-		if provider, err = gcp.NewClient(ctx, secret); err != nil {
+		var opts []gcp.Option
+		if proxy != nil {
+			opts = append(opts, gcp.WithProxy(proxy.ProxyFunc()))
+		}
+		if r.ConnectionLimiter != nil {
+			opts = append(opts, gcp.WithTransportWrapper(r.ConnectionLimiter.RoundTripper))
+		}
+		c, err := gcp.NewClient(ctx, secret, opts...)
+		if errors.Is(err, gcp.ErrDefaultCredentials) {
+			e := &serror.Event{
+				Err: fmt.Errorf("no Secret reference specified, and %w; ensure the controller's service account "+
+					"is bound to a Google service account with access to the bucket (e.g. using GKE Workload Identity)", err),
+				Reason: sourcev1.AuthenticationFailedReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+			return sreconcile.ResultEmpty, e
+		}
+		if err != nil {
 			e := &serror.Event{Err: err, Reason: "ClientError"}
 			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
 			return sreconcile.ResultEmpty, e
 		}
+		c.PageSize = r.ListPageSize
+		c.Prefix = objectPrefix(obj)
+		provider = c
 	case bucketv1.AzureBucketProvider:
 		if err = azure.ValidateSecret(secret); err != nil {
 			e := &serror.Event{Err: err, Reason: sourcev1.AuthenticationFailedReason}
 			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
 			return sreconcile.ResultEmpty, e
 		}
-		if provider, err = azure.NewClient(obj, secret); err != nil {
+		opts := []azure.Option{azure.WithMinTLSVersion(transport.MinTLSVersion())}
+		if proxy != nil {
+			opts = append(opts, azure.WithProxy(proxy.ProxyFunc()))
+		}
+		if r.ConnectionLimiter != nil {
+			opts = append(opts, azure.WithTransportWrapper(r.ConnectionLimiter.RoundTripper))
+		}
+		c, err := azure.NewClient(obj, secret, opts...)
+		if err != nil {
 			e := &serror.Event{Err: err, Reason: "ClientError"}
 			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
 			return sreconcile.ResultEmpty, e
 		}
+		c.PageSize = r.ListPageSize
+		c.Prefix = objectPrefix(obj)
+		provider = c
 	default:
 		if err = minio.ValidateSecret(secret); err != nil {
 			e := &serror.Event{Err: err, Reason: sourcev1.AuthenticationFailedReason}
 			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
 			return sreconcile.ResultEmpty, e
 		}
-		if provider, err = minio.NewClient(obj, secret); err != nil {
+		opts := []minio.Option{minio.WithMinTLSVersion(transport.MinTLSVersion())}
+		if proxy != nil {
+			opts = append(opts, minio.WithProxy(proxy.ProxyFunc()))
+		}
+		if r.ConnectionLimiter != nil {
+			opts = append(opts, minio.WithTransportWrapper(r.ConnectionLimiter.RoundTripper))
+		}
+		c, err := minio.NewClient(obj, secret, opts...)
+		if err != nil {
 			e := &serror.Event{Err: err, Reason: "ClientError"}
 			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
 			return sreconcile.ResultEmpty, e
 		}
+		c.PageSize = r.ListPageSize
+		c.Prefix = objectPrefix(obj)
+		provider = c
 	}
 
-	// Fetch etag index
-	if err = fetchEtagIndex(ctx, provider, obj, index, dir); err != nil {
+	// Fetch etag index, while recording the ignored object keys
+	ignored := &IgnoredPaths{SampleSize: r.IgnoredPathsSampleSize}
+	if err = fetchConsistentEtagIndex(ctx, provider, obj, index, ignored, dir); err != nil {
 		e := &serror.Event{Err: err, Reason: bucketv1.BucketOperationFailedReason}
 		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
 		return sreconcile.ResultEmpty, e
 	}
+	obj.Status.IgnoredPathsCount = ignored.Count
+	obj.Status.IgnoredPathsSample = ignored.Sample
+
+	// Rewrite the keys in the index to the paths in the Artifact, while
+	// recording the object key of every rewritten path to fetch it.
+	objectKeys, err := applyPathRewrites(rewrites, index)
+	if err != nil {
+		e := &serror.Event{Err: err, Reason: bucketv1.PathRewriteFailedReason}
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
+	// Handle objects with keys which only differ in case before any are
+	// fetched, as these collide on case-insensitive file systems.
+	if err = applyCaseCollisionPolicy(obj.Spec.CaseCollisionPolicy, index); err != nil {
+		e := &serror.Event{Err: err, Reason: bucketv1.KeyCaseCollisionReason}
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
+	// When the revision is computed from the content of the objects, all
+	// objects must be fetched to determine if the revision changed.
+	contentRevision := obj.Spec.RevisionStrategy == bucketv1.BucketRevisionStrategyContent
+	if contentRevision {
+		if err = fetchIndexFiles(ctx, provider, obj, index, objectKeys, dir, r.maxConcurrentFetches); err != nil {
+			e := &serror.Event{Err: err, Reason: bucketv1.BucketOperationFailedReason}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+			return sreconcile.ResultEmpty, e
+		}
+		if err = contentDigestIndex(index, dir); err != nil {
+			e := &serror.Event{Err: err, Reason: bucketv1.BucketOperationFailedReason}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+			return sreconcile.ResultEmpty, e
+		}
+	}
 
 	// Check if index has changed compared to current Artifact revision.
 	var changed bool
 	if artifact := obj.Status.Artifact; artifact != nil && artifact.Revision != "" {
 		curRev := digest.Digest(artifact.Revision)
-		changed = curRev.Validate() != nil || curRev != index.Digest(curRev.Algorithm())
+		changed = curRev.Validate() != nil || curRev != index.Digest(curRev.Algorithm()) ||
+			digestAlgorithmChanged(artifact, obj.Spec.DigestAlgorithm)
 	}
 
 	// Fetch the bucket objects if required to.
@@ -480,10 +692,12 @@ func (r *BucketReconciler) reconcileSource(ctx context.Context, sp *patch.Serial
 			}
 		}()
 
-		if err = fetchIndexFiles(ctx, provider, obj, index, dir); err != nil {
-			e := &serror.Event{Err: err, Reason: bucketv1.BucketOperationFailedReason}
-			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
-			return sreconcile.ResultEmpty, e
+		if !contentRevision {
+			if err = fetchIndexFiles(ctx, provider, obj, index, objectKeys, dir, r.maxConcurrentFetches); err != nil {
+				e := &serror.Event{Err: err, Reason: bucketv1.BucketOperationFailedReason}
+				conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+				return sreconcile.ResultEmpty, e
+			}
 		}
 	}
 
@@ -511,7 +725,8 @@ func (r *BucketReconciler) reconcileArtifact(ctx context.Context, sp *patch.Seri
 	defer func() {
 		if curArtifact := obj.GetArtifact(); curArtifact != nil && curArtifact.Revision != "" {
 			curRev := digest.Digest(curArtifact.Revision)
-			if curRev.Validate() == nil && index.Digest(curRev.Algorithm()) == curRev {
+			if curRev.Validate() == nil && index.Digest(curRev.Algorithm()) == curRev &&
+				!digestAlgorithmChanged(curArtifact, obj.Spec.DigestAlgorithm) {
 				conditions.Delete(obj, sourcev1.ArtifactOutdatedCondition)
 				conditions.MarkTrue(obj, sourcev1.ArtifactInStorageCondition, meta.SucceededReason,
 					"stored artifact: revision '%s'", artifact.Revision)
@@ -522,7 +737,8 @@ func (r *BucketReconciler) reconcileArtifact(ctx context.Context, sp *patch.Seri
 	// The artifact is up-to-date
 	if curArtifact := obj.GetArtifact(); curArtifact != nil && curArtifact.Revision != "" {
 		curRev := digest.Digest(curArtifact.Revision)
-		if curRev.Validate() == nil && index.Digest(curRev.Algorithm()) == curRev {
+		if curRev.Validate() == nil && index.Digest(curRev.Algorithm()) == curRev &&
+			!digestAlgorithmChanged(curArtifact, obj.Spec.DigestAlgorithm) {
 			r.eventLogf(ctx, obj, eventv1.EventTypeTrace, sourcev1.ArtifactUpToDateReason, "artifact up-to-date with remote revision: '%s'", artifact.Revision)
 			return sreconcile.ResultSuccess, nil
 		}
@@ -545,6 +761,12 @@ func (r *BucketReconciler) reconcileArtifact(ctx context.Context, sp *patch.Seri
 		return sreconcile.ResultEmpty, e
 	}
 
+	// Consult the pre-store webhook before storing the artifact
+	if e := reviewArtifact(ctx, r.PreStoreWebhook, bucketv1.BucketKind, obj, artifact); e != nil {
+		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
 	// Ensure artifact directory exists and acquire lock
 	if err := r.Storage.MkdirAll(artifact); err != nil {
 		e := &serror.Event{
@@ -564,10 +786,11 @@ func (r *BucketReconciler) reconcileArtifact(ctx context.Context, sp *patch.Seri
 	defer unlock()
 
 	// Archive directory to storage
-	if err := r.Storage.Archive(&artifact, dir, nil); err != nil {
+	if err := r.Storage.Archive(&artifact, dir, nil, "", WithDigestAlgorithm(digest.Algorithm(obj.Spec.DigestAlgorithm)),
+		WithExpectedSize(artifactSize(obj.GetArtifact()))); err != nil {
 		e := &serror.Event{
 			Err:    fmt.Errorf("unable to archive artifact to storage: %s", err),
-			Reason: sourcev1.ArchiveOperationFailedReason,
+			Reason: storageFailedReason(err),
 		}
 		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
 		return sreconcile.ResultEmpty, e
@@ -614,7 +837,7 @@ func (r *BucketReconciler) reconcileDelete(ctx context.Context, obj *bucketv1.Bu
 // removal of all Artifacts for the objects.
 func (r *BucketReconciler) garbageCollect(ctx context.Context, obj *bucketv1.Bucket) error {
 	if !obj.DeletionTimestamp.IsZero() {
-		if deleted, err := r.Storage.RemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
+		if deleted, err := r.Storage.DeferRemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
 			return &serror.Event{
 				Err:    fmt.Errorf("garbage collection for deleted resource failed: %s", err),
 				Reason: "GarbageCollectionFailed",
@@ -627,7 +850,7 @@ func (r *BucketReconciler) garbageCollect(ctx context.Context, obj *bucketv1.Buc
 		return nil
 	}
 	if obj.GetArtifact() != nil {
-		delFiles, err := r.Storage.GarbageCollect(ctx, *obj.GetArtifact(), time.Second*5)
+		delFiles, err := r.Storage.GarbageCollect(ctx, *obj.GetArtifact(), obj.Spec.GC, time.Second*5)
 		if err != nil {
 			return &serror.Event{
 				Err:    fmt.Errorf("garbage collection of artifacts failed: %w", err),
@@ -686,11 +909,22 @@ func (r *BucketReconciler) annotatedEventLogf(ctx context.Context,
 	r.AnnotatedEventf(obj, annotations, eventType, reason, msg)
 }
 
+// objectPrefix returns the prefix of the keys of the objects of the given
+// Bucket, which ends with a slash unless it is empty.
+func objectPrefix(obj *bucketv1.Bucket) string {
+	if p := obj.Spec.Prefix; p != "" && !strings.HasSuffix(p, "/") {
+		return p + "/"
+	}
+	return obj.Spec.Prefix
+}
+
 // fetchEtagIndex fetches the current etagIndex for the in the obj specified
 // bucket using the given provider, while filtering them using .sourceignore
-// rules. After fetching an object, the etag value in the index is updated to
+// rules. The keys in the index are relative to the objectPrefix of the obj.
+// The keys of the ignored objects are recorded in ignored when it is
+// not nil. After fetching an object, the etag value in the index is updated to
 // the current value to ensure accuracy.
-func fetchEtagIndex(ctx context.Context, provider BucketProvider, obj *bucketv1.Bucket, index *index.Digester, tempDir string) error {
+func fetchEtagIndex(ctx context.Context, provider BucketProvider, obj *bucketv1.Bucket, index *index.Digester, ignored *IgnoredPaths, tempDir string) error {
 	ctxTimeout, cancel := context.WithTimeout(ctx, obj.Spec.Timeout.Duration)
 	defer cancel()
 
@@ -705,8 +939,9 @@ func fetchEtagIndex(ctx context.Context, provider BucketProvider, obj *bucketv1.
 	}
 
 	// Look for file with ignore rules first
+	prefix := objectPrefix(obj)
 	path := filepath.Join(tempDir, sourceignore.IgnoreFile)
-	if _, err := provider.FGetObject(ctxTimeout, obj.Spec.BucketName, sourceignore.IgnoreFile, path); err != nil {
+	if _, err := provider.FGetObject(ctxTimeout, obj.Spec.BucketName, prefix+sourceignore.IgnoreFile, path); err != nil {
 		if !provider.ObjectIsNotFound(err) {
 			return err
 		}
@@ -723,11 +958,18 @@ func fetchEtagIndex(ctx context.Context, provider BucketProvider, obj *bucketv1.
 
 	// Build up index
 	err = provider.VisitObjects(ctxTimeout, obj.Spec.BucketName, func(key, etag string) error {
-		if strings.HasSuffix(key, "/") || key == sourceignore.IgnoreFile {
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		key = strings.TrimPrefix(key, prefix)
+		if key == "" || strings.HasSuffix(key, "/") || key == sourceignore.IgnoreFile {
 			return nil
 		}
 
 		if matcher.Match(strings.Split(key, "/"), false) {
+			if ignored != nil {
+				ignored.Add(key, false)
+			}
 			return nil
 		}
 
@@ -740,51 +982,269 @@ func fetchEtagIndex(ctx context.Context, provider BucketProvider, obj *bucketv1.
 	return nil
 }
 
+// bucketConsistencyRetryInterval is the delay after which the objects of a
+// Bucket are listed again to confirm the previous listing.
+var bucketConsistencyRetryInterval = 2 * time.Second
+
+// fetchConsistentEtagIndex fetches the etagIndex like fetchEtagIndex. When
+// obj.Spec.ConsistencyRetries is set, it lists the objects again after
+// bucketConsistencyRetryInterval until two consecutive listings agree, and
+// returns an error if they do not within the retries. The etagIndex and
+// ignored keys are set to those of the last listing.
+func fetchConsistentEtagIndex(ctx context.Context, provider BucketProvider, obj *bucketv1.Bucket, etagIndex *index.Digester, ignored *IgnoredPaths, tempDir string) error {
+	if err := fetchEtagIndex(ctx, provider, obj, etagIndex, ignored, tempDir); err != nil {
+		return err
+	}
+
+	for i := int32(0); i < obj.Spec.ConsistencyRetries; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(bucketConsistencyRetryInterval):
+		}
+
+		next := index.NewDigester()
+		var nextIgnored *IgnoredPaths
+		if ignored != nil {
+			nextIgnored = &IgnoredPaths{SampleSize: ignored.SampleSize}
+		}
+		if err := fetchEtagIndex(ctx, provider, obj, next, nextIgnored, tempDir); err != nil {
+			return err
+		}
+		if ignored != nil {
+			*ignored = *nextIgnored
+		}
+		if next.Digest(intdigest.Canonical) == etagIndex.Digest(intdigest.Canonical) {
+			return nil
+		}
+
+		ctrl.LoggerFrom(ctx).Info(fmt.Sprintf("listing of '%s' bucket changed, confirming listing again", obj.Spec.BucketName))
+		for k := range etagIndex.Index() {
+			etagIndex.Delete(k)
+		}
+		for k, v := range next.Index() {
+			etagIndex.Add(k, v)
+		}
+	}
+
+	if obj.Spec.ConsistencyRetries > 0 {
+		return fmt.Errorf("listings of '%s' bucket did not agree within %d consistency retries",
+			obj.Spec.BucketName, obj.Spec.ConsistencyRetries)
+	}
+	return nil
+}
+
 // fetchIndexFiles fetches the object files for the keys from the given etagIndex
-// using the given provider, and stores them into tempDir. It downloads in
-// parallel, but limited to the maxConcurrentBucketFetches.
+// using the given provider, and stores them into tempDir. Keys present in
+// objectKeys are fetched from the object key they map to, and all keys are
+// relative to the objectPrefix of the obj. It downloads in
+// parallel, but limited to maxConcurrent objects at a time.
 // Given an index is provided, the bucket is assumed to exist.
-func fetchIndexFiles(ctx context.Context, provider BucketProvider, obj *bucketv1.Bucket, index *index.Digester, tempDir string) error {
+func fetchIndexFiles(ctx context.Context, provider BucketProvider, obj *bucketv1.Bucket, index *index.Digester, objectKeys map[string]string, tempDir string, maxConcurrent int) error {
 	ctxTimeout, cancel := context.WithTimeout(ctx, obj.Spec.Timeout.Duration)
 	defer cancel()
 
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultMaxConcurrentBucketFetches
+	}
+
 	// Download in parallel, but bound the concurrency. According to
 	// AWS and GCP docs, rate limits are either soft or don't exist:
 	//  - https://cloud.google.com/storage/quotas
 	//  - https://docs.aws.amazon.com/general/latest/gr/s3.html
 	// .. so, the limiting factor is this process keeping a small footprint.
-	group, groupCtx := errgroup.WithContext(ctx)
-	group.Go(func() error {
-		sem := semaphore.NewWeighted(maxConcurrentBucketFetches)
-		for key, etag := range index.Index() {
-			k := key
-			t := etag
-			if err := sem.Acquire(groupCtx, 1); err != nil {
-				return err
+	// The first failure cancels the downloads in progress, and the errors of
+	// all failed downloads are returned. As the objects are written to their
+	// own paths, the order of the downloads does not affect the Artifact.
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	prefix := objectPrefix(obj)
+	sem := semaphore.NewWeighted(int64(maxConcurrent))
+	var aborted error
+	for key, etag := range index.Index() {
+		if aborted = sem.Acquire(ctxTimeout, 1); aborted != nil {
+			break
+		}
+		wg.Add(1)
+		go func(k, t string) {
+			defer wg.Done()
+			defer sem.Release(1)
+			localPath := filepath.Join(tempDir, k)
+			objectKey := k
+			if o, ok := objectKeys[k]; ok {
+				objectKey = o
 			}
-			group.Go(func() error {
-				defer sem.Release(1)
-				localPath := filepath.Join(tempDir, k)
-				etag, err := provider.FGetObject(ctxTimeout, obj.Spec.BucketName, k, localPath)
-				if err != nil {
-					if provider.ObjectIsNotFound(err) {
-						ctrl.LoggerFrom(ctx).Info(fmt.Sprintf("indexed object '%s' disappeared from '%s' bucket", k, obj.Spec.BucketName))
-						index.Delete(k)
-						return nil
-					}
-					return fmt.Errorf("failed to get '%s' object: %w", k, err)
+			objectKey = prefix + objectKey
+			etag, err := provider.FGetObject(ctxTimeout, obj.Spec.BucketName, objectKey, localPath)
+			if err != nil {
+				if provider.ObjectIsNotFound(err) {
+					ctrl.LoggerFrom(ctx).Info(fmt.Sprintf("indexed object '%s' disappeared from '%s' bucket", objectKey, obj.Spec.BucketName))
+					index.Delete(k)
+					return
 				}
-				if t != etag {
-					index.Add(k, etag)
+				mu.Lock()
+				defer mu.Unlock()
+				// Downloads cancelled due to an earlier failure are not
+				// reported.
+				if len(errs) > 0 && errors.Is(err, context.Canceled) {
+					return
 				}
-				return nil
-			})
+				errs = append(errs, fmt.Errorf("failed to get '%s' object: %w", objectKey, err))
+				cancel()
+				return
+			}
+			if t != etag {
+				index.Add(k, etag)
+			}
+		}(key, etag)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 && aborted != nil {
+		errs = append(errs, aborted)
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return fmt.Errorf("fetch from bucket '%s' failed: %w", obj.Spec.BucketName, kerrors.NewAggregate(errs))
+	}
+	return nil
+}
+
+// pathRewrite is a compiled bucketv1.BucketPathRewrite rule.
+type pathRewrite struct {
+	match   *regexp.Regexp
+	replace string
+}
+
+// newPathRewrites compiles the given bucketv1.BucketPathRewrite rules. It
+// returns an error for the first rule which is not a valid regular
+// expression.
+func newPathRewrites(rules []bucketv1.BucketPathRewrite) ([]pathRewrite, error) {
+	rewrites := make([]pathRewrite, 0, len(rules))
+	for i, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path rewrite rule %d: %w", i, err)
+		}
+		rewrites = append(rewrites, pathRewrite{match: re, replace: rule.Replace})
+	}
+	return rewrites, nil
+}
+
+// applyPathRewrites rewrites the keys in the given index using the given
+// rules, in order. Keys which are rewritten to an empty path are removed from
+// the index. It returns a map of the rewritten paths to the object keys they
+// were rewritten from, or an error when multiple keys are rewritten to the
+// same path, or a key is rewritten to a path outside the Artifact.
+func applyPathRewrites(rewrites []pathRewrite, index *index.Digester) (map[string]string, error) {
+	if len(rewrites) == 0 {
+		return nil, nil
+	}
+
+	entries := index.Index()
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	paths := make(map[string]string, len(keys))
+	for _, k := range keys {
+		p := k
+		for _, r := range rewrites {
+			p = r.match.ReplaceAllString(p, r.replace)
+		}
+		if p = strings.TrimLeft(p, "/"); p != "" {
+			p = path.Clean(p)
+			if p == ".." || strings.HasPrefix(p, "../") {
+				return nil, fmt.Errorf("object key '%s' is rewritten to '%s', which is outside the artifact", k, p)
+			}
+		}
+		if o, ok := paths[p]; ok && p != "" {
+			return nil, fmt.Errorf("object keys '%s' and '%s' are rewritten to the same path '%s'", o, k, p)
+		}
+		paths[p] = k
+	}
+
+	for _, k := range keys {
+		index.Delete(k)
+	}
+	objectKeys := make(map[string]string, len(paths))
+	for p, k := range paths {
+		if p == "" {
+			continue
+		}
+		index.Add(p, entries[k])
+		if p != k {
+			objectKeys[p] = k
+		}
+	}
+	return objectKeys, nil
+}
+
+// applyCaseCollisionPolicy applies the given bucketv1.Bucket case collision
+// policy to the keys in the given index which only differ in case.
+// With BucketCaseCollisionPolicyFail, it returns an error listing the
+// colliding keys. With BucketCaseCollisionPolicyKeepFirst, it removes all but
+// the key which sorts first in byte order from the index. Any other policy
+// leaves the index as is.
+func applyCaseCollisionPolicy(policy string, index *index.Digester) error {
+	if policy != bucketv1.BucketCaseCollisionPolicyFail && policy != bucketv1.BucketCaseCollisionPolicyKeepFirst {
+		return nil
+	}
+
+	keys := make([]string, 0, index.Len())
+	for k := range index.Index() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	folded := make(map[string][]string, len(keys))
+	var collisions []string
+	for _, k := range keys {
+		f := strings.ToLower(k)
+		if len(folded[f]) == 1 {
+			collisions = append(collisions, f)
 		}
+		folded[f] = append(folded[f], k)
+	}
+	if len(collisions) == 0 {
 		return nil
-	})
-	if err := group.Wait(); err != nil {
-		return fmt.Errorf("fetch from bucket '%s' failed: %w", obj.Spec.BucketName, err)
 	}
 
+	if policy == bucketv1.BucketCaseCollisionPolicyFail {
+		var msgs []string
+		for _, f := range collisions {
+			msgs = append(msgs, fmt.Sprintf("'%s'", strings.Join(folded[f], "', '")))
+		}
+		return fmt.Errorf("bucket contains objects with keys which only differ in case: %s", strings.Join(msgs, "; "))
+	}
+	for _, f := range collisions {
+		for _, k := range folded[f][1:] {
+			index.Delete(k)
+		}
+	}
+	return nil
+}
+
+// contentDigestIndex replaces the etag values in the given index with the
+// digests of the content of the objects fetched into tempDir, making the
+// revision computed from the index independent of any object metadata.
+func contentDigestIndex(index *index.Digester, tempDir string) error {
+	for key := range index.Index() {
+		f, err := os.Open(filepath.Join(tempDir, key))
+		if err != nil {
+			return fmt.Errorf("failed to open '%s' object: %w", key, err)
+		}
+		d, err := intdigest.Canonical.FromReader(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to compute digest of '%s' object: %w", key, err)
+		}
+		index.Add(key, d.Encoded())
+	}
 	return nil
 }
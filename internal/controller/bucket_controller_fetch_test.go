@@ -21,6 +21,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,6 +31,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta2"
+	intdigest "github.com/fluxcd/source-controller/internal/digest"
 	"github.com/fluxcd/source-controller/internal/index"
 )
 
@@ -116,7 +120,7 @@ func Test_fetchEtagIndex(t *testing.T) {
 		client.addObject("baz.yaml", mockBucketObject{data: "baz.yaml", etag: "etag3"})
 
 		index := index.NewDigester()
-		err := fetchEtagIndex(context.TODO(), client, bucket.DeepCopy(), index, tmp)
+		err := fetchEtagIndex(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -130,7 +134,7 @@ func Test_fetchEtagIndex(t *testing.T) {
 		client := mockBucketClient{bucketName: "other-bucket-name"}
 
 		index := index.NewDigester()
-		err := fetchEtagIndex(context.TODO(), client, bucket.DeepCopy(), index, tmp)
+		err := fetchEtagIndex(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp)
 		assert.ErrorContains(t, err, "not found")
 	})
 
@@ -143,7 +147,7 @@ func Test_fetchEtagIndex(t *testing.T) {
 		client.addObject("foo.txt", mockBucketObject{etag: "etag2", data: "foo.txt"})
 
 		index := index.NewDigester()
-		err := fetchEtagIndex(context.TODO(), client, bucket.DeepCopy(), index, tmp)
+		err := fetchEtagIndex(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -170,7 +174,7 @@ func Test_fetchEtagIndex(t *testing.T) {
 		bucket.Spec.Ignore = &ignore
 
 		index := index.NewDigester()
-		err := fetchEtagIndex(context.TODO(), client, bucket.DeepCopy(), index, tmp)
+		err := fetchEtagIndex(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -184,6 +188,164 @@ func Test_fetchEtagIndex(t *testing.T) {
 			t.Error(fmt.Errorf("expected 'foo.txt' index item to exist"))
 		}
 	})
+
+	t.Run("records ignored object keys", func(t *testing.T) {
+		tmp := t.TempDir()
+
+		client := mockBucketClient{bucketName: bucketName}
+		client.addObject(".sourceignore", mockBucketObject{etag: "sourceignore1", data: `*.txt`})
+		client.addObject("foo.yaml", mockBucketObject{etag: "etag1", data: "foo.yaml"})
+		client.addObject("foo.txt", mockBucketObject{etag: "etag2", data: "foo.txt"})
+		client.addObject("bar/bar.txt", mockBucketObject{etag: "etag3", data: "bar.txt"})
+
+		index := index.NewDigester()
+		ignored := &IgnoredPaths{SampleSize: 5}
+		err := fetchEtagIndex(context.TODO(), client, bucket.DeepCopy(), index, ignored, tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, index.Len(), 1)
+		assert.Equal(t, ignored.Count, int64(2))
+		sort.Strings(ignored.Sample)
+		assert.DeepEqual(t, ignored.Sample, []string{"bar/bar.txt", "foo.txt"})
+	})
+
+	t.Run("indexes objects relative to prefix", func(t *testing.T) {
+		tmp := t.TempDir()
+
+		client := mockBucketClient{bucketName: bucketName}
+		client.addObject("clusters/prod/.sourceignore", mockBucketObject{etag: "sourceignore1", data: `*.txt`})
+		client.addObject("clusters/prod/foo.yaml", mockBucketObject{etag: "etag1", data: "foo.yaml"})
+		client.addObject("clusters/prod/foo.txt", mockBucketObject{etag: "etag2", data: "foo.txt"})
+		client.addObject("clusters/prod/", mockBucketObject{etag: "etag3"})
+		client.addObject("clusters/production/foo.yaml", mockBucketObject{etag: "etag4", data: "foo.yaml"})
+		client.addObject("foo.yaml", mockBucketObject{etag: "etag5", data: "foo.yaml"})
+
+		bucket := bucket.DeepCopy()
+		bucket.Spec.Prefix = "clusters/prod"
+
+		index := index.NewDigester()
+		err := fetchEtagIndex(context.TODO(), client, bucket, index, nil, tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(filepath.Join(tmp, ".sourceignore")); err != nil {
+			t.Error(err)
+		}
+		assert.DeepEqual(t, index.Index(), map[string]string{"foo.yaml": "etag1"})
+	})
+}
+
+// changingListingBucketClient is a mockBucketClient of which the objects
+// change to the next of the listings on every listing, until the last.
+type changingListingBucketClient struct {
+	mockBucketClient
+	listings []map[string]mockBucketObject
+	listed   int
+}
+
+func (m *changingListingBucketClient) VisitObjects(ctx context.Context, bucket string, f func(key, etag string) error) error {
+	m.objects = m.listings[m.listed]
+	if m.listed < len(m.listings)-1 {
+		m.listed++
+	}
+	return m.mockBucketClient.VisitObjects(ctx, bucket, f)
+}
+
+func Test_fetchConsistentEtagIndex(t *testing.T) {
+	bucketName := "all-my-config"
+
+	interval := bucketConsistencyRetryInterval
+	bucketConsistencyRetryInterval = time.Millisecond
+	t.Cleanup(func() {
+		bucketConsistencyRetryInterval = interval
+	})
+
+	listings := []map[string]mockBucketObject{
+		{
+			"foo.yaml": {etag: "etag1", data: "foo.yaml"},
+		},
+		{
+			"foo.yaml": {etag: "etag1", data: "foo.yaml"},
+			"bar.yaml": {etag: "etag2", data: "bar.yaml"},
+		},
+		{
+			"foo.yaml": {etag: "etag1", data: "foo.yaml"},
+			"bar.yaml": {etag: "etag2", data: "bar.yaml"},
+			"baz.txt":  {etag: "etag3", data: "baz.txt"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		retries     int32
+		wantListed  int
+		wantKeys    []string
+		wantIgnored int64
+		wantErr     string
+	}{
+		{
+			name:       "lists once without retries",
+			retries:    0,
+			wantListed: 1,
+			wantKeys:   []string{"foo.yaml"},
+		},
+		{
+			name:    "fails when listings do not agree within retries",
+			retries: 1,
+			wantErr: "listings of 'all-my-config' bucket did not agree within 1 consistency retries",
+		},
+		{
+			name:        "confirms listing once it stabilizes",
+			retries:     3,
+			wantListed:  2,
+			wantKeys:    []string{"bar.yaml", "foo.yaml"},
+			wantIgnored: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+
+			bucket := sourcev1.Bucket{
+				Spec: sourcev1.BucketSpec{
+					BucketName:         bucketName,
+					Timeout:            &metav1.Duration{Duration: 1 * time.Hour},
+					ConsistencyRetries: tt.retries,
+				},
+			}
+			ignore := "*.txt"
+			bucket.Spec.Ignore = &ignore
+
+			client := &changingListingBucketClient{
+				mockBucketClient: mockBucketClient{bucketName: bucketName},
+				listings:         listings,
+			}
+
+			index := index.NewDigester()
+			ignored := &IgnoredPaths{SampleSize: 5}
+			err := fetchConsistentEtagIndex(context.TODO(), client, bucket.DeepCopy(), index, ignored, tmp)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, client.listed, tt.wantListed)
+			var keys []string
+			for k := range index.Index() {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			assert.DeepEqual(t, keys, tt.wantKeys)
+			assert.Equal(t, ignored.Count, tt.wantIgnored)
+		})
+	}
 }
 
 func Test_fetchFiles(t *testing.T) {
@@ -206,7 +368,7 @@ func Test_fetchFiles(t *testing.T) {
 
 		index := client.objectsToDigestIndex()
 
-		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, tmp)
+		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp, 0)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -220,13 +382,43 @@ func Test_fetchFiles(t *testing.T) {
 		}
 	})
 
+	t.Run("fetches files relative to prefix", func(t *testing.T) {
+		tmp := t.TempDir()
+
+		client := mockBucketClient{bucketName: bucketName}
+		client.addObject("clusters/prod/foo.yaml", mockBucketObject{data: "foo", etag: "etag1"})
+		client.addObject("clusters/prod/bar/bar.yaml", mockBucketObject{data: "bar", etag: "etag2"})
+
+		bucket := bucket.DeepCopy()
+		bucket.Spec.Prefix = "clusters/prod/"
+
+		index := index.NewDigester()
+		index.Add("foo.yaml", "etag1")
+		index.Add("baz.yaml", "etag2")
+		objectKeys := map[string]string{"baz.yaml": "bar/bar.yaml"}
+
+		err := fetchIndexFiles(context.TODO(), client, bucket, index, objectKeys, tmp, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for path, want := range map[string]string{"foo.yaml": "foo", "baz.yaml": "bar"} {
+			b, err := os.ReadFile(filepath.Join(tmp, path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, string(b), want)
+		}
+		assert.Equal(t, index.Len(), 2)
+	})
+
 	t.Run("an error while fetching returns an error for the whole procedure", func(t *testing.T) {
 		tmp := t.TempDir()
 
 		client := mockBucketClient{bucketName: bucketName, objects: map[string]mockBucketObject{}}
 		client.objects["error"] = mockBucketObject{}
 
-		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), client.objectsToDigestIndex(), tmp)
+		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), client.objectsToDigestIndex(), nil, tmp, 0)
 		if err == nil {
 			t.Fatal("expected error but got nil")
 		}
@@ -240,7 +432,7 @@ func Test_fetchFiles(t *testing.T) {
 
 		index := index.NewDigester()
 		index.Add("foo.yaml", "etag1")
-		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, tmp)
+		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp, 0)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -259,7 +451,7 @@ func Test_fetchFiles(t *testing.T) {
 		// Does not exist on server
 		index.Add("bar.yaml", "etag2")
 
-		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, tmp)
+		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp, 0)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -273,15 +465,334 @@ func Test_fetchFiles(t *testing.T) {
 		tmp := t.TempDir()
 
 		client := mockBucketClient{bucketName: bucketName}
-		for i := 0; i < 2*maxConcurrentBucketFetches; i++ {
+		for i := 0; i < 2*defaultMaxConcurrentBucketFetches; i++ {
 			f := fmt.Sprintf("file-%d", i)
 			client.addObject(f, mockBucketObject{etag: f, data: f})
 		}
 		index := client.objectsToDigestIndex()
 
-		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, tmp)
+		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp, 0)
 		if err != nil {
 			t.Fatal(err)
 		}
 	})
+
+	t.Run("limits the number of concurrent fetches", func(t *testing.T) {
+		tmp := t.TempDir()
+
+		client := &concurrencyBucketClient{mockBucketClient: mockBucketClient{bucketName: bucketName}}
+		for i := 0; i < 20; i++ {
+			f := fmt.Sprintf("file-%d", i)
+			client.addObject(f, mockBucketObject{etag: f, data: f})
+		}
+		index := client.objectsToDigestIndex()
+
+		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Check(t, client.max <= 3, "fetched %d objects concurrently", client.max)
+		assert.Check(t, client.max > 1, "fetched objects sequentially")
+	})
+
+	t.Run("errors cancel the other fetches and are aggregated", func(t *testing.T) {
+		tmp := t.TempDir()
+
+		client := blockingBucketClient{mockBucketClient: mockBucketClient{bucketName: bucketName}}
+		for _, f := range []string{"error-1", "error-2", "block-1", "block-2", "block-3"} {
+			client.addObject(f, mockBucketObject{etag: f, data: f})
+		}
+		index := client.objectsToDigestIndex()
+
+		err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp, 10)
+		assert.ErrorContains(t, err, "fetch from bucket 'all-my-config' failed: [failed to get 'error-1' object: I was asked to report an error, failed to get 'error-2' object: I was asked to report an error]")
+	})
+}
+
+// concurrencyBucketClient records the maximum number of concurrent calls to
+// FGetObject.
+type concurrencyBucketClient struct {
+	mockBucketClient
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (m *concurrencyBucketClient) FGetObject(ctx context.Context, bucket, obj, path string) (string, error) {
+	m.mu.Lock()
+	m.current++
+	if m.current > m.max {
+		m.max = m.current
+	}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.current--
+		m.mu.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	return m.mockBucketClient.FGetObject(ctx, bucket, obj, path)
+}
+
+// blockingBucketClient fails to get objects with an "error" prefix, and
+// blocks getting objects with a "block" prefix until the context is done.
+type blockingBucketClient struct {
+	mockBucketClient
+}
+
+func (m blockingBucketClient) FGetObject(ctx context.Context, bucket, obj, path string) (string, error) {
+	switch {
+	case strings.HasPrefix(obj, "error"):
+		return "", fmt.Errorf("I was asked to report an error")
+	case strings.HasPrefix(obj, "block"):
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return m.mockBucketClient.FGetObject(ctx, bucket, obj, path)
+}
+
+func Test_applyCaseCollisionPolicy(t *testing.T) {
+	newIndex := func() *index.Digester {
+		return index.NewDigester(index.WithIndex(map[string]string{
+			"config/app.yaml": "etag1",
+			"Config/app.yaml": "etag2",
+			"config/APP.yaml": "etag3",
+			"README.md":       "etag4",
+			"readme.md":       "etag5",
+			"unique.yaml":     "etag6",
+		}))
+	}
+
+	t.Run("allow leaves colliding keys", func(t *testing.T) {
+		index := newIndex()
+		assert.NilError(t, applyCaseCollisionPolicy(sourcev1.BucketCaseCollisionPolicyAllow, index))
+		assert.Equal(t, index.Len(), 6)
+		assert.NilError(t, applyCaseCollisionPolicy("", index))
+		assert.Equal(t, index.Len(), 6)
+	})
+
+	t.Run("fail reports colliding keys", func(t *testing.T) {
+		index := newIndex()
+		err := applyCaseCollisionPolicy(sourcev1.BucketCaseCollisionPolicyFail, index)
+		assert.Error(t, err, "bucket contains objects with keys which only differ in case: "+
+			"'Config/app.yaml', 'config/APP.yaml', 'config/app.yaml'; 'README.md', 'readme.md'")
+		assert.Equal(t, index.Len(), 6)
+	})
+
+	t.Run("keep first removes all but first key", func(t *testing.T) {
+		index := newIndex()
+		assert.NilError(t, applyCaseCollisionPolicy(sourcev1.BucketCaseCollisionPolicyKeepFirst, index))
+		assert.DeepEqual(t, index.Index(), map[string]string{
+			"Config/app.yaml": "etag2",
+			"README.md":       "etag4",
+			"unique.yaml":     "etag6",
+		})
+	})
+
+	t.Run("no collisions", func(t *testing.T) {
+		index := index.NewDigester(index.WithIndex(map[string]string{"a.yaml": "etag1", "b.yaml": "etag2"}))
+		assert.NilError(t, applyCaseCollisionPolicy(sourcev1.BucketCaseCollisionPolicyFail, index))
+		assert.Equal(t, index.Len(), 2)
+	})
+}
+
+func Test_newPathRewrites(t *testing.T) {
+	t.Run("compiles rules", func(t *testing.T) {
+		rewrites, err := newPathRewrites([]sourcev1.BucketPathRewrite{
+			{Match: "^env/prod/"},
+			{Match: "(.*)\\.yml$", Replace: "$1.yaml"},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, len(rewrites), 2)
+	})
+
+	t.Run("reports invalid rule", func(t *testing.T) {
+		_, err := newPathRewrites([]sourcev1.BucketPathRewrite{
+			{Match: "^env/"},
+			{Match: "(unclosed"},
+		})
+		assert.ErrorContains(t, err, "invalid path rewrite rule 1: error parsing regexp")
+	})
+}
+
+func Test_applyPathRewrites(t *testing.T) {
+	newIndex := func() *index.Digester {
+		return index.NewDigester(index.WithIndex(map[string]string{
+			"env/prod/app.yaml":       "etag1",
+			"env/prod/config/db.yml":  "etag2",
+			"env/staging/app.yaml":    "etag3",
+			"manifests/frontend.yaml": "etag4",
+			"manifests/backend.yaml":  "etag5",
+			"manifests/nested/x.yaml": "etag6",
+			"unchanged/readme.md":     "etag7",
+		}))
+	}
+	rewrite := func(t *testing.T, rules ...sourcev1.BucketPathRewrite) ([]pathRewrite, *index.Digester) {
+		rewrites, err := newPathRewrites(rules)
+		assert.NilError(t, err)
+		return rewrites, newIndex()
+	}
+
+	t.Run("no rules leaves index as is", func(t *testing.T) {
+		rewrites, index := rewrite(t)
+		objectKeys, err := applyPathRewrites(rewrites, index)
+		assert.NilError(t, err)
+		assert.Equal(t, len(objectKeys), 0)
+		assert.DeepEqual(t, index.Index(), newIndex().Index())
+	})
+
+	t.Run("strips prefix", func(t *testing.T) {
+		rewrites, index := rewrite(t, sourcev1.BucketPathRewrite{Match: "^env/prod/"})
+		objectKeys, err := applyPathRewrites(rewrites, index)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, index.Index(), map[string]string{
+			"app.yaml":                "etag1",
+			"config/db.yml":           "etag2",
+			"env/staging/app.yaml":    "etag3",
+			"manifests/frontend.yaml": "etag4",
+			"manifests/backend.yaml":  "etag5",
+			"manifests/nested/x.yaml": "etag6",
+			"unchanged/readme.md":     "etag7",
+		})
+		assert.DeepEqual(t, objectKeys, map[string]string{
+			"app.yaml":      "env/prod/app.yaml",
+			"config/db.yml": "env/prod/config/db.yml",
+		})
+	})
+
+	t.Run("rewrites with capture groups in order", func(t *testing.T) {
+		rewrites, index := rewrite(t,
+			sourcev1.BucketPathRewrite{Match: "^manifests/([^/]+)\\.yaml$", Replace: "apps/$1/manifest.yaml"},
+			sourcev1.BucketPathRewrite{Match: "^(?P<env>[^/]+)/(?P<name>[^/]+)/(.*)\\.yml$", Replace: "${name}/${3}.yaml"},
+		)
+		objectKeys, err := applyPathRewrites(rewrites, index)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, index.Index(), map[string]string{
+			"env/prod/app.yaml":           "etag1",
+			"prod/config/db.yaml":         "etag2",
+			"env/staging/app.yaml":        "etag3",
+			"apps/frontend/manifest.yaml": "etag4",
+			"apps/backend/manifest.yaml":  "etag5",
+			"manifests/nested/x.yaml":     "etag6",
+			"unchanged/readme.md":         "etag7",
+		})
+		assert.DeepEqual(t, objectKeys, map[string]string{
+			"prod/config/db.yaml":         "env/prod/config/db.yml",
+			"apps/frontend/manifest.yaml": "manifests/frontend.yaml",
+			"apps/backend/manifest.yaml":  "manifests/backend.yaml",
+		})
+	})
+
+	t.Run("excludes keys rewritten to empty path", func(t *testing.T) {
+		rewrites, index := rewrite(t, sourcev1.BucketPathRewrite{Match: "^env/staging/.*$"})
+		_, err := applyPathRewrites(rewrites, index)
+		assert.NilError(t, err)
+		assert.Equal(t, index.Len(), 6)
+		assert.Assert(t, !index.Has("env/staging/app.yaml"))
+	})
+
+	t.Run("reports keys rewritten to same path", func(t *testing.T) {
+		rewrites, index := rewrite(t, sourcev1.BucketPathRewrite{Match: "^env/[^/]+/"})
+		_, err := applyPathRewrites(rewrites, index)
+		assert.Error(t, err, "object keys 'env/prod/app.yaml' and 'env/staging/app.yaml' are rewritten to the same path 'app.yaml'")
+		assert.Equal(t, index.Len(), 7)
+	})
+
+	t.Run("reports keys rewritten outside artifact", func(t *testing.T) {
+		rewrites, index := rewrite(t, sourcev1.BucketPathRewrite{Match: "^unchanged/", Replace: "../"})
+		_, err := applyPathRewrites(rewrites, index)
+		assert.Error(t, err, "object key 'unchanged/readme.md' is rewritten to '../readme.md', which is outside the artifact")
+		assert.Equal(t, index.Len(), 7)
+	})
+
+	t.Run("fetches rewritten paths from object keys", func(t *testing.T) {
+		tmp := t.TempDir()
+
+		client := mockBucketClient{bucketName: "all-my-config"}
+		client.addObject("env/prod/app.yaml", mockBucketObject{data: "app", etag: "etag1"})
+		client.addObject("other.yaml", mockBucketObject{data: "other", etag: "etag2"})
+		index := client.objectsToDigestIndex()
+
+		rewrites, err := newPathRewrites([]sourcev1.BucketPathRewrite{{Match: "^env/prod/"}})
+		assert.NilError(t, err)
+		objectKeys, err := applyPathRewrites(rewrites, index)
+		assert.NilError(t, err)
+
+		bucket := sourcev1.Bucket{
+			Spec: sourcev1.BucketSpec{
+				BucketName: "all-my-config",
+				Timeout:    &metav1.Duration{Duration: 1 * time.Hour},
+			},
+		}
+		assert.NilError(t, fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, objectKeys, tmp, 0))
+		assert.DeepEqual(t, index.Index(), map[string]string{"app.yaml": "etag1", "other.yaml": "etag2"})
+		for p, want := range map[string]string{"app.yaml": "app", "other.yaml": "other"} {
+			b, err := os.ReadFile(filepath.Join(tmp, p))
+			assert.NilError(t, err)
+			assert.Equal(t, string(b), want)
+		}
+	})
+}
+
+func Test_contentDigestIndex(t *testing.T) {
+	bucketName := "all-my-config"
+
+	bucket := sourcev1.Bucket{
+		Spec: sourcev1.BucketSpec{
+			BucketName:       bucketName,
+			Timeout:          &metav1.Duration{Duration: 1 * time.Hour},
+			RevisionStrategy: sourcev1.BucketRevisionStrategyContent,
+		},
+	}
+
+	revision := func(t *testing.T, client mockBucketClient) string {
+		tmp := t.TempDir()
+		index := client.objectsToDigestIndex()
+		if err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := contentDigestIndex(index, tmp); err != nil {
+			t.Fatal(err)
+		}
+		return index.Digest(intdigest.Canonical).String()
+	}
+
+	client := mockBucketClient{bucketName: bucketName}
+	client.addObject("foo.yaml", mockBucketObject{data: "foo.yaml", etag: "etag1"})
+	client.addObject("bar.yaml", mockBucketObject{data: "bar.yaml", etag: "etag2"})
+	rev := revision(t, client)
+
+	t.Run("replaces etags with content digests", func(t *testing.T) {
+		tmp := t.TempDir()
+		index := client.objectsToDigestIndex()
+		if err := fetchIndexFiles(context.TODO(), client, bucket.DeepCopy(), index, nil, tmp, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := contentDigestIndex(index, tmp); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, index.Get("foo.yaml"), intdigest.Canonical.FromString("foo.yaml").Encoded())
+		assert.Equal(t, index.Get("bar.yaml"), intdigest.Canonical.FromString("bar.yaml").Encoded())
+	})
+
+	t.Run("revision is stable when only metadata changes", func(t *testing.T) {
+		changed := mockBucketClient{bucketName: bucketName}
+		changed.addObject("foo.yaml", mockBucketObject{data: "foo.yaml", etag: "etag3"})
+		changed.addObject("bar.yaml", mockBucketObject{data: "bar.yaml", etag: "etag4"})
+		assert.Equal(t, revision(t, changed), rev)
+	})
+
+	t.Run("revision changes when content changes", func(t *testing.T) {
+		changed := mockBucketClient{bucketName: bucketName}
+		changed.addObject("foo.yaml", mockBucketObject{data: "changed", etag: "etag1"})
+		changed.addObject("bar.yaml", mockBucketObject{data: "bar.yaml", etag: "etag2"})
+		assert.Check(t, revision(t, changed) != rev)
+	})
+
+	t.Run("returns an error for objects which were not fetched", func(t *testing.T) {
+		index := client.objectsToDigestIndex()
+		if err := contentDigestIndex(index, t.TempDir()); err == nil {
+			t.Fatal("expected error but got nil")
+		}
+	})
 }
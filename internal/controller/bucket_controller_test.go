@@ -18,9 +18,13 @@ package controller
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -44,6 +48,7 @@ import (
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	bucketv1 "github.com/fluxcd/source-controller/api/v1beta2"
+	"github.com/fluxcd/source-controller/internal/connlimit"
 	intdigest "github.com/fluxcd/source-controller/internal/digest"
 	"github.com/fluxcd/source-controller/internal/index"
 	gcsmock "github.com/fluxcd/source-controller/internal/mock/gcs"
@@ -335,7 +340,9 @@ func TestBucketReconciler_reconcileSource_generic(t *testing.T) {
 		bucketName       string
 		bucketObjects    []*s3mock.Object
 		middleware       http.Handler
+		serverTLS        bool
 		secret           *corev1.Secret
+		allowedSchemes   []string
 		beforeFunc       func(obj *bucketv1.Bucket)
 		want             sreconcile.Result
 		wantErr          bool
@@ -362,6 +369,43 @@ func TestBucketReconciler_reconcileSource_generic(t *testing.T) {
 				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:b4c2a60ce44b67f5b659a95ce4e4cc9e2a86baf13afb72bd397c5384cbc0e479'"),
 			},
 		},
+		{
+			name:       "Reconciles source with allowed scheme",
+			bucketName: "dummy",
+			bucketObjects: []*s3mock.Object{
+				{
+					Key:          "test.txt",
+					Content:      []byte("test"),
+					ContentType:  "text/plain",
+					LastModified: time.Now(),
+				},
+			},
+			allowedSchemes: []string{"http", "https"},
+			want:           sreconcile.ResultSuccess,
+			assertIndex: index.NewDigester(index.WithIndex(map[string]string{
+				"test.txt": "098f6bcd4621d373cade4e832627b4f6",
+			})),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:b4c2a60ce44b67f5b659a95ce4e4cc9e2a86baf13afb72bd397c5384cbc0e479'"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:b4c2a60ce44b67f5b659a95ce4e4cc9e2a86baf13afb72bd397c5384cbc0e479'"),
+			},
+		},
+		{
+			name:           "Observes forbidden scheme",
+			bucketName:     "dummy",
+			allowedSchemes: []string{"https"},
+			beforeFunc: func(obj *bucketv1.Bucket) {
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, "foo", "bar")
+			},
+			wantErr:     true,
+			assertIndex: index.NewDigester(),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.URLSchemeNotAllowedReason, "scheme 'http' is not allowed, must be one of: https"),
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
+			},
+		},
 		// TODO(hidde): middleware for mock server
 		//{
 		//	name: "authenticates using secretRef",
@@ -408,6 +452,77 @@ func TestBucketReconciler_reconcileSource_generic(t *testing.T) {
 				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
 			},
 		},
+		{
+			name:       "Verifies TLS endpoint with caFile of secretRef",
+			bucketName: "dummy",
+			serverTLS:  true,
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy",
+				},
+				Data: map[string][]byte{
+					"accesskey": []byte("key"),
+					"secretkey": []byte("secret"),
+					"caFile":    tlsCA,
+				},
+			},
+			beforeFunc: func(obj *bucketv1.Bucket) {
+				obj.Spec.SecretRef = &meta.LocalObjectReference{
+					Name: "dummy",
+				}
+			},
+			want:        sreconcile.ResultSuccess,
+			assertIndex: index.NewDigester(),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new upstream revision"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new upstream revision"),
+			},
+		},
+		{
+			name:       "Observes invalid caFile of secretRef",
+			bucketName: "dummy",
+			serverTLS:  true,
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy",
+				},
+				Data: map[string][]byte{
+					"accesskey": []byte("key"),
+					"secretkey": []byte("secret"),
+					"caFile":    []byte("invalid"),
+				},
+			},
+			beforeFunc: func(obj *bucketv1.Bucket) {
+				obj.Spec.SecretRef = &meta.LocalObjectReference{
+					Name: "dummy",
+				}
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, "foo", "bar")
+			},
+			wantErr:     true,
+			assertIndex: index.NewDigester(),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.AuthenticationFailedReason, "invalid 'dummy' secret data: 'caFile' does not contain a PEM encoded certificate"),
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
+			},
+		},
+		{
+			name:       "Observes TLS endpoint with unknown authority",
+			bucketName: "dummy",
+			serverTLS:  true,
+			beforeFunc: func(obj *bucketv1.Bucket) {
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, "foo", "bar")
+			},
+			wantErr:     true,
+			assertIndex: index.NewDigester(),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, bucketv1.BucketOperationFailedReason, "certificate signed by unknown authority"),
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
+			},
+		},
 		{
 			name:       "Observes non-existing bucket name",
 			bucketName: "dummy",
@@ -424,6 +539,22 @@ func TestBucketReconciler_reconcileSource_generic(t *testing.T) {
 				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
 			},
 		},
+		{
+			name:       "Observes TLS against a non-TLS endpoint",
+			bucketName: "dummy",
+			beforeFunc: func(obj *bucketv1.Bucket) {
+				obj.Spec.Insecure = false
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, "foo", "bar")
+			},
+			wantErr:     true,
+			assertIndex: index.NewDigester(),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, bucketv1.BucketOperationFailedReason, "failed to confirm existence of 'dummy' bucket: endpoint does not support TLS: set 'insecure' to connect to it over plain HTTP"),
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
+			},
+		},
 		{
 			name: "Transient bucket name API failure",
 			beforeFunc: func(obj *bucketv1.Bucket) {
@@ -536,6 +667,145 @@ func TestBucketReconciler_reconcileSource_generic(t *testing.T) {
 				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
 			},
 		},
+		{
+			name:       "Up-to-date artifact with Content revision strategy",
+			bucketName: "dummy",
+			beforeFunc: func(obj *bucketv1.Bucket) {
+				obj.Spec.RevisionStrategy = bucketv1.BucketRevisionStrategyContent
+				obj.Status.Artifact = &sourcev1.Artifact{
+					Revision: "sha256:b0417053bc9d402170a0783886d8290b2b6a51ae4a9c1c74ae4134a69e4a286f",
+				}
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, "foo", "bar")
+			},
+			bucketObjects: []*s3mock.Object{
+				{
+					Key:          "test.txt",
+					Content:      []byte("test"),
+					ContentType:  "text/plain",
+					LastModified: time.Now(),
+				},
+			},
+			want: sreconcile.ResultSuccess,
+			assertIndex: index.NewDigester(index.WithIndex(map[string]string{
+				"test.txt": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			})),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
+			},
+		},
+		{
+			name:       "Case-variant keys with Fail policy makes FetchFailed=True",
+			bucketName: "dummy",
+			beforeFunc: func(obj *bucketv1.Bucket) {
+				obj.Spec.CaseCollisionPolicy = bucketv1.BucketCaseCollisionPolicyFail
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, "foo", "bar")
+			},
+			bucketObjects: []*s3mock.Object{
+				{
+					Key:          "test.txt",
+					Content:      []byte("test"),
+					ContentType:  "text/plain",
+					LastModified: time.Now(),
+				},
+				{
+					Key:          "Test.txt",
+					Content:      []byte("other"),
+					ContentType:  "text/plain",
+					LastModified: time.Now(),
+				},
+			},
+			wantErr: true,
+			assertIndex: index.NewDigester(index.WithIndex(map[string]string{
+				"Test.txt": "795f3202b17cb6bc3d4b771d8c6c9eaf",
+				"test.txt": "098f6bcd4621d373cade4e832627b4f6",
+			})),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, bucketv1.KeyCaseCollisionReason, "bucket contains objects with keys which only differ in case: 'Test.txt', 'test.txt'"),
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
+			},
+		},
+		{
+			name:       "Case-variant keys with KeepFirst policy only includes first key",
+			bucketName: "dummy",
+			beforeFunc: func(obj *bucketv1.Bucket) {
+				obj.Spec.CaseCollisionPolicy = bucketv1.BucketCaseCollisionPolicyKeepFirst
+			},
+			bucketObjects: []*s3mock.Object{
+				{
+					Key:          "test.txt",
+					Content:      []byte("test"),
+					ContentType:  "text/plain",
+					LastModified: time.Now(),
+				},
+				{
+					Key:          "Test.txt",
+					Content:      []byte("other"),
+					ContentType:  "text/plain",
+					LastModified: time.Now(),
+				},
+			},
+			want: sreconcile.ResultSuccess,
+			assertIndex: index.NewDigester(index.WithIndex(map[string]string{
+				"Test.txt": "795f3202b17cb6bc3d4b771d8c6c9eaf",
+			})),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:4dcc3d6c907abe0299abd85f0bf11aab06c4007487f1fbc740d92364dd30db57'"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:4dcc3d6c907abe0299abd85f0bf11aab06c4007487f1fbc740d92364dd30db57'"),
+			},
+		},
+		{
+			name:       "Path rewrite rules rewrite keys to Artifact paths",
+			bucketName: "dummy",
+			beforeFunc: func(obj *bucketv1.Bucket) {
+				obj.Spec.PathRewrite = []bucketv1.BucketPathRewrite{
+					{Match: "^env/prod/"},
+					{Match: "^manifests/([^/]+)\\.yml$", Replace: "apps/$1.yaml"},
+				}
+			},
+			bucketObjects: []*s3mock.Object{
+				{
+					Key:          "env/prod/test.txt",
+					Content:      []byte("test"),
+					ContentType:  "text/plain",
+					LastModified: time.Now(),
+				},
+				{
+					Key:          "manifests/app.yml",
+					Content:      []byte("other"),
+					ContentType:  "text/plain",
+					LastModified: time.Now(),
+				},
+			},
+			want: sreconcile.ResultSuccess,
+			assertIndex: index.NewDigester(index.WithIndex(map[string]string{
+				"test.txt":      "098f6bcd4621d373cade4e832627b4f6",
+				"apps/app.yaml": "795f3202b17cb6bc3d4b771d8c6c9eaf",
+			})),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:77d806feb6f1884b49c719a0fe66b1920eba924581a379cb1036aac164d88ccb'"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:77d806feb6f1884b49c719a0fe66b1920eba924581a379cb1036aac164d88ccb'"),
+			},
+		},
+		{
+			name:       "Invalid path rewrite rule makes FetchFailed=True",
+			bucketName: "dummy",
+			beforeFunc: func(obj *bucketv1.Bucket) {
+				obj.Spec.PathRewrite = []bucketv1.BucketPathRewrite{{Match: "(unclosed"}}
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, "foo", "bar")
+			},
+			wantErr:     true,
+			assertIndex: index.NewDigester(),
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, bucketv1.PathRewriteFailedReason, "invalid path rewrite rule 0: error parsing regexp: missing closing ): `(unclosed`"),
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
+			},
+		},
 		{
 			name:       "Removes FetchFailedCondition after reconciling source",
 			bucketName: "dummy",
@@ -596,10 +866,11 @@ func TestBucketReconciler_reconcileSource_generic(t *testing.T) {
 				builder.WithObjects(tt.secret)
 			}
 			r := &BucketReconciler{
-				EventRecorder: record.NewFakeRecorder(32),
-				Client:        builder.Build(),
-				Storage:       testStorage,
-				patchOptions:  getPatchOptions(bucketReadyCondition.Owned, "sc"),
+				EventRecorder:  record.NewFakeRecorder(32),
+				Client:         builder.Build(),
+				Storage:        testStorage,
+				AllowedSchemes: tt.allowedSchemes,
+				patchOptions:   getPatchOptions(bucketReadyCondition.Owned, "sc"),
 			}
 			tmpDir := t.TempDir()
 
@@ -620,7 +891,13 @@ func TestBucketReconciler_reconcileSource_generic(t *testing.T) {
 			if tt.bucketName != "" {
 				server = s3mock.NewServer(tt.bucketName)
 				server.Objects = tt.bucketObjects
-				server.Start()
+				if tt.serverTLS {
+					cert, err := tls.X509KeyPair(tlsPublicKey, tlsPrivateKey)
+					g.Expect(err).NotTo(HaveOccurred())
+					server.StartTLS(&tls.Config{Certificates: []tls.Certificate{cert}})
+				} else {
+					server.Start()
+				}
 				defer server.Stop()
 
 				g.Expect(server.HTTPAddress()).ToNot(BeEmpty())
@@ -629,8 +906,7 @@ func TestBucketReconciler_reconcileSource_generic(t *testing.T) {
 
 				obj.Spec.BucketName = tt.bucketName
 				obj.Spec.Endpoint = u.Host
-				// TODO(hidde): also test TLS
-				obj.Spec.Insecure = true
+				obj.Spec.Insecure = !tt.serverTLS
 			}
 			if tt.beforeFunc != nil {
 				tt.beforeFunc(obj)
@@ -658,6 +934,310 @@ func TestBucketReconciler_reconcileSource_generic(t *testing.T) {
 	}
 }
 
+func TestBucketReconciler_reconcileSource_proxy(t *testing.T) {
+	server := s3mock.NewServer("dummy")
+	server.Objects = []*s3mock.Object{
+		{
+			Key:          "test.txt",
+			Content:      []byte("test"),
+			ContentType:  "text/plain",
+			LastModified: time.Now(),
+		},
+	}
+	server.Start()
+	defer server.Stop()
+	endpoint, err := url.Parse(server.HTTPAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The proxy forwards the requests with the expected credentials to the
+	// server, and records the hosts it was asked to connect to.
+	var proxiedHosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		proxiedHosts = append(proxiedHosts, r.Host)
+		r.RequestURI = ""
+		r.Header.Del("Proxy-Authorization")
+		res, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		for k, v := range res.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(res.StatusCode)
+		_, _ = io.Copy(w, res.Body)
+	}))
+	defer proxy.Close()
+
+	proxySecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "proxy"},
+		Data: map[string][]byte{
+			"username": []byte("user"),
+			"password": []byte("pass"),
+		},
+	}
+
+	tests := []struct {
+		name             string
+		proxy            *bucketv1.ProxyConfig
+		wantErr          bool
+		wantProxied      bool
+		assertConditions []metav1.Condition
+	}{
+		{
+			name: "fetches through proxy",
+			proxy: &bucketv1.ProxyConfig{
+				URL:       proxy.URL,
+				SecretRef: &meta.LocalObjectReference{Name: "proxy"},
+			},
+			wantProxied: true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:b4c2a60ce44b67f5b659a95ce4e4cc9e2a86baf13afb72bd397c5384cbc0e479'"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:b4c2a60ce44b67f5b659a95ce4e4cc9e2a86baf13afb72bd397c5384cbc0e479'"),
+			},
+		},
+		{
+			name: "fetches directly from endpoint excluded from proxy",
+			proxy: &bucketv1.ProxyConfig{
+				URL:       proxy.URL,
+				SecretRef: &meta.LocalObjectReference{Name: "proxy"},
+				NoProxy:   []string{endpoint.Hostname()},
+			},
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:b4c2a60ce44b67f5b659a95ce4e4cc9e2a86baf13afb72bd397c5384cbc0e479'"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new upstream revision 'sha256:b4c2a60ce44b67f5b659a95ce4e4cc9e2a86baf13afb72bd397c5384cbc0e479'"),
+			},
+		},
+		{
+			name: "observes non-existing proxy secretRef",
+			proxy: &bucketv1.ProxyConfig{
+				URL:       proxy.URL,
+				SecretRef: &meta.LocalObjectReference{Name: "invalid"},
+			},
+			wantErr: true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.AuthenticationFailedReason, "failed to configure proxy: failed to get proxy secret '/invalid': secrets \"invalid\" not found"),
+			},
+		},
+		{
+			name:    "observes invalid proxy URL",
+			proxy:   &bucketv1.ProxyConfig{URL: "socks5://proxy.example.com"},
+			wantErr: true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.URLInvalidReason, "invalid proxy URL 'socks5://proxy.example.com': must be an absolute HTTP/S URL"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			proxiedHosts = nil
+			r := &BucketReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.Scheme()).WithObjects(proxySecret).Build(),
+				Storage:       testStorage,
+				patchOptions:  getPatchOptions(bucketReadyCondition.Owned, "sc"),
+			}
+
+			obj := &bucketv1.Bucket{
+				TypeMeta: metav1.TypeMeta{
+					Kind: bucketv1.BucketKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test-bucket",
+					Generation: 1,
+				},
+				Spec: bucketv1.BucketSpec{
+					BucketName: "dummy",
+					Endpoint:   endpoint.Host,
+					Insecure:   true,
+					Timeout:    &metav1.Duration{Duration: timeout},
+					Proxy:      tt.proxy,
+				},
+			}
+			g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+			defer func() {
+				g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+			}()
+
+			sp := patch.NewSerialPatcher(obj, r.Client)
+			_, err := r.reconcileSource(context.TODO(), sp, obj, index.NewDigester(), t.TempDir())
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			g.Expect(obj.Status.Conditions).To(conditions.MatchConditions(tt.assertConditions))
+			if tt.wantProxied {
+				g.Expect(proxiedHosts).To(ContainElement(endpoint.Host))
+			} else {
+				g.Expect(proxiedHosts).To(BeEmpty())
+			}
+		})
+	}
+}
+
+func TestBucketReconciler_reconcileSource_weight(t *testing.T) {
+	server := s3mock.NewServer("dummy")
+	server.Objects = []*s3mock.Object{
+		{
+			Key:          "test.txt",
+			Content:      []byte("test"),
+			ContentType:  "text/plain",
+			LastModified: time.Now(),
+		},
+	}
+	server.Start()
+	defer server.Stop()
+	endpoint, err := url.Parse(server.HTTPAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name               string
+		weight             int32
+		limiter            *connlimit.Limiter
+		observedGeneration int64
+		wantEvent          bool
+	}{
+		{
+			name:      "weight without limiter records event",
+			weight:    5,
+			wantEvent: true,
+		},
+		{
+			name:               "weight without limiter of observed generation records no event",
+			weight:             5,
+			observedGeneration: 1,
+		},
+		{
+			name:    "weight with limiter records no event",
+			weight:  5,
+			limiter: connlimit.New(1),
+		},
+		{
+			name:   "default weight without limiter records no event",
+			weight: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			recorder := record.NewFakeRecorder(32)
+			r := &BucketReconciler{
+				EventRecorder:     recorder,
+				Client:            fakeclient.NewClientBuilder().WithScheme(testEnv.Scheme()).Build(),
+				Storage:           testStorage,
+				ConnectionLimiter: tt.limiter,
+				patchOptions:      getPatchOptions(bucketReadyCondition.Owned, "sc"),
+			}
+
+			obj := &bucketv1.Bucket{
+				TypeMeta: metav1.TypeMeta{
+					Kind: bucketv1.BucketKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test-bucket",
+					Generation: 1,
+				},
+				Spec: bucketv1.BucketSpec{
+					BucketName: "dummy",
+					Endpoint:   endpoint.Host,
+					Insecure:   true,
+					Timeout:    &metav1.Duration{Duration: timeout},
+					Weight:     tt.weight,
+				},
+				Status: bucketv1.BucketStatus{
+					ObservedGeneration: tt.observedGeneration,
+				},
+			}
+
+			sp := patch.NewSerialPatcher(obj, r.Client)
+			_, err := r.reconcileSource(context.TODO(), sp, obj, index.NewDigester(), t.TempDir())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(tt.limiter.InUse()).To(BeZero())
+
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if tt.wantEvent {
+				g.Expect(events).To(ContainElement(ContainSubstring(bucketv1.WeightIgnoredReason)))
+			} else {
+				g.Expect(events).ToNot(ContainElement(ContainSubstring(bucketv1.WeightIgnoredReason)))
+			}
+		})
+	}
+}
+
+func TestBucketReconciler_reconcileSource_listPageSize(t *testing.T) {
+	g := NewWithT(t)
+
+	const (
+		objectCount = 2500
+		pageSize    = 100
+	)
+
+	server := s3mock.NewServer("dummy")
+	for i := 0; i < objectCount; i++ {
+		server.Objects = append(server.Objects, &s3mock.Object{
+			Key:          fmt.Sprintf("dir/%05d.txt", i),
+			Content:      []byte(fmt.Sprintf("object %d", i)),
+			ContentType:  "text/plain",
+			LastModified: time.Now(),
+		})
+	}
+	server.Start()
+	defer server.Stop()
+	endpoint, err := url.Parse(server.HTTPAddress())
+	g.Expect(err).ToNot(HaveOccurred())
+
+	r := &BucketReconciler{
+		EventRecorder: record.NewFakeRecorder(32),
+		Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.Scheme()).Build(),
+		Storage:       testStorage,
+		ListPageSize:  pageSize,
+		patchOptions:  getPatchOptions(bucketReadyCondition.Owned, "sc"),
+	}
+
+	obj := &bucketv1.Bucket{
+		TypeMeta: metav1.TypeMeta{
+			Kind: bucketv1.BucketKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-bucket",
+			Generation: 1,
+		},
+		Spec: bucketv1.BucketSpec{
+			BucketName: "dummy",
+			Endpoint:   endpoint.Host,
+			Insecure:   true,
+			Timeout:    &metav1.Duration{Duration: time.Minute},
+		},
+	}
+
+	dir := t.TempDir()
+	idx := index.NewDigester()
+	sp := patch.NewSerialPatcher(obj, r.Client)
+	_, err = r.reconcileSource(context.TODO(), sp, obj, idx, dir)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The objects are listed in pages of the configured size, instead of
+	// in a single response holding all objects.
+	g.Expect(server.ListRequests()).To(Equal(objectCount / pageSize))
+	g.Expect(idx.Len()).To(Equal(objectCount))
+
+	entries, err := os.ReadDir(filepath.Join(dir, "dir"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(objectCount))
+}
+
 func TestBucketReconciler_reconcileSource_gcs(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -1085,6 +1665,26 @@ func TestBucketReconciler_reconcileArtifact(t *testing.T) {
 				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
 			},
 		},
+		{
+			name: "Digest algorithm override is used for the artifact digest",
+			beforeFunc: func(t *WithT, obj *bucketv1.Bucket, index *index.Digester, dir string) {
+				obj.Spec.Interval = metav1.Duration{Duration: interval}
+				obj.Spec.DigestAlgorithm = "sha512"
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, "foo", "bar")
+			},
+			afterFunc: func(t *WithT, obj *bucketv1.Bucket, dir string) {
+				t.Expect(obj.GetArtifact().Digest).To(HavePrefix("sha512:"))
+				t.Expect(obj.GetArtifact().Revision).To(HavePrefix("sha256:"))
+				t.Expect(testStorage.VerifyArtifact(*obj.GetArtifact())).To(Succeed())
+			},
+			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, meta.SucceededReason, "stored artifact: revision 'sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855'"),
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
+			},
+		},
 		{
 			name: "Dir path deleted",
 			beforeFunc: func(t *WithT, obj *bucketv1.Bucket, index *index.Digester, dir string) {
@@ -18,8 +18,12 @@ package controller
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -28,6 +32,7 @@ import (
 
 	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/fluxcd/pkg/runtime/logger"
+	"github.com/opencontainers/go-digest"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -55,11 +60,17 @@ import (
 	"github.com/fluxcd/pkg/sourceignore"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/fluxcd/source-controller/internal/connlimit"
 	serror "github.com/fluxcd/source-controller/internal/error"
 	"github.com/fluxcd/source-controller/internal/features"
+	"github.com/fluxcd/source-controller/internal/latency"
+	intpredicates "github.com/fluxcd/source-controller/internal/predicates"
 	sreconcile "github.com/fluxcd/source-controller/internal/reconcile"
 	"github.com/fluxcd/source-controller/internal/reconcile/summarize"
+	"github.com/fluxcd/source-controller/internal/sourcemetrics"
+	"github.com/fluxcd/source-controller/internal/tracing"
 	"github.com/fluxcd/source-controller/internal/util"
+	"github.com/fluxcd/source-controller/internal/webhook"
 )
 
 // gitRepositoryReadyCondition contains the information required to summarize a
@@ -71,6 +82,7 @@ var gitRepositoryReadyCondition = summarize.Conditions{
 		sourcev1.FetchFailedCondition,
 		sourcev1.IncludeUnavailableCondition,
 		sourcev1.ArtifactOutdatedCondition,
+		sourcev1.PendingApprovalCondition,
 		sourcev1.ArtifactInStorageCondition,
 		sourcev1.SourceVerifiedCondition,
 		meta.ReadyCondition,
@@ -82,6 +94,7 @@ var gitRepositoryReadyCondition = summarize.Conditions{
 		sourcev1.FetchFailedCondition,
 		sourcev1.IncludeUnavailableCondition,
 		sourcev1.ArtifactOutdatedCondition,
+		sourcev1.PendingApprovalCondition,
 		sourcev1.ArtifactInStorageCondition,
 		sourcev1.SourceVerifiedCondition,
 		meta.StalledCondition,
@@ -92,11 +105,15 @@ var gitRepositoryReadyCondition = summarize.Conditions{
 		sourcev1.FetchFailedCondition,
 		sourcev1.IncludeUnavailableCondition,
 		sourcev1.ArtifactOutdatedCondition,
+		sourcev1.PendingApprovalCondition,
 		meta.StalledCondition,
 		meta.ReconcilingCondition,
 	},
 }
 
+// gitProtocolScheme is the URL scheme of the anonymous Git protocol.
+const gitProtocolScheme = "git"
+
 // gitRepositoryFailConditions contains the conditions that represent a failure.
 var gitRepositoryFailConditions = []string{
 	sourcev1.FetchFailedCondition,
@@ -130,6 +147,37 @@ type GitRepositoryReconciler struct {
 	requeueDependency time.Duration
 	features          map[string]bool
 
+	PreStoreWebhook *webhook.PreStore
+
+	// LatencyRecorder records the sliding-window reconcile latency
+	// percentiles.
+	LatencyRecorder *latency.Recorder
+
+	// SourceMetrics records the reconcile duration, Artifact size and
+	// fetch failure metrics.
+	SourceMetrics *sourcemetrics.Recorder
+
+	// ConnectionLimiter bounds the number of concurrent outbound network
+	// operations across all reconcilers.
+	ConnectionLimiter *connlimit.Limiter
+
+	// DisableGitProtocol disables cloning from repositories over the
+	// anonymous git:// protocol.
+	DisableGitProtocol bool
+
+	// AllowedSchemes is the list of URL schemes sources are allowed to use.
+	// Any scheme is allowed when empty.
+	AllowedSchemes []string
+
+	// IgnoredPathsSampleSize is the maximum number of paths excluded by the
+	// ignore rules which are recorded in the status of an object.
+	IgnoredPathsSampleSize int
+
+	// MaxCloneSize is the maximum size in bytes of the clone of a repository
+	// on disk, including the Git metadata and any submodules. The clone is
+	// aborted as soon as it exceeds the size. Unlimited when zero.
+	MaxCloneSize int64
+
 	patchOptions []patch.Option
 }
 
@@ -158,7 +206,12 @@ func (r *GitRepositoryReconciler) SetupWithManagerAndOptions(mgr ctrl.Manager, o
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&sourcev1.GitRepository{}, builder.WithPredicates(
-			predicate.Or(predicate.GenerationChangedPredicate{}, predicates.ReconcileRequestedPredicate{}),
+			predicate.Or(
+				predicate.GenerationChangedPredicate{},
+				predicates.ReconcileRequestedPredicate{},
+				intpredicates.AnnotationChangedPredicate{Annotation: sourcev1.ApprovalRequiredAnnotation},
+				intpredicates.AnnotationChangedPredicate{Annotation: sourcev1.ApprovedRevisionAnnotation},
+			),
 		)).
 		WithOptions(controller.Options{
 			MaxConcurrentReconciles: opts.MaxConcurrentReconciles,
@@ -171,6 +224,11 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	start := time.Now()
 	log := ctrl.LoggerFrom(ctx)
 
+	ctx, span := tracing.StartReconcile(ctx, sourcev1.GitRepositoryKind, req.Namespace, req.Name)
+	defer func() {
+		tracing.End(span, retErr)
+	}()
+
 	// Fetch the GitRepository
 	obj := &sourcev1.GitRepository{}
 	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
@@ -208,6 +266,8 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		// Always record readiness and duration metrics
 		r.Metrics.RecordReadiness(ctx, obj)
 		r.Metrics.RecordDuration(ctx, obj, start)
+		r.LatencyRecorder.Observe(sourcev1.GitRepositoryKind, time.Since(start))
+		r.SourceMetrics.Record(sourcev1.GitRepositoryKind, obj, time.Since(start), retErr)
 	}()
 
 	// Add finalizer first if not exist to avoid the race condition
@@ -296,7 +356,9 @@ func (r *GitRepositoryReconciler) reconcile(ctx context.Context, sp *patch.Seria
 		resErr error
 	)
 	for _, rec := range reconcilers {
-		recResult, err := rec(ctx, sp, obj, &commit, &includes, tmpDir)
+		recCtx, recSpan := tracing.StartFunc(ctx, rec)
+		recResult, err := rec(recCtx, sp, obj, &commit, &includes, tmpDir)
+		tracing.End(recSpan, err)
 		// Exit immediately on ResultRequeue.
 		if recResult == sreconcile.ResultRequeue {
 			return sreconcile.ResultRequeue, nil
@@ -389,19 +451,32 @@ func (r *GitRepositoryReconciler) reconcileStorage(ctx context.Context, sp *patc
 
 	// Determine if the advertised artifact is still in storage
 	var artifactMissing bool
-	if artifact := obj.GetArtifact(); artifact != nil && !r.Storage.ArtifactExist(*artifact) {
+	if artifact := obj.GetArtifact(); artifact != nil && r.Storage.ArtifactMissing(*artifact) {
 		obj.Status.Artifact = nil
 		artifactMissing = true
 		// Remove the condition as the artifact doesn't exist.
 		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
 	}
 
+	// Determine if the advertised artifact still matches its digest
+	var artifactMismatch bool
+	if err := r.Storage.ArtifactDigestMismatch(obj.GetArtifact()); err != nil {
+		r.eventLogf(ctx, obj, corev1.EventTypeWarning, sourcev1.ArtifactDigestMismatchReason,
+			"failed to verify integrity of artifact: %s", err.Error())
+		obj.Status.Artifact = nil
+		artifactMismatch = true
+		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
+	}
+
 	// Record that we do not have an artifact
 	if obj.GetArtifact() == nil {
 		msg := "building artifact"
 		if artifactMissing {
 			msg += ": disappeared from storage"
 		}
+		if artifactMismatch {
+			msg += ": digest mismatch in storage"
+		}
 		rreconcile.ProgressiveStatus(true, obj, meta.ProgressingReason, msg)
 		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
 		if err := sp.Patch(ctx, obj, r.patchOptions...); err != nil {
@@ -410,9 +485,12 @@ func (r *GitRepositoryReconciler) reconcileStorage(ctx context.Context, sp *patc
 		return sreconcile.ResultSuccess, nil
 	}
 
-	// Always update URLs to ensure hostname is up-to-date
-	// TODO(hidde): we may want to send out an event only if we notice the URL has changed
-	r.Storage.SetArtifactURL(obj.GetArtifact())
+	// Always update URLs to ensure hostname is up-to-date, and notify about
+	// corrected URLs of e.g. a changed storage hostname
+	if previousURL, ok := r.Storage.UpdateArtifactURL(obj.GetArtifact()); ok {
+		r.eventLogf(ctx, obj, corev1.EventTypeNormal, sourcev1.ArtifactURLUpdatedReason,
+			"artifact URL updated from '%s' to '%s' to match the storage hostname", previousURL, obj.GetArtifact().URL)
+	}
 
 	return sreconcile.ResultSuccess, nil
 }
@@ -449,6 +527,14 @@ func (r *GitRepositoryReconciler) reconcileStorage(ctx context.Context, sp *patc
 // change, it short-circuits the whole reconciliation with an early return.
 func (r *GitRepositoryReconciler) reconcileSource(ctx context.Context, sp *patch.SerialPatcher,
 	obj *sourcev1.GitRepository, commit *git.Commit, includes *artifactSet, dir string) (sreconcile.Result, error) {
+	// Validate the referenced secrets before any network operation
+	if r.features[features.PreflightSecrets] {
+		if e := preflightSecrets(ctx, r.Client, obj.GetNamespace(), gitRepositorySecretReferences(obj)...); e != nil {
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return sreconcile.ResultEmpty, e
+		}
+	}
+
 	// Remove previously failed source verification status conditions. The
 	// failing verification should be recalculated. But an existing successful
 	// verification need not be removed as it indicates verification of previous
@@ -486,18 +572,55 @@ func (r *GitRepositoryReconciler) reconcileSource(ctx context.Context, sp *patch
 		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
 		return sreconcile.ResultEmpty, e
 	}
-
-	// Configure authentication strategy to access the source
-	authOpts, err := git.NewAuthOptions(*u, authData)
-	if err != nil {
-		e := serror.NewGeneric(
-			fmt.Errorf("failed to configure authentication options: %w", err),
-			sourcev1.AuthenticationFailedReason,
+	if err := util.ValidateURLScheme(obj.Spec.URL, r.AllowedSchemes); err != nil {
+		e := serror.NewStalling(
+			fmt.Errorf("failed to validate url '%s': %w", util.RedactURL(obj.Spec.URL), err),
+			sourcev1.URLSchemeNotAllowedReason,
 		)
 		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
 		return sreconcile.ResultEmpty, e
 	}
 
+	// Configure authentication strategy to access the source
+	var authOpts *git.AuthOptions
+	if u.Scheme == gitProtocolScheme {
+		// The Git protocol is read-only and does not support authentication.
+		// As the Git client selects the transport based on the URL scheme,
+		// HTTP options without credentials result in an anonymous clone.
+		if r.DisableGitProtocol {
+			e := serror.NewStalling(
+				fmt.Errorf("failed to validate url '%s': the git protocol is disabled", util.RedactURL(obj.Spec.URL)),
+				sourcev1.URLSchemeNotAllowedReason,
+			)
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return sreconcile.ResultEmpty, e
+		}
+		if obj.Spec.SecretRef != nil {
+			e := serror.NewStalling(
+				errors.New("failed to configure authentication options: the git protocol does not support authentication"),
+				sourcev1.AuthenticationFailedReason,
+			)
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return sreconcile.ResultEmpty, e
+		}
+		authOpts = &git.AuthOptions{Transport: git.HTTP}
+	} else {
+		authOpts, err = git.NewAuthOptions(*u, authData)
+		if err != nil {
+			e := serror.NewGeneric(
+				fmt.Errorf("failed to configure authentication options: %w", err),
+				sourcev1.AuthenticationFailedReason,
+			)
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return sreconcile.ResultEmpty, e
+		}
+	}
+
+	// Observe if the authentication configuration changed since the last
+	// fetch, e.g. due to the rotation of credentials.
+	authDigest := gitAuthDigest(obj.UID, authOpts)
+	authChanged := authDigest != obj.Status.ObservedAuthDigest
+
 	// Fetch the included artifact metadata.
 	artifacts, err := r.fetchIncludes(ctx, obj)
 	if err != nil {
@@ -520,8 +643,10 @@ func (r *GitRepositoryReconciler) reconcileSource(ctx context.Context, sp *patch
 	// Persist the ArtifactSet.
 	*includes = *artifacts
 
+	// Do not optimize the clone if the authentication configuration changed,
+	// to ensure the content is fetched again using the new configuration.
 	var optimizedClone bool
-	if val, ok := r.features[features.OptimizedGitClones]; ok && val {
+	if val, ok := r.features[features.OptimizedGitClones]; ok && val && !authChanged {
 		optimizedClone = true
 	}
 
@@ -530,12 +655,7 @@ func (r *GitRepositoryReconciler) reconcileSource(ctx context.Context, sp *patch
 		return sreconcile.ResultEmpty, err
 	}
 	if c == nil {
-		e := serror.NewGeneric(
-			fmt.Errorf("git repository is empty"),
-			"EmptyGitRepository",
-		)
-		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
-		return sreconcile.ResultEmpty, e
+		return sreconcile.ResultEmpty, emptyRepositoryError(obj)
 	}
 	// Assign the commit to the shared commit reference.
 	*commit = *c
@@ -560,6 +680,9 @@ func (r *GitRepositoryReconciler) reconcileSource(ctx context.Context, sp *patch
 			// very end.
 			conditions.MarkTrue(obj, sourcev1.ArtifactInStorageCondition, meta.SucceededReason,
 				"stored artifact for revision '%s'", commitReference(obj, commit))
+			// Evaluate the approval gate for the stored artifact, this allows
+			// it to be approved without fetching it again.
+			markApprovalGate(obj, commitReference(obj, commit))
 			// TODO: Find out if such condition setting is needed when commit
 			// signature verification is enabled.
 			return sreconcile.ResultEmpty, ge
@@ -571,16 +694,25 @@ func (r *GitRepositoryReconciler) reconcileSource(ctx context.Context, sp *patch
 		if err != nil {
 			return sreconcile.ResultEmpty, err
 		}
+		if c == nil {
+			return sreconcile.ResultEmpty, emptyRepositoryError(obj)
+		}
 		*commit = *c
 	}
-	ctrl.LoggerFrom(ctx).V(logger.DebugLevel).Info("git repository checked out", "url", obj.Spec.URL, "revision", commitReference(obj, commit))
+	ctrl.LoggerFrom(ctx).V(logger.DebugLevel).Info("git repository checked out", "url", util.RedactURL(obj.Spec.URL), "revision", commitReference(obj, commit))
 	conditions.Delete(obj, sourcev1.FetchFailedCondition)
+	obj.Status.ObservedAuthDigest = authDigest
 
 	// Verify commit signature
 	if result, err := r.verifyCommitSignature(ctx, obj, *commit); err != nil || result == sreconcile.ResultEmpty {
 		return result, err
 	}
 
+	// Record the metadata of the commit if the revision changed
+	if obj.Status.LastCommit == nil || obj.Status.LastCommit.Revision != commitReference(obj, commit) {
+		obj.Status.LastCommit = commitMetadata(obj, commit)
+	}
+
 	// Mark observations about the revision on the object
 	if !obj.GetArtifact().HasRevision(commitReference(obj, commit)) {
 		message := fmt.Sprintf("new upstream revision '%s'", commitReference(obj, commit))
@@ -620,6 +752,7 @@ func (r *GitRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pat
 			conditions.Delete(obj, sourcev1.ArtifactOutdatedCondition)
 			conditions.MarkTrue(obj, sourcev1.ArtifactInStorageCondition, meta.SucceededReason,
 				"stored artifact for revision '%s'", curArtifact.Revision)
+			markApprovalGate(obj, curArtifact.Revision)
 		}
 	}()
 
@@ -648,6 +781,12 @@ func (r *GitRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pat
 		return sreconcile.ResultEmpty, e
 	}
 
+	// Consult the pre-store webhook before storing the artifact
+	if e := reviewArtifact(ctx, r.PreStoreWebhook, sourcev1.GitRepositoryKind, obj, artifact); e != nil {
+		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
 	// Ensure artifact directory exists and acquire lock
 	if err := r.Storage.MkdirAll(artifact); err != nil {
 		e := serror.NewGeneric(
@@ -679,11 +818,14 @@ func (r *GitRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pat
 		ps = append(ps, sourceignore.ReadPatterns(strings.NewReader(*obj.Spec.Ignore), ignoreDomain)...)
 	}
 
-	// Archive directory to storage
-	if err := r.Storage.Archive(&artifact, dir, SourceIgnoreFilter(ps, ignoreDomain)); err != nil {
+	// Archive directory to storage, while recording the ignored paths
+	ignored := &IgnoredPaths{SampleSize: r.IgnoredPathsSampleSize}
+	filter := ignored.Filter(dir, SourceIgnoreFilter(ps, ignoreDomain))
+	if err := r.Storage.Archive(&artifact, dir, filter, obj.Spec.SymlinkPolicy, WithDigestAlgorithm(digest.Algorithm(obj.Spec.DigestAlgorithm)),
+		WithExpectedSize(artifactSize(obj.GetArtifact()))); err != nil {
 		e := serror.NewGeneric(
 			fmt.Errorf("unable to archive artifact to storage: %w", err),
-			sourcev1.ArchiveOperationFailedReason,
+			storageFailedReason(err),
 		)
 		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
 		return sreconcile.ResultEmpty, e
@@ -693,7 +835,10 @@ func (r *GitRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pat
 	obj.Status.Artifact = artifact.DeepCopy()
 	obj.Status.IncludedArtifacts = *includes
 	obj.Status.ObservedIgnore = obj.Spec.Ignore
+	obj.Status.IgnoredPathsCount = ignored.Count
+	obj.Status.IgnoredPathsSample = ignored.Sample
 	obj.Status.ObservedRecurseSubmodules = obj.Spec.RecurseSubmodules
+	obj.Status.ObservedSymlinkPolicy = obj.Spec.SymlinkPolicy
 	obj.Status.ObservedInclude = obj.Spec.Include
 
 	// Remove the deprecated symlink.
@@ -809,7 +954,48 @@ func (r *GitRepositoryReconciler) gitCheckout(ctx context.Context,
 	}
 	defer gitReader.Close()
 
-	commit, err := gitReader.Clone(gitCtx, obj.Spec.URL, cloneOpts)
+	// Credentials embedded in the URL are part of the auth options, clone
+	// from the URL without them to prevent them from ending up in errors.
+	cloneURL := obj.Spec.URL
+	if authOpts.Transport != git.SSH {
+		cloneURL = util.RedactURL(cloneURL)
+	}
+
+	// Abort the clone while it is in progress when it exceeds the maximum
+	// size, to prevent a large repository from filling up the disk.
+	stopSizeWatch := func() bool { return false }
+	if r.MaxCloneSize > 0 {
+		stopSizeWatch = watchDirSize(gitCtx, cancel, dir, r.MaxCloneSize, cloneSizeCheckInterval)
+	}
+
+	// Clones over SSH, and over HTTPS with a CA bundle, bypass the HTTP
+	// client installed for go-git which bounds the number of connections.
+	// Hold a slot for the duration of the clone for them instead.
+	if authOpts.Transport == git.SSH || len(authOpts.CAFile) > 0 {
+		release, err := r.ConnectionLimiter.Acquire(gitCtx)
+		if err != nil {
+			e := serror.NewGeneric(err, sourcev1.GitOperationFailedReason)
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return nil, e
+		}
+		defer release()
+	}
+
+	commit, err := gitReader.Clone(gitCtx, cloneURL, cloneOpts)
+	if exceeded := stopSizeWatch(); r.MaxCloneSize > 0 {
+		if !exceeded {
+			size, sErr := dirSize(dir)
+			exceeded = sErr == nil && size > r.MaxCloneSize
+		}
+		if exceeded {
+			e := serror.NewGeneric(
+				fmt.Errorf("clone of repository exceeds the maximum size of %d bytes", r.MaxCloneSize),
+				sourcev1.CloneSizeExceededReason,
+			)
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return nil, e
+		}
+	}
 	if err != nil {
 		e := serror.NewGeneric(
 			fmt.Errorf("failed to checkout and determine revision: %w", err),
@@ -822,6 +1008,83 @@ func (r *GitRepositoryReconciler) gitCheckout(ctx context.Context,
 	return commit, nil
 }
 
+// cloneSizeCheckInterval is the interval at which the size of a clone in
+// progress is checked against the GitRepositoryReconciler.MaxCloneSize.
+var cloneSizeCheckInterval = 500 * time.Millisecond
+
+// watchDirSize checks the size of dir at the interval, and calls cancel once
+// it exceeds the limit. It returns a function which stops the watch, and
+// reports if the limit was exceeded.
+func watchDirSize(ctx context.Context, cancel context.CancelFunc, dir string, limit int64, interval time.Duration) func() bool {
+	// exceeded is only read after the goroutine has stopped.
+	var exceeded bool
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				if size, err := dirSize(dir); err == nil && size > limit {
+					exceeded = true
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return func() bool {
+		close(done)
+		<-stopped
+		return exceeded
+	}
+}
+
+// dirSize returns the total size in bytes of the regular files in dir.
+// Files which are removed while walking dir are ignored.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// emptyRepositoryError records the clone of an empty Git repository on the
+// object, and returns a Waiting error to requeue the object at its interval
+// to wait for the first commit.
+func emptyRepositoryError(obj *sourcev1.GitRepository) *serror.Waiting {
+	e := serror.NewWaiting(
+		fmt.Errorf("git repository is empty: waiting for the first commit"),
+		sourcev1.EmptyRepositoryReason,
+	)
+	e.RequeueAfter = obj.GetRequeueAfter()
+	conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+	return e
+}
+
 // fetchIncludes fetches artifact metadata of all the included repos.
 func (r *GitRepositoryReconciler) fetchIncludes(ctx context.Context, obj *sourcev1.GitRepository) (*artifactSet, error) {
 	artifacts := make(artifactSet, len(obj.Spec.Include))
@@ -934,7 +1197,7 @@ func (r *GitRepositoryReconciler) reconcileDelete(ctx context.Context, obj *sour
 // removal of all Artifacts for the objects.
 func (r *GitRepositoryReconciler) garbageCollect(ctx context.Context, obj *sourcev1.GitRepository) error {
 	if !obj.DeletionTimestamp.IsZero() {
-		if deleted, err := r.Storage.RemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
+		if deleted, err := r.Storage.DeferRemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
 			return serror.NewGeneric(
 				fmt.Errorf("garbage collection for deleted resource failed: %w", err),
 				"GarbageCollectionFailed",
@@ -947,7 +1210,7 @@ func (r *GitRepositoryReconciler) garbageCollect(ctx context.Context, obj *sourc
 		return nil
 	}
 	if obj.GetArtifact() != nil {
-		delFiles, err := r.Storage.GarbageCollect(ctx, *obj.GetArtifact(), time.Second*5)
+		delFiles, err := r.Storage.GarbageCollect(ctx, *obj.GetArtifact(), obj.Spec.GC, time.Second*5)
 		if err != nil {
 			return serror.NewGeneric(
 				fmt.Errorf("garbage collection of artifacts failed: %w", err),
@@ -979,6 +1242,16 @@ func (r *GitRepositoryReconciler) eventLogf(ctx context.Context, obj runtime.Obj
 	r.Eventf(obj, eventType, reason, msg)
 }
 
+// symlinkPolicyOrDefault returns the given symlink policy, or the default
+// sourcev1.SymlinkPolicyIgnore if it is empty, as both result in the same
+// Artifact.
+func symlinkPolicyOrDefault(policy string) string {
+	if policy == "" {
+		return sourcev1.SymlinkPolicyIgnore
+	}
+	return policy
+}
+
 // gitContentConfigChanged evaluates the current spec with the observations of
 // the artifact in the status to determine if artifact content configuration has
 // changed and requires rebuilding the artifact.
@@ -986,9 +1259,15 @@ func gitContentConfigChanged(obj *sourcev1.GitRepository, includes *artifactSet)
 	if !pointer.StringEqual(obj.Spec.Ignore, obj.Status.ObservedIgnore) {
 		return true
 	}
+	if digestAlgorithmChanged(obj.GetArtifact(), obj.Spec.DigestAlgorithm) {
+		return true
+	}
 	if obj.Spec.RecurseSubmodules != obj.Status.ObservedRecurseSubmodules {
 		return true
 	}
+	if symlinkPolicyOrDefault(obj.Spec.SymlinkPolicy) != symlinkPolicyOrDefault(obj.Status.ObservedSymlinkPolicy) {
+		return true
+	}
 	if len(obj.Spec.Include) != len(obj.Status.ObservedInclude) {
 		return true
 	}
@@ -1026,6 +1305,27 @@ func gitContentConfigChanged(obj *sourcev1.GitRepository, includes *artifactSet)
 	return false
 }
 
+// gitAuthDigest returns an HMAC-SHA256 of the credentials in the given
+// git.AuthOptions keyed with the given UID of the object, or an empty string
+// if there are none. Keying the digest with the UID salts it, preventing the
+// credentials from being looked up in a precomputed table, and the digests
+// of objects using the same credentials from being compared.
+func gitAuthDigest(uid types.UID, opts *git.AuthOptions) string {
+	if opts == nil || (opts.Username == "" && opts.Password == "" && opts.BearerToken == "" &&
+		len(opts.Identity) == 0 && len(opts.KnownHosts) == 0 && len(opts.CAFile) == 0) {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(uid))
+	for _, v := range [][]byte{[]byte(opts.Username), []byte(opts.Password), []byte(opts.BearerToken),
+		opts.Identity, opts.KnownHosts, opts.CAFile} {
+		// Prefix values with their length to prevent ambiguity between
+		// different configurations.
+		_, _ = fmt.Fprintf(mac, "%d:", len(v))
+		_, _ = mac.Write(v)
+	}
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
 // Returns true if both GitRepositoryIncludes are equal.
 func gitRepositoryIncludeEqual(a, b sourcev1.GitRepositoryInclude) bool {
 	if a.GitRepositoryRef != b.GitRepositoryRef {
@@ -1040,9 +1340,44 @@ func gitRepositoryIncludeEqual(a, b sourcev1.GitRepositoryInclude) bool {
 	return true
 }
 
+// markApprovalGate marks the object with v1.PendingApprovalCondition if the
+// v1.ApprovalRequiredAnnotation is set, and the Artifact with the given
+// revision has not been approved using the v1.ApprovedRevisionAnnotation.
+// Otherwise, it removes any stale v1.PendingApprovalCondition.
+func markApprovalGate(obj *sourcev1.GitRepository, revision string) {
+	annotations := obj.GetAnnotations()
+	if annotations[sourcev1.ApprovalRequiredAnnotation] != "true" || annotations[sourcev1.ApprovedRevisionAnnotation] == revision {
+		conditions.Delete(obj, sourcev1.PendingApprovalCondition)
+		return
+	}
+	conditions.MarkTrue(obj, sourcev1.PendingApprovalCondition, sourcev1.AwaitingApprovalReason,
+		"artifact for revision '%s' is pending approval", revision)
+}
+
 func commitReference(obj *sourcev1.GitRepository, commit *git.Commit) string {
 	if obj.Spec.Reference != nil && obj.Spec.Reference.Name != "" {
 		return commit.AbsoluteReference()
 	}
 	return commit.String()
 }
+
+// maxCommitAuthorLength is the maximum number of characters of the author
+// recorded in the commit metadata.
+const maxCommitAuthorLength = 256
+
+// commitMetadata returns the v1.GitCommitMetadata for the given commit, with
+// the message and author bounded in length.
+func commitMetadata(obj *sourcev1.GitRepository, commit *git.Commit) *sourcev1.GitCommitMetadata {
+	author := commit.Author.Name
+	if commit.Author.Email != "" {
+		author = strings.TrimSpace(fmt.Sprintf("%s <%s>", author, commit.Author.Email))
+	}
+	if r := []rune(author); len(r) > maxCommitAuthorLength {
+		author = string(r[:maxCommitAuthorLength-3]) + "..."
+	}
+	return &sourcev1.GitCommitMetadata{
+		Revision: commitReference(obj, commit),
+		Message:  commit.ShortMessage(),
+		Author:   author,
+	}
+}
@@ -17,20 +17,27 @@ limitations under the License.
 package controller
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/opencontainers/go-digest"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"helm.sh/helm/v3/pkg/chartutil"
 	helmgetter "helm.sh/helm/v3/pkg/getter"
 	helmreg "helm.sh/helm/v3/pkg/registry"
 	helmrepo "helm.sh/helm/v3/pkg/repo"
@@ -66,17 +73,30 @@ import (
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	helmv1 "github.com/fluxcd/source-controller/api/v1beta2"
 	"github.com/fluxcd/source-controller/internal/cache"
+	"github.com/fluxcd/source-controller/internal/connlimit"
+	intdigest "github.com/fluxcd/source-controller/internal/digest"
 	serror "github.com/fluxcd/source-controller/internal/error"
+	"github.com/fluxcd/source-controller/internal/features"
 	"github.com/fluxcd/source-controller/internal/helm/chart"
 	"github.com/fluxcd/source-controller/internal/helm/getter"
 	"github.com/fluxcd/source-controller/internal/helm/registry"
 	"github.com/fluxcd/source-controller/internal/helm/repository"
+	"github.com/fluxcd/source-controller/internal/latency"
 	soci "github.com/fluxcd/source-controller/internal/oci"
 	sreconcile "github.com/fluxcd/source-controller/internal/reconcile"
 	"github.com/fluxcd/source-controller/internal/reconcile/summarize"
+	"github.com/fluxcd/source-controller/internal/sourcemetrics"
+	"github.com/fluxcd/source-controller/internal/tracing"
+	"github.com/fluxcd/source-controller/internal/transport"
 	"github.com/fluxcd/source-controller/internal/util"
+	"github.com/fluxcd/source-controller/internal/webhook"
 )
 
+// valuesFileName is the name of the file next to the artifact of a HelmChart
+// containing the default values of the chart, when HelmChartSpec.ExtractValues
+// is enabled.
+const valuesFileName = "values.yaml"
+
 // helmChartReadyCondition contains all the conditions information
 // needed for HelmChart Ready status conditions summary calculation.
 var helmChartReadyCondition = summarize.Conditions{
@@ -87,7 +107,11 @@ var helmChartReadyCondition = summarize.Conditions{
 		sourcev1.BuildFailedCondition,
 		sourcev1.ArtifactOutdatedCondition,
 		sourcev1.ArtifactInStorageCondition,
+		sourcev1.ChartValidatedCondition,
 		sourcev1.SourceVerifiedCondition,
+		sourcev1.NewerVersionAvailableCondition,
+		sourcev1.RepositoryArtifactStaleCondition,
+		sourcev1.DeprecatedCondition,
 		meta.ReadyCondition,
 		meta.ReconcilingCondition,
 		meta.StalledCondition,
@@ -97,6 +121,7 @@ var helmChartReadyCondition = summarize.Conditions{
 		sourcev1.FetchFailedCondition,
 		sourcev1.BuildFailedCondition,
 		sourcev1.ArtifactOutdatedCondition,
+		sourcev1.ChartValidatedCondition,
 		sourcev1.ArtifactInStorageCondition,
 		sourcev1.SourceVerifiedCondition,
 		meta.StalledCondition,
@@ -139,6 +164,37 @@ type HelmChartReconciler struct {
 	TTL   time.Duration
 	*cache.CacheRecorder
 
+	PreStoreWebhook *webhook.PreStore
+
+	// LatencyRecorder records the sliding-window reconcile latency
+	// percentiles.
+	LatencyRecorder *latency.Recorder
+
+	// SourceMetrics records the reconcile duration, Artifact size and
+	// fetch failure metrics.
+	SourceMetrics *sourcemetrics.Recorder
+
+	// ConnectionLimiter bounds the number of concurrent outbound network
+	// operations across all reconcilers.
+	ConnectionLimiter *connlimit.Limiter
+
+	// AllowedSchemes is the list of URL schemes sources are allowed to use.
+	// Any scheme is allowed when empty.
+	AllowedSchemes []string
+
+	// AllowedChartAPIVersions is the list of chart API versions charts are
+	// allowed to have. Any API version is allowed when empty.
+	AllowedChartAPIVersions []string
+
+	// RequireIndexDigest fails the build of charts of which the entry in the
+	// repository index has no digest, instead of warning about it.
+	RequireIndexDigest bool
+
+	// ChartDownloads deduplicates the concurrent downloads of the same chart
+	// version from a HelmRepository across reconciles, when set.
+	ChartDownloads *repository.DownloadGroup
+
+	features     map[string]bool
 	patchOptions []patch.Option
 }
 
@@ -159,6 +215,10 @@ type helmChartReconcileFunc func(ctx context.Context, sp *patch.SerialPatcher, o
 func (r *HelmChartReconciler) SetupWithManagerAndOptions(mgr ctrl.Manager, opts HelmChartReconcilerOptions) error {
 	r.patchOptions = getPatchOptions(helmChartReadyCondition.Owned, r.ControllerName)
 
+	if r.features == nil {
+		r.features = features.FeatureGates()
+	}
+
 	if err := mgr.GetCache().IndexField(context.TODO(), &helmv1.HelmRepository{}, helmv1.HelmRepositoryURLIndexKey,
 		r.indexHelmRepositoryByURL); err != nil {
 		return fmt.Errorf("failed setting index fields: %w", err)
@@ -198,6 +258,11 @@ func (r *HelmChartReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	start := time.Now()
 	log := ctrl.LoggerFrom(ctx)
 
+	ctx, span := tracing.StartReconcile(ctx, helmv1.HelmChartKind, req.Namespace, req.Name)
+	defer func() {
+		tracing.End(span, retErr)
+	}()
+
 	// Fetch the HelmChart
 	obj := &helmv1.HelmChart{}
 	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
@@ -235,6 +300,8 @@ func (r *HelmChartReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		// Always record readiness and duration metrics
 		r.Metrics.RecordReadiness(ctx, obj)
 		r.Metrics.RecordDuration(ctx, obj, start)
+		r.LatencyRecorder.Observe(helmv1.HelmChartKind, time.Since(start))
+		r.SourceMetrics.Record(helmv1.HelmChartKind, obj, time.Since(start), retErr)
 	}()
 
 	// Add finalizer first if not exist to avoid the race condition
@@ -263,6 +330,7 @@ func (r *HelmChartReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		r.reconcileStorage,
 		r.reconcileSource,
 		r.reconcileArtifact,
+		r.reconcilePush,
 	}
 	recResult, retErr = r.reconcile(ctx, serialPatcher, obj, reconcilers)
 	return
@@ -302,7 +370,9 @@ func (r *HelmChartReconciler) reconcile(ctx context.Context, sp *patch.SerialPat
 		resErr error
 	)
 	for _, rec := range reconcilers {
-		recResult, err := rec(ctx, sp, obj, &build)
+		recCtx, recSpan := tracing.StartFunc(ctx, rec)
+		recResult, err := rec(recCtx, sp, obj, &build)
+		tracing.End(recSpan, err)
 		// Exit immediately on ResultRequeue.
 		if recResult == sreconcile.ResultRequeue {
 			return sreconcile.ResultRequeue, nil
@@ -333,16 +403,19 @@ func (r *HelmChartReconciler) notify(ctx context.Context, oldObj, newObj *helmv1
 			fmt.Sprintf("%s/%s", sourcev1.GroupVersion.Group, eventv1.MetaDigestKey):   newObj.Status.Artifact.Digest,
 		}
 
+		message := fmt.Sprintf("%s with revision '%s' at '%s'",
+			build.Summary(), newObj.Status.Artifact.Revision, newObj.Status.Artifact.Path)
+
 		// Notify on new artifact and failure recovery.
 		if !oldObj.GetArtifact().HasDigest(newObj.GetArtifact().Digest) {
 			r.AnnotatedEventf(newObj, annotations, corev1.EventTypeNormal,
-				reasonForBuild(build), build.Summary())
-			ctrl.LoggerFrom(ctx).Info(build.Summary())
+				reasonForBuild(build), message)
+			ctrl.LoggerFrom(ctx).Info(message)
 		} else {
 			if sreconcile.FailureRecovery(oldObj, newObj, helmChartFailConditions) {
 				r.AnnotatedEventf(newObj, annotations, corev1.EventTypeNormal,
-					reasonForBuild(build), build.Summary())
-				ctrl.LoggerFrom(ctx).Info(build.Summary())
+					reasonForBuild(build), message)
+				ctrl.LoggerFrom(ctx).Info(message)
 			}
 		}
 	}
@@ -366,20 +439,36 @@ func (r *HelmChartReconciler) reconcileStorage(ctx context.Context, sp *patch.Se
 
 	// Determine if the advertised artifact is still in storage
 	var artifactMissing bool
-	if artifact := obj.GetArtifact(); artifact != nil && !r.Storage.ArtifactExist(*artifact) {
+	if artifact := obj.GetArtifact(); artifact != nil && r.Storage.ArtifactMissing(*artifact) {
 		obj.Status.Artifact = nil
 		obj.Status.URL = ""
+		obj.Status.ChartMetadata = nil
 		artifactMissing = true
 		// Remove the condition as the artifact doesn't exist.
 		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
 	}
 
+	// Determine if the advertised artifact still matches its digest
+	var artifactMismatch bool
+	if err := r.Storage.ArtifactDigestMismatch(obj.GetArtifact()); err != nil {
+		r.eventLogf(ctx, obj, corev1.EventTypeWarning, sourcev1.ArtifactDigestMismatchReason,
+			"failed to verify integrity of artifact: %s", err.Error())
+		obj.Status.Artifact = nil
+		obj.Status.URL = ""
+		obj.Status.ChartMetadata = nil
+		artifactMismatch = true
+		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
+	}
+
 	// Record that we do not have an artifact
 	if obj.GetArtifact() == nil {
 		msg := "building artifact"
 		if artifactMissing {
 			msg += ": disappeared from storage"
 		}
+		if artifactMismatch {
+			msg += ": digest mismatch in storage"
+		}
 		rreconcile.ProgressiveStatus(true, obj, meta.ProgressingReason, msg)
 		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
 		if err := sp.Patch(ctx, obj, r.patchOptions...); err != nil {
@@ -388,15 +477,29 @@ func (r *HelmChartReconciler) reconcileStorage(ctx context.Context, sp *patch.Se
 		return sreconcile.ResultSuccess, nil
 	}
 
-	// Always update URLs to ensure hostname is up-to-date
-	// TODO(hidde): we may want to send out an event only if we notice the URL has changed
-	r.Storage.SetArtifactURL(obj.GetArtifact())
+	// Always update URLs to ensure hostname is up-to-date, and notify about
+	// corrected URLs of e.g. a changed storage hostname
+	if previousURL, ok := r.Storage.UpdateArtifactURL(obj.GetArtifact()); ok {
+		r.eventLogf(ctx, obj, corev1.EventTypeNormal, sourcev1.ArtifactURLUpdatedReason,
+			"artifact URL updated from '%s' to '%s' to match the storage hostname", previousURL, obj.GetArtifact().URL)
+	}
 	obj.Status.URL = r.Storage.SetHostname(obj.Status.URL)
+	if obj.Status.ValuesURL != "" {
+		obj.Status.ValuesURL = r.Storage.SetHostname(obj.Status.ValuesURL)
+	}
 
 	return sreconcile.ResultSuccess, nil
 }
 
 func (r *HelmChartReconciler) reconcileSource(ctx context.Context, sp *patch.SerialPatcher, obj *helmv1.HelmChart, build *chart.Build) (_ sreconcile.Result, retErr error) {
+	// Validate the referenced secrets before any network operation
+	if r.features[features.PreflightSecrets] {
+		if e := preflightSecrets(ctx, r.Client, obj.GetNamespace(), helmChartSecretReferences(obj)...); e != nil {
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return sreconcile.ResultEmpty, e
+		}
+	}
+
 	// Remove any failed verification condition.
 	// The reason is that a failing verification should be recalculated.
 	if conditions.IsFalse(obj, sourcev1.SourceVerifiedCondition) {
@@ -406,6 +509,16 @@ func (r *HelmChartReconciler) reconcileSource(ctx context.Context, sp *patch.Ser
 	// Retrieve the source
 	s, err := r.getSource(ctx, obj)
 	if err != nil {
+		// An unsupported kind can only be solved by a change in generation
+		if errors.Is(err, errUnsupportedSourceKind) {
+			e := &serror.Stalling{
+				Err:    fmt.Errorf("failed to get source: %w", err),
+				Reason: helmv1.UnsupportedSourceKindReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+			return sreconcile.ResultEmpty, e
+		}
+
 		e := &serror.Event{
 			Err:    fmt.Errorf("failed to get source: %w", err),
 			Reason: "SourceUnavailable",
@@ -417,12 +530,23 @@ func (r *HelmChartReconciler) reconcileSource(ctx context.Context, sp *patch.Ser
 		if apierrs.ReasonForError(err) == metav1.StatusReasonUnknown {
 			return sreconcile.ResultEmpty, &serror.Stalling{
 				Err:    fmt.Errorf("failed to get source: %w", err),
-				Reason: "UnsupportedSourceKind",
+				Reason: e.Reason,
 			}
 		}
 		return sreconcile.ResultEmpty, e
 	}
 
+	// Validation requires a chart version to resolve in a repository
+	if _, ok := s.(*helmv1.HelmRepository); !ok && obj.Spec.ReconcileStrategy == helmv1.ReconcileStrategyValidate {
+		e := &serror.Stalling{
+			Err: fmt.Errorf("reconcile strategy '%s' is not supported for %s sources",
+				helmv1.ReconcileStrategyValidate, obj.Spec.SourceRef.Kind),
+			Reason: helmv1.UnsupportedReconcileStrategyReason,
+		}
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
 	// Assert source has an artifact
 	if s.GetArtifact() == nil || !r.Storage.ArtifactExist(*s.GetArtifact()) {
 		// Set the condition to indicate that the source has no artifact for all types except OCI HelmRepository
@@ -440,6 +564,9 @@ func (r *HelmChartReconciler) reconcileSource(ctx context.Context, sp *patch.Ser
 		obj.Status.ObservedSourceArtifactRevision = s.GetArtifact().Revision
 	}
 
+	// Warn if the chart is resolved against a stale repository artifact
+	markRepositoryArtifactAge(obj, s)
+
 	// Defer observation of build result
 	defer func() {
 		// Record both success and error observations on the object
@@ -484,6 +611,26 @@ func (r *HelmChartReconciler) reconcileSource(ctx context.Context, sp *patch.Ser
 	}
 }
 
+// markRepositoryArtifactAge sets the RepositoryArtifactStaleCondition on the
+// object if the artifact of the given HelmRepository source is older than
+// spec.maxRepositoryArtifactAge, and removes it otherwise.
+func markRepositoryArtifactAge(obj *helmv1.HelmChart, s sourcev1.Source) {
+	repo, ok := s.(*helmv1.HelmRepository)
+	if !ok || obj.Spec.MaxRepositoryArtifactAge == nil || repo.GetArtifact() == nil {
+		conditions.Delete(obj, sourcev1.RepositoryArtifactStaleCondition)
+		return
+	}
+
+	maxAge := obj.Spec.MaxRepositoryArtifactAge.Duration
+	if age := time.Since(repo.GetArtifact().LastUpdateTime.Time); age > maxAge {
+		conditions.MarkTrue(obj, sourcev1.RepositoryArtifactStaleCondition, sourcev1.ArtifactAgeExceededReason,
+			"artifact of %s '%s' was last updated %s ago, exceeding the maximum age of %s",
+			obj.Spec.SourceRef.Kind, obj.Spec.SourceRef.Name, age.Round(time.Second), maxAge)
+		return
+	}
+	conditions.Delete(obj, sourcev1.RepositoryArtifactStaleCondition)
+}
+
 // buildFromHelmRepository attempts to pull and/or package a Helm chart with
 // the specified data from the v1beta2.HelmRepository and v1beta2.HelmChart
 // objects.
@@ -493,23 +640,45 @@ func (r *HelmChartReconciler) buildFromHelmRepository(ctx context.Context, obj *
 	repo *helmv1.HelmRepository, b *chart.Build) (sreconcile.Result, error) {
 	var (
 		tlsConfig     *tls.Config
+		proxy         *transport.Proxy
 		authenticator authn.Authenticator
 		keychain      authn.Keychain
 	)
 	// Used to login with the repository declared provider
-	ctxTimeout, cancel := context.WithTimeout(ctx, repo.Spec.Timeout.Duration)
+	ctxTimeout, cancel := context.WithTimeout(ctx, repo.GetTimeout())
 	defer cancel()
 
+	if err := util.ValidateURLScheme(repo.Spec.URL, r.AllowedSchemes); err != nil {
+		e := &serror.Stalling{
+			Err:    fmt.Errorf("invalid Helm repository URL '%s': %w", util.RedactURL(repo.Spec.URL), err),
+			Reason: sourcev1.URLSchemeNotAllowedReason,
+		}
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
 	normalizedURL, err := repository.NormalizeURL(repo.Spec.URL)
 	if err != nil {
 		return chartRepoConfigErrorReturn(err, obj)
 	}
+	// Extract any credentials embedded in the URL of an HTTP repository, to
+	// prevent them from being exposed through the chart URLs.
+	var urlAuth helmgetter.Option
+	if repo.Spec.Type != helmv1.HelmRepositoryTypeOCI {
+		normalizedURL, urlAuth, err = getter.BasicAuthFromURL(normalizedURL)
+		if err != nil {
+			return chartRepoConfigErrorReturn(err, obj)
+		}
+	}
 	// Construct the Getter options from the HelmRepository data
 	clientOpts := []helmgetter.Option{
 		helmgetter.WithURL(normalizedURL),
-		helmgetter.WithTimeout(repo.Spec.Timeout.Duration),
+		helmgetter.WithTimeout(repo.GetTimeout()),
 		helmgetter.WithPassCredentialsAll(repo.Spec.PassCredentials),
 	}
+	if urlAuth != nil {
+		clientOpts = append(clientOpts, urlAuth)
+	}
 	if secret, err := r.getHelmRepositorySecret(ctx, repo); secret != nil || err != nil {
 		if err != nil {
 			e := &serror.Event{
@@ -521,6 +690,16 @@ func (r *HelmChartReconciler) buildFromHelmRepository(ctx context.Context, obj *
 			return sreconcile.ResultEmpty, e
 		}
 
+		if err := validateInsecureSkipVerify(repo, secret); err != nil {
+			e := &serror.Event{
+				Err:    err,
+				Reason: helmv1.InvalidTLSConfigReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			// Requeue as content of secret might change
+			return sreconcile.ResultEmpty, e
+		}
+
 		// Build client options from secret
 		opts, tlsCfg, err := r.clientOptionsFromSecret(secret, normalizedURL)
 		if err != nil {
@@ -535,6 +714,18 @@ func (r *HelmChartReconciler) buildFromHelmRepository(ctx context.Context, obj *
 		clientOpts = append(clientOpts, opts...)
 		tlsConfig = tlsCfg
 
+		// Build proxy configuration from secret
+		proxy, err = getter.ProxyFromSecret(*secret)
+		if err != nil {
+			e := &serror.Event{
+				Err:    fmt.Errorf("failed to configure proxy with secret data: %w", err),
+				Reason: sourcev1.AuthenticationFailedReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			// Requeue as content of secret might change
+			return sreconcile.ResultEmpty, e
+		}
+
 		// Build registryClient options from secret
 		keychain, err = registry.LoginOptionFromSecret(normalizedURL, *secret)
 		if err != nil {
@@ -561,6 +752,24 @@ func (r *HelmChartReconciler) buildFromHelmRepository(ctx context.Context, obj *
 		}
 	}
 
+	if repo.Spec.Type != helmv1.HelmRepositoryTypeOCI && repo.Spec.Proxy != nil {
+		proxy, err = proxyFromConfig(ctx, r.Client, repo.GetNamespace(), repo.Spec.Proxy)
+		if errors.Is(err, errInvalidProxyURL) {
+			e := serror.NewStalling(err, sourcev1.URLInvalidReason)
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return sreconcile.ResultEmpty, e
+		}
+		if err != nil {
+			e := &serror.Event{
+				Err:    fmt.Errorf("failed to configure proxy: %w", err),
+				Reason: sourcev1.AuthenticationFailedReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			// Requeue as content of secret might change
+			return sreconcile.ResultEmpty, e
+		}
+	}
+
 	loginOpt, err := makeLoginOption(authenticator, keychain, normalizedURL)
 	if err != nil {
 		e := &serror.Event{
@@ -626,6 +835,7 @@ func (r *HelmChartReconciler) buildFromHelmRepository(ctx context.Context, obj *
 			repository.WithOCIGetter(r.Getters),
 			repository.WithOCIGetterOptions(clientOpts),
 			repository.WithOCIRegistryClient(registryClient),
+			repository.WithOCIConnectionLimiter(r.ConnectionLimiter),
 			repository.WithVerifiers(verifiers))
 		if err != nil {
 			return chartRepoConfigErrorReturn(err, obj)
@@ -646,10 +856,30 @@ func (r *HelmChartReconciler) buildFromHelmRepository(ctx context.Context, obj *
 			}
 		}
 	default:
-		httpChartRepo, err := repository.NewChartRepository(normalizedURL, r.Storage.LocalPath(*repo.GetArtifact()), r.Getters, tlsConfig, clientOpts...)
+		httpChartRepo, err := repository.NewChartRepository(normalizedURL, r.Storage.LocalPath(*repo.GetArtifact()), r.Getters,
+			getter.WithInsecureSkipVerify(getter.WithTLSServerName(tlsConfig, repo.Spec.TLSServerName), repo.Spec.Insecure),
+			clientOpts...)
 		if err != nil {
 			return chartRepoConfigErrorReturn(err, obj)
 		}
+		httpChartRepo.Proxy = proxy
+		httpChartRepo.ConnectionLimiter = r.ConnectionLimiter
+		// Downloads are scoped to the HelmRepository, as its credentials
+		// apply to them.
+		httpChartRepo.Downloads = r.ChartDownloads.Scoped(repo.Namespace + "/" + repo.Name)
+
+		if obj.Spec.Verify != nil {
+			keyring, err := r.makeKeyring(ctx, obj)
+			if err != nil {
+				e := &serror.Event{
+					Err:    fmt.Errorf("failed to verify the provenance using provider '%s': %w", obj.Spec.Verify.Provider, err),
+					Reason: sourcev1.VerificationError,
+				}
+				conditions.MarkFalse(obj, sourcev1.SourceVerifiedCondition, e.Reason, e.Err.Error())
+				return sreconcile.ResultEmpty, e
+			}
+			httpChartRepo.Keyring = keyring
+		}
 
 		// NB: this needs to be deferred first, as otherwise the Index will disappear
 		// before we had a chance to cache it.
@@ -688,9 +918,19 @@ func (r *HelmChartReconciler) buildFromHelmRepository(ctx context.Context, obj *
 		// The remote builder will not attempt to download the chart if
 		// an artifact exists with the same name and version and `Force` is false.
 		// It will however try to verify the chart if `obj.Spec.Verify` is set, at every reconciliation.
-		Verify: obj.Spec.Verify != nil && obj.Spec.Verify.Provider != "",
-	}
-	if artifact := obj.GetArtifact(); artifact != nil {
+		Verify:                obj.Spec.Verify != nil && obj.Spec.Verify.Provider != "",
+		FailOnVersionMismatch: obj.Spec.VersionMismatchPolicy == helmv1.VersionMismatchPolicyError,
+		RequireIndexDigest:    r.RequireIndexDigest,
+		AllowedAPIVersions:    r.AllowedChartAPIVersions,
+		// A validated chart is not downloaded, but only confirmed to be
+		// available in the repository.
+		ValidateOnly: obj.Spec.ReconcileStrategy == helmv1.ReconcileStrategyValidate,
+	}
+	// A validated chart is never stored, and must therefore be confirmed
+	// to be available every time. A chart stored with another digest
+	// algorithm is downloaded again to store it with the configured one.
+	if artifact := obj.GetArtifact(); artifact != nil && !opts.ValidateOnly &&
+		!digestAlgorithmChanged(artifact, obj.Spec.DigestAlgorithm) {
 		opts.CachedChart = r.Storage.LocalPath(*artifact)
 	}
 
@@ -699,6 +939,9 @@ func (r *HelmChartReconciler) buildFromHelmRepository(ctx context.Context, obj *
 	if len(opts.GetValuesFiles()) > 0 {
 		opts.VersionMetadata = strconv.FormatInt(obj.Generation, 10)
 	}
+	if err := setInlineValues(obj, &opts); err != nil {
+		return sreconcile.ResultEmpty, err
+	}
 
 	// Build the chart
 	ref := chart.RemoteReference{Name: obj.Spec.Chart, Version: obj.Spec.Version}
@@ -706,6 +949,19 @@ func (r *HelmChartReconciler) buildFromHelmRepository(ctx context.Context, obj *
 	if err != nil {
 		return sreconcile.ResultEmpty, err
 	}
+	// The provenance of a cached chart has been verified before it was stored
+	if opts.Verify && build.SignerKeyID == "" && build.Path == opts.CachedChart {
+		build.SignerKeyID = obj.Status.SignerKeyID
+	}
+	if build.MismatchedVersion != "" {
+		r.eventLogf(ctx, obj, corev1.EventTypeWarning, helmv1.VersionMismatchReason,
+			"chart declares version '%s' while the repository index has version '%s': storing chart with the index version",
+			build.MismatchedVersion, build.Version)
+	}
+	if build.MissingDigest {
+		r.eventLogf(ctx, obj, corev1.EventTypeWarning, helmv1.MissingDigestReason,
+			"chart '%s' version '%s' has no digest in the repository index", build.Name, build.Version)
+	}
 
 	*b = *build
 	return sreconcile.ResultSuccess, nil
@@ -778,10 +1034,13 @@ func (r *HelmChartReconciler) buildFromTarballArtifact(ctx context.Context, obj
 
 	// Configure builder options, including any previously cached chart
 	opts := chart.BuildOptions{
-		ValuesFiles: obj.GetValuesFiles(),
-		Force:       obj.Generation != obj.Status.ObservedGeneration,
+		ValuesFiles:        obj.GetValuesFiles(),
+		Force:              obj.Generation != obj.Status.ObservedGeneration,
+		AllowedAPIVersions: r.AllowedChartAPIVersions,
 	}
-	if artifact := obj.Status.Artifact; artifact != nil {
+	// A chart stored with another digest algorithm is built again to store
+	// it with the configured one.
+	if artifact := obj.Status.Artifact; artifact != nil && !digestAlgorithmChanged(artifact, obj.Spec.DigestAlgorithm) {
 		opts.CachedChart = r.Storage.LocalPath(*artifact)
 	}
 
@@ -819,12 +1078,31 @@ func (r *HelmChartReconciler) buildFromTarballArtifact(ctx context.Context, obj
 		}
 		opts.VersionMetadata += strconv.FormatInt(obj.Generation, 10)
 	}
+	if err := setInlineValues(obj, &opts); err != nil {
+		return sreconcile.ResultEmpty, err
+	}
+
+	// Determine the path of the chart to package within the source
+	chartPath := obj.Spec.Chart
+	if obj.Spec.ChartPath != "" {
+		chartPath = filepath.Join(chartPath, obj.Spec.ChartPath)
+		securePath, err := securejoin.SecureJoin(sourceDir, chartPath)
+		if err != nil {
+			return sreconcile.ResultEmpty, &chart.BuildError{Reason: chart.ErrChartReference, Err: err}
+		}
+		if _, err := os.Stat(filepath.Join(securePath, chartutil.ChartfileName)); err != nil {
+			return sreconcile.ResultEmpty, &chart.BuildError{
+				Reason: chart.ErrChartReference,
+				Err:    fmt.Errorf("no %s found at chart path '%s'", chartutil.ChartfileName, obj.Spec.ChartPath),
+			}
+		}
+	}
 
 	// Build chart
 	cb := chart.NewLocalBuilder(dm)
 	build, err := cb.Build(ctx, chart.LocalReference{
 		WorkDir: sourceDir,
-		Path:    obj.Spec.Chart,
+		Path:    chartPath,
 	}, util.TempPathForObj("", ".tgz", obj), opts)
 	if err != nil {
 		return sreconcile.ResultEmpty, err
@@ -849,9 +1127,66 @@ func (r *HelmChartReconciler) reconcileArtifact(ctx context.Context, _ *patch.Se
 		return sreconcile.ResultRequeue, nil
 	}
 
-	// Set the ArtifactInStorageCondition if there's no drift.
+	// Report if the chart version is behind the latest available version
+	obj.Status.LatestVersion = b.LatestVersion
+	if b.NewerVersionAvailable() {
+		conditions.MarkTrue(obj, sourcev1.NewerVersionAvailableCondition, sourcev1.NewChartVersionReason,
+			"chart version '%s' is behind the latest available version '%s'", b.Version, b.LatestVersion)
+	} else {
+		conditions.Delete(obj, sourcev1.NewerVersionAvailableCondition)
+	}
+
+	// Report if the chart version is deprecated, while still storing it
+	if b.Deprecated {
+		conditions.MarkTrue(obj, sourcev1.DeprecatedCondition, sourcev1.ChartDeprecatedReason,
+			"chart '%s' version '%s' is deprecated", b.Name, b.Version)
+	} else {
+		conditions.Delete(obj, sourcev1.DeprecatedCondition)
+	}
+
+	// Report the validated chart instead of storing it
+	if obj.Spec.ReconcileStrategy == helmv1.ReconcileStrategyValidate {
+		// The chart is only downloaded when required to verify it
+		if b.Path != "" {
+			defer os.Remove(b.Path)
+		}
+
+		// Remove the artifact stored before switching to validation
+		if obj.GetArtifact() != nil {
+			if _, err := r.Storage.RemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
+				e := &serror.Event{
+					Err:    fmt.Errorf("failed to remove stored artifact: %w", err),
+					Reason: "GarbageCollectionFailed",
+				}
+				conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
+				return sreconcile.ResultEmpty, e
+			}
+			obj.Status.Artifact = nil
+			obj.Status.URL = ""
+			obj.Status.ObservedChartName = ""
+			obj.Status.ChartMetadata = nil
+		}
+		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
+		conditions.Delete(obj, sourcev1.ArtifactOutdatedCondition)
+		if !conditions.IsTrue(obj, sourcev1.ChartValidatedCondition) {
+			r.eventLogf(ctx, obj, eventv1.EventTypeTrace, helmv1.ValidationOnlyReason,
+				"validated chart '%s' version '%s'", b.Name, b.Version)
+		}
+		conditions.MarkTrue(obj, sourcev1.ChartValidatedCondition, helmv1.ValidationOnlyReason,
+			"validated chart '%s' version '%s' without storing an artifact", b.Name, b.Version)
+		return sreconcile.ResultSuccess, nil
+	}
+	conditions.Delete(obj, sourcev1.ChartValidatedCondition)
+
+	// Set the ArtifactInStorageCondition and the chart metadata if there's
+	// no drift.
 	defer func() {
 		if obj.Status.ObservedChartName == b.Name && obj.GetArtifact().HasRevision(b.Version) {
+			obj.Status.ChartMetadata = &helmv1.HelmChartMetadata{
+				Name:       b.Name,
+				Version:    b.Version,
+				AppVersion: b.AppVersion,
+			}
 			conditions.Delete(obj, sourcev1.ArtifactOutdatedCondition)
 			conditions.MarkTrue(obj, sourcev1.ArtifactInStorageCondition, reasonForBuild(b), b.Summary())
 		}
@@ -863,12 +1198,22 @@ func (r *HelmChartReconciler) reconcileArtifact(ctx context.Context, _ *patch.Se
 	// Return early if the build path equals the current artifact path
 	if curArtifact := obj.GetArtifact(); curArtifact != nil && r.Storage.LocalPath(*curArtifact) == b.Path {
 		r.eventLogf(ctx, obj, eventv1.EventTypeTrace, sourcev1.ArtifactUpToDateReason, "artifact up-to-date with remote revision: '%s'", artifact.Revision)
+		if err := r.reconcileValues(ctx, obj, b.Path); err != nil {
+			return sreconcile.ResultEmpty, err
+		}
+		conditions.Delete(obj, sourcev1.StorageOperationFailedCondition)
 		return sreconcile.ResultSuccess, nil
 	}
 
 	// Garbage collect chart build once persisted to storage
 	defer os.Remove(b.Path)
 
+	// Consult the pre-store webhook before storing the artifact
+	if e := reviewArtifact(ctx, r.PreStoreWebhook, helmv1.HelmChartKind, obj, artifact); e != nil {
+		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
 	// Ensure artifact directory exists and acquire lock
 	if err := r.Storage.MkdirAll(artifact); err != nil {
 		e := &serror.Event{
@@ -890,10 +1235,10 @@ func (r *HelmChartReconciler) reconcileArtifact(ctx context.Context, _ *patch.Se
 	defer unlock()
 
 	// Copy the packaged chart to the artifact path
-	if err = r.Storage.CopyFromPath(&artifact, b.Path); err != nil {
+	if err = r.Storage.CopyFromPath(&artifact, b.Path, WithDigestAlgorithm(digest.Algorithm(obj.Spec.DigestAlgorithm))); err != nil {
 		e := &serror.Event{
 			Err:    fmt.Errorf("unable to copy Helm chart to storage: %w", err),
-			Reason: sourcev1.ArchiveOperationFailedReason,
+			Reason: storageFailedReason(err),
 		}
 		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
 		return sreconcile.ResultEmpty, e
@@ -902,6 +1247,12 @@ func (r *HelmChartReconciler) reconcileArtifact(ctx context.Context, _ *patch.Se
 	// Record it on the object
 	obj.Status.Artifact = artifact.DeepCopy()
 	obj.Status.ObservedChartName = b.Name
+	obj.Status.SignerKeyID = b.SignerKeyID
+
+	// Save the default values next to the artifact, or remove any stale ones.
+	if err = r.reconcileValues(ctx, obj, b.Path); err != nil {
+		return sreconcile.ResultEmpty, err
+	}
 
 	// Update symlink on a "best effort" basis
 	symURL, err := r.Storage.Symlink(artifact, "latest.tar.gz")
@@ -916,6 +1267,172 @@ func (r *HelmChartReconciler) reconcileArtifact(ctx context.Context, _ *patch.Se
 	return sreconcile.ResultSuccess, nil
 }
 
+// reconcileValues stores the default values file of the chart at the given
+// path next to the Artifact of the object when HelmChartSpec.ExtractValues is
+// enabled, and records its URL and digest in the Status. The file is only
+// written when its digest differs from the recorded one. When disabled, any
+// previously stored values file is removed.
+func (r *HelmChartReconciler) reconcileValues(ctx context.Context, obj *helmv1.HelmChart, chartPath string) error {
+	valuesArtifact := r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), obj.GetArtifact().Revision, valuesFileName)
+	if !obj.Spec.ExtractValues {
+		if obj.Status.ValuesURL != "" {
+			if err := os.Remove(r.Storage.LocalPath(valuesArtifact)); err != nil && !os.IsNotExist(err) {
+				r.eventLogf(ctx, obj, eventv1.EventTypeTrace, "GarbageCollectionFailed",
+					"failed to remove values file from storage: %s", err)
+			}
+		}
+		obj.Status.ValuesURL = ""
+		obj.Status.ValuesDigest = ""
+		return nil
+	}
+
+	values, err := chart.LoadChartValuesFromArchive(chartPath)
+	if err != nil {
+		e := &serror.Event{
+			Err:    fmt.Errorf("failed to extract values file from chart: %w", err),
+			Reason: sourcev1.ArchiveOperationFailedReason,
+		}
+		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
+		return e
+	}
+
+	algo := intdigest.Canonical
+	if obj.Spec.DigestAlgorithm != "" {
+		algo = digest.Algorithm(obj.Spec.DigestAlgorithm)
+	}
+	if algo.Available() && algo.FromBytes(values).String() == obj.Status.ValuesDigest && r.Storage.ArtifactExist(valuesArtifact) {
+		obj.Status.ValuesURL = valuesArtifact.URL
+		return nil
+	}
+
+	if err = r.Storage.Copy(&valuesArtifact, bytes.NewReader(values), WithDigestAlgorithm(algo),
+		WithExpectedSize(int64(len(values)))); err != nil {
+		e := &serror.Event{
+			Err:    fmt.Errorf("unable to save values file to storage: %w", err),
+			Reason: storageFailedReason(err),
+		}
+		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
+		return e
+	}
+	obj.Status.ValuesURL = valuesArtifact.URL
+	obj.Status.ValuesDigest = valuesArtifact.Digest
+	return nil
+}
+
+// reconcilePush pushes the Artifact of the object to the OCI repository
+// configured in HelmChartSpec.Push, if it has not been pushed there before.
+//
+// On a successful push, the reference and manifest digest of the pushed chart
+// are recorded in the Status of the object. A failure to push is recorded as a
+// v1beta2.StorageOperationFailedCondition with ChartPushFailedReason.
+func (r *HelmChartReconciler) reconcilePush(ctx context.Context, _ *patch.SerialPatcher, obj *helmv1.HelmChart, _ *chart.Build) (sreconcile.Result, error) {
+	if obj.Spec.Push == nil {
+		obj.Status.Push = nil
+		if conditions.GetReason(obj, sourcev1.StorageOperationFailedCondition) == helmv1.ChartPushFailedReason {
+			conditions.Delete(obj, sourcev1.StorageOperationFailedCondition)
+		}
+		return sreconcile.ResultSuccess, nil
+	}
+
+	// Only stored Artifacts are pushed
+	artifact := obj.GetArtifact()
+	if artifact == nil || obj.Spec.ReconcileStrategy == helmv1.ReconcileStrategyValidate {
+		return sreconcile.ResultSuccess, nil
+	}
+
+	// Return early if the Artifact has already been pushed to the repository
+	ref := chartPushRef(obj.Spec.Push.OCIRef, obj.Status.ObservedChartName, artifact.Revision)
+	if p := obj.Status.Push; p != nil && p.Ref == ref && p.ArtifactDigest == artifact.Digest {
+		return sreconcile.ResultSuccess, nil
+	}
+
+	pushFailed := func(err error) (sreconcile.Result, error) {
+		e := &serror.Event{
+			Err:    fmt.Errorf("failed to push chart to '%s': %w", ref, err),
+			Reason: helmv1.ChartPushFailedReason,
+		}
+		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
+	u, err := url.Parse(obj.Spec.Push.OCIRef)
+	if err != nil {
+		return pushFailed(err)
+	}
+
+	// Construct the login option from the referenced secret, if any
+	var loginOpt helmreg.LoginOption
+	if obj.Spec.Push.SecretRef != nil {
+		var secret corev1.Secret
+		name := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.Spec.Push.SecretRef.Name}
+		if err := r.Client.Get(ctx, name, &secret); err != nil {
+			return pushFailed(fmt.Errorf("failed to get secret '%s': %w", name.String(), err))
+		}
+		keychain, err := registry.LoginOptionFromSecret(obj.Spec.Push.OCIRef, secret)
+		if err != nil {
+			return pushFailed(err)
+		}
+		if loginOpt, err = makeLoginOption(nil, keychain, obj.Spec.Push.OCIRef); err != nil {
+			return pushFailed(err)
+		}
+	}
+
+	registryClient, credentialsFile, err := r.RegistryClientGenerator(loginOpt != nil)
+	if err != nil {
+		return pushFailed(fmt.Errorf("failed to construct Helm client: %w", err))
+	}
+	if credentialsFile != "" {
+		defer func() {
+			if err := os.Remove(credentialsFile); err != nil {
+				r.eventLogf(ctx, obj, corev1.EventTypeWarning, meta.FailedReason,
+					"failed to delete temporary credentials file: %s", err)
+			}
+		}()
+	}
+	if loginOpt != nil {
+		if err := registryClient.Login(u.Host, loginOpt); err != nil {
+			return pushFailed(fmt.Errorf("failed to login to OCI registry: %w", err))
+		}
+	}
+
+	data, err := os.ReadFile(r.Storage.LocalPath(*artifact))
+	if err != nil {
+		return pushFailed(err)
+	}
+	// Strict mode compares the tag to the version of the chart before it is
+	// normalized, while the reference is already constructed from the
+	// metadata of the chart.
+	res, err := registryClient.Push(data, ref, helmreg.PushOptStrictMode(false))
+	if err != nil {
+		return pushFailed(err)
+	}
+
+	obj.Status.Push = &helmv1.HelmChartPushStatus{
+		Ref:            ref,
+		Digest:         res.Manifest.Digest,
+		ArtifactDigest: artifact.Digest,
+	}
+	r.eventLogf(ctx, obj, corev1.EventTypeNormal, helmv1.ChartPushSucceededReason,
+		"pushed chart to '%s' with digest '%s'", ref, res.Manifest.Digest)
+	if conditions.GetReason(obj, sourcev1.StorageOperationFailedCondition) == helmv1.ChartPushFailedReason {
+		conditions.Delete(obj, sourcev1.StorageOperationFailedCondition)
+	}
+	return sreconcile.ResultSuccess, nil
+}
+
+// chartPushRef returns the OCI reference a chart with the given name and
+// version is pushed to within the given 'oci://' repository. As with
+// 'helm push', the reference consists of the repository with the chart name
+// appended to it, and the version as tag with '+' replaced by '_'.
+func chartPushRef(ociRef, name, version string) string {
+	repo := strings.TrimSuffix(strings.TrimPrefix(ociRef, fmt.Sprintf("%s://", helmreg.OCIScheme)), "/")
+	return fmt.Sprintf("%s/%s:%s", repo, name, strings.ReplaceAll(version, "+", "_"))
+}
+
+// errUnsupportedSourceKind is returned by getSource for a SourceRef of which
+// the kind is not a supported Source kind.
+var errUnsupportedSourceKind = errors.New("unsupported source kind")
+
 // getSource returns the v1beta1.Source for the given object, or an error describing why the source could not be
 // returned.
 func (r *HelmChartReconciler) getSource(ctx context.Context, obj *helmv1.HelmChart) (sourcev1.Source, error) {
@@ -944,7 +1461,7 @@ func (r *HelmChartReconciler) getSource(ctx context.Context, obj *helmv1.HelmCha
 		}
 		s = &bucket
 	default:
-		return nil, fmt.Errorf("unsupported source kind '%s', must be one of: %v", obj.Spec.SourceRef.Kind, []string{
+		return nil, fmt.Errorf("%w '%s', must be one of: %v", errUnsupportedSourceKind, obj.Spec.SourceRef.Kind, []string{
 			helmv1.HelmRepositoryKind, sourcev1.GitRepositoryKind, helmv1.BucketKind})
 	}
 	return s, nil
@@ -974,7 +1491,7 @@ func (r *HelmChartReconciler) reconcileDelete(ctx context.Context, obj *helmv1.H
 // removal of all Artifacts for the objects.
 func (r *HelmChartReconciler) garbageCollect(ctx context.Context, obj *helmv1.HelmChart) error {
 	if !obj.DeletionTimestamp.IsZero() {
-		if deleted, err := r.Storage.RemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
+		if deleted, err := r.Storage.DeferRemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
 			return &serror.Event{
 				Err:    fmt.Errorf("garbage collection for deleted resource failed: %w", err),
 				Reason: "GarbageCollectionFailed",
@@ -987,7 +1504,7 @@ func (r *HelmChartReconciler) garbageCollect(ctx context.Context, obj *helmv1.He
 		return nil
 	}
 	if obj.GetArtifact() != nil {
-		delFiles, err := r.Storage.GarbageCollect(ctx, *obj.GetArtifact(), time.Second*5)
+		delFiles, err := r.Storage.GarbageCollect(ctx, *obj.GetArtifact(), obj.Spec.GC, time.Second*5)
 		if err != nil {
 			return &serror.Event{
 				Err:    fmt.Errorf("garbage collection of artifacts failed: %w", err),
@@ -1011,6 +1528,7 @@ func (r *HelmChartReconciler) namespacedChartRepositoryCallback(ctx context.Cont
 	return func(url string) (repository.Downloader, error) {
 		var (
 			tlsConfig     *tls.Config
+			proxy         *transport.Proxy
 			authenticator authn.Authenticator
 			keychain      authn.Keychain
 		)
@@ -1034,12 +1552,12 @@ func (r *HelmChartReconciler) namespacedChartRepositoryCallback(ctx context.Cont
 		}
 
 		// Used to login with the repository declared provider
-		ctxTimeout, cancel := context.WithTimeout(ctx, obj.Spec.Timeout.Duration)
+		ctxTimeout, cancel := context.WithTimeout(ctx, obj.GetTimeout())
 		defer cancel()
 
 		clientOpts := []helmgetter.Option{
 			helmgetter.WithURL(normalizedURL),
-			helmgetter.WithTimeout(obj.Spec.Timeout.Duration),
+			helmgetter.WithTimeout(obj.GetTimeout()),
 			helmgetter.WithPassCredentialsAll(obj.Spec.PassCredentials),
 		}
 		if secret, err := r.getHelmRepositorySecret(ctx, obj); secret != nil || err != nil {
@@ -1047,6 +1565,10 @@ func (r *HelmChartReconciler) namespacedChartRepositoryCallback(ctx context.Cont
 				return nil, err
 			}
 
+			if err := validateInsecureSkipVerify(obj, secret); err != nil {
+				return nil, err
+			}
+
 			// Build client options from secret
 			opts, tlsCfg, err := r.clientOptionsFromSecret(secret, normalizedURL)
 			if err != nil {
@@ -1055,6 +1577,12 @@ func (r *HelmChartReconciler) namespacedChartRepositoryCallback(ctx context.Cont
 			clientOpts = append(clientOpts, opts...)
 			tlsConfig = tlsCfg
 
+			// Build proxy configuration from secret
+			proxy, err = getter.ProxyFromSecret(*secret)
+			if err != nil {
+				return nil, fmt.Errorf("failed to configure proxy for HelmRepository '%s': %w", obj.Name, err)
+			}
+
 			// Build registryClient options from secret
 			keychain, err = registry.LoginOptionFromSecret(normalizedURL, *secret)
 			if err != nil {
@@ -1071,6 +1599,12 @@ func (r *HelmChartReconciler) namespacedChartRepositoryCallback(ctx context.Cont
 			}
 		}
 
+		if obj.Spec.Type != helmv1.HelmRepositoryTypeOCI && obj.Spec.Proxy != nil {
+			if proxy, err = proxyFromConfig(ctx, r.Client, obj.GetNamespace(), obj.Spec.Proxy); err != nil {
+				return nil, fmt.Errorf("failed to configure proxy for HelmRepository '%s': %w", obj.Name, err)
+			}
+		}
+
 		loginOpt, err := makeLoginOption(authenticator, keychain, normalizedURL)
 		if err != nil {
 			return nil, err
@@ -1089,6 +1623,7 @@ func (r *HelmChartReconciler) namespacedChartRepositoryCallback(ctx context.Cont
 			ociChartRepo, err := repository.NewOCIChartRepository(normalizedURL, repository.WithOCIGetter(r.Getters),
 				repository.WithOCIGetterOptions(clientOpts),
 				repository.WithOCIRegistryClient(registryClient),
+				repository.WithOCIConnectionLimiter(r.ConnectionLimiter),
 				repository.WithCredentialsFile(credentialsFile))
 			if err != nil {
 				errs = append(errs, fmt.Errorf("failed to create OCI chart repository for HelmRepository '%s': %w", obj.Name, err))
@@ -1115,10 +1650,14 @@ func (r *HelmChartReconciler) namespacedChartRepositoryCallback(ctx context.Cont
 
 			chartRepo = ociChartRepo
 		} else {
-			httpChartRepo, err := repository.NewChartRepository(normalizedURL, "", r.Getters, tlsConfig, clientOpts...)
+			httpChartRepo, err := repository.NewChartRepository(normalizedURL, "", r.Getters,
+				getter.WithInsecureSkipVerify(getter.WithTLSServerName(tlsConfig, obj.Spec.TLSServerName), obj.Spec.Insecure),
+				clientOpts...)
 			if err != nil {
 				return nil, err
 			}
+			httpChartRepo.Proxy = proxy
+			httpChartRepo.ConnectionLimiter = r.ConnectionLimiter
 
 			if artifact := obj.GetArtifact(); artifact != nil {
 				httpChartRepo.Path = r.Storage.LocalPath(*artifact)
@@ -1327,7 +1866,12 @@ func observeChartBuild(ctx context.Context, sp *patch.SerialPatcher, pOpts []pat
 	if build.Complete() {
 		conditions.Delete(obj, sourcev1.FetchFailedCondition)
 		conditions.Delete(obj, sourcev1.BuildFailedCondition)
-		conditions.MarkTrue(obj, sourcev1.SourceVerifiedCondition, meta.SucceededReason, fmt.Sprintf("verified signature of version %s", build.Version))
+		if build.SignerKeyID != "" {
+			conditions.MarkTrue(obj, sourcev1.SourceVerifiedCondition, meta.SucceededReason,
+				fmt.Sprintf("verified provenance of version %s signed with key %s", build.Version, build.SignerKeyID))
+		} else {
+			conditions.MarkTrue(obj, sourcev1.SourceVerifiedCondition, meta.SucceededReason, fmt.Sprintf("verified signature of version %s", build.Version))
+		}
 	}
 
 	if obj.Spec.Verify == nil {
@@ -1351,6 +1895,10 @@ func observeChartBuild(ctx context.Context, sp *patch.SerialPatcher, pOpts []pat
 			conditions.Delete(obj, sourcev1.FetchFailedCondition)
 			conditions.MarkTrue(obj, sourcev1.BuildFailedCondition, buildErr.Reason.Reason, buildErr.Error())
 			conditions.MarkFalse(obj, sourcev1.SourceVerifiedCondition, sourcev1.VerificationError, buildErr.Error())
+		case chart.ErrChartProvenance:
+			conditions.Delete(obj, sourcev1.FetchFailedCondition)
+			conditions.MarkTrue(obj, sourcev1.BuildFailedCondition, buildErr.Reason.Reason, buildErr.Error())
+			conditions.MarkFalse(obj, sourcev1.SourceVerifiedCondition, helmv1.VerificationFailedReason, buildErr.Error())
 		default:
 			conditions.Delete(obj, sourcev1.BuildFailedCondition)
 			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, buildErr.Reason.Reason, buildErr.Error())
@@ -1359,6 +1907,44 @@ func observeChartBuild(ctx context.Context, sp *patch.SerialPatcher, pOpts []pat
 	}
 }
 
+// setInlineValues configures the given chart.BuildOptions with the inline
+// values of the v1beta2.HelmChart, if any. It appends a short hash of the
+// values to the VersionMetadata, to ensure changes can be noticed by the
+// Artifact consumer.
+func setInlineValues(obj *helmv1.HelmChart, opts *chart.BuildOptions) error {
+	if obj.Spec.Values == nil || len(obj.Spec.Values.Raw) == 0 {
+		return nil
+	}
+
+	values, err := chartutil.ReadValues(obj.Spec.Values.Raw)
+	if err != nil {
+		return &chart.BuildError{
+			Reason: chart.ErrValuesFilesMerge,
+			Err:    fmt.Errorf("failed to parse inline values: %w", err),
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	// Calculate the hash from the re-encoded values, as the encoding of
+	// a map has its keys sorted
+	b, err := json.Marshal(values)
+	if err != nil {
+		return &chart.BuildError{
+			Reason: chart.ErrValuesFilesMerge,
+			Err:    fmt.Errorf("failed to encode inline values: %w", err),
+		}
+	}
+
+	opts.Values = values
+	if opts.VersionMetadata != "" {
+		opts.VersionMetadata += "."
+	}
+	opts.VersionMetadata += digest.SHA256.FromBytes(b).Encoded()[:12]
+	return nil
+}
+
 func reasonForBuild(build *chart.Build) string {
 	if !build.Complete() {
 		return ""
@@ -1376,18 +1962,75 @@ func chartRepoConfigErrorReturn(err error, obj *helmv1.HelmChart) (sreconcile.Re
 			Err:    fmt.Errorf("invalid Helm repository URL: %w", err),
 			Reason: sourcev1.URLInvalidReason,
 		}
-		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
 		return sreconcile.ResultEmpty, e
 	default:
 		e := &serror.Stalling{
 			Err:    fmt.Errorf("failed to construct Helm client: %w", err),
 			Reason: meta.FailedReason,
 		}
-		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
 		return sreconcile.ResultEmpty, e
 	}
 }
 
+// makeKeyring returns the OpenPGP keyring to verify the provenance of the
+// given chart with, composed of all the data in the Secret referenced by the
+// verification of the chart.
+func (r *HelmChartReconciler) makeKeyring(ctx context.Context, obj *helmv1.HelmChart) ([]byte, error) {
+	if obj.Spec.Verify.Provider != "helm" {
+		return nil, fmt.Errorf("unsupported verification provider: %s", obj.Spec.Verify.Provider)
+	}
+	if obj.Spec.Verify.SecretRef == nil {
+		return nil, errors.New("no secret with a keyring referenced")
+	}
+
+	secretName := types.NamespacedName{
+		Namespace: obj.Namespace,
+		Name:      obj.Spec.Verify.SecretRef.Name,
+	}
+	var secret corev1.Secret
+	if err := r.Get(ctx, secretName, &secret); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(secret.Data))
+	for k := range secret.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var keyring []byte
+	for _, k := range keys {
+		keyring = append(keyring, secret.Data[k]...)
+	}
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("no keyring found in secret '%s'", secretName)
+	}
+	return keyring, nil
+}
+
+// cosignIdentityFromSecret returns the identity the certificate of a keyless
+// Cosign signature must match, as configured with the 'issuer', 'subject',
+// 'issuerRegExp' and 'subjectRegExp' keys of the given Secret. It returns nil
+// if none of the keys are set.
+func cosignIdentityFromSecret(secret corev1.Secret) (*cosign.Identity, error) {
+	identity := cosign.Identity{
+		Issuer:        string(secret.Data["issuer"]),
+		Subject:       string(secret.Data["subject"]),
+		IssuerRegExp:  string(secret.Data["issuerRegExp"]),
+		SubjectRegExp: string(secret.Data["subjectRegExp"]),
+	}
+	if identity == (cosign.Identity{}) {
+		return nil, nil
+	}
+	for k, expr := range map[string]string{"issuerRegExp": identity.IssuerRegExp, "subjectRegExp": identity.SubjectRegExp} {
+		if _, err := regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid '%s': %w", k, err)
+		}
+	}
+	return &identity, nil
+}
+
 // makeVerifiers returns a list of verifiers for the given chart.
 func (r *HelmChartReconciler) makeVerifiers(ctx context.Context, obj *helmv1.HelmChart, auth authn.Authenticator, keychain authn.Keychain) ([]soci.Verifier, error) {
 	var verifiers []soci.Verifier
@@ -1426,11 +2069,24 @@ func (r *HelmChartReconciler) makeVerifiers(ctx context.Context, obj *helmv1.Hel
 					verifiers = append(verifiers, verifier)
 				}
 			}
+			if len(verifiers) > 0 {
+				return verifiers, nil
+			}
 
-			if len(verifiers) == 0 {
-				return nil, fmt.Errorf("no public keys found in secret '%s'", certSecretName)
+			// without public keys, perform a keyless verification against
+			// the identity in the secret
+			identity, err := cosignIdentityFromSecret(pubSecret)
+			if err != nil {
+				return nil, fmt.Errorf("invalid identity in secret '%s': %w", certSecretName, err)
+			}
+			if identity == nil {
+				return nil, fmt.Errorf("no public keys or identity found in secret '%s'", certSecretName)
+			}
+			verifier, err := soci.NewCosignVerifier(ctx, append(defaultCosignOciOpts, soci.WithIdentities(*identity))...)
+			if err != nil {
+				return nil, err
 			}
-			return verifiers, nil
+			return append(verifiers, verifier), nil
 		}
 
 		// if no secret is provided, add a keyless verifier
@@ -25,15 +25,19 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
 	coptions "github.com/sigstore/cosign/cmd/cosign/cli/options"
 	"github.com/sigstore/cosign/cmd/cosign/cli/sign"
 	"github.com/sigstore/cosign/pkg/cosign"
@@ -41,6 +45,7 @@ import (
 	"helm.sh/helm/v3/pkg/chart/loader"
 	helmreg "helm.sh/helm/v3/pkg/registry"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
@@ -63,6 +68,7 @@ import (
 	"github.com/fluxcd/source-controller/internal/helm/chart"
 	"github.com/fluxcd/source-controller/internal/helm/chart/secureloader"
 	"github.com/fluxcd/source-controller/internal/helm/registry"
+	"github.com/fluxcd/source-controller/internal/helm/repository"
 	"github.com/fluxcd/source-controller/internal/oci"
 	sreconcile "github.com/fluxcd/source-controller/internal/reconcile"
 	"github.com/fluxcd/source-controller/internal/reconcile/summarize"
@@ -461,7 +467,7 @@ func TestHelmChartReconciler_reconcileSource(t *testing.T) {
 		Revision: "mock-ref/abcdefg12345678",
 		Path:     "mock.tgz",
 	}
-	g.Expect(storage.Archive(gitArtifact, "testdata/charts", nil)).To(Succeed())
+	g.Expect(storage.Archive(gitArtifact, "testdata/charts", nil, "")).To(Succeed())
 
 	tests := []struct {
 		name       string
@@ -582,7 +588,40 @@ func TestHelmChartReconciler_reconcileSource(t *testing.T) {
 				g.Expect(build.Complete()).To(BeFalse())
 
 				g.Expect(obj.Status.Conditions).To(conditions.MatchConditions([]metav1.Condition{
-					*conditions.TrueCondition(sourcev1.FetchFailedCondition, "SourceUnavailable", "failed to get source: unsupported source kind"),
+					*conditions.TrueCondition(sourcev1.FetchFailedCondition, helmv1.UnsupportedSourceKindReason, "failed to get source: unsupported source kind"),
+					*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+					*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "foo"),
+				}))
+			},
+		},
+		{
+			name: "Stalling on Validate strategy for GitRepository source",
+			source: &sourcev1.GitRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "gitrepository",
+					Namespace: "default",
+				},
+				Status: sourcev1.GitRepositoryStatus{
+					Artifact: gitArtifact,
+				},
+			},
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Spec.Chart = "testdata/charts/helmchart-0.1.0.tgz"
+				obj.Spec.SourceRef = helmv1.LocalHelmChartSourceReference{
+					Name: "gitrepository",
+					Kind: sourcev1.GitRepositoryKind,
+				}
+				obj.Spec.ReconcileStrategy = helmv1.ReconcileStrategyValidate
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, meta.ProgressingReason, "foo")
+			},
+			want:    sreconcile.ResultEmpty,
+			wantErr: &serror.Stalling{Err: errors.New("reconcile strategy 'Validate' is not supported for GitRepository sources")},
+			assertFunc: func(g *WithT, build chart.Build, obj helmv1.HelmChart) {
+				g.Expect(build.Complete()).To(BeFalse())
+
+				g.Expect(obj.Status.Conditions).To(conditions.MatchConditions([]metav1.Condition{
+					*conditions.TrueCondition(sourcev1.FetchFailedCondition, helmv1.UnsupportedReconcileStrategyReason, "reconcile strategy 'Validate' is not supported for GitRepository sources"),
 					*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
 					*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "foo"),
 				}))
@@ -713,6 +752,95 @@ func TestHelmChartReconciler_reconcileSource(t *testing.T) {
 	}
 }
 
+func Test_markRepositoryArtifactAge(t *testing.T) {
+	staleMsg := "artifact of HelmRepository 'helmrepository' was last updated 2h0m0s ago, exceeding the maximum age of 1h0m0s"
+
+	tests := []struct {
+		name             string
+		source           sourcev1.Source
+		maxAge           *metav1.Duration
+		beforeFunc       func(obj *helmv1.HelmChart)
+		assertConditions []metav1.Condition
+	}{
+		{
+			name: "fresh repository artifact",
+			source: &helmv1.HelmRepository{
+				Status: helmv1.HelmRepositoryStatus{
+					Artifact: &sourcev1.Artifact{LastUpdateTime: metav1.NewTime(time.Now().Add(-time.Minute))},
+				},
+			},
+			maxAge: &metav1.Duration{Duration: time.Hour},
+		},
+		{
+			name: "stale repository artifact makes RepositoryArtifactStale=True",
+			source: &helmv1.HelmRepository{
+				Status: helmv1.HelmRepositoryStatus{
+					Artifact: &sourcev1.Artifact{LastUpdateTime: metav1.NewTime(time.Now().Add(-2 * time.Hour))},
+				},
+			},
+			maxAge: &metav1.Duration{Duration: time.Hour},
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.RepositoryArtifactStaleCondition, sourcev1.ArtifactAgeExceededReason, staleMsg),
+			},
+		},
+		{
+			name: "fresh repository artifact removes RepositoryArtifactStale",
+			source: &helmv1.HelmRepository{
+				Status: helmv1.HelmRepositoryStatus{
+					Artifact: &sourcev1.Artifact{LastUpdateTime: metav1.Now()},
+				},
+			},
+			maxAge: &metav1.Duration{Duration: time.Hour},
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				conditions.MarkTrue(obj, sourcev1.RepositoryArtifactStaleCondition, sourcev1.ArtifactAgeExceededReason, staleMsg)
+			},
+		},
+		{
+			name: "stale repository artifact without maximum age",
+			source: &helmv1.HelmRepository{
+				Status: helmv1.HelmRepositoryStatus{
+					Artifact: &sourcev1.Artifact{LastUpdateTime: metav1.NewTime(time.Now().Add(-2 * time.Hour))},
+				},
+			},
+		},
+		{
+			name:   "OCI repository without artifact",
+			source: &helmv1.HelmRepository{Spec: helmv1.HelmRepositorySpec{Type: helmv1.HelmRepositoryTypeOCI}},
+			maxAge: &metav1.Duration{Duration: time.Hour},
+		},
+		{
+			name: "non HelmRepository source",
+			source: &sourcev1.GitRepository{
+				Status: sourcev1.GitRepositoryStatus{
+					Artifact: &sourcev1.Artifact{LastUpdateTime: metav1.NewTime(time.Now().Add(-2 * time.Hour))},
+				},
+			},
+			maxAge: &metav1.Duration{Duration: time.Hour},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			obj := &helmv1.HelmChart{
+				Spec: helmv1.HelmChartSpec{
+					SourceRef: helmv1.LocalHelmChartSourceReference{
+						Kind: helmv1.HelmRepositoryKind,
+						Name: "helmrepository",
+					},
+					MaxRepositoryArtifactAge: tt.maxAge,
+				},
+			}
+			if tt.beforeFunc != nil {
+				tt.beforeFunc(obj)
+			}
+
+			markRepositoryArtifactAge(obj, tt.source)
+			g.Expect(obj.Status.Conditions).To(conditions.MatchConditions(tt.assertConditions))
+		})
+	}
+}
+
 func TestHelmChartReconciler_buildFromHelmRepository(t *testing.T) {
 	g := NewWithT(t)
 
@@ -735,6 +863,7 @@ func TestHelmChartReconciler_buildFromHelmRepository(t *testing.T) {
 	type options struct {
 		username string
 		password string
+		delay    time.Duration
 	}
 
 	tests := []struct {
@@ -809,6 +938,45 @@ func TestHelmChartReconciler_buildFromHelmRepository(t *testing.T) {
 				g.Expect(build.Path).To(BeARegularFile())
 			},
 		},
+		{
+			name: "Digest algorithm change does not use artifact as build cache",
+			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
+				obj.Spec.Chart = chartName
+				obj.Spec.Version = chartVersion
+				obj.Spec.DigestAlgorithm = "sha512"
+				obj.Status.Artifact = &sourcev1.Artifact{
+					Path:   chartName + "-" + chartVersion + ".tgz",
+					Digest: "sha256:3b9c358f36f0a31b6ad3e14f309c7cf198ac9246e8316f9ce543d5b19ac02b80",
+				}
+			},
+			want: sreconcile.ResultSuccess,
+			assertFunc: func(g *WithT, obj *helmv1.HelmChart, build chart.Build) {
+				g.Expect(build.Name).To(Equal(chartName))
+				g.Expect(build.Version).To(Equal(chartVersion))
+				g.Expect(build.Path).ToNot(Equal(filepath.Join(serverFactory.Root(), obj.Status.Artifact.Path)))
+				g.Expect(build.Path).To(BeARegularFile())
+			},
+			cleanFunc: func(g *WithT, build *chart.Build) {
+				g.Expect(os.Remove(build.Path)).To(Succeed())
+			},
+		},
+		{
+			name: "Validate strategy does not use artifact as build cache nor downloads chart",
+			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
+				obj.Spec.Chart = chartName
+				obj.Spec.Version = chartVersion
+				obj.Spec.ReconcileStrategy = helmv1.ReconcileStrategyValidate
+				obj.Status.Artifact = &sourcev1.Artifact{Path: chartName + "-" + chartVersion + ".tgz"}
+			},
+			want: sreconcile.ResultSuccess,
+			assertFunc: func(g *WithT, obj *helmv1.HelmChart, build chart.Build) {
+				g.Expect(build.Name).To(Equal(chartName))
+				g.Expect(build.Version).To(Equal(chartVersion))
+				g.Expect(build.Path).To(BeEmpty())
+				g.Expect(build.Validated).To(BeTrue())
+				g.Expect(build.Complete()).To(BeTrue())
+			},
+		},
 		{
 			name: "Sets Generation as VersionMetadata with values files",
 			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
@@ -849,59 +1017,544 @@ func TestHelmChartReconciler_buildFromHelmRepository(t *testing.T) {
 			},
 		},
 		{
-			name: "Event on unsuccessful secret retrieval",
-			beforeFunc: func(_ *helmv1.HelmChart, repository *helmv1.HelmRepository) {
-				repository.Spec.SecretRef = &meta.LocalObjectReference{
-					Name: "invalid",
-				}
+			name: "Applies repository timeout to chart download",
+			server: options{
+				delay: time.Second,
+			},
+			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
+				obj.Spec.Chart = chartName
+				obj.Spec.Version = chartVersion
+				repository.Spec.Timeout = &metav1.Duration{Duration: 100 * time.Millisecond}
+			},
+			want:    sreconcile.ResultEmpty,
+			wantErr: &chart.BuildError{Err: errors.New("timeout exceeded while downloading chart")},
+			assertFunc: func(g *WithT, _ *helmv1.HelmChart, build chart.Build) {
+				g.Expect(build.Complete()).To(BeFalse())
+			},
+		},
+		{
+			name: "Defaults timeout for chart download when unset",
+			server: options{
+				delay: 100 * time.Millisecond,
+			},
+			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
+				obj.Spec.Chart = chartName
+				obj.Spec.Version = chartVersion
+				repository.Spec.Timeout = nil
+			},
+			want: sreconcile.ResultSuccess,
+			assertFunc: func(g *WithT, _ *helmv1.HelmChart, build chart.Build) {
+				g.Expect(build.Name).To(Equal(chartName))
+				g.Expect(build.Version).To(Equal(chartVersion))
+				g.Expect(build.Path).To(BeARegularFile())
+			},
+			cleanFunc: func(g *WithT, build *chart.Build) {
+				g.Expect(os.Remove(build.Path)).To(Succeed())
+			},
+		},
+		{
+			name: "Event on unsuccessful secret retrieval",
+			beforeFunc: func(_ *helmv1.HelmChart, repository *helmv1.HelmRepository) {
+				repository.Spec.SecretRef = &meta.LocalObjectReference{
+					Name: "invalid",
+				}
+			},
+			want:    sreconcile.ResultEmpty,
+			wantErr: &serror.Event{Err: errors.New("failed to get secret 'invalid'")},
+			assertFunc: func(g *WithT, obj *helmv1.HelmChart, build chart.Build) {
+				g.Expect(build.Complete()).To(BeFalse())
+
+				g.Expect(obj.Status.Conditions).To(conditions.MatchConditions([]metav1.Condition{
+					*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.AuthenticationFailedReason, "failed to get secret 'invalid'"),
+				}))
+			},
+		},
+		{
+			name: "Stalling on invalid client options",
+			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
+				repository.Spec.URL = "file://unsupported" // Unsupported protocol
+			},
+			want:    sreconcile.ResultEmpty,
+			wantErr: &serror.Stalling{Err: errors.New("scheme \"file\" not supported")},
+			assertFunc: func(g *WithT, obj *helmv1.HelmChart, build chart.Build) {
+				g.Expect(build.Complete()).To(BeFalse())
+
+				g.Expect(obj.Status.Conditions).To(conditions.MatchConditions([]metav1.Condition{
+					*conditions.TrueCondition(sourcev1.FetchFailedCondition, meta.FailedReason, "failed to construct Helm client"),
+				}))
+			},
+		},
+		{
+			name: "Stalling on invalid repository URL",
+			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
+				repository.Spec.URL = "://unsupported" // Invalid URL
+			},
+			want:    sreconcile.ResultEmpty,
+			wantErr: &serror.Stalling{Err: errors.New("missing protocol scheme")},
+			assertFunc: func(g *WithT, obj *helmv1.HelmChart, build chart.Build) {
+				g.Expect(build.Complete()).To(BeFalse())
+
+				g.Expect(obj.Status.Conditions).To(conditions.MatchConditions([]metav1.Condition{
+					*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.URLInvalidReason, "invalid Helm repository URL"),
+				}))
+			},
+		},
+		{
+			name: "BuildError on temporary build error",
+			beforeFunc: func(obj *helmv1.HelmChart, _ *helmv1.HelmRepository) {
+				obj.Spec.Chart = "invalid"
+			},
+			want:    sreconcile.ResultEmpty,
+			wantErr: &chart.BuildError{Err: errors.New("failed to get chart version for remote reference")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			server := testserver.NewHTTPServer(serverFactory.Root())
+			server.Start()
+			defer server.Stop()
+
+			if tt.server.delay > 0 {
+				server.WithMiddleware(func(handler http.Handler) http.Handler {
+					return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						if strings.HasSuffix(r.URL.Path, ".tgz") {
+							select {
+							case <-r.Context().Done():
+								return
+							case <-time.After(tt.server.delay):
+							}
+						}
+						handler.ServeHTTP(w, r)
+					})
+				})
+			}
+
+			if len(tt.server.username+tt.server.password) > 0 {
+				server.WithMiddleware(func(handler http.Handler) http.Handler {
+					return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						u, p, ok := r.BasicAuth()
+						if !ok || u != tt.server.username || p != tt.server.password {
+							w.WriteHeader(401)
+							return
+						}
+						handler.ServeHTTP(w, r)
+					})
+				})
+			}
+
+			clientBuilder := fake.NewClientBuilder()
+			if tt.secret != nil {
+				clientBuilder.WithObjects(tt.secret.DeepCopy())
+			}
+
+			storage, err := newTestStorage(server)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			r := &HelmChartReconciler{
+				Client:        clientBuilder.Build(),
+				EventRecorder: record.NewFakeRecorder(32),
+				Getters:       testGetters,
+				Storage:       storage,
+				patchOptions:  getPatchOptions(helmChartReadyCondition.Owned, "sc"),
+			}
+
+			repository := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "helmrepository-",
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:     server.URL(),
+					Timeout: &metav1.Duration{Duration: timeout},
+				},
+				Status: helmv1.HelmRepositoryStatus{
+					Artifact: &sourcev1.Artifact{
+						Path: "index.yaml",
+					},
+				},
+			}
+			obj := &helmv1.HelmChart{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "helmrepository-",
+				},
+				Spec: helmv1.HelmChartSpec{},
+			}
+
+			if tt.beforeFunc != nil {
+				tt.beforeFunc(obj, repository)
+			}
+
+			var b chart.Build
+			if tt.cleanFunc != nil {
+				defer tt.cleanFunc(g, &b)
+			}
+			got, err := r.buildFromHelmRepository(context.TODO(), obj, repository, &b)
+
+			g.Expect(err != nil).To(Equal(tt.wantErr != nil))
+			if tt.wantErr != nil {
+				g.Expect(reflect.TypeOf(err).String()).To(Equal(reflect.TypeOf(tt.wantErr).String()))
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr.Error()))
+			}
+			g.Expect(got).To(Equal(tt.want))
+
+			if tt.assertFunc != nil {
+				tt.assertFunc(g, obj, b)
+			}
+		})
+	}
+}
+
+func TestHelmChartReconciler_buildFromHelmRepository_versionMismatch(t *testing.T) {
+	g := NewWithT(t)
+
+	serverFactory, err := helmtestserver.NewTempHelmServer()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(serverFactory.Root())
+
+	g.Expect(serverFactory.PackageChartWithVersion("testdata/charts/helmchart", "0.2.0")).To(Succeed())
+	g.Expect(serverFactory.GenerateIndex()).To(Succeed())
+
+	// Publish the chart with a different version in the index than in its
+	// Chart.yaml.
+	indexPath := filepath.Join(serverFactory.Root(), "index.yaml")
+	index, err := os.ReadFile(indexPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	index = bytes.ReplaceAll(index, []byte("version: 0.2.0"), []byte("version: 0.4.0"))
+	g.Expect(os.WriteFile(indexPath, index, 0o640)).To(Succeed())
+
+	tests := []struct {
+		name       string
+		policy     string
+		wantErr    bool
+		wantEvents []string
+	}{
+		{
+			name:       "warn policy stores chart with index version",
+			policy:     helmv1.VersionMismatchPolicyWarn,
+			wantEvents: []string{"Warning VersionMismatch chart declares version '0.2.0' while the repository index has version '0.4.0': storing chart with the index version"},
+		},
+		{
+			name:    "error policy fails the build",
+			policy:  helmv1.VersionMismatchPolicyError,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			server := testserver.NewHTTPServer(serverFactory.Root())
+			server.Start()
+			defer server.Stop()
+
+			storage, err := newTestStorage(server)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			recorder := record.NewFakeRecorder(32)
+			r := &HelmChartReconciler{
+				Client:        fake.NewClientBuilder().Build(),
+				EventRecorder: recorder,
+				Getters:       testGetters,
+				Storage:       storage,
+				patchOptions:  getPatchOptions(helmChartReadyCondition.Owned, "sc"),
+			}
+
+			repository := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "helmrepository-",
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:     server.URL(),
+					Timeout: &metav1.Duration{Duration: timeout},
+				},
+				Status: helmv1.HelmRepositoryStatus{
+					Artifact: &sourcev1.Artifact{
+						Path: "index.yaml",
+					},
+				},
+			}
+			obj := &helmv1.HelmChart{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "helmchart-",
+				},
+				Spec: helmv1.HelmChartSpec{
+					Chart:                 "helmchart",
+					VersionMismatchPolicy: tt.policy,
+				},
+			}
+
+			var b chart.Build
+			got, err := r.buildFromHelmRepository(context.TODO(), obj, repository, &b)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				var buildErr *chart.BuildError
+				g.Expect(errors.As(err, &buildErr)).To(BeTrue())
+				g.Expect(buildErr.Reason.Reason).To(Equal(helmv1.VersionMismatchReason))
+				g.Expect(got).To(Equal(sreconcile.ResultEmpty))
+				g.Expect(b.Complete()).To(BeFalse())
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(got).To(Equal(sreconcile.ResultSuccess))
+				g.Expect(b.Version).To(Equal("0.4.0"))
+				g.Expect(b.Path).To(BeARegularFile())
+				g.Expect(os.Remove(b.Path)).To(Succeed())
+			}
+
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			g.Expect(events).To(Equal(tt.wantEvents))
+		})
+	}
+}
+
+func TestHelmChartReconciler_buildFromHelmRepository_allowedAPIVersions(t *testing.T) {
+	g := NewWithT(t)
+
+	serverFactory, err := helmtestserver.NewTempHelmServer()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(serverFactory.Root())
+
+	g.Expect(serverFactory.PackageChart("testdata/charts/helmchart")).To(Succeed())
+	g.Expect(serverFactory.GenerateIndex()).To(Succeed())
+
+	tests := []struct {
+		name    string
+		allowed []string
+		wantErr bool
+	}{
+		{
+			name: "any API version allowed",
+		},
+		{
+			name:    "chart API version allowed",
+			allowed: []string{"v1", "v2"},
+		},
+		{
+			name:    "chart API version not allowed",
+			allowed: []string{"v1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			server := testserver.NewHTTPServer(serverFactory.Root())
+			server.Start()
+			defer server.Stop()
+
+			storage, err := newTestStorage(server)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			r := &HelmChartReconciler{
+				Client:                  fake.NewClientBuilder().Build(),
+				EventRecorder:           record.NewFakeRecorder(32),
+				Getters:                 testGetters,
+				Storage:                 storage,
+				AllowedChartAPIVersions: tt.allowed,
+				patchOptions:            getPatchOptions(helmChartReadyCondition.Owned, "sc"),
+			}
+
+			repository := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "helmrepository-",
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:     server.URL(),
+					Timeout: &metav1.Duration{Duration: timeout},
+				},
+				Status: helmv1.HelmRepositoryStatus{
+					Artifact: &sourcev1.Artifact{
+						Path: "index.yaml",
+					},
+				},
+			}
+			obj := &helmv1.HelmChart{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "helmchart-",
+				},
+				Spec: helmv1.HelmChartSpec{
+					Chart: "helmchart",
+				},
+			}
+
+			var b chart.Build
+			got, err := r.buildFromHelmRepository(context.TODO(), obj, repository, &b)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				var buildErr *chart.BuildError
+				g.Expect(errors.As(err, &buildErr)).To(BeTrue())
+				g.Expect(buildErr.Reason.Reason).To(Equal(helmv1.UnsupportedChartReason))
+				g.Expect(got).To(Equal(sreconcile.ResultEmpty))
+				g.Expect(b.Complete()).To(BeFalse())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(sreconcile.ResultSuccess))
+			g.Expect(b.Path).To(BeARegularFile())
+			g.Expect(os.Remove(b.Path)).To(Succeed())
+		})
+	}
+}
+
+func TestHelmChartReconciler_buildFromHelmRepository_chartDownloads(t *testing.T) {
+	g := NewWithT(t)
+
+	serverFactory, err := helmtestserver.NewTempHelmServer()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(serverFactory.Root())
+
+	g.Expect(serverFactory.PackageChart("testdata/charts/helmchart")).To(Succeed())
+	g.Expect(serverFactory.GenerateIndex()).To(Succeed())
+
+	// The server holds the chart downloads until released, to allow the
+	// concurrent builds to coalesce.
+	var downloads int32
+	release := make(chan struct{})
+	files := http.FileServer(http.Dir(serverFactory.Root()))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			atomic.AddInt32(&downloads, 1)
+			<-release
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	storage, err := NewStorage(serverFactory.Root(), server.URL, retentionTTL, retentionRecords)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	r := &HelmChartReconciler{
+		Client:         fake.NewClientBuilder().Build(),
+		EventRecorder:  record.NewFakeRecorder(32),
+		Getters:        testGetters,
+		Storage:        storage,
+		ChartDownloads: repository.NewDownloadGroup(),
+		patchOptions:   getPatchOptions(helmChartReadyCondition.Owned, "sc"),
+	}
+
+	repo := &helmv1.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "helmrepository",
+			Namespace: "default",
+		},
+		Spec: helmv1.HelmRepositorySpec{
+			URL:     server.URL,
+			Timeout: &metav1.Duration{Duration: timeout},
+		},
+		Status: helmv1.HelmRepositoryStatus{
+			Artifact: &sourcev1.Artifact{
+				Path: "index.yaml",
+			},
+		},
+	}
+
+	const builds = 4
+	var wg sync.WaitGroup
+	results := make([]chart.Build, builds)
+	errs := make([]error, builds)
+	for i := 0; i < builds; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			obj := &helmv1.HelmChart{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("helmchart-%d", i),
+					Namespace: "default",
+				},
+				Spec: helmv1.HelmChartSpec{
+					Chart: "helmchart",
+				},
+			}
+			_, errs[i] = r.buildFromHelmRepository(context.TODO(), obj, repo, &results[i])
+		}()
+	}
+
+	g.Eventually(func() int32 { return atomic.LoadInt32(&downloads) }, timeout).Should(Equal(int32(1)))
+	// Allow the other builds to wait for the download in flight.
+	time.Sleep(500 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	g.Expect(atomic.LoadInt32(&downloads)).To(Equal(int32(1)))
+	for i := range results {
+		g.Expect(errs[i]).ToNot(HaveOccurred())
+		g.Expect(results[i].Path).To(BeARegularFile())
+		g.Expect(os.Remove(results[i].Path)).To(Succeed())
+	}
+}
+
+func TestHelmChartReconciler_buildFromHelmRepository_provenance(t *testing.T) {
+	g := NewWithT(t)
+
+	serverFactory, err := helmtestserver.NewTempHelmServer()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(serverFactory.Root())
+
+	keyringPath := filepath.Join(t.TempDir(), "pub.pgp")
+	g.Expect(serverFactory.PackageSignedChartWithVersion("testdata/charts/helmchart", "0.1.0", keyringPath)).To(Succeed())
+	g.Expect(serverFactory.GenerateIndex()).To(Succeed())
+	keyring, err := os.ReadFile(keyringPath)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	otherServerFactory, err := helmtestserver.NewTempHelmServer()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(otherServerFactory.Root())
+	otherKeyringPath := filepath.Join(t.TempDir(), "other.pgp")
+	g.Expect(otherServerFactory.PackageSignedChartWithVersion("testdata/charts/helmchart", "0.1.0", otherKeyringPath)).To(Succeed())
+	otherKeyring, err := os.ReadFile(otherKeyringPath)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	tests := []struct {
+		name       string
+		verify     *helmv1.OCIRepositoryVerification
+		secret     *corev1.Secret
+		wantErr    string
+		wantReason string
+	}{
+		{
+			name: "verified provenance",
+			verify: &helmv1.OCIRepositoryVerification{
+				Provider:  "helm",
+				SecretRef: &meta.LocalObjectReference{Name: "keyring"},
 			},
-			want:    sreconcile.ResultEmpty,
-			wantErr: &serror.Event{Err: errors.New("failed to get secret 'invalid'")},
-			assertFunc: func(g *WithT, obj *helmv1.HelmChart, build chart.Build) {
-				g.Expect(build.Complete()).To(BeFalse())
-
-				g.Expect(obj.Status.Conditions).To(conditions.MatchConditions([]metav1.Condition{
-					*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.AuthenticationFailedReason, "failed to get secret 'invalid'"),
-				}))
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "keyring"},
+				Data:       map[string][]byte{"pubring.gpg": keyring},
 			},
 		},
 		{
-			name: "Stalling on invalid client options",
-			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
-				repository.Spec.URL = "file://unsupported" // Unsupported protocol
+			name: "provenance signed by unknown key",
+			verify: &helmv1.OCIRepositoryVerification{
+				Provider:  "helm",
+				SecretRef: &meta.LocalObjectReference{Name: "keyring"},
 			},
-			want:    sreconcile.ResultEmpty,
-			wantErr: &serror.Stalling{Err: errors.New("scheme \"file\" not supported")},
-			assertFunc: func(g *WithT, obj *helmv1.HelmChart, build chart.Build) {
-				g.Expect(build.Complete()).To(BeFalse())
-
-				g.Expect(obj.Status.Conditions).To(conditions.MatchConditions([]metav1.Condition{
-					*conditions.TrueCondition(sourcev1.FetchFailedCondition, meta.FailedReason, "failed to construct Helm client"),
-				}))
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "keyring"},
+				Data:       map[string][]byte{"pubring.gpg": otherKeyring},
 			},
+			wantErr:    "failed to verify provenance of chart 'helmchart' version '0.1.0'",
+			wantReason: helmv1.VerificationFailedReason,
 		},
 		{
-			name: "Stalling on invalid repository URL",
-			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
-				repository.Spec.URL = "://unsupported" // Invalid URL
-			},
-			want:    sreconcile.ResultEmpty,
-			wantErr: &serror.Stalling{Err: errors.New("missing protocol scheme")},
-			assertFunc: func(g *WithT, obj *helmv1.HelmChart, build chart.Build) {
-				g.Expect(build.Complete()).To(BeFalse())
-
-				g.Expect(obj.Status.Conditions).To(conditions.MatchConditions([]metav1.Condition{
-					*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.URLInvalidReason, "invalid Helm repository URL"),
-				}))
+			name: "no secret reference",
+			verify: &helmv1.OCIRepositoryVerification{
+				Provider: "helm",
 			},
+			wantErr:    "no secret with a keyring referenced",
+			wantReason: sourcev1.VerificationError,
 		},
 		{
-			name: "BuildError on temporary build error",
-			beforeFunc: func(obj *helmv1.HelmChart, _ *helmv1.HelmRepository) {
-				obj.Spec.Chart = "invalid"
+			name: "unsupported provider",
+			verify: &helmv1.OCIRepositoryVerification{
+				Provider: "cosign",
 			},
-			want:    sreconcile.ResultEmpty,
-			wantErr: &chart.BuildError{Err: errors.New("failed to get chart version for remote reference")},
+			wantErr:    "unsupported verification provider: cosign",
+			wantReason: sourcev1.VerificationError,
 		},
 	}
 	for _, tt := range tests {
@@ -912,27 +1565,14 @@ func TestHelmChartReconciler_buildFromHelmRepository(t *testing.T) {
 			server.Start()
 			defer server.Stop()
 
-			if len(tt.server.username+tt.server.password) > 0 {
-				server.WithMiddleware(func(handler http.Handler) http.Handler {
-					return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-						u, p, ok := r.BasicAuth()
-						if !ok || u != tt.server.username || p != tt.server.password {
-							w.WriteHeader(401)
-							return
-						}
-						handler.ServeHTTP(w, r)
-					})
-				})
-			}
+			storage, err := newTestStorage(server)
+			g.Expect(err).ToNot(HaveOccurred())
 
 			clientBuilder := fake.NewClientBuilder()
 			if tt.secret != nil {
-				clientBuilder.WithObjects(tt.secret.DeepCopy())
+				clientBuilder.WithObjects(tt.secret)
 			}
 
-			storage, err := newTestStorage(server)
-			g.Expect(err).ToNot(HaveOccurred())
-
 			r := &HelmChartReconciler{
 				Client:        clientBuilder.Build(),
 				EventRecorder: record.NewFakeRecorder(32),
@@ -957,31 +1597,36 @@ func TestHelmChartReconciler_buildFromHelmRepository(t *testing.T) {
 			}
 			obj := &helmv1.HelmChart{
 				ObjectMeta: metav1.ObjectMeta{
-					GenerateName: "helmrepository-",
+					GenerateName: "helmchart-",
+				},
+				Spec: helmv1.HelmChartSpec{
+					Chart:  "helmchart",
+					Verify: tt.verify,
 				},
-				Spec: helmv1.HelmChartSpec{},
-			}
-
-			if tt.beforeFunc != nil {
-				tt.beforeFunc(obj, repository)
 			}
 
 			var b chart.Build
-			if tt.cleanFunc != nil {
-				defer tt.cleanFunc(g, &b)
-			}
 			got, err := r.buildFromHelmRepository(context.TODO(), obj, repository, &b)
-
-			g.Expect(err != nil).To(Equal(tt.wantErr != nil))
-			if tt.wantErr != nil {
-				g.Expect(reflect.TypeOf(err).String()).To(Equal(reflect.TypeOf(tt.wantErr).String()))
-				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr.Error()))
-			}
-			g.Expect(got).To(Equal(tt.want))
-
-			if tt.assertFunc != nil {
-				tt.assertFunc(g, obj, b)
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				g.Expect(got).To(Equal(sreconcile.ResultEmpty))
+				g.Expect(b.Complete()).To(BeFalse())
+
+				var buildErr *chart.BuildError
+				if errors.As(err, &buildErr) {
+					g.Expect(buildErr.Reason.Reason).To(Equal(tt.wantReason))
+				} else {
+					g.Expect(conditions.GetReason(obj, sourcev1.SourceVerifiedCondition)).To(Equal(tt.wantReason))
+				}
+				return
 			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(sreconcile.ResultSuccess))
+			g.Expect(b.SignerKeyID).ToNot(BeEmpty())
+			g.Expect(b.Summary()).To(ContainSubstring(fmt.Sprintf("with provenance signed by key '%s'", b.SignerKeyID)))
+			g.Expect(b.Path).To(BeARegularFile())
+			g.Expect(os.Remove(b.Path)).To(Succeed())
 		})
 	}
 }
@@ -1091,6 +1736,28 @@ func TestHelmChartReconciler_buildFromOCIHelmRepository(t *testing.T) {
 				g.Expect(build.Path).To(BeARegularFile())
 			},
 		},
+		{
+			name: "Digest algorithm change does not use artifact as build cache",
+			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
+				obj.Spec.Chart = metadata.Name
+				obj.Spec.Version = metadata.Version
+				obj.Spec.DigestAlgorithm = "sha512"
+				obj.Status.Artifact = &sourcev1.Artifact{
+					Path:   metadata.Name + "-" + metadata.Version + ".tgz",
+					Digest: "sha256:3b9c358f36f0a31b6ad3e14f309c7cf198ac9246e8316f9ce543d5b19ac02b80",
+				}
+			},
+			want: sreconcile.ResultSuccess,
+			assertFunc: func(g *WithT, obj *helmv1.HelmChart, build chart.Build) {
+				g.Expect(build.Name).To(Equal(metadata.Name))
+				g.Expect(build.Version).To(Equal(metadata.Version))
+				g.Expect(build.Path).ToNot(Equal(storage.LocalPath(*cachedArtifact.DeepCopy())))
+				g.Expect(build.Path).To(BeARegularFile())
+			},
+			cleanFunc: func(g *WithT, build *chart.Build) {
+				g.Expect(os.Remove(build.Path)).To(Succeed())
+			},
+		},
 		{
 			name: "Forces build on generation change",
 			beforeFunc: func(obj *helmv1.HelmChart, repository *helmv1.HelmRepository) {
@@ -1225,7 +1892,7 @@ func TestHelmChartReconciler_buildFromTarballArtifact(t *testing.T) {
 		Revision: "mock-ref/abcdefg12345678",
 		Path:     "mock.tgz",
 	}
-	g.Expect(storage.Archive(chartsArtifact, "testdata/charts", nil)).To(Succeed())
+	g.Expect(storage.Archive(chartsArtifact, "testdata/charts", nil, "")).To(Succeed())
 	yamlArtifact := &sourcev1.Artifact{
 		Revision: "9876abcd",
 		Path:     "values.yaml",
@@ -1310,6 +1977,75 @@ func TestHelmChartReconciler_buildFromTarballArtifact(t *testing.T) {
 				g.Expect(os.Remove(build.Path)).To(Succeed())
 			},
 		},
+		{
+			name:   "Values sets hash of values as VersionMetadata",
+			source: *chartsArtifact.DeepCopy(),
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Generation = 3
+				obj.Spec.Chart = "testdata/charts/helmchart"
+				obj.Spec.SourceRef.Kind = sourcev1.GitRepositoryKind
+				obj.Spec.ValuesFiles = []string{
+					filepath.Join(obj.Spec.Chart, "values.yaml"),
+				}
+				obj.Spec.Values = &apiextensionsv1.JSON{Raw: []byte(`{"replicaCount": 2}`)}
+			},
+			want: sreconcile.ResultSuccess,
+			assertFunc: func(g *WithT, build chart.Build) {
+				g.Expect(build.Name).To(Equal("helmchart"))
+				g.Expect(build.Version).To(Equal("0.1.0+3.64abcd6676e4"))
+				g.Expect(build.Path).To(BeARegularFile())
+				chart, err := secureloader.LoadFile(build.Path)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(chart.Values["replicaCount"]).To(Equal(float64(2)))
+			},
+			cleanFunc: func(g *WithT, build *chart.Build) {
+				g.Expect(os.Remove(build.Path)).To(Succeed())
+			},
+		},
+		{
+			name:   "Invalid values",
+			source: *chartsArtifact.DeepCopy(),
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Spec.Chart = "testdata/charts/helmchart"
+				obj.Spec.SourceRef.Kind = sourcev1.GitRepositoryKind
+				obj.Spec.Values = &apiextensionsv1.JSON{Raw: []byte(`["replicaCount"]`)}
+			},
+			want:    sreconcile.ResultEmpty,
+			wantErr: &chart.BuildError{Err: errors.New("failed to parse inline values")},
+			assertFunc: func(g *WithT, build chart.Build) {
+				g.Expect(build.Complete()).To(BeFalse())
+			},
+		},
+		{
+			name:   "ChartPath selects chart from repository with multiple charts",
+			source: *chartsArtifact.DeepCopy(),
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Spec.Chart = "testdata/charts"
+				obj.Spec.ChartPath = "helmchart"
+			},
+			want: sreconcile.ResultSuccess,
+			assertFunc: func(g *WithT, build chart.Build) {
+				g.Expect(build.Name).To(Equal("helmchart"))
+				g.Expect(build.Version).To(Equal("0.1.0"))
+				g.Expect(build.Path).To(BeARegularFile())
+			},
+			cleanFunc: func(g *WithT, build *chart.Build) {
+				g.Expect(os.Remove(build.Path)).To(Succeed())
+			},
+		},
+		{
+			name:   "ChartPath without Chart.yaml",
+			source: *chartsArtifact.DeepCopy(),
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Spec.Chart = "testdata/charts"
+				obj.Spec.ChartPath = "helmchart/templates"
+			},
+			want:    sreconcile.ResultEmpty,
+			wantErr: &chart.BuildError{Err: errors.New("no Chart.yaml found at chart path 'helmchart/templates'")},
+			assertFunc: func(g *WithT, build chart.Build) {
+				g.Expect(build.Complete()).To(BeFalse())
+			},
+		},
 		{
 			name:   "Chart from storage cache",
 			source: *chartsArtifact.DeepCopy(),
@@ -1345,6 +2081,25 @@ func TestHelmChartReconciler_buildFromTarballArtifact(t *testing.T) {
 				g.Expect(os.Remove(build.Path)).To(Succeed())
 			},
 		},
+		{
+			name:   "Digest algorithm change forces rebuild",
+			source: *chartsArtifact.DeepCopy(),
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Spec.Chart = "testdata/charts/helmchart-0.1.0.tgz"
+				obj.Spec.DigestAlgorithm = "sha512"
+				obj.Status.Artifact = cachedArtifact.DeepCopy()
+			},
+			want: sreconcile.ResultSuccess,
+			assertFunc: func(g *WithT, build chart.Build) {
+				g.Expect(build.Name).To(Equal("helmchart"))
+				g.Expect(build.Version).To(Equal("0.1.0"))
+				g.Expect(build.Path).ToNot(Equal(storage.LocalPath(*cachedArtifact.DeepCopy())))
+				g.Expect(build.Path).To(BeARegularFile())
+			},
+			cleanFunc: func(g *WithT, build *chart.Build) {
+				g.Expect(os.Remove(build.Path)).To(Succeed())
+			},
+		},
 		{
 			name:    "Empty source artifact",
 			source:  sourcev1.Artifact{},
@@ -1427,13 +2182,100 @@ func TestHelmChartReconciler_reconcileArtifact(t *testing.T) {
 			beforeFunc: func(obj *helmv1.HelmChart) {
 				conditions.MarkTrue(obj, sourcev1.ArtifactOutdatedCondition, "Foo", "")
 			},
-			want: sreconcile.ResultRequeue,
+			want: sreconcile.ResultRequeue,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactOutdatedCondition, "Foo", ""),
+			},
+		},
+		{
+			name:  "Copying artifact to storage from build makes ArtifactInStorage=True",
+			build: mockChartBuild("helmchart", "0.1.0", "testdata/charts/helmchart-0.1.0.tgz"),
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				conditions.MarkTrue(obj, sourcev1.ArtifactOutdatedCondition, "Foo", "")
+			},
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.GetArtifact()).ToNot(BeNil())
+				t.Expect(obj.GetArtifact().Digest).To(Equal("sha256:bbdf96023c912c393b49d5238e227576ed0d20d1bb145d7476d817b80e20c11a"))
+				t.Expect(obj.GetArtifact().Revision).To(Equal("0.1.0"))
+				t.Expect(obj.Status.URL).ToNot(BeEmpty())
+				t.Expect(obj.Status.ObservedChartName).To(Equal("helmchart"))
+			},
+			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, helmv1.ChartPullSucceededReason, "pulled 'helmchart' chart with version '0.1.0'"),
+			},
+		},
+		{
+			name: "Up-to-date chart build does not persist artifact to storage",
+			build: &chart.Build{
+				Name:    "helmchart",
+				Version: "0.1.0",
+				Path:    filepath.Join(testStorage.BasePath, "testdata/charts/helmchart-0.1.0.tgz"),
+			},
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Status.Artifact = &sourcev1.Artifact{
+					Path: "testdata/charts/helmchart-0.1.0.tgz",
+				}
+			},
+			want: sreconcile.ResultSuccess,
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.Status.Artifact.Path).To(Equal("testdata/charts/helmchart-0.1.0.tgz"))
+				t.Expect(obj.Status.ObservedChartName).To(BeEmpty())
+				t.Expect(obj.Status.URL).To(BeEmpty())
+			},
+		},
+		{
+			name: "Restores conditions in case artifact matches current chart build",
+			build: &chart.Build{
+				Name:     "helmchart",
+				Version:  "0.1.0",
+				Path:     filepath.Join(testStorage.BasePath, "testdata/charts/helmchart-0.1.0.tgz"),
+				Packaged: true,
+			},
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Status.ObservedChartName = "helmchart"
+				obj.Status.Artifact = &sourcev1.Artifact{
+					Revision: "0.1.0",
+					Path:     "testdata/charts/helmchart-0.1.0.tgz",
+				}
+			},
+			want: sreconcile.ResultSuccess,
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.Status.Artifact.Path).To(Equal("testdata/charts/helmchart-0.1.0.tgz"))
+				t.Expect(obj.Status.URL).To(BeEmpty())
+			},
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, helmv1.ChartPackageSucceededReason, "packaged 'helmchart' chart with version '0.1.0'"),
+			},
+		},
+		{
+			name: "Copying artifact to storage records the chart metadata",
+			build: func() *chart.Build {
+				b := mockChartBuild("helmchart", "0.1.0", "testdata/charts/helmchart-0.1.0.tgz")
+				b.AppVersion = "1.16.0"
+				return b
+			}(),
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Status.ChartMetadata = &helmv1.HelmChartMetadata{
+					Name:    "helmchart",
+					Version: "0.0.1",
+				}
+			},
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.GetArtifact()).ToNot(BeNil())
+				t.Expect(obj.Status.ChartMetadata).To(Equal(&helmv1.HelmChartMetadata{
+					Name:       "helmchart",
+					Version:    "0.1.0",
+					AppVersion: "1.16.0",
+				}))
+			},
+			want: sreconcile.ResultSuccess,
 			assertConditions: []metav1.Condition{
-				*conditions.TrueCondition(sourcev1.ArtifactOutdatedCondition, "Foo", ""),
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, helmv1.ChartPullSucceededReason, "pulled 'helmchart' chart with version '0.1.0'"),
 			},
 		},
 		{
-			name:  "Copying artifact to storage from build makes ArtifactInStorage=True",
+			name:  "Removes ArtifactOutdatedCondition after creating new artifact",
 			build: mockChartBuild("helmchart", "0.1.0", "testdata/charts/helmchart-0.1.0.tgz"),
 			beforeFunc: func(obj *helmv1.HelmChart) {
 				conditions.MarkTrue(obj, sourcev1.ArtifactOutdatedCondition, "Foo", "")
@@ -1451,60 +2293,174 @@ func TestHelmChartReconciler_reconcileArtifact(t *testing.T) {
 			},
 		},
 		{
-			name: "Up-to-date chart build does not persist artifact to storage",
-			build: &chart.Build{
-				Name:    "helmchart",
-				Version: "0.1.0",
-				Path:    filepath.Join(testStorage.BasePath, "testdata/charts/helmchart-0.1.0.tgz"),
+			name: "Chart version behind latest version makes NewerVersionAvailable=True",
+			build: func() *chart.Build {
+				b := mockChartBuild("helmchart", "0.1.0", "testdata/charts/helmchart-0.1.0.tgz")
+				b.LatestVersion = "0.2.0"
+				return b
+			}(),
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.GetArtifact()).ToNot(BeNil())
+				t.Expect(obj.Status.LatestVersion).To(Equal("0.2.0"))
+			},
+			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.NewerVersionAvailableCondition, sourcev1.NewChartVersionReason, "chart version '0.1.0' is behind the latest available version '0.2.0'"),
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, helmv1.ChartPullSucceededReason, "pulled 'helmchart' chart with version '0.1.0'"),
 			},
+		},
+		{
+			name: "Chart version equal to latest version removes NewerVersionAvailable",
+			build: func() *chart.Build {
+				b := mockChartBuild("helmchart", "0.1.0", "testdata/charts/helmchart-0.1.0.tgz")
+				b.LatestVersion = "0.1.0"
+				return b
+			}(),
 			beforeFunc: func(obj *helmv1.HelmChart) {
-				obj.Status.Artifact = &sourcev1.Artifact{
-					Path: "testdata/charts/helmchart-0.1.0.tgz",
-				}
+				conditions.MarkTrue(obj, sourcev1.NewerVersionAvailableCondition, sourcev1.NewChartVersionReason, "")
+			},
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.GetArtifact()).ToNot(BeNil())
+				t.Expect(obj.Status.LatestVersion).To(Equal("0.1.0"))
 			},
 			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, helmv1.ChartPullSucceededReason, "pulled 'helmchart' chart with version '0.1.0'"),
+			},
+		},
+		{
+			name: "Deprecated chart version makes Deprecated=True",
+			build: func() *chart.Build {
+				b := mockChartBuild("helmchart", "0.1.0", "testdata/charts/helmchart-0.1.0.tgz")
+				b.Deprecated = true
+				return b
+			}(),
 			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
-				t.Expect(obj.Status.Artifact.Path).To(Equal("testdata/charts/helmchart-0.1.0.tgz"))
-				t.Expect(obj.Status.ObservedChartName).To(BeEmpty())
+				t.Expect(obj.GetArtifact()).ToNot(BeNil())
+				t.Expect(obj.GetArtifact().Revision).To(Equal("0.1.0"))
+			},
+			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.DeprecatedCondition, sourcev1.ChartDeprecatedReason, "chart 'helmchart' version '0.1.0' is deprecated"),
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, helmv1.ChartPullSucceededReason, "pulled 'helmchart' chart with version '0.1.0'"),
+			},
+		},
+		{
+			name:  "Chart version which is not deprecated removes Deprecated",
+			build: mockChartBuild("helmchart", "0.1.0", "testdata/charts/helmchart-0.1.0.tgz"),
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				conditions.MarkTrue(obj, sourcev1.DeprecatedCondition, sourcev1.ChartDeprecatedReason, "")
+			},
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.GetArtifact()).ToNot(BeNil())
+			},
+			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, helmv1.ChartPullSucceededReason, "pulled 'helmchart' chart with version '0.1.0'"),
+			},
+		},
+		{
+			name: "Validate strategy makes ChartValidated=True without storing artifact",
+			build: &chart.Build{
+				Name:      "helmchart",
+				Version:   "0.1.0",
+				Validated: true,
+			},
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Spec.ReconcileStrategy = helmv1.ReconcileStrategyValidate
+				conditions.MarkTrue(obj, sourcev1.ArtifactOutdatedCondition, "NewChart", "")
+			},
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.GetArtifact()).To(BeNil())
 				t.Expect(obj.Status.URL).To(BeEmpty())
+				t.Expect(obj.Status.ObservedChartName).To(BeEmpty())
+			},
+			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ChartValidatedCondition, helmv1.ValidationOnlyReason, "validated chart 'helmchart' version '0.1.0' without storing an artifact"),
 			},
 		},
 		{
-			name: "Restores conditions in case artifact matches current chart build",
+			name: "Switching to Validate strategy removes stored artifact",
 			build: &chart.Build{
-				Name:     "helmchart",
-				Version:  "0.1.0",
-				Path:     filepath.Join(testStorage.BasePath, "testdata/charts/helmchart-0.1.0.tgz"),
-				Packaged: true,
+				Name:      "helmchart",
+				Version:   "0.1.0",
+				Validated: true,
 			},
 			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Name = "validate-stored-artifact"
+				obj.Spec.ReconcileStrategy = helmv1.ReconcileStrategyValidate
 				obj.Status.ObservedChartName = "helmchart"
-				obj.Status.Artifact = &sourcev1.Artifact{
-					Revision: "0.1.0",
-					Path:     "testdata/charts/helmchart-0.1.0.tgz",
-				}
+				obj.Status.ChartMetadata = &helmv1.HelmChartMetadata{Name: "helmchart", Version: "0.1.0"}
+				artifact := testStorage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "0.1.0", "helmchart-0.1.0.tgz")
+				obj.Status.Artifact = &artifact
+				obj.Status.URL = testStorage.SetHostname("http://example.com/" + artifact.Path)
+				g := NewWithT(t)
+				g.Expect(testStorage.MkdirAll(artifact)).To(Succeed())
+				g.Expect(os.WriteFile(testStorage.LocalPath(artifact), []byte("chart"), 0o600)).To(Succeed())
+				conditions.MarkTrue(obj, sourcev1.ArtifactInStorageCondition, helmv1.ChartPullSucceededReason, "")
 			},
-			want: sreconcile.ResultSuccess,
 			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
-				t.Expect(obj.Status.Artifact.Path).To(Equal("testdata/charts/helmchart-0.1.0.tgz"))
+				t.Expect(obj.GetArtifact()).To(BeNil())
 				t.Expect(obj.Status.URL).To(BeEmpty())
+				t.Expect(obj.Status.ObservedChartName).To(BeEmpty())
+				t.Expect(obj.Status.ChartMetadata).To(BeNil())
+				artifact := testStorage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "0.1.0", "helmchart-0.1.0.tgz")
+				t.Expect(filepath.Dir(testStorage.LocalPath(artifact))).ToNot(BeAnExistingFile())
 			},
+			want: sreconcile.ResultSuccess,
 			assertConditions: []metav1.Condition{
-				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, helmv1.ChartPackageSucceededReason, "packaged 'helmchart' chart with version '0.1.0'"),
+				*conditions.TrueCondition(sourcev1.ChartValidatedCondition, helmv1.ValidationOnlyReason, "validated chart 'helmchart' version '0.1.0' without storing an artifact"),
 			},
 		},
 		{
-			name:  "Removes ArtifactOutdatedCondition after creating new artifact",
+			name:  "Removes ChartValidated when storing artifact",
 			build: mockChartBuild("helmchart", "0.1.0", "testdata/charts/helmchart-0.1.0.tgz"),
 			beforeFunc: func(obj *helmv1.HelmChart) {
-				conditions.MarkTrue(obj, sourcev1.ArtifactOutdatedCondition, "Foo", "")
+				conditions.MarkTrue(obj, sourcev1.ChartValidatedCondition, helmv1.ValidationOnlyReason, "")
 			},
 			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
 				t.Expect(obj.GetArtifact()).ToNot(BeNil())
-				t.Expect(obj.GetArtifact().Digest).To(Equal("sha256:bbdf96023c912c393b49d5238e227576ed0d20d1bb145d7476d817b80e20c11a"))
-				t.Expect(obj.GetArtifact().Revision).To(Equal("0.1.0"))
-				t.Expect(obj.Status.URL).ToNot(BeEmpty())
-				t.Expect(obj.Status.ObservedChartName).To(Equal("helmchart"))
+			},
+			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, helmv1.ChartPullSucceededReason, "pulled 'helmchart' chart with version '0.1.0'"),
+			},
+		},
+		{
+			name:  "Copying artifact to storage extracts the default values",
+			build: mockChartBuild("helmchart", "0.1.0", "testdata/charts/helmchart-0.1.0.tgz"),
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Spec.ExtractValues = true
+			},
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.GetArtifact()).ToNot(BeNil())
+				t.Expect(obj.Status.ValuesURL).ToNot(BeEmpty())
+
+				valuesPath := filepath.Join(filepath.Dir(testStorage.LocalPath(*obj.GetArtifact())), valuesFileName)
+				got, err := os.ReadFile(valuesPath)
+				t.Expect(err).ToNot(HaveOccurred())
+				t.Expect(string(got)).To(ContainSubstring("replicaCount: 1"))
+				t.Expect(obj.Status.ValuesDigest).To(Equal(digest.SHA256.FromBytes(got).String()))
+			},
+			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, helmv1.ChartPullSucceededReason, "pulled 'helmchart' chart with version '0.1.0'"),
+			},
+		},
+		{
+			name:  "Copying artifact to storage removes stale values",
+			build: mockChartBuild("helmchart", "0.1.0", "testdata/charts/helmchart-0.1.0.tgz"),
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Status.ValuesURL = "http://example.com/" + valuesFileName
+				obj.Status.ValuesDigest = "sha256:foo"
+			},
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.GetArtifact()).ToNot(BeNil())
+				t.Expect(obj.Status.ValuesURL).To(BeEmpty())
+				t.Expect(obj.Status.ValuesDigest).To(BeEmpty())
+				valuesPath := filepath.Join(filepath.Dir(testStorage.LocalPath(*obj.GetArtifact())), valuesFileName)
+				t.Expect(valuesPath).ToNot(BeAnExistingFile())
 			},
 			want: sreconcile.ResultSuccess,
 			assertConditions: []metav1.Condition{
@@ -1570,6 +2526,176 @@ func TestHelmChartReconciler_reconcileArtifact(t *testing.T) {
 	}
 }
 
+func TestHelmChartReconciler_reconcilePush(t *testing.T) {
+	g := NewWithT(t)
+
+	server, err := setupRegistryServer(ctx, t.TempDir(), registryOptions{
+		withBasicAuth: true,
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	// The registry is started in the background.
+	g.Eventually(func() error {
+		return server.registryClient.Login(server.registryHost,
+			helmreg.LoginOptBasicAuth(testRegistryUsername, testRegistryPassword),
+			helmreg.LoginOptInsecure(true))
+	}, timeout, time.Second).Should(Succeed())
+
+	ociRef := fmt.Sprintf("oci://%s/charts", server.registryHost)
+	ref := fmt.Sprintf("%s/charts/helmchart:0.1.0", server.registryHost)
+
+	newSecret := func(password string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "push-" + password,
+			},
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				".dockerconfigjson": []byte(fmt.Sprintf(`{"auths": {%q: {"username": %q, "password": %q}}}`,
+					server.registryHost, testRegistryUsername, password)),
+			},
+		}
+	}
+	validSecret := newSecret(testRegistryPassword)
+	invalidSecret := newSecret("invalid")
+
+	tests := []struct {
+		name             string
+		beforeFunc       func(obj *helmv1.HelmChart)
+		want             sreconcile.Result
+		wantErr          bool
+		assertConditions []metav1.Condition
+		afterFunc        func(t *WithT, obj *helmv1.HelmChart)
+	}{
+		{
+			name: "Pushes artifact and records digest",
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Spec.Push = &helmv1.HelmChartPush{
+					OCIRef:    ociRef,
+					SecretRef: &meta.LocalObjectReference{Name: validSecret.Name},
+				}
+			},
+			want: sreconcile.ResultSuccess,
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.Status.Push).ToNot(BeNil())
+				t.Expect(obj.Status.Push.Ref).To(Equal(ref))
+				t.Expect(obj.Status.Push.ArtifactDigest).To(Equal(obj.GetArtifact().Digest))
+
+				res, err := server.registryClient.Pull(ref)
+				t.Expect(err).ToNot(HaveOccurred())
+				t.Expect(obj.Status.Push.Digest).To(Equal(res.Manifest.Digest))
+			},
+		},
+		{
+			name: "Does not push already pushed artifact",
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Spec.Push = &helmv1.HelmChartPush{
+					OCIRef: ociRef,
+				}
+				obj.Status.Push = &helmv1.HelmChartPushStatus{
+					Ref:            ref,
+					Digest:         "sha256:pushed",
+					ArtifactDigest: obj.GetArtifact().Digest,
+				}
+			},
+			want: sreconcile.ResultSuccess,
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.Status.Push.Digest).To(Equal("sha256:pushed"))
+			},
+		},
+		{
+			name: "Push with invalid credentials makes StorageOperationFailed=True",
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Spec.Push = &helmv1.HelmChartPush{
+					OCIRef:    ociRef,
+					SecretRef: &meta.LocalObjectReference{Name: invalidSecret.Name},
+				}
+			},
+			want:    sreconcile.ResultEmpty,
+			wantErr: true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.StorageOperationFailedCondition, helmv1.ChartPushFailedReason, "failed to push chart to '%s'", ref),
+			},
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.Status.Push).To(BeNil())
+			},
+		},
+		{
+			name: "Disabled push removes push status and failure",
+			beforeFunc: func(obj *helmv1.HelmChart) {
+				obj.Status.Push = &helmv1.HelmChartPushStatus{
+					Ref:            ref,
+					Digest:         "sha256:pushed",
+					ArtifactDigest: obj.GetArtifact().Digest,
+				}
+				conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, helmv1.ChartPushFailedReason, "failed")
+			},
+			want: sreconcile.ResultSuccess,
+			afterFunc: func(t *WithT, obj *helmv1.HelmChart) {
+				t.Expect(obj.Status.Push).To(BeNil())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			r := &HelmChartReconciler{
+				Client:                  fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).WithObjects(validSecret, invalidSecret).Build(),
+				EventRecorder:           record.NewFakeRecorder(32),
+				Storage:                 testStorage,
+				RegistryClientGenerator: registry.ClientGenerator,
+				patchOptions:            getPatchOptions(helmChartReadyCondition.Owned, "sc"),
+			}
+
+			obj := &helmv1.HelmChart{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "reconcile-push-",
+					Generation:   1,
+				},
+			}
+
+			artifact := testStorage.NewArtifactFor(helmv1.HelmChartKind, obj.GetObjectMeta(), "0.1.0", "helmchart-0.1.0.tgz")
+			g.Expect(testStorage.MkdirAll(artifact)).To(Succeed())
+			g.Expect(testStorage.CopyFromPath(&artifact, "testdata/charts/helmchart-0.1.0.tgz")).To(Succeed())
+			obj.Status.Artifact = &artifact
+			obj.Status.ObservedChartName = "helmchart"
+
+			if tt.beforeFunc != nil {
+				tt.beforeFunc(obj)
+			}
+
+			sp := patch.NewSerialPatcher(obj, r.Client)
+
+			got, err := r.reconcilePush(ctx, sp, obj, &chart.Build{})
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			g.Expect(got).To(Equal(tt.want))
+			g.Expect(obj.Status.Conditions).To(conditions.MatchConditions(tt.assertConditions))
+			if tt.afterFunc != nil {
+				tt.afterFunc(g, obj)
+			}
+		})
+	}
+}
+
+func Test_chartPushRef(t *testing.T) {
+	tests := []struct {
+		ociRef  string
+		version string
+		want    string
+	}{
+		{ociRef: "oci://ghcr.io/org/charts", version: "1.0.0", want: "ghcr.io/org/charts/podinfo:1.0.0"},
+		{ociRef: "oci://localhost:5000/charts/", version: "1.0.0", want: "localhost:5000/charts/podinfo:1.0.0"},
+		{ociRef: "oci://ghcr.io/org", version: "1.0.0+abcdef", want: "ghcr.io/org/podinfo:1.0.0_abcdef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(chartPushRef(tt.ociRef, "podinfo", tt.version)).To(Equal(tt.want))
+		})
+	}
+}
+
 func TestHelmChartReconciler_getHelmRepositorySecret(t *testing.T) {
 	mock := &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
@@ -1689,10 +2815,11 @@ func TestHelmChartReconciler_getSource(t *testing.T) {
 	}
 
 	tests := []struct {
-		name    string
-		obj     *helmv1.HelmChart
-		want    sourcev1.Source
-		wantErr bool
+		name                string
+		obj                 *helmv1.HelmChart
+		want                sourcev1.Source
+		wantErr             bool
+		wantUnsupportedKind bool
 	}{
 		{
 			name: "Get HelmRepository source for reference",
@@ -1764,7 +2891,34 @@ func TestHelmChartReconciler_getSource(t *testing.T) {
 					},
 				},
 			},
-			wantErr: true,
+			wantErr:             true,
+			wantUnsupportedKind: true,
+		},
+		{
+			name: "Error on source kind with different case",
+			obj: &helmv1.HelmChart{
+				Spec: helmv1.HelmChartSpec{
+					SourceRef: helmv1.LocalHelmChartSourceReference{
+						Name: mocks[0].GetName(),
+						Kind: "helmrepository",
+					},
+				},
+			},
+			wantErr:             true,
+			wantUnsupportedKind: true,
+		},
+		{
+			name: "Error on Source kind which is not supported for charts",
+			obj: &helmv1.HelmChart{
+				Spec: helmv1.HelmChartSpec{
+					SourceRef: helmv1.LocalHelmChartSourceReference{
+						Name: "oci",
+						Kind: helmv1.OCIRepositoryKind,
+					},
+				},
+			},
+			wantErr:             true,
+			wantUnsupportedKind: true,
 		},
 	}
 	for _, tt := range tests {
@@ -1775,6 +2929,7 @@ func TestHelmChartReconciler_getSource(t *testing.T) {
 
 			if tt.wantErr {
 				g.Expect(err).To(HaveOccurred())
+				g.Expect(errors.Is(err, errUnsupportedSourceKind)).To(Equal(tt.wantUnsupportedKind))
 				g.Expect(got).To(BeNil())
 				return
 			}
@@ -2088,9 +3243,9 @@ func TestHelmChartReconciler_notify(t *testing.T) {
 			res:    sreconcile.ResultSuccess,
 			resErr: nil,
 			newObjBeforeFunc: func(obj *helmv1.HelmChart) {
-				obj.Status.Artifact = &sourcev1.Artifact{Revision: "xxx", Digest: "yyy"}
+				obj.Status.Artifact = &sourcev1.Artifact{Revision: "xxx", Digest: "yyy", Path: "foo-1.0.0.tgz"}
 			},
-			wantEvent: "Normal ChartPackageSucceeded packaged",
+			wantEvent: "Normal ChartPackageSucceeded packaged 'foo' chart with version '1.0.0' with revision 'xxx' at 'foo-1.0.0.tgz'",
 		},
 		{
 			name:   "recovery from failure",
@@ -2650,3 +3805,58 @@ func loadTestChartToOCI(chartData []byte, chartPath string, server *registryClie
 
 	return metadata, nil
 }
+
+func Test_cosignIdentityFromSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string][]byte
+		want    *cosign.Identity
+		wantErr string
+	}{
+		{
+			name: "no identity",
+			data: map[string][]byte{"cosign.key": []byte("key")},
+		},
+		{
+			name: "issuer and subject",
+			data: map[string][]byte{
+				"issuer":  []byte("https://token.actions.githubusercontent.com"),
+				"subject": []byte("https://github.com/stefanprodan/podinfo/.github/workflows/release.yml@refs/tags/6.2.0"),
+			},
+			want: &cosign.Identity{
+				Issuer:  "https://token.actions.githubusercontent.com",
+				Subject: "https://github.com/stefanprodan/podinfo/.github/workflows/release.yml@refs/tags/6.2.0",
+			},
+		},
+		{
+			name: "regular expressions",
+			data: map[string][]byte{
+				"issuerRegExp":  []byte("^https://token.actions.githubusercontent.com$"),
+				"subjectRegExp": []byte("^https://github.com/stefanprodan/podinfo.*$"),
+			},
+			want: &cosign.Identity{
+				IssuerRegExp:  "^https://token.actions.githubusercontent.com$",
+				SubjectRegExp: "^https://github.com/stefanprodan/podinfo.*$",
+			},
+		},
+		{
+			name:    "invalid regular expression",
+			data:    map[string][]byte{"issuerRegExp": []byte("(")},
+			wantErr: "invalid 'issuerRegExp'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			got, err := cosignIdentityFromSecret(corev1.Secret{Data: tt.data})
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
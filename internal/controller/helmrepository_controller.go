@@ -22,10 +22,12 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
 	"time"
 
 	"github.com/docker/go-units"
 	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/attribute"
 	helmgetter "helm.sh/helm/v3/pkg/getter"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -42,6 +44,7 @@ import (
 	"github.com/fluxcd/pkg/apis/meta"
 	"github.com/fluxcd/pkg/runtime/conditions"
 	helper "github.com/fluxcd/pkg/runtime/controller"
+	"github.com/fluxcd/pkg/runtime/logger"
 	"github.com/fluxcd/pkg/runtime/patch"
 	"github.com/fluxcd/pkg/runtime/predicates"
 	rreconcile "github.com/fluxcd/pkg/runtime/reconcile"
@@ -49,13 +52,35 @@ import (
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	helmv1 "github.com/fluxcd/source-controller/api/v1beta2"
 	"github.com/fluxcd/source-controller/internal/cache"
+	"github.com/fluxcd/source-controller/internal/connlimit"
 	intdigest "github.com/fluxcd/source-controller/internal/digest"
 	serror "github.com/fluxcd/source-controller/internal/error"
+	"github.com/fluxcd/source-controller/internal/features"
 	"github.com/fluxcd/source-controller/internal/helm/getter"
 	"github.com/fluxcd/source-controller/internal/helm/repository"
+	"github.com/fluxcd/source-controller/internal/latency"
+	"github.com/fluxcd/source-controller/internal/mirror"
 	intpredicates "github.com/fluxcd/source-controller/internal/predicates"
 	sreconcile "github.com/fluxcd/source-controller/internal/reconcile"
 	"github.com/fluxcd/source-controller/internal/reconcile/summarize"
+	"github.com/fluxcd/source-controller/internal/sourcemetrics"
+	"github.com/fluxcd/source-controller/internal/tracing"
+	"github.com/fluxcd/source-controller/internal/transport"
+	"github.com/fluxcd/source-controller/internal/util"
+	"github.com/fluxcd/source-controller/internal/webhook"
+)
+
+// rawIndexFileName is the name of the file next to the artifact of a
+// HelmRepository containing the index exactly as downloaded, when
+// HelmRepositoryReconciler.KeepRawIndex is enabled.
+const rawIndexFileName = "index.raw.yaml"
+
+// fetchIndexRetryInterval is the delay before the first retry of a failed
+// fetch of a Helm repository index, which doubles for every next retry up to
+// fetchIndexMaxRetryInterval.
+var (
+	fetchIndexRetryInterval    = time.Second
+	fetchIndexMaxRetryInterval = 30 * time.Second
 )
 
 // helmRepositoryReadyCondition contains the information required to summarize a
@@ -67,6 +92,7 @@ var helmRepositoryReadyCondition = summarize.Conditions{
 		sourcev1.FetchFailedCondition,
 		sourcev1.ArtifactOutdatedCondition,
 		sourcev1.ArtifactInStorageCondition,
+		helmv1.IndexCompatibilityWarningCondition,
 		meta.ReadyCondition,
 		meta.ReconcilingCondition,
 		meta.StalledCondition,
@@ -114,7 +140,41 @@ type HelmRepositoryReconciler struct {
 	TTL   time.Duration
 	*cache.CacheRecorder
 
+	PreStoreWebhook *webhook.PreStore
+
+	// LatencyRecorder records the sliding-window reconcile latency
+	// percentiles.
+	LatencyRecorder *latency.Recorder
+
+	// SourceMetrics records the reconcile duration, Artifact size and
+	// fetch failure metrics.
+	SourceMetrics *sourcemetrics.Recorder
+
+	// ConnectionLimiter bounds the number of concurrent outbound network
+	// operations across all reconcilers.
+	ConnectionLimiter *connlimit.Limiter
+
+	// AllowedSchemes is the list of URL schemes sources are allowed to use.
+	// Any scheme is allowed when empty.
+	AllowedSchemes []string
+
+	// KeepRawIndex enables storing the index exactly as downloaded next to
+	// the artifact, to allow debugging the processing of indexes.
+	KeepRawIndex bool
+
+	// PassthroughIndex disables the normalization of indexes, storing the
+	// index exactly as downloaded as the artifact. Paginated indexes, which
+	// can not be merged without normalization, fail to reconcile.
+	PassthroughIndex bool
+
+	// CompressedIndex enables downloading the gzip-compressed index.yaml.gz
+	// of HTTP/S repositories, falling back to the index.yaml if it is not
+	// available.
+	CompressedIndex bool
+
+	features     map[string]bool
 	patchOptions []patch.Option
+	mirrorHealth *mirror.Tracker
 }
 
 type HelmRepositoryReconcilerOptions struct {
@@ -135,6 +195,11 @@ func (r *HelmRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
 func (r *HelmRepositoryReconciler) SetupWithManagerAndOptions(mgr ctrl.Manager, opts HelmRepositoryReconcilerOptions) error {
 	r.patchOptions = getPatchOptions(helmRepositoryReadyCondition.Owned, r.ControllerName)
 
+	if r.features == nil {
+		r.features = features.FeatureGates()
+	}
+	r.mirrorHealth = mirror.NewTracker()
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&helmv1.HelmRepository{}).
 		WithEventFilter(
@@ -157,6 +222,11 @@ func (r *HelmRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	start := time.Now()
 	log := ctrl.LoggerFrom(ctx)
 
+	ctx, span := tracing.StartReconcile(ctx, helmv1.HelmRepositoryKind, req.Namespace, req.Name)
+	defer func() {
+		tracing.End(span, retErr)
+	}()
+
 	// Fetch the HelmRepository
 	obj := &helmv1.HelmRepository{}
 	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
@@ -193,6 +263,8 @@ func (r *HelmRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		// Always record readiness and duration metrics
 		r.Metrics.RecordReadiness(ctx, obj)
 		r.Metrics.RecordDuration(ctx, obj, start)
+		r.LatencyRecorder.Observe(helmv1.HelmRepositoryKind, time.Since(start))
+		r.SourceMetrics.Record(helmv1.HelmRepositoryKind, obj, time.Since(start), retErr)
 	}()
 
 	// Add finalizer first if not exist to avoid the race condition
@@ -262,7 +334,9 @@ func (r *HelmRepositoryReconciler) reconcile(ctx context.Context, sp *patch.Seri
 	var res sreconcile.Result
 	var resErr error
 	for _, rec := range reconcilers {
-		recResult, err := rec(ctx, sp, obj, &artifact, &chartRepo)
+		recCtx, recSpan := tracing.StartFunc(ctx, rec)
+		recResult, err := rec(recCtx, sp, obj, &artifact, &chartRepo)
+		tracing.End(recSpan, err)
 		// Exit immediately on ResultRequeue.
 		if recResult == sreconcile.ResultRequeue {
 			return sreconcile.ResultRequeue, nil
@@ -298,7 +372,8 @@ func (r *HelmRepositoryReconciler) notify(ctx context.Context, oldObj, newObj *h
 			humanReadableSize = fmt.Sprintf("size %s", units.HumanSize(float64(*size)))
 		}
 
-		message := fmt.Sprintf("stored fetched index of %s from '%s'", humanReadableSize, chartRepo.URL)
+		message := fmt.Sprintf("stored fetched index of %s from '%s' with revision '%s' at '%s'",
+			humanReadableSize, chartRepo.URL, newObj.Status.Artifact.Revision, newObj.Status.Artifact.Path)
 
 		// Notify on new artifact and failure recovery.
 		if !oldObj.GetArtifact().HasDigest(newObj.GetArtifact().Digest) {
@@ -334,7 +409,7 @@ func (r *HelmRepositoryReconciler) reconcileStorage(ctx context.Context, sp *pat
 
 	// Determine if the advertised artifact is still in storage
 	var artifactMissing bool
-	if artifact := obj.GetArtifact(); artifact != nil && !r.Storage.ArtifactExist(*artifact) {
+	if artifact := obj.GetArtifact(); artifact != nil && r.Storage.ArtifactMissing(*artifact) {
 		obj.Status.Artifact = nil
 		obj.Status.URL = ""
 		artifactMissing = true
@@ -342,12 +417,26 @@ func (r *HelmRepositoryReconciler) reconcileStorage(ctx context.Context, sp *pat
 		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
 	}
 
+	// Determine if the advertised artifact still matches its digest
+	var artifactMismatch bool
+	if err := r.Storage.ArtifactDigestMismatch(obj.GetArtifact()); err != nil {
+		r.eventLogf(ctx, obj, corev1.EventTypeWarning, sourcev1.ArtifactDigestMismatchReason,
+			"failed to verify integrity of artifact: %s", err.Error())
+		obj.Status.Artifact = nil
+		obj.Status.URL = ""
+		artifactMismatch = true
+		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
+	}
+
 	// Record that we do not have an artifact
 	if obj.GetArtifact() == nil {
 		msg := "building artifact"
 		if artifactMissing {
 			msg += ": disappeared from storage"
 		}
+		if artifactMismatch {
+			msg += ": digest mismatch in storage"
+		}
 		rreconcile.ProgressiveStatus(true, obj, meta.ProgressingReason, msg)
 		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
 		if err := sp.Patch(ctx, obj, r.patchOptions...); err != nil {
@@ -356,10 +445,16 @@ func (r *HelmRepositoryReconciler) reconcileStorage(ctx context.Context, sp *pat
 		return sreconcile.ResultSuccess, nil
 	}
 
-	// Always update URLs to ensure hostname is up-to-date
-	// TODO(hidde): we may want to send out an event only if we notice the URL has changed
-	r.Storage.SetArtifactURL(obj.GetArtifact())
+	// Always update URLs to ensure hostname is up-to-date, and notify about
+	// corrected URLs of e.g. a changed storage hostname
+	if previousURL, ok := r.Storage.UpdateArtifactURL(obj.GetArtifact()); ok {
+		r.eventLogf(ctx, obj, corev1.EventTypeNormal, sourcev1.ArtifactURLUpdatedReason,
+			"artifact URL updated from '%s' to '%s' to match the storage hostname", previousURL, obj.GetArtifact().URL)
+	}
 	obj.Status.URL = r.Storage.SetHostname(obj.Status.URL)
+	if obj.Status.RawIndexURL != "" {
+		obj.Status.RawIndexURL = r.Storage.SetHostname(obj.Status.RawIndexURL)
+	}
 
 	return sreconcile.ResultSuccess, nil
 }
@@ -374,24 +469,23 @@ func (r *HelmRepositoryReconciler) reconcileStorage(ctx context.Context, sp *pat
 // pointer is set to the newly fetched index.
 func (r *HelmRepositoryReconciler) reconcileSource(ctx context.Context, sp *patch.SerialPatcher,
 	obj *helmv1.HelmRepository, artifact *sourcev1.Artifact, chartRepo *repository.ChartRepository) (sreconcile.Result, error) {
-	var tlsConfig *tls.Config
-
-	// Configure Helm client to access repository
-	clientOpts := []helmgetter.Option{
-		helmgetter.WithTimeout(obj.Spec.Timeout.Duration),
-		helmgetter.WithURL(obj.Spec.URL),
-		helmgetter.WithPassCredentialsAll(obj.Spec.PassCredentials),
+	// Validate the referenced secrets before any network operation
+	if r.features[features.PreflightSecrets] {
+		if e := preflightSecrets(ctx, r.Client, obj.GetNamespace(), helmRepositorySecretReferences(obj)...); e != nil {
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return sreconcile.ResultEmpty, e
+		}
 	}
 
-	// Configure any authentication related options
+	// Attempt to retrieve the secret used for authentication
+	var secret *corev1.Secret
 	if obj.Spec.SecretRef != nil {
-		// Attempt to retrieve secret
 		name := types.NamespacedName{
 			Namespace: obj.GetNamespace(),
 			Name:      obj.Spec.SecretRef.Name,
 		}
-		var secret corev1.Secret
-		if err := r.Client.Get(ctx, name, &secret); err != nil {
+		secret = &corev1.Secret{}
+		if err := r.Client.Get(ctx, name, secret); err != nil {
 			e := &serror.Event{
 				Err:    fmt.Errorf("failed to get secret '%s': %w", name.String(), err),
 				Reason: sourcev1.AuthenticationFailedReason,
@@ -399,64 +493,43 @@ func (r *HelmRepositoryReconciler) reconcileSource(ctx context.Context, sp *patc
 			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
 			return sreconcile.ResultEmpty, e
 		}
+	}
 
-		// Construct actual options
-		opts, err := getter.ClientOptionsFromSecret(secret)
-		if err != nil {
-			e := &serror.Event{
-				Err:    fmt.Errorf("failed to configure Helm client with secret data: %w", err),
-				Reason: sourcev1.AuthenticationFailedReason,
-			}
-			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
-			// Return err as the content of the secret may change.
-			return sreconcile.ResultEmpty, e
+	// Fetch the repository index from the healthiest of the URL and its
+	// mirrors, failing over to the next one on error.
+	var (
+		newChartRepo *repository.ChartRepository
+		notModified  bool
+		err          error
+	)
+	for _, u := range r.mirrorHealth.Rank(append([]string{obj.Spec.URL}, obj.Spec.Mirrors...)) {
+		start := time.Now()
+		fetchCtx, span := tracing.Start(ctx, "fetchIndex", attribute.String("url", util.RedactURL(u)))
+		newChartRepo, err = r.fetchIndex(fetchCtx, obj, u, secret)
+		if errors.Is(err, repository.ErrIndexNotModified) {
+			notModified, err = true, nil
 		}
-		clientOpts = append(clientOpts, opts...)
-
-		tlsConfig, err = getter.TLSClientConfigFromSecret(secret, obj.Spec.URL)
-		if err != nil {
-			e := &serror.Event{
-				Err:    fmt.Errorf("failed to create TLS client config with secret data: %w", err),
-				Reason: sourcev1.AuthenticationFailedReason,
-			}
-			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
-			// Requeue as content of secret might change
-			return sreconcile.ResultEmpty, e
+		tracing.End(span, err)
+		r.mirrorHealth.Observe(u, time.Since(start), err)
+		if err == nil {
+			break
+		}
+		if len(obj.Spec.Mirrors) > 0 {
+			ctrl.LoggerFrom(ctx).V(logger.DebugLevel).Info("failed to fetch Helm repository index",
+				"url", util.RedactURL(u), "error", err.Error())
 		}
 	}
-
-	// Construct Helm chart repository with options and download index
-	newChartRepo, err := repository.NewChartRepository(obj.Spec.URL, "", r.Getters, tlsConfig, clientOpts...)
 	if err != nil {
-		switch err.(type) {
-		case *url.Error:
-			e := &serror.Stalling{
-				Err:    fmt.Errorf("invalid Helm repository URL: %w", err),
-				Reason: sourcev1.URLInvalidReason,
-			}
-			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
-			return sreconcile.ResultEmpty, e
-		default:
-			e := &serror.Stalling{
-				Err:    fmt.Errorf("failed to construct Helm client: %w", err),
-				Reason: meta.FailedReason,
-			}
-			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
-			return sreconcile.ResultEmpty, e
-		}
+		return sreconcile.ResultEmpty, err
 	}
+	*chartRepo = *newChartRepo
 
-	// Fetch the repository index from remote.
-	if err := newChartRepo.CacheIndex(); err != nil {
-		e := &serror.Event{
-			Err:    fmt.Errorf("failed to fetch Helm repository index: %w", err),
-			Reason: meta.FailedReason,
-		}
-		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
-		// Coin flip on transient or persistent error, return error and hope for the best
-		return sreconcile.ResultEmpty, e
+	// Keep the current Artifact if its index has not been modified.
+	if notModified {
+		*artifact = *obj.GetArtifact()
+		conditions.Delete(obj, sourcev1.FetchFailedCondition)
+		return sreconcile.ResultSuccess, nil
 	}
-	*chartRepo = *newChartRepo
 
 	// Early comparison to current Artifact.
 	if curArtifact := obj.GetArtifact(); curArtifact != nil {
@@ -473,22 +546,37 @@ func (r *HelmRepositoryReconciler) reconcileSource(ctx context.Context, sp *patc
 	}
 
 	// Load the cached repository index to ensure it passes validation.
-	if err := chartRepo.LoadFromPath(); err != nil {
+	_, span := tracing.Start(ctx, "loadIndex")
+	err = chartRepo.LoadFromPath()
+	tracing.End(span, err)
+	if err != nil {
 		e := &serror.Event{
 			Err:    fmt.Errorf("failed to load Helm repository from index YAML: %w", err),
 			Reason: helmv1.IndexationFailedReason,
 		}
+		if errors.Is(err, repository.ErrTooManyIndexEntries) {
+			e.Reason = sourcev1.IndexTooLargeReason
+		}
 		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
 		return sreconcile.ResultEmpty, e
 	}
 	// Delete any stale failure observation
 	conditions.Delete(obj, sourcev1.FetchFailedCondition)
 
+	// Warn about an index API version which may not be fully supported.
+	if apiVersion := chartRepo.Index.APIVersion; !repository.IsKnownIndexAPIVersion(apiVersion) {
+		conditions.MarkTrue(obj, helmv1.IndexCompatibilityWarningCondition, helmv1.UnknownIndexAPIVersionReason,
+			"index has unrecognized API version '%s' and was parsed on a best-effort basis", apiVersion)
+	} else {
+		conditions.Delete(obj, helmv1.IndexCompatibilityWarningCondition)
+	}
+
 	// Check if index has changed compared to current Artifact revision.
 	var changed bool
 	if artifact := obj.Status.Artifact; artifact != nil {
 		curRev := digest.Digest(artifact.Revision)
-		changed = curRev.Validate() != nil || curRev != chartRepo.Digest(curRev.Algorithm())
+		changed = curRev.Validate() != nil || curRev != chartRepo.Digest(curRev.Algorithm()) ||
+			digestAlgorithmChanged(artifact, obj.Spec.DigestAlgorithm)
 	}
 
 	// Calculate revision.
@@ -525,6 +613,227 @@ func (r *HelmRepositoryReconciler) reconcileSource(ctx context.Context, sp *patc
 	return sreconcile.ResultSuccess, nil
 }
 
+// validateInsecureSkipVerify returns an error if the verification of the TLS
+// certificate of the given HelmRepository is disabled, while the given secret
+// provides a CA certificate to verify it with.
+func validateInsecureSkipVerify(obj *helmv1.HelmRepository, secret *corev1.Secret) error {
+	if obj.Spec.Insecure && secret != nil && len(secret.Data["caFile"]) > 0 {
+		return fmt.Errorf("'insecure' is mutually exclusive with the 'caFile' of secret '%s'", secret.Name)
+	}
+	return nil
+}
+
+// fetchIndex constructs a Helm chart repository for the given repository URL
+// of the object, with the authentication options of the given secret (if not
+// nil), and downloads its index. Transient download errors are retried up to
+// the fetch retries of the object, with an exponential backoff.
+// On error, it records the failure on the FetchFailedCondition of the object.
+func (r *HelmRepositoryReconciler) fetchIndex(ctx context.Context, obj *helmv1.HelmRepository, repositoryURL string, secret *corev1.Secret) (*repository.ChartRepository, error) {
+	var (
+		tlsConfig *tls.Config
+		proxy     *transport.Proxy
+	)
+
+	if err := util.ValidateURLScheme(repositoryURL, r.AllowedSchemes); err != nil {
+		e := &serror.Stalling{
+			Err:    fmt.Errorf("invalid Helm repository URL '%s': %w", util.RedactURL(repositoryURL), err),
+			Reason: sourcev1.URLSchemeNotAllowedReason,
+		}
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+		return nil, e
+	}
+
+	// Extract any credentials embedded in the URL, to prevent them from being
+	// exposed through the URLs of the chart repository.
+	repoURL, urlAuth, err := getter.BasicAuthFromURL(repositoryURL)
+	if err != nil {
+		e := &serror.Stalling{
+			Err:    fmt.Errorf("invalid Helm repository URL: %w", err),
+			Reason: sourcev1.URLInvalidReason,
+		}
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+		return nil, e
+	}
+
+	// Configure Helm client to access repository
+	clientOpts := []helmgetter.Option{
+		helmgetter.WithTimeout(obj.GetTimeout()),
+		helmgetter.WithURL(repoURL),
+		helmgetter.WithPassCredentialsAll(obj.Spec.PassCredentials),
+	}
+	if urlAuth != nil {
+		clientOpts = append(clientOpts, urlAuth)
+	}
+
+	// Configure any authentication related options
+	if secret != nil {
+		if err := validateInsecureSkipVerify(obj, secret); err != nil {
+			e := &serror.Event{
+				Err:    err,
+				Reason: helmv1.InvalidTLSConfigReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			// Requeue as content of secret might change
+			return nil, e
+		}
+
+		// Construct actual options
+		opts, err := getter.ClientOptionsFromSecret(*secret)
+		if err != nil {
+			e := &serror.Event{
+				Err:    fmt.Errorf("failed to configure Helm client with secret data: %w", err),
+				Reason: sourcev1.AuthenticationFailedReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			// Return err as the content of the secret may change.
+			return nil, e
+		}
+		clientOpts = append(clientOpts, opts...)
+
+		tlsConfig, err = getter.TLSClientConfigFromSecret(*secret, repoURL)
+		if err != nil {
+			e := &serror.Event{
+				Err:    fmt.Errorf("failed to create TLS client config with secret data: %w", err),
+				Reason: sourcev1.AuthenticationFailedReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			// Requeue as content of secret might change
+			return nil, e
+		}
+
+		proxy, err = getter.ProxyFromSecret(*secret)
+		if err != nil {
+			e := &serror.Event{
+				Err:    fmt.Errorf("failed to configure proxy with secret data: %w", err),
+				Reason: sourcev1.AuthenticationFailedReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			// Requeue as content of secret might change
+			return nil, e
+		}
+	}
+
+	// Configure the proxy of the object, which takes precedence over the
+	// proxy from the secret
+	if obj.Spec.Proxy != nil {
+		proxy, err = proxyFromConfig(ctx, r.Client, obj.GetNamespace(), obj.Spec.Proxy)
+		if errors.Is(err, errInvalidProxyURL) {
+			e := serror.NewStalling(err, sourcev1.URLInvalidReason)
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return nil, e
+		}
+		if err != nil {
+			e := &serror.Event{
+				Err:    fmt.Errorf("failed to configure proxy: %w", err),
+				Reason: sourcev1.AuthenticationFailedReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			// Requeue as content of secret might change
+			return nil, e
+		}
+	}
+
+	tlsConfig = getter.WithTLSServerName(tlsConfig, obj.Spec.TLSServerName)
+	if obj.Spec.Insecure {
+		r.eventLogf(ctx, obj, corev1.EventTypeWarning, helmv1.InsecureSkipVerifyReason,
+			"TLS certificate verification is disabled for Helm repository URL '%s'", util.RedactURL(repositoryURL))
+		tlsConfig = getter.WithInsecureSkipVerify(tlsConfig, true)
+	}
+
+	// Construct Helm chart repository with options and download index
+	newChartRepo, err := repository.NewChartRepository(repoURL, "", r.Getters, tlsConfig, clientOpts...)
+	if err != nil {
+		switch err.(type) {
+		case *url.Error:
+			e := &serror.Stalling{
+				Err:    fmt.Errorf("invalid Helm repository URL: %w", err),
+				Reason: sourcev1.URLInvalidReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+			return nil, e
+		default:
+			e := &serror.Stalling{
+				Err:    fmt.Errorf("failed to construct Helm client: %w", err),
+				Reason: meta.FailedReason,
+			}
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Error())
+			return nil, e
+		}
+	}
+
+	// Fetch the repository index from remote.
+	newChartRepo.Proxy = proxy
+	newChartRepo.ConnectionLimiter = r.ConnectionLimiter
+	newChartRepo.KeepRawIndex = r.KeepRawIndex
+	newChartRepo.PassthroughIndex = r.PassthroughIndex
+	newChartRepo.CompressedIndex = r.CompressedIndex
+
+	// Make a conditional request for the index of the current Artifact, as
+	// long as the index can not differ from it due to a change of the spec.
+	// The validators of one URL do not apply to its mirrors.
+	newChartRepo.ConditionalIndex = len(obj.Spec.Mirrors) == 0
+	if curArtifact := obj.GetArtifact(); curArtifact != nil && obj.Generation == obj.Status.ObservedGeneration &&
+		!digestAlgorithmChanged(curArtifact, obj.Spec.DigestAlgorithm) &&
+		(obj.Status.IndexETag != "" || obj.Status.IndexLastModified != "") {
+		newChartRepo.Validators = &repository.IndexValidators{
+			ETag:         obj.Status.IndexETag,
+			LastModified: obj.Status.IndexLastModified,
+		}
+	}
+
+	if attempts, err := cacheIndexWithRetries(ctx, newChartRepo, obj.GetFetchRetries()); err != nil {
+		if errors.Is(err, repository.ErrIndexNotModified) {
+			return newChartRepo, err
+		}
+		e := &serror.Event{
+			Err:    fmt.Errorf("failed to fetch Helm repository index: %w", err),
+			Reason: meta.FailedReason,
+		}
+		if attempts > 1 {
+			e.Err = fmt.Errorf("failed to fetch Helm repository index after %d attempts: %w", attempts, err)
+		}
+		switch {
+		case errors.Is(err, repository.ErrIndexTooLarge), errors.Is(err, repository.ErrTooManyIndexEntries):
+			e.Reason = sourcev1.IndexTooLargeReason
+		case errors.Is(err, repository.ErrPaginatedIndex):
+			e.Reason = helmv1.IndexationFailedReason
+		case transport.IsTooManyRedirects(err):
+			e.Reason = sourcev1.TooManyRedirectsReason
+		}
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+		// Coin flip on transient or persistent error, return error and hope for the best
+		return nil, e
+	}
+	return newChartRepo, nil
+}
+
+// cacheIndexWithRetries caches the index of the given chart repository,
+// retrying up to the given number of times after a transient error, with an
+// exponential backoff starting at fetchIndexRetryInterval. It returns the
+// number of attempts made, and the error of the last attempt.
+func cacheIndexWithRetries(ctx context.Context, chartRepo *repository.ChartRepository, retries int) (int, error) {
+	delay := fetchIndexRetryInterval
+	for attempt := 1; ; attempt++ {
+		err := chartRepo.CacheIndex()
+		if err == nil || attempt > retries || !repository.IsTransientError(err) {
+			return attempt, err
+		}
+
+		ctrl.LoggerFrom(ctx).Info("retrying fetch of Helm repository index after transient error",
+			"url", util.RedactURL(chartRepo.URL), "attempt", attempt, "retryAfter", delay.String(), "error", err.Error())
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+		if delay *= 2; delay > fetchIndexMaxRetryInterval {
+			delay = fetchIndexMaxRetryInterval
+		}
+	}
+}
+
 // reconcileArtifact archives a new Artifact to the Storage, if the current
 // (Status) data on the object does not match the given.
 //
@@ -537,7 +846,8 @@ func (r *HelmRepositoryReconciler) reconcileSource(ctx context.Context, sp *patc
 func (r *HelmRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *patch.SerialPatcher, obj *helmv1.HelmRepository, artifact *sourcev1.Artifact, chartRepo *repository.ChartRepository) (sreconcile.Result, error) {
 	// Set the ArtifactInStorageCondition if there's no drift.
 	defer func() {
-		if obj.GetArtifact().HasRevision(artifact.Revision) {
+		if obj.GetArtifact().HasRevision(artifact.Revision) &&
+			!digestAlgorithmChanged(obj.GetArtifact(), obj.Spec.DigestAlgorithm) {
 			conditions.Delete(obj, sourcev1.ArtifactOutdatedCondition)
 			conditions.MarkTrue(obj, sourcev1.ArtifactInStorageCondition, meta.SucceededReason,
 				"stored artifact: revision '%s'", artifact.Revision)
@@ -547,16 +857,24 @@ func (r *HelmRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pa
 		}
 	}()
 
-	if obj.GetArtifact().HasRevision(artifact.Revision) && obj.GetArtifact().HasDigest(artifact.Digest) {
+	if obj.GetArtifact().HasRevision(artifact.Revision) && obj.GetArtifact().HasDigest(artifact.Digest) &&
+		!digestAlgorithmChanged(obj.GetArtifact(), obj.Spec.DigestAlgorithm) {
 		// Extend TTL of the Index in the cache (if present).
 		if r.Cache != nil {
 			r.Cache.SetExpiration(artifact.Path, r.TTL)
 		}
 
+		setIndexValidators(obj, chartRepo)
 		r.eventLogf(ctx, obj, eventv1.EventTypeTrace, sourcev1.ArtifactUpToDateReason, "artifact up-to-date with remote revision: '%s'", artifact.Revision)
 		return sreconcile.ResultSuccess, nil
 	}
 
+	// Consult the pre-store webhook before storing the artifact
+	if e := reviewArtifact(ctx, r.PreStoreWebhook, helmv1.HelmRepositoryKind, obj, *artifact); e != nil {
+		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
 	// Create artifact dir
 	if err := r.Storage.MkdirAll(*artifact); err != nil {
 		e := &serror.Event{
@@ -578,17 +896,41 @@ func (r *HelmRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pa
 	defer unlock()
 
 	// Save artifact to storage.
-	if err = r.Storage.CopyFromPath(artifact, chartRepo.Path); err != nil {
+	if err = r.Storage.CopyFromPath(artifact, chartRepo.Path, WithDigestAlgorithm(digest.Algorithm(obj.Spec.DigestAlgorithm))); err != nil {
 		e := &serror.Event{
 			Err:    fmt.Errorf("unable to save artifact to storage: %w", err),
-			Reason: sourcev1.ArchiveOperationFailedReason,
+			Reason: storageFailedReason(err),
 		}
 		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
 		return sreconcile.ResultEmpty, e
 	}
 
+	// Evict the index of the previous Artifact from the cache, as it is
+	// no longer referenced by the HelmCharts of the repository.
+	if prev := obj.GetArtifact(); r.Cache != nil && prev != nil && prev.Path != artifact.Path {
+		r.Cache.Delete(prev.Path)
+	}
+
 	// Record it on the object.
 	obj.Status.Artifact = artifact.DeepCopy()
+	setIndexValidators(obj, chartRepo)
+
+	// Save the raw index next to the artifact, or remove any stale one.
+	rawArtifact := r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), artifact.Revision, rawIndexFileName)
+	if r.KeepRawIndex && chartRepo.RawPath != "" {
+		if err = r.Storage.CopyFromPath(&rawArtifact, chartRepo.RawPath); err != nil {
+			r.eventLogf(ctx, obj, eventv1.EventTypeTrace, sourcev1.ArchiveOperationFailedReason,
+				"failed to save raw index to storage: %s", err)
+		} else {
+			obj.Status.RawIndexURL = rawArtifact.URL
+		}
+	} else if obj.Status.RawIndexURL != "" {
+		if err = os.Remove(r.Storage.LocalPath(rawArtifact)); err != nil && !os.IsNotExist(err) {
+			r.eventLogf(ctx, obj, eventv1.EventTypeTrace, "GarbageCollectionFailed",
+				"failed to remove raw index from storage: %s", err)
+		}
+		obj.Status.RawIndexURL = ""
+	}
 
 	// Cache the index if it was successfully retrieved.
 	if r.Cache != nil && chartRepo.Index != nil {
@@ -614,6 +956,16 @@ func (r *HelmRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pa
 	return sreconcile.ResultSuccess, nil
 }
 
+// setIndexValidators records the validators of the index of the given chart
+// repository on the object, to make a conditional request for the index of
+// its Artifact on the next reconciliation.
+func setIndexValidators(obj *helmv1.HelmRepository, chartRepo *repository.ChartRepository) {
+	obj.Status.IndexETag, obj.Status.IndexLastModified = "", ""
+	if v := chartRepo.Validators; v != nil {
+		obj.Status.IndexETag, obj.Status.IndexLastModified = v.ETag, v.LastModified
+	}
+}
+
 // reconcileDelete handles the deletion of the object.
 // It first garbage collects all Artifacts for the object from the Storage.
 // Removing the finalizer from the object if successful.
@@ -641,7 +993,7 @@ func (r *HelmRepositoryReconciler) reconcileDelete(ctx context.Context, obj *hel
 // Which will result in the removal of all Artifacts for the objects.
 func (r *HelmRepositoryReconciler) garbageCollect(ctx context.Context, obj *helmv1.HelmRepository) error {
 	if !obj.DeletionTimestamp.IsZero() || (obj.Spec.Type != "" && obj.Spec.Type != helmv1.HelmRepositoryTypeDefault) {
-		if deleted, err := r.Storage.RemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
+		if deleted, err := r.Storage.DeferRemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
 			return &serror.Event{
 				Err:    fmt.Errorf("garbage collection for deleted resource failed: %w", err),
 				Reason: "GarbageCollectionFailed",
@@ -650,15 +1002,20 @@ func (r *HelmRepositoryReconciler) garbageCollect(ctx context.Context, obj *helm
 			r.eventLogf(ctx, obj, eventv1.EventTypeTrace, "GarbageCollectionSucceeded",
 				"garbage collected artifacts for deleted resource")
 		}
+		// Evict the index from the cache.
+		if artifact := obj.GetArtifact(); r.Cache != nil && artifact != nil {
+			r.Cache.Delete(artifact.Path)
+		}
 		// Clean status sub-resource
 		obj.Status.Artifact = nil
 		obj.Status.URL = ""
+		obj.Status.RawIndexURL = ""
 		// Remove any stale conditions.
 		obj.Status.Conditions = nil
 		return nil
 	}
 	if obj.GetArtifact() != nil {
-		delFiles, err := r.Storage.GarbageCollect(ctx, *obj.GetArtifact(), time.Second*5)
+		delFiles, err := r.Storage.GarbageCollect(ctx, *obj.GetArtifact(), obj.Spec.GC, time.Second*5)
 		if err != nil {
 			return &serror.Event{
 				Err:    fmt.Errorf("garbage collection of artifacts failed: %w", err),
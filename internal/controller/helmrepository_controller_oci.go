@@ -51,10 +51,16 @@ import (
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	helmv1 "github.com/fluxcd/source-controller/api/v1beta2"
+	"github.com/fluxcd/source-controller/internal/connlimit"
+	"github.com/fluxcd/source-controller/internal/features"
 	"github.com/fluxcd/source-controller/internal/helm/registry"
 	"github.com/fluxcd/source-controller/internal/helm/repository"
+	"github.com/fluxcd/source-controller/internal/latency"
 	"github.com/fluxcd/source-controller/internal/object"
 	intpredicates "github.com/fluxcd/source-controller/internal/predicates"
+	"github.com/fluxcd/source-controller/internal/sourcemetrics"
+	"github.com/fluxcd/source-controller/internal/tracing"
+	"github.com/fluxcd/source-controller/internal/util"
 )
 
 var helmRepositoryOCIOwnedConditions = []string{
@@ -82,6 +88,23 @@ type HelmRepositoryOCIReconciler struct {
 	ControllerName          string
 	RegistryClientGenerator RegistryClientGeneratorFunc
 
+	// LatencyRecorder records the sliding-window reconcile latency
+	// percentiles.
+	LatencyRecorder *latency.Recorder
+
+	// SourceMetrics records the reconcile duration, Artifact size and
+	// fetch failure metrics.
+	SourceMetrics *sourcemetrics.Recorder
+
+	// ConnectionLimiter bounds the number of concurrent outbound network
+	// operations across all reconcilers.
+	ConnectionLimiter *connlimit.Limiter
+
+	// AllowedSchemes is the list of URL schemes sources are allowed to use.
+	// Any scheme is allowed when empty.
+	AllowedSchemes []string
+
+	features     map[string]bool
 	patchOptions []patch.Option
 
 	// unmanagedConditions are the conditions that are not managed by this
@@ -104,6 +127,10 @@ func (r *HelmRepositoryOCIReconciler) SetupWithManagerAndOptions(mgr ctrl.Manage
 	r.unmanagedConditions = conditionsDiff(helmRepositoryReadyCondition.Owned, helmRepositoryOCIOwnedConditions)
 	r.patchOptions = getPatchOptions(helmRepositoryOCIOwnedConditions, r.ControllerName)
 
+	if r.features == nil {
+		r.features = features.FeatureGates()
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&helmv1.HelmRepository{}).
 		WithEventFilter(
@@ -123,6 +150,11 @@ func (r *HelmRepositoryOCIReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	start := time.Now()
 	log := ctrl.LoggerFrom(ctx)
 
+	ctx, span := tracing.StartReconcile(ctx, helmv1.HelmRepositoryKind, req.Namespace, req.Name)
+	defer func() {
+		tracing.End(span, retErr)
+	}()
+
 	// Fetch the HelmRepository
 	obj := &helmv1.HelmRepository{}
 	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
@@ -173,6 +205,8 @@ func (r *HelmRepositoryOCIReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		// Always record readiness and duration metrics
 		r.Metrics.RecordReadiness(ctx, obj)
 		r.Metrics.RecordDuration(ctx, obj, start)
+		r.LatencyRecorder.Observe(helmv1.HelmRepositoryKind, time.Since(start))
+		r.SourceMetrics.Record(helmv1.HelmRepositoryKind, obj, time.Since(start), retErr)
 	}()
 
 	// Add finalizer first if it doesn't exist to avoid the race condition
@@ -212,7 +246,7 @@ func (r *HelmRepositoryOCIReconciler) Reconcile(ctx context.Context, req ctrl.Re
 // block at the very end to summarize the conditions to be in a consistent
 // state.
 func (r *HelmRepositoryOCIReconciler) reconcile(ctx context.Context, sp *patch.SerialPatcher, obj *helmv1.HelmRepository) (result ctrl.Result, retErr error) {
-	ctxTimeout, cancel := context.WithTimeout(ctx, obj.Spec.Timeout.Duration)
+	ctxTimeout, cancel := context.WithTimeout(ctx, obj.GetTimeout())
 	defer cancel()
 
 	oldObj := obj.DeepCopy()
@@ -303,8 +337,25 @@ func (r *HelmRepositoryOCIReconciler) reconcile(ctx context.Context, sp *patch.S
 		result, retErr = ctrl.Result{}, nil
 		return
 	}
+	if err := util.ValidateURLScheme(obj.Spec.URL, r.AllowedSchemes); err != nil {
+		err = fmt.Errorf("invalid URL '%s': %w", util.RedactURL(obj.Spec.URL), err)
+		conditions.MarkStalled(obj, sourcev1.URLSchemeNotAllowedReason, err.Error())
+		conditions.MarkFalse(obj, meta.ReadyCondition, sourcev1.URLSchemeNotAllowedReason, err.Error())
+		ctrl.LoggerFrom(ctx).Error(err, "reconciliation stalled")
+		result, retErr = ctrl.Result{}, nil
+		return
+	}
 	conditions.Delete(obj, meta.StalledCondition)
 
+	// Validate the referenced secrets before any network operation
+	if r.features[features.PreflightSecrets] {
+		if e := preflightSecrets(ctx, r.Client, obj.GetNamespace(), helmRepositorySecretReferences(obj)...); e != nil {
+			conditions.MarkFalse(obj, meta.ReadyCondition, e.Reason, e.Err.Error())
+			result, retErr = ctrl.Result{}, e
+			return
+		}
+	}
+
 	var (
 		authenticator authn.Authenticator
 		keychain      authn.Keychain
@@ -355,7 +406,8 @@ func (r *HelmRepositoryOCIReconciler) reconcile(ctx context.Context, sp *patch.S
 		}()
 	}
 
-	chartRepo, err := repository.NewOCIChartRepository(obj.Spec.URL, repository.WithOCIRegistryClient(registryClient))
+	chartRepo, err := repository.NewOCIChartRepository(obj.Spec.URL, repository.WithOCIRegistryClient(registryClient),
+		repository.WithOCIConnectionLimiter(r.ConnectionLimiter))
 	if err != nil {
 		e := fmt.Errorf("failed to parse URL '%s': %w", obj.Spec.URL, err)
 		conditions.MarkStalled(obj, sourcev1.URLInvalidReason, e.Error())
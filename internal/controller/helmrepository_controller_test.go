@@ -19,12 +19,16 @@ package controller
 import (
 	"context"
 	"crypto/tls"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -36,6 +40,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
 	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -51,10 +56,13 @@ import (
 	helmv1 "github.com/fluxcd/source-controller/api/v1beta2"
 	"github.com/fluxcd/source-controller/internal/cache"
 	intdigest "github.com/fluxcd/source-controller/internal/digest"
+	"github.com/fluxcd/source-controller/internal/helm"
 	"github.com/fluxcd/source-controller/internal/helm/getter"
 	"github.com/fluxcd/source-controller/internal/helm/repository"
+	"github.com/fluxcd/source-controller/internal/mirror"
 	sreconcile "github.com/fluxcd/source-controller/internal/reconcile"
 	"github.com/fluxcd/source-controller/internal/reconcile/summarize"
+	"github.com/fluxcd/source-controller/internal/transport"
 )
 
 func TestHelmRepositoryReconciler_Reconcile(t *testing.T) {
@@ -779,10 +787,1256 @@ func TestHelmRepositoryReconciler_reconcileSource(t *testing.T) {
 	}
 }
 
+func TestHelmRepositoryReconciler_reconcileSource_maxIndexSize(t *testing.T) {
+	tests := []struct {
+		name             string
+		limit            int64
+		wantErr          bool
+		assertConditions []metav1.Condition
+	}{
+		{
+			name:  "index within limit makes ArtifactOutdated=True",
+			limit: helm.MaxIndexSize,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new index revision"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new index revision"),
+			},
+		},
+		{
+			name:    "index exceeding limit makes FetchFailed=True",
+			limit:   10,
+			wantErr: true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.IndexTooLargeReason, "index exceeds the maximum index file size of 10 bytes"),
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			defaultLimit := helm.MaxIndexSize
+			helm.MaxIndexSize = tt.limit
+			defer func() {
+				helm.MaxIndexSize = defaultLimit
+			}()
+
+			server, err := helmtestserver.NewTempHelmServer()
+			g.Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(server.Root())
+
+			g.Expect(server.PackageChart("testdata/charts/helmchart")).To(Succeed())
+			g.Expect(server.GenerateIndex()).To(Succeed())
+			server.Start()
+			defer server.Stop()
+
+			obj := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "max-index-size-",
+					Generation:   1,
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:      server.URL(),
+					Interval: metav1.Duration{Duration: interval},
+					Timeout:  &metav1.Duration{Duration: timeout},
+				},
+			}
+			if tt.wantErr {
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, "foo", "bar")
+			}
+
+			r := &HelmRepositoryReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).Build(),
+				Storage:       testStorage,
+				Getters:       testGetters,
+				patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+			}
+
+			g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+			defer func() {
+				g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+			}()
+
+			var chartRepo repository.ChartRepository
+			var artifact sourcev1.Artifact
+			sp := patch.NewSerialPatcher(obj, r.Client)
+
+			_, err = r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+			defer os.Remove(chartRepo.Path)
+
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			g.Expect(obj.Status.Conditions).To(conditions.MatchConditions(tt.assertConditions))
+		})
+	}
+}
+
+func TestHelmRepositoryReconciler_reconcileSource_tlsServerName(t *testing.T) {
+	g := NewWithT(t)
+
+	var serverName atomic.Value
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("apiVersion: v1\nentries: {}\n"))
+	}))
+	server.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName.Store(hello.ServerName)
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	// The certificate of the test server is valid for example.com, while the
+	// server is dialed by IP address.
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "tls-server-name",
+		},
+		Data: map[string][]byte{
+			"caFile": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+		},
+	}
+	obj := &helmv1.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "tls-server-name-",
+			Generation:   1,
+		},
+		Spec: helmv1.HelmRepositorySpec{
+			URL:           server.URL,
+			Interval:      metav1.Duration{Duration: interval},
+			Timeout:       &metav1.Duration{Duration: timeout},
+			SecretRef:     &meta.LocalObjectReference{Name: secret.Name},
+			TLSServerName: "example.com",
+		},
+	}
+
+	r := &HelmRepositoryReconciler{
+		EventRecorder: record.NewFakeRecorder(32),
+		Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).WithObjects(secret).Build(),
+		Storage:       testStorage,
+		Getters:       testGetters,
+		patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+	}
+
+	g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+	defer func() {
+		g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+	}()
+
+	var chartRepo repository.ChartRepository
+	var artifact sourcev1.Artifact
+	sp := patch.NewSerialPatcher(obj, r.Client)
+
+	got, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+	defer os.Remove(chartRepo.Path)
+
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(got).To(Equal(sreconcile.ResultSuccess))
+	g.Expect(serverName.Load()).To(Equal("example.com"))
+}
+
+func TestHelmRepositoryReconciler_reconcileSource_insecure(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("apiVersion: v1\nentries: {}\n"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		insecure         bool
+		secretData       map[string][]byte
+		wantErr          bool
+		wantEvent        string
+		assertConditions []metav1.Condition
+	}{
+		{
+			name:     "insecure skips verification of the certificate",
+			insecure: true,
+			wantEvent: fmt.Sprintf("Warning %s TLS certificate verification is disabled for Helm repository URL '%s'",
+				helmv1.InsecureSkipVerifyReason, server.URL),
+		},
+		{
+			name:    "certificate is verified by default",
+			wantErr: true,
+		},
+		{
+			name:     "insecure with caFile",
+			insecure: true,
+			secretData: map[string][]byte{
+				"caFile": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+			},
+			wantErr: true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, helmv1.InvalidTLSConfigReason,
+					"'insecure' is mutually exclusive with the 'caFile' of secret 'insecure'"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clientBuilder := fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme())
+			obj := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "insecure-",
+					Generation:   1,
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:      server.URL,
+					Interval: metav1.Duration{Duration: interval},
+					Timeout:  &metav1.Duration{Duration: timeout},
+					Insecure: tt.insecure,
+				},
+			}
+			if tt.secretData != nil {
+				clientBuilder.WithObjects(&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "insecure",
+					},
+					Data: tt.secretData,
+				})
+				obj.Spec.SecretRef = &meta.LocalObjectReference{Name: "insecure"}
+			}
+
+			recorder := record.NewFakeRecorder(32)
+			r := &HelmRepositoryReconciler{
+				EventRecorder: recorder,
+				Client:        clientBuilder.Build(),
+				Storage:       testStorage,
+				Getters:       testGetters,
+				patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+			}
+
+			g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+			defer func() {
+				g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+			}()
+
+			var chartRepo repository.ChartRepository
+			var artifact sourcev1.Artifact
+			sp := patch.NewSerialPatcher(obj, r.Client)
+
+			_, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+			defer os.Remove(chartRepo.Path)
+
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			if tt.assertConditions != nil {
+				g.Expect(obj.Status.Conditions).To(conditions.MatchConditions(tt.assertConditions))
+			}
+			if tt.wantEvent != "" {
+				g.Expect(recorder.Events).To(Receive(Equal(tt.wantEvent)))
+			} else {
+				g.Expect(recorder.Events).ToNot(Receive(ContainSubstring(helmv1.InsecureSkipVerifyReason)))
+			}
+		})
+	}
+}
+
+func TestHelmRepositoryReconciler_reconcileSource_clientCertificate(t *testing.T) {
+	server, rootCertPEM, clientCertPEM, clientKeyPEM, _, err := createTLSServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("apiVersion: v1\nentries: {}\n"))
+	})
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		secretData       map[string][]byte
+		wantErr          bool
+		assertConditions []metav1.Condition
+	}{
+		{
+			name: "client certificate is presented",
+			secretData: map[string][]byte{
+				"certFile": clientCertPEM,
+				"keyFile":  clientKeyPEM,
+				"caFile":   rootCertPEM,
+			},
+		},
+		{
+			name: "without client certificate",
+			secretData: map[string][]byte{
+				"caFile": rootCertPEM,
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed keyFile",
+			secretData: map[string][]byte{
+				"certFile": clientCertPEM,
+				"keyFile":  []byte("invalid"),
+				"caFile":   rootCertPEM,
+			},
+			wantErr: true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.AuthenticationFailedReason,
+					"failed to create TLS client config with secret data: invalid 'client-cert' secret data: field 'keyFile' does not contain a PEM encoded private key"),
+			},
+		},
+		{
+			name: "mismatching certFile",
+			secretData: map[string][]byte{
+				"certFile": rootCertPEM,
+				"keyFile":  clientKeyPEM,
+				"caFile":   rootCertPEM,
+			},
+			wantErr: true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, sourcev1.AuthenticationFailedReason,
+					"failed to create TLS client config with secret data: invalid 'client-cert' secret data: fields 'certFile' and 'keyFile' do not form a valid key pair"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "client-cert",
+				},
+				Data: tt.secretData,
+			}
+			obj := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "client-cert-",
+					Generation:   1,
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:       server.URL,
+					Interval:  metav1.Duration{Duration: interval},
+					Timeout:   &metav1.Duration{Duration: timeout},
+					SecretRef: &meta.LocalObjectReference{Name: secret.Name},
+				},
+			}
+
+			r := &HelmRepositoryReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).WithObjects(secret).Build(),
+				Storage:       testStorage,
+				Getters:       testGetters,
+				patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+			}
+
+			g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+			defer func() {
+				g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+			}()
+
+			var chartRepo repository.ChartRepository
+			var artifact sourcev1.Artifact
+			sp := patch.NewSerialPatcher(obj, r.Client)
+
+			_, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+			defer os.Remove(chartRepo.Path)
+
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			if tt.assertConditions != nil {
+				g.Expect(obj.Status.Conditions).To(conditions.MatchConditions(tt.assertConditions))
+			}
+		})
+	}
+}
+
+func TestHelmRepositoryReconciler_reconcileSource_notModified(t *testing.T) {
+	// gets counts the requests which are answered with the index.
+	var gets int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("If-None-Match") != `"v1"` {
+			atomic.AddInt32(&gets, 1)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "index.yaml", time.Time{}, strings.NewReader("apiVersion: v1\nentries: {}\n"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		beforeFunc       func(obj *helmv1.HelmRepository)
+		wantGets         int32
+		wantKeptArtifact bool
+	}{
+		{
+			name: "keeps artifact of index which is not modified",
+			beforeFunc: func(obj *helmv1.HelmRepository) {
+				obj.Status.IndexETag = `"v1"`
+			},
+			wantKeptArtifact: true,
+		},
+		{
+			name: "downloads modified index",
+			beforeFunc: func(obj *helmv1.HelmRepository) {
+				obj.Status.IndexETag = `"v0"`
+			},
+			wantGets: 1,
+		},
+		{
+			name:     "downloads index without validators",
+			wantGets: 1,
+		},
+		{
+			name: "downloads index of new generation",
+			beforeFunc: func(obj *helmv1.HelmRepository) {
+				obj.Status.IndexETag = `"v1"`
+				obj.Generation = 2
+			},
+			wantGets: 1,
+		},
+		{
+			name: "downloads index with mirrors",
+			beforeFunc: func(obj *helmv1.HelmRepository) {
+				obj.Status.IndexETag = `"v1"`
+				obj.Spec.Mirrors = []string{server.URL}
+			},
+			wantGets: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			atomic.StoreInt32(&gets, 0)
+
+			obj := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "not-modified-",
+					Generation:   1,
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:      server.URL,
+					Interval: metav1.Duration{Duration: interval},
+					Timeout:  &metav1.Duration{Duration: timeout},
+				},
+				Status: helmv1.HelmRepositoryStatus{
+					ObservedGeneration: 1,
+					Artifact: &sourcev1.Artifact{
+						Path:     "/some/path",
+						Revision: "sha256:1234",
+						Digest:   "sha256:1234",
+					},
+				},
+			}
+			if tt.beforeFunc != nil {
+				tt.beforeFunc(obj)
+			}
+
+			r := &HelmRepositoryReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).Build(),
+				Storage:       testStorage,
+				Getters:       testGetters,
+				patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+				mirrorHealth:  mirror.NewTracker(),
+			}
+
+			g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+			defer func() {
+				g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+			}()
+
+			var chartRepo repository.ChartRepository
+			var artifact sourcev1.Artifact
+			sp := patch.NewSerialPatcher(obj, r.Client)
+
+			got, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+			defer chartRepo.Clear()
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(sreconcile.ResultSuccess))
+			g.Expect(atomic.LoadInt32(&gets)).To(Equal(tt.wantGets))
+			g.Expect(artifact.Revision == obj.Status.Artifact.Revision).To(Equal(tt.wantKeptArtifact))
+			if !tt.wantKeptArtifact && len(obj.Spec.Mirrors) == 0 {
+				g.Expect(chartRepo.Validators).To(Equal(&repository.IndexValidators{ETag: `"v1"`}))
+			}
+		})
+	}
+}
+
+func TestHelmRepositoryReconciler_reconcileSource_tooManyRedirects(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(transport.SetMaxRedirects(2)).To(Succeed())
+	defer func() {
+		_ = transport.SetMaxRedirects(transport.DefaultMaxRedirects)
+	}()
+
+	// The server redirects every request to itself.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.String(), http.StatusFound)
+	}))
+	defer server.Close()
+
+	obj := &helmv1.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "too-many-redirects-",
+			Generation:   1,
+		},
+		Spec: helmv1.HelmRepositorySpec{
+			URL:      server.URL,
+			Interval: metav1.Duration{Duration: interval},
+			Timeout:  &metav1.Duration{Duration: timeout},
+		},
+	}
+
+	r := &HelmRepositoryReconciler{
+		EventRecorder: record.NewFakeRecorder(32),
+		Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).Build(),
+		Storage:       testStorage,
+		Getters:       testGetters,
+		patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+	}
+
+	var chartRepo repository.ChartRepository
+	var artifact sourcev1.Artifact
+	sp := patch.NewSerialPatcher(obj, r.Client)
+
+	got, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(got).To(Equal(sreconcile.ResultEmpty))
+	g.Expect(conditions.GetReason(obj, sourcev1.FetchFailedCondition)).To(Equal(sourcev1.TooManyRedirectsReason))
+	g.Expect(conditions.GetMessage(obj, sourcev1.FetchFailedCondition)).To(ContainSubstring("stopped after 2 redirects"))
+}
+
+func TestHelmRepositoryReconciler_passthroughIndex(t *testing.T) {
+	// The index is deliberately not in the format the controller would
+	// produce when normalizing it.
+	index := `# Published by the upstream repository.
+generated: "2023-01-01T00:00:00Z"
+entries:
+  podinfo:
+  - version: 6.0.0
+    name: podinfo
+    urls: [podinfo-6.0.0.tgz]
+    apiVersion: v2
+apiVersion: v1
+`
+	paginated := "apiVersion: v1\nannotations:\n  " + repository.NextIndexPageAnnotation + ": 2.yaml\nentries: {}\n"
+
+	tests := []struct {
+		name       string
+		index      string
+		wantReason string
+	}{
+		{
+			name:  "stores index as downloaded",
+			index: index,
+		},
+		{
+			name:       "rejects paginated index",
+			index:      paginated,
+			wantReason: helmv1.IndexationFailedReason,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(tt.index))
+			}))
+			defer server.Close()
+
+			obj := &helmv1.HelmRepository{
+				TypeMeta: metav1.TypeMeta{
+					Kind: helmv1.HelmRepositoryKind,
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "passthrough-index",
+					Namespace:  "default",
+					Generation: 1,
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:      server.URL,
+					Interval: metav1.Duration{Duration: interval},
+					Timeout:  &metav1.Duration{Duration: timeout},
+				},
+			}
+
+			r := &HelmRepositoryReconciler{
+				EventRecorder:    record.NewFakeRecorder(32),
+				Client:           fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).WithObjects(obj).Build(),
+				Storage:          testStorage,
+				Getters:          testGetters,
+				PassthroughIndex: true,
+				patchOptions:     getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+			}
+
+			var chartRepo repository.ChartRepository
+			var artifact sourcev1.Artifact
+			sp := patch.NewSerialPatcher(obj, r.Client)
+
+			got, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+			if tt.wantReason != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(got).To(Equal(sreconcile.ResultEmpty))
+				g.Expect(conditions.GetReason(obj, sourcev1.FetchFailedCondition)).To(Equal(tt.wantReason))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(sreconcile.ResultSuccess))
+
+			got, err = r.reconcileArtifact(context.TODO(), sp, obj, &artifact, &chartRepo)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(sreconcile.ResultSuccess))
+
+			b, err := os.ReadFile(testStorage.LocalPath(*obj.GetArtifact()))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(b)).To(Equal(tt.index))
+			g.Expect(obj.GetArtifact().Digest).To(Equal(digest.FromString(tt.index).String()))
+		})
+	}
+}
+
+func TestHelmRepositoryReconciler_reconcileSource_credentialsInURL(t *testing.T) {
+	tests := []struct {
+		name             string
+		password         string
+		want             sreconcile.Result
+		wantErr          bool
+		assertConditions []metav1.Condition
+	}{
+		{
+			name:     "valid credentials in URL makes ArtifactOutdated=True",
+			password: "1234",
+			want:     sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new index revision"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new index revision"),
+			},
+		},
+		{
+			name:     "invalid credentials in URL makes FetchFailed=True",
+			password: "invalid",
+			wantErr:  true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.FetchFailedCondition, meta.FailedReason, "failed to fetch Helm repository index"),
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "foo"),
+				*conditions.UnknownCondition(meta.ReadyCondition, "foo", "bar"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			server, err := helmtestserver.NewTempHelmServer()
+			g.Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(server.Root())
+
+			g.Expect(server.PackageChart("testdata/charts/helmchart")).To(Succeed())
+			g.Expect(server.GenerateIndex()).To(Succeed())
+
+			server.WithMiddleware(func(handler http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					u, p, ok := r.BasicAuth()
+					if !ok || u != "git" || p != "1234" {
+						w.WriteHeader(401)
+						return
+					}
+					handler.ServeHTTP(w, r)
+				})
+			})
+			server.Start()
+			defer server.Stop()
+
+			u, err := url.Parse(server.URL())
+			g.Expect(err).NotTo(HaveOccurred())
+			u.User = url.UserPassword("git", tt.password)
+
+			obj := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "credentials-in-url-",
+					Generation:   1,
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:      u.String(),
+					Interval: metav1.Duration{Duration: interval},
+					Timeout:  &metav1.Duration{Duration: timeout},
+				},
+			}
+			if tt.wantErr {
+				conditions.MarkReconciling(obj, meta.ProgressingReason, "foo")
+				conditions.MarkUnknown(obj, meta.ReadyCondition, "foo", "bar")
+			}
+
+			r := &HelmRepositoryReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).Build(),
+				Storage:       testStorage,
+				Getters:       testGetters,
+				patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+			}
+
+			g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+			defer func() {
+				g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+			}()
+
+			var chartRepo repository.ChartRepository
+			var artifact sourcev1.Artifact
+			sp := patch.NewSerialPatcher(obj, r.Client)
+
+			got, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+			defer os.Remove(chartRepo.Path)
+
+			g.Expect(obj.Status.Conditions).To(conditions.MatchConditions(tt.assertConditions))
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			g.Expect(got).To(Equal(tt.want))
+
+			// The credentials must not be exposed through the chart
+			// repository or the status of the object.
+			g.Expect(chartRepo.URL).ToNot(ContainSubstring(tt.password))
+			for _, c := range obj.Status.Conditions {
+				g.Expect(c.Message).ToNot(ContainSubstring(tt.password))
+			}
+			if !tt.wantErr {
+				g.Expect(chartRepo.URL).To(Equal(server.URL()))
+				g.Expect(chartRepo.Index).ToNot(BeNil())
+			}
+		})
+	}
+}
+
+func TestHelmRepositoryReconciler_reconcileSource_indexAPIVersion(t *testing.T) {
+	entries := `entries:
+  helmchart:
+    - urls:
+        - helmchart-0.1.0.tgz
+      name: helmchart
+      version: 0.1.0
+      digest: 1234567890abcdef
+`
+
+	tests := []struct {
+		name             string
+		index            string
+		beforeFunc       func(obj *helmv1.HelmRepository)
+		assertConditions []metav1.Condition
+	}{
+		{
+			name:  "v1 index",
+			index: "apiVersion: v1\n" + entries,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new index revision"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new index revision"),
+			},
+		},
+		{
+			name:  "index without API version",
+			index: entries,
+			beforeFunc: func(obj *helmv1.HelmRepository) {
+				conditions.MarkTrue(obj, helmv1.IndexCompatibilityWarningCondition, helmv1.UnknownIndexAPIVersionReason, "foo")
+			},
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new index revision"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new index revision"),
+			},
+		},
+		{
+			name:  "index with unknown API version",
+			index: "apiVersion: v2\n" + entries + "      futureField: value\n",
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(helmv1.IndexCompatibilityWarningCondition, helmv1.UnknownIndexAPIVersionReason, "index has unrecognized API version 'v2'"),
+				*conditions.TrueCondition(meta.ReconcilingCondition, meta.ProgressingReason, "building artifact: new index revision"),
+				*conditions.UnknownCondition(meta.ReadyCondition, meta.ProgressingReason, "building artifact: new index revision"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			server, err := helmtestserver.NewTempHelmServer()
+			g.Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(server.Root())
+
+			g.Expect(os.WriteFile(filepath.Join(server.Root(), "index.yaml"), []byte(tt.index), 0o600)).To(Succeed())
+			server.Start()
+			defer server.Stop()
+
+			obj := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "index-api-version-",
+					Generation:   1,
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:      server.URL(),
+					Interval: metav1.Duration{Duration: interval},
+					Timeout:  &metav1.Duration{Duration: timeout},
+				},
+			}
+			if tt.beforeFunc != nil {
+				tt.beforeFunc(obj)
+			}
+
+			r := &HelmRepositoryReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).Build(),
+				Storage:       testStorage,
+				Getters:       testGetters,
+				patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+			}
+
+			g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+			defer func() {
+				g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+			}()
+
+			var chartRepo repository.ChartRepository
+			var artifact sourcev1.Artifact
+			sp := patch.NewSerialPatcher(obj, r.Client)
+
+			got, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+			defer os.Remove(chartRepo.Path)
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(sreconcile.ResultSuccess))
+			g.Expect(obj.Status.Conditions).To(conditions.MatchConditions(tt.assertConditions))
+			g.Expect(chartRepo.Index.Entries).To(HaveKey("helmchart"))
+		})
+	}
+}
+
+func TestHelmRepositoryReconciler_reconcileSource_fileURL(t *testing.T) {
+	index := `apiVersion: v1
+entries:
+  helmchart:
+    - urls:
+        - helmchart-0.1.0.tgz
+      name: helmchart
+      version: 0.1.0
+      digest: 1234567890abcdef
+`
+
+	tests := []struct {
+		name      string
+		enabled   bool
+		wantErr   bool
+		wantEntry bool
+	}{
+		{
+			name:      "reads index from file repository root",
+			enabled:   true,
+			wantEntry: true,
+		},
+		{
+			name:    "file URLs are unsupported without file repository root",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			root := t.TempDir()
+			repoDir := filepath.Join(root, "repo")
+			g.Expect(os.MkdirAll(repoDir, 0o700)).To(Succeed())
+			g.Expect(os.WriteFile(filepath.Join(repoDir, "index.yaml"), []byte(index), 0o600)).To(Succeed())
+
+			obj := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "file-url-",
+					Generation:   1,
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:      "file://" + filepath.ToSlash(repoDir),
+					Interval: metav1.Duration{Duration: interval},
+					Timeout:  &metav1.Duration{Duration: timeout},
+				},
+			}
+
+			getters := append(helmgetter.Providers{}, testGetters...)
+			if tt.enabled {
+				getters = append(getters, getter.NewFileProvider(root))
+			}
+			r := &HelmRepositoryReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).Build(),
+				Storage:       testStorage,
+				Getters:       getters,
+				patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+			}
+
+			g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+			defer func() {
+				g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+			}()
+
+			var chartRepo repository.ChartRepository
+			var artifact sourcev1.Artifact
+			sp := patch.NewSerialPatcher(obj, r.Client)
+
+			got, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+			defer os.Remove(chartRepo.Path)
+
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(conditions.IsTrue(obj, sourcev1.FetchFailedCondition)).To(BeTrue())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(sreconcile.ResultSuccess))
+			g.Expect(chartRepo.Index.Entries).To(HaveKey("helmchart"))
+			g.Expect(artifact.Revision).To(Equal(chartRepo.Digest(intdigest.Canonical).String()))
+		})
+	}
+}
+
+func TestHelmRepositoryReconciler_reconcile_revisionStableOnTransientFailure(t *testing.T) {
+	g := NewWithT(t)
+
+	var healthy atomic.Bool
+	healthy.Store(true)
+
+	server, err := helmtestserver.NewTempHelmServer()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(server.Root())
+	g.Expect(server.PackageChartWithVersion("testdata/charts/helmchart", "0.1.0")).To(Succeed())
+	g.Expect(server.GenerateIndex()).To(Succeed())
+	server.WithMiddleware(func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+	})
+	server.Start()
+	defer server.Stop()
+
+	retryInterval := fetchIndexRetryInterval
+	fetchIndexRetryInterval = 10 * time.Millisecond
+	defer func() { fetchIndexRetryInterval = retryInterval }()
+
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	obj := &helmv1.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "transient-failure",
+			Namespace:  "default",
+			Generation: 1,
+		},
+		Spec: helmv1.HelmRepositorySpec{
+			URL:      server.URL(),
+			Interval: metav1.Duration{Duration: interval},
+			Timeout:  &metav1.Duration{Duration: timeout},
+		},
+	}
+
+	r := &HelmRepositoryReconciler{
+		EventRecorder: record.NewFakeRecorder(32),
+		Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).WithObjects(obj).Build(),
+		Storage:       storage,
+		Getters:       testGetters,
+		patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+		mirrorHealth:  mirror.NewTracker(),
+	}
+
+	reconcile := func() error {
+		sp := patch.NewSerialPatcher(obj, r.Client)
+		reconcilers := []helmRepositoryReconcileFunc{r.reconcileStorage, r.reconcileSource, r.reconcileArtifact}
+		_, err := r.reconcile(context.TODO(), sp, obj, reconcilers)
+		return err
+	}
+
+	// The first fetch produces an Artifact.
+	g.Expect(reconcile()).To(Succeed())
+	g.Expect(obj.GetArtifact()).ToNot(BeNil())
+	lastGood := obj.GetArtifact().DeepCopy()
+
+	// While the repository is unavailable, the failure is reflected in the
+	// conditions, and the last good Artifact keeps being advertised.
+	healthy.Store(false)
+	for i := 0; i < 2; i++ {
+		g.Expect(reconcile()).ToNot(Succeed())
+		g.Expect(conditions.IsTrue(obj, sourcev1.FetchFailedCondition)).To(BeTrue())
+		g.Expect(conditions.IsTrue(obj, sourcev1.ArtifactInStorageCondition)).To(BeTrue())
+		g.Expect(obj.GetArtifact()).To(MatchArtifact(lastGood))
+		g.Expect(obj.Status.URL).ToNot(BeEmpty())
+		g.Expect(storage.VerifyArtifact(*obj.GetArtifact())).To(Succeed())
+	}
+
+	// After the recovery, the Artifact is only updated for a new revision.
+	healthy.Store(true)
+	g.Expect(reconcile()).To(Succeed())
+	g.Expect(conditions.Has(obj, sourcev1.FetchFailedCondition)).To(BeFalse())
+	g.Expect(obj.GetArtifact().Revision).To(Equal(lastGood.Revision))
+
+	g.Expect(server.PackageChartWithVersion("testdata/charts/helmchart", "0.2.0")).To(Succeed())
+	g.Expect(server.GenerateIndex()).To(Succeed())
+	g.Expect(reconcile()).To(Succeed())
+	g.Expect(conditions.Has(obj, sourcev1.FetchFailedCondition)).To(BeFalse())
+	g.Expect(obj.GetArtifact().Revision).ToNot(Equal(lastGood.Revision))
+}
+
+func TestHelmRepositoryReconciler_reconcileSource_mirrors(t *testing.T) {
+	g := NewWithT(t)
+
+	newServer := func(healthy *atomic.Bool) *helmtestserver.HelmServer {
+		server, err := helmtestserver.NewTempHelmServer()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(server.PackageChart("testdata/charts/helmchart")).To(Succeed())
+		g.Expect(server.GenerateIndex()).To(Succeed())
+		server.WithMiddleware(func(handler http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !healthy.Load() {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				handler.ServeHTTP(w, r)
+			})
+		})
+		server.Start()
+		return server
+	}
+
+	retryInterval := fetchIndexRetryInterval
+	fetchIndexRetryInterval = 10 * time.Millisecond
+	defer func() { fetchIndexRetryInterval = retryInterval }()
+
+	var primaryHealthy, mirrorHealthy atomic.Bool
+	primaryHealthy.Store(true)
+	mirrorHealthy.Store(true)
+
+	primaryServer := newServer(&primaryHealthy)
+	defer os.RemoveAll(primaryServer.Root())
+	defer primaryServer.Stop()
+	mirrorServer := newServer(&mirrorHealthy)
+	defer os.RemoveAll(mirrorServer.Root())
+	defer mirrorServer.Stop()
+
+	obj := &helmv1.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "mirrors-",
+			Generation:   1,
+		},
+		Spec: helmv1.HelmRepositorySpec{
+			URL:      primaryServer.URL(),
+			Mirrors:  []string{mirrorServer.URL()},
+			Interval: metav1.Duration{Duration: interval},
+			Timeout:  &metav1.Duration{Duration: timeout},
+		},
+	}
+
+	r := &HelmRepositoryReconciler{
+		EventRecorder: record.NewFakeRecorder(32),
+		Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).Build(),
+		Storage:       testStorage,
+		Getters:       testGetters,
+		patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+		mirrorHealth:  mirror.NewTracker(),
+	}
+
+	g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+	defer func() {
+		g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+	}()
+
+	reconcileSource := func() (*repository.ChartRepository, error) {
+		var chartRepo repository.ChartRepository
+		var artifact sourcev1.Artifact
+		sp := patch.NewSerialPatcher(obj, r.Client)
+		_, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+		if chartRepo.Path != "" {
+			os.Remove(chartRepo.Path)
+		}
+		return &chartRepo, err
+	}
+
+	// Observe a high latency for the mirror, so that the URL is preferred
+	// while it is healthy, regardless of the latency of the test servers.
+	r.mirrorHealth.Observe(mirrorServer.URL(), time.Hour, nil)
+
+	// While healthy, the URL is preferred.
+	chartRepo, err := reconcileSource()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(chartRepo.URL).To(Equal(primaryServer.URL()))
+
+	// The URL degrades, and the mirror is failed over to.
+	primaryHealthy.Store(false)
+	chartRepo, err = reconcileSource()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(chartRepo.URL).To(Equal(mirrorServer.URL()))
+	g.Expect(conditions.Has(obj, sourcev1.FetchFailedCondition)).To(BeFalse())
+
+	// The selection has shifted to the mirror, even after the URL recovered.
+	primaryHealthy.Store(true)
+	g.Expect(r.mirrorHealth.Rank([]string{primaryServer.URL(), mirrorServer.URL()})[0]).To(Equal(mirrorServer.URL()))
+	chartRepo, err = reconcileSource()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(chartRepo.URL).To(Equal(mirrorServer.URL()))
+
+	// The mirror degrades, and the URL is failed over to.
+	mirrorHealthy.Store(false)
+	chartRepo, err = reconcileSource()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(chartRepo.URL).To(Equal(primaryServer.URL()))
+
+	// When all of them fail, the failure is recorded.
+	primaryHealthy.Store(false)
+	_, err = reconcileSource()
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(conditions.IsTrue(obj, sourcev1.FetchFailedCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(obj, sourcev1.FetchFailedCondition)).To(Equal(meta.FailedReason))
+}
+
+func TestHelmRepositoryReconciler_reconcileSource_fetchRetries(t *testing.T) {
+	g := NewWithT(t)
+
+	server, err := helmtestserver.NewTempHelmServer()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(server.Root())
+	g.Expect(server.PackageChart("testdata/charts/helmchart")).To(Succeed())
+	g.Expect(server.GenerateIndex()).To(Succeed())
+
+	// The server responds with the given statuses in turn, before serving the
+	// index.
+	var (
+		requests int32
+		statuses []int
+	)
+	server.WithMiddleware(func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Only count the downloads of the index, not the conditional
+			// requests for it.
+			if r.Method != http.MethodGet {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			if n := int(atomic.AddInt32(&requests, 1)); n <= len(statuses) {
+				w.WriteHeader(statuses[n-1])
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+	})
+	server.Start()
+	defer server.Stop()
+
+	retryInterval := fetchIndexRetryInterval
+	fetchIndexRetryInterval = 10 * time.Millisecond
+	defer func() { fetchIndexRetryInterval = retryInterval }()
+
+	tests := []struct {
+		name         string
+		retries      *int32
+		statuses     []int
+		wantErr      string
+		wantRequests int32
+	}{
+		{
+			name:         "succeeds without retries",
+			wantRequests: 1,
+		},
+		{
+			name:         "succeeds after transient errors",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway},
+			wantRequests: 3,
+		},
+		{
+			name:         "fails after exhausting the retries",
+			retries:      pointer.Int32(1),
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			wantErr:      "failed to fetch Helm repository index after 2 attempts",
+			wantRequests: 2,
+		},
+		{
+			name:         "does not retry when retries are disabled",
+			retries:      pointer.Int32(0),
+			statuses:     []int{http.StatusServiceUnavailable},
+			wantErr:      "failed to fetch Helm repository index: failed to cache index to temporary file: failed to fetch " + server.URL() + "/index.yaml : 503 Service Unavailable",
+			wantRequests: 1,
+		},
+		{
+			name:         "does not retry permanent errors",
+			statuses:     []int{http.StatusNotFound},
+			wantErr:      "failed to fetch Helm repository index: failed to cache index to temporary file: failed to fetch " + server.URL() + "/index.yaml : 404 Not Found",
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			atomic.StoreInt32(&requests, 0)
+			statuses = tt.statuses
+
+			obj := &helmv1.HelmRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "fetch-retries-",
+					Generation:   1,
+				},
+				Spec: helmv1.HelmRepositorySpec{
+					URL:          server.URL(),
+					Interval:     metav1.Duration{Duration: interval},
+					Timeout:      &metav1.Duration{Duration: timeout},
+					FetchRetries: tt.retries,
+				},
+			}
+
+			r := &HelmRepositoryReconciler{
+				EventRecorder: record.NewFakeRecorder(32),
+				Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).Build(),
+				Storage:       testStorage,
+				Getters:       testGetters,
+				patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+				mirrorHealth:  mirror.NewTracker(),
+			}
+
+			g.Expect(r.Client.Create(context.TODO(), obj)).ToNot(HaveOccurred())
+			defer func() {
+				g.Expect(r.Client.Delete(context.TODO(), obj)).ToNot(HaveOccurred())
+			}()
+
+			var chartRepo repository.ChartRepository
+			var artifact sourcev1.Artifact
+			sp := patch.NewSerialPatcher(obj, r.Client)
+			_, err := r.reconcileSource(context.TODO(), sp, obj, &artifact, &chartRepo)
+			defer func() {
+				if chartRepo.Path != "" {
+					os.Remove(chartRepo.Path)
+				}
+			}()
+
+			g.Expect(atomic.LoadInt32(&requests)).To(Equal(tt.wantRequests))
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				g.Expect(conditions.IsTrue(obj, sourcev1.FetchFailedCondition)).To(BeTrue())
+				g.Expect(conditions.GetMessage(obj, sourcev1.FetchFailedCondition)).To(ContainSubstring(tt.wantErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(conditions.Has(obj, sourcev1.FetchFailedCondition)).To(BeFalse())
+		})
+	}
+}
+
 func TestHelmRepositoryReconciler_reconcileArtifact(t *testing.T) {
+	previousCache := cache.New(10, time.Minute)
+
 	tests := []struct {
 		name             string
 		cache            *cache.Cache
+		keepRawIndex     bool
 		beforeFunc       func(t *WithT, obj *helmv1.HelmRepository, artifact sourcev1.Artifact, index *repository.ChartRepository)
 		afterFunc        func(t *WithT, obj *helmv1.HelmRepository, cache *cache.Cache)
 		want             sreconcile.Result
@@ -799,6 +2053,22 @@ func TestHelmRepositoryReconciler_reconcileArtifact(t *testing.T) {
 				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, meta.SucceededReason, "stored artifact: revision 'existing'"),
 			},
 		},
+		{
+			name: "Archiving artifact records the validators of the index",
+			beforeFunc: func(t *WithT, obj *helmv1.HelmRepository, artifact sourcev1.Artifact, index *repository.ChartRepository) {
+				obj.Spec.Interval = metav1.Duration{Duration: interval}
+				obj.Status.IndexLastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+				index.Validators = &repository.IndexValidators{ETag: `"v1"`}
+			},
+			want: sreconcile.ResultSuccess,
+			afterFunc: func(t *WithT, obj *helmv1.HelmRepository, cache *cache.Cache) {
+				t.Expect(obj.Status.IndexETag).To(Equal(`"v1"`))
+				t.Expect(obj.Status.IndexLastModified).To(BeEmpty())
+			},
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, meta.SucceededReason, "stored artifact: revision 'existing'"),
+			},
+		},
 		{
 			name:  "Archiving (loaded) artifact to storage adds to cache",
 			cache: cache.New(10, time.Minute),
@@ -819,6 +2089,32 @@ func TestHelmRepositoryReconciler_reconcileArtifact(t *testing.T) {
 				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, meta.SucceededReason, "stored artifact: revision 'existing'"),
 			},
 		},
+		{
+			name:  "Archiving new artifact evicts previous artifact from cache",
+			cache: previousCache,
+			beforeFunc: func(t *WithT, obj *helmv1.HelmRepository, artifact sourcev1.Artifact, index *repository.ChartRepository) {
+				index.Index = &repo.IndexFile{
+					APIVersion: "v1",
+					Generated:  time.Now(),
+				}
+				obj.Spec.Interval = metav1.Duration{Duration: interval}
+				obj.Status.Artifact = &sourcev1.Artifact{
+					Path:     "helmrepository/default/previous/index-previous.yaml",
+					Revision: "previous",
+				}
+				t.Expect(previousCache.Set(obj.Status.Artifact.Path, &repo.IndexFile{}, time.Minute)).To(Succeed())
+			},
+			want: sreconcile.ResultSuccess,
+			afterFunc: func(t *WithT, obj *helmv1.HelmRepository, cache *cache.Cache) {
+				_, ok := cache.Get("helmrepository/default/previous/index-previous.yaml")
+				t.Expect(ok).To(BeFalse())
+				_, ok = cache.Get(obj.GetArtifact().Path)
+				t.Expect(ok).To(BeTrue())
+			},
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, meta.SucceededReason, "stored artifact: revision 'existing'"),
+			},
+		},
 		{
 			name: "Up-to-date artifact should not update status",
 			beforeFunc: func(t *WithT, obj *helmv1.HelmRepository, artifact sourcev1.Artifact, index *repository.ChartRepository) {
@@ -861,6 +2157,42 @@ func TestHelmRepositoryReconciler_reconcileArtifact(t *testing.T) {
 				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, meta.SucceededReason, "stored artifact: revision 'existing'"),
 			},
 		},
+		{
+			name:         "Stores raw index next to the artifact",
+			keepRawIndex: true,
+			beforeFunc: func(t *WithT, obj *helmv1.HelmRepository, artifact sourcev1.Artifact, index *repository.ChartRepository) {
+				obj.Spec.Interval = metav1.Duration{Duration: interval}
+				index.RawPath = filepath.Join(filepath.Dir(index.Path), "raw.yaml")
+				t.Expect(os.WriteFile(index.RawPath, []byte("apiVersion: v1\n---\napiVersion: v1\n"), 0o640)).To(Succeed())
+			},
+			afterFunc: func(t *WithT, obj *helmv1.HelmRepository, _ *cache.Cache) {
+				t.Expect(obj.Status.RawIndexURL).ToNot(BeEmpty())
+				rawPath := filepath.Join(filepath.Dir(testStorage.LocalPath(*obj.GetArtifact())), rawIndexFileName)
+				b, err := os.ReadFile(rawPath)
+				t.Expect(err).ToNot(HaveOccurred())
+				t.Expect(string(b)).To(Equal("apiVersion: v1\n---\napiVersion: v1\n"))
+			},
+			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, meta.SucceededReason, "stored artifact: revision 'existing'"),
+			},
+		},
+		{
+			name: "Removes raw index when no longer kept",
+			beforeFunc: func(t *WithT, obj *helmv1.HelmRepository, artifact sourcev1.Artifact, index *repository.ChartRepository) {
+				obj.Spec.Interval = metav1.Duration{Duration: interval}
+				obj.Status.RawIndexURL = "http://example.com/" + rawIndexFileName
+			},
+			afterFunc: func(t *WithT, obj *helmv1.HelmRepository, _ *cache.Cache) {
+				t.Expect(obj.Status.RawIndexURL).To(BeEmpty())
+				rawPath := filepath.Join(filepath.Dir(testStorage.LocalPath(*obj.GetArtifact())), rawIndexFileName)
+				t.Expect(rawPath).ToNot(BeAnExistingFile())
+			},
+			want: sreconcile.ResultSuccess,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, meta.SucceededReason, "stored artifact: revision 'existing'"),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -873,6 +2205,7 @@ func TestHelmRepositoryReconciler_reconcileArtifact(t *testing.T) {
 				Storage:       testStorage,
 				Cache:         tt.cache,
 				TTL:           1 * time.Minute,
+				KeepRawIndex:  tt.keepRawIndex,
 				patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
 			}
 
@@ -930,6 +2263,52 @@ func TestHelmRepositoryReconciler_reconcileArtifact(t *testing.T) {
 	}
 }
 
+func TestHelmRepositoryReconciler_reconcileArtifact_externalURL(t *testing.T) {
+	g := NewWithT(t)
+
+	storage, err := NewStorage(t.TempDir(), "source-controller.flux-system.svc.cluster.local.", retentionTTL, retentionRecords)
+	g.Expect(err).ToNot(HaveOccurred())
+	storage.ExternalURL = "https://artifacts.example.com"
+
+	r := &HelmRepositoryReconciler{
+		Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).Build(),
+		EventRecorder: record.NewFakeRecorder(32),
+		Storage:       storage,
+		patchOptions:  getPatchOptions(helmRepositoryReadyCondition.Owned, "sc"),
+	}
+
+	obj := &helmv1.HelmRepository{
+		TypeMeta: metav1.TypeMeta{
+			Kind: helmv1.HelmRepositoryKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "external-url",
+			Generation: 1,
+			Namespace:  "default",
+		},
+		Spec: helmv1.HelmRepositorySpec{
+			Interval: metav1.Duration{Duration: interval},
+			Timeout:  &metav1.Duration{Duration: timeout},
+			URL:      "https://example.com/index.yaml",
+		},
+	}
+
+	cachePath := filepath.Join(t.TempDir(), "index.yaml")
+	g.Expect(os.WriteFile(cachePath, nil, 0o640)).To(Succeed())
+	chartRepo, err := repository.NewChartRepository(obj.Spec.URL, "", testGetters, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	chartRepo.Path = cachePath
+
+	artifact := storage.NewArtifactFor(obj.Kind, obj, "existing", "index.yaml")
+	sp := patch.NewSerialPatcher(obj, r.Client)
+
+	got, err := r.reconcileArtifact(context.TODO(), sp, obj, &artifact, chartRepo)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(got).To(Equal(sreconcile.ResultSuccess))
+	g.Expect(obj.GetArtifact().URL).To(Equal("https://artifacts.example.com/helmrepository/default/external-url/index.yaml"))
+	g.Expect(obj.Status.URL).To(HavePrefix("https://artifacts.example.com/helmrepository/default/external-url/"))
+}
+
 func TestHelmRepositoryReconciler_reconcileSubRecs(t *testing.T) {
 	// Helper to build simple helmRepositoryReconcileFunc with result and error.
 	buildReconcileFuncs := func(r sreconcile.Result, e error) helmRepositoryReconcileFunc {
@@ -1180,9 +2559,9 @@ func TestHelmRepositoryReconciler_notify(t *testing.T) {
 			res:    sreconcile.ResultSuccess,
 			resErr: nil,
 			newObjBeforeFunc: func(obj *helmv1.HelmRepository) {
-				obj.Status.Artifact = &sourcev1.Artifact{Revision: "xxx", Digest: "yyy", Size: nil}
+				obj.Status.Artifact = &sourcev1.Artifact{Revision: "xxx", Digest: "yyy", Size: nil, Path: "index-yyy.yaml"}
 			},
-			wantEvent: "Normal NewArtifact stored fetched index of unknown size",
+			wantEvent: "Normal NewArtifact stored fetched index of unknown size from 'some-address' with revision 'xxx' at 'index-yyy.yaml'",
 		},
 		{
 			name:   "new artifact",
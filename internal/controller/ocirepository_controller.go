@@ -38,6 +38,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/opencontainers/go-digest"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -68,10 +69,17 @@ import (
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	ociv1 "github.com/fluxcd/source-controller/api/v1beta2"
+	"github.com/fluxcd/source-controller/internal/connlimit"
 	serror "github.com/fluxcd/source-controller/internal/error"
+	"github.com/fluxcd/source-controller/internal/features"
+	"github.com/fluxcd/source-controller/internal/latency"
 	sreconcile "github.com/fluxcd/source-controller/internal/reconcile"
 	"github.com/fluxcd/source-controller/internal/reconcile/summarize"
+	"github.com/fluxcd/source-controller/internal/sourcemetrics"
+	"github.com/fluxcd/source-controller/internal/tracing"
+	stransport "github.com/fluxcd/source-controller/internal/transport"
 	"github.com/fluxcd/source-controller/internal/util"
+	"github.com/fluxcd/source-controller/internal/webhook"
 )
 
 // ociRepositoryReadyCondition contains the information required to summarize a
@@ -135,6 +143,25 @@ type OCIRepositoryReconciler struct {
 	ControllerName    string
 	requeueDependency time.Duration
 
+	PreStoreWebhook *webhook.PreStore
+
+	// LatencyRecorder records the sliding-window reconcile latency
+	// percentiles.
+	LatencyRecorder *latency.Recorder
+
+	// SourceMetrics records the reconcile duration, Artifact size and
+	// fetch failure metrics.
+	SourceMetrics *sourcemetrics.Recorder
+
+	// ConnectionLimiter bounds the number of concurrent outbound network
+	// operations across all reconcilers.
+	ConnectionLimiter *connlimit.Limiter
+
+	// AllowedSchemes is the list of URL schemes sources are allowed to use.
+	// Any scheme is allowed when empty.
+	AllowedSchemes []string
+
+	features     map[string]bool
 	patchOptions []patch.Option
 }
 
@@ -152,6 +179,10 @@ func (r *OCIRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
 func (r *OCIRepositoryReconciler) SetupWithManagerAndOptions(mgr ctrl.Manager, opts OCIRepositoryReconcilerOptions) error {
 	r.patchOptions = getPatchOptions(ociRepositoryReadyCondition.Owned, r.ControllerName)
 
+	if r.features == nil {
+		r.features = features.FeatureGates()
+	}
+
 	r.requeueDependency = opts.DependencyRequeueInterval
 
 	return ctrl.NewControllerManagedBy(mgr).
@@ -174,6 +205,11 @@ func (r *OCIRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	start := time.Now()
 	log := ctrl.LoggerFrom(ctx)
 
+	ctx, span := tracing.StartReconcile(ctx, ociv1.OCIRepositoryKind, req.Namespace, req.Name)
+	defer func() {
+		tracing.End(span, retErr)
+	}()
+
 	// Fetch the OCIRepository
 	obj := &ociv1.OCIRepository{}
 	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
@@ -211,6 +247,8 @@ func (r *OCIRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		// Always record readiness and duration metrics
 		r.Metrics.RecordReadiness(ctx, obj)
 		r.Metrics.RecordDuration(ctx, obj, start)
+		r.LatencyRecorder.Observe(ociv1.OCIRepositoryKind, time.Since(start))
+		r.SourceMetrics.Record(ociv1.OCIRepositoryKind, obj, time.Since(start), retErr)
 	}()
 
 	// Add finalizer first if not exist to avoid the race condition between init and delete
@@ -296,7 +334,9 @@ func (r *OCIRepositoryReconciler) reconcile(ctx context.Context, sp *patch.Seria
 
 	// Run the sub-reconcilers and build the result of reconciliation.
 	for _, rec := range reconcilers {
-		recResult, err := rec(ctx, sp, obj, &metadata, tmpDir)
+		recCtx, recSpan := tracing.StartFunc(ctx, rec)
+		recResult, err := rec(recCtx, sp, obj, &metadata, tmpDir)
+		tracing.End(recSpan, err)
 		// Exit immediately on ResultRequeue.
 		if recResult == sreconcile.ResultRequeue {
 			return sreconcile.ResultRequeue, nil
@@ -321,6 +361,14 @@ func (r *OCIRepositoryReconciler) reconcile(ctx context.Context, sp *patch.Seria
 // If this fails, it records v1beta2.FetchFailedCondition=True on the object and returns early.
 func (r *OCIRepositoryReconciler) reconcileSource(ctx context.Context, sp *patch.SerialPatcher,
 	obj *ociv1.OCIRepository, metadata *sourcev1.Artifact, dir string) (sreconcile.Result, error) {
+	// Validate the referenced secrets before any network operation
+	if r.features[features.PreflightSecrets] {
+		if e := preflightSecrets(ctx, r.Client, obj.GetNamespace(), ociRepositorySecretReferences(obj)...); e != nil {
+			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+			return sreconcile.ResultEmpty, e
+		}
+	}
+
 	var auth authn.Authenticator
 
 	ctxTimeout, cancel := context.WithTimeout(ctx, obj.Spec.Timeout.Duration)
@@ -334,6 +382,14 @@ func (r *OCIRepositoryReconciler) reconcileSource(ctx context.Context, sp *patch
 		conditions.Delete(obj, sourcev1.SourceVerifiedCondition)
 	}
 
+	if err := util.ValidateURLScheme(obj.Spec.URL, r.AllowedSchemes); err != nil {
+		e := serror.NewStalling(
+			fmt.Errorf("URL validation failed for '%s': %w", util.RedactURL(obj.Spec.URL), err),
+			sourcev1.URLSchemeNotAllowedReason)
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
 	// Generate the registry credential keychain either from static credentials or using cloud OIDC
 	keychain, err := r.keychain(ctx, obj)
 	if err != nil {
@@ -376,7 +432,7 @@ func (r *OCIRepositoryReconciler) reconcileSource(ctx context.Context, sp *patch
 	if err != nil {
 		if _, ok := err.(invalidOCIURLError); ok {
 			e := serror.NewStalling(
-				fmt.Errorf("URL validation failed for '%s': %w", obj.Spec.URL, err),
+				fmt.Errorf("URL validation failed for '%s': %w", util.RedactURL(obj.Spec.URL), err),
 				sourcev1.URLInvalidReason)
 			conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, e.Reason, e.Err.Error())
 			return sreconcile.ResultEmpty, e
@@ -831,9 +887,14 @@ func (r *OCIRepositoryReconciler) keychain(ctx context.Context, obj *ociv1.OCIRe
 
 // transport clones the default transport from remote and when a certSecretRef is specified,
 // the returned transport will include the TLS client and/or CA certificates.
+// When a ConnectionLimiter is configured, the returned transport acquires a
+// slot of it for every request.
 func (r *OCIRepositoryReconciler) transport(ctx context.Context, obj *ociv1.OCIRepository) (http.RoundTripper, error) {
 	if obj.Spec.CertSecretRef == nil || obj.Spec.CertSecretRef.Name == "" {
-		return nil, nil
+		if r.ConnectionLimiter == nil {
+			return nil, nil
+		}
+		return r.ConnectionLimiter.RoundTripper(remote.DefaultTransport), nil
 	}
 
 	certSecretName := types.NamespacedName{
@@ -869,7 +930,15 @@ func (r *OCIRepositoryReconciler) transport(ctx context.Context, obj *ociv1.OCIR
 		syscerts.AppendCertsFromPEM(caCert)
 		tlsConfig.RootCAs = syscerts
 	}
-	return transport, nil
+
+	if intermediates, ok := certSecret.Data["intermediatesFile"]; ok {
+		tlsConfig, err := stransport.WithIntermediates(tlsConfig, intermediates)
+		if err != nil {
+			return nil, fmt.Errorf("invalid intermediatesFile: %w", err)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return r.ConnectionLimiter.RoundTripper(transport), nil
 }
 
 // oidcAuth generates the OIDC credential authenticator based on the specified cloud provider.
@@ -912,7 +981,7 @@ func (r *OCIRepositoryReconciler) reconcileStorage(ctx context.Context, sp *patc
 
 	// Determine if the advertised artifact is still in storage
 	var artifactMissing bool
-	if artifact := obj.GetArtifact(); artifact != nil && !r.Storage.ArtifactExist(*artifact) {
+	if artifact := obj.GetArtifact(); artifact != nil && r.Storage.ArtifactMissing(*artifact) {
 		obj.Status.Artifact = nil
 		obj.Status.URL = ""
 		artifactMissing = true
@@ -920,12 +989,26 @@ func (r *OCIRepositoryReconciler) reconcileStorage(ctx context.Context, sp *patc
 		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
 	}
 
+	// Determine if the advertised artifact still matches its digest
+	var artifactMismatch bool
+	if err := r.Storage.ArtifactDigestMismatch(obj.GetArtifact()); err != nil {
+		r.eventLogf(ctx, obj, corev1.EventTypeWarning, sourcev1.ArtifactDigestMismatchReason,
+			"failed to verify integrity of artifact: %s", err.Error())
+		obj.Status.Artifact = nil
+		obj.Status.URL = ""
+		artifactMismatch = true
+		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
+	}
+
 	// Record that we do not have an artifact
 	if obj.GetArtifact() == nil {
 		msg := "building artifact"
 		if artifactMissing {
 			msg += ": disappeared from storage"
 		}
+		if artifactMismatch {
+			msg += ": digest mismatch in storage"
+		}
 		rreconcile.ProgressiveStatus(true, obj, meta.ProgressingReason, msg)
 		conditions.Delete(obj, sourcev1.ArtifactInStorageCondition)
 		if err := sp.Patch(ctx, obj, r.patchOptions...); err != nil {
@@ -934,8 +1017,12 @@ func (r *OCIRepositoryReconciler) reconcileStorage(ctx context.Context, sp *patc
 		return sreconcile.ResultSuccess, nil
 	}
 
-	// Always update URLs to ensure hostname is up-to-date
-	r.Storage.SetArtifactURL(obj.GetArtifact())
+	// Always update URLs to ensure hostname is up-to-date, and notify about
+	// corrected URLs of e.g. a changed storage hostname
+	if previousURL, ok := r.Storage.UpdateArtifactURL(obj.GetArtifact()); ok {
+		r.eventLogf(ctx, obj, corev1.EventTypeNormal, sourcev1.ArtifactURLUpdatedReason,
+			"artifact URL updated from '%s' to '%s' to match the storage hostname", previousURL, obj.GetArtifact().URL)
+	}
 	obj.Status.URL = r.Storage.SetHostname(obj.Status.URL)
 
 	return sreconcile.ResultSuccess, nil
@@ -989,6 +1076,12 @@ func (r *OCIRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pat
 		return sreconcile.ResultEmpty, e
 	}
 
+	// Consult the pre-store webhook before storing the artifact
+	if e := reviewArtifact(ctx, r.PreStoreWebhook, ociv1.OCIRepositoryKind, obj, artifact); e != nil {
+		conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
+		return sreconcile.ResultEmpty, e
+	}
+
 	// Ensure artifact directory exists and acquire lock
 	if err := r.Storage.MkdirAll(artifact); err != nil {
 		e := serror.NewGeneric(
@@ -1007,12 +1100,13 @@ func (r *OCIRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pat
 	}
 	defer unlock()
 
+	digestOpt := WithDigestAlgorithm(digest.Algorithm(obj.Spec.DigestAlgorithm))
 	switch obj.GetLayerOperation() {
 	case ociv1.OCILayerCopy:
-		if err = r.Storage.CopyFromPath(&artifact, filepath.Join(dir, metadata.Path)); err != nil {
+		if err = r.Storage.CopyFromPath(&artifact, filepath.Join(dir, metadata.Path), digestOpt); err != nil {
 			e := serror.NewGeneric(
 				fmt.Errorf("unable to copy artifact to storage: %w", err),
-				sourcev1.ArchiveOperationFailedReason,
+				storageFailedReason(err),
 			)
 			conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
 			return sreconcile.ResultEmpty, e
@@ -1031,10 +1125,11 @@ func (r *OCIRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pat
 			ps = append(ps, sourceignore.ReadPatterns(strings.NewReader(*obj.Spec.Ignore), ignoreDomain)...)
 		}
 
-		if err := r.Storage.Archive(&artifact, dir, SourceIgnoreFilter(ps, ignoreDomain)); err != nil {
+		if err := r.Storage.Archive(&artifact, dir, SourceIgnoreFilter(ps, ignoreDomain), "", digestOpt,
+			WithExpectedSize(artifactSize(obj.GetArtifact()))); err != nil {
 			e := serror.NewGeneric(
 				fmt.Errorf("unable to archive artifact to storage: %s", err),
-				sourcev1.ArchiveOperationFailedReason,
+				storageFailedReason(err),
 			)
 			conditions.MarkTrue(obj, sourcev1.StorageOperationFailedCondition, e.Reason, e.Err.Error())
 			return sreconcile.ResultEmpty, e
@@ -1043,7 +1138,14 @@ func (r *OCIRepositoryReconciler) reconcileArtifact(ctx context.Context, sp *pat
 
 	// Record the observations on the object.
 	obj.Status.Artifact = artifact.DeepCopy()
-	obj.Status.Artifact.Metadata = metadata.Metadata
+	// The annotations of the OCI artifact take precedence over the propagated
+	// annotations of the object.
+	for k, v := range metadata.Metadata {
+		if obj.Status.Artifact.Metadata == nil {
+			obj.Status.Artifact.Metadata = make(map[string]string)
+		}
+		obj.Status.Artifact.Metadata[k] = v
+	}
 	obj.Status.ContentConfigChecksum = "" // To be removed in the next API version.
 	obj.Status.ObservedIgnore = obj.Spec.Ignore
 	obj.Status.ObservedLayerSelector = obj.Spec.LayerSelector
@@ -1085,7 +1187,7 @@ func (r *OCIRepositoryReconciler) reconcileDelete(ctx context.Context, obj *ociv
 // removal of all Artifacts for the objects.
 func (r *OCIRepositoryReconciler) garbageCollect(ctx context.Context, obj *ociv1.OCIRepository) error {
 	if !obj.DeletionTimestamp.IsZero() {
-		if deleted, err := r.Storage.RemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
+		if deleted, err := r.Storage.DeferRemoveAll(r.Storage.NewArtifactFor(obj.Kind, obj.GetObjectMeta(), "", "*")); err != nil {
 			return serror.NewGeneric(
 				fmt.Errorf("garbage collection for deleted resource failed: %w", err),
 				"GarbageCollectionFailed",
@@ -1098,7 +1200,7 @@ func (r *OCIRepositoryReconciler) garbageCollect(ctx context.Context, obj *ociv1
 		return nil
 	}
 	if obj.GetArtifact() != nil {
-		delFiles, err := r.Storage.GarbageCollect(ctx, *obj.GetArtifact(), time.Second*5)
+		delFiles, err := r.Storage.GarbageCollect(ctx, *obj.GetArtifact(), obj.Spec.GC, time.Second*5)
 		if err != nil {
 			return serror.NewGeneric(
 				fmt.Errorf("garbage collection of artifacts failed: %w", err),
@@ -1233,6 +1335,10 @@ func ociContentConfigChanged(obj *ociv1.OCIRepository) bool {
 		return true
 	}
 
+	if digestAlgorithmChanged(obj.GetArtifact(), obj.Spec.DigestAlgorithm) {
+		return true
+	}
+
 	return false
 }
 
@@ -0,0 +1,294 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/git"
+	"github.com/fluxcd/pkg/oci"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/fluxcd/source-controller/api/v1beta2"
+	serror "github.com/fluxcd/source-controller/internal/error"
+	"github.com/fluxcd/source-controller/internal/helm/getter"
+	"github.com/fluxcd/source-controller/internal/helm/registry"
+	"github.com/fluxcd/source-controller/pkg/azure"
+	"github.com/fluxcd/source-controller/pkg/gcp"
+	"github.com/fluxcd/source-controller/pkg/minio"
+)
+
+// secretReference is a reference to a Secret from a field of an object,
+// together with a validation of the data the Secret must contain for its
+// use.
+type secretReference struct {
+	// field is the path of the field holding the reference, e.g.
+	// '.spec.secretRef'.
+	field string
+	// ref is the reference to the Secret. A nil reference is ignored.
+	ref *meta.LocalObjectReference
+	// validate validates the data of the Secret. It may be nil, in which
+	// case only the existence of the Secret is checked.
+	validate func(secret corev1.Secret) error
+}
+
+// preflightSecrets checks that all the given Secret references resolve to a
+// Secret in the namespace, and that the data of each Secret passes its
+// validation. It returns an error with sourcev1.SecretNotFoundReason for the
+// first Secret which does not exist, and with sourcev1.SecretInvalidReason
+// for the first Secret which fails its validation.
+func preflightSecrets(ctx context.Context, c client.Reader, namespace string, refs ...secretReference) *serror.Generic {
+	for _, ref := range refs {
+		if ref.ref == nil || ref.ref.Name == "" {
+			continue
+		}
+
+		name := types.NamespacedName{Namespace: namespace, Name: ref.ref.Name}
+		var secret corev1.Secret
+		if err := c.Get(ctx, name, &secret); err != nil {
+			reason := meta.FailedReason
+			if apierrors.IsNotFound(err) {
+				reason = sourcev1.SecretNotFoundReason
+			}
+			return serror.NewGeneric(
+				fmt.Errorf("failed to get secret '%s' referenced in '%s': %w", name.String(), ref.field, err),
+				reason,
+			)
+		}
+
+		if ref.validate == nil {
+			continue
+		}
+		if err := ref.validate(secret); err != nil {
+			return serror.NewGeneric(
+				fmt.Errorf("invalid secret '%s' referenced in '%s': %w", name.String(), ref.field, err),
+				sourcev1.SecretInvalidReason,
+			)
+		}
+	}
+	return nil
+}
+
+// gitRepositorySecretReferences returns the Secret references of the given
+// GitRepository.
+func gitRepositorySecretReferences(obj *sourcev1.GitRepository) []secretReference {
+	refs := []secretReference{
+		{
+			field: ".spec.secretRef",
+			ref:   obj.Spec.SecretRef,
+			validate: func(secret corev1.Secret) error {
+				u, err := url.Parse(obj.Spec.URL)
+				// Invalid URLs and the git protocol, which does not support
+				// authentication, are reported during the fetch.
+				if err != nil || u.Scheme == "git" {
+					return nil
+				}
+				_, err = git.NewAuthOptions(*u, secret.Data)
+				return err
+			},
+		},
+	}
+	if v := obj.Spec.Verification; v != nil && v.Mode != "" {
+		refs = append(refs, secretReference{
+			field: ".spec.verify.secretRef",
+			ref:   &v.SecretRef,
+			validate: func(secret corev1.Secret) error {
+				if len(secret.Data) == 0 {
+					return errors.New("no PGP public keys found")
+				}
+				return nil
+			},
+		})
+	}
+	return refs
+}
+
+// bucketSecretReferences returns the Secret references of the given Bucket.
+func bucketSecretReferences(obj *v1beta2.Bucket) []secretReference {
+	refs := []secretReference{
+		{
+			field: ".spec.secretRef",
+			ref:   obj.Spec.SecretRef,
+			validate: func(secret corev1.Secret) error {
+				switch obj.Spec.Provider {
+				case v1beta2.GoogleBucketProvider:
+					return gcp.ValidateSecret(&secret)
+				case v1beta2.AzureBucketProvider:
+					return azure.ValidateSecret(&secret)
+				default:
+					return minio.ValidateSecret(&secret)
+				}
+			},
+		},
+	}
+	return append(refs, proxySecretReferences(obj.Spec.Proxy)...)
+}
+
+// helmRepositorySecretReferences returns the Secret references of the given
+// HelmRepository.
+func helmRepositorySecretReferences(obj *v1beta2.HelmRepository) []secretReference {
+	refs := []secretReference{
+		{
+			field: ".spec.secretRef",
+			ref:   obj.Spec.SecretRef,
+			validate: func(secret corev1.Secret) error {
+				if obj.Spec.Type == v1beta2.HelmRepositoryTypeOCI {
+					_, err := registry.LoginOptionFromSecret(obj.Spec.URL, secret)
+					return err
+				}
+				if _, err := getter.ClientOptionsFromSecret(secret); err != nil {
+					return err
+				}
+				if _, err := getter.TLSClientConfigFromSecret(secret, obj.Spec.URL); err != nil {
+					return err
+				}
+				_, err := getter.ProxyFromSecret(secret)
+				return err
+			},
+		},
+	}
+	if obj.Spec.Type == v1beta2.HelmRepositoryTypeOCI {
+		return refs
+	}
+	return append(refs, proxySecretReferences(obj.Spec.Proxy)...)
+}
+
+// proxySecretReferences returns the Secret references of the given
+// ProxyConfig.
+func proxySecretReferences(cfg *v1beta2.ProxyConfig) []secretReference {
+	if cfg == nil {
+		return nil
+	}
+	return []secretReference{
+		{
+			field: ".spec.proxy.secretRef",
+			ref:   cfg.SecretRef,
+			validate: func(secret corev1.Secret) error {
+				_, err := proxyUserFromSecret(secret)
+				return err
+			},
+		},
+	}
+}
+
+// helmChartSecretReferences returns the Secret references of the given
+// HelmChart.
+func helmChartSecretReferences(obj *v1beta2.HelmChart) []secretReference {
+	var refs []secretReference
+	if v := obj.Spec.Verify; v != nil {
+		validate := validateCosignSecret
+		if v.Provider == "helm" {
+			validate = func(secret corev1.Secret) error {
+				if len(secret.Data) == 0 {
+					return errors.New("no keyring found")
+				}
+				return nil
+			}
+		}
+		refs = append(refs, secretReference{
+			field:    ".spec.verify.secretRef",
+			ref:      v.SecretRef,
+			validate: validate,
+		})
+	}
+	if p := obj.Spec.Push; p != nil {
+		refs = append(refs, secretReference{
+			field: ".spec.push.secretRef",
+			ref:   p.SecretRef,
+			validate: func(secret corev1.Secret) error {
+				_, err := registry.LoginOptionFromSecret(p.OCIRef, secret)
+				return err
+			},
+		})
+	}
+	return refs
+}
+
+// ociRepositorySecretReferences returns the Secret references of the given
+// OCIRepository.
+func ociRepositorySecretReferences(obj *v1beta2.OCIRepository) []secretReference {
+	refs := []secretReference{
+		{
+			field: ".spec.secretRef",
+			ref:   obj.Spec.SecretRef,
+			validate: func(secret corev1.Secret) error {
+				_, json := secret.Data[corev1.DockerConfigJsonKey]
+				_, cfg := secret.Data[corev1.DockerConfigKey]
+				if !json && !cfg {
+					return fmt.Errorf("no '%s' or '%s' found", corev1.DockerConfigJsonKey, corev1.DockerConfigKey)
+				}
+				return nil
+			},
+		},
+		{
+			field: ".spec.certSecretRef",
+			ref:   obj.Spec.CertSecretRef,
+			validate: func(secret corev1.Secret) error {
+				_, cert := secret.Data[oci.ClientCert]
+				_, key := secret.Data[oci.ClientKey]
+				if cert != key {
+					return fmt.Errorf("'%s' and '%s' must be set together", oci.ClientCert, oci.ClientKey)
+				}
+				return nil
+			},
+		},
+	}
+	if v := obj.Spec.Verify; v != nil {
+		refs = append(refs, secretReference{
+			field:    ".spec.verify.secretRef",
+			ref:      v.SecretRef,
+			validate: validatePublicKeys,
+		})
+	}
+	return refs
+}
+
+// validateCosignSecret validates that the given Secret contains at least one
+// public key, or the identity to verify a keyless Cosign signature against.
+func validateCosignSecret(secret corev1.Secret) error {
+	if validatePublicKeys(secret) == nil {
+		return nil
+	}
+	identity, err := cosignIdentityFromSecret(secret)
+	if err != nil {
+		return err
+	}
+	if identity == nil {
+		return errors.New("no public keys or identity found")
+	}
+	return nil
+}
+
+// validatePublicKeys validates that the given Secret contains at least one
+// public key, as used for the verification of OCI artifact signatures.
+func validatePublicKeys(secret corev1.Secret) error {
+	for k := range secret.Data {
+		if strings.HasSuffix(k, ".pub") {
+			return nil
+		}
+	}
+	return errors.New("no public keys found")
+}
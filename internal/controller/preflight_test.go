@@ -0,0 +1,517 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/runtime/conditions"
+	"github.com/fluxcd/pkg/runtime/patch"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/fluxcd/source-controller/api/v1beta2"
+	"github.com/fluxcd/source-controller/internal/features"
+	"github.com/fluxcd/source-controller/internal/index"
+	sreconcile "github.com/fluxcd/source-controller/internal/reconcile"
+)
+
+func TestPreflightSecrets(t *testing.T) {
+	tests := []struct {
+		name       string
+		secrets    []*corev1.Secret
+		refs       func() []secretReference
+		wantReason string
+		wantErr    string
+	}{
+		{
+			name: "no references",
+			refs: func() []secretReference {
+				return nil
+			},
+		},
+		{
+			name: "GitRepository missing secret",
+			refs: func() []secretReference {
+				return gitRepositorySecretReferences(&sourcev1.GitRepository{
+					Spec: sourcev1.GitRepositorySpec{
+						URL:       "https://example.com/repo.git",
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretNotFoundReason,
+			wantErr:    "failed to get secret 'default/auth' referenced in '.spec.secretRef'",
+		},
+		{
+			name: "GitRepository SSH secret without known hosts",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("auth", map[string][]byte{"identity": []byte("key")}),
+			},
+			refs: func() []secretReference {
+				return gitRepositorySecretReferences(&sourcev1.GitRepository{
+					Spec: sourcev1.GitRepositorySpec{
+						URL:       "ssh://git@example.com/repo.git",
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretInvalidReason,
+			wantErr:    "invalid secret 'default/auth' referenced in '.spec.secretRef'",
+		},
+		{
+			name: "GitRepository missing verification secret",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("auth", map[string][]byte{"username": []byte("user"), "password": []byte("pass")}),
+			},
+			refs: func() []secretReference {
+				return gitRepositorySecretReferences(&sourcev1.GitRepository{
+					Spec: sourcev1.GitRepositorySpec{
+						URL:       "https://example.com/repo.git",
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+						Verification: &sourcev1.GitRepositoryVerification{
+							Mode:      "head",
+							SecretRef: meta.LocalObjectReference{Name: "pgp"},
+						},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretNotFoundReason,
+			wantErr:    "failed to get secret 'default/pgp' referenced in '.spec.verify.secretRef'",
+		},
+		{
+			name: "GitRepository valid secrets",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("auth", map[string][]byte{"username": []byte("user"), "password": []byte("pass")}),
+				newPreflightSecret("pgp", map[string][]byte{"key.asc": []byte("key")}),
+			},
+			refs: func() []secretReference {
+				return gitRepositorySecretReferences(&sourcev1.GitRepository{
+					Spec: sourcev1.GitRepositorySpec{
+						URL:       "https://example.com/repo.git",
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+						Verification: &sourcev1.GitRepositoryVerification{
+							Mode:      "head",
+							SecretRef: meta.LocalObjectReference{Name: "pgp"},
+						},
+					},
+				})
+			},
+		},
+		{
+			name: "Bucket missing secret",
+			refs: func() []secretReference {
+				return bucketSecretReferences(&v1beta2.Bucket{
+					Spec: v1beta2.BucketSpec{
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretNotFoundReason,
+			wantErr:    "failed to get secret 'default/auth' referenced in '.spec.secretRef'",
+		},
+		{
+			name: "Bucket secret without provider keys",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("auth", map[string][]byte{"accesskey": []byte("key")}),
+			},
+			refs: func() []secretReference {
+				return bucketSecretReferences(&v1beta2.Bucket{
+					Spec: v1beta2.BucketSpec{
+						Provider:  v1beta2.GenericBucketProvider,
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretInvalidReason,
+			wantErr:    "required fields 'accesskey' and 'secretkey'",
+		},
+		{
+			name: "Bucket valid secret",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("auth", map[string][]byte{"serviceaccount": []byte("sa")}),
+			},
+			refs: func() []secretReference {
+				return bucketSecretReferences(&v1beta2.Bucket{
+					Spec: v1beta2.BucketSpec{
+						Provider:  v1beta2.GoogleBucketProvider,
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+		},
+		{
+			name: "Bucket proxy secret without password",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("proxy", map[string][]byte{"username": []byte("user")}),
+			},
+			refs: func() []secretReference {
+				return bucketSecretReferences(&v1beta2.Bucket{
+					Spec: v1beta2.BucketSpec{
+						Provider: v1beta2.GenericBucketProvider,
+						Proxy: &v1beta2.ProxyConfig{
+							URL:       "http://proxy.example.com",
+							SecretRef: &meta.LocalObjectReference{Name: "proxy"},
+						},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretInvalidReason,
+			wantErr:    "invalid secret 'default/proxy' referenced in '.spec.proxy.secretRef'",
+		},
+		{
+			name: "HelmRepository missing secret",
+			refs: func() []secretReference {
+				return helmRepositorySecretReferences(&v1beta2.HelmRepository{
+					Spec: v1beta2.HelmRepositorySpec{
+						URL:       "https://example.com",
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretNotFoundReason,
+			wantErr:    "failed to get secret 'default/auth' referenced in '.spec.secretRef'",
+		},
+		{
+			name: "HelmRepository secret with proxy username but no password",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("auth", map[string][]byte{
+					"proxyURL":      []byte("http://proxy.example.com"),
+					"proxyUsername": []byte("user"),
+				}),
+			},
+			refs: func() []secretReference {
+				return helmRepositorySecretReferences(&v1beta2.HelmRepository{
+					Spec: v1beta2.HelmRepositorySpec{
+						URL:       "https://example.com",
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretInvalidReason,
+			wantErr:    "invalid secret 'default/auth' referenced in '.spec.secretRef'",
+		},
+		{
+			name: "HelmRepository OCI secret with username but no password",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("auth", map[string][]byte{"username": []byte("user")}),
+			},
+			refs: func() []secretReference {
+				return helmRepositorySecretReferences(&v1beta2.HelmRepository{
+					Spec: v1beta2.HelmRepositorySpec{
+						URL:       "oci://example.com/charts",
+						Type:      v1beta2.HelmRepositoryTypeOCI,
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretInvalidReason,
+			wantErr:    "invalid secret 'default/auth' referenced in '.spec.secretRef'",
+		},
+		{
+			name: "HelmRepository valid secret",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("auth", map[string][]byte{"username": []byte("user"), "password": []byte("pass")}),
+			},
+			refs: func() []secretReference {
+				return helmRepositorySecretReferences(&v1beta2.HelmRepository{
+					Spec: v1beta2.HelmRepositorySpec{
+						URL:       "https://example.com",
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+		},
+		{
+			name: "HelmRepository missing proxy secret",
+			refs: func() []secretReference {
+				return helmRepositorySecretReferences(&v1beta2.HelmRepository{
+					Spec: v1beta2.HelmRepositorySpec{
+						URL: "https://example.com",
+						Proxy: &v1beta2.ProxyConfig{
+							URL:       "http://proxy.example.com",
+							SecretRef: &meta.LocalObjectReference{Name: "proxy"},
+						},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretNotFoundReason,
+			wantErr:    "failed to get secret 'default/proxy' referenced in '.spec.proxy.secretRef'",
+		},
+		{
+			name: "HelmChart missing verification secret",
+			refs: func() []secretReference {
+				return helmChartSecretReferences(&v1beta2.HelmChart{
+					Spec: v1beta2.HelmChartSpec{
+						Verify: &v1beta2.OCIRepositoryVerification{
+							Provider:  "cosign",
+							SecretRef: &meta.LocalObjectReference{Name: "cosign"},
+						},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretNotFoundReason,
+			wantErr:    "failed to get secret 'default/cosign' referenced in '.spec.verify.secretRef'",
+		},
+		{
+			name: "HelmChart verification secret without public keys",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("cosign", map[string][]byte{"cosign.key": []byte("key")}),
+			},
+			refs: func() []secretReference {
+				return helmChartSecretReferences(&v1beta2.HelmChart{
+					Spec: v1beta2.HelmChartSpec{
+						Verify: &v1beta2.OCIRepositoryVerification{
+							Provider:  "cosign",
+							SecretRef: &meta.LocalObjectReference{Name: "cosign"},
+						},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretInvalidReason,
+			wantErr:    "no public keys or identity found",
+		},
+		{
+			name: "HelmChart verification secret with invalid identity",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("cosign", map[string][]byte{"subjectRegExp": []byte("(")}),
+			},
+			refs: func() []secretReference {
+				return helmChartSecretReferences(&v1beta2.HelmChart{
+					Spec: v1beta2.HelmChartSpec{
+						Verify: &v1beta2.OCIRepositoryVerification{
+							Provider:  "cosign",
+							SecretRef: &meta.LocalObjectReference{Name: "cosign"},
+						},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretInvalidReason,
+			wantErr:    "invalid 'subjectRegExp'",
+		},
+		{
+			name: "HelmChart verification secret with identity",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("cosign", map[string][]byte{
+					"issuer":        []byte("https://token.actions.githubusercontent.com"),
+					"subjectRegExp": []byte("^https://github.com/stefanprodan/podinfo.*$"),
+				}),
+			},
+			refs: func() []secretReference {
+				return helmChartSecretReferences(&v1beta2.HelmChart{
+					Spec: v1beta2.HelmChartSpec{
+						Verify: &v1beta2.OCIRepositoryVerification{
+							Provider:  "cosign",
+							SecretRef: &meta.LocalObjectReference{Name: "cosign"},
+						},
+					},
+				})
+			},
+		},
+		{
+			name: "HelmChart missing push secret",
+			refs: func() []secretReference {
+				return helmChartSecretReferences(&v1beta2.HelmChart{
+					Spec: v1beta2.HelmChartSpec{
+						Push: &v1beta2.HelmChartPush{
+							OCIRef:    "oci://example.com/charts",
+							SecretRef: &meta.LocalObjectReference{Name: "push"},
+						},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretNotFoundReason,
+			wantErr:    "failed to get secret 'default/push' referenced in '.spec.push.secretRef'",
+		},
+		{
+			name: "HelmChart valid secrets",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("cosign", map[string][]byte{"cosign.pub": []byte("key")}),
+				newPreflightSecret("push", map[string][]byte{"username": []byte("user"), "password": []byte("pass")}),
+			},
+			refs: func() []secretReference {
+				return helmChartSecretReferences(&v1beta2.HelmChart{
+					Spec: v1beta2.HelmChartSpec{
+						Verify: &v1beta2.OCIRepositoryVerification{
+							Provider:  "cosign",
+							SecretRef: &meta.LocalObjectReference{Name: "cosign"},
+						},
+						Push: &v1beta2.HelmChartPush{
+							OCIRef:    "oci://example.com/charts",
+							SecretRef: &meta.LocalObjectReference{Name: "push"},
+						},
+					},
+				})
+			},
+		},
+		{
+			name: "OCIRepository missing secret",
+			refs: func() []secretReference {
+				return ociRepositorySecretReferences(&v1beta2.OCIRepository{
+					Spec: v1beta2.OCIRepositorySpec{
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretNotFoundReason,
+			wantErr:    "failed to get secret 'default/auth' referenced in '.spec.secretRef'",
+		},
+		{
+			name: "OCIRepository secret without docker config",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("auth", map[string][]byte{"username": []byte("user")}),
+			},
+			refs: func() []secretReference {
+				return ociRepositorySecretReferences(&v1beta2.OCIRepository{
+					Spec: v1beta2.OCIRepositorySpec{
+						SecretRef: &meta.LocalObjectReference{Name: "auth"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretInvalidReason,
+			wantErr:    "no '.dockerconfigjson' or '.dockercfg' found",
+		},
+		{
+			name: "OCIRepository missing cert secret",
+			refs: func() []secretReference {
+				return ociRepositorySecretReferences(&v1beta2.OCIRepository{
+					Spec: v1beta2.OCIRepositorySpec{
+						CertSecretRef: &meta.LocalObjectReference{Name: "certs"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretNotFoundReason,
+			wantErr:    "failed to get secret 'default/certs' referenced in '.spec.certSecretRef'",
+		},
+		{
+			name: "OCIRepository cert secret without key",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("certs", map[string][]byte{"certFile": []byte("cert")}),
+			},
+			refs: func() []secretReference {
+				return ociRepositorySecretReferences(&v1beta2.OCIRepository{
+					Spec: v1beta2.OCIRepositorySpec{
+						CertSecretRef: &meta.LocalObjectReference{Name: "certs"},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretInvalidReason,
+			wantErr:    "'certFile' and 'keyFile' must be set together",
+		},
+		{
+			name: "OCIRepository missing verification secret",
+			refs: func() []secretReference {
+				return ociRepositorySecretReferences(&v1beta2.OCIRepository{
+					Spec: v1beta2.OCIRepositorySpec{
+						Verify: &v1beta2.OCIRepositoryVerification{
+							Provider:  "cosign",
+							SecretRef: &meta.LocalObjectReference{Name: "cosign"},
+						},
+					},
+				})
+			},
+			wantReason: sourcev1.SecretNotFoundReason,
+			wantErr:    "failed to get secret 'default/cosign' referenced in '.spec.verify.secretRef'",
+		},
+		{
+			name: "OCIRepository valid secrets",
+			secrets: []*corev1.Secret{
+				newPreflightSecret("auth", map[string][]byte{corev1.DockerConfigJsonKey: []byte("{}")}),
+				newPreflightSecret("certs", map[string][]byte{"caFile": []byte("ca")}),
+				newPreflightSecret("cosign", map[string][]byte{"cosign.pub": []byte("key")}),
+			},
+			refs: func() []secretReference {
+				return ociRepositorySecretReferences(&v1beta2.OCIRepository{
+					Spec: v1beta2.OCIRepositorySpec{
+						SecretRef:     &meta.LocalObjectReference{Name: "auth"},
+						CertSecretRef: &meta.LocalObjectReference{Name: "certs"},
+						Verify: &v1beta2.OCIRepositoryVerification{
+							Provider:  "cosign",
+							SecretRef: &meta.LocalObjectReference{Name: "cosign"},
+						},
+					},
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			builder := fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme())
+			for _, s := range tt.secrets {
+				builder.WithObjects(s)
+			}
+
+			err := preflightSecrets(ctx, builder.Build(), "default", tt.refs()...)
+			if tt.wantReason == "" {
+				g.Expect(err).To(BeNil())
+				return
+			}
+			g.Expect(err).ToNot(BeNil())
+			g.Expect(err.Reason).To(Equal(tt.wantReason))
+			g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+		})
+	}
+}
+
+func TestBucketReconciler_reconcileSource_preflightSecrets(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &BucketReconciler{
+		Client:        fakeclient.NewClientBuilder().WithScheme(testEnv.GetScheme()).Build(),
+		EventRecorder: record.NewFakeRecorder(32),
+		Storage:       testStorage,
+		features:      map[string]bool{features.PreflightSecrets: true},
+		patchOptions:  getPatchOptions(bucketReadyCondition.Owned, "sc"),
+	}
+	obj := &v1beta2.Bucket{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "preflight",
+			Namespace: "default",
+		},
+		Spec: v1beta2.BucketSpec{
+			BucketName: "dummy",
+			Endpoint:   "unreachable.invalid",
+			SecretRef:  &meta.LocalObjectReference{Name: "missing"},
+		},
+	}
+	sp := patch.NewSerialPatcher(obj, r.Client)
+
+	got, err := r.reconcileSource(ctx, sp, obj, index.NewDigester(), t.TempDir())
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(got).To(Equal(sreconcile.ResultEmpty))
+	g.Expect(conditions.GetReason(obj, sourcev1.FetchFailedCondition)).To(Equal(sourcev1.SecretNotFoundReason))
+	g.Expect(conditions.GetMessage(obj, sourcev1.FetchFailedCondition)).To(
+		ContainSubstring("failed to get secret 'default/missing' referenced in '.spec.secretRef'"))
+}
+
+func newPreflightSecret(name string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Data: data,
+	}
+}
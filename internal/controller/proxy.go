@@ -0,0 +1,75 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/fluxcd/source-controller/api/v1beta2"
+	"github.com/fluxcd/source-controller/internal/transport"
+)
+
+// errInvalidProxyURL is returned by proxyFromConfig if the URL of the
+// ProxyConfig is invalid, which can only be resolved by changing the spec.
+var errInvalidProxyURL = errors.New("invalid proxy URL")
+
+// proxyFromConfig returns the transport.Proxy for the given ProxyConfig of an
+// object in the given namespace, authenticating with the credentials of the
+// Secret it references. It returns nil if the config is nil.
+func proxyFromConfig(ctx context.Context, c client.Reader, namespace string, cfg *v1beta2.ProxyConfig) (*transport.Proxy, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot parse URL", errInvalidProxyURL)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w '%s': must be an absolute HTTP/S URL", errInvalidProxyURL, u.Redacted())
+	}
+	proxy := &transport.Proxy{URL: u, NoProxy: cfg.NoProxy}
+
+	if cfg.SecretRef != nil {
+		var secret corev1.Secret
+		key := types.NamespacedName{Namespace: namespace, Name: cfg.SecretRef.Name}
+		if err := c.Get(ctx, key, &secret); err != nil {
+			return nil, fmt.Errorf("failed to get proxy secret '%s': %w", key, err)
+		}
+		if proxy.User, err = proxyUserFromSecret(secret); err != nil {
+			return nil, err
+		}
+	}
+	return proxy, nil
+}
+
+// proxyUserFromSecret returns the user to authenticate with a proxy from the
+// 'username' and 'password' fields of the given Secret.
+func proxyUserFromSecret(secret corev1.Secret) (*url.Userinfo, error) {
+	username, password := string(secret.Data["username"]), string(secret.Data["password"])
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("invalid '%s' secret data: required fields 'username' and 'password'", secret.Name)
+	}
+	return url.UserPassword(username, password), nil
+}
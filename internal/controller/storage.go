@@ -20,18 +20,24 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/fluxcd/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 
@@ -42,10 +48,26 @@ import (
 	v1 "github.com/fluxcd/source-controller/api/v1"
 	intdigest "github.com/fluxcd/source-controller/internal/digest"
 	sourcefs "github.com/fluxcd/source-controller/internal/fs"
+	"github.com/fluxcd/source-controller/internal/tree"
 )
 
 const GarbageCountLimit = 1000
 
+// deferredRemovalMarker is the name of the file written to an artifact dir
+// by DeferRemoveAll, holding the time after which the dir is to be removed.
+// It persists the schedule across restarts of the controller.
+const deferredRemovalMarker = ".deferred-removal"
+
+// ErrInsufficientStorage is returned by the Storage operations which write
+// the file of an artifact, when the free space on the BasePath is less than
+// the expected size of the artifact plus the FreeSpaceMargin.
+var ErrInsufficientStorage = errors.New("insufficient storage")
+
+// availableSpace returns the number of bytes available on the filesystem
+// holding the given path. It is a variable to allow tests to simulate a
+// filesystem running out of space.
+var availableSpace = sourcefs.AvailableSpace
+
 const (
 	// defaultFileMode is the permission mode applied to all files inside an artifact archive.
 	defaultFileMode int64 = 0o644
@@ -61,6 +83,11 @@ type Storage struct {
 	// Hostname is the file server host name used to compose the artifacts URIs.
 	Hostname string `json:"hostname"`
 
+	// ExternalURL is the scheme and host (e.g. "https://artifacts.example.com")
+	// used to compose the artifacts URIs instead of the Hostname, for consumers
+	// outside the cluster. The file server keeps serving on the Hostname.
+	ExternalURL string `json:"externalURL,omitempty"`
+
 	// ArtifactRetentionTTL is the duration of time that artifacts will be kept
 	// in storage before being garbage collected.
 	ArtifactRetentionTTL time.Duration `json:"artifactRetentionTTL"`
@@ -68,6 +95,55 @@ type Storage struct {
 	// ArtifactRetentionRecords is the maximum number of artifacts to be kept in
 	// storage after a garbage collection.
 	ArtifactRetentionRecords int `json:"artifactRetentionRecords"`
+
+	// ArtifactFailureThreshold is the number of consecutive times an artifact
+	// is tolerated to not be found in storage, before it is considered missing.
+	ArtifactFailureThreshold int `json:"artifactFailureThreshold"`
+
+	// FinalizerGCGrace is the duration of time the artifacts of a deleted
+	// object are kept in storage before being removed by
+	// SweepDeferredRemovals, allowing consumers to finish fetching them.
+	FinalizerGCGrace time.Duration `json:"finalizerGCGrace"`
+
+	// ArtifactTreeHash enables writing a sidecar file with the tree.Tree of
+	// the files in every archived artifact.
+	ArtifactTreeHash bool `json:"artifactTreeHash"`
+
+	// PropagateAnnotations is a list of annotation keys of source objects,
+	// which are recorded in the Metadata of the artifacts created for them.
+	// The keys may contain path.Match wildcards, e.g. "example.com/*".
+	PropagateAnnotations []string `json:"propagateAnnotations,omitempty"`
+
+	// FreeSpaceMargin is the number of bytes which must remain available on
+	// the BasePath after writing an artifact. When greater than zero, the
+	// free space is checked before writing, and ErrInsufficientStorage is
+	// returned instead of failing mid-write.
+	FreeSpaceMargin int64 `json:"freeSpaceMargin,omitempty"`
+
+	// artifactFailures holds the number of consecutive times an artifact was
+	// not found in storage, indexed by the path of the artifact.
+	artifactFailures   map[string]int
+	artifactFailuresMu sync.Mutex
+
+	// deferredRemovals holds the time after which the artifact directories of
+	// deleted objects are to be removed, indexed by the local directory path.
+	// It mirrors the deferredRemovalMarker files in the directories.
+	deferredRemovals   map[string]time.Time
+	deferredRemovalsMu sync.Mutex
+
+	// verifiedArtifacts holds the last artifact file verified by
+	// VerifyArtifact, indexed by the local directory path of the artifact.
+	verifiedArtifacts   map[string]verifiedArtifact
+	verifiedArtifactsMu sync.Mutex
+}
+
+// verifiedArtifact is an artifact file which matched the digest, and the
+// size and modification time of the file when it was verified.
+type verifiedArtifact struct {
+	path    string
+	digest  digest.Digest
+	size    int64
+	modTime time.Time
 }
 
 // NewStorage creates the storage helper for a given path and hostname.
@@ -83,22 +159,46 @@ func NewStorage(basePath string, hostname string, artifactRetentionTTL time.Dura
 	}, nil
 }
 
-// NewArtifactFor returns a new v1.Artifact.
+// NewArtifactFor returns a new v1.Artifact. The annotations of the given object metadata matching the
+// PropagateAnnotations are recorded in the Metadata of the artifact.
 func (s *Storage) NewArtifactFor(kind string, metadata metav1.Object, revision, fileName string) v1.Artifact {
 	path := v1.ArtifactPath(kind, metadata.GetNamespace(), metadata.GetName(), fileName)
 	artifact := v1.Artifact{
 		Path:     path,
 		Revision: revision,
+		Metadata: s.propagatedAnnotations(metadata.GetAnnotations()),
 	}
 	s.SetArtifactURL(&artifact)
 	return artifact
 }
 
+// propagatedAnnotations returns the given annotations with a key matching any of the PropagateAnnotations, or nil if
+// none match.
+func (s *Storage) propagatedAnnotations(annotations map[string]string) map[string]string {
+	var propagated map[string]string
+	for k, v := range annotations {
+		for _, pattern := range s.PropagateAnnotations {
+			if ok, _ := path.Match(pattern, k); ok {
+				if propagated == nil {
+					propagated = make(map[string]string)
+				}
+				propagated[k] = v
+				break
+			}
+		}
+	}
+	return propagated
+}
+
 // SetArtifactURL sets the URL on the given v1.Artifact.
-func (s Storage) SetArtifactURL(artifact *v1.Artifact) {
+func (s *Storage) SetArtifactURL(artifact *v1.Artifact) {
 	if artifact.Path == "" {
 		return
 	}
+	if s.ExternalURL != "" {
+		artifact.URL = s.externalURL(artifact.Path)
+		return
+	}
 	format := "http://%s/%s"
 	if strings.HasPrefix(s.Hostname, "http://") || strings.HasPrefix(s.Hostname, "https://") {
 		format = "%s/%s"
@@ -106,19 +206,50 @@ func (s Storage) SetArtifactURL(artifact *v1.Artifact) {
 	artifact.URL = fmt.Sprintf(format, s.Hostname, strings.TrimLeft(artifact.Path, "/"))
 }
 
+// UpdateArtifactURL sets the URL of the given v1.Artifact as SetArtifactURL does. It returns the previous URL of the
+// artifact and true if it was set and has been corrected, e.g. after a change of the Storage hostname.
+func (s *Storage) UpdateArtifactURL(artifact *v1.Artifact) (string, bool) {
+	previousURL := artifact.URL
+	s.SetArtifactURL(artifact)
+	return previousURL, previousURL != "" && artifact.URL != previousURL
+}
+
 // SetHostname sets the hostname of the given URL string to the current Storage.Hostname and returns the result.
-func (s Storage) SetHostname(URL string) string {
+// If an ExternalURL is configured, the scheme and host of the given URL are set to those of the ExternalURL instead.
+func (s *Storage) SetHostname(URL string) string {
 	u, err := url.Parse(URL)
 	if err != nil {
 		return ""
 	}
+	if s.ExternalURL != "" {
+		ext, err := url.Parse(s.ExternalURL)
+		if err != nil {
+			return ""
+		}
+		u.Scheme, u.Host = ext.Scheme, ext.Host
+		return u.String()
+	}
 	u.Host = s.Hostname
 	return u.String()
 }
 
+// externalURL returns the URL of the given path relative to the ExternalURL.
+func (s *Storage) externalURL(p string) string {
+	return strings.TrimRight(s.ExternalURL, "/") + "/" + strings.TrimLeft(p, "/")
+}
+
 // MkdirAll calls os.MkdirAll for the given v1.Artifact base dir.
+// Any deferred removal of the dir is cancelled, as it is in use again.
 func (s *Storage) MkdirAll(artifact v1.Artifact) error {
 	dir := filepath.Dir(s.LocalPath(artifact))
+	s.deferredRemovalsMu.Lock()
+	defer s.deferredRemovalsMu.Unlock()
+	if _, ok := s.deferredRemovals[dir]; ok {
+		if err := os.Remove(filepath.Join(dir, deferredRemovalMarker)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(s.deferredRemovals, dir)
+	}
 	return os.MkdirAll(dir, 0o700)
 }
 
@@ -131,9 +262,125 @@ func (s *Storage) RemoveAll(artifact v1.Artifact) (string, error) {
 	if err == nil {
 		deletedDir = dir
 	}
+	s.verifiedArtifactsMu.Lock()
+	delete(s.verifiedArtifacts, dir)
+	s.verifiedArtifactsMu.Unlock()
 	return deletedDir, os.RemoveAll(dir)
 }
 
+// DeferRemoveAll schedules the removal of the given v1.Artifact base dir
+// after the FinalizerGCGrace by SweepDeferredRemovals, and returns the dir if
+// it exists. The schedule is recorded in a marker file in the dir, which is
+// loaded by LoadDeferredRemovals. Without a grace period, it removes the dir
+// immediately using RemoveAll.
+func (s *Storage) DeferRemoveAll(artifact v1.Artifact) (string, error) {
+	if s.FinalizerGCGrace <= 0 {
+		return s.RemoveAll(artifact)
+	}
+
+	dir := filepath.Dir(s.LocalPath(artifact))
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	s.deferredRemovalsMu.Lock()
+	defer s.deferredRemovalsMu.Unlock()
+	if s.deferredRemovals == nil {
+		s.deferredRemovals = make(map[string]time.Time)
+	}
+	if _, ok := s.deferredRemovals[dir]; !ok {
+		after := time.Now().Add(s.FinalizerGCGrace)
+		if err := os.WriteFile(filepath.Join(dir, deferredRemovalMarker), []byte(after.UTC().Format(time.RFC3339)), 0o600); err != nil {
+			return "", err
+		}
+		s.deferredRemovals[dir] = after
+	}
+	return dir, nil
+}
+
+// LoadDeferredRemovals schedules the removal of the dirs with a marker file
+// written by DeferRemoveAll, e.g. before the controller was restarted, at the
+// time recorded in the marker. Without a grace period, or when the time can
+// not be parsed, the dirs are due for removal on the next
+// SweepDeferredRemovals.
+func (s *Storage) LoadDeferredRemovals() error {
+	s.deferredRemovalsMu.Lock()
+	defer s.deferredRemovalsMu.Unlock()
+
+	var errs []error
+	_ = filepath.WalkDir(s.BasePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if d.Name() != deferredRemovalMarker || !d.Type().IsRegular() {
+			return nil
+		}
+		var after time.Time
+		if s.FinalizerGCGrace > 0 {
+			if b, err := os.ReadFile(p); err == nil {
+				after, _ = time.Parse(time.RFC3339, strings.TrimSpace(string(b)))
+			}
+		}
+		if s.deferredRemovals == nil {
+			s.deferredRemovals = make(map[string]time.Time)
+		}
+		s.deferredRemovals[filepath.Dir(p)] = after
+		return nil
+	})
+	return kerrors.NewAggregate(errs)
+}
+
+// SweepDeferredRemovals removes the dirs scheduled for removal by
+// DeferRemoveAll of which the grace period has passed, and returns the
+// removed dirs. Dirs which failed to be removed are retried on the next
+// sweep.
+func (s *Storage) SweepDeferredRemovals() ([]string, error) {
+	s.deferredRemovalsMu.Lock()
+	defer s.deferredRemovalsMu.Unlock()
+
+	var removed []string
+	var errs []error
+	now := time.Now()
+	for dir, after := range s.deferredRemovals {
+		if now.Before(after) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(s.deferredRemovals, dir)
+		removed = append(removed, dir)
+	}
+	sort.Strings(removed)
+	return removed, kerrors.NewAggregate(errs)
+}
+
+// StartDeferredRemovalSweeper calls SweepDeferredRemovals at the given
+// interval, until the context is cancelled.
+func (s *Storage) StartDeferredRemovalSweeper(ctx context.Context, interval time.Duration, log logr.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.SweepDeferredRemovals()
+			if err != nil {
+				log.Error(err, "failed to remove deferred artifacts")
+			}
+			if len(removed) > 0 {
+				log.Info(fmt.Sprintf("removed %d deferred artifact directories", len(removed)))
+			}
+		}
+	}
+}
+
 // RemoveAllButCurrent removes all files for the given v1.Artifact base dir, excluding the current one.
 func (s *Storage) RemoveAllButCurrent(artifact v1.Artifact) ([]string, error) {
 	deletedFiles := []string{}
@@ -146,7 +393,9 @@ func (s *Storage) RemoveAllButCurrent(artifact v1.Artifact) ([]string, error) {
 			return nil
 		}
 
-		if path != localPath && !info.IsDir() && info.Mode()&os.ModeSymlink != os.ModeSymlink {
+		if path != localPath && path != tree.SidecarPath(localPath) && filepath.Base(path) != rawIndexFileName &&
+			filepath.Base(path) != valuesFileName &&
+			!info.IsDir() && info.Mode()&os.ModeSymlink != os.ModeSymlink {
 			if err := os.Remove(path); err != nil {
 				errors = append(errors, info.Name())
 			} else {
@@ -198,7 +447,9 @@ func (s *Storage) getGarbageFiles(artifact v1.Artifact, totalCountLimit, maxItem
 		// below logic just deals with determining if an artifact needs to be garbage collected,
 		// we avoid all lock files, adding them at the end to the list of garbage files.
 		expired := diff > ttl
-		if !info.IsDir() && info.Mode()&os.ModeSymlink != os.ModeSymlink && filepath.Ext(path) != ".lock" {
+		if !info.IsDir() && info.Mode()&os.ModeSymlink != os.ModeSymlink && filepath.Ext(path) != ".lock" &&
+			!strings.HasSuffix(path, tree.FileSuffix) && filepath.Base(path) != rawIndexFileName &&
+			filepath.Base(path) != valuesFileName {
 			if path != localPath && expired {
 				garbageFiles = append(garbageFiles, path)
 			}
@@ -253,9 +504,27 @@ func (s *Storage) getGarbageFiles(artifact v1.Artifact, totalCountLimit, maxItem
 	return garbageFiles, nil
 }
 
+// retention returns the maximum number of artifacts to be retained and their
+// TTL for the given v1.ArtifactGC, falling back to the defaults of the Storage
+// for the values which are not set.
+func (s *Storage) retention(gc *v1.ArtifactGC) (int, time.Duration) {
+	records, ttl := s.ArtifactRetentionRecords, s.ArtifactRetentionTTL
+	if gc != nil {
+		if gc.RetainRecords != nil {
+			records = int(*gc.RetainRecords)
+		}
+		if gc.RetainTTL != nil {
+			ttl = gc.RetainTTL.Duration
+		}
+	}
+	return records, ttl
+}
+
 // GarbageCollect removes all garbage files in the artifact dir according to the provided
-// retention options.
-func (s *Storage) GarbageCollect(ctx context.Context, artifact v1.Artifact, timeout time.Duration) ([]string, error) {
+// retention options. The retention configured in the given v1.ArtifactGC takes
+// precedence over the defaults of the Storage, and may be nil.
+func (s *Storage) GarbageCollect(ctx context.Context, artifact v1.Artifact, gc *v1.ArtifactGC, timeout time.Duration) ([]string, error) {
+	records, ttl := s.retention(gc)
 	delFilesChan := make(chan []string)
 	errChan := make(chan error)
 	// Abort if it takes more than the provided timeout duration.
@@ -263,7 +532,7 @@ func (s *Storage) GarbageCollect(ctx context.Context, artifact v1.Artifact, time
 	defer cancel()
 
 	go func() {
-		garbageFiles, err := s.getGarbageFiles(artifact, GarbageCountLimit, s.ArtifactRetentionRecords, s.ArtifactRetentionTTL)
+		garbageFiles, err := s.getGarbageFiles(artifact, GarbageCountLimit, records, ttl)
 		if err != nil {
 			errChan <- err
 			return
@@ -286,6 +555,14 @@ func (s *Storage) GarbageCollect(ctx context.Context, artifact v1.Artifact, time
 						errors = append(errors, err)
 					}
 				}
+				// If a tree file exists for this garbage artifact, remove that too.
+				treeFile := tree.SidecarPath(file)
+				if _, err = os.Lstat(treeFile); err == nil {
+					err = os.Remove(treeFile)
+					if err != nil {
+						errors = append(errors, err)
+					}
+				}
 			}
 		}
 		if len(errors) > 0 {
@@ -325,6 +602,93 @@ func (s *Storage) ArtifactExist(artifact v1.Artifact) bool {
 	return fi.Mode().IsRegular()
 }
 
+// ArtifactMissing returns true if the given v1.Artifact does not exist in the Storage, and has not been found for more
+// than ArtifactFailureThreshold consecutive times. This allows transient storage failures to be tolerated, before the
+// artifact is discarded.
+func (s *Storage) ArtifactMissing(artifact v1.Artifact) bool {
+	s.artifactFailuresMu.Lock()
+	defer s.artifactFailuresMu.Unlock()
+
+	if s.ArtifactExist(artifact) {
+		delete(s.artifactFailures, artifact.Path)
+		return false
+	}
+
+	if s.artifactFailures == nil {
+		s.artifactFailures = make(map[string]int)
+	}
+	s.artifactFailures[artifact.Path]++
+	if s.artifactFailures[artifact.Path] <= s.ArtifactFailureThreshold {
+		return false
+	}
+	delete(s.artifactFailures, artifact.Path)
+	return true
+}
+
+// VerifyArtifact verifies that the file of the given v1.Artifact in the Storage matches the Digest of the artifact,
+// using the algorithm encoded in the digest. This allows the digest algorithm of the Storage to be changed without
+// invalidating existing artifacts. A digest without an algorithm prefix is verified as a SHA-256 checksum, and an
+// artifact without a digest is not verified.
+// The file is only hashed again when its size or modification time changed since it was last verified against the
+// same digest.
+func (s *Storage) VerifyArtifact(artifact v1.Artifact) error {
+	if artifact.Digest == "" {
+		return nil
+	}
+
+	d, err := intdigest.Parse(artifact.Digest)
+	if err != nil {
+		return fmt.Errorf("failed to parse artifact digest '%s': %w", artifact.Digest, err)
+	}
+
+	localPath := s.LocalPath(artifact)
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	verified := verifiedArtifact{path: localPath, digest: d, size: fi.Size(), modTime: fi.ModTime()}
+
+	dir := filepath.Dir(localPath)
+	s.verifiedArtifactsMu.Lock()
+	cached, ok := s.verifiedArtifacts[dir]
+	s.verifiedArtifactsMu.Unlock()
+	if ok && cached == verified {
+		return nil
+	}
+
+	verifier := d.Verifier()
+	if _, err = io.Copy(verifier, f); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("computed digest doesn't match '%s'", d.String())
+	}
+
+	s.verifiedArtifactsMu.Lock()
+	defer s.verifiedArtifactsMu.Unlock()
+	if s.verifiedArtifacts == nil {
+		s.verifiedArtifacts = make(map[string]verifiedArtifact)
+	}
+	s.verifiedArtifacts[dir] = verified
+	return nil
+}
+
+// ArtifactDigestMismatch returns an error if the file of the given v1.Artifact exists in the Storage, but does not
+// match the Digest of the artifact as verified by VerifyArtifact. It returns nil for a nil artifact, or an artifact
+// which does not exist in the Storage.
+func (s *Storage) ArtifactDigestMismatch(artifact *v1.Artifact) error {
+	if artifact == nil || !s.ArtifactExist(*artifact) {
+		return nil
+	}
+	return s.VerifyArtifact(*artifact)
+}
+
 // ArchiveFileFilter must return true if a file should not be included in the archive after inspecting the given path
 // and/or os.FileInfo.
 type ArchiveFileFilter func(p string, fi os.FileInfo) bool
@@ -343,14 +707,178 @@ func SourceIgnoreFilter(ps []gitignore.Pattern, domain []string) ArchiveFileFilt
 	}
 }
 
+// IgnoredPaths records the paths which are excluded from an artifact by
+// ignore rules.
+type IgnoredPaths struct {
+	// Count is the number of ignored paths. The contents of an ignored
+	// directory are not counted separately.
+	Count int64
+	// Sample contains the first SampleSize ignored paths.
+	Sample []string
+	// SampleSize is the maximum number of paths recorded in Sample.
+	SampleSize int
+
+	lastDir string
+}
+
+// Add records the given slash-separated path as ignored, unless it is within
+// the last recorded directory.
+func (i *IgnoredPaths) Add(p string, isDir bool) {
+	if i.lastDir != "" && strings.HasPrefix(p, i.lastDir+"/") {
+		return
+	}
+	if isDir {
+		i.lastDir = p
+	}
+	i.Count++
+	if len(i.Sample) < i.SampleSize {
+		i.Sample = append(i.Sample, p)
+	}
+}
+
+// Filter returns an ArchiveFileFilter which records the paths within dir
+// filtered out by the given filter.
+func (i *IgnoredPaths) Filter(dir string, filter ArchiveFileFilter) ArchiveFileFilter {
+	return func(p string, fi os.FileInfo) bool {
+		if !filter(p, fi) {
+			return false
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			rel = p
+		}
+		i.Add(filepath.ToSlash(rel), fi.IsDir())
+		return true
+	}
+}
+
+// ArtifactOption is an option for the Storage operations which write the file
+// of an artifact.
+type ArtifactOption func(*artifactOptions)
+
+type artifactOptions struct {
+	digestAlgorithm digest.Algorithm
+	expectedSize    int64
+}
+
+// WithDigestAlgorithm configures the algorithm of the digest calculated for
+// the artifact, instead of intdigest.Canonical. An empty algorithm is ignored.
+func WithDigestAlgorithm(algo digest.Algorithm) ArtifactOption {
+	return func(o *artifactOptions) {
+		if algo != "" {
+			o.digestAlgorithm = algo
+		}
+	}
+}
+
+// WithExpectedSize configures the expected size in bytes of the artifact,
+// which is taken into account when checking the free space before writing.
+// A negative size is ignored.
+func WithExpectedSize(size int64) ArtifactOption {
+	return func(o *artifactOptions) {
+		if size >= 0 {
+			o.expectedSize = size
+		}
+	}
+}
+
+// artifactSize returns the size of the given artifact, or zero if the
+// artifact is nil or has no size recorded.
+func artifactSize(artifact *v1.Artifact) int64 {
+	if artifact == nil || artifact.Size == nil {
+		return 0
+	}
+	return *artifact.Size
+}
+
+// storageFailedReason returns the reason for the failure of a Storage write
+// operation with the given error.
+func storageFailedReason(err error) string {
+	if errors.Is(err, ErrInsufficientStorage) {
+		return v1.InsufficientStorageReason
+	}
+	return v1.ArchiveOperationFailedReason
+}
+
+// checkFreeSpace returns ErrInsufficientStorage if the available space on
+// the BasePath is less than the given size plus the FreeSpaceMargin. The
+// check is skipped when the FreeSpaceMargin is not set, or the available
+// space can not be determined on the platform.
+func (s *Storage) checkFreeSpace(size int64) error {
+	if s.FreeSpaceMargin <= 0 {
+		return nil
+	}
+	avail, err := availableSpace(s.BasePath)
+	if err != nil {
+		if errors.Is(err, sourcefs.ErrAvailableSpaceUnsupported) {
+			return nil
+		}
+		return fmt.Errorf("failed to determine available space on '%s': %w", s.BasePath, err)
+	}
+	if required := uint64(size) + uint64(s.FreeSpaceMargin); avail < required {
+		return fmt.Errorf("%w: %d bytes available on '%s', %d bytes required",
+			ErrInsufficientStorage, avail, s.BasePath, required)
+	}
+	return nil
+}
+
+// CheckWritable returns an error if a file can not be written to the
+// BasePath, e.g. because the volume is mounted read-only or is full, or if
+// less space than the FreeSpaceMargin is available. It writes and removes a
+// small temporary file.
+func (s *Storage) CheckWritable() error {
+	if err := s.checkFreeSpace(0); err != nil {
+		return err
+	}
+
+	tf, err := os.CreateTemp(s.BasePath, ".writable-")
+	if err != nil {
+		return fmt.Errorf("failed to create file in storage path '%s': %w", s.BasePath, err)
+	}
+	defer os.Remove(tf.Name())
+	if _, err = tf.Write([]byte("ok")); err == nil {
+		// Sync to surface write errors of a full volume, which are
+		// otherwise only returned when the data is flushed.
+		err = tf.Sync()
+	}
+	if closeErr := tf.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file in storage path '%s': %w", s.BasePath, err)
+	}
+	return nil
+}
+
+// makeArtifactOptions applies the given options, and returns an error if the
+// configured digest algorithm is not available.
+func makeArtifactOptions(opts []ArtifactOption) (artifactOptions, error) {
+	o := artifactOptions{digestAlgorithm: intdigest.Canonical}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.digestAlgorithm.Available() {
+		return o, fmt.Errorf("%w: %s", digest.ErrDigestUnsupported, o.digestAlgorithm)
+	}
+	return o, nil
+}
+
 // Archive atomically archives the given directory as a tarball to the given v1.Artifact path, excluding
 // directories and any ArchiveFileFilter matches. While archiving, any environment specific data (for example,
 // the user and group name) is stripped from file headers.
+// Symlinks are handled according to the given symlinkPolicy, which defaults to v1.SymlinkPolicyIgnore when empty.
 // If successful, it sets the digest and last update time on the artifact.
-func (s *Storage) Archive(artifact *v1.Artifact, dir string, filter ArchiveFileFilter) (err error) {
+func (s *Storage) Archive(artifact *v1.Artifact, dir string, filter ArchiveFileFilter, symlinkPolicy string, opts ...ArtifactOption) (err error) {
 	if f, err := os.Stat(dir); os.IsNotExist(err) || !f.IsDir() {
 		return fmt.Errorf("invalid dir path: %s", dir)
 	}
+	o, err := makeArtifactOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := s.checkFreeSpace(o.expectedSize); err != nil {
+		return err
+	}
 
 	localPath := s.LocalPath(*artifact)
 	tf, err := os.CreateTemp(filepath.Split(localPath))
@@ -364,74 +892,23 @@ func (s *Storage) Archive(artifact *v1.Artifact, dir string, filter ArchiveFileF
 		}
 	}()
 
-	d := intdigest.Canonical.Digester()
+	d := o.digestAlgorithm.Digester()
 	sz := &writeCounter{}
 	mw := io.MultiWriter(d.Hash(), tf, sz)
 
 	gw := gzip.NewWriter(mw)
 	tw := tar.NewWriter(gw)
-	if err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
-		if err != nil {
+	w := &archiveWalker{tw: tw, dir: dir, filter: filter, symlinkPolicy: symlinkPolicy}
+	if symlinkPolicy == v1.SymlinkPolicyFollow {
+		if w.realDir, err = filepath.EvalSymlinks(dir); err != nil {
+			tw.Close()
+			gw.Close()
+			tf.Close()
 			return err
 		}
-
-		// Ignore anything that is not a file or directories e.g. symlinks
-		if m := fi.Mode(); !(m.IsRegular() || m.IsDir()) {
-			return nil
-		}
-
-		// Skip filtered files
-		if filter != nil && filter(p, fi) {
-			return nil
-		}
-
-		header, err := tar.FileInfoHeader(fi, p)
-		if err != nil {
-			return err
-		}
-		// The name needs to be modified to maintain directory structure
-		// as tar.FileInfoHeader only has access to the base name of the file.
-		// Ref: https://golang.org/src/archive/tar/common.go?#L626
-		relFilePath := p
-		if filepath.IsAbs(dir) {
-			relFilePath, err = filepath.Rel(dir, p)
-			if err != nil {
-				return err
-			}
-		}
-		header.Name = relFilePath
-
-		// We want to remove any environment specific data as well, this
-		// ensures the checksum is purely content based.
-		header.Gid = 0
-		header.Uid = 0
-		header.Uname = ""
-		header.Gname = ""
-		header.ModTime = time.Time{}
-		header.AccessTime = time.Time{}
-		header.ChangeTime = time.Time{}
-		header.Mode = defaultFileMode
-		if fi.Mode().IsDir() {
-			header.Mode = defaultDirMode
-		}
-
-		if err := tw.WriteHeader(header); err != nil {
-			return err
-		}
-
-		if !fi.Mode().IsRegular() {
-			return nil
-		}
-		f, err := os.Open(p)
-		if err != nil {
-			f.Close()
-			return err
-		}
-		if _, err := io.Copy(tw, f); err != nil {
-			f.Close()
-			return err
-		}
-		return f.Close()
+	}
+	if err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		return w.walk(p, p, fi, err, nil)
 	}); err != nil {
 		tw.Close()
 		gw.Close()
@@ -448,7 +925,7 @@ func (s *Storage) Archive(artifact *v1.Artifact, dir string, filter ArchiveFileF
 		tf.Close()
 		return err
 	}
-	if err := tf.Close(); err != nil {
+	if err := syncAndClose(tf); err != nil {
 		return err
 	}
 
@@ -460,6 +937,17 @@ func (s *Storage) Archive(artifact *v1.Artifact, dir string, filter ArchiveFileF
 		return err
 	}
 
+	if s.ArtifactTreeHash {
+		t, err := writeTree(localPath, o.digestAlgorithm)
+		if err != nil {
+			return fmt.Errorf("failed to write tree of artifact: %w", err)
+		}
+		if artifact.Metadata == nil {
+			artifact.Metadata = make(map[string]string)
+		}
+		artifact.Metadata[tree.RootMetadataKey] = t.Root.String()
+	}
+
 	artifact.Digest = d.Digest().String()
 	artifact.LastUpdateTime = metav1.Now()
 	artifact.Size = &sz.written
@@ -467,9 +955,199 @@ func (s *Storage) Archive(artifact *v1.Artifact, dir string, filter ArchiveFileF
 	return nil
 }
 
+// writeTree computes the tree.Tree of the tarball at the given path,
+// atomically writes it as JSON to the tree.SidecarPath, and returns it.
+func writeTree(p string, algo digest.Algorithm) (*tree.Tree, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	t, err := tree.FromTarball(algo, f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	treePath := tree.SidecarPath(p)
+	tf, err := os.CreateTemp(filepath.Split(treePath))
+	if err != nil {
+		return nil, err
+	}
+	tmpName := tf.Name()
+	if _, err = tf.Write(b); err != nil {
+		tf.Close()
+		os.Remove(tmpName)
+		return nil, err
+	}
+	if err = syncAndClose(tf); err != nil {
+		os.Remove(tmpName)
+		return nil, err
+	}
+	if err = os.Chmod(tmpName, 0o600); err != nil {
+		os.Remove(tmpName)
+		return nil, err
+	}
+	if err = sourcefs.RenameWithFallback(tmpName, treePath); err != nil {
+		os.Remove(tmpName)
+		return nil, err
+	}
+	return t, nil
+}
+
+// archiveWalker writes the files and directories it walks to a tar.Writer,
+// handling symlinks according to its symlinkPolicy.
+type archiveWalker struct {
+	tw            *tar.Writer
+	dir           string
+	realDir       string
+	filter        ArchiveFileFilter
+	symlinkPolicy string
+}
+
+// walk writes the file or directory at src with the given os.FileInfo to the
+// tar.Writer under the name of path p within the archived directory. When
+// following symlinks, followed contains the targets of the directory
+// symlinks which are currently being followed to detect loops.
+func (w *archiveWalker) walk(p, src string, fi os.FileInfo, err error, followed []string) error {
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		switch w.symlinkPolicy {
+		case v1.SymlinkPolicyError:
+			return fmt.Errorf("symlink '%s' is not allowed", w.relPath(p))
+		case v1.SymlinkPolicyFollow:
+			return w.follow(p, src, followed)
+		default:
+			return nil
+		}
+	}
+
+	// Ignore anything that is not a file or directories e.g. devices
+	if m := fi.Mode(); !(m.IsRegular() || m.IsDir()) {
+		return nil
+	}
+
+	// Skip filtered files
+	if w.filter != nil && w.filter(p, fi) {
+		return nil
+	}
+
+	header, err := tar.FileInfoHeader(fi, src)
+	if err != nil {
+		return err
+	}
+	header.Name = w.relPath(p)
+
+	// We want to remove any environment specific data as well, this
+	// ensures the checksum is purely content based.
+	header.Gid = 0
+	header.Uid = 0
+	header.Uname = ""
+	header.Gname = ""
+	header.ModTime = time.Time{}
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Mode = defaultFileMode
+	if fi.Mode().IsDir() {
+		header.Mode = defaultDirMode
+	}
+
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w.tw, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// follow resolves the symlink at src, and walks its target under the name of
+// path p. It returns an error if the target is outside the archived
+// directory, or if following it results in a loop.
+func (w *archiveWalker) follow(p, src string, followed []string) error {
+	target, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return fmt.Errorf("failed to resolve symlink '%s': %w", w.relPath(p), err)
+	}
+	if rel, err := filepath.Rel(w.realDir, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("symlink '%s' points outside of the archived directory", w.relPath(p))
+	}
+
+	fi, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return w.walk(p, target, fi, nil, followed)
+	}
+
+	// A directory symlink pointing to itself or one of its parents, or to a
+	// directory which is already being followed, would be walked endlessly.
+	parent, err := filepath.EvalSymlinks(filepath.Dir(src))
+	if err != nil {
+		return err
+	}
+	for _, d := range append([]string{parent}, followed...) {
+		if d == target || strings.HasPrefix(d, target+string(filepath.Separator)) {
+			return fmt.Errorf("symlink '%s' results in a loop", w.relPath(p))
+		}
+	}
+	followed = append([]string{target}, followed...)
+
+	return filepath.Walk(target, func(tp string, tfi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(target, tp)
+		if err != nil {
+			return err
+		}
+		return w.walk(filepath.Join(p, rel), tp, tfi, nil, followed)
+	})
+}
+
+// relPath returns the name of path p in the archive.
+func (w *archiveWalker) relPath(p string) string {
+	// The name needs to be modified to maintain directory structure
+	// as tar.FileInfoHeader only has access to the base name of the file.
+	// Ref: https://golang.org/src/archive/tar/common.go?#L626
+	if filepath.IsAbs(w.dir) {
+		if rel, err := filepath.Rel(w.dir, p); err == nil {
+			return rel
+		}
+	}
+	return p
+}
+
 // AtomicWriteFile atomically writes the io.Reader contents to the v1.Artifact path.
+// The contents are written to a temporary file in the same directory, which is
+// synced to disk before being renamed to the Artifact path. On any error, the
+// temporary file is removed and an existing file at the Artifact path is left
+// untouched.
 // If successful, it sets the digest and last update time on the artifact.
-func (s *Storage) AtomicWriteFile(artifact *v1.Artifact, reader io.Reader, mode os.FileMode) (err error) {
+func (s *Storage) AtomicWriteFile(artifact *v1.Artifact, reader io.Reader, mode os.FileMode, opts ...ArtifactOption) (err error) {
+	o, err := makeArtifactOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := s.checkFreeSpace(o.expectedSize); err != nil {
+		return err
+	}
 	localPath := s.LocalPath(*artifact)
 	tf, err := os.CreateTemp(filepath.Split(localPath))
 	if err != nil {
@@ -482,7 +1160,7 @@ func (s *Storage) AtomicWriteFile(artifact *v1.Artifact, reader io.Reader, mode
 		}
 	}()
 
-	d := intdigest.Canonical.Digester()
+	d := o.digestAlgorithm.Digester()
 	sz := &writeCounter{}
 	mw := io.MultiWriter(tf, d.Hash(), sz)
 
@@ -490,7 +1168,7 @@ func (s *Storage) AtomicWriteFile(artifact *v1.Artifact, reader io.Reader, mode
 		tf.Close()
 		return err
 	}
-	if err := tf.Close(); err != nil {
+	if err := syncAndClose(tf); err != nil {
 		return err
 	}
 
@@ -511,7 +1189,14 @@ func (s *Storage) AtomicWriteFile(artifact *v1.Artifact, reader io.Reader, mode
 
 // Copy atomically copies the io.Reader contents to the v1.Artifact path.
 // If successful, it sets the digest and last update time on the artifact.
-func (s *Storage) Copy(artifact *v1.Artifact, reader io.Reader) (err error) {
+func (s *Storage) Copy(artifact *v1.Artifact, reader io.Reader, opts ...ArtifactOption) (err error) {
+	o, err := makeArtifactOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := s.checkFreeSpace(o.expectedSize); err != nil {
+		return err
+	}
 	localPath := s.LocalPath(*artifact)
 	tf, err := os.CreateTemp(filepath.Split(localPath))
 	if err != nil {
@@ -524,7 +1209,7 @@ func (s *Storage) Copy(artifact *v1.Artifact, reader io.Reader) (err error) {
 		}
 	}()
 
-	d := intdigest.Canonical.Digester()
+	d := o.digestAlgorithm.Digester()
 	sz := &writeCounter{}
 	mw := io.MultiWriter(tf, d.Hash(), sz)
 
@@ -532,7 +1217,7 @@ func (s *Storage) Copy(artifact *v1.Artifact, reader io.Reader) (err error) {
 		tf.Close()
 		return err
 	}
-	if err := tf.Close(); err != nil {
+	if err := syncAndClose(tf); err != nil {
 		return err
 	}
 
@@ -548,8 +1233,9 @@ func (s *Storage) Copy(artifact *v1.Artifact, reader io.Reader) (err error) {
 }
 
 // CopyFromPath atomically copies the contents of the given path to the path of the v1.Artifact.
+// Unless configured otherwise, the size of the file is used as the expected size of the artifact.
 // If successful, the digest and last update time on the artifact is set.
-func (s *Storage) CopyFromPath(artifact *v1.Artifact, path string) (err error) {
+func (s *Storage) CopyFromPath(artifact *v1.Artifact, path string, opts ...ArtifactOption) (err error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return err
@@ -559,7 +1245,10 @@ func (s *Storage) CopyFromPath(artifact *v1.Artifact, path string) (err error) {
 			err = cerr
 		}
 	}()
-	err = s.Copy(artifact, f)
+	if fi, err := f.Stat(); err == nil {
+		opts = append([]ArtifactOption{WithExpectedSize(fi.Size())}, opts...)
+	}
+	err = s.Copy(artifact, f, opts...)
 	return err
 }
 
@@ -621,6 +1310,9 @@ func (s *Storage) Symlink(artifact v1.Artifact, linkName string) (string, error)
 		return "", err
 	}
 
+	if s.ExternalURL != "" {
+		return s.externalURL(filepath.Join(filepath.Dir(artifact.Path), linkName)), nil
+	}
 	return fmt.Sprintf("http://%s/%s", s.Hostname, filepath.Join(filepath.Dir(artifact.Path), linkName)), nil
 }
 
@@ -654,3 +1346,14 @@ func (wc *writeCounter) Write(p []byte) (int, error) {
 	wc.written += int64(n)
 	return n, nil
 }
+
+// syncAndClose commits the contents of the given file to stable storage before
+// closing it, to ensure a subsequent rename does not expose a partially
+// written file after a crash.
+func syncAndClose(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+func TestStorage_CopyFromPath_insufficientStorage(t *testing.T) {
+	g := NewWithT(t)
+
+	// Mount a small tmpfs as the storage path, which requires privileges.
+	basePath := t.TempDir()
+	if err := syscall.Mount("tmpfs", basePath, "tmpfs", 0, "size=1m"); err != nil {
+		t.Skipf("unable to mount tmpfs: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = syscall.Unmount(basePath, 0)
+	})
+
+	storage, err := NewStorage(basePath, "hostname", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+	storage.FreeSpaceMargin = 64 * 1024
+
+	src := filepath.Join(t.TempDir(), "chart.tgz")
+	g.Expect(os.WriteFile(src, make([]byte, 2*1024*1024), 0o600)).To(Succeed())
+
+	artifact := sourcev1.Artifact{Path: filepath.Join("helmchart", "chart.tgz")}
+	g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+	err = storage.CopyFromPath(&artifact, src)
+	g.Expect(err).To(MatchError(ErrInsufficientStorage))
+	g.Expect(storageFailedReason(err)).To(Equal(sourcev1.InsufficientStorageReason))
+
+	// The write failed before creating a temporary file.
+	entries, err := os.ReadDir(filepath.Dir(storage.LocalPath(artifact)))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(BeEmpty())
+}
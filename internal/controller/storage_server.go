@@ -0,0 +1,120 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// StorageFileServer serves the files in the Storage over HTTP.
+//
+// A request for a symlink maintained with Storage.Symlink, e.g.
+// '/helmchart/<namespace>/<name>/latest.tar.gz', is redirected (302) to the
+// file of the artifact it points to, which allows consumers to retrieve the
+// current artifact without knowing its file name. The redirect is relative
+// to the requested path, so it is resolved correctly behind a proxy serving
+// the Storage at the ExternalURL.
+//
+// Regular files are served with an ETag, derived from their modification
+// time and size, so clients can make conditional (If-None-Match) and range
+// requests for them.
+type StorageFileServer struct {
+	storage *Storage
+	files   http.Handler
+}
+
+// NewStorageFileServer returns a new StorageFileServer for the given Storage.
+func NewStorageFileServer(storage *Storage) *StorageFileServer {
+	return &StorageFileServer{
+		storage: storage,
+		files:   http.FileServer(http.Dir(storage.BasePath)),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *StorageFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.files.ServeHTTP(w, r)
+		return
+	}
+
+	// The path is cleaned the same way as by http.Dir, but the last element
+	// is not resolved, to be able to detect symlinks.
+	localPath := filepath.Join(s.storage.BasePath, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+	fi, err := os.Lstat(localPath)
+	if err != nil {
+		s.files.ServeHTTP(w, r)
+		return
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, ok := s.symlinkTarget(localPath)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Location", target)
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	if fi.Mode().IsRegular() {
+		w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()))
+	}
+	s.files.ServeHTTP(w, r)
+}
+
+// symlinkTarget returns the target of the symlink at the given local path,
+// as a URL relative to the symlink. It returns false if the target can not
+// be read, or is outside the Storage.
+func (s *StorageFileServer) symlinkTarget(link string) (string, bool) {
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", false
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(link), target)
+	}
+
+	basePath, err := filepath.Abs(s.storage.BasePath)
+	if err != nil {
+		return "", false
+	}
+	if target, err = filepath.Abs(target); err != nil {
+		return "", false
+	}
+	if rel, err := filepath.Rel(basePath, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	link, err = filepath.Abs(link)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(filepath.Dir(link), target)
+	if err != nil {
+		return "", false
+	}
+	return (&url.URL{Path: filepath.ToSlash(rel)}).String(), true
+}
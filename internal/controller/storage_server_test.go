@@ -0,0 +1,134 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+func TestStorageFileServer(t *testing.T) {
+	g := NewWithT(t)
+
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	artifact := sourcev1.Artifact{Path: "helmchart/default/podinfo/podinfo-6.1.0.tgz"}
+	g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+	g.Expect(os.WriteFile(storage.LocalPath(artifact), []byte("chart content"), 0o600)).To(Succeed())
+	_, err = storage.Symlink(artifact, "latest.tar.gz")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// A symlink to a file outside the Storage is not followed.
+	outside := filepath.Join(t.TempDir(), "secret")
+	g.Expect(os.WriteFile(outside, []byte("secret"), 0o600)).To(Succeed())
+	g.Expect(os.Symlink(outside, filepath.Join(storage.BasePath, "helmchart/default/podinfo/outside.tar.gz"))).To(Succeed())
+
+	server := httptest.NewServer(NewStorageFileServer(storage))
+	t.Cleanup(server.Close)
+
+	noRedirect := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	t.Run("redirects latest symlink to artifact", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resp, err := noRedirect.Get(server.URL + "/helmchart/default/podinfo/latest.tar.gz")
+		g.Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		g.Expect(resp.StatusCode).To(Equal(http.StatusFound))
+		g.Expect(resp.Header.Get("Location")).To(Equal("podinfo-6.1.0.tgz"))
+		g.Expect(resp.Header.Get("Cache-Control")).To(Equal("no-cache"))
+	})
+
+	t.Run("serves artifact after redirect", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resp, err := http.Get(server.URL + "/helmchart/default/podinfo/latest.tar.gz")
+		g.Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		g.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		g.Expect(resp.Request.URL.Path).To(Equal("/" + artifact.Path))
+		g.Expect(resp.Header.Get("ETag")).ToNot(BeEmpty())
+		b, err := io.ReadAll(resp.Body)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(b)).To(Equal("chart content"))
+	})
+
+	t.Run("supports conditional requests", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resp, err := http.Get(server.URL + "/" + artifact.Path)
+		g.Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close()
+		etag := resp.Header.Get("ETag")
+		g.Expect(etag).ToNot(BeEmpty())
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/helmchart/default/podinfo/latest.tar.gz", nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("If-None-Match", etag)
+		resp, err = http.DefaultClient.Do(req)
+		g.Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close()
+		g.Expect(resp.StatusCode).To(Equal(http.StatusNotModified))
+	})
+
+	t.Run("supports range requests", func(t *testing.T) {
+		g := NewWithT(t)
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/helmchart/default/podinfo/latest.tar.gz", nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Range", "bytes=6-12")
+		resp, err := http.DefaultClient.Do(req)
+		g.Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		g.Expect(resp.StatusCode).To(Equal(http.StatusPartialContent))
+		b, err := io.ReadAll(resp.Body)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(b)).To(Equal("content"))
+	})
+
+	t.Run("does not follow symlink outside storage", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resp, err := noRedirect.Get(server.URL + "/helmchart/default/podinfo/outside.tar.gz")
+		g.Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close()
+		g.Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	t.Run("returns not found for missing file", func(t *testing.T) {
+		g := NewWithT(t)
+
+		resp, err := http.Get(server.URL + "/helmchart/default/missing/latest.tar.gz")
+		g.Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close()
+		g.Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+}
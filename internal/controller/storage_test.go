@@ -20,18 +20,26 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/fluxcd/go-git/v5/plumbing/format/gitignore"
 	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	intdigest "github.com/fluxcd/source-controller/internal/digest"
+	sourcefs "github.com/fluxcd/source-controller/internal/fs"
+	"github.com/fluxcd/source-controller/internal/tree"
 )
 
 func TestStorageConstructor(t *testing.T) {
@@ -58,6 +66,112 @@ func TestStorageConstructor(t *testing.T) {
 	}
 }
 
+func TestStorage_NewArtifactFor_propagateAnnotations(t *testing.T) {
+	annotations := map[string]string{
+		"example.com/team":     "platform",
+		"example.com/pipeline": "release",
+		"other.com/owner":      "someone",
+		"unrelated":            "value",
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     map[string]string
+	}{
+		{
+			name: "without patterns",
+		},
+		{
+			name:     "exact key",
+			patterns: []string{"other.com/owner"},
+			want: map[string]string{
+				"other.com/owner": "someone",
+			},
+		},
+		{
+			name:     "wildcard",
+			patterns: []string{"example.com/*"},
+			want: map[string]string{
+				"example.com/team":     "platform",
+				"example.com/pipeline": "release",
+			},
+		},
+		{
+			name:     "multiple patterns",
+			patterns: []string{"example.com/team", "other.com/*"},
+			want: map[string]string{
+				"example.com/team": "platform",
+				"other.com/owner":  "someone",
+			},
+		},
+		{
+			name:     "no match",
+			patterns: []string{"missing.com/*"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+			g.Expect(err).ToNot(HaveOccurred())
+			storage.PropagateAnnotations = tt.patterns
+
+			obj := &metav1.ObjectMeta{Namespace: "default", Name: "foo", Annotations: annotations}
+			artifact := storage.NewArtifactFor(sourcev1.GitRepositoryKind, obj, "revision", "artifact.tar.gz")
+			g.Expect(artifact.Metadata).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestStorage_externalURL(t *testing.T) {
+	g := NewWithT(t)
+
+	s, err := NewStorage(t.TempDir(), "source-controller.flux-system.svc.cluster.local.", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	obj := &metav1.ObjectMeta{Name: "podinfo", Namespace: "default"}
+	artifact := s.NewArtifactFor(sourcev1.GitRepositoryKind, obj, "main@sha1:1234", "1234.tar.gz")
+	g.Expect(artifact.URL).To(Equal("http://source-controller.flux-system.svc.cluster.local./gitrepository/default/podinfo/1234.tar.gz"))
+
+	s.ExternalURL = "https://artifacts.example.com"
+
+	artifact = s.NewArtifactFor(sourcev1.GitRepositoryKind, obj, "main@sha1:1234", "1234.tar.gz")
+	g.Expect(artifact.URL).To(Equal("https://artifacts.example.com/gitrepository/default/podinfo/1234.tar.gz"))
+
+	g.Expect(os.MkdirAll(filepath.Dir(s.LocalPath(artifact)), 0o750)).To(Succeed())
+	g.Expect(os.WriteFile(s.LocalPath(artifact), nil, 0o640)).To(Succeed())
+	url, err := s.Symlink(artifact, "latest.tar.gz")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(url).To(Equal("https://artifacts.example.com/gitrepository/default/podinfo/latest.tar.gz"))
+
+	g.Expect(s.SetHostname("http://source-controller.flux-system.svc.cluster.local./gitrepository/default/podinfo/latest.tar.gz")).
+		To(Equal("https://artifacts.example.com/gitrepository/default/podinfo/latest.tar.gz"))
+}
+
+func TestStorage_UpdateArtifactURL(t *testing.T) {
+	g := NewWithT(t)
+
+	s, err := NewStorage(t.TempDir(), "source-controller.flux-system.svc.cluster.local.", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	artifact := sourcev1.Artifact{Path: "gitrepository/default/podinfo/1234.tar.gz"}
+	previousURL, ok := s.UpdateArtifactURL(&artifact)
+	g.Expect(ok).To(BeFalse())
+	g.Expect(previousURL).To(BeEmpty())
+	g.Expect(artifact.URL).To(Equal("http://source-controller.flux-system.svc.cluster.local./gitrepository/default/podinfo/1234.tar.gz"))
+
+	previousURL, ok = s.UpdateArtifactURL(&artifact)
+	g.Expect(ok).To(BeFalse())
+
+	s.Hostname = "source-controller.flux-system.svc"
+	previousURL, ok = s.UpdateArtifactURL(&artifact)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(previousURL).To(Equal("http://source-controller.flux-system.svc.cluster.local./gitrepository/default/podinfo/1234.tar.gz"))
+	g.Expect(artifact.URL).To(Equal("http://source-controller.flux-system.svc/gitrepository/default/podinfo/1234.tar.gz"))
+}
+
 // walks a tar.gz and looks for paths with the basename. It does not match
 // symlinks properly at this time because that's painful.
 func walkTar(tarFile string, match string, dir bool) (int64, int64, bool, error) {
@@ -257,7 +371,7 @@ func TestStorage_Archive(t *testing.T) {
 			if err := storage.MkdirAll(artifact); err != nil {
 				t.Fatalf("artifact directory creation failed: %v", err)
 			}
-			if err := storage.Archive(&artifact, dir, tt.filter); (err != nil) != tt.wantErr {
+			if err := storage.Archive(&artifact, dir, tt.filter, ""); (err != nil) != tt.wantErr {
 				t.Errorf("Archive() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			matchFiles(t, storage, artifact, tt.want, tt.wantDirs)
@@ -265,6 +379,364 @@ func TestStorage_Archive(t *testing.T) {
 	}
 }
 
+func TestStorage_Archive_symlinkPolicy(t *testing.T) {
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+	if err != nil {
+		t.Fatalf("error while bootstrapping storage: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		policy    string
+		symlinks  map[string]string
+		wantFiles []string
+		wantDirs  []string
+		wantErr   string
+	}{
+		{
+			name:   "ignore in-tree symlinks",
+			policy: sourcev1.SymlinkPolicyIgnore,
+			symlinks: map[string]string{
+				"link.yaml": "manifest.yaml",
+				"linkdir":   "dir",
+			},
+			wantFiles: []string{"manifest.yaml", "dir/file.yaml", "!link.yaml", "!linkdir/file.yaml"},
+			wantDirs:  []string{"dir", "!linkdir"},
+		},
+		{
+			name:   "ignore out-of-tree symlinks by default",
+			policy: "",
+			symlinks: map[string]string{
+				"outside.yaml": "../outside.yaml",
+			},
+			wantFiles: []string{"manifest.yaml", "!outside.yaml"},
+		},
+		{
+			name:   "follow in-tree symlinks",
+			policy: sourcev1.SymlinkPolicyFollow,
+			symlinks: map[string]string{
+				"link.yaml": "manifest.yaml",
+				"linkdir":   "dir",
+			},
+			wantFiles: []string{"manifest.yaml", "dir/file.yaml", "link.yaml", "linkdir/file.yaml"},
+			wantDirs:  []string{"dir", "linkdir"},
+		},
+		{
+			name:   "follow refuses out-of-tree symlinks",
+			policy: sourcev1.SymlinkPolicyFollow,
+			symlinks: map[string]string{
+				"outside.yaml": "../outside.yaml",
+			},
+			wantErr: "symlink 'outside.yaml' points outside of the archived directory",
+		},
+		{
+			name:   "follow refuses symlink loops",
+			policy: sourcev1.SymlinkPolicyFollow,
+			symlinks: map[string]string{
+				"dir/loop": "..",
+			},
+			wantErr: "symlink 'dir/loop' results in a loop",
+		},
+		{
+			name:   "error on in-tree symlinks",
+			policy: sourcev1.SymlinkPolicyError,
+			symlinks: map[string]string{
+				"link.yaml": "manifest.yaml",
+			},
+			wantErr: "symlink 'link.yaml' is not allowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			root := t.TempDir()
+			g.Expect(os.WriteFile(filepath.Join(root, "outside.yaml"), []byte("outside"), 0o640)).To(Succeed())
+			dir := filepath.Join(root, "source")
+			g.Expect(os.MkdirAll(filepath.Join(dir, "dir"), 0o750)).To(Succeed())
+			g.Expect(os.WriteFile(filepath.Join(dir, "manifest.yaml"), []byte("manifest"), 0o640)).To(Succeed())
+			g.Expect(os.WriteFile(filepath.Join(dir, "dir", "file.yaml"), []byte("file"), 0o640)).To(Succeed())
+			for name, target := range tt.symlinks {
+				g.Expect(os.Symlink(target, filepath.Join(dir, name))).To(Succeed())
+			}
+
+			artifact := sourcev1.Artifact{
+				Path: filepath.Join(randStringRunes(10), randStringRunes(10), randStringRunes(10)+".tar.gz"),
+			}
+			g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+
+			err := storage.Archive(&artifact, dir, nil, tt.policy)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			for _, name := range tt.wantFiles {
+				mustExist := !strings.HasPrefix(name, "!")
+				_, _, exist, err := walkTar(storage.LocalPath(artifact), strings.TrimPrefix(name, "!"), false)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(exist).To(Equal(mustExist), name)
+			}
+			for _, name := range tt.wantDirs {
+				mustExist := !strings.HasPrefix(name, "!")
+				_, _, exist, err := walkTar(storage.LocalPath(artifact), strings.TrimPrefix(name, "!"), true)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(exist).To(Equal(mustExist), name)
+			}
+		})
+	}
+}
+
+func TestStorage_Archive_treeHash(t *testing.T) {
+	g := NewWithT(t)
+
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+	storage.ArtifactTreeHash = true
+
+	dir := t.TempDir()
+	g.Expect(os.MkdirAll(filepath.Join(dir, "base"), 0o750)).To(Succeed())
+	g.Expect(os.MkdirAll(filepath.Join(dir, "apps"), 0o750)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "base", "kustomization.yaml"), []byte("base"), 0o600)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "apps", "app.yaml"), []byte("app"), 0o600)).To(Succeed())
+
+	archive := func(revision string) *tree.Tree {
+		artifact := sourcev1.Artifact{
+			Path: filepath.Join("tree", revision+".tar.gz"),
+		}
+		g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+		g.Expect(storage.Archive(&artifact, dir, nil, "")).To(Succeed())
+
+		b, err := os.ReadFile(tree.SidecarPath(storage.LocalPath(artifact)))
+		g.Expect(err).ToNot(HaveOccurred())
+		var tr tree.Tree
+		g.Expect(json.Unmarshal(b, &tr)).To(Succeed())
+		g.Expect(artifact.Metadata).To(HaveKeyWithValue(tree.RootMetadataKey, tr.Root.String()))
+		return &tr
+	}
+
+	first := archive("first")
+	g.Expect(first.Paths).To(HaveKeyWithValue("base/kustomization.yaml", intdigest.Canonical.FromString("base")))
+	g.Expect(first.Paths).To(HaveKeyWithValue("apps/app.yaml", intdigest.Canonical.FromString("app")))
+
+	g.Expect(os.WriteFile(filepath.Join(dir, "apps", "app.yaml"), []byte("changed"), 0o600)).To(Succeed())
+	second := archive("second")
+	g.Expect(second.Root).ToNot(Equal(first.Root))
+	g.Expect(tree.Changed(first, second)).To(Equal([]string{"apps", "apps/app.yaml"}))
+
+	// The tree of an artifact is removed together with the artifact.
+	storage.ArtifactRetentionRecords = 1
+	storage.ArtifactRetentionTTL = 0
+	deleted, err := storage.GarbageCollect(context.TODO(), sourcev1.Artifact{Path: filepath.Join("tree", "second.tar.gz")}, nil, time.Second)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(deleted).To(ConsistOf(storage.LocalPath(sourcev1.Artifact{Path: filepath.Join("tree", "first.tar.gz")})))
+	g.Expect(filepath.Join(storage.BasePath, "tree", "first"+tree.FileSuffix)).ToNot(BeAnExistingFile())
+	g.Expect(filepath.Join(storage.BasePath, "tree", "second"+tree.FileSuffix)).To(BeARegularFile())
+}
+
+func TestStorage_WithDigestAlgorithm(t *testing.T) {
+	g := NewWithT(t)
+
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+	storage.ArtifactTreeHash = true
+
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("app"), 0o600)).To(Succeed())
+
+	for _, algo := range []digest.Algorithm{digest.SHA384, digest.SHA512, digest.BLAKE3} {
+		t.Run(algo.String(), func(t *testing.T) {
+			g := NewWithT(t)
+
+			archived := sourcev1.Artifact{Path: filepath.Join(algo.String(), "archive.tar.gz")}
+			g.Expect(storage.MkdirAll(archived)).To(Succeed())
+			g.Expect(storage.Archive(&archived, dir, nil, "", WithDigestAlgorithm(algo))).To(Succeed())
+			g.Expect(archived.Digest).To(HavePrefix(algo.String() + ":"))
+			g.Expect(storage.VerifyArtifact(archived)).To(Succeed())
+
+			b, err := os.ReadFile(tree.SidecarPath(storage.LocalPath(archived)))
+			g.Expect(err).ToNot(HaveOccurred())
+			var tr tree.Tree
+			g.Expect(json.Unmarshal(b, &tr)).To(Succeed())
+			g.Expect(tr.Paths).To(HaveKeyWithValue("app.yaml", algo.FromString("app")))
+
+			copied := sourcev1.Artifact{Path: filepath.Join(algo.String(), "app.yaml")}
+			g.Expect(storage.MkdirAll(copied)).To(Succeed())
+			g.Expect(storage.CopyFromPath(&copied, filepath.Join(dir, "app.yaml"), WithDigestAlgorithm(algo))).To(Succeed())
+			g.Expect(copied.Digest).To(Equal(algo.FromString("app").String()))
+			g.Expect(storage.VerifyArtifact(copied)).To(Succeed())
+		})
+	}
+
+	artifact := sourcev1.Artifact{Path: filepath.Join("unsupported", "app.yaml")}
+	g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+	err = storage.CopyFromPath(&artifact, filepath.Join(dir, "app.yaml"), WithDigestAlgorithm("md5"))
+	g.Expect(err).To(MatchError(digest.ErrDigestUnsupported))
+}
+
+func TestStorage_checkFreeSpace(t *testing.T) {
+	var avail uint64
+	availableSpace = func(string) (uint64, error) {
+		return avail, nil
+	}
+	t.Cleanup(func() {
+		availableSpace = sourcefs.AvailableSpace
+	})
+
+	dir := t.TempDir()
+	data := []byte(strings.Repeat("a", 1024))
+	g := NewWithT(t)
+	g.Expect(os.WriteFile(filepath.Join(dir, "app.yaml"), data, 0o600)).To(Succeed())
+
+	tests := []struct {
+		name    string
+		margin  int64
+		avail   uint64
+		wantErr bool
+	}{
+		{name: "unchecked without margin", margin: 0, avail: 0},
+		{name: "enough space", margin: 512, avail: 1024 + 512},
+		{name: "insufficient space", margin: 512, avail: 1024 + 511, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+			g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+			storage.FreeSpaceMargin = tt.margin
+			avail = tt.avail
+
+			copied := sourcev1.Artifact{Path: filepath.Join("copied", "app.yaml")}
+			g.Expect(storage.MkdirAll(copied)).To(Succeed())
+			err = storage.CopyFromPath(&copied, filepath.Join(dir, "app.yaml"))
+
+			archived := sourcev1.Artifact{Path: filepath.Join("archived", "archive.tar.gz")}
+			g.Expect(storage.MkdirAll(archived)).To(Succeed())
+			archiveErr := storage.Archive(&archived, dir, nil, "", WithExpectedSize(int64(len(data))))
+
+			if tt.wantErr {
+				g.Expect(err).To(MatchError(ErrInsufficientStorage))
+				g.Expect(storageFailedReason(err)).To(Equal(sourcev1.InsufficientStorageReason))
+				g.Expect(archiveErr).To(MatchError(ErrInsufficientStorage))
+
+				entries, err := os.ReadDir(filepath.Dir(storage.LocalPath(copied)))
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(entries).To(BeEmpty())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(archiveErr).ToNot(HaveOccurred())
+			g.Expect(storage.VerifyArtifact(copied)).To(Succeed())
+		})
+	}
+}
+
+func TestStorage_CheckWritable(t *testing.T) {
+	var avail uint64
+	availableSpace = func(string) (uint64, error) {
+		return avail, nil
+	}
+	t.Cleanup(func() {
+		availableSpace = sourcefs.AvailableSpace
+	})
+
+	t.Run("writable", func(t *testing.T) {
+		g := NewWithT(t)
+
+		storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+		g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+
+		g.Expect(storage.CheckWritable()).To(Succeed())
+		entries, err := os.ReadDir(storage.BasePath)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(entries).To(BeEmpty())
+	})
+
+	t.Run("missing base path", func(t *testing.T) {
+		g := NewWithT(t)
+
+		storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+		g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+		g.Expect(os.RemoveAll(storage.BasePath)).To(Succeed())
+
+		err = storage.CheckWritable()
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("failed to create file in storage path"))
+	})
+
+	t.Run("insufficient space", func(t *testing.T) {
+		g := NewWithT(t)
+
+		storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+		g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+		storage.FreeSpaceMargin = 1024
+		avail = 512
+
+		g.Expect(storage.CheckWritable()).To(MatchError(ErrInsufficientStorage))
+	})
+}
+
+func TestStorage_Archive_ignoredPaths(t *testing.T) {
+	g := NewWithT(t)
+
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+
+	dir := t.TempDir()
+	for _, f := range []string{
+		"app.yaml",
+		"test.log",
+		"logs/a.log",
+		"logs/b.log",
+		"vendor/lib/lib.yaml",
+		"vendor/lib/README.md",
+		"base/debug.log",
+	} {
+		p := filepath.Join(dir, f)
+		g.Expect(os.MkdirAll(filepath.Dir(p), 0o750)).To(Succeed())
+		g.Expect(os.WriteFile(p, []byte(f), 0o600)).To(Succeed())
+	}
+
+	domain := strings.Split(dir, string(filepath.Separator))
+	ps := []gitignore.Pattern{
+		gitignore.ParsePattern("*.log", domain),
+		gitignore.ParsePattern("vendor/", domain),
+	}
+	ignored := &IgnoredPaths{SampleSize: 3}
+
+	artifact := sourcev1.Artifact{
+		Path: filepath.Join("ignored", "artifact.tar.gz"),
+	}
+	g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+	g.Expect(storage.Archive(&artifact, dir, ignored.Filter(dir, SourceIgnoreFilter(ps, domain)), "")).To(Succeed())
+
+	// The contents of the ignored vendor directory are not counted, while
+	// the files in the logs directory are matched individually.
+	g.Expect(ignored.Count).To(Equal(int64(5)))
+	g.Expect(ignored.Sample).To(Equal([]string{"base/debug.log", "logs/a.log", "logs/b.log"}))
+
+	f, err := os.Open(storage.LocalPath(artifact))
+	g.Expect(err).ToNot(HaveOccurred())
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	g.Expect(err).ToNot(HaveOccurred())
+	var files []string
+	tr := tar.NewReader(gzr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		g.Expect(err).ToNot(HaveOccurred())
+		if h.Typeflag == tar.TypeReg {
+			files = append(files, h.Name)
+		}
+	}
+	g.Expect(files).To(ConsistOf("app.yaml"))
+}
+
 func TestStorageRemoveAllButCurrent(t *testing.T) {
 	t.Run("bad directory in archive", func(t *testing.T) {
 		dir := t.TempDir()
@@ -362,6 +834,128 @@ func TestStorageRemoveAll(t *testing.T) {
 	}
 }
 
+func TestStorage_DeferRemoveAll(t *testing.T) {
+	setup := func(g *WithT, grace time.Duration) (*Storage, sourcev1.Artifact, string) {
+		dir := t.TempDir()
+		s, err := NewStorage(dir, "hostname", time.Minute, 2)
+		g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+		s.FinalizerGCGrace = grace
+
+		artifact := sourcev1.Artifact{
+			Path: filepath.Join("foo", "bar", "artifact1.tar.gz"),
+		}
+		g.Expect(s.MkdirAll(artifact)).To(Succeed())
+		g.Expect(os.WriteFile(s.LocalPath(artifact), []byte("artifact"), 0o600)).To(Succeed())
+		return s, artifact, filepath.Join(dir, "foo", "bar")
+	}
+
+	t.Run("removes immediately without grace period", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s, artifact, artifactDir := setup(g, 0)
+		deleted, err := s.DeferRemoveAll(artifact)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(deleted).To(Equal(artifactDir))
+		g.Expect(artifactDir).ToNot(BeADirectory())
+	})
+
+	t.Run("keeps artifacts during grace period", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s, artifact, artifactDir := setup(g, 500*time.Millisecond)
+		deleted, err := s.DeferRemoveAll(artifact)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(deleted).To(Equal(artifactDir))
+
+		removed, err := s.SweepDeferredRemovals()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(removed).To(BeEmpty())
+		g.Expect(s.LocalPath(artifact)).To(BeARegularFile())
+
+		g.Eventually(func() []string {
+			removed, err := s.SweepDeferredRemovals()
+			g.Expect(err).ToNot(HaveOccurred())
+			return removed
+		}, 2*time.Second, 100*time.Millisecond).Should(Equal([]string{artifactDir}))
+		g.Expect(artifactDir).ToNot(BeADirectory())
+	})
+
+	t.Run("cancels removal when dir is reused", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s, artifact, artifactDir := setup(g, time.Millisecond)
+		_, err := s.DeferRemoveAll(artifact)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(s.MkdirAll(artifact)).To(Succeed())
+
+		time.Sleep(10 * time.Millisecond)
+		removed, err := s.SweepDeferredRemovals()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(removed).To(BeEmpty())
+		g.Expect(artifactDir).To(BeADirectory())
+		g.Expect(filepath.Join(artifactDir, deferredRemovalMarker)).ToNot(BeAnExistingFile())
+	})
+
+	t.Run("loads removal schedule after restart", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s, artifact, artifactDir := setup(g, time.Hour)
+		_, err := s.DeferRemoveAll(artifact)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(filepath.Join(artifactDir, deferredRemovalMarker)).To(BeARegularFile())
+
+		restarted, err := NewStorage(s.BasePath, "hostname", time.Minute, 2)
+		g.Expect(err).ToNot(HaveOccurred())
+		restarted.FinalizerGCGrace = time.Hour
+		g.Expect(restarted.LoadDeferredRemovals()).To(Succeed())
+		g.Expect(restarted.deferredRemovals).To(HaveKey(artifactDir))
+		g.Expect(restarted.deferredRemovals[artifactDir]).To(BeTemporally("~", s.deferredRemovals[artifactDir], time.Second))
+
+		removed, err := restarted.SweepDeferredRemovals()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(removed).To(BeEmpty())
+
+		g.Expect(os.WriteFile(filepath.Join(artifactDir, deferredRemovalMarker),
+			[]byte(time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)), 0o600)).To(Succeed())
+		restarted, err = NewStorage(s.BasePath, "hostname", time.Minute, 2)
+		g.Expect(err).ToNot(HaveOccurred())
+		restarted.FinalizerGCGrace = time.Hour
+		g.Expect(restarted.LoadDeferredRemovals()).To(Succeed())
+		removed, err = restarted.SweepDeferredRemovals()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(removed).To(Equal([]string{artifactDir}))
+		g.Expect(artifactDir).ToNot(BeADirectory())
+	})
+
+	t.Run("removes deferred dirs after restart without grace period", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s, artifact, artifactDir := setup(g, time.Hour)
+		_, err := s.DeferRemoveAll(artifact)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		restarted, err := NewStorage(s.BasePath, "hostname", time.Minute, 2)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(restarted.LoadDeferredRemovals()).To(Succeed())
+		removed, err := restarted.SweepDeferredRemovals()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(removed).To(Equal([]string{artifactDir}))
+		g.Expect(artifactDir).ToNot(BeADirectory())
+	})
+
+	t.Run("ignores non-existent dir", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+		g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+		s.FinalizerGCGrace = time.Minute
+
+		deleted, err := s.DeferRemoveAll(sourcev1.Artifact{Path: filepath.Join("foo", "bar", "artifact1.tar.gz")})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(deleted).To(BeEmpty())
+	})
+}
+
 func TestStorageCopyFromPath(t *testing.T) {
 	type File struct {
 		Name    string
@@ -454,6 +1048,254 @@ func TestStorageCopyFromPath(t *testing.T) {
 	}
 }
 
+func TestStorage_AtomicWriteFile(t *testing.T) {
+	errMidWrite := errors.New("connection reset")
+
+	tests := []struct {
+		name        string
+		existing    []byte
+		reader      io.Reader
+		wantErr     error
+		wantContent []byte
+	}{
+		{
+			name:        "writes file",
+			reader:      strings.NewReader("contents"),
+			wantContent: []byte("contents"),
+		},
+		{
+			name:        "replaces existing file",
+			existing:    []byte("old contents"),
+			reader:      strings.NewReader("contents"),
+			wantContent: []byte("contents"),
+		},
+		{
+			name:    "mid-write error leaves no partial file",
+			reader:  io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errMidWrite)),
+			wantErr: errMidWrite,
+		},
+		{
+			name:        "mid-write error leaves existing file untouched",
+			existing:    []byte("old contents"),
+			reader:      io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errMidWrite)),
+			wantErr:     errMidWrite,
+			wantContent: []byte("old contents"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			artifact := sourcev1.Artifact{
+				Path: filepath.Join("gitrepository", "default", "foo", "artifact.tar.gz"),
+			}
+			g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+			if tt.existing != nil {
+				g.Expect(os.WriteFile(storage.LocalPath(artifact), tt.existing, 0o600)).To(Succeed())
+			}
+
+			err = storage.AtomicWriteFile(&artifact, tt.reader, 0o600)
+			if tt.wantErr != nil {
+				g.Expect(err).To(MatchError(tt.wantErr))
+				g.Expect(artifact.Digest).To(BeEmpty())
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(artifact.Digest).ToNot(BeEmpty())
+				g.Expect(*artifact.Size).To(BeEquivalentTo(len(tt.wantContent)))
+			}
+
+			// No temporary files must be left behind.
+			entries, err := os.ReadDir(filepath.Dir(storage.LocalPath(artifact)))
+			g.Expect(err).ToNot(HaveOccurred())
+			if tt.wantContent == nil {
+				g.Expect(entries).To(BeEmpty())
+				return
+			}
+			g.Expect(entries).To(HaveLen(1))
+			g.Expect(entries[0].Name()).To(Equal(filepath.Base(artifact.Path)))
+
+			b, err := os.ReadFile(storage.LocalPath(artifact))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(b).To(Equal(tt.wantContent))
+		})
+	}
+}
+
+func TestStorage_ArtifactMissing(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		want      []bool
+	}{
+		{
+			name: "without threshold",
+			want: []bool{true, true},
+		},
+		{
+			name:      "with threshold",
+			threshold: 2,
+			want:      []bool{false, false, true, false, false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+			g.Expect(err).ToNot(HaveOccurred())
+			storage.ArtifactFailureThreshold = tt.threshold
+
+			artifact := sourcev1.Artifact{
+				Path: filepath.Join("gitrepository", "default", "foo", "artifact.tar.gz"),
+			}
+			for i, want := range tt.want {
+				g.Expect(storage.ArtifactMissing(artifact)).To(Equal(want), "attempt %d", i+1)
+			}
+		})
+	}
+
+	t.Run("resets when artifact reappears", func(t *testing.T) {
+		g := NewWithT(t)
+
+		storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+		g.Expect(err).ToNot(HaveOccurred())
+		storage.ArtifactFailureThreshold = 1
+
+		artifact := sourcev1.Artifact{
+			Path: filepath.Join("gitrepository", "default", "foo", "artifact.tar.gz"),
+		}
+		g.Expect(storage.ArtifactMissing(artifact)).To(BeFalse())
+
+		g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+		g.Expect(storage.AtomicWriteFile(&artifact, strings.NewReader("contents"), 0o600)).To(Succeed())
+		g.Expect(storage.ArtifactMissing(artifact)).To(BeFalse())
+
+		g.Expect(os.Remove(storage.LocalPath(artifact))).To(Succeed())
+		g.Expect(storage.ArtifactMissing(artifact)).To(BeFalse())
+		g.Expect(storage.ArtifactMissing(artifact)).To(BeTrue())
+	})
+}
+
+func TestStorage_VerifyArtifact(t *testing.T) {
+	const contents = "contents"
+
+	tests := []struct {
+		name    string
+		digest  string
+		wantErr string
+	}{
+		{
+			name:   "sha256 digest",
+			digest: digest.SHA256.FromString(contents).String(),
+		},
+		{
+			name:   "sha512 digest",
+			digest: digest.SHA512.FromString(contents).String(),
+		},
+		{
+			name:   "hex checksum without algorithm",
+			digest: digest.SHA256.FromString(contents).Encoded(),
+		},
+		{
+			name: "without digest",
+		},
+		{
+			name:    "digest mismatch",
+			digest:  digest.SHA512.FromString("other").String(),
+			wantErr: "computed digest doesn't match '" + digest.SHA512.FromString("other").String() + "'",
+		},
+		{
+			name:    "hex checksum mismatch",
+			digest:  digest.SHA256.FromString("other").Encoded(),
+			wantErr: "computed digest doesn't match '" + digest.SHA256.FromString("other").String() + "'",
+		},
+		{
+			name:    "invalid digest",
+			digest:  "sha256:invalid",
+			wantErr: "failed to parse artifact digest 'sha256:invalid'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			artifact := sourcev1.Artifact{
+				Path: filepath.Join("gitrepository", "default", "foo", "artifact.tar.gz"),
+			}
+			g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+			g.Expect(storage.AtomicWriteFile(&artifact, strings.NewReader(contents), 0o600)).To(Succeed())
+
+			artifact.Digest = tt.digest
+			err = storage.VerifyArtifact(artifact)
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+func TestStorage_VerifyArtifact_cache(t *testing.T) {
+	g := NewWithT(t)
+
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	artifact := sourcev1.Artifact{
+		Path: filepath.Join("gitrepository", "default", "foo", "artifact.tar.gz"),
+	}
+	g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+	g.Expect(storage.AtomicWriteFile(&artifact, strings.NewReader("contents"), 0o600)).To(Succeed())
+	artifact.Digest = digest.SHA256.FromString("contents").String()
+	g.Expect(storage.VerifyArtifact(artifact)).To(Succeed())
+
+	// Overwrite the file with contents of the same size, and restore the
+	// modification time: the file is not hashed again.
+	localPath := storage.LocalPath(artifact)
+	fi, err := os.Stat(localPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(os.WriteFile(localPath, []byte("tampered"), 0o600)).To(Succeed())
+	g.Expect(os.Chtimes(localPath, fi.ModTime(), fi.ModTime())).To(Succeed())
+	g.Expect(storage.VerifyArtifact(artifact)).To(Succeed())
+
+	// A changed modification time causes the file to be hashed again.
+	g.Expect(os.Chtimes(localPath, fi.ModTime().Add(time.Second), fi.ModTime().Add(time.Second))).To(Succeed())
+	g.Expect(storage.VerifyArtifact(artifact)).To(MatchError(ContainSubstring("computed digest doesn't match")))
+
+	// A different digest causes the file to be hashed again.
+	g.Expect(os.Chtimes(localPath, fi.ModTime(), fi.ModTime())).To(Succeed())
+	artifact.Digest = digest.SHA512.FromString("contents").String()
+	g.Expect(storage.VerifyArtifact(artifact)).To(MatchError(ContainSubstring("computed digest doesn't match")))
+}
+
+func TestStorage_ArtifactDigestMismatch(t *testing.T) {
+	g := NewWithT(t)
+
+	storage, err := NewStorage(t.TempDir(), "hostname", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(storage.ArtifactDigestMismatch(nil)).To(Succeed())
+
+	artifact := sourcev1.Artifact{
+		Path:   filepath.Join("gitrepository", "default", "foo", "artifact.tar.gz"),
+		Digest: digest.SHA256.FromString("other").String(),
+	}
+	g.Expect(storage.ArtifactDigestMismatch(&artifact)).To(Succeed())
+
+	g.Expect(storage.MkdirAll(artifact)).To(Succeed())
+	g.Expect(storage.AtomicWriteFile(&artifact, strings.NewReader("contents"), 0o600)).To(Succeed())
+	artifact.Digest = digest.SHA256.FromString("other").String()
+	g.Expect(storage.ArtifactDigestMismatch(&artifact)).To(MatchError(ContainSubstring("computed digest doesn't match")))
+}
+
 func TestStorage_getGarbageFiles(t *testing.T) {
 	artifactFolder := filepath.Join("foo", "bar")
 	tests := []struct {
@@ -689,7 +1531,7 @@ func TestStorage_GarbageCollect(t *testing.T) {
 				}
 			}
 
-			collectedPaths, err := s.GarbageCollect(context.TODO(), artifact, tt.ctxTimeout)
+			collectedPaths, err := s.GarbageCollect(context.TODO(), artifact, nil, tt.ctxTimeout)
 			if tt.wantErr == "" {
 				g.Expect(err).ToNot(HaveOccurred(), "failed to collect garbage files")
 			} else {
@@ -718,3 +1560,61 @@ func TestStorage_GarbageCollect(t *testing.T) {
 		})
 	}
 }
+
+func TestStorage_GarbageCollect_retention(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+
+	s, err := NewStorage(dir, "hostname", time.Minute, 2)
+	g.Expect(err).ToNot(HaveOccurred(), "failed to create new storage")
+
+	// createArtifacts creates the given number of artifacts for the object,
+	// with the most recent one being the current artifact.
+	createArtifacts := func(name string, n int) sourcev1.Artifact {
+		artifactDir := filepath.Join(dir, "gitrepository", "default", name)
+		g.Expect(os.MkdirAll(artifactDir, 0o750)).To(Succeed())
+		var artifact sourcev1.Artifact
+		for i := 1; i <= n; i++ {
+			artifact = sourcev1.Artifact{Path: filepath.Join("gitrepository", "default", name, fmt.Sprintf("artifact%d.tar.gz", i))}
+			p := s.LocalPath(artifact)
+			g.Expect(os.WriteFile(p, nil, 0o600)).To(Succeed())
+			modTime := time.Now().Add(time.Duration(i-n) * time.Second)
+			g.Expect(os.Chtimes(p, modTime, modTime)).To(Succeed())
+		}
+		return artifact
+	}
+	countArtifacts := func(name string) int {
+		entries, err := os.ReadDir(filepath.Join(dir, "gitrepository", "default", name))
+		g.Expect(err).ToNot(HaveOccurred())
+		return len(entries)
+	}
+
+	retainRecords := int32(4)
+	tests := []struct {
+		name string
+		gc   *sourcev1.ArtifactGC
+		want int
+	}{
+		{
+			name: "controller-defaults",
+			want: 2,
+		},
+		{
+			name: "retain-records",
+			gc:   &sourcev1.ArtifactGC{RetainRecords: &retainRecords},
+			want: 4,
+		},
+		{
+			name: "retain-ttl",
+			gc:   &sourcev1.ArtifactGC{RetainTTL: &metav1.Duration{Duration: 0}},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		artifact := createArtifacts(tt.name, 5)
+		_, err := s.GarbageCollect(context.TODO(), artifact, tt.gc, time.Second)
+		g.Expect(err).ToNot(HaveOccurred(), tt.name)
+		g.Expect(countArtifacts(tt.name)).To(Equal(tt.want), tt.name)
+		g.Expect(s.LocalPath(artifact)).To(BeARegularFile(), tt.name)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	serror "github.com/fluxcd/source-controller/internal/error"
+	"github.com/fluxcd/source-controller/internal/webhook"
+)
+
+// reviewArtifact consults the given pre-store webhook about the Artifact
+// which is about to be stored for the object of the given kind.
+// It returns nil if no webhook is configured, or if the webhook approves the
+// Artifact. If the webhook rejects the Artifact, it returns an error with
+// sourcev1.PolicyRejectedReason. Failing to consult the webhook results in
+// an error as well, to not store Artifacts which have not been reviewed.
+func reviewArtifact(ctx context.Context, wh *webhook.PreStore, kind string, obj metav1.Object, artifact sourcev1.Artifact) *serror.Generic {
+	if wh == nil {
+		return nil
+	}
+
+	result, err := wh.Review(ctx, webhook.ArtifactReview{
+		Kind:      kind,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Revision:  artifact.Revision,
+		Path:      artifact.Path,
+		Digest:    artifact.Digest,
+	})
+	if err != nil {
+		return serror.NewGeneric(
+			fmt.Errorf("failed to review artifact with pre-store webhook: %w", err),
+			meta.FailedReason,
+		)
+	}
+	if !result.Approved {
+		msg := "artifact rejected by pre-store webhook"
+		if result.Message != "" {
+			msg = fmt.Sprintf("%s: %s", msg, result.Message)
+		}
+		return serror.NewGeneric(errors.New(msg), sourcev1.PolicyRejectedReason)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/git"
+	"github.com/fluxcd/pkg/runtime/conditions"
+	"github.com/fluxcd/pkg/runtime/patch"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/fluxcd/source-controller/internal/features"
+	sreconcile "github.com/fluxcd/source-controller/internal/reconcile"
+	"github.com/fluxcd/source-controller/internal/webhook"
+)
+
+func TestGitRepositoryReconciler_reconcileArtifact_preStoreWebhook(t *testing.T) {
+	tests := []struct {
+		name             string
+		result           *webhook.ReviewResult
+		statusCode       int
+		want             sreconcile.Result
+		wantErr          bool
+		wantArtifact     bool
+		assertConditions []metav1.Condition
+	}{
+		{
+			name:         "approved artifact is stored",
+			result:       &webhook.ReviewResult{Approved: true},
+			want:         sreconcile.ResultSuccess,
+			wantArtifact: true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.ArtifactInStorageCondition, meta.SucceededReason, "stored artifact for revision 'main@sha1:b9b3feadba509cb9b22e968a5d27e96c2bc2ff91'"),
+			},
+		},
+		{
+			name:    "rejected artifact is not stored",
+			result:  &webhook.ReviewResult{Approved: false, Message: "revision not allowed"},
+			want:    sreconcile.ResultEmpty,
+			wantErr: true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.StorageOperationFailedCondition, sourcev1.PolicyRejectedReason, "artifact rejected by pre-store webhook: revision not allowed"),
+			},
+		},
+		{
+			name:       "webhook failure does not store artifact",
+			statusCode: http.StatusServiceUnavailable,
+			want:       sreconcile.ResultEmpty,
+			wantErr:    true,
+			assertConditions: []metav1.Condition{
+				*conditions.TrueCondition(sourcev1.StorageOperationFailedCondition, meta.FailedReason, "failed to review artifact with pre-store webhook"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var review webhook.ArtifactReview
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewDecoder(r.Body).Decode(&review)
+				if tt.statusCode != 0 {
+					w.WriteHeader(tt.statusCode)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(tt.result)
+			}))
+			defer server.Close()
+
+			r := &GitRepositoryReconciler{
+				EventRecorder:   record.NewFakeRecorder(32),
+				Storage:         testStorage,
+				PreStoreWebhook: webhook.NewPreStore(server.URL, time.Second),
+				features:        features.FeatureGates(),
+				patchOptions:    getPatchOptions(gitRepositoryReadyCondition.Owned, "sc"),
+			}
+
+			// The TypeMeta is left empty, as it often is on objects decoded
+			// by the typed client.
+			obj := &sourcev1.GitRepository{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "reconcile-artifact-webhook",
+					Namespace:  "default",
+					Generation: 1,
+				},
+				Spec: sourcev1.GitRepositorySpec{
+					Interval: metav1.Duration{Duration: interval},
+				},
+			}
+
+			commit := git.Commit{
+				Hash:      []byte("b9b3feadba509cb9b22e968a5d27e96c2bc2ff91"),
+				Reference: "refs/heads/main",
+			}
+			sp := patch.NewSerialPatcher(obj, r.Client)
+
+			got, err := r.reconcileArtifact(ctx, sp, obj, &commit, &artifactSet{}, "testdata/git/repository")
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			g.Expect(got).To(Equal(tt.want))
+			g.Expect(obj.Status.Conditions).To(conditions.MatchConditions(tt.assertConditions))
+			g.Expect(obj.GetArtifact() != nil).To(Equal(tt.wantArtifact))
+
+			g.Expect(review.Kind).To(Equal(sourcev1.GitRepositoryKind))
+			g.Expect(review.Namespace).To(Equal(obj.Namespace))
+			g.Expect(review.Name).To(Equal(obj.Name))
+			g.Expect(review.Revision).To(Equal("main@sha1:b9b3feadba509cb9b22e968a5d27e96c2bc2ff91"))
+		})
+	}
+}
@@ -22,6 +22,7 @@ import (
 	_ "crypto/sha256"
 	_ "crypto/sha512"
 	"fmt"
+	"strings"
 
 	"github.com/opencontainers/go-digest"
 	_ "github.com/opencontainers/go-digest/blake3"
@@ -50,3 +51,17 @@ func AlgorithmForName(name string) (digest.Algorithm, error) {
 	}
 	return a, nil
 }
+
+// Parse parses the given digest in the form of '<algorithm>:<encoded>'. A
+// digest without an algorithm prefix, as recorded in the checksum of
+// artifacts by older versions, is parsed as a hex encoded SHA-256 digest.
+func Parse(s string) (digest.Digest, error) {
+	if !strings.Contains(s, ":") {
+		d := digest.NewDigestFromEncoded(digest.SHA256, s)
+		if err := d.Validate(); err != nil {
+			return "", err
+		}
+		return d, nil
+	}
+	return digest.Parse(s)
+}
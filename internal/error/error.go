@@ -66,8 +66,10 @@ type Stalling struct {
 }
 
 // Error implements error interface.
+// The message is sanitized, as the error may be constructed without
+// NewStalling.
 func (se *Stalling) Error() string {
-	return se.Err.Error()
+	return SanitizeString(se.Err.Error())
 }
 
 // Unwrap returns the underlying error.
@@ -76,12 +78,13 @@ func (se *Stalling) Unwrap() error {
 }
 
 // NewStalling constructs a new Stalling error with default configuration.
+// The message of the error is sanitized using Sanitize.
 func NewStalling(err error, reason string) *Stalling {
 	// Stalling errors are not returned to the runtime. Log it explicitly.
 	// Since this failure requires user interaction, send warning notification.
 	return &Stalling{
 		Reason: reason,
-		Err:    err,
+		Err:    Sanitize(err),
 		Config: Config{
 			Event:        corev1.EventTypeWarning,
 			Log:          true,
@@ -103,8 +106,10 @@ type Event struct {
 }
 
 // Error implements error interface.
+// The message is sanitized, as Event errors are not constructed using a
+// function which does this for the underlying error.
 func (ee *Event) Error() string {
-	return ee.Err.Error()
+	return SanitizeString(ee.Err.Error())
 }
 
 // Unwrap returns the underlying error.
@@ -129,8 +134,10 @@ type Waiting struct {
 }
 
 // Error implements error interface.
+// The message is sanitized, as the error may be constructed without
+// NewWaiting.
 func (we *Waiting) Error() string {
-	return we.Err.Error()
+	return SanitizeString(we.Err.Error())
 }
 
 // Unwrap returns the underlying error.
@@ -139,13 +146,14 @@ func (we *Waiting) Unwrap() error {
 }
 
 // NewWaiting constructs a new Waiting error with default configuration.
+// The message of the error is sanitized using Sanitize.
 func NewWaiting(err error, reason string) *Waiting {
 	// Waiting errors are not returned to the runtime. Log it explicitly.
 	// Since this failure results in reconciliation delay, send warning
 	// notification.
 	return &Waiting{
 		Reason: reason,
-		Err:    err,
+		Err:    Sanitize(err),
 		Config: Config{
 			Event: corev1.EventTypeNormal,
 			Log:   true,
@@ -165,8 +173,10 @@ type Generic struct {
 }
 
 // Error implements error interface.
+// The message is sanitized, as the error may be constructed without
+// NewGeneric.
 func (g *Generic) Error() string {
-	return g.Err.Error()
+	return SanitizeString(g.Err.Error())
 }
 
 // Unwrap returns the underlying error.
@@ -175,11 +185,12 @@ func (g *Generic) Unwrap() error {
 }
 
 // NewGeneric constructs a new Generic error with default configuration.
+// The message of the error is sanitized using Sanitize.
 func NewGeneric(err error, reason string) *Generic {
 	// Since it's a error, ensure to log and send failure notification.
 	return &Generic{
 		Reason: reason,
-		Err:    err,
+		Err:    Sanitize(err),
 		Config: Config{
 			Event:        corev1.EventTypeWarning,
 			Log:          true,
@@ -0,0 +1,126 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package eventlimit provides an event recorder which rate limits repeated
+// Warning events, to prevent floods of events while a reconciliation keeps
+// failing for the same reason.
+package eventlimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	kuberecorder "k8s.io/client-go/tools/record"
+)
+
+// Recorder is a kuberecorder.EventRecorder which drops Warning events which
+// repeat a Warning event recorded for the same object, with the same reason
+// and message, within the interval. All other events are passed on to the
+// underlying recorder. It is safe for concurrent use.
+type Recorder struct {
+	recorder kuberecorder.EventRecorder
+	interval time.Duration
+
+	mu sync.Mutex
+	// recorded holds the time of the last recorded Warning event of each
+	// object, reason and message.
+	recorded map[eventKey]time.Time
+	now      func() time.Time
+}
+
+// eventKey identifies a repeated event.
+type eventKey struct {
+	object  string
+	reason  string
+	message string
+}
+
+// New returns a Recorder which records events using the given recorder, and
+// drops repeated Warning events within the given interval. When the interval
+// is zero or negative, it returns the given recorder.
+func New(recorder kuberecorder.EventRecorder, interval time.Duration) kuberecorder.EventRecorder {
+	if interval <= 0 {
+		return recorder
+	}
+	return &Recorder{
+		recorder: recorder,
+		interval: interval,
+		recorded: make(map[eventKey]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Event implements kuberecorder.EventRecorder.
+func (r *Recorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if !r.allow(object, eventtype, reason, message) {
+		return
+	}
+	r.recorder.Event(object, eventtype, reason, message)
+}
+
+// Eventf implements kuberecorder.EventRecorder.
+func (r *Recorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if !r.allow(object, eventtype, reason, fmt.Sprintf(messageFmt, args...)) {
+		return
+	}
+	r.recorder.Eventf(object, eventtype, reason, messageFmt, args...)
+}
+
+// AnnotatedEventf implements kuberecorder.EventRecorder.
+func (r *Recorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if !r.allow(object, eventtype, reason, fmt.Sprintf(messageFmt, args...)) {
+		return
+	}
+	r.recorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+}
+
+// allow returns if the event should be recorded, and remembers the time
+// Warning events are recorded at.
+func (r *Recorder) allow(object runtime.Object, eventtype, reason, message string) bool {
+	if eventtype != corev1.EventTypeWarning {
+		return true
+	}
+
+	key := eventKey{object: objectKey(object), reason: reason, message: message}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for k, t := range r.recorded {
+		if now.Sub(t) >= r.interval {
+			delete(r.recorded, k)
+		}
+	}
+	if _, ok := r.recorded[key]; ok {
+		return false
+	}
+	r.recorded[key] = now
+	return true
+}
+
+// objectKey returns a key identifying the given object.
+func objectKey(object runtime.Object) string {
+	o, err := apimeta.Accessor(object)
+	if err != nil {
+		return fmt.Sprintf("%T", object)
+	}
+	return fmt.Sprintf("%T/%s/%s/%s", object, o.GetNamespace(), o.GetName(), o.GetUID())
+}
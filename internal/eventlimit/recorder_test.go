@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventlimit
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestNew(t *testing.T) {
+	g := NewWithT(t)
+
+	fake := record.NewFakeRecorder(1)
+	g.Expect(New(fake, 0)).To(BeIdenticalTo(fake))
+	g.Expect(New(fake, time.Minute)).To(BeAssignableToTypeOf(&Recorder{}))
+}
+
+func TestRecorder(t *testing.T) {
+	g := NewWithT(t)
+
+	fake := record.NewFakeRecorder(32)
+	r := New(fake, time.Minute).(*Recorder)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	foo := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	bar := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "default"}}
+
+	r.Eventf(foo, corev1.EventTypeWarning, "AuthenticationFailed", "failed: %s", "401")
+	r.AnnotatedEventf(foo, nil, corev1.EventTypeWarning, "AuthenticationFailed", "failed: 401")
+	r.Event(foo, corev1.EventTypeWarning, "AuthenticationFailed", "failed: 401")
+	g.Expect(drain(fake)).To(Equal([]string{"Warning AuthenticationFailed failed: 401"}))
+
+	// Other objects, reasons and messages, and non-Warning events, are not
+	// limited.
+	r.Event(bar, corev1.EventTypeWarning, "AuthenticationFailed", "failed: 401")
+	r.Event(foo, corev1.EventTypeWarning, "IndexationFailed", "failed: 401")
+	r.Event(foo, corev1.EventTypeWarning, "AuthenticationFailed", "failed: 403")
+	r.Event(foo, corev1.EventTypeNormal, "NewArtifact", "stored")
+	r.Event(foo, corev1.EventTypeNormal, "NewArtifact", "stored")
+	g.Expect(drain(fake)).To(HaveLen(5))
+
+	// The event is recorded again once the interval has passed.
+	now = now.Add(time.Minute)
+	r.Event(foo, corev1.EventTypeWarning, "AuthenticationFailed", "failed: 401")
+	r.Event(foo, corev1.EventTypeWarning, "AuthenticationFailed", "failed: 401")
+	g.Expect(drain(fake)).To(Equal([]string{"Warning AuthenticationFailed failed: 401"}))
+}
+
+func drain(r *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case e := <-r.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
@@ -34,6 +34,13 @@ const (
 	// When enabled, it will cache both object types, resulting in increased memory usage
 	// and cluster-wide RBAC permissions (list and watch).
 	CacheSecretsAndConfigMaps = "CacheSecretsAndConfigMaps"
+	// PreflightSecrets controls whether the Secrets referenced by an object
+	// are validated before the source is fetched.
+	//
+	// When enabled, the reconcilers check that all the referenced Secrets
+	// exist and contain the expected data before making any network call,
+	// and report a missing or invalid Secret with a precise condition.
+	PreflightSecrets = "PreflightSecrets"
 )
 
 var features = map[string]bool{
@@ -43,6 +50,9 @@ var features = map[string]bool{
 	// CacheSecretsAndConfigMaps
 	// opt-in from v0.34
 	CacheSecretsAndConfigMaps: false,
+	// PreflightSecrets
+	// opt-in from v1.0
+	PreflightSecrets: false,
 }
 
 // FeatureGates contains a list of all supported feature gates and
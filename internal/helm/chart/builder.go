@@ -24,9 +24,12 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	helmchart "helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chartutil"
 
+	"github.com/fluxcd/pkg/runtime/transform"
+
 	"github.com/fluxcd/source-controller/internal/fs"
 )
 
@@ -106,6 +109,9 @@ type BuildOptions struct {
 	// ValuesFiles can be set to a list of relative paths, used to compose
 	// and overwrite an alternative default "values.yaml" for the chart.
 	ValuesFiles []string
+	// Values can be set to values which are merged on top of the chart's
+	// default values, or the values composed from ValuesFiles.
+	Values chartutil.Values
 	// CachedChart can be set to the absolute path of a chart stored on
 	// the local filesystem, and is used for simple validation by metadata
 	// comparisons.
@@ -115,6 +121,22 @@ type BuildOptions struct {
 	Force bool
 	// Verifier can be set to the verification of the chart.
 	Verify bool
+	// FailOnVersionMismatch can be set to fail the build of a chart from a
+	// remote repository when the version declared in its metadata differs
+	// from the version in the repository index.
+	FailOnVersionMismatch bool
+	// RequireIndexDigest can be set to fail the build of a chart from a
+	// repository index when the index entry of the chart version has no
+	// digest.
+	RequireIndexDigest bool
+	// AllowedAPIVersions can be set to the list of chart API versions (e.g.
+	// "v2") the chart is allowed to have. Any API version is allowed when
+	// empty.
+	AllowedAPIVersions []string
+	// ValidateOnly can be set to only confirm a chart from a remote
+	// repository can be downloaded, without downloading it. The returned
+	// Build has no Path, unless the chart had to be downloaded to verify it.
+	ValidateOnly bool
 }
 
 // GetValuesFiles returns BuildOptions.ValuesFiles, except if it equals
@@ -126,6 +148,36 @@ func (o BuildOptions) GetValuesFiles() []string {
 	return o.ValuesFiles
 }
 
+// checkAPIVersion returns a BuildError with ErrUnsupportedChart if the API
+// version of the given chart metadata is not in BuildOptions.AllowedAPIVersions.
+func (o BuildOptions) checkAPIVersion(meta *helmchart.Metadata) error {
+	if len(o.AllowedAPIVersions) == 0 {
+		return nil
+	}
+	for _, v := range o.AllowedAPIVersions {
+		if meta.APIVersion == v {
+			return nil
+		}
+	}
+	err := fmt.Errorf("chart '%s' has API version '%s', while only '%s' are allowed",
+		meta.Name, meta.APIVersion, strings.Join(o.AllowedAPIVersions, "', '"))
+	return &BuildError{Reason: ErrUnsupportedChart, Err: err}
+}
+
+// mergeInlineValues merges BuildOptions.Values on top of the given values
+// composed from BuildOptions.ValuesFiles. If no values files are set, it
+// merges them on top of the given chart default values instead.
+// It returns the given values as-is if BuildOptions.Values is empty.
+func (o BuildOptions) mergeInlineValues(defaults, values map[string]interface{}) map[string]interface{} {
+	if len(o.Values) == 0 {
+		return values
+	}
+	if len(o.GetValuesFiles()) == 0 {
+		values = defaults
+	}
+	return transform.MergeMaps(values, o.Values)
+}
+
 // Build contains the (partial) Builder.Build result, including specific
 // information about the built chart like ResolvedDependencies.
 type Build struct {
@@ -133,9 +185,33 @@ type Build struct {
 	Name string
 	// Version of the chart.
 	Version string
+	// AppVersion is the version of the app contained in the chart.
+	AppVersion string
+	// LatestVersion is the latest version of the chart available in the
+	// repository. Only set for charts from a remote repository.
+	LatestVersion string
+	// MismatchedVersion is the version declared in the metadata of the chart,
+	// if it differs from the Version in the repository index. Only set for
+	// charts downloaded from a remote repository.
+	MismatchedVersion string
+	// MissingDigest indicates the entry of the chart version in the
+	// repository index has no digest. Only set for charts downloaded from
+	// a repository index.
+	MissingDigest bool
+	// SignerKeyID is the ID of the OpenPGP key the provenance of the chart
+	// was signed with. Only set for charts downloaded from a repository
+	// index, of which the provenance has been verified.
+	SignerKeyID string
+	// Deprecated indicates the chart version is marked as deprecated in the
+	// repository index. Only set for charts from a remote repository.
+	Deprecated bool
 	// Path is the absolute path to the packaged chart.
-	// Can be empty, in which case a failure should be assumed.
+	// Can be empty, in which case a failure should be assumed, unless
+	// Validated is true.
 	Path string
+	// Validated indicates the chart has been confirmed to be available in
+	// the remote repository, without being downloaded to Path.
+	Validated bool
 	// ValuesFiles is the list of files used to compose the chart's
 	// default "values.yaml".
 	ValuesFiles []string
@@ -157,7 +233,9 @@ func (b *Build) Summary() string {
 	var s strings.Builder
 
 	var action = "new"
-	if b.Path != "" {
+	if b.Validated && b.Path == "" {
+		action = "validated"
+	} else if b.Path != "" {
 		action = "pulled"
 		if b.Packaged {
 			action = "packaged"
@@ -169,6 +247,10 @@ func (b *Build) Summary() string {
 		s.WriteString(fmt.Sprintf(" and merged values files %v", b.ValuesFiles))
 	}
 
+	if b.SignerKeyID != "" {
+		s.WriteString(fmt.Sprintf(" with provenance signed by key '%s'", b.SignerKeyID))
+	}
+
 	return s.String()
 }
 
@@ -184,9 +266,26 @@ func (b *Build) HasMetadata() bool {
 	return b.Name != "" && b.Version != ""
 }
 
+// NewerVersionAvailable returns if the LatestVersion is higher than the
+// Version of the Build.
+func (b *Build) NewerVersionAvailable() bool {
+	if b == nil || b.LatestVersion == "" {
+		return false
+	}
+	latest, err := semver.NewVersion(b.LatestVersion)
+	if err != nil {
+		return false
+	}
+	current, err := semver.NewVersion(b.Version)
+	if err != nil {
+		return false
+	}
+	return latest.GreaterThan(current)
+}
+
 // Complete returns if the Build completed successfully.
 func (b *Build) Complete() bool {
-	return b.HasMetadata() && b.Path != ""
+	return b.HasMetadata() && (b.Path != "" || b.Validated)
 }
 
 // String returns the Path of the Build.
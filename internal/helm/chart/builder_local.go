@@ -17,6 +17,7 @@ limitations under the License.
 package chart
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/Masterminds/semver/v3"
 	securejoin "github.com/cyphar/filepath-securejoin"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"sigs.k8s.io/yaml"
 
 	"github.com/fluxcd/pkg/runtime/transform"
@@ -53,8 +55,8 @@ func NewLocalBuilder(dm *DependencyManager) Builder {
 // version (including BuildOptions.VersionMetadata modifications) differs from
 // the current BuildOptions.CachedChart.
 //
-// BuildOptions.ValuesFiles changes are in this case not taken into account,
-// and BuildOptions.Force should be used to enforce a rebuild.
+// When BuildOptions.ValuesFiles are set, the chart is also packaged if the
+// values of the CachedChart differ from the merged values files.
 //
 // If the LocalReference.Path refers to an already packaged chart, and no
 // packaging is required due to BuildOptions modifying the chart,
@@ -82,14 +84,18 @@ func (b *localChartBuilder) Build(ctx context.Context, ref Reference, p string,
 	}
 	curMeta, err := LoadChartMetadata(securePath)
 	if err != nil {
-		return nil, &BuildError{Reason: ErrChartReference, Err: err}
+		return nil, &BuildError{Reason: archiveErrorReason(err, ErrChartReference), Err: err}
 	}
 	if err = curMeta.Validate(); err != nil {
 		return nil, &BuildError{Reason: ErrChartReference, Err: err}
 	}
+	if err = opts.checkAPIVersion(curMeta); err != nil {
+		return nil, err
+	}
 
 	result := &Build{}
 	result.Name = curMeta.Name
+	result.AppVersion = curMeta.AppVersion
 
 	// Set build specific metadata if instructed
 	result.Version = curMeta.Version
@@ -107,18 +113,20 @@ func (b *localChartBuilder) Build(ctx context.Context, ref Reference, p string,
 	}
 
 	isChartDir := pathIsDir(securePath)
-	requiresPackaging := isChartDir || opts.VersionMetadata != "" || len(opts.GetValuesFiles()) != 0
+	requiresPackaging := isChartDir || opts.VersionMetadata != "" || len(opts.GetValuesFiles()) != 0 || len(opts.Values) != 0
 
 	// If all the following is true, we do not need to package the chart:
 	// - Chart name from cached chart matches resolved name
 	// - Chart version from cached chart matches calculated version
+	// - Values from cached chart match the merged values files, if any
 	// - BuildOptions.Force is False
 	if opts.CachedChart != "" && !opts.Force {
 		if curMeta, err = LoadChartMetadataFromArchive(opts.CachedChart); err == nil {
 			// If the cached metadata is corrupt, we ignore its existence
 			// and continue the build
 			if err = curMeta.Validate(); err == nil {
-				if result.Name == curMeta.Name && result.Version == curMeta.Version {
+				if result.Name == curMeta.Name && result.Version == curMeta.Version &&
+					cachedValuesMatch(localRef.WorkDir, opts) {
 					result.Path = opts.CachedChart
 					result.ValuesFiles = opts.GetValuesFiles()
 					result.Packaged = requiresPackaging
@@ -129,7 +137,7 @@ func (b *localChartBuilder) Build(ctx context.Context, ref Reference, p string,
 		}
 	}
 
-	// If the chart at the path is already packaged and no custom values files
+	// If the chart at the path is already packaged and no custom values (files)
 	// options are set, we can copy the chart without making modifications
 	if !requiresPackaging {
 		if err = copyFileToPath(securePath, p); err != nil {
@@ -152,12 +160,15 @@ func (b *localChartBuilder) Build(ctx context.Context, ref Reference, p string,
 	// or because we have merged values and need to repackage
 	loadedChart, err := secureloader.Load(localRef.WorkDir, localRef.Path)
 	if err != nil {
-		return result, &BuildError{Reason: ErrChartPackage, Err: err}
+		return result, &BuildError{Reason: archiveErrorReason(err, ErrChartPackage), Err: err}
 	}
 
 	// Set earlier resolved version (with metadata)
 	loadedChart.Metadata.Version = result.Version
 
+	// Merge inline values, if any
+	mergedValues = opts.mergeInlineValues(loadedChart.Values, mergedValues)
+
 	// Overwrite default values with merged values, if any
 	if ok, err = OverwriteChartDefaultValues(loadedChart, mergedValues); ok || err != nil {
 		if err != nil {
@@ -173,7 +184,7 @@ func (b *localChartBuilder) Build(ctx context.Context, ref Reference, p string,
 			return result, &BuildError{Reason: ErrDependencyBuild, Err: err}
 		}
 		if result.ResolvedDependencies, err = b.dm.Build(ctx, ref, loadedChart); err != nil {
-			return result, &BuildError{Reason: ErrDependencyBuild, Err: err}
+			return result, &BuildError{Reason: archiveErrorReason(err, ErrDependencyBuild), Err: err}
 		}
 	}
 
@@ -214,6 +225,37 @@ func mergeFileValues(baseDir string, paths []string) (map[string]interface{}, er
 	return mergedValues, nil
 }
 
+// cachedValuesMatch returns true if the values of the BuildOptions.CachedChart
+// equal the values the chart would be packaged with, or if no values files
+// are set. This allows noticing changes to the values files, e.g. in a new
+// revision of the source, while the version of the chart is unchanged.
+// It returns false if the values can not be determined.
+func cachedValuesMatch(baseDir string, opts BuildOptions) bool {
+	if len(opts.GetValuesFiles()) == 0 {
+		return true
+	}
+	mergedValues, err := mergeFileValues(baseDir, opts.ValuesFiles)
+	if err != nil {
+		return false
+	}
+	var want bytes.Buffer
+	if mergedValues = opts.mergeInlineValues(nil, mergedValues); len(mergedValues) > 0 {
+		if err = chartutil.Values(mergedValues).Encode(&want); err != nil {
+			return false
+		}
+	}
+	cached, err := secureloader.LoadFile(opts.CachedChart)
+	if err != nil {
+		return false
+	}
+	for _, f := range cached.Raw {
+		if f.Name == chartutil.ValuesfileName {
+			return bytes.Equal(f.Data, want.Bytes())
+		}
+	}
+	return false
+}
+
 // copyFileToPath attempts to copy in to out. It returns an error if out already exists.
 func copyFileToPath(in, out string) error {
 	o, err := os.Create(out)
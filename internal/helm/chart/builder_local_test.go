@@ -18,6 +18,7 @@ package chart
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"sync"
@@ -70,6 +71,7 @@ func TestLocalBuilder_Build(t *testing.T) {
 		repositories        map[string]repository.Downloader
 		dependentChartPaths []string
 		wantValues          chartutil.Values
+		wantDependencies    int
 		wantVersion         string
 		wantPackaged        bool
 		wantErr             string
@@ -143,6 +145,46 @@ fullnameOverride: "full-foo-name-override"`),
 			wantVersion:  "0.1.0",
 			wantPackaged: true,
 		},
+		{
+			name:      "with inline values",
+			reference: LocalReference{Path: "../testdata/charts/helmchart-0.1.0.tgz"},
+			buildOpts: BuildOptions{
+				Values: chartutil.Values{
+					"nameOverride": "inline-name-override",
+				},
+			},
+			wantValues: chartutil.Values{
+				"replicaCount": float64(1),
+				"nameOverride": "inline-name-override",
+			},
+			wantVersion:  "0.1.0",
+			wantPackaged: true,
+		},
+		{
+			name:      "with values files and inline values",
+			reference: LocalReference{Path: "../testdata/charts/helmchart"},
+			buildOpts: BuildOptions{
+				ValuesFiles: []string{"custom-values1.yaml"},
+				Values: chartutil.Values{
+					"replicaCount":     float64(30),
+					"fullnameOverride": "inline-full-name-override",
+				},
+			},
+			valuesFiles: []helmchart.File{
+				{
+					Name: "custom-values1.yaml",
+					Data: []byte(`replicaCount: 11
+nameOverride: "foo-name-override"`),
+				},
+			},
+			wantValues: chartutil.Values{
+				"replicaCount":     float64(30),
+				"nameOverride":     "foo-name-override",
+				"fullnameOverride": "inline-full-name-override",
+			},
+			wantVersion:  "0.1.0",
+			wantPackaged: true,
+		},
 		{
 			name:      "chart with dependencies",
 			reference: LocalReference{Path: "../testdata/charts/helmchartwithdeps"},
@@ -152,6 +194,7 @@ fullnameOverride: "full-foo-name-override"`),
 			dependentChartPaths: []string{"./../testdata/charts/helmchart"},
 			wantVersion:         "0.1.0",
 			wantPackaged:        true,
+			wantDependencies:    2,
 		},
 		{
 			name:      "v1 chart",
@@ -171,6 +214,7 @@ fullnameOverride: "full-foo-name-override"`),
 			dependentChartPaths: []string{"../testdata/charts/helmchart-v1"},
 			wantVersion:         "0.3.0",
 			wantPackaged:        true,
+			wantDependencies:    1,
 		},
 	}
 	for _, tt := range tests {
@@ -233,14 +277,40 @@ fullnameOverride: "full-foo-name-override"`),
 			resultChart, err := secureloader.LoadFile(cb.Path)
 			g.Expect(err).ToNot(HaveOccurred())
 			g.Expect(resultChart.Metadata.Version).To(Equal(tt.wantVersion))
+			g.Expect(cb.AppVersion).To(Equal(resultChart.Metadata.AppVersion))
 
 			for k, v := range tt.wantValues {
 				g.Expect(v).To(Equal(resultChart.Values[k]))
 			}
+
+			// The resolved dependencies are packaged in the charts/ directory,
+			// and loaded from there.
+			g.Expect(cb.ResolvedDependencies).To(Equal(tt.wantDependencies))
+			if tt.wantDependencies > 0 {
+				g.Expect(resultChart.Dependencies()).ToNot(BeEmpty())
+			}
 		})
 	}
 }
 
+func TestLocalBuilder_Build_MissingDependency(t *testing.T) {
+	g := NewWithT(t)
+
+	workDir := t.TempDir()
+	for _, p := range []string{"../testdata/charts/helmchartwithdeps", "../testdata/charts/helmchart"} {
+		g.Expect(copy.Copy(p, filepath.Join(workDir, "testdata", "charts", filepath.Base(p)))).To(Succeed())
+	}
+	reference := LocalReference{WorkDir: workDir, Path: "testdata/charts/helmchartwithdeps"}
+
+	// No repository is configured for the remote dependency.
+	b := NewLocalBuilder(NewDependencyManager())
+	cb, err := b.Build(context.TODO(), reference, workDir+".tgz", BuildOptions{})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(errors.Is(err, ErrDependencyBuild)).To(BeTrue())
+	g.Expect(err.Error()).To(ContainSubstring("failed to add remote dependency 'grafana'"))
+	g.Expect(cb.Path).To(BeEmpty())
+}
+
 func TestLocalBuilder_Build_CachedChart(t *testing.T) {
 	g := NewWithT(t)
 
@@ -279,6 +349,106 @@ func TestLocalBuilder_Build_CachedChart(t *testing.T) {
 	g.Expect(cb.Path).To(Equal(targetPath2))
 }
 
+func TestLocalBuilder_Build_CachedChartValuesFiles(t *testing.T) {
+	g := NewWithT(t)
+
+	workDir := t.TempDir()
+	tmpDir := t.TempDir()
+	chartDir := filepath.Join(workDir, "helmchart")
+	g.Expect(copy.Copy("./../testdata/charts/helmchart", chartDir)).To(Succeed())
+	overridePath := filepath.Join(chartDir, "override.yaml")
+	g.Expect(os.WriteFile(overridePath, []byte("replicaCount: 2\n"), 0o640)).To(Succeed())
+
+	b := NewLocalBuilder(NewDependencyManager())
+	reference := LocalReference{WorkDir: workDir, Path: "helmchart"}
+	buildOpts := BuildOptions{
+		ValuesFiles: []string{"helmchart/values.yaml", "helmchart/override.yaml"},
+	}
+
+	targetPath := filepath.Join(tmpDir, "chart1.tgz")
+	cb, err := b.Build(context.TODO(), reference, targetPath, buildOpts)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(cb.Path).To(Equal(targetPath))
+	buildOpts.CachedChart = cb.Path
+
+	// The cached chart is used while the values files are unchanged.
+	targetPath2 := filepath.Join(tmpDir, "chart2.tgz")
+	cb, err = b.Build(context.TODO(), reference, targetPath2, buildOpts)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(cb.Path).To(Equal(targetPath))
+
+	// The chart is packaged again once a values file changes, while the
+	// version of the chart is unchanged.
+	g.Expect(os.WriteFile(overridePath, []byte("replicaCount: 3\n"), 0o640)).To(Succeed())
+	cb, err = b.Build(context.TODO(), reference, targetPath2, buildOpts)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(cb.Path).To(Equal(targetPath2))
+	g.Expect(cb.Version).To(Equal("0.1.0"))
+	resultChart, err := secureloader.LoadFile(cb.Path)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(resultChart.Values["replicaCount"]).To(Equal(float64(3)))
+
+	// A missing values file fails the build, instead of using the cached
+	// chart.
+	g.Expect(os.Remove(overridePath)).To(Succeed())
+	buildOpts.CachedChart = cb.Path
+	_, err = b.Build(context.TODO(), reference, filepath.Join(tmpDir, "chart3.tgz"), buildOpts)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(errors.Is(err, ErrValuesFilesMerge)).To(BeTrue())
+	g.Expect(err.Error()).To(ContainSubstring("no values file found at path '/helmchart/override.yaml'"))
+}
+
+func TestLocalBuilder_Build_AllowedAPIVersions(t *testing.T) {
+	tests := []struct {
+		name      string
+		chartPath string
+		allowed   []string
+		wantErr   string
+	}{
+		{
+			name:      "v2 chart with v2 allowed",
+			chartPath: "testdata/charts/helmchart",
+			allowed:   []string{"v2"},
+		},
+		{
+			name:      "v1 chart with any API version allowed",
+			chartPath: "testdata/charts/helmchart-v1",
+		},
+		{
+			name:      "v1 chart with v2 allowed",
+			chartPath: "testdata/charts/helmchart-v1",
+			allowed:   []string{"v2"},
+			wantErr:   "chart 'helmchart-v1' has API version 'v1', while only 'v2' are allowed",
+		},
+		{
+			name:      "v1 chart with v1 allowed",
+			chartPath: "testdata/charts/helmchart-v1",
+			allowed:   []string{"v1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			workDir := t.TempDir()
+			g.Expect(copy.Copy(filepath.Join("./..", tt.chartPath), filepath.Join(workDir, tt.chartPath))).To(Succeed())
+
+			b := NewLocalBuilder(NewDependencyManager())
+			cb, err := b.Build(context.TODO(), LocalReference{WorkDir: workDir, Path: tt.chartPath},
+				filepath.Join(t.TempDir(), "chart.tgz"), BuildOptions{AllowedAPIVersions: tt.allowed})
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(errors.Is(err, ErrUnsupportedChart)).To(BeTrue())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				g.Expect(cb).To(BeNil())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(cb.Path).To(BeARegularFile())
+		})
+	}
+}
+
 func Test_mergeFileValues(t *testing.T) {
 	tests := []struct {
 		name    string
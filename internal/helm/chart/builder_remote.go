@@ -19,8 +19,10 @@ package chart
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 
@@ -59,10 +61,13 @@ func NewRemoteBuilder(repository repository.Downloader) Builder {
 // BuildOptions.VersionMetadata) differs from the current BuildOptions.CachedChart.
 // BuildOptions.ValuesFiles changes are in this case not taken into account,
 // and BuildOptions.Force should be used to enforce a rebuild.
+// With BuildOptions.ValidateOnly, the chart is not downloaded, and the
+// returned Build has no Path.
 //
 // After downloading the chart, it is only packaged if required due to BuildOptions
-// modifying the chart, otherwise the exact data as retrieved from the repository
-// is written to p, after validating it to be a chart.
+// modifying the chart, or the version in its metadata differing from the index,
+// otherwise the exact data as retrieved from the repository is written to p,
+// after validating it to be a chart.
 func (b *remoteChartBuilder) Build(ctx context.Context, ref Reference, p string, opts BuildOptions) (*Build, error) {
 	remoteRef, ok := ref.(RemoteReference)
 	if !ok {
@@ -82,13 +87,17 @@ func (b *remoteChartBuilder) Build(ctx context.Context, ref Reference, p string,
 		return result, nil
 	}
 
-	requiresPackaging := len(opts.GetValuesFiles()) != 0 || opts.VersionMetadata != ""
+	// A chart of which the version differs from the index entry is packaged
+	// with the version of the entry, for it to be served from cache by the
+	// next build.
+	requiresPackaging := len(opts.GetValuesFiles()) != 0 || len(opts.Values) != 0 || opts.VersionMetadata != "" ||
+		result.MismatchedVersion != ""
 
-	// Use literal chart copy from remote if no custom values files options are
-	// set or version metadata isn't set.
+	// Use literal chart copy from remote if no custom values (files) options
+	// are set, version metadata isn't set and the version of the chart matches.
 	if !requiresPackaging {
 		if err = validatePackageAndWriteToPath(res, p); err != nil {
-			return nil, &BuildError{Reason: ErrChartPull, Err: err}
+			return nil, &BuildError{Reason: archiveErrorReason(err, ErrChartPull), Err: err}
 		}
 		result.Path = p
 		return result, nil
@@ -98,21 +107,25 @@ func (b *remoteChartBuilder) Build(ctx context.Context, ref Reference, p string,
 	var chart *helmchart.Chart
 	if chart, err = secureloader.LoadArchive(res); err != nil {
 		err = fmt.Errorf("failed to load downloaded chart: %w", err)
-		return result, &BuildError{Reason: ErrChartPackage, Err: err}
+		return result, &BuildError{Reason: archiveErrorReason(err, ErrChartPackage), Err: err}
 	}
 	chart.Metadata.Version = result.Version
 
-	mergedValues, err := mergeChartValues(chart, opts.ValuesFiles)
-	if err != nil {
-		err = fmt.Errorf("failed to merge chart values: %w", err)
-		return result, &BuildError{Reason: ErrValuesFilesMerge, Err: err}
-	}
-	// Overwrite default values with merged values, if any
-	if ok, err = OverwriteChartDefaultValues(chart, mergedValues); ok || err != nil {
+	if len(opts.GetValuesFiles()) != 0 || len(opts.Values) != 0 {
+		mergedValues, err := mergeChartValues(chart, opts.ValuesFiles)
 		if err != nil {
-			return nil, &BuildError{Reason: ErrValuesFilesMerge, Err: err}
+			err = fmt.Errorf("failed to merge chart values: %w", err)
+			return result, &BuildError{Reason: ErrValuesFilesMerge, Err: err}
+		}
+		mergedValues = opts.mergeInlineValues(chart.Values, mergedValues)
+
+		// Overwrite default values with merged values, if any
+		if ok, err = OverwriteChartDefaultValues(chart, mergedValues); ok || err != nil {
+			if err != nil {
+				return nil, &BuildError{Reason: ErrValuesFilesMerge, Err: err}
+			}
+			result.ValuesFiles = opts.GetValuesFiles()
 		}
-		result.ValuesFiles = opts.GetValuesFiles()
 	}
 
 	// Package the chart with the custom values
@@ -141,8 +154,18 @@ func (b *remoteChartBuilder) downloadFromRepository(ctx context.Context, remote
 		return nil, nil, &BuildError{Reason: reason, Err: err}
 	}
 
-	// Verify the chart if necessary
-	if opts.Verify {
+	// Detect an index entry without a digest. OCI repositories have no
+	// index, and are therefore not subject to this check.
+	index, fromIndex := remote.(*repository.ChartRepository)
+	missingDigest := fromIndex && cv.Digest == ""
+	if missingDigest && opts.RequireIndexDigest {
+		err = fmt.Errorf("chart '%s' version '%s' has no digest in the repository index", cv.Name, cv.Version)
+		return nil, nil, &BuildError{Reason: ErrMissingDigest, Err: err}
+	}
+
+	// Verify the chart if necessary. Charts from an index are verified
+	// against their provenance file once downloaded.
+	if opts.Verify && !fromIndex {
 		if err := remote.VerifyChart(ctx, cv); err != nil {
 			return nil, nil, &BuildError{Reason: ErrChartVerification, Err: err}
 		}
@@ -153,17 +176,82 @@ func (b *remoteChartBuilder) downloadFromRepository(ctx context.Context, remote
 		return nil, nil, err
 	}
 
+	// Determine the latest available version, to allow reporting if the
+	// resolved version is behind
+	result.LatestVersion = cv.Version
+	if remoteRef.Version != "" && remoteRef.Version != "*" {
+		if latest, err := remote.GetChartVersion(remoteRef.Name, "*"); err == nil {
+			result.LatestVersion = latest.Version
+		}
+	}
+
 	if shouldReturn {
 		return nil, result, nil
 	}
 
+	// Confirm the chart can be downloaded without downloading it, unless
+	// the downloaded chart is required to verify its provenance. The chart
+	// version of an OCI repository is resolved from the tags in the
+	// registry, which confirms the chart can be pulled.
+	if opts.ValidateOnly && !(opts.Verify && fromIndex) {
+		if fromIndex {
+			if err = opts.checkAPIVersion(cv.Metadata); err != nil {
+				return nil, nil, err
+			}
+			if err = index.CheckChart(cv); err != nil {
+				err = fmt.Errorf("failed to check chart for remote reference: %w", err)
+				return nil, nil, &BuildError{Reason: ErrChartPull, Err: err}
+			}
+		}
+		result.MissingDigest = missingDigest
+		result.Validated = true
+		return nil, result, nil
+	}
+
 	// Download the package for the resolved version
+	// The download is bounded by the timeout the getter of the remote is
+	// configured with
 	res, err := remote.DownloadChart(cv)
 	if err != nil {
-		err = fmt.Errorf("failed to download chart for remote reference: %w", err)
+		if isTimeout(err) {
+			err = fmt.Errorf("timeout exceeded while downloading chart for remote reference: %w", err)
+		} else {
+			err = fmt.Errorf("failed to download chart for remote reference: %w", err)
+		}
 		return nil, nil, &BuildError{Reason: ErrChartPull, Err: err}
 	}
 
+	// Detect a version in the chart metadata which differs from the index
+	meta, err := LoadChartMetadataFromArchiveReader(bytes.NewReader(res.Bytes()))
+	if err != nil {
+		err = fmt.Errorf("failed to load metadata of downloaded chart: %w", err)
+		return nil, nil, &BuildError{Reason: archiveErrorReason(err, ErrChartPull), Err: err}
+	}
+	if err = opts.checkAPIVersion(meta); err != nil {
+		return nil, nil, err
+	}
+	if meta.Version != cv.Version {
+		if opts.FailOnVersionMismatch {
+			err = fmt.Errorf("chart declares version '%s' while the repository index has version '%s'", meta.Version, cv.Version)
+			return nil, nil, &BuildError{Reason: ErrVersionMismatch, Err: err}
+		}
+		result.MismatchedVersion = meta.Version
+	}
+	if result.AppVersion == "" {
+		// OCI repositories do not provide an index with the app version
+		result.AppVersion = meta.AppVersion
+	}
+	result.MissingDigest = missingDigest
+
+	// Verify the provenance of the downloaded chart
+	if opts.Verify && fromIndex {
+		ver, err := index.VerifyProvenance(cv, res.Bytes())
+		if err != nil {
+			return nil, nil, &BuildError{Reason: ErrChartProvenance, Err: err}
+		}
+		result.SignerKeyID = ver.SignedBy.PrimaryKey.KeyIdString()
+	}
+
 	return res, result, nil
 }
 
@@ -173,6 +261,8 @@ func generateBuildResult(cv *repo.ChartVersion, opts BuildOptions) (*Build, bool
 	result := &Build{}
 	result.Version = cv.Version
 	result.Name = cv.Name
+	result.AppVersion = cv.AppVersion
+	result.Deprecated = cv.Deprecated
 
 	// Set build specific metadata if instructed
 	if opts.VersionMetadata != "" {
@@ -183,7 +273,7 @@ func generateBuildResult(cv *repo.ChartVersion, opts BuildOptions) (*Build, bool
 		result.Version = ver.String()
 	}
 
-	requiresPackaging := len(opts.GetValuesFiles()) != 0 || opts.VersionMetadata != ""
+	requiresPackaging := len(opts.GetValuesFiles()) != 0 || len(opts.Values) != 0 || opts.VersionMetadata != ""
 
 	// If all the following is true, we do not need to download and/or build the chart:
 	// - Chart name from cached chart matches resolved name
@@ -195,6 +285,12 @@ func generateBuildResult(cv *repo.ChartVersion, opts BuildOptions) (*Build, bool
 			// and continue the build
 			if err = curMeta.Validate(); err == nil {
 				if result.Name == curMeta.Name && result.Version == curMeta.Version {
+					if err = opts.checkAPIVersion(curMeta); err != nil {
+						return nil, false, err
+					}
+					if result.AppVersion == "" {
+						result.AppVersion = curMeta.AppVersion
+					}
 					result.Path = opts.CachedChart
 					result.ValuesFiles = opts.GetValuesFiles()
 					result.Packaged = requiresPackaging
@@ -287,3 +383,13 @@ func pathIsDir(p string) bool {
 	}
 	return true
 }
+
+// isTimeout returns true if the given error is caused by a timeout, either
+// of a context or of a network operation.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
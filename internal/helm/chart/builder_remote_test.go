@@ -17,15 +17,21 @@ limitations under the License.
 package chart
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	helmchart "helm.sh/helm/v3/pkg/chart"
@@ -33,6 +39,8 @@ import (
 	helmgetter "helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/registry"
 
+	"github.com/fluxcd/pkg/helmtestserver"
+
 	"github.com/fluxcd/source-controller/internal/helm/chart/secureloader"
 	"github.com/fluxcd/source-controller/internal/helm/repository"
 )
@@ -62,10 +70,11 @@ func (m *mockRegistryClient) Logout(url string, opts ...registry.LogoutOption) e
 
 // mockIndexChartGetter returns specific response for index and chart queries.
 type mockIndexChartGetter struct {
-	IndexResponse []byte
-	ChartResponse []byte
-	ErrorResponse error
-	requestedURL  string
+	IndexResponse      []byte
+	ChartResponse      []byte
+	ProvenanceResponse []byte
+	ErrorResponse      error
+	requestedURL       string
 }
 
 func (g *mockIndexChartGetter) Get(u string, _ ...helmgetter.Option) (*bytes.Buffer, error) {
@@ -77,6 +86,9 @@ func (g *mockIndexChartGetter) Get(u string, _ ...helmgetter.Option) (*bytes.Buf
 	if strings.HasSuffix(u, "index.yaml") {
 		r = g.IndexResponse
 	}
+	if strings.HasSuffix(u, ".prov") {
+		r = g.ProvenanceResponse
+	}
 	return bytes.NewBuffer(r), nil
 }
 
@@ -165,10 +177,11 @@ entries:
 			name:        "default values",
 			reference:   RemoteReference{Name: "grafana"},
 			repository:  mockRepo(),
-			wantVersion: "0.1.0",
+			wantVersion: "6.17.4",
 			wantValues: chartutil.Values{
 				"replicaCount": float64(1),
 			},
+			wantPackaged: true,
 		},
 		{
 			name:      "merge values",
@@ -184,6 +197,35 @@ entries:
 			},
 			wantPackaged: true,
 		},
+		{
+			name:      "inline values",
+			reference: RemoteReference{Name: "grafana"},
+			buildOpts: BuildOptions{
+				Values: chartutil.Values{"a": "inline"},
+			},
+			repository:  mockRepo(),
+			wantVersion: "6.17.4",
+			wantValues: chartutil.Values{
+				"replicaCount": float64(1),
+				"a":            "inline",
+			},
+			wantPackaged: true,
+		},
+		{
+			name:      "merge values and inline values",
+			reference: RemoteReference{Name: "grafana"},
+			buildOpts: BuildOptions{
+				ValuesFiles: []string{"a.yaml", "b.yaml"},
+				Values:      chartutil.Values{"b": "inline"},
+			},
+			repository:  mockRepo(),
+			wantVersion: "6.17.4",
+			wantValues: chartutil.Values{
+				"a": "b",
+				"b": "inline",
+			},
+			wantPackaged: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -216,6 +258,7 @@ entries:
 			resultChart, err := secureloader.LoadFile(cb.Path)
 			g.Expect(err).ToNot(HaveOccurred())
 			g.Expect(resultChart.Metadata.Version).To(Equal(tt.wantVersion))
+			g.Expect(cb.AppVersion).To(Equal(resultChart.Metadata.AppVersion))
 
 			for k, v := range tt.wantValues {
 				g.Expect(v).To(Equal(resultChart.Values[k]))
@@ -224,6 +267,715 @@ entries:
 	}
 }
 
+func TestRemoteBuilder_Build_LatestVersion(t *testing.T) {
+	g := NewWithT(t)
+
+	chartGrafana, err := os.ReadFile("./../testdata/charts/helmchart-0.1.0.tgz")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	index := []byte(`
+apiVersion: v1
+entries:
+  grafana:
+    - urls:
+        - https://example.com/grafana-6.17.4.tgz
+      version: 6.17.4
+    - urls:
+        - https://example.com/grafana-6.16.0.tgz
+      version: 6.16.0
+    - urls:
+        - https://example.com/grafana-7.0.0-rc.1.tgz
+      version: 7.0.0-rc.1
+`)
+
+	tests := []struct {
+		name           string
+		version        string
+		wantVersion    string
+		wantLatest     string
+		wantNewerAvail bool
+	}{
+		{
+			name:        "resolved version is latest",
+			version:     "",
+			wantVersion: "6.17.4",
+			wantLatest:  "6.17.4",
+		},
+		{
+			name:        "resolved version range is latest",
+			version:     "6.x",
+			wantVersion: "6.17.4",
+			wantLatest:  "6.17.4",
+		},
+		{
+			name:           "resolved version is behind latest",
+			version:        "6.16.0",
+			wantVersion:    "6.16.0",
+			wantLatest:     "6.17.4",
+			wantNewerAvail: true,
+		},
+		{
+			name:        "resolved prerelease is ahead of latest",
+			version:     ">=7.0.0-0",
+			wantVersion: "7.0.0-rc.1",
+			wantLatest:  "6.17.4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			repo := &repository.ChartRepository{
+				URL: "https://grafana.github.io/helm-charts/",
+				Client: &mockIndexChartGetter{
+					IndexResponse: index,
+					ChartResponse: chartGrafana,
+				},
+				RWMutex: &sync.RWMutex{},
+			}
+			g.Expect(repo.CacheIndex()).To(Succeed())
+			defer os.Remove(repo.Path)
+
+			b := NewRemoteBuilder(repo)
+			cb, err := b.Build(context.TODO(), RemoteReference{Name: "grafana", Version: tt.version},
+				filepath.Join(t.TempDir(), "chart.tgz"), BuildOptions{})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(cb.Version).To(Equal(tt.wantVersion))
+			g.Expect(cb.LatestVersion).To(Equal(tt.wantLatest))
+			g.Expect(cb.NewerVersionAvailable()).To(Equal(tt.wantNewerAvail))
+		})
+	}
+}
+
+func TestRemoteBuilder_Build_Deprecated(t *testing.T) {
+	g := NewWithT(t)
+
+	chartGrafana, err := os.ReadFile("./../testdata/charts/helmchart-0.1.0.tgz")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	index := []byte(`
+apiVersion: v1
+entries:
+  grafana:
+    - urls:
+        - https://example.com/grafana-6.17.4.tgz
+      version: 6.17.4
+      deprecated: true
+    - urls:
+        - https://example.com/grafana-6.16.0.tgz
+      version: 6.16.0
+`)
+
+	tests := []struct {
+		name           string
+		version        string
+		wantDeprecated bool
+	}{
+		{
+			name:           "deprecated chart version",
+			version:        "6.17.4",
+			wantDeprecated: true,
+		},
+		{
+			name:    "chart version which is not deprecated",
+			version: "6.16.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			repo := &repository.ChartRepository{
+				URL: "https://grafana.github.io/helm-charts/",
+				Client: &mockIndexChartGetter{
+					IndexResponse: index,
+					ChartResponse: chartGrafana,
+				},
+				RWMutex: &sync.RWMutex{},
+			}
+			g.Expect(repo.CacheIndex()).To(Succeed())
+			defer os.Remove(repo.Path)
+
+			b := NewRemoteBuilder(repo)
+			cb, err := b.Build(context.TODO(), RemoteReference{Name: "grafana", Version: tt.version},
+				filepath.Join(t.TempDir(), "chart.tgz"), BuildOptions{})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(cb.Version).To(Equal(tt.version))
+			g.Expect(cb.Deprecated).To(Equal(tt.wantDeprecated))
+		})
+	}
+}
+
+func TestRemoteBuilder_Build_AllowedAPIVersions(t *testing.T) {
+	tests := []struct {
+		name       string
+		chartFile  string
+		chartName  string
+		version    string
+		allowed    []string
+		wantErr    string
+		wantCached bool
+	}{
+		{
+			name:      "v2 chart with any API version allowed",
+			chartFile: "helmchart-0.1.0.tgz",
+			chartName: "helmchart",
+			version:   "0.1.0",
+		},
+		{
+			name:      "v1 chart with any API version allowed",
+			chartFile: "helmchartwithdeps-v1-0.3.0.tgz",
+			chartName: "helmchartwithdeps-v1",
+			version:   "0.3.0",
+		},
+		{
+			name:      "v2 chart with v2 allowed",
+			chartFile: "helmchart-0.1.0.tgz",
+			chartName: "helmchart",
+			version:   "0.1.0",
+			allowed:   []string{"v2"},
+		},
+		{
+			name:      "v1 chart with v2 allowed",
+			chartFile: "helmchartwithdeps-v1-0.3.0.tgz",
+			chartName: "helmchartwithdeps-v1",
+			version:   "0.3.0",
+			allowed:   []string{"v2"},
+			wantErr:   "chart 'helmchartwithdeps-v1' has API version 'v1', while only 'v2' are allowed",
+		},
+		{
+			name:      "v1 chart with v1 and v2 allowed",
+			chartFile: "helmchartwithdeps-v1-0.3.0.tgz",
+			chartName: "helmchartwithdeps-v1",
+			version:   "0.3.0",
+			allowed:   []string{"v1", "v2"},
+		},
+		{
+			name:       "cached v1 chart with v2 allowed",
+			chartFile:  "helmchartwithdeps-v1-0.3.0.tgz",
+			chartName:  "helmchartwithdeps-v1",
+			version:    "0.3.0",
+			allowed:    []string{"v2"},
+			wantCached: true,
+			wantErr:    "chart 'helmchartwithdeps-v1' has API version 'v1', while only 'v2' are allowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			chartPath := filepath.Join("./../testdata/charts", tt.chartFile)
+			chartData, err := os.ReadFile(chartPath)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			index := []byte(fmt.Sprintf(`
+apiVersion: v1
+entries:
+  %s:
+    - name: %s
+      urls:
+        - https://example.com/%s
+      version: %s
+`, tt.chartName, tt.chartName, tt.chartFile, tt.version))
+
+			repo := &repository.ChartRepository{
+				URL: "https://example.com/",
+				Client: &mockIndexChartGetter{
+					IndexResponse: index,
+					ChartResponse: chartData,
+				},
+				RWMutex: &sync.RWMutex{},
+			}
+			g.Expect(repo.CacheIndex()).To(Succeed())
+			defer os.Remove(repo.Path)
+
+			opts := BuildOptions{AllowedAPIVersions: tt.allowed}
+			if tt.wantCached {
+				opts.CachedChart = chartPath
+			}
+
+			b := NewRemoteBuilder(repo)
+			cb, err := b.Build(context.TODO(), RemoteReference{Name: tt.chartName, Version: tt.version},
+				filepath.Join(t.TempDir(), "chart.tgz"), opts)
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(errors.Is(err, ErrUnsupportedChart)).To(BeTrue())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				g.Expect(cb).To(BeNil())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(cb.Name).To(Equal(tt.chartName))
+			g.Expect(cb.Path).To(BeARegularFile())
+		})
+	}
+}
+
+func TestRemoteBuilder_Build_VersionMismatch(t *testing.T) {
+	g := NewWithT(t)
+
+	chartHelm, err := os.ReadFile("./../testdata/charts/helmchart-0.1.0.tgz")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	tests := []struct {
+		name                  string
+		indexVersion          string
+		failOnVersionMismatch bool
+		wantMismatchedVersion string
+		wantErr               error
+	}{
+		{
+			name:         "matching version",
+			indexVersion: "0.1.0",
+		},
+		{
+			name:                  "matching version with fail on mismatch",
+			indexVersion:          "0.1.0",
+			failOnVersionMismatch: true,
+		},
+		{
+			name:                  "mismatching version",
+			indexVersion:          "0.2.0",
+			wantMismatchedVersion: "0.1.0",
+		},
+		{
+			name:                  "mismatching version with fail on mismatch",
+			indexVersion:          "0.2.0",
+			failOnVersionMismatch: true,
+			wantErr:               ErrVersionMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			index := []byte(fmt.Sprintf(`
+apiVersion: v1
+entries:
+  helmchart:
+    - name: helmchart
+      urls:
+        - https://example.com/helmchart.tgz
+      version: %s
+`, tt.indexVersion))
+
+			repo := &repository.ChartRepository{
+				URL: "https://example.com/",
+				Client: &mockIndexChartGetter{
+					IndexResponse: index,
+					ChartResponse: chartHelm,
+				},
+				RWMutex: &sync.RWMutex{},
+			}
+			g.Expect(repo.CacheIndex()).To(Succeed())
+			defer os.Remove(repo.Path)
+
+			b := NewRemoteBuilder(repo)
+			cb, err := b.Build(context.TODO(), RemoteReference{Name: "helmchart"},
+				filepath.Join(t.TempDir(), "chart.tgz"), BuildOptions{FailOnVersionMismatch: tt.failOnVersionMismatch})
+			if tt.wantErr != nil {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(errors.Is(err, tt.wantErr)).To(BeTrue())
+				g.Expect(err.Error()).To(ContainSubstring("chart declares version '0.1.0' while the repository index has version '0.2.0'"))
+				g.Expect(cb).To(BeNil())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(cb.Version).To(Equal(tt.indexVersion))
+			g.Expect(cb.MismatchedVersion).To(Equal(tt.wantMismatchedVersion))
+			g.Expect(cb.Path).To(BeARegularFile())
+
+			// The stored chart declares the version of the index entry.
+			meta, err := LoadChartMetadataFromArchive(cb.Path)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(meta.Version).To(Equal(tt.indexVersion))
+
+			// A next build is served from cache.
+			cached, err := b.Build(context.TODO(), RemoteReference{Name: "helmchart"},
+				filepath.Join(t.TempDir(), "chart.tgz"), BuildOptions{
+					FailOnVersionMismatch: tt.failOnVersionMismatch,
+					CachedChart:           cb.Path,
+				})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(cached.Path).To(Equal(cb.Path))
+			g.Expect(cached.MismatchedVersion).To(BeEmpty())
+		})
+	}
+}
+
+func TestRemoteBuilder_Build_MissingDigest(t *testing.T) {
+	g := NewWithT(t)
+
+	chartHelm, err := os.ReadFile("./../testdata/charts/helmchart-0.1.0.tgz")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	tests := []struct {
+		name               string
+		digest             string
+		requireIndexDigest bool
+		wantMissingDigest  bool
+		wantErr            error
+	}{
+		{
+			name:   "entry with digest",
+			digest: "sha256:2b3d4f8d5d6b5e0e8c44f6e1748c1a1b8d1b0c1e1b9d0b0a0f1e2d3c4b5a6978",
+		},
+		{
+			name:               "entry with digest with require index digest",
+			digest:             "sha256:2b3d4f8d5d6b5e0e8c44f6e1748c1a1b8d1b0c1e1b9d0b0a0f1e2d3c4b5a6978",
+			requireIndexDigest: true,
+		},
+		{
+			name:              "entry without digest",
+			wantMissingDigest: true,
+		},
+		{
+			name:               "entry without digest with require index digest",
+			requireIndexDigest: true,
+			wantErr:            ErrMissingDigest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			index := []byte(fmt.Sprintf(`
+apiVersion: v1
+entries:
+  helmchart:
+    - name: helmchart
+      urls:
+        - https://example.com/helmchart.tgz
+      version: 0.1.0
+      digest: %q
+`, tt.digest))
+
+			repo := &repository.ChartRepository{
+				URL: "https://example.com/",
+				Client: &mockIndexChartGetter{
+					IndexResponse: index,
+					ChartResponse: chartHelm,
+				},
+				RWMutex: &sync.RWMutex{},
+			}
+			g.Expect(repo.CacheIndex()).To(Succeed())
+			defer os.Remove(repo.Path)
+
+			b := NewRemoteBuilder(repo)
+			cb, err := b.Build(context.TODO(), RemoteReference{Name: "helmchart"},
+				filepath.Join(t.TempDir(), "chart.tgz"), BuildOptions{RequireIndexDigest: tt.requireIndexDigest})
+			if tt.wantErr != nil {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(errors.Is(err, tt.wantErr)).To(BeTrue())
+				g.Expect(err.Error()).To(ContainSubstring("chart 'helmchart' version '0.1.0' has no digest in the repository index"))
+				g.Expect(cb).To(BeNil())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(cb.MissingDigest).To(Equal(tt.wantMissingDigest))
+			g.Expect(cb.Path).To(BeARegularFile())
+		})
+	}
+}
+
+func TestRemoteBuilder_Build_MaliciousArchive(t *testing.T) {
+	g := NewWithT(t)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, data := range map[string]string{
+		"helmchart/Chart.yaml": "apiVersion: v2\nname: helmchart\nversion: 0.1.0\n",
+		"helmchart/../../evil": "evil",
+	} {
+		g.Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data))})).To(Succeed())
+		_, err := tw.Write([]byte(data))
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	g.Expect(tw.Close()).To(Succeed())
+	g.Expect(gw.Close()).To(Succeed())
+
+	index := []byte(`
+apiVersion: v1
+entries:
+  helmchart:
+    - name: helmchart
+      urls:
+        - https://example.com/helmchart.tgz
+      version: 0.1.0
+`)
+
+	repo := &repository.ChartRepository{
+		URL: "https://example.com/",
+		Client: &mockIndexChartGetter{
+			IndexResponse: index,
+			ChartResponse: buf.Bytes(),
+		},
+		RWMutex: &sync.RWMutex{},
+	}
+	g.Expect(repo.CacheIndex()).To(Succeed())
+	defer os.Remove(repo.Path)
+
+	p := filepath.Join(t.TempDir(), "chart.tgz")
+	b := NewRemoteBuilder(repo)
+	cb, err := b.Build(context.TODO(), RemoteReference{Name: "helmchart"}, p, BuildOptions{})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(errors.Is(err, ErrMaliciousArchive)).To(BeTrue())
+	g.Expect(errors.Is(err, secureloader.ErrPathTraversal)).To(BeTrue())
+	g.Expect(IsPersistentBuildErrorReason(ErrMaliciousArchive)).To(BeTrue())
+	g.Expect(cb).To(BeNil())
+	g.Expect(p).ToNot(BeAnExistingFile())
+}
+
+func TestRemoteBuilder_Build_DownloadTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	// The server serves the index, but hangs on chart downloads until the
+	// request is cancelled.
+	cancelled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			<-r.Context().Done()
+			close(cancelled)
+			return
+		}
+		_, _ = w.Write([]byte(`
+apiVersion: v1
+entries:
+  helmchart:
+    - name: helmchart
+      urls:
+        - helmchart-0.1.0.tgz
+      version: 0.1.0
+`))
+	}))
+	defer server.Close()
+
+	providers := helmgetter.Providers{
+		helmgetter.Provider{
+			Schemes: []string{"http"},
+			New:     helmgetter.NewHTTPGetter,
+		},
+	}
+	repo, err := repository.NewChartRepository(server.URL, "", providers, nil,
+		helmgetter.WithTimeout(100*time.Millisecond))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(repo.CacheIndex()).To(Succeed())
+	defer os.Remove(repo.Path)
+
+	p := filepath.Join(t.TempDir(), "chart.tgz")
+	b := NewRemoteBuilder(repo)
+
+	start := time.Now()
+	cb, err := b.Build(context.TODO(), RemoteReference{Name: "helmchart"}, p, BuildOptions{})
+	g.Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(errors.Is(err, ErrChartPull)).To(BeTrue())
+	g.Expect(err.Error()).To(ContainSubstring("timeout exceeded while downloading chart"))
+	g.Expect(cb).To(BeNil())
+	g.Expect(p).ToNot(BeAnExistingFile())
+
+	// The download itself is cancelled.
+	g.Eventually(cancelled).Should(BeClosed())
+}
+
+func TestRemoteBuilder_Build_ValidateOnly(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		methods []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			mu.Lock()
+			methods = append(methods, r.Method)
+			mu.Unlock()
+			if r.URL.Path != "/helmchart-0.1.0.tgz" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte("chart"))
+			return
+		}
+		_, _ = w.Write([]byte(`
+apiVersion: v1
+entries:
+  helmchart:
+    - name: helmchart
+      apiVersion: v2
+      urls:
+        - helmchart-0.1.0.tgz
+      version: 0.1.0
+  missing:
+    - name: missing
+      apiVersion: v2
+      urls:
+        - missing-0.1.0.tgz
+      version: 0.1.0
+`))
+	}))
+	defer server.Close()
+
+	providers := helmgetter.Providers{
+		helmgetter.Provider{
+			Schemes: []string{"http"},
+			New:     helmgetter.NewHTTPGetter,
+		},
+	}
+
+	tests := []struct {
+		name    string
+		chart   string
+		opts    BuildOptions
+		wantErr string
+	}{
+		{
+			name:  "available chart",
+			chart: "helmchart",
+		},
+		{
+			name:    "missing chart",
+			chart:   "missing",
+			wantErr: "failed to check chart for remote reference",
+		},
+		{
+			name:    "unsupported API version",
+			chart:   "helmchart",
+			opts:    BuildOptions{AllowedAPIVersions: []string{"v1"}},
+			wantErr: "has API version 'v2'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			mu.Lock()
+			methods = nil
+			mu.Unlock()
+
+			repo, err := repository.NewChartRepository(server.URL, "", providers, nil)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(repo.CacheIndex()).To(Succeed())
+			defer os.Remove(repo.Path)
+
+			p := filepath.Join(t.TempDir(), "chart.tgz")
+			b := NewRemoteBuilder(repo)
+
+			opts := tt.opts
+			opts.ValidateOnly = true
+			cb, err := b.Build(context.TODO(), RemoteReference{Name: tt.chart}, p, opts)
+			g.Expect(p).ToNot(BeAnExistingFile())
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, m := range methods {
+				g.Expect(m).To(Equal(http.MethodHead))
+			}
+
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				g.Expect(cb).To(BeNil())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(methods).To(HaveLen(1))
+			g.Expect(cb.Name).To(Equal("helmchart"))
+			g.Expect(cb.Version).To(Equal("0.1.0"))
+			g.Expect(cb.Path).To(BeEmpty())
+			g.Expect(cb.Validated).To(BeTrue())
+			g.Expect(cb.Complete()).To(BeTrue())
+		})
+	}
+}
+
+func TestRemoteBuilder_Build_Provenance(t *testing.T) {
+	g := NewWithT(t)
+
+	server, err := helmtestserver.NewTempHelmServer()
+	g.Expect(err).ToNot(HaveOccurred())
+	t.Cleanup(func() { _ = os.RemoveAll(server.Root()) })
+
+	keyringPath := filepath.Join(t.TempDir(), "pub.pgp")
+	g.Expect(server.PackageSignedChartWithVersion("./../testdata/charts/helmchart", "0.1.0", keyringPath)).To(Succeed())
+	otherKeyringPath := filepath.Join(t.TempDir(), "other.pgp")
+	g.Expect(server.PackageSignedChartWithVersion("./../testdata/charts/helmchart", "0.2.0", otherKeyringPath)).To(Succeed())
+
+	chartHelm, err := os.ReadFile(filepath.Join(server.Root(), "helmchart-0.1.0.tgz"))
+	g.Expect(err).ToNot(HaveOccurred())
+	prov, err := os.ReadFile(filepath.Join(server.Root(), "helmchart-0.1.0.tgz.prov"))
+	g.Expect(err).ToNot(HaveOccurred())
+	keyring, err := os.ReadFile(keyringPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	otherKeyring, err := os.ReadFile(otherKeyringPath)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	index := []byte(`
+apiVersion: v1
+entries:
+  helmchart:
+    - name: helmchart
+      urls:
+        - https://example.com/helmchart-0.1.0.tgz
+      version: 0.1.0
+`)
+
+	tests := []struct {
+		name            string
+		keyring         []byte
+		verify          bool
+		wantSignerKeyID bool
+		wantErr         error
+	}{
+		{
+			name:    "without verification",
+			keyring: keyring,
+		},
+		{
+			name:            "verified provenance",
+			keyring:         keyring,
+			verify:          true,
+			wantSignerKeyID: true,
+		},
+		{
+			name:    "provenance signed by unknown key",
+			keyring: otherKeyring,
+			verify:  true,
+			wantErr: ErrChartProvenance,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			repo := &repository.ChartRepository{
+				URL: "https://example.com/",
+				Client: &mockIndexChartGetter{
+					IndexResponse:      index,
+					ChartResponse:      chartHelm,
+					ProvenanceResponse: prov,
+				},
+				Keyring: tt.keyring,
+				RWMutex: &sync.RWMutex{},
+			}
+			g.Expect(repo.CacheIndex()).To(Succeed())
+			defer os.Remove(repo.Path)
+
+			b := NewRemoteBuilder(repo)
+			cb, err := b.Build(context.TODO(), RemoteReference{Name: "helmchart"},
+				filepath.Join(t.TempDir(), "chart.tgz"), BuildOptions{Verify: tt.verify})
+			if tt.wantErr != nil {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(errors.Is(err, tt.wantErr)).To(BeTrue())
+				g.Expect(cb).To(BeNil())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(cb.SignerKeyID != "").To(Equal(tt.wantSignerKeyID))
+			g.Expect(cb.Path).To(BeARegularFile())
+		})
+	}
+}
+
 func TestRemoteBuilder_BuildFromOCIChartRepository(t *testing.T) {
 	g := NewWithT(t)
 
@@ -313,19 +1065,21 @@ func TestRemoteBuilder_BuildFromOCIChartRepository(t *testing.T) {
 			name:        "default values",
 			reference:   RemoteReference{Name: "grafana"},
 			repository:  mockRepo(),
-			wantVersion: "0.1.0",
+			wantVersion: "6.17.4",
 			wantValues: chartutil.Values{
 				"replicaCount": float64(1),
 			},
+			wantPackaged: true,
 		},
 		{
 			name:        "default values",
 			reference:   RemoteReference{Name: "another/grafana"},
 			repository:  mockRepo(),
-			wantVersion: "0.1.0",
+			wantVersion: "6.17.4",
 			wantValues: chartutil.Values{
 				"replicaCount": float64(1),
 			},
+			wantPackaged: true,
 		},
 		{
 			name:      "merge values",
@@ -369,6 +1123,7 @@ func TestRemoteBuilder_BuildFromOCIChartRepository(t *testing.T) {
 			resultChart, err := secureloader.LoadFile(cb.Path)
 			g.Expect(err).ToNot(HaveOccurred())
 			g.Expect(resultChart.Metadata.Version).To(Equal(tt.wantVersion))
+			g.Expect(cb.AppVersion).To(Equal(resultChart.Metadata.AppVersion))
 
 			for k, v := range tt.wantValues {
 				g.Expect(v).To(Equal(resultChart.Values[k]))
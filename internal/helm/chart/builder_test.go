@@ -179,6 +179,15 @@ func TestChartBuildResult_Summary(t *testing.T) {
 			},
 			want: "pulled 'chart' chart with version '1.2.3-rc.1+bd6bf40'",
 		},
+		{
+			name: "Validated chart",
+			build: &Build{
+				Name:      "chart",
+				Version:   "1.2.3",
+				Validated: true,
+			},
+			want: "validated 'chart' chart with version '1.2.3'",
+		},
 		{
 			name: "Packaged chart",
 			build: &Build{
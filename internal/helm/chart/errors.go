@@ -19,6 +19,8 @@ package chart
 import (
 	"errors"
 	"fmt"
+
+	"github.com/fluxcd/source-controller/internal/helm/chart/secureloader"
 )
 
 // BuildErrorReason is the descriptive reason for a BuildError.
@@ -70,7 +72,7 @@ func (e *BuildError) Unwrap() error {
 
 func IsPersistentBuildErrorReason(err error) bool {
 	switch err {
-	case ErrChartReference, ErrChartMetadataPatch, ErrValuesFilesMerge:
+	case ErrChartReference, ErrChartMetadataPatch, ErrValuesFilesMerge, ErrMaliciousArchive:
 		return true
 	default:
 		return false
@@ -85,5 +87,20 @@ var (
 	ErrDependencyBuild    = BuildErrorReason{Reason: "DependencyBuildError", Summary: "dependency build error"}
 	ErrChartPackage       = BuildErrorReason{Reason: "ChartPackageError", Summary: "chart package error"}
 	ErrChartVerification  = BuildErrorReason{Reason: "ChartVerificationError", Summary: "chart verification error"}
+	ErrChartProvenance    = BuildErrorReason{Reason: "VerificationFailed", Summary: "chart provenance verification error"}
+	ErrVersionMismatch    = BuildErrorReason{Reason: "VersionMismatch", Summary: "chart version mismatch"}
+	ErrUnsupportedChart   = BuildErrorReason{Reason: "UnsupportedChart", Summary: "unsupported chart"}
+	ErrMissingDigest      = BuildErrorReason{Reason: "MissingDigest", Summary: "chart digest missing"}
+	ErrMaliciousArchive   = BuildErrorReason{Reason: "MaliciousArchive", Summary: "malicious chart archive"}
 	ErrUnknown            = BuildErrorReason{Reason: "Unknown", Summary: "unknown build error"}
 )
+
+// archiveErrorReason returns ErrMaliciousArchive if the given error is caused
+// by a chart archive with an entry escaping the chart directory, or the given
+// reason otherwise.
+func archiveErrorReason(err error, reason BuildErrorReason) BuildErrorReason {
+	if errors.Is(err, secureloader.ErrPathTraversal) {
+		return ErrMaliciousArchive
+	}
+	return reason
+}
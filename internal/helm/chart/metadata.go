@@ -36,6 +36,7 @@ import (
 	"sigs.k8s.io/yaml"
 
 	"github.com/fluxcd/source-controller/internal/helm"
+	"github.com/fluxcd/source-controller/internal/helm/chart/secureloader"
 )
 
 var drivePathPattern = regexp.MustCompile(`^[a-zA-Z]:/`)
@@ -156,8 +157,14 @@ func LoadChartMetadataFromArchive(archive string) (*helmchart.Metadata, error) {
 		return nil, err
 	}
 	defer f.Close()
+	return LoadChartMetadataFromArchiveReader(f)
+}
 
-	r := bufio.NewReader(f)
+// LoadChartMetadataFromArchiveReader loads the chart.Metadata from the "Chart.yaml" file in the archive read from the
+// given reader. It takes "requirements.yaml" files into account, and is therefore compatible with the
+// chart.APIVersionV1 format.
+func LoadChartMetadataFromArchiveReader(archive io.Reader) (*helmchart.Metadata, error) {
+	r := bufio.NewReader(archive)
 	zr, err := gzip.NewReader(r)
 	if err != nil {
 		return nil, err
@@ -176,6 +183,9 @@ func LoadChartMetadataFromArchive(archive string) (*helmchart.Metadata, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err = secureloader.ValidateArchiveEntryName(hd.Name); err != nil {
+			return nil, err
+		}
 
 		if hd.FileInfo().IsDir() {
 			// Use this instead of hd.Typeflag because we don't have to do any
@@ -252,3 +262,25 @@ func LoadChartMetadataFromArchive(archive string) (*helmchart.Metadata, error) {
 	}
 	return m, nil
 }
+
+// LoadChartValuesFromArchive returns the default "values.yaml" file of the
+// chart in the archive at the given path. It returns nil if the chart does not
+// contain a "values.yaml" file.
+func LoadChartValuesFromArchive(archive string) ([]byte, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	files, err := secureloader.LoadArchiveFiles(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Name == chartutil.ValuesfileName {
+			return file.Data, nil
+		}
+	}
+	return nil, nil
+}
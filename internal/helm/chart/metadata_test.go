@@ -261,3 +261,18 @@ func TestLoadChartMetadataFromArchive(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadChartValuesFromArchive(t *testing.T) {
+	g := NewWithT(t)
+
+	want, err := os.ReadFile("../testdata/charts/helmchart/values.yaml")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	got, err := LoadChartValuesFromArchive(helmPackageFile)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(got).To(Equal(want))
+
+	_, err = LoadChartValuesFromArchive("../testdata/invalid.tgz")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("no such file or directory"))
+}
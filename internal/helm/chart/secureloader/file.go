@@ -18,19 +18,44 @@ limitations under the License.
 package secureloader
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"regexp"
+	"strings"
 
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 )
 
+// ErrPathTraversal is returned when a chart archive contains an entry with an
+// absolute path, or a path with a parent directory ("..") component, which
+// could escape the directory the archive is extracted to.
+var ErrPathTraversal = errors.New("chart archive contains path escaping the chart directory")
+
+var drivePathPattern = regexp.MustCompile(`^[a-zA-Z]:/`)
+
 // FileLoader is equal to Helm's.
 // Redeclared to avoid having to deal with multiple package imports,
 // possibly resulting in using the non-secure directory loader.
 type FileLoader = loader.FileLoader
 
-// LoadFile loads from an archive file.
+// LoadFile loads from an archive file, after validating the paths of the
+// entries in the archive with ValidateArchive.
 func LoadFile(name string) (*chart.Chart, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateArchive(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
 	return loader.LoadFile(name)
 }
 
@@ -38,10 +63,75 @@ func LoadFile(name string) (*chart.Chart, error) {
 // performs important path security checks and should always be used before
 // expanding a tarball
 func LoadArchiveFiles(in io.Reader) ([]*loader.BufferedFile, error) {
-	return loader.LoadArchiveFiles(in)
+	b, err := readValidArchive(in)
+	if err != nil {
+		return nil, err
+	}
+	return loader.LoadArchiveFiles(bytes.NewReader(b))
 }
 
-// LoadArchive loads from a reader containing a compressed tar archive.
+// LoadArchive loads from a reader containing a compressed tar archive, after
+// validating the paths of the entries in the archive with ValidateArchive.
 func LoadArchive(in io.Reader) (*chart.Chart, error) {
-	return loader.LoadArchive(in)
+	b, err := readValidArchive(in)
+	if err != nil {
+		return nil, err
+	}
+	return loader.LoadArchive(bytes.NewReader(b))
+}
+
+// ValidateArchive reads the compressed tar archive from the given reader, and
+// returns an error wrapping ErrPathTraversal if any of its entries has an
+// absolute path, or a path with a parent directory component.
+//
+// Contrary to Helm, which strips the first component of a path (the chart
+// directory) before checking it, the full path of the entry is validated.
+func ValidateArchive(in io.Reader) error {
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	for {
+		hd, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ValidateArchiveEntryName(hd.Name); err != nil {
+			return err
+		}
+	}
+}
+
+// ValidateArchiveEntryName returns an error wrapping ErrPathTraversal if the
+// given archive entry name is absolute, or contains a ".." component. Both
+// "/" and "\" are treated as path separators.
+func ValidateArchiveEntryName(name string) error {
+	n := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(n, "/") || drivePathPattern.MatchString(n) {
+		return fmt.Errorf("%w: absolute path '%s'", ErrPathTraversal, name)
+	}
+	for _, part := range strings.Split(n, "/") {
+		if part == ".." {
+			return fmt.Errorf("%w: parent directory reference in '%s'", ErrPathTraversal, name)
+		}
+	}
+	return nil
+}
+
+// readValidArchive reads all data from the given reader, and validates it
+// with ValidateArchive.
+func readValidArchive(in io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	if err = ValidateArchive(bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+	return b, nil
 }
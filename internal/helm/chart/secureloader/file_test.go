@@ -0,0 +1,148 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secureloader
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const chartYAML = `apiVersion: v2
+name: app
+version: 0.1.0
+`
+
+// craftArchive returns a gzip compressed tar archive with the given entries,
+// mapping the names to the file contents.
+func craftArchive(t *testing.T, entries [][2]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     e[0],
+			Mode:     0o644,
+			Size:     int64(len(e[1])),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidateArchiveEntryName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "app/Chart.yaml"},
+		{name: "app/templates/..deployment.yaml"},
+		{name: "app/templates/"},
+		{name: "../app/Chart.yaml", wantErr: true},
+		{name: "app/../../etc/passwd", wantErr: true},
+		{name: "app/templates/../../../x", wantErr: true},
+		{name: "app\\..\\..\\x", wantErr: true},
+		{name: "/etc/passwd", wantErr: true},
+		{name: "\\etc\\passwd", wantErr: true},
+		{name: "c:\\windows\\x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := ValidateArchiveEntryName(tt.name)
+			if tt.wantErr {
+				g.Expect(err).To(MatchError(ErrPathTraversal))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+func TestLoadArchive_pathTraversal(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries [][2]string
+		wantErr bool
+	}{
+		{
+			name:    "valid chart",
+			entries: [][2]string{{"app/Chart.yaml", chartYAML}},
+		},
+		{
+			name:    "parent directory entry",
+			entries: [][2]string{{"app/Chart.yaml", chartYAML}, {"app/../../evil.sh", "evil"}},
+			wantErr: true,
+		},
+		{
+			name:    "parent directory as chart directory",
+			entries: [][2]string{{"app/Chart.yaml", chartYAML}, {"../templates/evil.yaml", "evil"}},
+			wantErr: true,
+		},
+		{
+			name:    "absolute path entry",
+			entries: [][2]string{{"app/Chart.yaml", chartYAML}, {"/etc/cron.d/evil", "evil"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			b := craftArchive(t, tt.entries)
+
+			_, err := LoadArchive(bytes.NewReader(b))
+			_, filesErr := LoadArchiveFiles(bytes.NewReader(b))
+
+			p := filepath.Join(t.TempDir(), "app-0.1.0.tgz")
+			g.Expect(os.WriteFile(p, b, 0o600)).To(Succeed())
+			_, fileErr := LoadFile(p)
+			_, loadErr := Load(filepath.Dir(p), p)
+
+			if tt.wantErr {
+				g.Expect(err).To(MatchError(ErrPathTraversal))
+				g.Expect(filesErr).To(MatchError(ErrPathTraversal))
+				g.Expect(fileErr).To(MatchError(ErrPathTraversal))
+				g.Expect(loadErr).To(MatchError(ErrPathTraversal))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(filesErr).ToNot(HaveOccurred())
+			g.Expect(fileErr).ToNot(HaveOccurred())
+			g.Expect(loadErr).ToNot(HaveOccurred())
+		})
+	}
+}
@@ -81,5 +81,8 @@ func Load(root, name string) (*chart.Chart, error) {
 	if err != nil {
 		return nil, err
 	}
+	if f, ok := l.(FileLoader); ok {
+		return LoadFile(string(f))
+	}
 	return l.Load()
 }
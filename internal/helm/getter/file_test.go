@@ -0,0 +1,112 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package getter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileGetter_Get(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(root, "repo"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "repo", "index.yaml"), []byte("index"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "repo", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		root    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "file within root",
+			root: root,
+			url:  "file://" + filepath.ToSlash(filepath.Join(root, "repo", "index.yaml")),
+			want: "index",
+		},
+		{
+			name: "file within root with localhost",
+			root: root,
+			url:  "file://localhost" + filepath.ToSlash(filepath.Join(root, "repo", "index.yaml")),
+			want: "index",
+		},
+		{
+			name:    "file outside root",
+			root:    root,
+			url:     "file://" + filepath.ToSlash(filepath.Join(outside, "secret")),
+			wantErr: true,
+		},
+		{
+			name:    "path escaping root",
+			root:    root,
+			url:     "file://" + filepath.ToSlash(root) + "/repo/../../" + filepath.Base(outside) + "/secret",
+			wantErr: true,
+		},
+		{
+			name:    "symlink is resolved within root",
+			root:    root,
+			url:     "file://" + filepath.ToSlash(filepath.Join(root, "repo", "link")),
+			wantErr: true,
+		},
+		{
+			name:    "remote host",
+			root:    root,
+			url:     "file://example.com" + filepath.ToSlash(filepath.Join(root, "repo", "index.yaml")),
+			wantErr: true,
+		},
+		{
+			name:    "no root",
+			url:     "file://" + filepath.ToSlash(filepath.Join(root, "repo", "index.yaml")),
+			wantErr: true,
+		},
+		{
+			name:    "other scheme",
+			root:    root,
+			url:     "https://example.com/index.yaml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewFileProvider(tt.root).New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := g.Get(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("Get() = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
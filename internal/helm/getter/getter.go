@@ -19,11 +19,16 @@ package getter
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"net/url"
+	"strings"
 
 	"helm.sh/helm/v3/pkg/getter"
 	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fluxcd/source-controller/internal/transport"
+	"github.com/fluxcd/source-controller/internal/util"
 )
 
 // ClientOptionsFromSecret constructs a getter.Option slice for the given secret.
@@ -56,15 +61,71 @@ func BasicAuthFromSecret(secret corev1.Secret) (getter.Option, error) {
 	return getter.WithBasicAuth(username, password), nil
 }
 
+// BasicAuthFromURL extracts the credentials embedded in the userinfo of the
+// given repository URL, and returns the URL without them together with a basic
+// auth getter.Option for the extracted credentials.
+//
+// URLs without userinfo are returned as is, with a nil getter.Option.
+func BasicAuthFromURL(repositoryUrl string) (string, getter.Option, error) {
+	u, username, password, err := util.ExtractURLCredentials(repositoryUrl)
+	if err != nil {
+		return "", nil, err
+	}
+	if username == "" && password == "" {
+		return u, nil, nil
+	}
+	return u, getter.WithBasicAuth(username, password), nil
+}
+
+// ProxyFromSecret attempts to construct a transport.Proxy for the given
+// v1.Secret and returns the result.
+//
+// The proxy is configured by a 'proxyURL' field, which may contain the
+// credentials of the proxy as userinfo, and/or 'proxyUsername' and
+// 'proxyPassword' fields. Without a 'proxyURL', the credentials are used for
+// the proxy configured in the environment.
+// Secrets with none of the fields are ignored, if only one of 'proxyUsername'
+// and 'proxyPassword' is defined it returns an error.
+func ProxyFromSecret(secret corev1.Secret) (*transport.Proxy, error) {
+	proxyURL := string(secret.Data["proxyURL"])
+	username, password := string(secret.Data["proxyUsername"]), string(secret.Data["proxyPassword"])
+	switch {
+	case proxyURL == "" && username == "" && password == "":
+		return nil, nil
+	case (username == "") != (password == ""):
+		return nil, fmt.Errorf("invalid '%s' secret data: fields 'proxyUsername' and 'proxyPassword' require each other's presence",
+			secret.Name)
+	}
+
+	proxy := &transport.Proxy{}
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' secret data: cannot parse 'proxyURL': %w", secret.Name, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid '%s' secret data: 'proxyURL' must be an absolute URL", secret.Name)
+		}
+		proxy.URL = u
+	}
+	if username != "" {
+		proxy.User = url.UserPassword(username, password)
+	}
+	return proxy, nil
+}
+
 // TLSClientConfigFromSecret attempts to construct a TLS client config
 // for the given v1.Secret. It returns the TLS client config or an error.
 //
-// Secrets with no certFile, keyFile, AND caFile are ignored, if only a
-// certBytes OR keyBytes is defined it returns an error.
+// Secrets with no certFile, keyFile, caFile AND intermediatesFile are ignored,
+// if only a certBytes OR keyBytes is defined it returns an error.
+// The certificates in intermediatesFile are used to complete the certificate
+// chain presented by the server, see transport.WithIntermediates.
 func TLSClientConfigFromSecret(secret corev1.Secret, repositoryUrl string) (*tls.Config, error) {
 	certBytes, keyBytes, caBytes := secret.Data["certFile"], secret.Data["keyFile"], secret.Data["caFile"]
+	intermediatesBytes := secret.Data["intermediatesFile"]
 	switch {
-	case len(certBytes)+len(keyBytes)+len(caBytes) == 0:
+	case len(certBytes)+len(keyBytes)+len(caBytes)+len(intermediatesBytes) == 0:
 		return nil, nil
 	case (len(certBytes) > 0 && len(keyBytes) == 0) || (len(keyBytes) > 0 && len(certBytes) == 0):
 		return nil, fmt.Errorf("invalid '%s' secret data: fields 'certFile' and 'keyFile' require each other's presence",
@@ -75,7 +136,7 @@ func TLSClientConfigFromSecret(secret corev1.Secret, repositoryUrl string) (*tls
 	if len(certBytes) > 0 && len(keyBytes) > 0 {
 		cert, err := tls.X509KeyPair(certBytes, keyBytes)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("invalid '%s' secret data: %w", secret.Name, keyPairError(certBytes, keyBytes, err))
 		}
 		tlsConf.Certificates = append(tlsConf.Certificates, cert)
 	}
@@ -101,5 +162,59 @@ func TLSClientConfigFromSecret(secret corev1.Secret, repositoryUrl string) (*tls
 
 	tlsConf.ServerName = u.Hostname()
 
+	if len(intermediatesBytes) > 0 {
+		if tlsConf, err = transport.WithIntermediates(tlsConf, intermediatesBytes); err != nil {
+			return nil, fmt.Errorf("invalid intermediatesFile: %w", err)
+		}
+	}
+
 	return tlsConf, nil
 }
+
+// keyPairError returns an error naming the field of the given PEM encoded
+// certificate and key data which caused tls.X509KeyPair to fail with err.
+func keyPairError(certBytes, keyBytes []byte, err error) error {
+	certBlock, _ := pem.Decode(certBytes)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return fmt.Errorf("field 'certFile' does not contain a PEM encoded certificate")
+	}
+	if _, certErr := x509.ParseCertificate(certBlock.Bytes); certErr != nil {
+		return fmt.Errorf("field 'certFile' contains an invalid certificate: %w", certErr)
+	}
+	keyBlock, _ := pem.Decode(keyBytes)
+	if keyBlock == nil || !strings.HasSuffix(keyBlock.Type, "PRIVATE KEY") {
+		return fmt.Errorf("field 'keyFile' does not contain a PEM encoded private key")
+	}
+	return fmt.Errorf("fields 'certFile' and 'keyFile' do not form a valid key pair: %w", err)
+}
+
+// WithTLSServerName returns the given TLS client config with its ServerName
+// set to the given server name. If the config is nil, a new config is
+// returned. If the server name is empty, the config is returned as is.
+func WithTLSServerName(tlsConf *tls.Config, serverName string) *tls.Config {
+	if serverName == "" {
+		return tlsConf
+	}
+	if tlsConf == nil {
+		return &tls.Config{ServerName: serverName}
+	}
+	tlsConf = tlsConf.Clone()
+	tlsConf.ServerName = serverName
+	return tlsConf
+}
+
+// WithInsecureSkipVerify returns the given TLS client config with the
+// verification of the server certificate disabled if insecure is true. If the
+// config is nil, a new config is returned. If insecure is false, the config is
+// returned as is.
+func WithInsecureSkipVerify(tlsConf *tls.Config, insecure bool) *tls.Config {
+	if !insecure {
+		return tlsConf
+	}
+	if tlsConf == nil {
+		return &tls.Config{InsecureSkipVerify: true}
+	}
+	tlsConf = tlsConf.Clone()
+	tlsConf.InsecureSkipVerify = true
+	return tlsConf
+}
@@ -26,4 +26,7 @@ var (
 	// MaxChartFileSize is the max allowed file size in bytes of any arbitrary
 	// file originating from a chart.
 	MaxChartFileSize int64 = 5 << 20
+	// MaxIndexEntries is the max allowed number of chart versions in the index
+	// of a ChartRepository. Unlimited when zero.
+	MaxIndexEntries = 0
 )
@@ -18,34 +18,77 @@ package repository
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/opencontainers/go-digest"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/provenance"
 	"helm.sh/helm/v3/pkg/repo"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"sigs.k8s.io/yaml"
 
 	"github.com/fluxcd/pkg/version"
 
+	"github.com/fluxcd/source-controller/internal/connlimit"
 	"github.com/fluxcd/source-controller/internal/helm"
 	"github.com/fluxcd/source-controller/internal/transport"
 )
 
 var (
 	ErrNoChartIndex = errors.New("no chart index")
+
+	// ErrIndexTooLarge is returned by DownloadIndex when the downloaded index
+	// exceeds helm.MaxIndexSize.
+	ErrIndexTooLarge = errors.New("index exceeds the maximum index file size")
+
+	// ErrTooManyIndexEntries is returned when an index contains more chart
+	// versions than helm.MaxIndexEntries.
+	ErrTooManyIndexEntries = errors.New("index exceeds the maximum number of entries")
+
+	// ErrTooManyIndexPages is returned by DownloadIndex when a paginated
+	// index consists of more than MaxIndexPages pages.
+	ErrTooManyIndexPages = errors.New("index exceeds the maximum number of pages")
+
+	// ErrPaginatedIndex is returned by DownloadIndex when PassthroughIndex is
+	// true and the index is paginated, as the pages can not be merged without
+	// normalizing the index.
+	ErrPaginatedIndex = errors.New("paginated index can not be stored as downloaded")
+
+	// ErrIndexNotModified is returned by DownloadIndex when ConditionalIndex
+	// is true, and the index has not been modified since it was downloaded
+	// with the Validators.
+	ErrIndexNotModified = errors.New("index not modified")
 )
 
+// NextIndexPageAnnotation is the index annotation containing the URL of the
+// next page of a paginated index. The URL is resolved relative to the URL of
+// the page it is found in.
+const NextIndexPageAnnotation = "source.toolkit.fluxcd.io/next-page"
+
+// gzipMagic is the header a gzip-compressed index starts with, which can not
+// be the start of a YAML document.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// MaxIndexPages is the maximum number of pages of a paginated index,
+// including the root index.yaml.
+var MaxIndexPages = 100
+
 // IndexFromFile loads a repo.IndexFile from the given path. It returns an
 // error if the file does not exist, is not a regular file, exceeds the
 // maximum index file size, or if the file cannot be parsed.
@@ -68,20 +111,37 @@ func IndexFromFile(path string) (*repo.IndexFile, error) {
 }
 
 // IndexFromBytes loads a repo.IndexFile from the given bytes. It returns an
-// error if the bytes cannot be parsed, or if the API version is not set.
+// error if the bytes cannot be parsed, or ErrTooManyIndexEntries if the index
+// contains more chart versions than helm.MaxIndexEntries.
+// Indexes without an API version are assumed to be repo.APIVersionV1, as
+// emitted by old repositories. Indexes with an unrecognized API version are
+// parsed on a best-effort basis, ignoring any unknown fields. This can be
+// detected using IsKnownIndexAPIVersion.
 // The entries are sorted before the index is returned.
 func IndexFromBytes(b []byte) (*repo.IndexFile, error) {
 	if len(b) == 0 {
 		return nil, repo.ErrEmptyIndexYaml
 	}
-
 	i := &repo.IndexFile{}
 	if err := yaml.UnmarshalStrict(b, i); err != nil {
+		// Newer API versions may introduce fields we are not aware of.
+		lenient := &repo.IndexFile{}
+		if lerr := yaml.Unmarshal(b, lenient); lerr != nil || IsKnownIndexAPIVersion(lenient.APIVersion) {
+			return nil, err
+		}
+		i = lenient
+	}
+
+	var n int
+	for _, cvs := range i.Entries {
+		n += len(cvs)
+	}
+	if err := exceedsIndexEntries(n); err != nil {
 		return nil, err
 	}
 
 	if i.APIVersion == "" {
-		return nil, repo.ErrNoAPIVersion
+		i.APIVersion = repo.APIVersionV1
 	}
 
 	for _, cvs := range i.Entries {
@@ -102,6 +162,21 @@ func IndexFromBytes(b []byte) (*repo.IndexFile, error) {
 	return i, nil
 }
 
+// exceedsIndexEntries returns ErrTooManyIndexEntries if the given number of
+// chart versions exceeds helm.MaxIndexEntries.
+func exceedsIndexEntries(n int) error {
+	if helm.MaxIndexEntries > 0 && n > helm.MaxIndexEntries {
+		return fmt.Errorf("%w of %d", ErrTooManyIndexEntries, helm.MaxIndexEntries)
+	}
+	return nil
+}
+
+// IsKnownIndexAPIVersion returns if the given index API version is recognized.
+// An empty API version is treated as repo.APIVersionV1.
+func IsKnownIndexAPIVersion(apiVersion string) bool {
+	return apiVersion == "" || apiVersion == repo.APIVersionV1
+}
+
 // ChartRepository represents a Helm chart repository, and the configuration
 // required to download the chart index and charts from the repository.
 // All methods are thread safe unless defined otherwise.
@@ -111,6 +186,29 @@ type ChartRepository struct {
 	URL string
 	// Path is the absolute path to the Index file.
 	Path string
+	// RawPath is the absolute path to the file containing the index exactly
+	// as downloaded from the URL, before e.g. paginated indexes are merged.
+	// It is only set by CacheIndex if KeepRawIndex is true.
+	RawPath string
+	// KeepRawIndex configures CacheIndex to write the raw downloaded index
+	// to a file at RawPath.
+	KeepRawIndex bool
+	// PassthroughIndex configures DownloadIndex to write the index exactly as
+	// downloaded, and to reject paginated indexes with ErrPaginatedIndex
+	// instead of merging their pages into a normalized index.
+	PassthroughIndex bool
+	// ConditionalIndex configures DownloadIndex to make a conditional request
+	// for the index of an HTTP/S repository using the Validators, and to
+	// return ErrIndexNotModified if it has not been modified since.
+	// CacheIndex updates the Validators to those of the downloaded index.
+	ConditionalIndex bool
+	// CompressedIndex configures DownloadIndex to attempt to download the
+	// gzip-compressed index.yaml.gz of an HTTP/S repository, falling back to
+	// the index.yaml if the repository does not provide it.
+	CompressedIndex bool
+	// Validators of the previously downloaded index, used by DownloadIndex
+	// when ConditionalIndex is true.
+	Validators *IndexValidators
 	// Index of the ChartRepository.
 	Index *repo.IndexFile
 
@@ -119,6 +217,25 @@ type ChartRepository struct {
 	// Options to configure the Client with while downloading the Index
 	// or a chart from the URL.
 	Options []getter.Option
+	// Proxy to connect to the URL through while downloading the Index or a
+	// chart, overriding the proxy configured in the environment.
+	Proxy *transport.Proxy
+	// CookieJar stores the cookies set by the responses of the URL, and
+	// sends them with the subsequent requests for the Index or a chart, to
+	// support repositories which require a session. It is set
+	// to a new jar by NewChartRepository. Cookies are ignored when nil.
+	CookieJar http.CookieJar
+	// ConnectionLimiter bounds the number of concurrent requests to the URL
+	// with the ones of other clients sharing it. Requests are not limited
+	// when nil.
+	ConnectionLimiter *connlimit.Limiter
+	// Keyring is the OpenPGP keyring used by VerifyProvenance to verify the
+	// provenance file of a chart.
+	Keyring []byte
+	// Downloads deduplicates the concurrent downloads of the same chart
+	// version by DownloadChart with the other ChartRepositories sharing it.
+	// Every download is made by the ChartRepository itself when nil.
+	Downloads *DownloadGroup
 
 	tlsConfig *tls.Config
 
@@ -148,6 +265,9 @@ func NewChartRepository(URL, path string, providers getter.Providers, tlsConfig
 	r.Client = c
 	r.Options = getterOpts
 	r.tlsConfig = tlsConfig
+	if r.CookieJar, err = cookiejar.New(nil); err != nil {
+		return nil, err
+	}
 
 	return r, nil
 }
@@ -240,14 +360,14 @@ func (r *ChartRepository) getChartVersion(name, ver string) (*repo.ChartVersion,
 			left := matchedVersions[i]
 			right := matchedVersions[j]
 
-			if !left.Equal(right) {
-				return left.LessThan(right)
+			// Versions with equal precedence which differ in build metadata
+			// are ordered by their build metadata, to prefer the newest build.
+			if c := compareVersions(left, right); c != 0 {
+				return c < 0
 			}
 
-			// Having chart creation timestamp at our disposal, we put package with the
-			// same version into a chronological order. This is especially important for
-			// versions that differ only by build metadata, because it is not considered
-			// a part of the comparable version in Semver
+			// Having chart creation timestamp at our disposal, we put packages with the
+			// same version and build metadata into a chronological order.
 			return lookup[left].Created.Before(lookup[right].Created)
 		})()
 	})
@@ -259,29 +379,200 @@ func (r *ChartRepository) getChartVersion(name, ver string) (*repo.ChartVersion,
 // DownloadChart confirms the given repo.ChartVersion has a downloadable URL,
 // and then attempts to download the chart using the Client and Options of the
 // ChartRepository. It returns a bytes.Buffer containing the chart data.
+// When the chart version lists multiple URLs, they are attempted in order
+// until a download succeeds. If all of them fail, the returned error
+// aggregates the errors of the attempts.
+// When Downloads is set, concurrent downloads of the chart URL and digest are
+// made only once.
 func (r *ChartRepository) DownloadChart(chart *repo.ChartVersion) (*bytes.Buffer, error) {
+	return r.getChartFile(chart, "", func(u string) (*bytes.Buffer, error) {
+		return r.Downloads.do(u, chart.Digest, func() (*bytes.Buffer, error) {
+			return r.get(u)
+		})
+	})
+}
+
+// CheckChart confirms the given repo.ChartVersion has a downloadable URL, and
+// that the chart is available at it without downloading the chart, by
+// sending a HEAD request through the Client and Options of the
+// ChartRepository. When the chart version lists multiple URLs, they are
+// attempted in order until a request succeeds.
+func (r *ChartRepository) CheckChart(chart *repo.ChartVersion) error {
+	_, err := r.getChartFile(chart, "", func(u string) (*bytes.Buffer, error) {
+		t, rt := r.newTransport()
+		defer transport.Release(t)
+
+		// The Client only offers GET requests, which are sent as HEAD
+		// requests to the same URL, with the same headers.
+		rt = &headRoundTripper{rt: rt}
+		if _, err := r.Client.Get(u, append(r.Options, getter.WithTransport(transport.Wrap(rt)))...); err != nil {
+			return nil, getterError(err)
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// headRoundTripper sends the requests as HEAD requests through rt.
+type headRoundTripper struct {
+	rt http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (h *headRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Method = http.MethodHead
+	return h.rt.RoundTrip(req)
+}
+
+// VerifyProvenance downloads the provenance file of the given chart version,
+// and verifies the given chart package against it using the Keyring.
+// It returns an error if the provenance file can not be downloaded, its
+// signature is not made by a key in the Keyring, or the digest of the chart
+// package does not match the digest in the provenance file.
+func (r *ChartRepository) VerifyProvenance(chart *repo.ChartVersion, data []byte) (*provenance.Verification, error) {
+	if len(r.Keyring) == 0 {
+		return nil, errors.New("no keyring to verify the chart provenance with")
+	}
+
+	var resolvedUrl string
+	prov, err := r.getChartFile(chart, ".prov", func(u string) (*bytes.Buffer, error) {
+		resolvedUrl = strings.TrimSuffix(u, ".prov")
+		return r.get(u)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download provenance file: %w", err)
+	}
+
+	// The Helm verification works on files, and requires the chart file
+	// to have the name it is recorded with in the provenance file.
+	dir, err := os.MkdirTemp("", "chart-provenance-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory to verify provenance in: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	u, err := url.Parse(resolvedUrl)
+	if err != nil {
+		return nil, err
+	}
+	chartPath := filepath.Join(dir, path.Base(u.Path))
+	keyringPath := filepath.Join(dir, "keyring.gpg")
+	for p, b := range map[string][]byte{
+		chartPath:           data,
+		chartPath + ".prov": prov.Bytes(),
+		keyringPath:         r.Keyring,
+	} {
+		if err = os.WriteFile(p, b, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write file to verify provenance with: %w", err)
+		}
+	}
+
+	sig, err := provenance.NewFromKeyring(keyringPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keyring: %w", err)
+	}
+	ver, err := sig.Verify(chartPath, chartPath+".prov")
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify provenance of chart '%s' version '%s': %w", chart.Name, chart.Version, err)
+	}
+	return ver, nil
+}
+
+// getChartFile calls get with the absolute URL of each of the URLs of the
+// given chart version, suffixed with suffix, until a call succeeds. It
+// returns the result of the successful call, or an error aggregating the
+// errors of all calls.
+func (r *ChartRepository) getChartFile(chart *repo.ChartVersion, suffix string, get func(u string) (*bytes.Buffer, error)) (*bytes.Buffer, error) {
 	if len(chart.URLs) == 0 {
 		return nil, fmt.Errorf("chart '%s' has no downloadable URLs", chart.Name)
 	}
 
-	// TODO(hidde): according to the Helm source the first item is not
-	//  always the correct one to pick, check for updates once in awhile.
-	//  Ref: https://github.com/helm/helm/blob/v3.3.0/pkg/downloader/chart_downloader.go#L241
-	ref := chart.URLs[0]
-	resolvedUrl, err := repo.ResolveReferenceURL(r.URL, ref)
+	var errs []error
+	for _, ref := range chart.URLs {
+		u, err := r.resolveChartURL(ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid chart URL '%s': %w", ref, err))
+			continue
+		}
+		res, err := get(u + suffix)
+		if err == nil {
+			return res, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, kerrors.NewAggregate(errs)
+}
+
+// resolveChartURL returns the absolute URL of the given chart URL.
+//
+// An absolute chart URL is returned verbatim, which preserves the exact
+// encoding of its query, e.g. the signature of a presigned URL. A relative
+// chart URL is resolved against the repository URL, with the raw query of
+// the chart URL, or the query of the repository URL if it has none.
+func (r *ChartRepository) resolveChartURL(ref string) (string, error) {
+	resolved, err := repo.ResolveReferenceURL(r.URL, ref)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	t := transport.NewOrIdle(r.tlsConfig)
-	clientOpts := append(r.Options, getter.WithTransport(t))
+	// Helm replaces the query of a relative chart URL with the query of the
+	// repository URL, keep the query of the chart URL instead.
+	refURL, err := url.Parse(ref)
+	if err != nil || refURL.IsAbs() || refURL.RawQuery == "" {
+		return resolved, err
+	}
+	resolvedURL, err := url.Parse(resolved)
+	if err != nil {
+		return "", err
+	}
+	resolvedURL.RawQuery = refURL.RawQuery
+	return resolvedURL.String(), nil
+}
+
+// get downloads the given URL using the Client, through the Proxy if set.
+func (r *ChartRepository) get(u string) (*bytes.Buffer, error) {
+	t, rt := r.newTransport()
 	defer transport.Release(t)
 
-	return r.Client.Get(resolvedUrl, clientOpts...)
+	res, err := r.Client.Get(u, append(r.Options, getter.WithTransport(transport.Wrap(rt)))...)
+	if err != nil {
+		return nil, getterError(err)
+	}
+	return res, nil
+}
+
+// newTransport returns a transport of the pool configured with the TLS config
+// and Proxy of the ChartRepository, and the http.RoundTripper the requests to
+// the URL are to be sent through, which are limited by the ConnectionLimiter,
+// send the cookies of the CookieJar, and fail with a transport.StatusError for
+// an unsuccessful response. The transport must be released by the caller once
+// the requests have been made.
+func (r *ChartRepository) newTransport() (*http.Transport, http.RoundTripper) {
+	t := transport.NewOrIdle(r.tlsConfig)
+	transport.SetProxy(t, r.Proxy)
+	rt := r.ConnectionLimiter.RoundTripper(t)
+	return t, transport.WithStatusError(transport.WithCookieJar(rt, r.CookieJar))
+}
+
+// getterError returns the transport.StatusError of the given error of the
+// Client as is, which reports the same message as the Helm HTTP getter
+// without the URL of the request being repeated, or the error otherwise.
+func getterError(err error) error {
+	var statusErr *transport.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr
+	}
+	return err
 }
 
 // CacheIndex attempts to write the index from the remote into a new temporary file
-// using DownloadIndex, and sets Path and cached.
+// using DownloadIndex, and sets Path and cached. If KeepRawIndex is true, the
+// raw downloaded index is written to another temporary file, and RawPath is
+// set.
 // The caller is expected to handle the garbage collection of Path, and to
 // load the Index separately using LoadFromPath if required.
 func (r *ChartRepository) CacheIndex() error {
@@ -290,20 +581,55 @@ func (r *ChartRepository) CacheIndex() error {
 		return fmt.Errorf("failed to create temp file to cache index to: %w", err)
 	}
 
-	if err = r.DownloadIndex(f); err != nil {
-		f.Close()
+	var raw *os.File
+	if r.KeepRawIndex {
+		if raw, err = os.CreateTemp("", "chart-index-raw-*.yaml"); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return fmt.Errorf("failed to create temp file to cache raw index to: %w", err)
+		}
+	}
+	removeAll := func() {
 		os.Remove(f.Name())
+		if raw != nil {
+			os.Remove(raw.Name())
+		}
+	}
+
+	var rawWriter io.Writer
+	if raw != nil {
+		rawWriter = raw
+	}
+	validators, err := r.downloadIndex(f, rawWriter)
+	if err != nil {
+		f.Close()
+		if raw != nil {
+			raw.Close()
+		}
+		removeAll()
 		return fmt.Errorf("failed to cache index to temporary file: %w", err)
 	}
 	if err = f.Close(); err != nil {
-		os.Remove(f.Name())
+		removeAll()
 		return fmt.Errorf("failed to close cached index file '%s': %w", f.Name(), err)
 	}
+	var rawPath string
+	if raw != nil {
+		if err = raw.Close(); err != nil {
+			removeAll()
+			return fmt.Errorf("failed to close cached raw index file '%s': %w", raw.Name(), err)
+		}
+		rawPath = raw.Name()
+	}
 
 	r.Lock()
 	r.Path = f.Name()
+	r.RawPath = rawPath
 	r.Index = nil
 	r.cached = true
+	if r.ConditionalIndex {
+		r.Validators = validators
+	}
 	r.invalidate()
 	r.Unlock()
 
@@ -353,33 +679,285 @@ func (r *ChartRepository) LoadFromPath() error {
 
 // DownloadIndex attempts to download the chart repository index using
 // the Client and set Options, and writes the index to the given io.Writer.
-// It returns an url.Error if the URL failed to parse.
+// When the index is paginated using the NextIndexPageAnnotation, all pages are
+// downloaded and merged into a single index before it is written.
+// It returns an url.Error if the URL failed to parse, ErrIndexTooLarge if
+// the (merged) index exceeds helm.MaxIndexSize, ErrTooManyIndexEntries if the
+// merged index exceeds helm.MaxIndexEntries, or ErrTooManyIndexPages if the
+// index consists of more than MaxIndexPages pages. When PassthroughIndex
+// is true, paginated indexes result in ErrPaginatedIndex. When
+// CompressedIndex is true, the index.yaml.gz is downloaded if available.
 func (r *ChartRepository) DownloadIndex(w io.Writer) (err error) {
+	_, err = r.downloadIndex(w, nil)
+	return err
+}
+
+// downloadIndex implements DownloadIndex. If raw is not nil, the downloaded
+// index (pages) are written as-is to it, with pages separated as YAML
+// documents. When ConditionalIndex is true, it returns the validators of the
+// downloaded index, or nil if the index is paginated, as the validators of
+// the root index do not cover the other pages.
+func (r *ChartRepository) downloadIndex(w, raw io.Writer) (*IndexValidators, error) {
 	r.RLock()
 	defer r.RUnlock()
 
 	u, err := url.Parse(r.URL)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	u.RawPath = path.Join(u.RawPath, "index.yaml")
 	u.Path = path.Join(u.Path, "index.yaml")
 
-	t := transport.NewOrIdle(r.tlsConfig)
-	clientOpts := append(r.Options, getter.WithTransport(t))
+	t, rt := r.newTransport()
+	rt = &indexSizeRoundTripper{rt: rt}
+	clientOpts := append(r.Options[:len(r.Options):len(r.Options)], getter.WithTransport(transport.Wrap(rt)))
 	defer transport.Release(t)
 
-	var res *bytes.Buffer
-	res, err = r.Client.Get(u.String(), clientOpts...)
+	indexURLs := []*url.URL{u}
+	if r.CompressedIndex && (u.Scheme == "http" || u.Scheme == "https") {
+		gz := *u
+		if gz.RawPath != "" {
+			gz.RawPath += ".gz"
+		}
+		gz.Path += ".gz"
+		indexURLs = []*url.URL{&gz, u}
+	}
+
+	var b []byte
+	var validators *IndexValidators
+	for i, indexURL := range indexURLs {
+		// The index is requested conditionally through the same round
+		// tripper, servers which do not support it respond with the index.
+		opts := clientOpts
+		var conditional *conditionalRoundTripper
+		if r.ConditionalIndex && (indexURL.Scheme == "http" || indexURL.Scheme == "https") {
+			conditional = &conditionalRoundTripper{rt: rt, validators: r.Validators}
+			opts = append(r.Options[:len(r.Options):len(r.Options)], getter.WithTransport(transport.Wrap(conditional)))
+		}
+
+		b, err = r.downloadIndexPage(indexURL.String(), opts)
+		if errors.Is(err, ErrIndexNotModified) {
+			return nil, ErrIndexNotModified
+		}
+		if err == nil {
+			if conditional != nil {
+				validators = conditional.response
+			}
+			u = indexURL
+			break
+		}
+		// Fall back to the next URL if the index is not provided at this
+		// one, but not if the request may succeed when retried.
+		var statusErr *transport.StatusError
+		if i == len(indexURLs)-1 || !errors.As(err, &statusErr) || IsTransientError(err) {
+			return nil, err
+		}
+	}
+	if raw != nil {
+		if _, err = raw.Write(b); err != nil {
+			return nil, fmt.Errorf("failed to write raw index: %w", err)
+		}
+	}
+
+	// Write the index as-is if it is not paginated.
+	if nextIndexPage(b) == "" {
+		_, err = w.Write(b)
+		return validators, err
+	}
+	if r.PassthroughIndex {
+		return nil, ErrPaginatedIndex
+	}
+
+	index, err := r.downloadIndexPages(u, b, clientOpts, raw)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = yaml.Marshal(index); err != nil {
+		return nil, fmt.Errorf("failed to marshal merged index: %w", err)
+	}
+	if int64(len(b)) > helm.MaxIndexSize {
+		return nil, fmt.Errorf("%w of %d bytes", ErrIndexTooLarge, helm.MaxIndexSize)
+	}
+	_, err = w.Write(b)
+	return nil, err
+}
+
+// downloadIndexPage downloads the index (page) at the given URL using the
+// Client and the given options. A gzip-compressed page, e.g. an index.yaml.gz
+// or a response with a 'Content-Encoding: gzip' header which is not decoded
+// by the transport, is decompressed. It returns ErrIndexTooLarge if the
+// (decompressed) page exceeds helm.MaxIndexSize.
+func (r *ChartRepository) downloadIndexPage(u string, opts []getter.Option) ([]byte, error) {
+	res, err := r.Client.Get(u, opts...)
 	if err != nil {
-		return err
+		return nil, getterError(err)
+	}
+
+	// The response of an HTTP/S request is limited by the
+	// indexSizeRoundTripper while it is downloaded, the ones of other
+	// getters are only checked once they have been downloaded.
+	b, err := io.ReadAll(io.LimitReader(res, helm.MaxIndexSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > helm.MaxIndexSize {
+		return nil, fmt.Errorf("%w of %d bytes", ErrIndexTooLarge, helm.MaxIndexSize)
+	}
+	if !bytes.HasPrefix(b, gzipMagic) {
+		return b, nil
 	}
-	if _, err = io.Copy(w, res); err != nil {
-		return err
+
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress index: %w", err)
+	}
+	defer zr.Close()
+	if b, err = io.ReadAll(io.LimitReader(zr, helm.MaxIndexSize+1)); err != nil {
+		return nil, fmt.Errorf("failed to decompress index: %w", err)
+	}
+	if int64(len(b)) > helm.MaxIndexSize {
+		return nil, fmt.Errorf("%w of %d bytes", ErrIndexTooLarge, helm.MaxIndexSize)
+	}
+	return b, nil
+}
+
+// indexSizeRoundTripper sends the requests for an index (page) through rt, and
+// fails with ErrIndexTooLarge when the response exceeds helm.MaxIndexSize,
+// before more of it is downloaded.
+type indexSizeRoundTripper struct {
+	rt http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (l *indexSizeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := l.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.ContentLength > helm.MaxIndexSize {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w of %d bytes", ErrIndexTooLarge, helm.MaxIndexSize)
+	}
+	res.Body = &indexSizeReader{ReadCloser: res.Body}
+	return res, nil
+}
+
+// indexSizeReader fails with ErrIndexTooLarge once more than
+// helm.MaxIndexSize bytes have been read from the ReadCloser.
+type indexSizeReader struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read implements io.Reader.
+func (r *indexSizeReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if r.n += int64(n); r.n > helm.MaxIndexSize {
+		return n, fmt.Errorf("%w of %d bytes", ErrIndexTooLarge, helm.MaxIndexSize)
+	}
+	return n, err
+}
+
+// downloadIndexPages follows the NextIndexPageAnnotation of the given root
+// index page downloaded from u, and merges all pages into a single index.
+// Pages are required to be served from the same host as the root index, to
+// prevent credentials from leaking to other hosts. Entries already present
+// in earlier pages take precedence over entries in later pages.
+// If raw is not nil, the subsequent pages are written as-is to it, each
+// preceded by a YAML document separator.
+func (r *ChartRepository) downloadIndexPages(u *url.URL, b []byte, opts []getter.Option, raw io.Writer) (*repo.IndexFile, error) {
+	index, err := IndexFromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index page '%s': %w", u.Redacted(), err)
+	}
+
+	visited := map[string]struct{}{u.String(): {}}
+	next := index.Annotations[NextIndexPageAnnotation]
+	for next != "" {
+		if len(visited) >= MaxIndexPages {
+			return nil, fmt.Errorf("%w of %d", ErrTooManyIndexPages, MaxIndexPages)
+		}
+
+		ref, err := url.Parse(next)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index page URL '%s': %w", next, err)
+		}
+		pageURL := u.ResolveReference(ref)
+		if pageURL.Scheme != u.Scheme || pageURL.Host != u.Host {
+			return nil, fmt.Errorf("index page '%s' is not served from the same host as the index", pageURL.Redacted())
+		}
+		if _, ok := visited[pageURL.String()]; ok {
+			return nil, fmt.Errorf("index page '%s' results in a loop", pageURL.Redacted())
+		}
+		visited[pageURL.String()] = struct{}{}
+		u = pageURL
+
+		prev := b
+		b, err := r.downloadIndexPage(u.String(), opts)
+		if err != nil {
+			return nil, err
+		}
+		if raw != nil {
+			if err = writeRawIndexPage(raw, prev, b); err != nil {
+				return nil, err
+			}
+		}
+		page, err := IndexFromBytes(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load index page '%s': %w", u.Redacted(), err)
+		}
+		index.Merge(page)
+		var n int
+		for _, cvs := range index.Entries {
+			n += len(cvs)
+		}
+		if err = exceedsIndexEntries(n); err != nil {
+			return nil, err
+		}
+		next = page.Annotations[NextIndexPageAnnotation]
+	}
+
+	delete(index.Annotations, NextIndexPageAnnotation)
+	if len(index.Annotations) == 0 {
+		index.Annotations = nil
+	}
+	index.SortEntries()
+	return index, nil
+}
+
+// writeRawIndexPage writes the given page to w as a new YAML document,
+// following the previously written page prev.
+func writeRawIndexPage(w io.Writer, prev, page []byte) error {
+	sep := "---\n"
+	if len(prev) > 0 && !bytes.HasSuffix(prev, []byte("\n")) {
+		sep = "\n" + sep
+	}
+	if _, err := io.WriteString(w, sep); err != nil {
+		return fmt.Errorf("failed to write raw index: %w", err)
+	}
+	if _, err := w.Write(page); err != nil {
+		return fmt.Errorf("failed to write raw index: %w", err)
 	}
 	return nil
 }
 
+// nextIndexPage returns the value of the NextIndexPageAnnotation of the given
+// index, or an empty string if the index is not paginated or can not be
+// parsed.
+func nextIndexPage(b []byte) string {
+	// Avoid parsing the index when it can not contain the annotation.
+	if !bytes.Contains(b, []byte(NextIndexPageAnnotation)) {
+		return ""
+	}
+	var i struct {
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+	if err := yaml.Unmarshal(b, &i); err != nil {
+		return ""
+	}
+	return i.Annotations[NextIndexPageAnnotation]
+}
+
 // Digest returns the digest of the file at the ChartRepository's Path.
 func (r *ChartRepository) Digest(algorithm digest.Algorithm) digest.Digest {
 	if !r.HasFile() {
@@ -434,6 +1012,12 @@ func (r *ChartRepository) Clear() error {
 			return fmt.Errorf("failed to remove cached index: %w", err)
 		}
 		r.Path = ""
+		if r.RawPath != "" {
+			if err := os.Remove(r.RawPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove cached raw index: %w", err)
+			}
+			r.RawPath = ""
+		}
 		r.cached = false
 	}
 
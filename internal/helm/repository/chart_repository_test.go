@@ -18,12 +18,17 @@ package repository
 
 import (
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -33,7 +38,10 @@ import (
 	helmgetter "helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/repo"
 
+	"github.com/fluxcd/pkg/helmtestserver"
+
 	"github.com/fluxcd/source-controller/internal/helm"
+	"github.com/fluxcd/source-controller/internal/transport"
 )
 
 var now = time.Now()
@@ -57,6 +65,22 @@ func (g *mockGetter) Get(u string, _ ...helmgetter.Option) (*bytes.Buffer, error
 	return bytes.NewBuffer(r), nil
 }
 
+// pagedGetter is a getter.Getter implementation returning the response
+// configured for the requested URL.
+type pagedGetter struct {
+	Responses  map[string]string
+	CalledURLs []string
+}
+
+func (g *pagedGetter) Get(u string, _ ...helmgetter.Option) (*bytes.Buffer, error) {
+	g.CalledURLs = append(g.CalledURLs, u)
+	r, ok := g.Responses[u]
+	if !ok {
+		return nil, fmt.Errorf("no response for '%s'", u)
+	}
+	return bytes.NewBufferString(r), nil
+}
+
 // Index load tests are derived from https://github.com/helm/helm/blob/v3.3.4/pkg/repo/index_test.go#L108
 // to ensure parity with Helm behaviour.
 func TestIndexFromFile(t *testing.T) {
@@ -109,12 +133,13 @@ func TestIndexFromFile(t *testing.T) {
 
 func TestIndexFromBytes(t *testing.T) {
 	tests := []struct {
-		name        string
-		b           []byte
-		wantName    string
-		wantVersion string
-		wantDigest  string
-		wantErr     string
+		name           string
+		b              []byte
+		wantAPIVersion string
+		wantName       string
+		wantVersion    string
+		wantDigest     string
+		wantErr        string
 	}{
 		{
 			name: "index",
@@ -130,16 +155,53 @@ entries:
       home: https://github.com/something/else
       digest: "sha256:1234567890abcdef"
 `),
-			wantName:    "nginx",
-			wantVersion: "0.2.0",
-			wantDigest:  "sha256:1234567890abcdef",
+			wantAPIVersion: "v1",
+			wantName:       "nginx",
+			wantVersion:    "0.2.0",
+			wantDigest:     "sha256:1234567890abcdef",
 		},
 		{
 			name: "index without API version",
 			b: []byte(`entries:
   nginx:
-    - name: nginx`),
-			wantErr: "no API version specified",
+    - urls:
+        - https://kubernetes-charts.storage.googleapis.com/nginx-0.2.0.tgz
+      name: nginx
+      version: 0.2.0
+      digest: "sha256:1234567890abcdef"
+`),
+			wantAPIVersion: "v1",
+			wantName:       "nginx",
+			wantVersion:    "0.2.0",
+			wantDigest:     "sha256:1234567890abcdef",
+		},
+		{
+			name: "index with unknown API version",
+			b: []byte(`apiVersion: v2
+generator: future
+entries:
+  nginx:
+    - urls:
+        - https://kubernetes-charts.storage.googleapis.com/nginx-0.2.0.tgz
+      name: nginx
+      version: 0.2.0
+      digest: "sha256:1234567890abcdef"
+      unknownField: value
+`),
+			wantAPIVersion: "v2",
+			wantName:       "nginx",
+			wantVersion:    "0.2.0",
+			wantDigest:     "sha256:1234567890abcdef",
+		},
+		{
+			name: "index with unknown field",
+			b: []byte(`apiVersion: v1
+entries:
+  nginx:
+    - name: nginx
+      unknownField: value
+`),
+			wantErr: "unknown field \"unknownField\"",
 		},
 		{
 			name: "index with duplicate entry",
@@ -168,6 +230,7 @@ entries:
 
 			g.Expect(err).ToNot(HaveOccurred())
 			g.Expect(i).ToNot(BeNil())
+			g.Expect(i.APIVersion).To(Equal(tt.wantAPIVersion))
 			got, err := i.Get(tt.wantName, tt.wantVersion)
 			g.Expect(err).ToNot(HaveOccurred())
 			g.Expect(got.Digest).To(Equal(tt.wantDigest))
@@ -187,6 +250,68 @@ func TestIndexFromBytes_Unordered(t *testing.T) {
 	verifyLocalIndex(t, i)
 }
 
+func TestIndexFromBytes_maxIndexEntries(t *testing.T) {
+	b := []byte(`apiVersion: v1
+entries:
+  nginx:
+    - name: nginx
+      version: 0.2.0
+      urls:
+        - https://example.com/nginx-0.2.0.tgz
+    - name: nginx
+      version: 0.1.0
+      urls:
+        - https://example.com/nginx-0.1.0.tgz
+  alpine:
+    - name: alpine
+      version: 1.0.0
+      urls:
+        - https://example.com/alpine-1.0.0.tgz
+`)
+
+	tests := []struct {
+		name    string
+		limit   int
+		wantErr bool
+	}{
+		{
+			name:  "unlimited",
+			limit: 0,
+		},
+		{
+			name:  "within limit",
+			limit: 3,
+		},
+		{
+			name:    "exceeds limit",
+			limit:   2,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			defaultLimit := helm.MaxIndexEntries
+			helm.MaxIndexEntries = tt.limit
+			t.Cleanup(func() {
+				helm.MaxIndexEntries = defaultLimit
+			})
+
+			i, err := IndexFromBytes(b)
+			if tt.wantErr {
+				g.Expect(err).To(MatchError(ErrTooManyIndexEntries))
+				g.Expect(err.Error()).To(ContainSubstring("of 2"))
+				g.Expect(i).To(BeNil())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(i.Entries["nginx"]).To(HaveLen(2))
+			g.Expect(i.Entries["alpine"]).To(HaveLen(1))
+		})
+	}
+}
+
 func TestNewChartRepository(t *testing.T) {
 	repositoryURL := "https://example.com"
 	providers := helmgetter.Providers{
@@ -248,6 +373,10 @@ func TestChartRepository_GetChartVersion(t *testing.T) {
 		{name: "chart", version: "0.2.0", url: "http://example.com/charts", digest: "sha256:1234567890abc"},
 		{name: "chart", version: "1.0.0", url: "http://example.com/charts", digest: "sha256:1234567890abc"},
 		{name: "chart", version: "1.1.0-rc.1", url: "http://example.com/charts", digest: "sha256:1234567890abc"},
+		{name: "builds", version: "1.2.3+build.9", url: "http://example.com/charts", digest: "sha256:1234567890abc", created: now},
+		{name: "builds", version: "1.2.3+build.100", url: "http://example.com/charts", digest: "sha256:1234567890abc", created: now.Add(-time.Hour)},
+		{name: "builds", version: "1.2.3+build.45", url: "http://example.com/charts", digest: "sha256:1234567890abc", created: now.Add(-time.Minute)},
+		{name: "builds", version: "1.2.2+build.200", url: "http://example.com/charts", digest: "sha256:1234567890abc", created: now},
 	}
 	for _, c := range charts {
 		g.Expect(r.Index.MustAdd(
@@ -255,7 +384,7 @@ func TestChartRepository_GetChartVersion(t *testing.T) {
 			fmt.Sprintf("%s-%s.tgz", c.name, c.version), c.url, c.digest),
 		).To(Succeed())
 		if !c.created.IsZero() {
-			r.Index.Entries["chart"][len(r.Index.Entries["chart"])-1].Created = c.created
+			r.Index.Entries[c.name][len(r.Index.Entries[c.name])-1].Created = c.created
 		}
 	}
 	r.Index.SortEntries()
@@ -308,6 +437,18 @@ func TestChartRepository_GetChartVersion(t *testing.T) {
 			chartVersion: "0.1.5",
 			wantVersion:  "0.1.5+c.now",
 		},
+		{
+			name:         "match highest build metadata if ambiguous",
+			chartName:    "builds",
+			chartVersion: "1.2.3",
+			wantVersion:  "1.2.3+build.100",
+		},
+		{
+			name:         "match highest build metadata of latest version",
+			chartName:    "builds",
+			chartVersion: "*",
+			wantVersion:  "1.2.3+build.100",
+		},
 	}
 
 	for _, tt := range tests {
@@ -346,6 +487,33 @@ func TestChartRepository_DownloadChart(t *testing.T) {
 			},
 			wantURL: "https://example.com/charts/foo-1.0.0.tgz",
 		},
+		{
+			name: "absolute URL with query",
+			url:  "https://example.com?token=repo",
+			chartVersion: &repo.ChartVersion{
+				Metadata: &chart.Metadata{Name: "chart"},
+				URLs:     []string{"https://bucket.s3.amazonaws.com/foo-1.0.0.tgz?X-Amz-Credential=AKIA%2F20230101%2Fus-east-1&a=b+c"},
+			},
+			wantURL: "https://bucket.s3.amazonaws.com/foo-1.0.0.tgz?X-Amz-Credential=AKIA%2F20230101%2Fus-east-1&a=b+c",
+		},
+		{
+			name: "relative URL with query",
+			url:  "https://example.com?token=repo",
+			chartVersion: &repo.ChartVersion{
+				Metadata: &chart.Metadata{Name: "chart"},
+				URLs:     []string{"charts/foo-1.0.0.tgz?token=chart%2Fsigned"},
+			},
+			wantURL: "https://example.com/charts/foo-1.0.0.tgz?token=chart%2Fsigned",
+		},
+		{
+			name: "relative URL without query",
+			url:  "https://example.com?token=repo",
+			chartVersion: &repo.ChartVersion{
+				Metadata: &chart.Metadata{Name: "chart"},
+				URLs:     []string{"charts/foo-1.0.0.tgz"},
+			},
+			wantURL: "https://example.com/charts/foo-1.0.0.tgz?token=repo",
+		},
 		{
 			name:         "no chart URL",
 			chartVersion: &repo.ChartVersion{Metadata: &chart.Metadata{Name: "chart"}},
@@ -384,6 +552,339 @@ func TestChartRepository_DownloadChart(t *testing.T) {
 	}
 }
 
+func TestChartRepository_DownloadChart_multipleURLs(t *testing.T) {
+	tests := []struct {
+		name       string
+		urls       []string
+		responses  map[string]string
+		wantCalled []string
+		wantErr    []string
+	}{
+		{
+			name: "first URL succeeds",
+			urls: []string{"https://mirror.example.com/foo-1.0.0.tgz", "charts/foo-1.0.0.tgz"},
+			responses: map[string]string{
+				"https://mirror.example.com/foo-1.0.0.tgz": "mirror",
+				"https://example.com/charts/foo-1.0.0.tgz": "origin",
+			},
+			wantCalled: []string{"https://mirror.example.com/foo-1.0.0.tgz"},
+		},
+		{
+			name: "falls back to relative URL",
+			urls: []string{"https://mirror.example.com/foo-1.0.0.tgz", "charts/foo-1.0.0.tgz"},
+			responses: map[string]string{
+				"https://example.com/charts/foo-1.0.0.tgz": "origin",
+			},
+			wantCalled: []string{"https://mirror.example.com/foo-1.0.0.tgz", "https://example.com/charts/foo-1.0.0.tgz"},
+		},
+		{
+			name: "skips invalid URL",
+			urls: []string{"https://ex ample.com/foo-1.0.0.tgz", "charts/foo-1.0.0.tgz"},
+			responses: map[string]string{
+				"https://example.com/charts/foo-1.0.0.tgz": "origin",
+			},
+			wantCalled: []string{"https://example.com/charts/foo-1.0.0.tgz"},
+		},
+		{
+			name:       "aggregates errors when all URLs fail",
+			urls:       []string{"https://mirror.example.com/foo-1.0.0.tgz", "charts/foo-1.0.0.tgz"},
+			wantCalled: []string{"https://mirror.example.com/foo-1.0.0.tgz", "https://example.com/charts/foo-1.0.0.tgz"},
+			wantErr: []string{
+				"no response for 'https://mirror.example.com/foo-1.0.0.tgz'",
+				"no response for 'https://example.com/charts/foo-1.0.0.tgz'",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			pg := &pagedGetter{Responses: tt.responses}
+			r := &ChartRepository{
+				URL:    "https://example.com",
+				Client: pg,
+			}
+			res, err := r.DownloadChart(&repo.ChartVersion{
+				Metadata: &chart.Metadata{Name: "foo"},
+				URLs:     tt.urls,
+			})
+			g.Expect(pg.CalledURLs).To(Equal(tt.wantCalled))
+			if len(tt.wantErr) > 0 {
+				g.Expect(err).To(HaveOccurred())
+				for _, e := range tt.wantErr {
+					g.Expect(err.Error()).To(ContainSubstring(e))
+				}
+				g.Expect(res).To(BeNil())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(res.String()).To(Equal(tt.responses[tt.wantCalled[len(tt.wantCalled)-1]]))
+		})
+	}
+}
+
+func TestChartRepository_DownloadChart_relativeURLFromIndex(t *testing.T) {
+	g := NewWithT(t)
+
+	server, err := helmtestserver.NewTempHelmServer()
+	g.Expect(err).ToNot(HaveOccurred())
+	t.Cleanup(func() { _ = os.RemoveAll(server.Root()) })
+
+	// Serve the repository from a sub path, with the chart in a directory
+	// relative to the index.
+	g.Expect(server.PackageChartWithVersion("../testdata/charts/helmchart", "1.2.3")).To(Succeed())
+	repoDir := filepath.Join(server.Root(), "repo")
+	g.Expect(os.MkdirAll(filepath.Join(repoDir, "charts"), 0o700)).To(Succeed())
+	g.Expect(os.Rename(filepath.Join(server.Root(), "helmchart-1.2.3.tgz"),
+		filepath.Join(repoDir, "charts", "helmchart-1.2.3.tgz"))).To(Succeed())
+	index, err := repo.IndexDirectory(repoDir, "")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(index.Entries["helmchart"][0].URLs).To(Equal([]string{"charts/helmchart-1.2.3.tgz"}))
+	g.Expect(index.WriteFile(filepath.Join(repoDir, "index.yaml"), 0o600)).To(Succeed())
+
+	server.Start()
+	t.Cleanup(server.Stop)
+
+	repoURL, err := NormalizeURL(server.URL() + "/repo")
+	g.Expect(err).ToNot(HaveOccurred())
+	providers := helmgetter.Providers{
+		helmgetter.Provider{
+			Schemes: []string{"http"},
+			New:     helmgetter.NewHTTPGetter,
+		},
+	}
+	r, err := NewChartRepository(repoURL, "", providers, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.CacheIndex()).To(Succeed())
+	t.Cleanup(func() { _ = r.Clear() })
+	g.Expect(r.LoadFromPath()).To(Succeed())
+
+	cv, err := r.GetChartVersion("helmchart", "1.2.3")
+	g.Expect(err).ToNot(HaveOccurred())
+	res, err := r.DownloadChart(cv)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	want, err := os.ReadFile(filepath.Join(repoDir, "charts", "helmchart-1.2.3.tgz"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.Bytes()).To(Equal(want))
+}
+
+func TestChartRepository_DownloadChart_presignedURL(t *testing.T) {
+	g := NewWithT(t)
+
+	// A presigned URL, with a query which is not in the canonical encoding
+	// of url.Values.
+	const rawQuery = "X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=AKIA%2F20230101%2Fus-east-1%2Fs3%2Faws4_request" +
+		"&X-Amz-Date=20230101T000000Z&X-Amz-Expires=900&X-Amz-SignedHeaders=host&response-content-type=application%2fgzip" +
+		"&X-Amz-Signature=0123456789abcdef;x=%7E+y"
+
+	var gotRawQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRawQuery = r.URL.RawQuery
+		_, _ = w.Write([]byte("chart"))
+	}))
+	t.Cleanup(server.Close)
+
+	providers := helmgetter.Providers{
+		helmgetter.Provider{
+			Schemes: []string{"http"},
+			New:     helmgetter.NewHTTPGetter,
+		},
+	}
+	r, err := NewChartRepository("http://example.com", "", providers, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	res, err := r.DownloadChart(&repo.ChartVersion{
+		Metadata: &chart.Metadata{Name: "chart"},
+		URLs:     []string{server.URL + "/charts/chart-0.1.0.tgz?" + rawQuery},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(res.String()).To(Equal("chart"))
+	g.Expect(gotRawQuery).To(Equal(rawQuery))
+}
+
+func TestChartRepository_CheckChart(t *testing.T) {
+	var (
+		methods []string
+		mu      sync.Mutex
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/charts/chart-0.1.0.tgz":
+			_, _ = w.Write([]byte("chart"))
+		case "/redirect/chart-0.1.0.tgz":
+			http.Redirect(w, r, "/charts/chart-0.1.0.tgz", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	providers := helmgetter.Providers{
+		helmgetter.Provider{
+			Schemes: []string{"http"},
+			New:     helmgetter.NewHTTPGetter,
+		},
+	}
+
+	tests := []struct {
+		name        string
+		urls        []string
+		wantMethods []string
+		wantErr     string
+	}{
+		{
+			name:        "available chart",
+			urls:        []string{"charts/chart-0.1.0.tgz"},
+			wantMethods: []string{http.MethodHead},
+		},
+		{
+			name:        "follows redirect",
+			urls:        []string{"redirect/chart-0.1.0.tgz"},
+			wantMethods: []string{http.MethodHead, http.MethodHead},
+		},
+		{
+			name:        "falls back to next URL",
+			urls:        []string{"missing/chart-0.1.0.tgz", "charts/chart-0.1.0.tgz"},
+			wantMethods: []string{http.MethodHead, http.MethodHead},
+		},
+		{
+			name:        "missing chart",
+			urls:        []string{"missing/chart-0.1.0.tgz"},
+			wantMethods: []string{http.MethodHead},
+			wantErr:     "404 Not Found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			mu.Lock()
+			methods = nil
+			mu.Unlock()
+
+			r, err := NewChartRepository(server.URL, "", providers, nil, helmgetter.WithBasicAuth("user", "pass"),
+				helmgetter.WithURL(server.URL))
+			g.Expect(err).ToNot(HaveOccurred())
+
+			err = r.CheckChart(&repo.ChartVersion{
+				Metadata: &chart.Metadata{Name: "chart"},
+				URLs:     tt.urls,
+			})
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			g.Expect(methods).To(Equal(tt.wantMethods))
+		})
+	}
+}
+
+func TestChartRepository_VerifyProvenance(t *testing.T) {
+	g := NewWithT(t)
+
+	server, err := helmtestserver.NewTempHelmServer()
+	g.Expect(err).ToNot(HaveOccurred())
+	t.Cleanup(func() { _ = os.RemoveAll(server.Root()) })
+
+	keyringPath := filepath.Join(t.TempDir(), "pub.pgp")
+	g.Expect(server.PackageSignedChartWithVersion("../testdata/charts/helmchart", "0.1.0", keyringPath)).To(Succeed())
+	otherKeyringPath := filepath.Join(t.TempDir(), "other.pgp")
+	g.Expect(server.PackageSignedChartWithVersion("../testdata/charts/helmchart", "0.2.0", otherKeyringPath)).To(Succeed())
+
+	readFile := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(server.Root(), name))
+		g.Expect(err).ToNot(HaveOccurred())
+		return string(b)
+	}
+	keyring, err := os.ReadFile(keyringPath)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	chartVersion := &repo.ChartVersion{
+		Metadata: &chart.Metadata{Name: "helmchart", Version: "0.1.0"},
+		URLs:     []string{"helmchart-0.1.0.tgz"},
+	}
+
+	tests := []struct {
+		name      string
+		keyring   []byte
+		responses map[string]string
+		data      string
+		wantErr   string
+	}{
+		{
+			name:    "valid provenance",
+			keyring: keyring,
+			responses: map[string]string{
+				"https://example.com/helmchart-0.1.0.tgz.prov": readFile("helmchart-0.1.0.tgz.prov"),
+			},
+			data: readFile("helmchart-0.1.0.tgz"),
+		},
+		{
+			name:    "no keyring",
+			data:    readFile("helmchart-0.1.0.tgz"),
+			wantErr: "no keyring to verify the chart provenance with",
+		},
+		{
+			name:      "no provenance file",
+			keyring:   keyring,
+			responses: map[string]string{},
+			data:      readFile("helmchart-0.1.0.tgz"),
+			wantErr:   "failed to download provenance file",
+		},
+		{
+			name:    "provenance signed by other key",
+			keyring: keyring,
+			responses: map[string]string{
+				"https://example.com/helmchart-0.1.0.tgz.prov": readFile("helmchart-0.2.0.tgz.prov"),
+			},
+			data:    readFile("helmchart-0.1.0.tgz"),
+			wantErr: "failed to verify provenance of chart 'helmchart' version '0.1.0'",
+		},
+		{
+			name:    "chart data does not match provenance",
+			keyring: keyring,
+			responses: map[string]string{
+				"https://example.com/helmchart-0.1.0.tgz.prov": readFile("helmchart-0.1.0.tgz.prov"),
+			},
+			data:    readFile("helmchart-0.2.0.tgz"),
+			wantErr: "sha256 sum does not match",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			r := &ChartRepository{
+				URL:     "https://example.com",
+				Client:  &pagedGetter{Responses: tt.responses},
+				Keyring: tt.keyring,
+			}
+			ver, err := r.VerifyProvenance(chartVersion, []byte(tt.data))
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(ver.SignedBy).ToNot(BeNil())
+			g.Expect(ver.FileName).To(Equal("helmchart-0.1.0.tgz"))
+		})
+	}
+}
+
 func TestChartRepository_CacheIndex(t *testing.T) {
 	g := NewWithT(t)
 
@@ -407,24 +908,733 @@ func TestChartRepository_CacheIndex(t *testing.T) {
 	g.Expect(r.digests).To(BeEmpty())
 }
 
-func TestChartRepository_DownloadIndex(t *testing.T) {
+func TestChartRepository_CacheIndex_keepRawIndex(t *testing.T) {
 	g := NewWithT(t)
 
-	b, err := os.ReadFile(chartmuseumTestFile)
+	pages := map[string]string{
+		"https://example.com/index.yaml": "apiVersion: v1\nannotations:\n  " + NextIndexPageAnnotation + ": 2.yaml\nentries: {}\n",
+		"https://example.com/2.yaml":     "apiVersion: v1\nentries: {}",
+	}
+	mg := &pagedGetter{Responses: pages}
+
+	r := newChartRepository()
+	r.URL = "https://example.com"
+	r.Client = mg
+	r.KeepRawIndex = true
+
+	g.Expect(r.CacheIndex()).To(Succeed())
+	t.Cleanup(func() { _ = r.Clear() })
+
+	g.Expect(r.RawPath).To(BeARegularFile())
+	b, err := os.ReadFile(r.RawPath)
 	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(b)).To(Equal(pages["https://example.com/index.yaml"] + "---\n" + pages["https://example.com/2.yaml"]))
 
-	mg := mockGetter{Response: b}
-	r := &ChartRepository{
-		URL:     "https://example.com",
-		Client:  &mg,
-		RWMutex: &sync.RWMutex{},
-	}
+	b, err = os.ReadFile(r.Path)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(b)).ToNot(ContainSubstring(NextIndexPageAnnotation))
 
-	buf := bytes.NewBuffer([]byte{})
-	g.Expect(r.DownloadIndex(buf)).To(Succeed())
-	g.Expect(buf.Bytes()).To(Equal(b))
-	g.Expect(mg.LastCalledURL).To(Equal(r.URL + "/index.yaml"))
-	g.Expect(err).To(BeNil())
+	rawPath := r.RawPath
+	g.Expect(r.Clear()).To(Succeed())
+	g.Expect(r.RawPath).To(BeEmpty())
+	g.Expect(rawPath).ToNot(BeAnExistingFile())
+}
+
+func TestChartRepository_CacheIndex_passthroughIndex(t *testing.T) {
+	t.Run("stores index as downloaded", func(t *testing.T) {
+		g := NewWithT(t)
+
+		b, err := os.ReadFile(chartmuseumTestFile)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		r := newChartRepository()
+		r.URL = "https://example.com"
+		r.Client = &mockGetter{Response: b}
+		r.PassthroughIndex = true
+
+		g.Expect(r.CacheIndex()).To(Succeed())
+		t.Cleanup(func() { _ = r.Clear() })
+
+		got, err := os.ReadFile(r.Path)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(got).To(Equal(b))
+		g.Expect(r.Digest(digest.SHA256)).To(Equal(digest.FromBytes(b)))
+	})
+
+	t.Run("rejects paginated index", func(t *testing.T) {
+		g := NewWithT(t)
+
+		pages := map[string]string{
+			"https://example.com/index.yaml": "apiVersion: v1\nannotations:\n  " + NextIndexPageAnnotation + ": 2.yaml\nentries: {}\n",
+			"https://example.com/2.yaml":     "apiVersion: v1\nentries: {}",
+		}
+		mg := &pagedGetter{Responses: pages}
+
+		r := newChartRepository()
+		r.URL = "https://example.com"
+		r.Client = mg
+		r.PassthroughIndex = true
+
+		err := r.CacheIndex()
+		g.Expect(err).To(MatchError(ErrPaginatedIndex))
+		g.Expect(r.Path).To(BeEmpty())
+		g.Expect(mg.CalledURLs).To(Equal([]string{"https://example.com/index.yaml"}))
+	})
+}
+
+func TestChartRepository_DownloadIndex(t *testing.T) {
+	g := NewWithT(t)
+
+	b, err := os.ReadFile(chartmuseumTestFile)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	mg := mockGetter{Response: b}
+	r := &ChartRepository{
+		URL:     "https://example.com",
+		Client:  &mg,
+		RWMutex: &sync.RWMutex{},
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	g.Expect(r.DownloadIndex(buf)).To(Succeed())
+	g.Expect(buf.Bytes()).To(Equal(b))
+	g.Expect(mg.LastCalledURL).To(Equal(r.URL + "/index.yaml"))
+	g.Expect(err).To(BeNil())
+}
+
+func TestChartRepository_cookieSession(t *testing.T) {
+	b, err := os.ReadFile(chartmuseumTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server establishes a session with a redirect to the requested URL,
+	// and requires the session cookie for any other request.
+	var redirects int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			atomic.AddInt32(&redirects, 1)
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			http.Redirect(w, r, r.URL.String(), http.StatusFound)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(server.Close)
+
+	providers := helmgetter.Providers{
+		helmgetter.Provider{
+			Schemes: []string{"http"},
+			New:     helmgetter.NewHTTPGetter,
+		},
+	}
+
+	t.Run("carries session cookie", func(t *testing.T) {
+		g := NewWithT(t)
+		atomic.StoreInt32(&redirects, 0)
+
+		r, err := NewChartRepository(server.URL, "", providers, nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(r.CookieJar).ToNot(BeNil())
+
+		buf := bytes.NewBuffer([]byte{})
+		g.Expect(r.DownloadIndex(buf)).To(Succeed())
+		g.Expect(buf.Bytes()).To(Equal(b))
+
+		// The chart is downloaded within the established session.
+		_, err = r.DownloadChart(&repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: "chart"},
+			URLs:     []string{"charts/chart-0.1.0.tgz"},
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(atomic.LoadInt32(&redirects)).To(Equal(int32(1)))
+	})
+
+	t.Run("carries session cookie set by index", func(t *testing.T) {
+		g := NewWithT(t)
+
+		// The index response establishes the session, which is required
+		// to download the chart.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/index.yaml" {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+				_, _ = w.Write(b)
+				return
+			}
+			if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("chart"))
+		}))
+		t.Cleanup(server.Close)
+
+		r, err := NewChartRepository(server.URL, "", providers, nil)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		cv := &repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: "chart"},
+			URLs:     []string{"charts/chart-0.1.0.tgz"},
+		}
+		_, err = r.DownloadChart(cv)
+		g.Expect(err).To(HaveOccurred())
+
+		g.Expect(r.DownloadIndex(bytes.NewBuffer([]byte{}))).To(Succeed())
+		_, err = r.DownloadChart(cv)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+
+	t.Run("fails without cookie jar", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r, err := NewChartRepository(server.URL, "", providers, nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		r.CookieJar = nil
+
+		err = r.DownloadIndex(bytes.NewBuffer([]byte{}))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(transport.IsTooManyRedirects(err)).To(BeTrue())
+	})
+}
+
+func TestChartRepository_CacheIndex_conditional(t *testing.T) {
+	b, err := os.ReadFile(chartmuseumTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		etag         atomic.Value
+		requests     int32
+		conditional  int32
+		gets         int32
+		unauthorized int32
+	)
+	etag.Store(`"v1"`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			atomic.AddInt32(&unauthorized, 1)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("ETag", etag.Load().(string))
+		if match := r.Header.Get("If-None-Match"); match != "" {
+			atomic.AddInt32(&conditional, 1)
+			if match == etag.Load().(string) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		atomic.AddInt32(&gets, 1)
+		http.ServeContent(w, r, "index.yaml", time.Time{}, bytes.NewReader(b))
+	}))
+	t.Cleanup(server.Close)
+
+	providers := helmgetter.Providers{
+		helmgetter.Provider{
+			Schemes: []string{"http"},
+			New:     helmgetter.NewHTTPGetter,
+		},
+	}
+	newRepository := func(g *WithT, validators *IndexValidators) *ChartRepository {
+		r, err := NewChartRepository(server.URL, "", providers, nil, helmgetter.WithBasicAuth("user", "pass"),
+			helmgetter.WithURL(server.URL))
+		g.Expect(err).ToNot(HaveOccurred())
+		r.ConditionalIndex = true
+		r.Validators = validators
+		return r
+	}
+
+	g := NewWithT(t)
+
+	r := newRepository(g, nil)
+	g.Expect(r.CacheIndex()).To(Succeed())
+	defer r.Clear()
+	g.Expect(r.Validators).To(Equal(&IndexValidators{ETag: `"v1"`}))
+	g.Expect(atomic.LoadInt32(&gets)).To(Equal(int32(1)))
+
+	// The index is not downloaded again while it is not modified.
+	r = newRepository(g, &IndexValidators{ETag: `"v1"`})
+	g.Expect(r.CacheIndex()).To(MatchError(ErrIndexNotModified))
+	g.Expect(r.Path).To(BeEmpty())
+	g.Expect(r.Validators).To(Equal(&IndexValidators{ETag: `"v1"`}))
+	g.Expect(atomic.LoadInt32(&gets)).To(Equal(int32(1)))
+
+	// The index is downloaded once it is modified.
+	etag.Store(`"v2"`)
+	r = newRepository(g, &IndexValidators{ETag: `"v1"`})
+	g.Expect(r.CacheIndex()).To(Succeed())
+	defer r.Clear()
+	g.Expect(r.Validators).To(Equal(&IndexValidators{ETag: `"v2"`}))
+	g.Expect(atomic.LoadInt32(&gets)).To(Equal(int32(2)))
+
+	// No conditional request is made unless configured.
+	r = newRepository(g, &IndexValidators{ETag: `"v2"`})
+	r.ConditionalIndex = false
+	conditionalBefore := atomic.LoadInt32(&conditional)
+	g.Expect(r.CacheIndex()).To(Succeed())
+	defer r.Clear()
+	g.Expect(atomic.LoadInt32(&conditional)).To(Equal(conditionalBefore))
+	g.Expect(atomic.LoadInt32(&gets)).To(Equal(int32(3)))
+
+	// Every conditional request is the request for the index itself.
+	g.Expect(atomic.LoadInt32(&requests)).To(Equal(int32(4)))
+	g.Expect(atomic.LoadInt32(&unauthorized)).To(BeZero())
+}
+
+func TestChartRepository_CacheIndex_conditionalSession(t *testing.T) {
+	g := NewWithT(t)
+
+	// The server establishes a session with a redirect to the requested URL,
+	// and requires the session cookie for the conditional request.
+	var redirects int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			atomic.AddInt32(&redirects, 1)
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			http.Redirect(w, r, r.URL.String(), http.StatusFound)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+
+	providers := helmgetter.Providers{
+		helmgetter.Provider{
+			Schemes: []string{"http"},
+			New:     helmgetter.NewHTTPGetter,
+		},
+	}
+	r, err := NewChartRepository(server.URL, "", providers, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	r.ConditionalIndex = true
+	r.Validators = &IndexValidators{ETag: `"v1"`}
+
+	g.Expect(r.CacheIndex()).To(MatchError(ErrIndexNotModified))
+	g.Expect(atomic.LoadInt32(&redirects)).To(Equal(int32(1)))
+}
+
+func TestChartRepository_CacheIndex_conditionalLastModified(t *testing.T) {
+	b, err := os.ReadFile(chartmuseumTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastModified := time.Now().Add(-time.Hour)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "index.yaml", lastModified, bytes.NewReader(b))
+	}))
+	t.Cleanup(server.Close)
+
+	providers := helmgetter.Providers{
+		helmgetter.Provider{
+			Schemes: []string{"http"},
+			New:     helmgetter.NewHTTPGetter,
+		},
+	}
+
+	t.Run("uses Last-Modified", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r, err := NewChartRepository(server.URL, "", providers, nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		r.ConditionalIndex = true
+		g.Expect(r.CacheIndex()).To(Succeed())
+		defer r.Clear()
+		g.Expect(r.Validators).To(Equal(&IndexValidators{LastModified: lastModified.UTC().Format(http.TimeFormat)}))
+
+		validators := r.Validators
+		r, err = NewChartRepository(server.URL, "", providers, nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		r.ConditionalIndex = true
+		r.Validators = validators
+		g.Expect(r.CacheIndex()).To(MatchError(ErrIndexNotModified))
+	})
+
+	t.Run("ignores Last-Modified within the second of the response", func(t *testing.T) {
+		g := NewWithT(t)
+
+		// A Last-Modified time which is not before the Date of the response,
+		// regardless of when in the current second the request is made.
+		lastModified = time.Now().Add(time.Minute)
+		r, err := NewChartRepository(server.URL, "", providers, nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		r.ConditionalIndex = true
+		g.Expect(r.CacheIndex()).To(Succeed())
+		defer r.Clear()
+		g.Expect(r.Validators).To(BeNil())
+	})
+}
+
+func TestChartRepository_DownloadIndex_maxIndexSize(t *testing.T) {
+	b, err := os.ReadFile(chartmuseumTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		limit   int64
+		wantErr bool
+	}{
+		{
+			name:  "within limit",
+			limit: int64(len(b)),
+		},
+		{
+			name:    "exceeds limit",
+			limit:   int64(len(b)) - 1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			defaultLimit := helm.MaxIndexSize
+			helm.MaxIndexSize = tt.limit
+			t.Cleanup(func() {
+				helm.MaxIndexSize = defaultLimit
+			})
+
+			r := &ChartRepository{
+				URL:     "https://example.com",
+				Client:  &mockGetter{Response: b},
+				RWMutex: &sync.RWMutex{},
+			}
+
+			buf := bytes.NewBuffer([]byte{})
+			err := r.DownloadIndex(buf)
+			if tt.wantErr {
+				g.Expect(err).To(MatchError(ErrIndexTooLarge))
+				g.Expect(int64(buf.Len())).To(BeNumerically("<=", tt.limit+1))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(buf.Bytes()).To(Equal(b))
+		})
+	}
+}
+
+func TestChartRepository_DownloadIndex_maxIndexSizeHTTP(t *testing.T) {
+	defaultLimit := helm.MaxIndexSize
+	helm.MaxIndexSize = 1024
+	t.Cleanup(func() {
+		helm.MaxIndexSize = defaultLimit
+	})
+
+	// The server streams an index without end, which can only be downloaded
+	// if the download is aborted once it exceeds the limit, or announces the
+	// Content-Length of an oversized index.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("length") != "" {
+			w.Header().Set("Content-Length", "1048576")
+		}
+		chunk := bytes.Repeat([]byte("#\n"), 512)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	providers := helmgetter.Providers{
+		helmgetter.Provider{
+			Schemes: []string{"http"},
+			New:     helmgetter.NewHTTPGetter,
+		},
+	}
+
+	for _, query := range []string{"", "?length=true"} {
+		t.Run("query "+query, func(t *testing.T) {
+			g := NewWithT(t)
+
+			r, err := NewChartRepository(server.URL+"/"+query, "", providers, nil)
+			g.Expect(err).ToNot(HaveOccurred())
+			err = r.DownloadIndex(bytes.NewBuffer([]byte{}))
+			g.Expect(err).To(MatchError(ErrIndexTooLarge))
+		})
+	}
+}
+
+func TestChartRepository_DownloadIndex_compressed(t *testing.T) {
+	b, err := os.ReadFile(chartmuseumTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var zb bytes.Buffer
+	zw := gzip.NewWriter(&zb)
+	if _, err = zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		compressedIndex bool
+		handler         http.HandlerFunc
+		limit           int64
+		wantRequests    []string
+		wantErr         string
+	}{
+		{
+			name:            "compressed index",
+			compressedIndex: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/index.yaml.gz" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write(zb.Bytes())
+			},
+			wantRequests: []string{"/index.yaml.gz"},
+		},
+		{
+			name:            "falls back to plain index",
+			compressedIndex: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/index.yaml" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write(b)
+			},
+			wantRequests: []string{"/index.yaml.gz", "/index.yaml"},
+		},
+		{
+			name: "plain index with gzip content encoding",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "gzip")
+				_, _ = w.Write(zb.Bytes())
+			},
+			wantRequests: []string{"/index.yaml"},
+		},
+		{
+			name: "compressed index is not attempted",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(b)
+			},
+			wantRequests: []string{"/index.yaml"},
+		},
+		{
+			name:            "does not fall back on transient error",
+			compressedIndex: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			wantRequests: []string{"/index.yaml.gz"},
+			wantErr:      "503 Service Unavailable",
+		},
+		{
+			name:            "decompressed index exceeds limit",
+			compressedIndex: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(zb.Bytes())
+			},
+			limit:        int64(len(b)) - 1,
+			wantRequests: []string{"/index.yaml.gz"},
+			wantErr:      ErrIndexTooLarge.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			if tt.limit > 0 {
+				defaultLimit := helm.MaxIndexSize
+				helm.MaxIndexSize = tt.limit
+				t.Cleanup(func() {
+					helm.MaxIndexSize = defaultLimit
+				})
+			}
+
+			var (
+				mu       sync.Mutex
+				requests []string
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests = append(requests, r.URL.Path)
+				mu.Unlock()
+				tt.handler(w, r)
+			}))
+			t.Cleanup(server.Close)
+
+			providers := helmgetter.Providers{
+				helmgetter.Provider{
+					Schemes: []string{"http"},
+					New:     helmgetter.NewHTTPGetter,
+				},
+			}
+			r, err := NewChartRepository(server.URL, "", providers, nil)
+			g.Expect(err).ToNot(HaveOccurred())
+			r.CompressedIndex = tt.compressedIndex
+
+			buf := bytes.NewBuffer([]byte{})
+			err = r.DownloadIndex(buf)
+			mu.Lock()
+			g.Expect(requests).To(Equal(tt.wantRequests))
+			mu.Unlock()
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(buf.Bytes()).To(Equal(b))
+		})
+	}
+}
+
+func TestChartRepository_DownloadIndex_paginated(t *testing.T) {
+	page := func(next string, entries ...string) string {
+		s := "apiVersion: v1\n"
+		if next != "" {
+			s += fmt.Sprintf("annotations:\n  %s: %s\n", NextIndexPageAnnotation, next)
+		}
+		s += "entries:\n"
+		for _, e := range entries {
+			name, version, _ := strings.Cut(e, "@")
+			s += fmt.Sprintf("  %s:\n  - name: %s\n    version: %s\n    urls:\n    - %s-%s.tgz\n", name, name, version, name, version)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name        string
+		pages       map[string]string
+		maxPages    int
+		maxEntries  int
+		wantEntries map[string][]string
+		wantErr     string
+		wantCalled  int
+	}{
+		{
+			name: "merges pages",
+			pages: map[string]string{
+				"https://example.com/index.yaml":   page("pages/2.yaml", "foo@1.0.0"),
+				"https://example.com/pages/2.yaml": page("/pages/3.yaml", "foo@2.0.0", "bar@1.0.0"),
+				"https://example.com/pages/3.yaml": page("", "foo@1.0.0", "baz@1.0.0"),
+			},
+			wantEntries: map[string][]string{
+				"foo": {"2.0.0", "1.0.0"},
+				"bar": {"1.0.0"},
+				"baz": {"1.0.0"},
+			},
+			wantCalled: 3,
+		},
+		{
+			name: "detects loop",
+			pages: map[string]string{
+				"https://example.com/index.yaml": page("2.yaml", "foo@1.0.0"),
+				"https://example.com/2.yaml":     page("index.yaml", "foo@2.0.0"),
+			},
+			wantErr:    "index page 'https://example.com/index.yaml' results in a loop",
+			wantCalled: 2,
+		},
+		{
+			name: "exceeds maximum number of pages",
+			pages: map[string]string{
+				"https://example.com/index.yaml": page("2.yaml", "foo@1.0.0"),
+				"https://example.com/2.yaml":     page("3.yaml", "foo@2.0.0"),
+				"https://example.com/3.yaml":     page("", "foo@3.0.0"),
+			},
+			maxPages:   2,
+			wantErr:    "index exceeds the maximum number of pages of 2",
+			wantCalled: 2,
+		},
+		{
+			name: "merged pages exceed maximum number of entries",
+			pages: map[string]string{
+				"https://example.com/index.yaml": page("2.yaml", "foo@1.0.0", "bar@1.0.0"),
+				"https://example.com/2.yaml":     page("3.yaml", "foo@2.0.0"),
+				"https://example.com/3.yaml":     page("", "foo@3.0.0"),
+			},
+			maxEntries: 3,
+			wantErr:    "index exceeds the maximum number of entries of 3",
+			wantCalled: 3,
+		},
+		{
+			name: "rejects page on other host",
+			pages: map[string]string{
+				"https://example.com/index.yaml": page("https://other.com/2.yaml", "foo@1.0.0"),
+			},
+			wantErr:    "index page 'https://other.com/2.yaml' is not served from the same host as the index",
+			wantCalled: 1,
+		},
+		{
+			name: "invalid page",
+			pages: map[string]string{
+				"https://example.com/index.yaml": page("2.yaml", "foo@1.0.0"),
+				"https://example.com/2.yaml":     "invalid",
+			},
+			wantErr:    "failed to load index page 'https://example.com/2.yaml'",
+			wantCalled: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			if tt.maxPages > 0 {
+				defaultMaxPages := MaxIndexPages
+				MaxIndexPages = tt.maxPages
+				t.Cleanup(func() {
+					MaxIndexPages = defaultMaxPages
+				})
+			}
+			if tt.maxEntries > 0 {
+				defaultMaxEntries := helm.MaxIndexEntries
+				helm.MaxIndexEntries = tt.maxEntries
+				t.Cleanup(func() {
+					helm.MaxIndexEntries = defaultMaxEntries
+				})
+			}
+
+			mg := &pagedGetter{Responses: tt.pages}
+			r := &ChartRepository{
+				URL:     "https://example.com",
+				Client:  mg,
+				RWMutex: &sync.RWMutex{},
+			}
+
+			buf := bytes.NewBuffer([]byte{})
+			err := r.DownloadIndex(buf)
+			g.Expect(mg.CalledURLs).To(HaveLen(tt.wantCalled))
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			i, err := IndexFromBytes(buf.Bytes())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(i.Annotations).ToNot(HaveKey(NextIndexPageAnnotation))
+			g.Expect(i.Entries).To(HaveLen(len(tt.wantEntries)))
+			for name, versions := range tt.wantEntries {
+				g.Expect(i.Entries).To(HaveKey(name))
+				var got []string
+				for _, cv := range i.Entries[name] {
+					got = append(got, cv.Version)
+				}
+				g.Expect(got).To(Equal(versions))
+			}
+		})
+	}
 }
 
 func TestChartRepository_StrategicallyLoadIndex(t *testing.T) {
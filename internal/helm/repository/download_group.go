@@ -0,0 +1,72 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"bytes"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// DownloadGroup deduplicates concurrent downloads of the same chart version.
+// When a ChartRepository with a DownloadGroup downloads a chart version while
+// a ChartRepository sharing the group is already downloading it, it waits
+// for that download to finish and uses its result, instead of downloading
+// the chart version itself. It is safe for concurrent use. A nil
+// DownloadGroup does not deduplicate anything.
+type DownloadGroup struct {
+	group *singleflight.Group
+	scope string
+}
+
+// NewDownloadGroup returns a new DownloadGroup.
+func NewDownloadGroup() *DownloadGroup {
+	return &DownloadGroup{group: &singleflight.Group{}}
+}
+
+// Scoped returns a DownloadGroup which shares the downloads of g, but only
+// with DownloadGroups returned for the same scope. This allows e.g. scoping
+// downloads to a HelmRepository, so that ChartRepositories configured with
+// different credentials never share a download.
+func (g *DownloadGroup) Scoped(scope string) *DownloadGroup {
+	if g == nil {
+		return nil
+	}
+	return &DownloadGroup{group: g.group, scope: g.scope + scope + "\x00"}
+}
+
+// do calls fn to download the chart version with the given URL and digest,
+// unless a download of it is already in flight, in which case it waits for
+// that download to finish. Every caller is returned its own copy of the
+// downloaded data.
+func (g *DownloadGroup) do(url, digest string, fn func() (*bytes.Buffer, error)) (*bytes.Buffer, error) {
+	if g == nil {
+		return fn()
+	}
+	v, err, _ := g.group.Do(g.scope+url+"\x00"+digest, func() (interface{}, error) {
+		res, err := fn()
+		if err != nil {
+			return nil, err
+		}
+		return res.Bytes(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := v.([]byte)
+	return bytes.NewBuffer(append(make([]byte, 0, len(b)), b...)), nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDownloadGroup_do(t *testing.T) {
+	// download returns a download func which blocks until release is
+	// closed, and counts its calls.
+	download := func(calls *int32, release chan struct{}, data string, err error) func() (*bytes.Buffer, error) {
+		return func() (*bytes.Buffer, error) {
+			atomic.AddInt32(calls, 1)
+			<-release
+			if err != nil {
+				return nil, err
+			}
+			return bytes.NewBufferString(data), nil
+		}
+	}
+
+	// concurrently calls do for each of the groups, and releases the first
+	// download once the others had time to wait for it.
+	concurrently := func(groups []*DownloadGroup, url, digest string, fn func() (*bytes.Buffer, error), release chan struct{}) ([]*bytes.Buffer, []error) {
+		var wg sync.WaitGroup
+		res := make([]*bytes.Buffer, len(groups))
+		errs := make([]error, len(groups))
+		for i, g := range groups {
+			i, g := i, g
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res[i], errs[i] = g.do(url, digest, fn)
+			}()
+		}
+		time.Sleep(200 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		return res, errs
+	}
+
+	t.Run("concurrent downloads are made once", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var calls int32
+		release := make(chan struct{})
+		group := NewDownloadGroup()
+		res, errs := concurrently([]*DownloadGroup{group, group, group, group},
+			"https://example.com/chart-0.1.0.tgz", "sha256:abc", download(&calls, release, "chart", nil), release)
+		g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+		for i := range res {
+			g.Expect(errs[i]).ToNot(HaveOccurred())
+			g.Expect(res[i].String()).To(Equal("chart"))
+		}
+
+		// Every caller gets its own copy of the data.
+		res[0].Reset()
+		_, _ = res[0].WriteString("other")
+		g.Expect(res[1].String()).To(Equal("chart"))
+	})
+
+	t.Run("errors are shared", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var calls int32
+		release := make(chan struct{})
+		group := NewDownloadGroup()
+		_, errs := concurrently([]*DownloadGroup{group, group},
+			"https://example.com/chart-0.1.0.tgz", "", download(&calls, release, "", errors.New("failed")), release)
+		g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(1)))
+		g.Expect(errs).To(HaveEach(MatchError("failed")))
+	})
+
+	t.Run("downloads are not shared across scopes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var calls int32
+		release := make(chan struct{})
+		group := NewDownloadGroup()
+		_, errs := concurrently([]*DownloadGroup{group.Scoped("default/a"), group.Scoped("default/b"), group.Scoped("default/a")},
+			"https://example.com/chart-0.1.0.tgz", "sha256:abc", download(&calls, release, "chart", nil), release)
+		g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(2)))
+		g.Expect(errs).To(HaveEach(BeNil()))
+	})
+
+	t.Run("nil group does not deduplicate", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var calls int32
+		release := make(chan struct{})
+		var group *DownloadGroup
+		_, errs := concurrently([]*DownloadGroup{group, group.Scoped("default/a")},
+			"https://example.com/chart-0.1.0.tgz", "sha256:abc", download(&calls, release, "chart", nil), release)
+		g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(2)))
+		g.Expect(errs).To(HaveEach(BeNil()))
+	})
+}
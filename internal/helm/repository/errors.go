@@ -16,6 +16,16 @@ limitations under the License.
 
 package repository
 
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/fluxcd/source-controller/internal/transport"
+)
+
 // ErrReference indicate invalid chart reference.
 type ErrReference struct {
 	Err error
@@ -45,3 +55,36 @@ func (ee *ErrExternal) Error() string {
 func (ee *ErrExternal) Unwrap() error {
 	return ee.Err
 }
+
+// IsTransientError returns if the given error of a request to a Helm
+// repository is likely to be resolved by retrying the request, like a
+// timeout, a refused or reset connection, or an HTTP 408, 429, 500, 502, 503
+// or 504 response. Any other error, like an HTTP 404 response, is considered
+// permanent.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && (dnsErr.IsTimeout || dnsErr.IsTemporary) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var statusErr *transport.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/fluxcd/source-controller/internal/transport"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransientError(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.com/index.yaml", Err: err}
+	}
+	statusErr := func(code int) error {
+		return urlErr(&transport.StatusError{
+			URL:        "https://example.com/index.yaml",
+			StatusCode: code,
+			Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "nil",
+			err:  nil,
+		},
+		{
+			name: "timeout",
+			err:  fmt.Errorf("failed to cache index to temporary file: %w", urlErr(timeoutError{})),
+			want: true,
+		},
+		{
+			name: "DNS timeout",
+			err:  urlErr(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "timeout", Name: "example.com", IsTimeout: true}}),
+			want: true,
+		},
+		{
+			name: "DNS host not found",
+			err:  urlErr(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}}),
+		},
+		{
+			name: "connection refused",
+			err:  urlErr(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}),
+			want: true,
+		},
+		{
+			name: "connection reset",
+			err:  urlErr(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}),
+			want: true,
+		},
+		{
+			name: "unexpected EOF",
+			err:  urlErr(io.ErrUnexpectedEOF),
+			want: true,
+		},
+		{
+			name: "HTTP 503",
+			err:  fmt.Errorf("failed to cache index to temporary file: %w", statusErr(http.StatusServiceUnavailable)),
+			want: true,
+		},
+		{
+			name: "HTTP 429",
+			err:  fmt.Errorf("failed to cache index to temporary file: %w", statusErr(http.StatusTooManyRequests)),
+			want: true,
+		},
+		{
+			name: "HTTP 404",
+			err:  fmt.Errorf("failed to cache index to temporary file: %w", statusErr(http.StatusNotFound)),
+		},
+		{
+			name: "HTTP 401",
+			err:  fmt.Errorf("failed to cache index to temporary file: %w", statusErr(http.StatusUnauthorized)),
+		},
+		{
+			name: "HTTP 503 message without status error",
+			err:  errors.New("failed to fetch https://example.com/index.yaml : 503 Service Unavailable"),
+		},
+		{
+			name: "index too large",
+			err:  fmt.Errorf("%w of %d bytes", ErrIndexTooLarge, 10),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(IsTransientError(tt.err)).To(Equal(tt.want))
+		})
+	}
+}
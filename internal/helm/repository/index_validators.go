@@ -0,0 +1,106 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"net/http"
+	"time"
+)
+
+// IndexValidators are the HTTP cache validators of a downloaded index, used
+// to make a conditional request for it.
+type IndexValidators struct {
+	// ETag of the index, sent in the If-None-Match header.
+	ETag string
+	// LastModified is the modification time of the index, sent in the
+	// If-Modified-Since header.
+	LastModified string
+}
+
+// conditionalRoundTripper sends the requests for an index through rt as
+// conditional requests using the validators, and records the validators of
+// the index of the last successful response.
+type conditionalRoundTripper struct {
+	rt         http.RoundTripper
+	validators *IndexValidators
+
+	// response holds the validators of the index of the last successful
+	// response, or nil if the server does not provide any.
+	response *IndexValidators
+}
+
+// RoundTrip implements http.RoundTripper. It returns ErrIndexNotModified if
+// the index has not been modified.
+func (c *conditionalRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if v := c.validators; v != nil && (v.ETag != "" || v.LastModified != "") {
+		// The request must not be modified, send a clone with the
+		// conditional headers.
+		req = req.Clone(req.Context())
+		if v.ETag != "" {
+			req.Header.Set("If-None-Match", v.ETag)
+		}
+		if v.LastModified != "" {
+			req.Header.Set("If-Modified-Since", v.LastModified)
+		}
+	}
+
+	res, err := c.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		res.Body.Close()
+		return nil, ErrIndexNotModified
+	case http.StatusOK:
+		c.response = responseValidators(res.Header)
+	}
+	return res, nil
+}
+
+// responseValidators returns the validators of the given response header, or
+// nil if it does not provide any.
+func responseValidators(header http.Header) *IndexValidators {
+	v := &IndexValidators{
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+	}
+	if !reliableLastModified(header) {
+		v.LastModified = ""
+	}
+	if v.ETag == "" && v.LastModified == "" {
+		return nil
+	}
+	return v
+}
+
+// reliableLastModified returns if the Last-Modified time of the given
+// response header can be used for a conditional request. As it has a
+// resolution of one second, the resource may still have been modified within
+// that second if it is not at least one second before the Date of the
+// response, see RFC 7232 section 2.2.2.
+func reliableLastModified(header http.Header) bool {
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return false
+	}
+	return date.Sub(lastModified) >= time.Second
+}
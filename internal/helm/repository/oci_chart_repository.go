@@ -36,6 +36,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 
 	"github.com/fluxcd/pkg/version"
+	"github.com/fluxcd/source-controller/internal/connlimit"
 	"github.com/fluxcd/source-controller/internal/oci"
 	"github.com/fluxcd/source-controller/internal/transport"
 )
@@ -70,6 +71,9 @@ type OCIChartRepository struct {
 
 	// verifiers is a list of verifiers to use when verifying a chart.
 	verifiers []oci.Verifier
+
+	// connectionLimiter bounds the number of concurrent registry operations.
+	connectionLimiter *connlimit.Limiter
 }
 
 // OCIChartRepositoryOption is a function that can be passed to NewOCIChartRepository
@@ -84,6 +88,16 @@ func WithVerifiers(verifiers []oci.Verifier) OCIChartRepositoryOption {
 	}
 }
 
+// WithOCIConnectionLimiter returns a ChartRepositoryOption that will set the
+// connection limiter. As the registry client does not allow its requests to
+// be limited individually, a slot is held for every registry operation.
+func WithOCIConnectionLimiter(limiter *connlimit.Limiter) OCIChartRepositoryOption {
+	return func(r *OCIChartRepository) error {
+		r.connectionLimiter = limiter
+		return nil
+	}
+}
+
 // WithOCIRegistryClient returns a ChartRepositoryOption that will set the registry client
 func WithOCIRegistryClient(client RegistryClient) OCIChartRepositoryOption {
 	return func(r *OCIChartRepository) error {
@@ -199,7 +213,11 @@ func (r *OCIChartRepository) getChartVersion(name, ver string) (*repo.ChartVersi
 // It assumes that the ref has been validated to be an OCI reference.
 func (r *OCIChartRepository) getTags(ref string) ([]string, error) {
 	// Retrieve list of repository tags
-	tags, err := r.RegistryClient.Tags(strings.TrimPrefix(ref, fmt.Sprintf("%s://", registry.OCIScheme)))
+	var tags []string
+	err := r.limit(func() (err error) {
+		tags, err = r.RegistryClient.Tags(strings.TrimPrefix(ref, fmt.Sprintf("%s://", registry.OCIScheme)))
+		return
+	})
 	if err != nil {
 		return nil, fmt.Errorf("could not fetch tags for %q: %s", ref, err)
 	}
@@ -231,7 +249,11 @@ func (r *OCIChartRepository) DownloadChart(chart *repo.ChartVersion) (*bytes.Buf
 	defer transport.Release(t)
 
 	// trim the oci scheme prefix if needed
-	b, err := r.Client.Get(strings.TrimPrefix(u.String(), fmt.Sprintf("%s://", registry.OCIScheme)), clientOpts...)
+	var b *bytes.Buffer
+	err = r.limit(func() (err error) {
+		b, err = r.Client.Get(strings.TrimPrefix(u.String(), fmt.Sprintf("%s://", registry.OCIScheme)), clientOpts...)
+		return
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get '%s': %w", ref, err)
 	}
@@ -241,13 +263,25 @@ func (r *OCIChartRepository) DownloadChart(chart *repo.ChartVersion) (*bytes.Buf
 // Login attempts to login to the OCI registry.
 // It returns an error on failure.
 func (r *OCIChartRepository) Login(opts ...registry.LoginOption) error {
-	err := r.RegistryClient.Login(r.URL.Host, opts...)
+	err := r.limit(func() error {
+		return r.RegistryClient.Login(r.URL.Host, opts...)
+	})
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// limit calls fn while holding a slot of the connection limiter.
+func (r *OCIChartRepository) limit(fn func() error) error {
+	release, err := r.connectionLimiter.Acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn()
+}
+
 // Logout attempts to logout from the OCI registry.
 // It returns an error on failure.
 func (r *OCIChartRepository) Logout() error {
@@ -317,8 +351,11 @@ func getLastMatchingVersionOrConstraint(cvs []string, ver string) (string, error
 		return "", fmt.Errorf("could not locate a version matching provided version string %s", ver)
 	}
 
-	// Sort versions
-	sort.Sort(sort.Reverse(semver.Collection(matchingVersions)))
+	// Sort versions, breaking ties between versions with equal precedence
+	// by their build metadata.
+	sort.SliceStable(matchingVersions, func(i, j int) bool {
+		return compareVersions(matchingVersions[i], matchingVersions[j]) > 0
+	})
 
 	return matchingVersions[0].Original(), nil
 }
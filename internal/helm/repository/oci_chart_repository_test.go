@@ -106,6 +106,9 @@ func TestOCIChartRepository_Get(t *testing.T) {
 			"0.10.0",
 			"1.0.0",
 			"1.1.0-rc.1",
+			"0.3.0+build.9",
+			"0.3.0+build.100",
+			"0.3.0+build.45",
 		},
 	}
 
@@ -167,6 +170,13 @@ func TestOCIChartRepository_Get(t *testing.T) {
 			url:            testURL,
 			expected:       "0.10.0",
 		},
+		{
+			name:           "should return highest build metadata of 0.3.0",
+			registryClient: registryClient,
+			version:        "~0.3.0",
+			url:            testURL,
+			expected:       "0.3.0+build.100",
+		},
 		{
 			name:           "should an error for unfulfilled range",
 			registryClient: registryClient,
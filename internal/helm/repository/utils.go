@@ -19,8 +19,10 @@ package repository
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	helmreg "helm.sh/helm/v3/pkg/registry"
 )
 
@@ -69,3 +71,64 @@ func ValidateDepURL(repositoryURL string) error {
 		return fmt.Errorf("%w: %s", errInvalidDepURL, repositoryURL)
 	}
 }
+
+// compareVersions compares the given versions by semver precedence, and breaks
+// ties using compareBuildMetadata. It returns -1 if a is lower than b, 1 if a
+// is higher than b, or 0 if they are equal.
+func compareVersions(a, b *semver.Version) int {
+	if c := a.Compare(b); c != 0 {
+		return c
+	}
+	return compareBuildMetadata(a.Metadata(), b.Metadata())
+}
+
+// compareBuildMetadata compares the given build metadata strings, which are
+// not considered in semver precedence. The dot separated identifiers are
+// compared from left to right, numerically if both identifiers are numeric and
+// lexically otherwise, with numeric identifiers being lower than
+// alphanumeric ones. When all compared identifiers are equal, the metadata
+// with more identifiers is higher. It returns -1 if a is lower than b, 1 if a
+// is higher than b, or 0 if they are equal.
+func compareBuildMetadata(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return -1
+	}
+	if b == "" {
+		return 1
+	}
+
+	aIDs, bIDs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		aNum, aErr := strconv.ParseUint(aIDs[i], 10, 64)
+		bNum, bErr := strconv.ParseUint(bIDs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				if aNum < bNum {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(aIDs[i], bIDs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	switch {
+	case len(aIDs) < len(bIDs):
+		return -1
+	case len(aIDs) > len(bIDs):
+		return 1
+	default:
+		return 0
+	}
+}
@@ -90,3 +90,29 @@ func TestNormalizeURL(t *testing.T) {
 		})
 	}
 }
+
+func Test_compareBuildMetadata(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "", b: "build.1", want: -1},
+		{a: "build.1", b: "", want: 1},
+		{a: "build.1", b: "build.1", want: 0},
+		{a: "build.9", b: "build.45", want: -1},
+		{a: "build.100", b: "build.45", want: 1},
+		{a: "build.45", b: "build.45.1", want: -1},
+		{a: "a", b: "b", want: -1},
+		{a: "2", b: "a", want: -1},
+		{a: "b", b: "10", want: 1},
+		{a: "20230101.1", b: "20221231.9", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(compareBuildMetadata(tt.a, tt.b)).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package latency provides sliding-window percentiles of the reconcile
+// latency per kind of Source, exposed as Prometheus gauges.
+package latency
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// DefaultWindowSize is the default number of most recent reconcile
+// durations per kind the percentiles are computed over.
+const DefaultWindowSize = 100
+
+// Quantiles are the quantiles which are reported for every kind.
+var Quantiles = []float64{0.5, 0.95, 0.99}
+
+// Recorder records reconcile durations per kind in a sliding window, and
+// reports the Quantiles of the durations in the window as gauges.
+// It is safe for concurrent use. A nil Recorder does not record anything.
+type Recorder struct {
+	// durationGauge is a gauge for the reconcile duration quantiles.
+	durationGauge *prometheus.GaugeVec
+
+	windowSize int
+	windows    map[string]*window
+	mu         sync.Mutex
+}
+
+// window is a ring buffer of the most recent durations.
+type window struct {
+	durations []time.Duration
+	next      int
+}
+
+// add adds the given duration to the window, replacing the oldest duration
+// when the window is full.
+func (w *window) add(d time.Duration, size int) {
+	if len(w.durations) < size {
+		w.durations = append(w.durations, d)
+		return
+	}
+	w.durations[w.next] = d
+	w.next = (w.next + 1) % size
+}
+
+// NewRecorder returns a new Recorder which computes the percentiles over the
+// given number of most recent durations per kind. When windowSize is zero or
+// negative, DefaultWindowSize is used.
+// The configured labels are: kind, quantile.
+func NewRecorder(windowSize int) *Recorder {
+	if windowSize <= 0 {
+		windowSize = DefaultWindowSize
+	}
+	return &Recorder{
+		durationGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gotk_reconcile_duration_quantile_seconds",
+				Help: "The quantiles of the duration in seconds of the most recent reconciliations of a Gitops Toolkit resource kind.",
+			},
+			[]string{"kind", "quantile"},
+		),
+		windowSize: windowSize,
+		windows:    make(map[string]*window),
+	}
+}
+
+// Collectors returns the metrics.Collector objects for the Recorder.
+func (r *Recorder) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		r.durationGauge,
+	}
+}
+
+// Observe records the duration of a reconciliation of the given kind, and
+// updates the quantile gauges of the kind.
+func (r *Recorder) Observe(kind string, d time.Duration) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.windows[kind]
+	if !ok {
+		w = &window{}
+		r.windows[kind] = w
+	}
+	w.add(d, r.windowSize)
+
+	for q, v := range percentiles(w.durations, Quantiles) {
+		r.durationGauge.WithLabelValues(kind, strconv.FormatFloat(q, 'f', -1, 64)).Set(v.Seconds())
+	}
+}
+
+// Percentiles returns the Quantiles of the durations in the window of the
+// given kind, and if any durations were recorded for it.
+func (r *Recorder) Percentiles(kind string) (map[float64]time.Duration, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.windows[kind]
+	if !ok {
+		return nil, false
+	}
+	return percentiles(w.durations, Quantiles), true
+}
+
+// percentiles returns the given quantiles of the durations using the
+// nearest-rank method. The given durations are not modified.
+func percentiles(durations []time.Duration, quantiles []float64) map[float64]time.Duration {
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	result := make(map[float64]time.Duration, len(quantiles))
+	if len(sorted) == 0 {
+		return result
+	}
+	for _, q := range quantiles {
+		rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		if rank >= len(sorted) {
+			rank = len(sorted) - 1
+		}
+		result[q] = sorted[rank]
+	}
+	return result
+}
+
+// MustMakeMetrics creates a new Recorder with the given window size, and registers the metrics collectors in the
+// controller-runtime metrics registry.
+func MustMakeMetrics(windowSize int) *Recorder {
+	r := NewRecorder(windowSize)
+	metrics.Registry.MustRegister(r.Collectors()...)
+
+	return r
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package latency
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecorder_Observe(t *testing.T) {
+	t.Run("reports approximate percentiles", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewRecorder(1000)
+		for _, i := range rand.Perm(1000) {
+			r.Observe("GitRepository", time.Duration(i+1)*time.Millisecond)
+		}
+
+		p, ok := r.Percentiles("GitRepository")
+		g.Expect(ok).To(BeTrue())
+		g.Expect(p[0.5]).To(BeNumerically("~", 500*time.Millisecond, 5*time.Millisecond))
+		g.Expect(p[0.95]).To(BeNumerically("~", 950*time.Millisecond, 5*time.Millisecond))
+		g.Expect(p[0.99]).To(BeNumerically("~", 990*time.Millisecond, 5*time.Millisecond))
+
+		g.Expect(testutil.ToFloat64(r.durationGauge.WithLabelValues("GitRepository", "0.5"))).To(BeNumerically("~", 0.5, 0.005))
+		g.Expect(testutil.ToFloat64(r.durationGauge.WithLabelValues("GitRepository", "0.95"))).To(BeNumerically("~", 0.95, 0.005))
+		g.Expect(testutil.ToFloat64(r.durationGauge.WithLabelValues("GitRepository", "0.99"))).To(BeNumerically("~", 0.99, 0.005))
+	})
+
+	t.Run("slides window", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewRecorder(10)
+		for i := 0; i < 10; i++ {
+			r.Observe("Bucket", time.Hour)
+		}
+		for i := 0; i < 10; i++ {
+			r.Observe("Bucket", time.Second)
+		}
+
+		p, _ := r.Percentiles("Bucket")
+		g.Expect(p[0.99]).To(Equal(time.Second))
+	})
+
+	t.Run("records kinds separately", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewRecorder(0)
+		r.Observe("HelmChart", time.Second)
+		r.Observe("HelmRepository", time.Minute)
+
+		p, _ := r.Percentiles("HelmChart")
+		g.Expect(p[0.5]).To(Equal(time.Second))
+		p, _ = r.Percentiles("HelmRepository")
+		g.Expect(p[0.5]).To(Equal(time.Minute))
+		_, ok := r.Percentiles("OCIRepository")
+		g.Expect(ok).To(BeFalse())
+	})
+
+	t.Run("nil recorder", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var r *Recorder
+		r.Observe("GitRepository", time.Second)
+		_, ok := r.Percentiles("GitRepository")
+		g.Expect(ok).To(BeFalse())
+	})
+}
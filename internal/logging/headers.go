@@ -0,0 +1,211 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logging provides helpers to configure the logger of the
+// controller.
+package logging
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// RedactedHeaderValue is the value the values of denied headers are replaced
+// with in logs.
+const RedactedHeaderValue = "REDACTED"
+
+// WithHeaderDenylist returns a logr.Logger writing to the sink of the given
+// logger, which replaces the values of the given (case-insensitive) HTTP
+// headers with RedactedHeaderValue in everything it logs. This includes
+// messages, errors and values, in which the headers are recognized when:
+//
+//   - the value is an http.Header, map[string][]string or map[string]string,
+//     or the key of the value is a denied header;
+//   - a string contains the header in HTTP wire format (e.g. "Name: value"),
+//     in Go format (e.g. "Name:[value]"), or as "Name=value".
+//
+// It returns the given logger if the denylist is empty.
+func WithHeaderDenylist(log logr.Logger, denylist []string) logr.Logger {
+	s := newHeaderScrubber(denylist)
+	sink := log.GetSink()
+	if s == nil || sink == nil {
+		return log
+	}
+	// Account for the call frame of the headerScrubSink.
+	if cd, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = cd.WithCallDepth(1)
+	}
+	return logr.New(&headerScrubSink{sink: sink, scrubber: s})
+}
+
+// headerScrubber replaces the values of the denied headers.
+type headerScrubber struct {
+	headers map[string]bool
+	// goFormat matches a denied header in the Go format of an http.Header.
+	goFormat *regexp.Regexp
+	// wireFormat matches a denied header in the HTTP wire format, or as
+	// key=value pair.
+	wireFormat *regexp.Regexp
+}
+
+func newHeaderScrubber(denylist []string) *headerScrubber {
+	var names []string
+	headers := make(map[string]bool, len(denylist))
+	for _, h := range denylist {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+		headers[http.CanonicalHeaderKey(h)] = true
+		names = append(names, regexp.QuoteMeta(h))
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	alt := strings.Join(names, "|")
+	return &headerScrubber{
+		headers:    headers,
+		goFormat:   regexp.MustCompile(`(?i)\b(` + alt + `)(\s*:\s*\[)[^\]]*`),
+		wireFormat: regexp.MustCompile(`(?i)\b(` + alt + `)(\s*:[ \t]*|=)[^\[\r\n][^\r\n]*`),
+	}
+}
+
+func (s *headerScrubber) denied(name string) bool {
+	return s.headers[http.CanonicalHeaderKey(name)]
+}
+
+func (s *headerScrubber) scrubString(v string) string {
+	v = s.goFormat.ReplaceAllString(v, "${1}${2}"+RedactedHeaderValue)
+	return s.wireFormat.ReplaceAllString(v, "${1}${2}"+RedactedHeaderValue)
+}
+
+func (s *headerScrubber) scrubValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return s.scrubString(v)
+	case error:
+		return scrubbedError{err: v, msg: s.scrubString(v.Error())}
+	case http.Header:
+		return http.Header(s.scrubHeader(v))
+	case map[string][]string:
+		return s.scrubHeader(v)
+	case map[string]string:
+		out := make(map[string]string, len(v))
+		for k, val := range v {
+			if s.denied(k) {
+				val = RedactedHeaderValue
+			}
+			out[k] = val
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func (s *headerScrubber) scrubHeader(h map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for k, vals := range h {
+		if s.denied(k) {
+			vals = []string{RedactedHeaderValue}
+		}
+		out[k] = vals
+	}
+	return out
+}
+
+func (s *headerScrubber) scrubKeysAndValues(kv []interface{}) []interface{} {
+	out := make([]interface{}, len(kv))
+	for i := range kv {
+		out[i] = kv[i]
+		if i%2 == 0 {
+			continue
+		}
+		if k, ok := kv[i-1].(string); ok && s.denied(k) {
+			out[i] = RedactedHeaderValue
+			continue
+		}
+		out[i] = s.scrubValue(kv[i])
+	}
+	return out
+}
+
+// scrubbedError is an error of which the message has been scrubbed, while
+// the underlying error is retained.
+type scrubbedError struct {
+	err error
+	msg string
+}
+
+// Error implements error interface.
+func (e scrubbedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the underlying error.
+func (e scrubbedError) Unwrap() error {
+	return e.err
+}
+
+// headerScrubSink is a logr.LogSink which scrubs the denied headers from
+// everything it writes to the underlying sink.
+type headerScrubSink struct {
+	sink     logr.LogSink
+	scrubber *headerScrubber
+}
+
+// Init implements logr.LogSink. The underlying sink has already been
+// initialized by its logger.
+func (s *headerScrubSink) Init(logr.RuntimeInfo) {}
+
+// Enabled implements logr.LogSink.
+func (s *headerScrubSink) Enabled(level int) bool {
+	return s.sink.Enabled(level)
+}
+
+// Info implements logr.LogSink.
+func (s *headerScrubSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.sink.Info(level, s.scrubber.scrubString(msg), s.scrubber.scrubKeysAndValues(keysAndValues)...)
+}
+
+// Error implements logr.LogSink.
+func (s *headerScrubSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if err != nil {
+		err = scrubbedError{err: err, msg: s.scrubber.scrubString(err.Error())}
+	}
+	s.sink.Error(err, s.scrubber.scrubString(msg), s.scrubber.scrubKeysAndValues(keysAndValues)...)
+}
+
+// WithValues implements logr.LogSink.
+func (s *headerScrubSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &headerScrubSink{sink: s.sink.WithValues(s.scrubber.scrubKeysAndValues(keysAndValues)...), scrubber: s.scrubber}
+}
+
+// WithName implements logr.LogSink.
+func (s *headerScrubSink) WithName(name string) logr.LogSink {
+	return &headerScrubSink{sink: s.sink.WithName(name), scrubber: s.scrubber}
+}
+
+// WithCallDepth implements logr.CallDepthLogSink, if the underlying sink
+// does.
+func (s *headerScrubSink) WithCallDepth(depth int) logr.LogSink {
+	if sink, ok := s.sink.(logr.CallDepthLogSink); ok {
+		return &headerScrubSink{sink: sink.WithCallDepth(depth), scrubber: s.scrubber}
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/gomega"
+)
+
+func TestWithHeaderDenylist(t *testing.T) {
+	const secret = "s3cr3t-value"
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+secret)
+	header.Set("X-Api-Key", secret)
+	header.Set("Accept", "application/json")
+
+	tests := []struct {
+		name string
+		log  func(log logr.Logger)
+		want []string
+	}{
+		{
+			name: "http.Header value",
+			log: func(log logr.Logger) {
+				log.V(1).Info("sending request", "headers", header)
+			},
+			want: []string{`"Authorization":["REDACTED"]`, `"X-Api-Key":["REDACTED"]`, `"Accept":["application/json"]`},
+		},
+		{
+			name: "map values",
+			log: func(log logr.Logger) {
+				log.V(1).Info("sending request",
+					"headers", map[string]string{"x-api-key": secret, "accept": "application/json"},
+					"values", map[string][]string{"authorization": {secret}})
+			},
+			want: []string{`"x-api-key":"REDACTED"`, `"accept":"application/json"`, `"authorization":["REDACTED"]`},
+		},
+		{
+			name: "header as key",
+			log: func(log logr.Logger) {
+				log.V(1).WithValues("X-API-KEY", secret).Info("sending request")
+			},
+			want: []string{`"X-API-KEY"="REDACTED"`},
+		},
+		{
+			name: "wire format in message and value",
+			log: func(log logr.Logger) {
+				log.V(1).Info("GET /index.yaml HTTP/1.1\r\nX-Api-Key: "+secret+"\r\nAccept: */*",
+					"dump", "Authorization: Bearer "+secret)
+			},
+			want: []string{`X-Api-Key: REDACTED\r\nAccept: */*`, `"dump"="Authorization: REDACTED"`},
+		},
+		{
+			name: "Go format and key value pairs in error",
+			log: func(log logr.Logger) {
+				err := fmt.Errorf("request failed with headers %v: %w", header, errors.New("x-api-key="+secret))
+				log.Error(err, "failed")
+			},
+			want: []string{`Authorization:[REDACTED]`, `X-Api-Key:[REDACTED]`, `Accept:[application/json]`, `x-api-key=REDACTED`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var out strings.Builder
+			log := funcr.New(func(prefix, args string) {
+				out.WriteString(args + "\n")
+			}, funcr.Options{Verbosity: 1})
+
+			tt.log(WithHeaderDenylist(log, []string{"authorization", " X-Api-Key "}))
+			g.Expect(out.String()).ToNot(BeEmpty())
+			g.Expect(out.String()).ToNot(ContainSubstring(secret))
+			for _, w := range tt.want {
+				g.Expect(out.String()).To(ContainSubstring(w))
+			}
+		})
+	}
+}
+
+func TestWithHeaderDenylist_empty(t *testing.T) {
+	g := NewWithT(t)
+
+	log := funcr.New(func(prefix, args string) {}, funcr.Options{})
+	g.Expect(WithHeaderDenylist(log, nil)).To(Equal(log))
+	g.Expect(WithHeaderDenylist(log, []string{" "})).To(Equal(log))
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mirror provides health tracking for equivalent (mirrored) source
+// URLs, allowing reconcilers to prefer the healthiest of them.
+package mirror
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailureCooldown is the default duration after which a failure
+	// of a URL is no longer taken into account.
+	DefaultFailureCooldown = 5 * time.Minute
+
+	// latencyWeight is the weight of a new latency observation in the
+	// exponentially weighted moving average.
+	latencyWeight = 0.3
+)
+
+// Health contains the health observations of a URL.
+type Health struct {
+	// Latency is the exponentially weighted moving average of the latency of
+	// successful requests.
+	Latency time.Duration
+	// Failures is the number of consecutive failed requests.
+	Failures int
+	// LastFailure is the time of the last failed request.
+	LastFailure time.Time
+}
+
+// Tracker keeps track of the Health of URLs, and ranks them accordingly.
+// It is safe for concurrent use. A nil Tracker does not track anything, and
+// ranks URLs in the order they are given.
+type Tracker struct {
+	// FailureCooldown is the duration after which a failure of a URL is no
+	// longer taken into account when ranking.
+	FailureCooldown time.Duration
+
+	health map[string]*Health
+	now    func() time.Time
+	mu     sync.RWMutex
+}
+
+// NewTracker returns a new Tracker with the DefaultFailureCooldown.
+func NewTracker() *Tracker {
+	return &Tracker{
+		FailureCooldown: DefaultFailureCooldown,
+		health:          make(map[string]*Health),
+		now:             time.Now,
+	}
+}
+
+// Observe records the result of a request to the given URL, which took the
+// given latency and resulted in err.
+func (t *Tracker) Observe(url string, latency time.Duration, err error) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.health[url]
+	if !ok {
+		h = &Health{}
+		t.health[url] = h
+	}
+
+	if err != nil {
+		h.Failures++
+		h.LastFailure = t.now()
+		return
+	}
+
+	h.Failures = 0
+	if h.Latency == 0 {
+		h.Latency = latency
+		return
+	}
+	h.Latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(h.Latency))
+}
+
+// Get returns the Health of the given URL, and if any observations were
+// recorded for it.
+func (t *Tracker) Get(url string) (Health, bool) {
+	if t == nil {
+		return Health{}, false
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	h, ok := t.health[url]
+	if !ok {
+		return Health{}, false
+	}
+	return *h, true
+}
+
+// Rank returns a copy of the given URLs, ordered from most to least healthy.
+//
+// URLs with recent failures are ranked last, ordered by their number of
+// consecutive failures. The others are ordered by latency, with URLs without
+// observations ranked first so that their health is determined. URLs with
+// equal health keep their relative order.
+func (t *Tracker) Rank(urls []string) []string {
+	ranked := make([]string, len(urls))
+	copy(ranked, urls)
+	if t == nil || len(ranked) < 2 {
+		return ranked
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	now := t.now()
+	failures := func(url string) int {
+		if h, ok := t.health[url]; ok && h.Failures > 0 && now.Sub(h.LastFailure) < t.FailureCooldown {
+			return h.Failures
+		}
+		return 0
+	}
+	latency := func(url string) time.Duration {
+		if h, ok := t.health[url]; ok {
+			return h.Latency
+		}
+		return 0
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if fi, fj := failures(ranked[i]), failures(ranked[j]); fi != fj {
+			return fi < fj
+		}
+		return latency(ranked[i]) < latency(ranked[j])
+	})
+	return ranked
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mirror
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+const (
+	primary  = "https://charts.example.com"
+	mirror1  = "https://mirror-1.example.com"
+	mirror2  = "https://mirror-2.example.com"
+	errFetch = "fetch failed"
+)
+
+func TestTracker_Observe(t *testing.T) {
+	t.Run("records latency as moving average", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tr := NewTracker()
+		tr.Observe(primary, 100*time.Millisecond, nil)
+		h, ok := tr.Get(primary)
+		g.Expect(ok).To(BeTrue())
+		g.Expect(h.Latency).To(Equal(100 * time.Millisecond))
+
+		tr.Observe(primary, 200*time.Millisecond, nil)
+		h, _ = tr.Get(primary)
+		g.Expect(h.Latency).To(Equal(130 * time.Millisecond))
+	})
+
+	t.Run("records consecutive failures", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tr := NewTracker()
+		tr.Observe(primary, time.Millisecond, errors.New(errFetch))
+		tr.Observe(primary, time.Millisecond, errors.New(errFetch))
+		h, _ := tr.Get(primary)
+		g.Expect(h.Failures).To(Equal(2))
+		g.Expect(h.LastFailure).ToNot(BeZero())
+
+		tr.Observe(primary, time.Millisecond, nil)
+		h, _ = tr.Get(primary)
+		g.Expect(h.Failures).To(BeZero())
+	})
+
+	t.Run("nil tracker", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var tr *Tracker
+		tr.Observe(primary, time.Millisecond, nil)
+		_, ok := tr.Get(primary)
+		g.Expect(ok).To(BeFalse())
+	})
+}
+
+func TestTracker_Rank(t *testing.T) {
+	urls := []string{primary, mirror1, mirror2}
+
+	t.Run("keeps order without observations", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(NewTracker().Rank(urls)).To(Equal(urls))
+
+		var tr *Tracker
+		g.Expect(tr.Rank(urls)).To(Equal(urls))
+	})
+
+	t.Run("prefers lowest latency", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tr := NewTracker()
+		tr.Observe(primary, 300*time.Millisecond, nil)
+		tr.Observe(mirror1, 100*time.Millisecond, nil)
+		tr.Observe(mirror2, 200*time.Millisecond, nil)
+		g.Expect(tr.Rank(urls)).To(Equal([]string{mirror1, mirror2, primary}))
+	})
+
+	t.Run("shifts away from degrading URL", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tr := NewTracker()
+		tr.Observe(primary, 10*time.Millisecond, nil)
+		tr.Observe(mirror1, 50*time.Millisecond, nil)
+		tr.Observe(mirror2, 80*time.Millisecond, nil)
+		g.Expect(tr.Rank(urls)[0]).To(Equal(primary))
+
+		// Latency degradation.
+		tr.Observe(primary, 500*time.Millisecond, nil)
+		g.Expect(tr.Rank(urls)[0]).To(Equal(mirror1))
+
+		// Failure of the next preferred URL.
+		tr.Observe(mirror1, time.Millisecond, errors.New(errFetch))
+		g.Expect(tr.Rank(urls)).To(Equal([]string{mirror2, primary, mirror1}))
+
+		// More failures rank lower.
+		tr.Observe(primary, time.Millisecond, errors.New(errFetch))
+		tr.Observe(primary, time.Millisecond, errors.New(errFetch))
+		g.Expect(tr.Rank(urls)).To(Equal([]string{mirror2, mirror1, primary}))
+	})
+
+	t.Run("ignores failures after cooldown", func(t *testing.T) {
+		g := NewWithT(t)
+
+		now := time.Now()
+		tr := NewTracker()
+		tr.now = func() time.Time { return now }
+		tr.Observe(primary, time.Millisecond, errors.New(errFetch))
+		g.Expect(tr.Rank(urls)).To(Equal([]string{mirror1, mirror2, primary}))
+
+		tr.now = func() time.Time { return now.Add(DefaultFailureCooldown) }
+		g.Expect(tr.Rank(urls)).To(Equal(urls))
+	})
+
+	t.Run("does not modify given URLs", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tr := NewTracker()
+		tr.Observe(primary, time.Millisecond, errors.New(errFetch))
+		given := []string{primary, mirror1}
+		_ = tr.Rank(given)
+		g.Expect(given).To(Equal([]string{primary, mirror1}))
+	})
+}
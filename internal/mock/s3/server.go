@@ -24,7 +24,9 @@ import (
 	"net/http/httptest"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -38,13 +40,16 @@ type Object struct {
 
 // Server is a simple AWS S3 mock server.
 // It serves the provided Objects for the BucketName on the HTTPAddress when
-// Start or StartTLS is called.
+// Start or StartTLS is called. Object listings are paginated according to
+// the requested max-keys.
 type Server struct {
 	srv *httptest.Server
 	mux *http.ServeMux
 
 	BucketName string
 	Objects    []*Object
+
+	listRequests int32
 }
 
 func NewServer(bucketName string) *Server {
@@ -74,6 +79,11 @@ func (s *Server) HTTPAddress() string {
 	return s.srv.URL
 }
 
+// ListRequests returns the number of object listing pages served.
+func (s *Server) ListRequests() int {
+	return int(atomic.LoadInt32(&s.listRequests))
+}
+
 func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 	key := path.Base(r.URL.Path)
 
@@ -95,8 +105,29 @@ func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		atomic.AddInt32(&s.listRequests, 1)
+
+		maxKeys := 1000
+		if v, err := strconv.Atoi(r.URL.Query().Get("max-keys")); err == nil && v > 0 {
+			maxKeys = v
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+		if start > len(s.Objects) {
+			start = len(s.Objects)
+		}
+		end := start + maxKeys
+		if end > len(s.Objects) {
+			end = len(s.Objects)
+		}
+		page := s.Objects[start:end]
+		truncated := end < len(s.Objects)
+		var nextToken string
+		if truncated {
+			nextToken = strconv.Itoa(end)
+		}
+
 		contents := ""
-		for _, o := range s.Objects {
+		for _, o := range page {
 			etag := md5.Sum(o.Content)
 			contents += fmt.Sprintf(`
 		<Contents>
@@ -115,11 +146,12 @@ func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 	<Prefix/>
 	<Marker/>
 	<KeyCount>%d</KeyCount>
-	<MaxKeys>1000</MaxKeys>
-	<IsTruncated>false</IsTruncated>
+	<MaxKeys>%d</MaxKeys>
+	<IsTruncated>%t</IsTruncated>
+	<NextContinuationToken>%s</NextContinuationToken>
 	%s
 </ListBucketResult>
-		`, s.BucketName, len(s.Objects), contents)
+		`, s.BucketName, len(page), maxKeys, truncated, nextToken, contents)
 	default:
 		key, err := filepath.Rel("/"+s.BucketName, r.URL.Path)
 		if err != nil {
@@ -19,7 +19,9 @@ package oci
 import (
 	"context"
 	"crypto"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/sigstore/cosign/cmd/cosign/cli/fulcio"
@@ -41,8 +43,9 @@ type Verifier interface {
 
 // options is a struct that holds options for verifier.
 type options struct {
-	PublicKey []byte
-	ROpt      []remote.Option
+	PublicKey  []byte
+	ROpt       []remote.Option
+	Identities []cosign.Identity
 }
 
 // Options is a function that configures the options applied to a Verifier.
@@ -63,9 +66,22 @@ func WithRemoteOptions(opts ...remote.Option) Options {
 	}
 }
 
+// WithIdentities sets the identities of which the certificate of a keyless
+// signature must match at least one. It is ignored when a public key is set.
+func WithIdentities(identities ...cosign.Identity) Options {
+	return func(o *options) {
+		o.Identities = identities
+	}
+}
+
+// ErrNoMatchingIdentity is returned by CosignVerifier.Verify when none of the
+// certificates of the verified signatures match any of the expected identities.
+var ErrNoMatchingIdentity = errors.New("signature certificate does not match any of the expected identities")
+
 // CosignVerifier is a struct which is responsible for executing verification logic.
 type CosignVerifier struct {
-	opts *cosign.CheckOpts
+	opts       *cosign.CheckOpts
+	identities []cosign.Identity
 }
 
 // NewCosignVerifier initializes a new CosignVerifier.
@@ -122,9 +138,13 @@ func NewCosignVerifier(ctx context.Context, opts ...Options) (*CosignVerifier, e
 		checkOpts.RekorClient = rc
 	}
 
-	return &CosignVerifier{
+	v := &CosignVerifier{
 		opts: checkOpts,
-	}, nil
+	}
+	if len(o.PublicKey) == 0 {
+		v.identities = o.Identities
+	}
+	return v, nil
 }
 
 // VerifyImageSignatures verify the authenticity of the given ref OCI image.
@@ -145,5 +165,54 @@ func (v *CosignVerifier) Verify(ctx context.Context, ref name.Reference) (bool,
 		return false, nil
 	}
 
+	if len(v.identities) > 0 {
+		if err := matchIdentities(signatures, v.identities); err != nil {
+			return false, err
+		}
+	}
+
 	return true, nil
 }
+
+// matchIdentities returns nil if the certificate of any of the given
+// signatures matches any of the given identities, or an error wrapping
+// ErrNoMatchingIdentity.
+func matchIdentities(signatures []oci.Signature, identities []cosign.Identity) error {
+	co := &cosign.CheckOpts{Identities: identities}
+	for _, sig := range signatures {
+		cert, err := sig.Cert()
+		if err != nil || cert == nil {
+			continue
+		}
+		if err := cosign.CheckCertificatePolicy(cert, co); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %s", ErrNoMatchingIdentity, describeIdentities(identities))
+}
+
+// describeIdentities returns a human-readable description of the given
+// identities, e.g. "[issuer 'https://example.com' and subject 'user']".
+func describeIdentities(identities []cosign.Identity) string {
+	descriptions := make([]string, 0, len(identities))
+	for _, id := range identities {
+		var constraints []string
+		switch {
+		case id.IssuerRegExp != "":
+			constraints = append(constraints, fmt.Sprintf("issuer matching '%s'", id.IssuerRegExp))
+		case id.Issuer != "":
+			constraints = append(constraints, fmt.Sprintf("issuer '%s'", id.Issuer))
+		}
+		switch {
+		case id.SubjectRegExp != "":
+			constraints = append(constraints, fmt.Sprintf("subject matching '%s'", id.SubjectRegExp))
+		case id.Subject != "":
+			constraints = append(constraints, fmt.Sprintf("subject '%s'", id.Subject))
+		}
+		if len(constraints) == 0 {
+			constraints = append(constraints, "any identity")
+		}
+		descriptions = append(descriptions, strings.Join(constraints, " and "))
+	}
+	return "[" + strings.Join(descriptions, ", ") + "]"
+}
@@ -17,12 +17,25 @@ limitations under the License.
 package oci
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/oci"
+	"github.com/sigstore/cosign/pkg/oci/static"
 )
 
 func TestOptions(t *testing.T) {
@@ -75,6 +88,12 @@ func TestOptions(t *testing.T) {
 				remote.WithTransport(http.DefaultTransport),
 			},
 		},
+	}, {
+		name: "identities option",
+		opts: []Options{WithIdentities(cosign.Identity{Issuer: "https://example.com", Subject: "foo"})},
+		want: &options{
+			Identities: []cosign.Identity{{Issuer: "https://example.com", Subject: "foo"}},
+		},
 	},
 	}
 
@@ -87,6 +106,9 @@ func TestOptions(t *testing.T) {
 			if !reflect.DeepEqual(o.PublicKey, test.want.PublicKey) {
 				t.Errorf("got %#v, want %#v", &o.PublicKey, test.want.PublicKey)
 			}
+			if !reflect.DeepEqual(o.Identities, test.want.Identities) {
+				t.Errorf("got %#v, want %#v", o.Identities, test.want.Identities)
+			}
 
 			if test.want.ROpt != nil {
 				if len(o.ROpt) != len(test.want.ROpt) {
@@ -103,3 +125,92 @@ func TestOptions(t *testing.T) {
 		})
 	}
 }
+
+func Test_describeIdentities(t *testing.T) {
+	tests := []struct {
+		name       string
+		identities []cosign.Identity
+		want       string
+	}{
+		{
+			name:       "issuer and subject",
+			identities: []cosign.Identity{{Issuer: "https://example.com", Subject: "foo"}},
+			want:       "[issuer 'https://example.com' and subject 'foo']",
+		},
+		{
+			name:       "regular expressions take precedence",
+			identities: []cosign.Identity{{Issuer: "https://example.com", IssuerRegExp: "^https://", SubjectRegExp: "^foo"}},
+			want:       "[issuer matching '^https://' and subject matching '^foo']",
+		},
+		{
+			name:       "multiple identities",
+			identities: []cosign.Identity{{Subject: "foo"}, {}},
+			want:       "[subject 'foo', any identity]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeIdentities(tt.identities); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_matchIdentities(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: "sigstore"},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		EmailAddresses: []string{"foo@example.com"},
+		ExtraExtensions: []pkix.Extension{{
+			// OIDC issuer extension of Fulcio certificates
+			Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1},
+			Value: []byte("https://example.com"),
+		}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := static.NewSignature(nil, "", static.WithCertChain(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		identities []cosign.Identity
+		wantErr    bool
+	}{
+		{
+			name:       "matching identity",
+			identities: []cosign.Identity{{Issuer: "https://example.com", Subject: "foo@example.com"}},
+		},
+		{
+			name:       "any matching identity",
+			identities: []cosign.Identity{{Subject: "bar@example.com"}, {SubjectRegExp: "^foo@"}},
+		},
+		{
+			name:       "no matching identity",
+			identities: []cosign.Identity{{Issuer: "https://example.com", Subject: "bar@example.com"}},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := matchIdentities([]oci.Signature{sig}, tt.identities)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr && !errors.Is(err, ErrNoMatchingIdentity) {
+				t.Errorf("expected error to wrap ErrNoMatchingIdentity, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package predicates
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+func TestAnnotationChangedPredicate_Update(t *testing.T) {
+	const annotation = "example.com/annotation"
+
+	withAnnotations := func(annotations map[string]string) *sourcev1.GitRepository {
+		return &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+	}
+
+	tests := []struct {
+		name string
+		old  client.Object
+		new  client.Object
+		want bool
+	}{
+		{name: "no annotations", old: withAnnotations(nil), new: withAnnotations(nil), want: false},
+		{name: "added", old: withAnnotations(nil), new: withAnnotations(map[string]string{annotation: "foo"}), want: true},
+		{name: "added empty", old: withAnnotations(nil), new: withAnnotations(map[string]string{annotation: ""}), want: true},
+		{name: "changed", old: withAnnotations(map[string]string{annotation: "foo"}), new: withAnnotations(map[string]string{annotation: "bar"}), want: true},
+		{name: "unchanged", old: withAnnotations(map[string]string{annotation: "foo"}), new: withAnnotations(map[string]string{annotation: "foo"}), want: false},
+		{name: "removed", old: withAnnotations(map[string]string{annotation: "foo"}), new: withAnnotations(nil), want: true},
+		{name: "other annotation changed", old: withAnnotations(map[string]string{"other": "foo"}), new: withAnnotations(map[string]string{"other": "bar"}), want: false},
+		{name: "old nil", old: nil, new: withAnnotations(nil), want: false},
+		{name: "new nil", old: withAnnotations(nil), new: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := gomega.NewWithT(t)
+
+			p := AnnotationChangedPredicate{Annotation: annotation}
+			g.Expect(p.Update(event.UpdateEvent{ObjectOld: tt.old, ObjectNew: tt.new})).To(gomega.Equal(tt.want))
+		})
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/fluxcd/pkg/runtime/conditions"
 	"github.com/fluxcd/pkg/runtime/patch"
 
+	serror "github.com/fluxcd/source-controller/internal/error"
 	"github.com/fluxcd/source-controller/internal/reconcile"
 )
 
@@ -202,6 +203,10 @@ func (h *Helper) SummarizeAndPatch(ctx context.Context, obj conditions.Setter, o
 		patchOpts = append(patchOpts, pOpts...)
 	}
 
+	// Redact any credentials from the condition messages before they are
+	// summarized and persisted in the status of the object.
+	sanitizeConditions(obj)
+
 	// Summarize conditions. This must be performed only after computing the
 	// reconcile result, since the object status is adjusted based on the
 	// reconcile result and error.
@@ -261,6 +266,16 @@ func (h *Helper) SummarizeAndPatch(ctx context.Context, obj conditions.Setter, o
 	return result, recErr
 }
 
+// sanitizeConditions redacts known credential patterns from the messages of
+// all the conditions of the given object, using serror.SanitizeString.
+func sanitizeConditions(obj conditions.Setter) {
+	conds := obj.GetConditions()
+	for i := range conds {
+		conds[i].Message = serror.SanitizeString(conds[i].Message)
+	}
+	obj.SetConditions(conds)
+}
+
 // isNonStalledSuccess checks if the reconciliation was successful and has not
 // resulted in stalled situation.
 func isNonStalledSuccess(obj conditions.Setter, rb reconcile.RuntimeResultBuilder, result ctrl.Result, recErr error) bool {
@@ -0,0 +1,137 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sourcemetrics provides Prometheus metrics of the reconciliations
+// of sources: the reconcile duration and fetch failures per kind, and the
+// size of the current Artifact per object.
+package sourcemetrics
+
+import (
+	"time"
+
+	"github.com/fluxcd/pkg/runtime/conditions"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+const (
+	// ResultSuccess is the result label value of a reconciliation which did
+	// not return an error.
+	ResultSuccess = "success"
+	// ResultFailure is the result label value of a reconciliation which
+	// returned an error.
+	ResultFailure = "failure"
+)
+
+// Object is a source of which the reconciliation is recorded.
+type Object interface {
+	client.Object
+	conditions.Getter
+	GetArtifact() *sourcev1.Artifact
+}
+
+// Recorder records the metrics of the reconciliations of sources.
+// It is safe for concurrent use. A nil Recorder does not record anything.
+type Recorder struct {
+	// durationHistogram is a histogram of the reconcile durations.
+	durationHistogram *prometheus.HistogramVec
+	// artifactSizeGauge is a gauge of the size of the current Artifact.
+	artifactSizeGauge *prometheus.GaugeVec
+	// fetchFailuresCounter is a counter of the fetch failures.
+	fetchFailuresCounter *prometheus.CounterVec
+}
+
+// NewRecorder returns a new Recorder.
+// The configured labels are:
+//   - kind, result for the reconcile duration, where the result is either
+//     ResultSuccess or ResultFailure;
+//   - kind, name, namespace for the Artifact size;
+//   - kind, reason for the fetch failures, where the reason is the reason of
+//     the FetchFailed Condition.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		durationHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "gotk_source_reconcile_duration_seconds",
+				Help:    "The duration in seconds of the reconciliations of a Gitops Toolkit source kind.",
+				Buckets: prometheus.ExponentialBuckets(0.05, 2, 12),
+			},
+			[]string{"kind", "result"},
+		),
+		artifactSizeGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gotk_source_artifact_size_bytes",
+				Help: "The size in bytes of the current Artifact of a Gitops Toolkit source.",
+			},
+			[]string{"kind", "name", "namespace"},
+		),
+		fetchFailuresCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gotk_source_fetch_failures_total",
+				Help: "Total number of reconciliations of a Gitops Toolkit source kind which failed to fetch the source.",
+			},
+			[]string{"kind", "reason"},
+		),
+	}
+}
+
+// Collectors returns the metrics.Collector objects for the Recorder.
+func (r *Recorder) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		r.durationHistogram,
+		r.artifactSizeGauge,
+		r.fetchFailuresCounter,
+	}
+}
+
+// Record records a reconciliation of the given kind and object, which took
+// the given duration and returned the given error. It observes the duration,
+// sets the Artifact size of the object, and counts a fetch failure if the
+// object has a FetchFailed Condition with status True.
+// The Artifact size is removed once the object is being deleted, or does not
+// have an Artifact of which the size is known.
+func (r *Recorder) Record(kind string, obj Object, d time.Duration, err error) {
+	if r == nil {
+		return
+	}
+
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	r.durationHistogram.WithLabelValues(kind, result).Observe(d.Seconds())
+
+	if artifact := obj.GetArtifact(); obj.GetDeletionTimestamp().IsZero() && artifact != nil && artifact.Size != nil {
+		r.artifactSizeGauge.WithLabelValues(kind, obj.GetName(), obj.GetNamespace()).Set(float64(*artifact.Size))
+	} else {
+		r.artifactSizeGauge.DeleteLabelValues(kind, obj.GetName(), obj.GetNamespace())
+	}
+
+	if conditions.IsTrue(obj, sourcev1.FetchFailedCondition) {
+		r.fetchFailuresCounter.WithLabelValues(kind, conditions.GetReason(obj, sourcev1.FetchFailedCondition)).Inc()
+	}
+}
+
+// MustMakeMetrics creates a new Recorder, and registers the metrics collectors in the controller-runtime metrics registry.
+func MustMakeMetrics() *Recorder {
+	r := NewRecorder()
+	metrics.Registry.MustRegister(r.Collectors()...)
+
+	return r
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sourcemetrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/fluxcd/pkg/runtime/conditions"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+)
+
+func TestRecorder_Record(t *testing.T) {
+	t.Run("observes duration by kind and result", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewRecorder()
+		obj := &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		r.Record(sourcev1.GitRepositoryKind, obj, time.Second, nil)
+		r.Record(sourcev1.GitRepositoryKind, obj, time.Second, nil)
+		r.Record(sourcev1.GitRepositoryKind, obj, time.Second, errors.New("failed"))
+
+		g.Expect(testutil.CollectAndCount(r.durationHistogram, "gotk_source_reconcile_duration_seconds")).To(Equal(2))
+	})
+
+	t.Run("sets and removes artifact size", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewRecorder()
+		size := int64(1024)
+		obj := &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		obj.Status.Artifact = &sourcev1.Artifact{Size: &size}
+
+		r.Record(sourcev1.GitRepositoryKind, obj, time.Second, nil)
+		g.Expect(testutil.ToFloat64(r.artifactSizeGauge.WithLabelValues(sourcev1.GitRepositoryKind, "foo", "default"))).To(Equal(float64(1024)))
+
+		now := metav1.Now()
+		obj.DeletionTimestamp = &now
+		r.Record(sourcev1.GitRepositoryKind, obj, time.Second, nil)
+		g.Expect(testutil.CollectAndCount(r.artifactSizeGauge)).To(BeZero())
+	})
+
+	t.Run("counts fetch failures by reason", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewRecorder()
+		obj := &sourcev1.GitRepository{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		r.Record(sourcev1.GitRepositoryKind, obj, time.Second, nil)
+		g.Expect(testutil.CollectAndCount(r.fetchFailuresCounter)).To(BeZero())
+
+		conditions.MarkTrue(obj, sourcev1.FetchFailedCondition, sourcev1.AuthenticationFailedReason, "failed")
+		conditions.MarkFalse(obj, meta.ReadyCondition, sourcev1.AuthenticationFailedReason, "failed")
+		r.Record(sourcev1.GitRepositoryKind, obj, time.Second, errors.New("failed"))
+		r.Record(sourcev1.GitRepositoryKind, obj, time.Second, errors.New("failed"))
+		g.Expect(testutil.ToFloat64(r.fetchFailuresCounter.WithLabelValues(sourcev1.GitRepositoryKind, sourcev1.AuthenticationFailedReason))).To(Equal(float64(2)))
+	})
+
+	t.Run("nil recorder", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var r *Recorder
+		g.Expect(func() {
+			r.Record(sourcev1.GitRepositoryKind, &sourcev1.GitRepository{}, time.Second, nil)
+		}).ToNot(Panic())
+	})
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing provides OpenTelemetry traces of the reconciliations of
+// sources. Until Setup is called, the global no-op tracer provider is used,
+// and starting a span has a negligible cost.
+package tracing
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the instrumentation library.
+const tracerName = "github.com/fluxcd/source-controller"
+
+// Options configures the export of traces.
+type Options struct {
+	// ServiceName is the name of the service the traces are recorded for.
+	ServiceName string
+	// Endpoint is the host and port of the OTLP gRPC collector. The
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable is used when empty.
+	Endpoint string
+	// Insecure disables TLS for the connection to the collector.
+	Insecure bool
+	// SampleRatio is the fraction of the reconciliations which are traced,
+	// between 0 and 1.
+	SampleRatio float64
+}
+
+// Setup configures the global tracer provider to export traces with OTLP
+// over gRPC. The returned function flushes the pending spans and shuts down
+// the exporter.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	var exporterOpts []otlptracegrpc.Option
+	if opts.Endpoint != "" {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithEndpoint(opts.Endpoint))
+	}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+	tp := NewTracerProvider(opts.ServiceName, opts.SampleRatio, sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// NewTracerProvider returns a tracer provider recording the traces of the
+// given service, sampling the given ratio of the traces which are not part
+// of a sampled parent.
+func NewTracerProvider(serviceName string, sampleRatio float64, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	}, opts...)...)
+}
+
+// Start starts a span with the given name and attributes, as a child of the
+// span in the given context, if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartReconcile starts the root span of the reconciliation of the object
+// of the given kind, namespace and name.
+func StartReconcile(ctx context.Context, kind, namespace, name string) (context.Context, trace.Span) {
+	return Start(ctx, kind+".Reconcile",
+		attribute.String("source.kind", kind),
+		attribute.String("source.namespace", namespace),
+		attribute.String("source.name", name),
+	)
+}
+
+// StartFunc starts a span named after the given function, e.g.
+// "reconcileSource" for a method value of a reconciler.
+func StartFunc(ctx context.Context, fn interface{}) (context.Context, trace.Span) {
+	return Start(ctx, funcName(fn))
+}
+
+// End records the given error on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// funcName returns the unqualified name of the given function, without the
+// suffix of method values.
+func funcName(fn interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fakeReconciler struct{}
+
+func (r *fakeReconciler) reconcileSource(ctx context.Context) error {
+	_, span := Start(ctx, "fetchIndex")
+	End(span, nil)
+	_, span = Start(ctx, "loadIndex")
+	End(span, nil)
+	return nil
+}
+
+func (r *fakeReconciler) reconcileArtifact(_ context.Context) error {
+	return errors.New("storage failure")
+}
+
+func (r *fakeReconciler) Reconcile(ctx context.Context) (retErr error) {
+	ctx, span := StartReconcile(ctx, "HelmRepository", "default", "podinfo")
+	defer func() {
+		End(span, retErr)
+	}()
+	for _, rec := range []func(context.Context) error{r.reconcileSource, r.reconcileArtifact} {
+		recCtx, recSpan := StartFunc(ctx, rec)
+		err := rec(recCtx)
+		End(recSpan, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStart_noopProvider(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx, span := StartReconcile(context.TODO(), "GitRepository", "default", "podinfo")
+	g.Expect(ctx).ToNot(BeNil())
+	g.Expect(span.SpanContext().IsValid()).To(BeFalse())
+	End(span, errors.New("ignored"))
+}
+
+func TestReconcileSpans(t *testing.T) {
+	g := NewWithT(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := NewTracerProvider("source-controller", 1, sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+
+	r := &fakeReconciler{}
+	g.Expect(r.Reconcile(context.TODO())).To(MatchError("storage failure"))
+	g.Expect(tp.ForceFlush(context.TODO())).To(Succeed())
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub, len(spans))
+	var names []string
+	for _, s := range spans {
+		byName[s.Name] = s
+		names = append(names, s.Name)
+	}
+	g.Expect(names).To(ConsistOf("HelmRepository.Reconcile", "reconcileSource", "fetchIndex", "loadIndex", "reconcileArtifact"))
+
+	root := byName["HelmRepository.Reconcile"]
+	g.Expect(root.Parent.IsValid()).To(BeFalse())
+	g.Expect(root.Attributes).To(ContainElements(
+		attribute.String("source.kind", "HelmRepository"),
+		attribute.String("source.namespace", "default"),
+		attribute.String("source.name", "podinfo"),
+	))
+	g.Expect(root.Status.Code).To(Equal(codes.Error))
+	g.Expect(root.Resource.Attributes()).To(ContainElement(attribute.String("service.name", "source-controller")))
+
+	for _, name := range []string{"reconcileSource", "reconcileArtifact"} {
+		g.Expect(byName[name].Parent.SpanID()).To(Equal(root.SpanContext.SpanID()), name)
+	}
+	for _, name := range []string{"fetchIndex", "loadIndex"} {
+		g.Expect(byName[name].Parent.SpanID()).To(Equal(byName["reconcileSource"].SpanContext.SpanID()), name)
+	}
+	g.Expect(byName["reconcileSource"].Status.Code).To(Equal(codes.Unset))
+	g.Expect(byName["reconcileArtifact"].Status.Code).To(Equal(codes.Error))
+	g.Expect(byName["reconcileArtifact"].Events).To(HaveLen(1))
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"net/http"
+)
+
+// WithCookieJar returns an http.RoundTripper which sends the cookies stored in
+// the jar with every request sent through rt, and stores the cookies set by
+// every response in the jar. This allows a session established by any
+// response, e.g. the one of the index of a repository or a redirect, to be
+// carried by the subsequent requests of clients which do not have a cookie
+// jar of their own, such as the ones of the Helm getters.
+//
+// A nil jar returns rt as is.
+func WithCookieJar(rt http.RoundTripper, jar http.CookieJar) http.RoundTripper {
+	if jar == nil {
+		return rt
+	}
+	return &cookieRoundTripper{rt: rt, jar: jar}
+}
+
+type cookieRoundTripper struct {
+	rt  http.RoundTripper
+	jar http.CookieJar
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *cookieRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if cookies := c.jar.Cookies(req.URL); len(cookies) > 0 {
+		// The request must not be modified, send a clone with the cookies
+		// of the jar, replacing the ones of the request with the same name.
+		existing := req.Cookies()
+		req = req.Clone(req.Context())
+		req.Header.Del("Cookie")
+		names := make(map[string]bool, len(cookies))
+		for _, cookie := range cookies {
+			names[cookie.Name] = true
+			req.AddCookie(cookie)
+		}
+		for _, cookie := range existing {
+			if !names[cookie.Name] {
+				req.AddCookie(cookie)
+			}
+		}
+	}
+
+	res, err := c.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if cookies := res.Cookies(); len(cookies) > 0 {
+		c.jar.SetCookies(req.URL, cookies)
+	}
+	return res, nil
+}
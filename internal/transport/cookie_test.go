@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWithCookieJar(t *testing.T) {
+	// The server establishes a session with a redirect to the requested URL
+	// for the index, or by setting it on the response of the login, and
+	// requires the session cookie for any other request.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		c, err := r.Cookie("session")
+		if err != nil {
+			if r.URL.Path == "/index.yaml" {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+				http.Redirect(w, r, r.URL.String(), http.StatusFound)
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if c.Value != "abc" || r.Header.Get("Cookie") != "session=abc" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	get := func(g *WithT, client *http.Client, path string) *http.Response {
+		res, err := client.Get(server.URL + path)
+		g.Expect(err).ToNot(HaveOccurred())
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("carries cookies set on redirect", func(t *testing.T) {
+		g := NewWithT(t)
+
+		jar, err := cookiejar.New(nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		tr := NewOrIdle(nil)
+		defer Release(tr)
+
+		// The client has no jar, like the clients of the Helm getters.
+		client := &http.Client{Transport: WithCookieJar(tr, jar)}
+		res := get(g, client, "/index.yaml")
+		g.Expect(res.StatusCode).To(Equal(http.StatusOK))
+		g.Expect(res.Request.Response).ToNot(BeNil())
+
+		// A subsequent request carries the cookie without redirect.
+		res = get(g, client, "/charts/chart-0.1.0.tgz")
+		g.Expect(res.StatusCode).To(Equal(http.StatusOK))
+		g.Expect(res.Request.Response).To(BeNil())
+	})
+
+	t.Run("carries cookies set without redirect", func(t *testing.T) {
+		g := NewWithT(t)
+
+		jar, err := cookiejar.New(nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		tr := NewOrIdle(nil)
+		defer Release(tr)
+
+		client := &http.Client{Transport: WithCookieJar(tr, jar)}
+		g.Expect(get(g, client, "/charts/chart-0.1.0.tgz").StatusCode).To(Equal(http.StatusUnauthorized))
+		g.Expect(get(g, client, "/login").StatusCode).To(Equal(http.StatusOK))
+		g.Expect(get(g, client, "/charts/chart-0.1.0.tgz").StatusCode).To(Equal(http.StatusOK))
+	})
+
+	t.Run("replaces request cookies with the ones in the jar", func(t *testing.T) {
+		g := NewWithT(t)
+
+		jar, err := cookiejar.New(nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		tr := NewOrIdle(nil)
+		defer Release(tr)
+
+		client := &http.Client{Transport: WithCookieJar(tr, jar)}
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/charts/chart-0.1.0.tgz", nil)
+		g.Expect(err).ToNot(HaveOccurred())
+		req.AddCookie(&http.Cookie{Name: "session", Value: "expired"})
+		res, err := client.Do(req)
+		g.Expect(err).ToNot(HaveOccurred())
+		res.Body.Close()
+		g.Expect(res.StatusCode).To(Equal(http.StatusForbidden))
+
+		// Once the jar has the session, it replaces the stale one without
+		// modifying the request.
+		jar.SetCookies(req.URL, []*http.Cookie{{Name: "session", Value: "abc", Path: "/"}})
+		res, err = client.Do(req)
+		g.Expect(err).ToNot(HaveOccurred())
+		res.Body.Close()
+		g.Expect(res.StatusCode).To(Equal(http.StatusOK))
+		g.Expect(req.Header.Get("Cookie")).To(Equal("session=expired"))
+	})
+
+	t.Run("nil jar returns round tripper as is", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tr := NewOrIdle(nil)
+		defer Release(tr)
+		g.Expect(WithCookieJar(tr, nil)).To(BeIdenticalTo(tr))
+	})
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// WithIntermediates returns a clone of the given TLS config which completes
+// the certificate chain presented by the server with the given PEM encoded
+// intermediate certificates, before verifying it against the RootCAs of the
+// config. This allows connecting to servers which present an incomplete
+// chain, e.g. only their leaf certificate. The certificate is verified for
+// the server name sent to the server, or for the ServerName of the config
+// when connecting to an IP address, which is not sent to the server.
+// If the config is nil, a new config is returned. A config with
+// InsecureSkipVerify set is returned as is.
+func WithIntermediates(tlsConfig *tls.Config, pemCerts []byte) (*tls.Config, error) {
+	intermediates, err := parseCertificates(pemCerts)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		if tlsConfig.InsecureSkipVerify {
+			return tlsConfig, nil
+		}
+		tlsConfig = tlsConfig.Clone()
+	}
+
+	// The verification of crypto/tls only considers the intermediates
+	// presented by the server, which is why it is replaced with an equivalent
+	// verification which considers the given intermediates as well.
+	roots, serverName := tlsConfig.RootCAs, tlsConfig.ServerName
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("tls: server did not present a certificate")
+		}
+		name := cs.ServerName
+		if name == "" {
+			name = serverName
+		}
+		if name == "" {
+			return errors.New("tls: no server name to verify the certificate against")
+		}
+
+		pool := x509.NewCertPool()
+		for _, c := range cs.PeerCertificates[1:] {
+			pool.AddCert(c)
+		}
+		for _, c := range intermediates {
+			pool.AddCert(c)
+		}
+		_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: pool,
+			DNSName:       name,
+		})
+		return err
+	}
+	return tlsConfig, nil
+}
+
+// parseCertificates parses all the PEM encoded certificates in the given data.
+// It returns an error if the data contains no certificates.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse intermediate certificate: %w", err)
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM encoded intermediate certificates found")
+	}
+	return certs, nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// testChain is a certificate chain of a root CA, an intermediate CA and a
+// leaf certificate for 127.0.0.1 issued by the intermediate CA.
+type testChain struct {
+	root         *x509.Certificate
+	intermediate *x509.Certificate
+	leaf         tls.Certificate
+}
+
+func newTestChain(t *testing.T) testChain {
+	t.Helper()
+
+	newCert := func(tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key
+	}
+
+	notBefore, notAfter := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	root, rootKey := newCert(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+	intermediate, intermediateKey := newCert(&x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, root, rootKey)
+	leaf, leafKey := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}, intermediate, intermediateKey)
+
+	return testChain{
+		root:         root,
+		intermediate: intermediate,
+		leaf:         tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: leafKey, Leaf: leaf},
+	}
+}
+
+func pemEncode(certs ...*x509.Certificate) []byte {
+	var b []byte
+	for _, c := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return b
+}
+
+func TestWithIntermediates(t *testing.T) {
+	chain := newTestChain(t)
+	other := newTestChain(t)
+
+	// The server presents only its leaf certificate.
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{chain.leaf}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(chain.root)
+
+	tests := []struct {
+		name          string
+		tlsConfig     *tls.Config
+		intermediates []byte
+		wantErr       string
+	}{
+		{
+			name:      "incomplete chain without intermediates",
+			tlsConfig: &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"},
+			wantErr:   "certificate signed by unknown authority",
+		},
+		{
+			name:          "incomplete chain completed with intermediates",
+			tlsConfig:     &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"},
+			intermediates: pemEncode(chain.intermediate),
+		},
+		{
+			name:          "intermediates bundle with other certificates",
+			tlsConfig:     &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"},
+			intermediates: pemEncode(other.intermediate, chain.intermediate),
+		},
+		{
+			name:          "intermediates do not lead to a root",
+			tlsConfig:     &tls.Config{ServerName: "127.0.0.1"},
+			intermediates: pemEncode(chain.intermediate),
+			wantErr:       "certificate signed by unknown authority",
+		},
+		{
+			name:          "intermediates of another chain",
+			tlsConfig:     &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"},
+			intermediates: pemEncode(other.intermediate),
+			wantErr:       "certificate signed by unknown authority",
+		},
+		{
+			name:          "server name mismatch",
+			tlsConfig:     &tls.Config{RootCAs: roots, ServerName: "example.com"},
+			intermediates: pemEncode(chain.intermediate),
+			wantErr:       "wanted to match example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			tlsConfig := tt.tlsConfig
+			if tt.intermediates != nil {
+				var err error
+				tlsConfig, err = WithIntermediates(tt.tlsConfig, tt.intermediates)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(tt.tlsConfig.InsecureSkipVerify).To(BeFalse())
+			}
+
+			tr := NewOrIdle(tlsConfig)
+			t.Cleanup(func() { _ = Release(tr) })
+			tr.DisableKeepAlives = true
+			t.Cleanup(func() { tr.DisableKeepAlives = false })
+
+			resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(resp.Body.Close()).To(Succeed())
+			g.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+	}
+
+	t.Run("invalid intermediates", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := WithIntermediates(nil, []byte("invalid"))
+		g.Expect(err).To(MatchError("no PEM encoded intermediate certificates found"))
+	})
+
+	t.Run("insecure config is returned as is", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tlsConfig := &tls.Config{InsecureSkipVerify: true}
+		got, err := WithIntermediates(tlsConfig, pemEncode(chain.intermediate))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(got).To(BeIdenticalTo(tlsConfig))
+		g.Expect(got.VerifyConnection).To(BeNil())
+	})
+}
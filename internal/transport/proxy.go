@@ -0,0 +1,94 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// defaultProxy is the proxy function of transports returned by NewOrIdle,
+// which is restored when they are released.
+var defaultProxy = limitRedirects(http.ProxyFromEnvironment)
+
+// Proxy configures the forward proxy used by a transport.
+type Proxy struct {
+	// URL of the proxy. When nil, the proxy is determined from the
+	// environment using http.ProxyFromEnvironment.
+	URL *url.URL
+	// User is used to authenticate with the proxy. It takes precedence over
+	// the user info of URL.
+	User *url.Userinfo
+	// NoProxy is a list of hosts which are connected to directly instead of
+	// through the proxy of URL, in the format of the NO_PROXY environment
+	// variable. Requests to localhost and loopback addresses are never
+	// proxied when it is set.
+	NoProxy []string
+}
+
+// ProxyFunc returns the proxy function for the Proxy, to be used as the
+// Proxy of an http.Transport.
+func (p *Proxy) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	proxy := http.ProxyFromEnvironment
+	if p.URL != nil {
+		proxy = http.ProxyURL(p.URL)
+		if len(p.NoProxy) > 0 {
+			proxy = noProxyFunc(p.URL, p.NoProxy)
+		}
+	}
+	if p.User == nil {
+		return proxy
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		u, err := proxy(req)
+		if err != nil || u == nil {
+			return u, err
+		}
+		withUser := *u
+		withUser.User = p.User
+		return &withUser, nil
+	}
+}
+
+// noProxyFunc returns a proxy function which returns the given proxy URL for
+// all requests, except for the ones to the hosts matching noProxy.
+func noProxyFunc(proxyURL *url.URL, noProxy []string) func(*http.Request) (*url.URL, error) {
+	cfg := &httpproxy.Config{
+		HTTPProxy:  proxyURL.String(),
+		HTTPSProxy: proxyURL.String(),
+		NoProxy:    strings.Join(noProxy, ","),
+	}
+	proxy := cfg.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// SetProxy configures the given transport to connect through the given
+// Proxy. The user info of the proxy is sent as Proxy-Authorization header,
+// for HTTPS targets as part of the CONNECT request to the proxy.
+// A nil Proxy leaves the transport as is. The proxy is reset to the one from
+// the environment when the transport is released.
+func SetProxy(t *http.Transport, p *Proxy) {
+	if t == nil || p == nil {
+		return
+	}
+	t.Proxy = limitRedirects(p.ProxyFunc())
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultMaxRedirects is the maximum number of redirects followed by the
+// Go HTTP client, which stops after 10 consecutive requests.
+const DefaultMaxRedirects = 9
+
+// ErrTooManyRedirects is returned for requests which are redirected more
+// often than MaxRedirects.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// maxRedirects is the maximum number of redirects enforced by the transports
+// of the pool.
+var maxRedirects int32 = DefaultMaxRedirects
+
+// SetMaxRedirects configures the maximum number of redirects followed by
+// requests made using the transports returned by NewOrIdle. It returns an
+// error if n is negative, or exceeds DefaultMaxRedirects as the HTTP clients
+// of the Helm getters never follow more redirects.
+func SetMaxRedirects(n int) error {
+	if n < 0 || n > DefaultMaxRedirects {
+		return fmt.Errorf("invalid maximum number of redirects %d: must be between 0 and %d", n, DefaultMaxRedirects)
+	}
+	atomic.StoreInt32(&maxRedirects, int32(n))
+	return nil
+}
+
+// MaxRedirects returns the maximum number of redirects configured using
+// SetMaxRedirects.
+func MaxRedirects() int {
+	return int(atomic.LoadInt32(&maxRedirects))
+}
+
+// IsTooManyRedirects returns if the given error is caused by a request being
+// redirected more often than allowed, either by MaxRedirects or by the
+// default redirect policy of the Go HTTP client.
+func IsTooManyRedirects(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, ErrTooManyRedirects) ||
+		strings.Contains(err.Error(), fmt.Sprintf("stopped after %d redirects", DefaultMaxRedirects+1))
+}
+
+// redirects returns the number of redirects which lead to the given request.
+func redirects(req *http.Request) int {
+	var n int
+	for res := req.Response; res != nil && res.Request != nil; res = res.Request.Response {
+		n++
+	}
+	return n
+}
+
+// limitRedirects wraps the given http.Transport proxy function to fail
+// requests which follow more redirects than MaxRedirects. As the Proxy of a
+// transport is consulted for every request, including the ones an
+// http.Client makes to follow redirects, this enforces the limit independent
+// of the redirect policy of the client using the transport.
+func limitRedirects(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if limit := MaxRedirects(); redirects(req) > limit {
+			return nil, fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, limit)
+		}
+		if proxy == nil {
+			return nil, nil
+		}
+		return proxy(req)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSetMaxRedirects(t *testing.T) {
+	g := NewWithT(t)
+	t.Cleanup(func() { _ = SetMaxRedirects(DefaultMaxRedirects) })
+
+	g.Expect(MaxRedirects()).To(Equal(DefaultMaxRedirects))
+	g.Expect(SetMaxRedirects(0)).To(Succeed())
+	g.Expect(MaxRedirects()).To(Equal(0))
+	g.Expect(SetMaxRedirects(-1)).ToNot(Succeed())
+	g.Expect(SetMaxRedirects(DefaultMaxRedirects + 1)).ToNot(Succeed())
+	g.Expect(MaxRedirects()).To(Equal(0))
+}
+
+func TestIsTooManyRedirects(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(IsTooManyRedirects(nil)).To(BeFalse())
+	g.Expect(IsTooManyRedirects(errors.New("connection refused"))).To(BeFalse())
+	g.Expect(IsTooManyRedirects(fmt.Errorf("failed: %w", ErrTooManyRedirects))).To(BeTrue())
+	g.Expect(IsTooManyRedirects(errors.New(`Get "/loop": stopped after 10 redirects`))).To(BeTrue())
+}
+
+func TestNewOrIdle_maxRedirects(t *testing.T) {
+	// The server redirects to itself until the requested number of redirects
+	// is reached, or forever if none is given.
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		if until, err := strconv.Atoi(r.URL.Query().Get("until")); err == nil && int(n) > until {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, r.URL.String(), http.StatusFound)
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name         string
+		maxRedirects int
+		query        string
+		wantRequests int32
+		wantErr      bool
+	}{
+		{name: "follows redirects up to the maximum", maxRedirects: 3, query: "?until=3", wantRequests: 4},
+		{name: "fails redirect loop at the maximum", maxRedirects: 3, wantRequests: 4, wantErr: true},
+		{name: "fails on first redirect without redirects allowed", maxRedirects: 0, wantRequests: 1, wantErr: true},
+		{name: "fails redirect loop at the default maximum", maxRedirects: DefaultMaxRedirects, wantRequests: DefaultMaxRedirects + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(SetMaxRedirects(tt.maxRedirects)).To(Succeed())
+			t.Cleanup(func() { _ = SetMaxRedirects(DefaultMaxRedirects) })
+			atomic.StoreInt32(&requests, 0)
+
+			tr := NewOrIdle(nil)
+			t.Cleanup(func() { _ = Release(tr) })
+
+			resp, err := (&http.Client{Transport: tr}).Get(server.URL + "/loop" + tt.query)
+			g.Expect(atomic.LoadInt32(&requests)).To(Equal(tt.wantRequests))
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(IsTooManyRedirects(err)).To(BeTrue())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(resp.Body.Close()).To(Succeed())
+		})
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// Wrap returns an http.Transport which sends all HTTP and HTTPS requests
+// through the given http.RoundTripper. This allows a stack of round trippers
+// to be used by clients which only accept an http.Transport, such as the Helm
+// getters configured using getter.WithTransport.
+//
+// The returned transport does not establish any connections itself, and
+// must not be released to the pool.
+func Wrap(rt http.RoundTripper) *http.Transport {
+	t := &http.Transport{
+		// An empty map disables HTTP/2, which would otherwise take over
+		// the HTTPS requests from the registered round tripper.
+		TLSNextProto: map[string]func(string, *tls.Conn) http.RoundTripper{},
+	}
+	t.RegisterProtocol("http", rt)
+	t.RegisterProtocol("https", rt)
+	return t
+}
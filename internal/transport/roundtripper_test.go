@@ -0,0 +1,60 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWrap(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Wrapped", r.Header.Get("X-Wrapped"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	tr := NewOrIdle(nil)
+	defer Release(tr)
+
+	var requests int
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		req = req.Clone(req.Context())
+		req.Header.Set("X-Wrapped", "true")
+		return tr.RoundTrip(req)
+	})
+
+	client := &http.Client{Transport: Wrap(rt)}
+	res, err := client.Get(server.URL)
+	g.Expect(err).ToNot(HaveOccurred())
+	res.Body.Close()
+	g.Expect(res.StatusCode).To(Equal(http.StatusOK))
+	g.Expect(res.Header.Get("X-Wrapped")).To(Equal("true"))
+	g.Expect(requests).To(Equal(1))
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// StatusError is returned by the http.RoundTripper of WithStatusError for a
+// response with an unsuccessful HTTP status.
+type StatusError struct {
+	// URL of the request.
+	URL string
+	// StatusCode of the response, e.g. 404.
+	StatusCode int
+	// Status of the response, e.g. "404 Not Found".
+	Status string
+}
+
+// Error implements the error interface. The message is equal to the one of
+// the Helm HTTP getter for an unsuccessful response.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("failed to fetch %s : %s", e.URL, e.Status)
+}
+
+// WithStatusError returns an http.RoundTripper which sends the requests
+// through rt, and fails with a StatusError for a response with an HTTP status
+// of 400 or higher. This allows the status of a response to be determined
+// from the error of a client which only reports it in its message, such as
+// the Helm getters.
+func WithStatusError(rt http.RoundTripper) http.RoundTripper {
+	return &statusRoundTripper{rt: rt}
+}
+
+type statusRoundTripper struct {
+	rt http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (s *statusRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := s.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		res.Body.Close()
+		return nil, &StatusError{
+			URL:        req.URL.String(),
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWithStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/missing", http.StatusFound)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tr := NewOrIdle(nil)
+	t.Cleanup(func() { Release(tr) })
+	client := &http.Client{Transport: WithStatusError(tr)}
+
+	t.Run("successful response", func(t *testing.T) {
+		g := NewWithT(t)
+
+		res, err := client.Get(server.URL + "/index.yaml")
+		g.Expect(err).ToNot(HaveOccurred())
+		res.Body.Close()
+		g.Expect(res.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	t.Run("unsuccessful response after redirect", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := client.Get(server.URL + "/redirect")
+		var statusErr *StatusError
+		g.Expect(errors.As(err, &statusErr)).To(BeTrue())
+		g.Expect(statusErr.StatusCode).To(Equal(http.StatusNotFound))
+		g.Expect(statusErr.URL).To(Equal(server.URL + "/missing"))
+		g.Expect(statusErr.Error()).To(Equal("failed to fetch " + server.URL + "/missing : 404 Not Found"))
+	})
+}
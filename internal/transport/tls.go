@@ -0,0 +1,95 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync/atomic"
+)
+
+// tlsVersions maps the supported values of ParseTLSVersion to their
+// crypto/tls version.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// minTLSVersion is the minimum TLS version enforced by WithMinTLSVersion.
+var minTLSVersion uint32
+
+// ParseTLSVersion parses the given TLS version (e.g. "1.2") into its
+// crypto/tls version. An empty string results in zero, which means no
+// minimum version is enforced.
+func ParseTLSVersion(s string) (uint16, error) {
+	if s == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[s]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version '%s': must be one of '1.0', '1.1', '1.2' or '1.3'", s)
+	}
+	return v, nil
+}
+
+// SetMinTLSVersion configures the minimum TLS version enforced by
+// WithMinTLSVersion. Zero disables the enforcement.
+func SetMinTLSVersion(v uint16) {
+	atomic.StoreUint32(&minTLSVersion, uint32(v))
+	defaultTLS.Store(WithMinTLSVersion(nil))
+}
+
+// defaultTLS holds the TLS config of transports returned by NewOrIdle
+// without a TLS config, see defaultTLSConfig.
+var defaultTLS atomic.Value
+
+// defaultTLSConfig returns the TLS config of transports returned by
+// NewOrIdle without a TLS config. It is nil, unless a minimum TLS version
+// is enforced. The same config is returned until SetMinTLSVersion is called,
+// which allows Release to tell whether a transport was used with a specific
+// TLS config.
+func defaultTLSConfig() *tls.Config {
+	cfg, _ := defaultTLS.Load().(*tls.Config)
+	return cfg
+}
+
+// MinTLSVersion returns the minimum TLS version configured using
+// SetMinTLSVersion, or zero if none is enforced.
+func MinTLSVersion() uint16 {
+	return uint16(atomic.LoadUint32(&minTLSVersion))
+}
+
+// WithMinTLSVersion returns the given TLS config with its MinVersion raised
+// to the configured MinTLSVersion. The given config is not modified, but a
+// copy is returned if it has to be changed. If the config is nil and a minimum
+// version is enforced, a new config is returned.
+// The minimum version is also enforced for configs which skip the
+// verification of certificates.
+func WithMinTLSVersion(cfg *tls.Config) *tls.Config {
+	v := MinTLSVersion()
+	if v == 0 || (cfg != nil && cfg.MinVersion >= v) {
+		return cfg
+	}
+	if cfg == nil {
+		return &tls.Config{MinVersion: v}
+	}
+	cfg = cfg.Clone()
+	cfg.MinVersion = v
+	return cfg
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{version: "", want: 0},
+		{version: "1.0", want: tls.VersionTLS10},
+		{version: "1.1", want: tls.VersionTLS11},
+		{version: "1.2", want: tls.VersionTLS12},
+		{version: "1.3", want: tls.VersionTLS13},
+		{version: "1.4", wantErr: true},
+		{version: "TLS1.2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			g := NewWithT(t)
+
+			got, err := ParseTLSVersion(tt.version)
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestWithMinTLSVersion(t *testing.T) {
+	t.Cleanup(func() { SetMinTLSVersion(0) })
+
+	t.Run("without minimum version", func(t *testing.T) {
+		g := NewWithT(t)
+
+		SetMinTLSVersion(0)
+		g.Expect(WithMinTLSVersion(nil)).To(BeNil())
+		cfg := &tls.Config{MinVersion: tls.VersionTLS10}
+		g.Expect(WithMinTLSVersion(cfg)).To(BeIdenticalTo(cfg))
+	})
+
+	t.Run("with minimum version", func(t *testing.T) {
+		g := NewWithT(t)
+
+		SetMinTLSVersion(tls.VersionTLS12)
+		g.Expect(WithMinTLSVersion(nil).MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+
+		cfg := &tls.Config{ServerName: "example.com", InsecureSkipVerify: true}
+		got := WithMinTLSVersion(cfg)
+		g.Expect(got.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+		g.Expect(got.ServerName).To(Equal("example.com"))
+		g.Expect(got.InsecureSkipVerify).To(BeTrue())
+		g.Expect(cfg.MinVersion).To(BeZero())
+
+		cfg = &tls.Config{MinVersion: tls.VersionTLS13}
+		g.Expect(WithMinTLSVersion(cfg)).To(BeIdenticalTo(cfg))
+	})
+}
+
+func TestNewOrIdle_minTLSVersion(t *testing.T) {
+	newServer := func(min, max uint16) *httptest.Server {
+		s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		s.TLS = &tls.Config{MinVersion: min, MaxVersion: max}
+		s.StartTLS()
+		t.Cleanup(s.Close)
+		return s
+	}
+	tls12 := newServer(tls.VersionTLS12, tls.VersionTLS12)
+	tls13 := newServer(tls.VersionTLS13, tls.VersionTLS13)
+
+	tests := []struct {
+		name       string
+		minVersion uint16
+		server     *httptest.Server
+		wantErr    bool
+	}{
+		{name: "no minimum accepts TLS 1.2", server: tls12},
+		{name: "no minimum accepts TLS 1.3", server: tls13},
+		{name: "minimum of TLS 1.2 accepts TLS 1.2", minVersion: tls.VersionTLS12, server: tls12},
+		{name: "minimum of TLS 1.3 accepts TLS 1.3", minVersion: tls.VersionTLS13, server: tls13},
+		{name: "minimum of TLS 1.3 rejects TLS 1.2", minVersion: tls.VersionTLS13, server: tls12, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			SetMinTLSVersion(tt.minVersion)
+			t.Cleanup(func() { SetMinTLSVersion(0) })
+
+			// Skipping the verification of certificates must not bypass the
+			// minimum version.
+			tr := NewOrIdle(&tls.Config{InsecureSkipVerify: true})
+			t.Cleanup(func() { _ = Release(tr) })
+			tr.DisableKeepAlives = true
+			t.Cleanup(func() { tr.DisableKeepAlives = false })
+
+			resp, err := (&http.Client{Transport: tr}).Get(tt.server.URL)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring("protocol version"))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(resp.Body.Close()).To(Succeed())
+		})
+	}
+}
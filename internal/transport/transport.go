@@ -21,13 +21,12 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"sync"
 	"time"
 )
 
 // TransportPool is a progressive and non-blocking pool
-// for http.Transport objects, optimised for Gargabe Collection
-// and without a hard limit on number of objects created.
+// for http.Transport objects, without a hard limit on number
+// of objects created.
 //
 // Its main purpose is to enable for transport objects to be
 // used across helm chart download requests and helm/pkg/getter
@@ -35,7 +34,9 @@ import (
 //
 // The use of this pool improves the default behaviour of helm getter
 // which creates a new connection per request, or per getter instance,
-// resulting on unnecessary TCP connections with the target.
+// resulting on unnecessary TCP connections with the target. Up to
+// MaxIdleTransports released transports are retained, together with
+// their idle connections, to be reused by the next users of the pool.
 //
 // http.Transport objects may contain sensitive material and also have
 // settings that may impact the security of HTTP operations using
@@ -44,48 +45,76 @@ import (
 // after each use.
 //
 // Calling the Release(t) function will reset TLS specific state whilst
-// also releasing the transport back to the pool to be reused.
+// also releasing the transport back to the pool to be reused. Only the
+// connections established with the default TLS config are kept for reuse,
+// the connections of a transport used with a specific TLS config (e.g.
+// with a CA or client certificate of a repository) are closed.
 //
 // xref: https://github.com/helm/helm/pull/10568
 // xref2: https://github.com/fluxcd/source-controller/issues/578
 type TransportPool struct {
 }
 
-var pool = &sync.Pool{
-	New: func() interface{} {
-		return &http.Transport{
-			DisableCompression: true,
-			Proxy:              http.ProxyFromEnvironment,
-
-			// Due to the non blocking nature of this approach,
-			// at peak usage a higher number of transport objects
-			// may be created. sync.Pool will ensure they are
-			// gargage collected when/if needed.
-			//
-			// By setting a low value to IdleConnTimeout the connections
-			// will be closed after that period of inactivity, allowing the
-			// transport to be garbage collected.
-			IdleConnTimeout: 60 * time.Second,
-
-			// use safe defaults based off http.DefaultTransport
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		}
-	},
+const (
+	// MaxIdleTransports is the maximum number of released transports
+	// retained by the pool. Transports released while the pool is full
+	// are discarded after closing their idle connections.
+	MaxIdleTransports = 32
+
+	// MaxIdleConns is the maximum number of idle connections across all
+	// hosts kept by a transport of the pool.
+	MaxIdleConns = 100
+
+	// MaxIdleConnsPerHost is the maximum number of idle connections to
+	// a single host kept by a transport of the pool.
+	MaxIdleConnsPerHost = 10
+)
+
+var pool = make(chan *http.Transport, MaxIdleTransports)
+
+// newTransport returns a new http.Transport for the pool.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		DisableCompression: true,
+		Proxy:              defaultProxy,
+
+		// By setting a low value to IdleConnTimeout the connections
+		// will be closed after that period of inactivity, preventing
+		// transports retained by the pool from holding on to them.
+		IdleConnTimeout:     60 * time.Second,
+		MaxIdleConns:        MaxIdleConns,
+		MaxIdleConnsPerHost: MaxIdleConnsPerHost,
+
+		// use safe defaults based off http.DefaultTransport
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
 }
 
 // NewOrIdle tries to return an existing transport that is not currently being used.
 // If none is found, creates a new Transport instead.
 //
-// tlsConfig can optionally set the TLSClientConfig for the transport.
+// tlsConfig can optionally set the TLSClientConfig for the transport. The
+// configured MinTLSVersion is enforced on it using WithMinTLSVersion.
+// Requests made using the transport fail with ErrTooManyRedirects if they
+// follow more than MaxRedirects redirects.
 func NewOrIdle(tlsConfig *tls.Config) *http.Transport {
-	t := pool.Get().(*http.Transport)
-	t.TLSClientConfig = tlsConfig
+	var t *http.Transport
+	select {
+	case t = <-pool:
+	default:
+		t = newTransport()
+	}
 
+	if tlsConfig == nil {
+		t.TLSClientConfig = defaultTLSConfig()
+	} else {
+		t.TLSClientConfig = WithMinTLSVersion(tlsConfig)
+	}
 	return t
 }
 
@@ -96,8 +125,20 @@ func Release(transport *http.Transport) error {
 		return fmt.Errorf("cannot release nil transport")
 	}
 
+	// Connections established with a specific TLS config, e.g. one which
+	// presents a client certificate or does not verify the certificate of
+	// the server, must not be reused by a next user of the transport.
+	if transport.TLSClientConfig != defaultTLSConfig() {
+		transport.CloseIdleConnections()
+	}
+
 	transport.TLSClientConfig = nil
+	transport.Proxy = defaultProxy
 
-	pool.Put(transport)
+	select {
+	case pool <- transport:
+	default:
+		transport.CloseIdleConnections()
+	}
 	return nil
 }
@@ -18,6 +18,10 @@ package transport
 
 import (
 	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 )
 
@@ -56,3 +60,84 @@ func Test_TransportReuse(t *testing.T) {
 		t.Errorf("wanted error message: 'cannot release nil transport' got: %q", err.Error())
 	}
 }
+
+func Test_ReleaseInsecureTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tr := NewOrIdle(&tls.Config{InsecureSkipVerify: true})
+	res, err := (&http.Client{Transport: tr}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error with insecure transport: %v", err)
+	}
+	res.Body.Close()
+
+	if err := Release(tr); err != nil {
+		t.Fatalf("error releasing transport: %v", err)
+	}
+
+	// The connection established without verification must not be reused.
+	if res, err := (&http.Client{Transport: tr}).Get(server.URL); err == nil {
+		res.Body.Close()
+		t.Error("expected certificate verification error after release")
+	}
+}
+
+func Test_ReleaseKeepsDefaultConnections(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	tr := NewOrIdle(nil)
+	res, err := (&http.Client{Transport: tr}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+
+	if err := Release(tr); err != nil {
+		t.Fatalf("error releasing transport: %v", err)
+	}
+
+	// The connection established with the default TLS config is reused.
+	res, err = (&http.Client{Transport: tr}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+
+	if got := atomic.LoadInt32(&conns); got != 1 {
+		t.Errorf("expected connection to be reused after release, got %d connections", got)
+	}
+}
+
+func Test_ReleaseFullPool(t *testing.T) {
+	transports := make([]*http.Transport, MaxIdleTransports+1)
+	for i := range transports {
+		transports[i] = NewOrIdle(nil)
+	}
+	for _, tr := range transports {
+		if err := Release(tr); err != nil {
+			t.Fatalf("error releasing transport: %v", err)
+		}
+	}
+	if n := len(pool); n != MaxIdleTransports {
+		t.Errorf("expected %d idle transports in pool, got %d", MaxIdleTransports, n)
+	}
+}
+
+func Test_newTransportIdleConns(t *testing.T) {
+	tr := newTransport()
+	if tr.MaxIdleConns != MaxIdleConns {
+		t.Errorf("expected MaxIdleConns to be %d, got %d", MaxIdleConns, tr.MaxIdleConns)
+	}
+	if tr.MaxIdleConnsPerHost != MaxIdleConnsPerHost {
+		t.Errorf("expected MaxIdleConnsPerHost to be %d, got %d", MaxIdleConnsPerHost, tr.MaxIdleConnsPerHost)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tree provides the computation of Merkle-style hash trees of the
+// files in an artifact, allowing consumers to detect exactly which files
+// changed between revisions.
+package tree
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// FileSuffix is the suffix of the sidecar file containing the Tree of an
+	// artifact, replacing the ".tar.gz" extension of the artifact.
+	FileSuffix = ".tree.json"
+
+	// RootMetadataKey is the key of the Root of the Tree in the metadata of
+	// an artifact.
+	RootMetadataKey = "source.toolkit.fluxcd.io/tree-root"
+
+	fileType = "file"
+	dirType  = "dir"
+)
+
+// Tree contains the hashes of the files and directories in an artifact.
+//
+// The hash of a file is the digest of its content. The hash of a directory
+// is the digest of the sorted list of the type, hash and name of its direct
+// children, which results in a change of a file only altering the hashes of
+// the file and its parent directories.
+type Tree struct {
+	// Root is the hash of the root directory of the artifact.
+	Root digest.Digest `json:"root"`
+	// Paths contains the hashes of all files and directories in the artifact,
+	// indexed by their slash separated path relative to the root.
+	Paths map[string]digest.Digest `json:"paths"`
+}
+
+// Build computes the Tree for the given file hashes, indexed by their slash
+// separated path relative to the root. Parent directories are derived from
+// the paths of the files.
+func Build(algo digest.Algorithm, files map[string]digest.Digest) *Tree {
+	t := &Tree{
+		Paths: make(map[string]digest.Digest, len(files)),
+	}
+
+	// Collect the children of every directory.
+	children := map[string]map[string]string{"": {}}
+	for p, d := range files {
+		p = path.Clean(strings.TrimPrefix(p, "/"))
+		t.Paths[p] = d
+
+		childType := fileType
+		for {
+			dir, name := path.Split(p)
+			dir = strings.TrimSuffix(dir, "/")
+			if _, ok := children[dir]; !ok {
+				children[dir] = map[string]string{}
+			}
+			children[dir][name] = childType
+			if dir == "" {
+				break
+			}
+			p, childType = dir, dirType
+		}
+	}
+
+	// Hash the directories, deepest first to ensure all children are hashed.
+	dirs := make([]string, 0, len(children))
+	for dir := range children {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if di, dj := depth(dirs[i]), depth(dirs[j]); di != dj {
+			return di > dj
+		}
+		return dirs[i] < dirs[j]
+	})
+	for _, dir := range dirs {
+		names := make([]string, 0, len(children[dir]))
+		for name := range children[dir] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var b strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&b, "%s %s %s\n", children[dir][name], t.Paths[path.Join(dir, name)], name)
+		}
+		d := algo.FromString(b.String())
+		if dir == "" {
+			t.Root = d
+			continue
+		}
+		t.Paths[dir] = d
+	}
+	return t
+}
+
+// FromTarball computes the Tree for the regular files in the given gzip
+// compressed tarball, as produced for artifacts by the controller.
+func FromTarball(algo digest.Algorithm, r io.Reader) (*Tree, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzip reader: %w", err)
+	}
+	defer gr.Close()
+
+	files := make(map[string]digest.Digest)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tarball: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		d, err := algo.FromReader(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash '%s': %w", hdr.Name, err)
+		}
+		files[hdr.Name] = d
+	}
+	return Build(algo, files), nil
+}
+
+// SidecarPath returns the path of the sidecar file containing the Tree of the
+// artifact at the given path.
+func SidecarPath(artifactPath string) string {
+	return strings.TrimSuffix(artifactPath, ".tar.gz") + FileSuffix
+}
+
+// Changed returns the sorted paths of which the hash differs between the
+// given Trees, including paths only present in one of them.
+func Changed(a, b *Tree) []string {
+	var changed []string
+	for p, d := range a.Paths {
+		if b.Paths[p] != d {
+			changed = append(changed, p)
+		}
+	}
+	for p := range b.Paths {
+		if _, ok := a.Paths[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func depth(p string) int {
+	if p == "" {
+		return 0
+	}
+	return strings.Count(p, "/") + 1
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tree
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestBuild(t *testing.T) {
+	files := map[string]string{
+		"README.md":              "readme",
+		"deploy/app.yaml":        "app",
+		"deploy/base/kust.yaml":  "kustomization",
+		"deploy/base/svc.yaml":   "service",
+		"charts/podinfo/Chart":   "chart",
+		"charts/podinfo/values":  "values",
+		"charts/other/Chart":     "other chart",
+		"charts/other/templates": "templates",
+	}
+	build := func(files map[string]string) *Tree {
+		hashes := make(map[string]digest.Digest, len(files))
+		for p, c := range files {
+			hashes[p] = digest.SHA256.FromString(c)
+		}
+		return Build(digest.SHA256, hashes)
+	}
+	with := func(p, c string) map[string]string {
+		m := make(map[string]string, len(files)+1)
+		for k, v := range files {
+			m[k] = v
+		}
+		if c == "" {
+			delete(m, p)
+		} else {
+			m[p] = c
+		}
+		return m
+	}
+
+	t.Run("computes hashes of files and directories", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tr := build(files)
+		g.Expect(tr.Root).ToNot(BeEmpty())
+		g.Expect(tr.Paths).To(HaveLen(len(files) + 5))
+		g.Expect(tr.Paths).To(HaveKeyWithValue("README.md", digest.SHA256.FromString("readme")))
+		for _, dir := range []string{"deploy", "deploy/base", "charts", "charts/podinfo", "charts/other"} {
+			g.Expect(tr.Paths).To(HaveKey(dir))
+		}
+	})
+
+	t.Run("is stable", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(build(files)).To(Equal(build(files)))
+	})
+
+	t.Run("changed file only alters its subtree", func(t *testing.T) {
+		g := NewWithT(t)
+
+		a, b := build(files), build(with("deploy/base/svc.yaml", "changed"))
+		g.Expect(b.Root).ToNot(Equal(a.Root))
+		g.Expect(Changed(a, b)).To(Equal([]string{"deploy", "deploy/base", "deploy/base/svc.yaml"}))
+	})
+
+	t.Run("added file only alters its subtree", func(t *testing.T) {
+		g := NewWithT(t)
+
+		a, b := build(files), build(with("charts/podinfo/new", "new"))
+		g.Expect(b.Root).ToNot(Equal(a.Root))
+		g.Expect(Changed(a, b)).To(Equal([]string{"charts", "charts/podinfo", "charts/podinfo/new"}))
+	})
+
+	t.Run("removed file only alters its subtree", func(t *testing.T) {
+		g := NewWithT(t)
+
+		a, b := build(files), build(with("charts/other/templates", ""))
+		g.Expect(b.Root).ToNot(Equal(a.Root))
+		g.Expect(Changed(a, b)).To(Equal([]string{"charts", "charts/other", "charts/other/templates"}))
+	})
+
+	t.Run("moved file alters both subtrees", func(t *testing.T) {
+		g := NewWithT(t)
+
+		moved := with("README.md", "")
+		moved["deploy/README.md"] = "readme"
+		a, b := build(files), build(moved)
+		g.Expect(Changed(a, b)).To(Equal([]string{"README.md", "deploy", "deploy/README.md"}))
+	})
+
+	t.Run("distinguishes files from directories", func(t *testing.T) {
+		g := NewWithT(t)
+
+		a := Build(digest.SHA256, map[string]digest.Digest{"a/b": digest.SHA256.FromString("")})
+		b := Build(digest.SHA256, map[string]digest.Digest{"a": a.Paths["a"]})
+		g.Expect(a.Root).ToNot(Equal(b.Root))
+	})
+}
+
+func TestFromTarball(t *testing.T) {
+	g := NewWithT(t)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	g.Expect(tw.WriteHeader(&tar.Header{Name: "dir", Typeflag: tar.TypeDir, Mode: 0o755})).To(Succeed())
+	for name, content := range map[string]string{"dir/file": "content", "root": "root"} {
+		g.Expect(tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))})).To(Succeed())
+		_, err := tw.Write([]byte(content))
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	g.Expect(tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "root"})).To(Succeed())
+	g.Expect(tw.Close()).To(Succeed())
+	g.Expect(gw.Close()).To(Succeed())
+
+	tr, err := FromTarball(digest.SHA256, &buf)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tr).To(Equal(Build(digest.SHA256, map[string]digest.Digest{
+		"dir/file": digest.SHA256.FromString("content"),
+		"root":     digest.SHA256.FromString("root"),
+	})))
+
+	_, err = FromTarball(digest.SHA256, bytes.NewBufferString("invalid"))
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestSidecarPath(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(SidecarPath("gitrepository/default/podinfo/b9b3fead.tar.gz")).To(Equal("gitrepository/default/podinfo/b9b3fead.tree.json"))
+}
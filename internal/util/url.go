@@ -0,0 +1,71 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ExtractURLCredentials returns the given URL stripped of any userinfo,
+// together with the username and password which were embedded in it.
+// If the URL does not contain userinfo, it is returned as is with empty
+// credentials.
+func ExtractURLCredentials(rawURL string) (stripped, username, password string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", "", err
+	}
+	if u.User == nil {
+		return rawURL, "", "", nil
+	}
+	username = u.User.Username()
+	password, _ = u.User.Password()
+	u.User = nil
+	return u.String(), username, password, nil
+}
+
+// RedactURL returns the given URL with any userinfo removed, making it safe
+// to be logged or recorded in the status of an object. If the URL can not be
+// parsed, it is returned as is.
+func RedactURL(rawURL string) string {
+	stripped, _, _, err := ExtractURLCredentials(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return stripped
+}
+
+// ValidateURLScheme returns an error if the scheme of the given URL is not in
+// the list of allowed schemes. The comparison is case-insensitive, and any
+// scheme is allowed if the list is empty.
+func ValidateURLScheme(rawURL string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	for _, s := range allowed {
+		if strings.EqualFold(u.Scheme, s) {
+			return nil
+		}
+	}
+	return fmt.Errorf("scheme '%s' is not allowed, must be one of: %s", u.Scheme, strings.Join(allowed, ", "))
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook provides clients for external webhooks which are consulted
+// by the reconcilers during the reconciliation of a Source.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultPreStoreTimeout is the default timeout for a pre-store webhook
+// request.
+const DefaultPreStoreTimeout = 10 * time.Second
+
+// maxResponseSize is the maximum size in bytes of a webhook response body
+// which is read.
+const maxResponseSize = 1 << 20
+
+// ArtifactReview contains the metadata of an Artifact which is about to be
+// stored, and is sent to the pre-store webhook for review.
+type ArtifactReview struct {
+	// Kind of the Source object the Artifact is produced for.
+	Kind string `json:"kind"`
+	// Namespace of the Source object.
+	Namespace string `json:"namespace"`
+	// Name of the Source object.
+	Name string `json:"name"`
+	// Revision of the Artifact.
+	Revision string `json:"revision"`
+	// Path of the Artifact relative to the root of the Storage.
+	Path string `json:"path"`
+	// Digest of the Artifact contents, if already known.
+	Digest string `json:"digest,omitempty"`
+}
+
+// ReviewResult is the response of the pre-store webhook to an
+// ArtifactReview.
+type ReviewResult struct {
+	// Approved indicates if the Artifact is allowed to be stored.
+	Approved bool `json:"approved"`
+	// Message can contain a human readable reason for the result.
+	Message string `json:"message,omitempty"`
+}
+
+// PreStore is a client for a validating webhook which approves or rejects
+// Artifacts before they are written to the Storage.
+type PreStore struct {
+	// URL of the webhook endpoint.
+	URL string
+	// Timeout for a single review request.
+	Timeout time.Duration
+
+	client *http.Client
+}
+
+// NewPreStore returns a new PreStore webhook client for the given URL.
+// When timeout is zero or negative, DefaultPreStoreTimeout is used.
+func NewPreStore(url string, timeout time.Duration) *PreStore {
+	if timeout <= 0 {
+		timeout = DefaultPreStoreTimeout
+	}
+	return &PreStore{
+		URL:     url,
+		Timeout: timeout,
+		client:  &http.Client{},
+	}
+}
+
+// Review sends the given ArtifactReview to the webhook, and returns the
+// ReviewResult. It returns an error if the request fails, times out, or the
+// webhook does not respond with a 2xx status code and a valid result.
+func (w *PreStore) Review(ctx context.Context, review ArtifactReview) (*ReviewResult, error) {
+	b, err := json.Marshal(review)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode artifact review: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("webhook responded with unexpected status code: %d", resp.StatusCode)
+	}
+
+	result := &ReviewResult{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(result); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook response: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNewPreStore(t *testing.T) {
+	g := NewWithT(t)
+
+	w := NewPreStore("http://example.com", 0)
+	g.Expect(w.Timeout).To(Equal(DefaultPreStoreTimeout))
+
+	w = NewPreStore("http://example.com", time.Second)
+	g.Expect(w.Timeout).To(Equal(time.Second))
+}
+
+func TestPreStore_Review(t *testing.T) {
+	review := ArtifactReview{
+		Kind:      "GitRepository",
+		Namespace: "default",
+		Name:      "podinfo",
+		Revision:  "main@sha1:b9b3feadba509cb9b22e968a5d27e96c2bc2ff91",
+		Path:      "gitrepository/default/podinfo/b9b3feadba509cb9b22e968a5d27e96c2bc2ff91.tar.gz",
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		timeout time.Duration
+		want    *ReviewResult
+		wantErr string
+	}{
+		{
+			name: "approves",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(ReviewResult{Approved: true})
+			},
+			want: &ReviewResult{Approved: true},
+		},
+		{
+			name: "rejects",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(ReviewResult{Approved: false, Message: "revision not allowed"})
+			},
+			want: &ReviewResult{Approved: false, Message: "revision not allowed"},
+		},
+		{
+			name: "unexpected status code",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantErr: "unexpected status code: 500",
+		},
+		{
+			name: "invalid response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("invalid"))
+			},
+			wantErr: "failed to decode webhook response",
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			},
+			timeout: 10 * time.Millisecond,
+			wantErr: "context deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var got ArtifactReview
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				g.Expect(r.Method).To(Equal(http.MethodPost))
+				g.Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+				g.Expect(json.NewDecoder(r.Body).Decode(&got)).To(Succeed())
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+
+			result, err := NewPreStore(server.URL, tt.timeout).Review(context.TODO(), review)
+			if tt.wantErr != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.want))
+			g.Expect(got).To(Equal(review))
+		})
+	}
+}
@@ -17,10 +17,15 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"time"
 
 	flag "github.com/spf13/pflag"
@@ -36,7 +41,10 @@ import (
 	ctrlcache "sigs.k8s.io/controller-runtime/pkg/cache"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 
+	gitclient "github.com/fluxcd/go-git/v5/plumbing/transport/client"
+	githttp "github.com/fluxcd/go-git/v5/plumbing/transport/http"
 	"github.com/fluxcd/pkg/git"
 	"github.com/fluxcd/pkg/runtime/client"
 	helper "github.com/fluxcd/pkg/runtime/controller"
@@ -53,11 +61,21 @@ import (
 	// +kubebuilder:scaffold:imports
 
 	"github.com/fluxcd/source-controller/internal/cache"
+	"github.com/fluxcd/source-controller/internal/connlimit"
 	"github.com/fluxcd/source-controller/internal/controller"
 	intdigest "github.com/fluxcd/source-controller/internal/digest"
+	"github.com/fluxcd/source-controller/internal/eventlimit"
 	"github.com/fluxcd/source-controller/internal/features"
 	"github.com/fluxcd/source-controller/internal/helm"
+	helmgetter "github.com/fluxcd/source-controller/internal/helm/getter"
 	"github.com/fluxcd/source-controller/internal/helm/registry"
+	"github.com/fluxcd/source-controller/internal/helm/repository"
+	"github.com/fluxcd/source-controller/internal/latency"
+	"github.com/fluxcd/source-controller/internal/logging"
+	"github.com/fluxcd/source-controller/internal/sourcemetrics"
+	"github.com/fluxcd/source-controller/internal/tracing"
+	"github.com/fluxcd/source-controller/internal/transport"
+	"github.com/fluxcd/source-controller/internal/webhook"
 )
 
 const controllerName = "source-controller"
@@ -94,8 +112,12 @@ func main() {
 		storageAddr              string
 		storageAdvAddr           string
 		concurrent               int
+		helmChartConcurrent      int
+		helmRepoConcurrent       int
+		bucketConcurrent         int
 		requeueDependency        time.Duration
 		helmIndexLimit           int64
+		helmIndexMaxEntries      int
 		helmChartLimit           int64
 		helmChartFileLimit       int64
 		clientOptions            client.Options
@@ -110,6 +132,37 @@ func main() {
 		artifactRetentionTTL     time.Duration
 		artifactRetentionRecords int
 		artifactDigestAlgo       string
+		artifactFailureThreshold int
+		preStoreWebhookURL       string
+		preStoreWebhookTimeout   time.Duration
+		bucketListPageSize       int
+		allowedSchemes           []string
+		disableGitProtocol       bool
+		finalizerGCGrace         time.Duration
+		globalArtifactTTL        time.Duration
+		artifactTreeHash         bool
+		storageFreeSpaceMargin   int64
+		maxGlobalConnections     int
+		keepRawIndex             bool
+		normalizeIndex           bool
+		compressedIndex          bool
+		tlsMinVersion            string
+		externalStorageURL       string
+		ignoredPathsSampleSize   int
+		maxRedirects             int
+		allowedChartAPIVersions  []string
+		requireIndexDigest       bool
+		propagateAnnotations     []string
+		maxCloneSize             int64
+		bucketMaxFetches         int
+		dedupeChartDownloads     bool
+		logHeaderDenylist        []string
+		warningEventsInterval    time.Duration
+		enableTracing            bool
+		tracingEndpoint          string
+		tracingInsecure          bool
+		tracingSampleRatio       float64
+		helmFileRepositoryRoot   string
 	)
 
 	flag.StringVar(&metricsAddr, "metrics-addr", envOrDefault("METRICS_ADDR", ":8080"),
@@ -123,13 +176,23 @@ func main() {
 		"The address the static file server binds to.")
 	flag.StringVar(&storageAdvAddr, "storage-adv-addr", envOrDefault("STORAGE_ADV_ADDR", ""),
 		"The advertised address of the static file server.")
+	flag.StringVar(&externalStorageURL, "external-storage-url", "",
+		"The scheme and host (e.g. 'https://artifacts.example.com') used in the artifact URLs reported in the status of objects, for consumers outside the cluster. The static file server keeps serving on the advertised address.")
 	flag.IntVar(&concurrent, "concurrent", 2, "The number of concurrent reconciles per controller.")
+	flag.IntVar(&helmChartConcurrent, "helm-chart-concurrency", 0,
+		"The number of concurrent HelmChart reconciles. Defaults to the value of --concurrent when zero.")
+	flag.IntVar(&helmRepoConcurrent, "helm-repo-concurrency", 0,
+		"The number of concurrent HelmRepository reconciles, for both the default and OCI type. Defaults to the value of --concurrent when zero.")
+	flag.IntVar(&bucketConcurrent, "bucket-concurrency", 0,
+		"The number of concurrent Bucket reconciles. Defaults to the value of --concurrent when zero.")
 	flag.Int64Var(&helmIndexLimit, "helm-index-max-size", helm.MaxIndexSize,
 		"The max allowed size in bytes of a Helm repository index file.")
 	flag.Int64Var(&helmChartLimit, "helm-chart-max-size", helm.MaxChartSize,
 		"The max allowed size in bytes of a Helm chart file.")
 	flag.Int64Var(&helmChartFileLimit, "helm-chart-file-max-size", helm.MaxChartFileSize,
 		"The max allowed size in bytes of a file in a Helm chart.")
+	flag.IntVar(&helmIndexMaxEntries, "max-index-entries", helm.MaxIndexEntries,
+		"The max allowed number of chart versions in a Helm repository index. Unlimited when zero.")
 	flag.DurationVar(&requeueDependency, "requeue-dependency", 30*time.Second,
 		"The interval at which failing dependencies are reevaluated.")
 	flag.IntVar(&helmCacheMaxSize, "helm-cache-max-size", 0,
@@ -148,6 +211,66 @@ func main() {
 		"The maximum number of artifacts to be kept in storage after a garbage collection.")
 	flag.StringVar(&artifactDigestAlgo, "artifact-digest-algo", intdigest.Canonical.String(),
 		"The algorithm to use to calculate the digest of artifacts.")
+	flag.BoolVar(&artifactTreeHash, "artifact-tree-hash", false,
+		"Write a sidecar file with the hash tree of the files in every archived artifact.")
+	flag.Int64Var(&storageFreeSpaceMargin, "storage-free-space-margin", 0,
+		"The number of bytes which must remain free in the storage path after writing an artifact. Writes which would exceed it fail early with an InsufficientStorage reason. Unchecked when zero.")
+	flag.StringSliceVar(&propagateAnnotations, "propagate-annotations", []string{},
+		"The list of annotations of source objects to record in the metadata of their artifacts. Supports wildcards, e.g. 'example.com/*'.")
+	flag.IntVar(&artifactFailureThreshold, "artifact-failure-threshold", 0,
+		"The number of consecutive times an artifact is tolerated to be missing from storage before it is discarded.")
+	flag.StringVar(&preStoreWebhookURL, "pre-store-webhook-url", "",
+		"The URL of a validating webhook which must approve artifacts before they are stored.")
+	flag.DurationVar(&preStoreWebhookTimeout, "pre-store-webhook-timeout", webhook.DefaultPreStoreTimeout,
+		"The timeout of a request to the pre-store webhook.")
+	flag.StringSliceVar(&allowedSchemes, "allowed-schemes", []string{},
+		"The list of URL schemes sources are allowed to use, e.g. 'https,ssh,oci'. Any scheme is allowed when empty.")
+	flag.BoolVar(&disableGitProtocol, "disable-git-protocol", false,
+		"Disable cloning GitRepositories over the anonymous and unencrypted git:// protocol.")
+	flag.DurationVar(&finalizerGCGrace, "finalizer-gc-grace", 0,
+		"The duration of time that artifacts of deleted resources will be kept in storage before being removed, allowing consumers to finish fetching them.")
+	flag.DurationVar(&globalArtifactTTL, "global-artifact-ttl", 0,
+		"The duration of time after which files in storage which do not belong to the current artifact of any resource are removed, e.g. those of resources deleted while the controller was not running. Disabled when zero.")
+	flag.IntVar(&maxGlobalConnections, "max-global-connections", 0,
+		"The maximum number of concurrent outbound network operations across all controllers. Unlimited when zero.")
+	flag.BoolVar(&keepRawIndex, "keep-raw-index", false,
+		"Store the index of a HelmRepository exactly as downloaded next to its artifact, for debugging purposes.")
+	flag.BoolVar(&normalizeIndex, "normalize-index", true,
+		"Normalize the index of a HelmRepository before storing it as artifact. When disabled, the index is stored exactly as downloaded, and paginated indexes fail to reconcile.")
+	flag.BoolVar(&compressedIndex, "compressed-index", false,
+		"Attempt to download the gzip-compressed index.yaml.gz of a HelmRepository, falling back to the index.yaml if it is not available.")
+	flag.StringVar(&tlsMinVersion, "tls-min-version", "",
+		"The minimum TLS version ('1.0', '1.1', '1.2' or '1.3') accepted by Helm repository and Bucket clients. Handshakes with servers which only offer lower versions fail.")
+	flag.IntVar(&maxRedirects, "max-redirects", transport.DefaultMaxRedirects,
+		"The maximum number of redirects followed by Helm repository clients, between 0 and 9. Requests which are redirected more often fail.")
+	flag.StringSliceVar(&allowedChartAPIVersions, "allowed-chart-apiversions", []string{},
+		"The list of chart API versions HelmCharts are allowed to build, e.g. 'v2'. Charts with any other API version fail to reconcile. Any API version is allowed when empty.")
+	flag.BoolVar(&requireIndexDigest, "require-index-digest", false,
+		"Fail the reconciliation of HelmCharts of which the entry in the Helm repository index has no digest. When disabled, a warning event is emitted instead.")
+	flag.IntVar(&bucketMaxFetches, "bucket-max-concurrent-fetches", 100,
+		"The maximum number of objects fetched concurrently per Bucket reconciliation.")
+	flag.IntVar(&bucketListPageSize, "bucket-list-page-size", 0,
+		"The maximum number of objects requested per page while listing the objects in a bucket. Defaults to the page size of the provider when zero. The objects are processed as the pages are received, while the keys and etags of all objects are kept in memory to calculate the revision.")
+	flag.IntVar(&ignoredPathsSampleSize, "ignored-paths-sample-size", 0,
+		"The maximum number of paths excluded by ignore rules recorded in the status of GitRepository and Bucket objects, for debugging purposes. Only the number of excluded paths is recorded when zero.")
+	flag.Int64Var(&maxCloneSize, "max-clone-size", 0,
+		"The max allowed size in bytes of the clone of a GitRepository on disk, including the Git metadata. Clones which exceed the size are aborted. Unlimited when zero.")
+	flag.BoolVar(&dedupeChartDownloads, "helm-dedupe-chart-downloads", false,
+		"Download a chart version from a HelmRepository only once for HelmCharts which are reconciled concurrently, and share it between their builds.")
+	flag.StringVar(&helmFileRepositoryRoot, "helm-file-repository-root", "",
+		"The absolute path of a local directory HelmRepositories with a 'file://' URL are allowed to read the index and charts from. 'file://' URLs are not supported when empty.")
+	flag.StringSliceVar(&logHeaderDenylist, "log-header-denylist", []string{},
+		"The list of HTTP headers of which the values are replaced with 'REDACTED' in logs, e.g. 'Authorization,X-Api-Key'.")
+	flag.DurationVar(&warningEventsInterval, "warning-events-interval", 5*time.Minute,
+		"The interval within which a Warning event with the same reason and message is recorded only once for an object. Repeated Warning events are not limited when zero.")
+	flag.BoolVar(&enableTracing, "enable-tracing", false,
+		"Export OpenTelemetry traces of the reconciliations with OTLP over gRPC.")
+	flag.StringVar(&tracingEndpoint, "tracing-otlp-endpoint", "",
+		"The host and port of the OTLP gRPC collector traces are exported to. Defaults to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable, or 'localhost:4317'.")
+	flag.BoolVar(&tracingInsecure, "tracing-otlp-insecure", false,
+		"Disable TLS for the connection to the OTLP gRPC collector.")
+	flag.Float64Var(&tracingSampleRatio, "tracing-sample-ratio", 1,
+		"The fraction of the reconciliations which are traced, between 0 and 1.")
 
 	clientOptions.BindFlags(flag.CommandLine)
 	logOptions.BindFlags(flag.CommandLine)
@@ -158,7 +281,7 @@ func main() {
 
 	flag.Parse()
 
-	logger.SetLogger(logger.NewLogger(logOptions))
+	logger.SetLogger(logging.WithHeaderDenylist(logger.NewLogger(logOptions), logHeaderDenylist))
 
 	if err := featureGates.WithLogger(setupLog).SupportedFeatures(features.FeatureGates()); err != nil {
 		setupLog.Error(err, "unable to load feature gates")
@@ -172,18 +295,54 @@ func main() {
 
 	metrics := helper.MustMakeMetrics(mgr)
 	cacheRecorder := cache.MustMakeMetrics()
-	eventRecorder := mustSetupEventRecorder(mgr, eventsAddr, controllerName)
-	storage := mustInitStorage(storagePath, storageAdvAddr, artifactRetentionTTL, artifactRetentionRecords, artifactDigestAlgo)
-
-	mustSetupHelmLimits(helmIndexLimit, helmChartLimit, helmChartFileLimit)
+	latencyRecorder := latency.MustMakeMetrics(latency.DefaultWindowSize)
+	sourceMetrics := sourcemetrics.MustMakeMetrics()
+	connectionLimiter := connlimit.New(maxGlobalConnections)
+	setupGitConnectionLimiter(connectionLimiter)
+	eventRecorder := mustSetupEventRecorder(mgr, eventsAddr, controllerName, warningEventsInterval)
+	mustSetupTracing(mgr, enableTracing, tracing.Options{
+		ServiceName: controllerName,
+		Endpoint:    tracingEndpoint,
+		Insecure:    tracingInsecure,
+		SampleRatio: tracingSampleRatio,
+	})
+	storage := mustInitStorage(storagePath, storageAdvAddr, artifactRetentionTTL, artifactRetentionRecords, artifactDigestAlgo, artifactFailureThreshold)
+
+	storage.ArtifactTreeHash = artifactTreeHash
+	storage.FreeSpaceMargin = storageFreeSpaceMargin
+	mustSetupExternalStorageURL(storage, externalStorageURL)
+	mustSetupPropagateAnnotations(storage, propagateAnnotations)
+	mustSetupDeferredRemovals(mgr, storage, finalizerGCGrace)
+	mustSetupArtifactTTLSweeper(mgr, storage, globalArtifactTTL)
+	mustSetupStorageReadinessCheck(mgr, storage)
+
+	mustSetupMinTLSVersion(tlsMinVersion)
+	mustValidateBucketListPageSize(bucketListPageSize)
+	mustSetupMaxRedirects(maxRedirects)
+	mustSetupHelmLimits(helmIndexLimit, helmIndexMaxEntries, helmChartLimit, helmChartFileLimit)
+	mustSetupHelmFileRepositories(helmFileRepositoryRoot)
 	helmIndexCache, helmIndexCacheItemTTL := mustInitHelmCache(helmCacheMaxSize, helmCacheTTL, helmCachePurgeInterval)
+	preStoreWebhook := mustInitPreStoreWebhook(preStoreWebhookURL, preStoreWebhookTimeout)
+
+	var chartDownloads *repository.DownloadGroup
+	if dedupeChartDownloads {
+		chartDownloads = repository.NewDownloadGroup()
+	}
 
 	if err := (&controller.GitRepositoryReconciler{
-		Client:         mgr.GetClient(),
-		EventRecorder:  eventRecorder,
-		Metrics:        metrics,
-		Storage:        storage,
-		ControllerName: controllerName,
+		Client:                 mgr.GetClient(),
+		EventRecorder:          eventRecorder,
+		Metrics:                metrics,
+		LatencyRecorder:        latencyRecorder,
+		SourceMetrics:          sourceMetrics,
+		ConnectionLimiter:      connectionLimiter,
+		Storage:                storage,
+		ControllerName:         controllerName,
+		PreStoreWebhook:        preStoreWebhook,
+		AllowedSchemes:         allowedSchemes,
+		DisableGitProtocol:     disableGitProtocol,
+		IgnoredPathsSampleSize: ignoredPathsSampleSize,
+		MaxCloneSize:           maxCloneSize,
 	}).SetupWithManagerAndOptions(mgr, controller.GitRepositoryReconcilerOptions{
 		MaxConcurrentReconciles:   concurrent,
 		DependencyRequeueInterval: requeueDependency,
@@ -197,11 +356,15 @@ func main() {
 		Client:                  mgr.GetClient(),
 		EventRecorder:           eventRecorder,
 		Metrics:                 metrics,
+		LatencyRecorder:         latencyRecorder,
+		SourceMetrics:           sourceMetrics,
+		ConnectionLimiter:       connectionLimiter,
 		Getters:                 getters,
 		ControllerName:          controllerName,
 		RegistryClientGenerator: registry.ClientGenerator,
+		AllowedSchemes:          allowedSchemes,
 	}).SetupWithManagerAndOptions(mgr, controller.HelmRepositoryReconcilerOptions{
-		MaxConcurrentReconciles: concurrent,
+		MaxConcurrentReconciles: concurrencyOrDefault(helmRepoConcurrent, concurrent),
 		RateLimiter:             helper.GetRateLimiter(rateLimiterOptions),
 	}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", v1beta2.HelmRepositoryKind, "type", "OCI")
@@ -209,17 +372,25 @@ func main() {
 	}
 
 	if err := (&controller.HelmRepositoryReconciler{
-		Client:         mgr.GetClient(),
-		EventRecorder:  eventRecorder,
-		Metrics:        metrics,
-		Storage:        storage,
-		Getters:        getters,
-		ControllerName: controllerName,
-		Cache:          helmIndexCache,
-		TTL:            helmIndexCacheItemTTL,
-		CacheRecorder:  cacheRecorder,
+		Client:            mgr.GetClient(),
+		EventRecorder:     eventRecorder,
+		Metrics:           metrics,
+		LatencyRecorder:   latencyRecorder,
+		SourceMetrics:     sourceMetrics,
+		ConnectionLimiter: connectionLimiter,
+		Storage:           storage,
+		Getters:           getters,
+		ControllerName:    controllerName,
+		Cache:             helmIndexCache,
+		TTL:               helmIndexCacheItemTTL,
+		CacheRecorder:     cacheRecorder,
+		PreStoreWebhook:   preStoreWebhook,
+		AllowedSchemes:    allowedSchemes,
+		KeepRawIndex:      keepRawIndex,
+		PassthroughIndex:  !normalizeIndex,
+		CompressedIndex:   compressedIndex,
 	}).SetupWithManagerAndOptions(mgr, controller.HelmRepositoryReconcilerOptions{
-		MaxConcurrentReconciles: concurrent,
+		MaxConcurrentReconciles: concurrencyOrDefault(helmRepoConcurrent, concurrent),
 		RateLimiter:             helper.GetRateLimiter(rateLimiterOptions),
 	}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", v1beta2.HelmRepositoryKind)
@@ -233,12 +404,20 @@ func main() {
 		Getters:                 getters,
 		EventRecorder:           eventRecorder,
 		Metrics:                 metrics,
+		LatencyRecorder:         latencyRecorder,
+		SourceMetrics:           sourceMetrics,
+		ConnectionLimiter:       connectionLimiter,
 		ControllerName:          controllerName,
 		Cache:                   helmIndexCache,
 		TTL:                     helmIndexCacheItemTTL,
 		CacheRecorder:           cacheRecorder,
+		PreStoreWebhook:         preStoreWebhook,
+		AllowedSchemes:          allowedSchemes,
+		AllowedChartAPIVersions: allowedChartAPIVersions,
+		RequireIndexDigest:      requireIndexDigest,
+		ChartDownloads:          chartDownloads,
 	}).SetupWithManagerAndOptions(mgr, controller.HelmChartReconcilerOptions{
-		MaxConcurrentReconciles: concurrent,
+		MaxConcurrentReconciles: concurrencyOrDefault(helmChartConcurrent, concurrent),
 		RateLimiter:             helper.GetRateLimiter(rateLimiterOptions),
 	}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", v1beta2.HelmChartKind)
@@ -246,25 +425,38 @@ func main() {
 	}
 
 	if err := (&controller.BucketReconciler{
-		Client:         mgr.GetClient(),
-		EventRecorder:  eventRecorder,
-		Metrics:        metrics,
-		Storage:        storage,
-		ControllerName: controllerName,
+		Client:                 mgr.GetClient(),
+		EventRecorder:          eventRecorder,
+		Metrics:                metrics,
+		LatencyRecorder:        latencyRecorder,
+		SourceMetrics:          sourceMetrics,
+		ConnectionLimiter:      connectionLimiter,
+		Storage:                storage,
+		ControllerName:         controllerName,
+		PreStoreWebhook:        preStoreWebhook,
+		AllowedSchemes:         allowedSchemes,
+		ListPageSize:           bucketListPageSize,
+		IgnoredPathsSampleSize: ignoredPathsSampleSize,
 	}).SetupWithManagerAndOptions(mgr, controller.BucketReconcilerOptions{
-		MaxConcurrentReconciles: concurrent,
-		RateLimiter:             helper.GetRateLimiter(rateLimiterOptions),
+		MaxConcurrentReconciles:    concurrencyOrDefault(bucketConcurrent, concurrent),
+		RateLimiter:                helper.GetRateLimiter(rateLimiterOptions),
+		MaxConcurrentBucketFetches: bucketMaxFetches,
 	}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Bucket")
 		os.Exit(1)
 	}
 
 	if err := (&controller.OCIRepositoryReconciler{
-		Client:         mgr.GetClient(),
-		Storage:        storage,
-		EventRecorder:  eventRecorder,
-		ControllerName: controllerName,
-		Metrics:        metrics,
+		Client:            mgr.GetClient(),
+		Storage:           storage,
+		EventRecorder:     eventRecorder,
+		ControllerName:    controllerName,
+		Metrics:           metrics,
+		LatencyRecorder:   latencyRecorder,
+		SourceMetrics:     sourceMetrics,
+		ConnectionLimiter: connectionLimiter,
+		PreStoreWebhook:   preStoreWebhook,
+		AllowedSchemes:    allowedSchemes,
 	}).SetupWithManagerAndOptions(mgr, controller.OCIRepositoryReconcilerOptions{
 		MaxConcurrentReconciles: concurrent,
 		RateLimiter:             helper.GetRateLimiter(rateLimiterOptions),
@@ -280,7 +472,7 @@ func main() {
 		// to handle that.
 		<-mgr.Elected()
 
-		startFileServer(storage.BasePath, storageAddr)
+		startFileServer(storage, storageAddr)
 	}()
 
 	setupLog.Info("starting manager")
@@ -290,9 +482,9 @@ func main() {
 	}
 }
 
-func startFileServer(path string, address string) {
+func startFileServer(storage *controller.Storage, address string) {
 	setupLog.Info("starting file server")
-	fs := http.FileServer(http.Dir(path))
+	fs := controller.NewStorageFileServer(storage)
 	mux := http.NewServeMux()
 	mux.Handle("/", fs)
 	err := http.ListenAndServe(address, mux)
@@ -301,13 +493,13 @@ func startFileServer(path string, address string) {
 	}
 }
 
-func mustSetupEventRecorder(mgr ctrl.Manager, eventsAddr, controllerName string) record.EventRecorder {
+func mustSetupEventRecorder(mgr ctrl.Manager, eventsAddr, controllerName string, warningInterval time.Duration) record.EventRecorder {
 	eventRecorder, err := events.NewRecorder(mgr, ctrl.Log, eventsAddr, controllerName)
 	if err != nil {
 		setupLog.Error(err, "unable to create event recorder")
 		os.Exit(1)
 	}
-	return eventRecorder
+	return eventlimit.New(eventRecorder, warningInterval)
 }
 
 func mustSetupManager(metricsAddr, healthAddr string, watchOpts helper.WatchOptions, clientOpts client.Options, leaderOpts leaderelection.Options) ctrl.Manager {
@@ -373,12 +565,115 @@ func mustSetupManager(metricsAddr, healthAddr string, watchOpts helper.WatchOpti
 	return mgr
 }
 
-func mustSetupHelmLimits(indexLimit, chartLimit, chartFileLimit int64) {
+func mustSetupMinTLSVersion(version string) {
+	v, err := transport.ParseTLSVersion(version)
+	if err != nil {
+		setupLog.Error(err, "unable to configure minimum TLS version")
+		os.Exit(1)
+	}
+	if v == 0 {
+		return
+	}
+	transport.SetMinTLSVersion(v)
+	// The GCP storage client clones the TLS config of the default transport.
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.TLSClientConfig = transport.WithMinTLSVersion(t.TLSClientConfig)
+	}
+	setupLog.Info("enforcing minimum TLS version", "version", version)
+}
+
+func mustSetupMaxRedirects(n int) {
+	if err := transport.SetMaxRedirects(n); err != nil {
+		setupLog.Error(err, "unable to configure maximum number of redirects")
+		os.Exit(1)
+	}
+}
+
+// setupGitConnectionLimiter installs go-git HTTP(S) clients which acquire a
+// slot of the given limiter for every request. go-git uses the globally
+// installed clients for all repositories, except for those with a CA bundle.
+func setupGitConnectionLimiter(limiter *connlimit.Limiter) {
+	if limiter == nil {
+		return
+	}
+	c := githttp.NewClient(&http.Client{Transport: limiter.RoundTripper(http.DefaultTransport)})
+	gitclient.InstallProtocol("http", c)
+	gitclient.InstallProtocol("https", c)
+}
+
+func mustValidateBucketListPageSize(n int) {
+	if n < 0 || n > math.MaxInt32 {
+		setupLog.Error(fmt.Errorf("invalid value %d: must be between 0 and %d", n, math.MaxInt32),
+			"invalid Bucket list page size")
+		os.Exit(1)
+	}
+}
+
+func mustSetupPropagateAnnotations(storage *controller.Storage, patterns []string) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			setupLog.Error(fmt.Errorf("invalid pattern '%s': %w", p, err), "unable to configure annotations to propagate")
+			os.Exit(1)
+		}
+	}
+	storage.PropagateAnnotations = patterns
+}
+
+func mustSetupExternalStorageURL(storage *controller.Storage, externalURL string) {
+	if externalURL == "" {
+		return
+	}
+
+	u, err := url.Parse(externalURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		setupLog.Error(fmt.Errorf("invalid URL '%s': must be an http or https URL with only a scheme and host", externalURL),
+			"unable to configure external storage URL")
+		os.Exit(1)
+	}
+
+	storage.ExternalURL = u.Scheme + "://" + u.Host
+	setupLog.Info("artifact URLs are composed using external storage URL", "url", storage.ExternalURL)
+}
+
+func mustSetupHelmLimits(indexLimit int64, indexMaxEntries int, chartLimit, chartFileLimit int64) {
 	helm.MaxIndexSize = indexLimit
+	helm.MaxIndexEntries = indexMaxEntries
 	helm.MaxChartSize = chartLimit
 	helm.MaxChartFileSize = chartFileLimit
 }
 
+func mustSetupHelmFileRepositories(root string) {
+	if root == "" {
+		return
+	}
+	if !filepath.IsAbs(root) {
+		setupLog.Error(fmt.Errorf("path '%s' is not absolute", root), "invalid Helm file repository root")
+		os.Exit(1)
+	}
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		setupLog.Error(fmt.Errorf("path '%s' is not an existing directory", root), "invalid Helm file repository root")
+		os.Exit(1)
+	}
+	getters = append(getters, helmgetter.NewFileProvider(filepath.Clean(root)))
+}
+
+func mustInitPreStoreWebhook(webhookURL string, timeout time.Duration) *webhook.PreStore {
+	if webhookURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		setupLog.Error(fmt.Errorf("invalid URL '%s': must be an absolute http or https URL", webhookURL),
+			"unable to configure pre-store webhook")
+		os.Exit(1)
+	}
+
+	setupLog.Info("artifacts are reviewed by pre-store webhook before being stored", "url", u.Redacted())
+	return webhook.NewPreStore(webhookURL, timeout)
+}
+
 func mustInitHelmCache(maxSize int, purgeInterval, itemTTL string) (*cache.Cache, time.Duration) {
 	if maxSize <= 0 {
 		setupLog.Info("caching of Helm index files is disabled")
@@ -400,7 +695,7 @@ func mustInitHelmCache(maxSize int, purgeInterval, itemTTL string) (*cache.Cache
 	return cache.New(maxSize, interval), ttl
 }
 
-func mustInitStorage(path string, storageAdvAddr string, artifactRetentionTTL time.Duration, artifactRetentionRecords int, artifactDigestAlgo string) *controller.Storage {
+func mustInitStorage(path string, storageAdvAddr string, artifactRetentionTTL time.Duration, artifactRetentionRecords int, artifactDigestAlgo string, artifactFailureThreshold int) *controller.Storage {
 	if storageAdvAddr == "" {
 		storageAdvAddr = determineAdvStorageAddr(storageAdvAddr)
 	}
@@ -414,14 +709,117 @@ func mustInitStorage(path string, storageAdvAddr string, artifactRetentionTTL ti
 		intdigest.Canonical = algo
 	}
 
+	if artifactFailureThreshold < 0 {
+		setupLog.Error(fmt.Errorf("invalid value %d: must not be negative", artifactFailureThreshold), "invalid artifact failure threshold")
+		os.Exit(1)
+	}
+
 	storage, err := controller.NewStorage(path, storageAdvAddr, artifactRetentionTTL, artifactRetentionRecords)
 	if err != nil {
 		setupLog.Error(err, "unable to initialise storage")
 		os.Exit(1)
 	}
+	storage.ArtifactFailureThreshold = artifactFailureThreshold
 	return storage
 }
 
+func mustSetupDeferredRemovals(mgr ctrl.Manager, storage *controller.Storage, finalizerGCGrace time.Duration) {
+	if finalizerGCGrace < 0 {
+		setupLog.Error(fmt.Errorf("invalid value %s: must not be negative", finalizerGCGrace), "invalid finalizer garbage collection grace period")
+		os.Exit(1)
+	}
+	storage.FinalizerGCGrace = finalizerGCGrace
+
+	// Sweep the removals deferred before the controller was (re)started,
+	// which without a grace period are all due
+	if err := storage.LoadDeferredRemovals(); err != nil {
+		setupLog.Error(err, "unable to load deferred artifact removals")
+	}
+	removed, err := storage.SweepDeferredRemovals()
+	if err != nil {
+		setupLog.Error(err, "failed to remove deferred artifacts")
+	}
+	if len(removed) > 0 {
+		setupLog.Info(fmt.Sprintf("removed %d deferred artifact directories", len(removed)))
+	}
+	if finalizerGCGrace == 0 {
+		return
+	}
+
+	interval := time.Minute
+	if finalizerGCGrace < interval {
+		interval = finalizerGCGrace
+	}
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		storage.StartDeferredRemovalSweeper(ctx, interval, ctrl.Log.WithName("storage"))
+		return nil
+	})); err != nil {
+		setupLog.Error(err, "unable to setup deferred artifact removal")
+		os.Exit(1)
+	}
+}
+
+func mustSetupArtifactTTLSweeper(mgr ctrl.Manager, storage *controller.Storage, ttl time.Duration) {
+	if ttl < 0 {
+		setupLog.Error(fmt.Errorf("invalid value %s: must not be negative", ttl), "invalid global artifact TTL")
+		os.Exit(1)
+	}
+	if ttl == 0 {
+		return
+	}
+
+	interval := time.Hour
+	if ttl < interval {
+		interval = ttl
+	}
+	if err := mgr.Add(&controller.ArtifactTTLSweeper{
+		Client:   mgr.GetClient(),
+		Storage:  storage,
+		TTL:      ttl,
+		Interval: interval,
+	}); err != nil {
+		setupLog.Error(err, "unable to setup global artifact TTL sweeper")
+		os.Exit(1)
+	}
+}
+
+// mustSetupStorageReadinessCheck registers a readiness check which fails
+// while no artifacts can be written to the storage, e.g. because the volume
+// is mounted read-only or is full.
+func mustSetupStorageReadinessCheck(mgr ctrl.Manager, storage *controller.Storage) {
+	if err := mgr.AddReadyzCheck("storage", func(_ *http.Request) error {
+		return storage.CheckWritable()
+	}); err != nil {
+		setupLog.Error(err, "unable to setup storage readiness check")
+		os.Exit(1)
+	}
+}
+
+func mustSetupTracing(mgr ctrl.Manager, enabled bool, opts tracing.Options) {
+	if !enabled {
+		return
+	}
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		setupLog.Error(fmt.Errorf("invalid value %v: must be between 0 and 1", opts.SampleRatio), "invalid tracing sample ratio")
+		os.Exit(1)
+	}
+	shutdown, err := tracing.Setup(context.Background(), opts)
+	if err != nil {
+		setupLog.Error(err, "unable to setup tracing")
+		os.Exit(1)
+	}
+	// Flush the pending spans when the manager stops.
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return shutdown(shutdownCtx)
+	})); err != nil {
+		setupLog.Error(err, "unable to setup tracing")
+		os.Exit(1)
+	}
+}
+
 func determineAdvStorageAddr(storageAddr string) string {
 	host, port, err := net.SplitHostPort(storageAddr)
 	if err != nil {
@@ -445,6 +843,15 @@ func determineAdvStorageAddr(storageAddr string) string {
 	return net.JoinHostPort(host, port)
 }
 
+// concurrencyOrDefault returns the number of concurrent reconciles configured
+// for a specific controller, or the global number if it is not configured.
+func concurrencyOrDefault(controllerConcurrent, concurrent int) int {
+	if controllerConcurrent > 0 {
+		return controllerConcurrent
+	}
+	return concurrent
+}
+
 func envOrDefault(envName, defaultValue string) string {
 	ret := os.Getenv(envName)
 	if ret != "" {
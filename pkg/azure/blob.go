@@ -19,9 +19,12 @@ package azure
 import (
 	"context"
 	"crypto/md5"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -62,6 +65,46 @@ const (
 // BlobClient is a minimal Azure Blob client for fetching objects.
 type BlobClient struct {
 	*azblob.Client
+	// PageSize is the maximum number of objects requested per page while
+	// listing objects. The default of the API is used when zero.
+	PageSize int
+	// Prefix limits the listed objects to those with a key starting with
+	// it. All objects are listed when empty.
+	Prefix string
+}
+
+// Option is a functional option for configuring the client created by
+// NewClient.
+type Option func(*options)
+
+type options struct {
+	minTLSVersion uint16
+	proxy         func(*http.Request) (*url.URL, error)
+	wrapTransport func(http.RoundTripper) http.RoundTripper
+}
+
+// WithMinTLSVersion configures the minimum TLS version of the client. It has
+// no effect if the version is lower than the default of TLS 1.2.
+func WithMinTLSVersion(v uint16) Option {
+	return func(o *options) {
+		o.minTLSVersion = v
+	}
+}
+
+// WithProxy configures the proxy function of the transport of the client,
+// instead of the proxy from the environment.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(o *options) {
+		o.proxy = proxy
+	}
+}
+
+// WithTransportWrapper configures a function which wraps the transport of the
+// client, e.g. to bound the number of concurrent requests.
+func WithTransportWrapper(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(o *options) {
+		o.wrapTransport = wrap
+	}
 }
 
 // NewClient creates a new Azure Blob storage client.
@@ -87,9 +130,29 @@ type BlobClient struct {
 //
 // If no credentials are found, and the azidentity.ChainedTokenCredential can
 // not be established. A simple client without credentials is returned.
-func NewClient(obj *sourcev1.Bucket, secret *corev1.Secret) (c *BlobClient, err error) {
+func NewClient(obj *sourcev1.Bucket, secret *corev1.Secret, opts ...Option) (c *BlobClient, err error) {
 	c = &BlobClient{}
 
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	clientOpts := &azblob.ClientOptions{}
+	if o.minTLSVersion > tls.VersionTLS12 || o.proxy != nil || o.wrapTransport != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if o.minTLSVersion > tls.VersionTLS12 {
+			transport.TLSClientConfig = &tls.Config{MinVersion: o.minTLSVersion}
+		}
+		if o.proxy != nil {
+			transport.Proxy = o.proxy
+		}
+		var rt http.RoundTripper = transport
+		if o.wrapTransport != nil {
+			rt = o.wrapTransport(transport)
+		}
+		clientOpts.Transport = &http.Client{Transport: rt}
+	}
+
 	var token azcore.TokenCredential
 
 	if secret != nil && len(secret.Data) > 0 {
@@ -99,7 +162,7 @@ func NewClient(obj *sourcev1.Bucket, secret *corev1.Secret) (c *BlobClient, err
 			return
 		}
 		if token != nil {
-			c.Client, err = azblob.NewClient(obj.Spec.Endpoint, token, nil)
+			c.Client, err = azblob.NewClient(obj.Spec.Endpoint, token, clientOpts)
 			return
 		}
 
@@ -109,7 +172,7 @@ func NewClient(obj *sourcev1.Bucket, secret *corev1.Secret) (c *BlobClient, err
 			return
 		}
 		if cred != nil {
-			c.Client, err = azblob.NewClientWithSharedKeyCredential(obj.Spec.Endpoint, cred, &azblob.ClientOptions{})
+			c.Client, err = azblob.NewClientWithSharedKeyCredential(obj.Spec.Endpoint, cred, clientOpts)
 			return
 		}
 
@@ -118,7 +181,7 @@ func NewClient(obj *sourcev1.Bucket, secret *corev1.Secret) (c *BlobClient, err
 			return
 		}
 
-		c.Client, err = azblob.NewClientWithNoCredential(fullPath, &azblob.ClientOptions{})
+		c.Client, err = azblob.NewClientWithNoCredential(fullPath, clientOpts)
 		return
 	}
 
@@ -131,12 +194,12 @@ func NewClient(obj *sourcev1.Bucket, secret *corev1.Secret) (c *BlobClient, err
 		return nil, err
 	}
 	if token != nil {
-		c.Client, err = azblob.NewClient(obj.Spec.Endpoint, token, nil)
+		c.Client, err = azblob.NewClient(obj.Spec.Endpoint, token, clientOpts)
 		return
 	}
 
 	// Fallback to simple client.
-	c.Client, err = azblob.NewClientWithNoCredential(obj.Spec.Endpoint, nil)
+	c.Client, err = azblob.NewClientWithNoCredential(obj.Spec.Endpoint, clientOpts)
 	return
 }
 
@@ -262,11 +325,23 @@ func (c *BlobClient) FGetObject(ctx context.Context, bucketName, objectName, loc
 }
 
 // VisitObjects iterates over the items in the provided object storage
-// bucket, calling visit for every item.
+// bucket with a key starting with Prefix, calling visit for every item. The
+// items are listed page by page, with pages of at most PageSize items.
 // If the underlying client or the visit callback returns an error,
 // it returns early.
 func (c *BlobClient) VisitObjects(ctx context.Context, bucketName string, visit func(path, etag string) error) error {
-	items := c.NewListBlobsFlatPager(bucketName, nil)
+	opts := &azblob.ListBlobsFlatOptions{}
+	if c.PageSize > 0 {
+		pageSize := int32(math.MaxInt32)
+		if c.PageSize < math.MaxInt32 {
+			pageSize = int32(c.PageSize)
+		}
+		opts.MaxResults = &pageSize
+	}
+	if c.Prefix != "" {
+		opts.Prefix = &c.Prefix
+	}
+	items := c.NewListBlobsFlatPager(bucketName, opts)
 	for items.More() {
 		resp, err := items.NextPage(ctx)
 		if err != nil {
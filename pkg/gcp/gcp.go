@@ -21,13 +21,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 
 	gcpstorage "cloud.google.com/go/storage"
 	"github.com/go-logr/logr"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 	corev1 "k8s.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
@@ -39,6 +44,9 @@ var (
 	// ErrorDirectoryExists is an error returned when the filename provided
 	// is a directory.
 	ErrorDirectoryExists = errors.New("filename is a directory")
+	// ErrDefaultCredentials is returned by NewClient when no Secret is
+	// provided, and the application default credentials can not be resolved.
+	ErrDefaultCredentials = errors.New("failed to resolve application default credentials")
 )
 
 // GCSClient is a minimal Google Cloud Storage client for fetching objects.
@@ -46,26 +54,104 @@ type GCSClient struct {
 	// client for interacting with the Google Cloud
 	// Storage APIs.
 	*gcpstorage.Client
+	// PageSize is the maximum number of objects requested per page while
+	// listing objects. The default of the API is used when zero.
+	PageSize int
+	// Prefix limits the listed objects to those with a key starting with
+	// it. All objects are listed when empty.
+	Prefix string
 }
 
-// NewClient creates a new GCP storage client. The Client will automatically look for  the Google Application
-// Credential environment variable or look for the Google Application Credential file.
-func NewClient(ctx context.Context, secret *corev1.Secret) (*GCSClient, error) {
-	c := &GCSClient{}
+// Option is a functional option for configuring the client created by
+// NewClient.
+type Option func(*options)
+
+type options struct {
+	proxy         func(*http.Request) (*url.URL, error)
+	wrapTransport func(http.RoundTripper) http.RoundTripper
+}
+
+// WithProxy configures the proxy function of the transport of the client,
+// which is used for both the requests to the Storage API and the requests to
+// obtain tokens, instead of the proxy from the environment.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(o *options) {
+		o.proxy = proxy
+	}
+}
+
+// WithTransportWrapper configures a function which wraps the transport of the
+// client, e.g. to bound the number of concurrent requests. Like the proxy, it
+// applies to both the requests to the Storage API and to obtain tokens.
+func WithTransportWrapper(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(o *options) {
+		o.wrapTransport = wrap
+	}
+}
+
+// NewClient creates a new GCP storage client. Without a Secret, the Client uses the application default
+// credentials, which are looked up from the Google Application Credential environment variable or file, or
+// the metadata server (e.g. with GKE Workload Identity). A failure to resolve them, or to obtain a token with
+// them, is returned as ErrDefaultCredentials.
+func NewClient(ctx context.Context, secret *corev1.Secret, opts ...Option) (*GCSClient, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var base http.RoundTripper
+	if o.proxy != nil || o.wrapTransport != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if o.proxy != nil {
+			transport.Proxy = o.proxy
+		}
+		base = transport
+		if o.wrapTransport != nil {
+			base = o.wrapTransport(transport)
+		}
+		// The HTTP client in the context is used to obtain tokens.
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: base})
+	}
+
+	var clientOpts []option.ClientOption
 	if secret != nil {
-		client, err := gcpstorage.NewClient(ctx, option.WithCredentialsJSON(secret.Data["serviceaccount"]))
+		clientOpts = append(clientOpts, option.WithCredentialsJSON(secret.Data["serviceaccount"]))
+	} else if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		creds, err := defaultCredentials(ctx)
 		if err != nil {
 			return nil, err
 		}
-		c.Client = client
-	} else {
-		client, err := gcpstorage.NewClient(ctx)
+		clientOpts = append(clientOpts, option.WithCredentials(creds))
+	}
+	if base != nil {
+		transport, err := htransport.NewTransport(ctx, base,
+			append([]option.ClientOption{option.WithScopes(gcpstorage.ScopeReadOnly)}, clientOpts...)...)
 		if err != nil {
 			return nil, err
 		}
-		c.Client = client
+		clientOpts = append(clientOpts, option.WithHTTPClient(&http.Client{Transport: transport}))
 	}
-	return c, nil
+
+	client, err := gcpstorage.NewClient(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GCSClient{Client: client}, nil
+}
+
+// defaultCredentials resolves the application default credentials, and
+// obtains a token with them to detect misconfigurations (e.g. a Kubernetes
+// service account which is not bound to a Google service account) before
+// the first request to the Storage API.
+func defaultCredentials(ctx context.Context) (*google.Credentials, error) {
+	creds, err := google.FindDefaultCredentials(ctx, gcpstorage.ScopeReadOnly)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDefaultCredentials, err)
+	}
+	if _, err = creds.TokenSource.Token(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDefaultCredentials, err)
+	}
+	return creds, nil
 }
 
 // ValidateSecret validates the credential secret. The provided Secret may
@@ -162,11 +248,19 @@ func (c *GCSClient) FGetObject(ctx context.Context, bucketName, objectName, loca
 }
 
 // VisitObjects iterates over the items in the provided object storage
-// bucket, calling visit for every item.
+// bucket with a key starting with Prefix, calling visit for every item. The
+// items are listed page by page, with pages of at most PageSize items.
 // If the underlying client or the visit callback returns an error,
 // it returns early.
 func (c *GCSClient) VisitObjects(ctx context.Context, bucketName string, visit func(path, etag string) error) error {
-	items := c.Client.Bucket(bucketName).Objects(ctx, nil)
+	var query *gcpstorage.Query
+	if c.Prefix != "" {
+		query = &gcpstorage.Query{Prefix: c.Prefix}
+	}
+	items := c.Client.Bucket(bucketName).Objects(ctx, query)
+	if c.PageSize > 0 {
+		items.PageInfo().MaxSize = c.PageSize
+	}
 	for {
 		object, err := items.Next()
 		if err == IteratorDone {
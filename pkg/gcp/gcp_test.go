@@ -20,6 +20,7 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -28,6 +29,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
@@ -144,6 +146,47 @@ func TestNewClientWithSecretErr(t *testing.T) {
 	assert.Assert(t, gcpClient == nil)
 }
 
+func TestNewClientWithDefaultCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		tokenStatus int
+		noCreds     bool
+		wantErr     bool
+	}{
+		{name: "valid default credentials", tokenStatus: http.StatusOK},
+		{name: "token request denied", tokenStatus: http.StatusUnauthorized, wantErr: true},
+		{name: "no default credentials", noCreds: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.tokenStatus)
+				fmt.Fprint(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`)
+			}))
+			defer tokenServer.Close()
+
+			credsPath := filepath.Join(t.TempDir(), "credentials.json")
+			if !tt.noCreds {
+				creds := fmt.Sprintf(`{"type":"authorized_user","client_id":"id","client_secret":"secret","refresh_token":"refresh","token_uri":%q}`,
+					tokenServer.URL)
+				assert.NilError(t, os.WriteFile(credsPath, []byte(creds), 0o600))
+			}
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsPath)
+			t.Setenv("STORAGE_EMULATOR_HOST", "")
+
+			gcpClient, err := NewClient(context.Background(), nil)
+			if tt.wantErr {
+				assert.Assert(t, errors.Is(err, ErrDefaultCredentials), "unexpected error: %v", err)
+				assert.Assert(t, gcpClient == nil)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Assert(t, gcpClient != nil)
+		})
+	}
+}
+
 func TestBucketExists(t *testing.T) {
 	gcpClient := &GCSClient{
 		Client: client,
@@ -201,6 +244,103 @@ func TestVisitObjectsCallbackErr(t *testing.T) {
 	assert.Error(t, err, mockErr.Error())
 }
 
+func TestVisitObjectsPageSize(t *testing.T) {
+	const (
+		objects  = 1000
+		pageSize = 100
+	)
+
+	var requests int
+	var maxResults []string
+	pagedClient, closePaged := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/storage/v1/b/%s/o", bucketName) {
+			w.WriteHeader(404)
+			return
+		}
+		requests++
+		maxResults = append(maxResults, r.URL.Query().Get("maxResults"))
+
+		start := 0
+		if token := r.URL.Query().Get("pageToken"); token != "" {
+			start, _ = strconv.Atoi(token)
+		}
+		end := start + pageSize
+		response := &raw.Objects{}
+		for i := start; i < end && i < objects; i++ {
+			response.Items = append(response.Items, &raw.Object{
+				Bucket: bucketName,
+				Name:   fmt.Sprintf("object-%d.yaml", i),
+				Etag:   objectEtag,
+			})
+		}
+		if end < objects {
+			response.NextPageToken = strconv.Itoa(end)
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	})
+	defer closePaged()
+
+	c, err := gcpstorage.NewClient(context.Background(), option.WithHTTPClient(pagedClient))
+	assert.NilError(t, err)
+	gcpClient := &GCSClient{
+		Client:   c,
+		PageSize: pageSize,
+	}
+
+	var visited int
+	err = gcpClient.VisitObjects(context.Background(), bucketName, func(key, etag string) error {
+		// Objects must be visited while their page is processed, rather than
+		// after all pages have been listed.
+		assert.Equal(t, requests, visited/pageSize+1)
+		visited++
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, visited, objects)
+	assert.Equal(t, requests, objects/pageSize)
+	for _, v := range maxResults {
+		assert.Equal(t, v, strconv.Itoa(pageSize))
+	}
+}
+
+func TestVisitObjectsPrefix(t *testing.T) {
+	var prefixes []string
+	prefixedClient, closePrefixed := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf("/storage/v1/b/%s/o", bucketName) {
+			w.WriteHeader(404)
+			return
+		}
+		prefixes = append(prefixes, r.URL.Query().Get("prefix"))
+		response := &raw.Objects{
+			Items: []*raw.Object{
+				{
+					Bucket: bucketName,
+					Name:   "clusters/prod/object.yaml",
+					Etag:   objectEtag,
+				},
+			},
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	})
+	defer closePrefixed()
+
+	c, err := gcpstorage.NewClient(context.Background(), option.WithHTTPClient(prefixedClient))
+	assert.NilError(t, err)
+	gcpClient := &GCSClient{
+		Client: c,
+		Prefix: "clusters/prod/",
+	}
+
+	var keys []string
+	err = gcpClient.VisitObjects(context.Background(), bucketName, func(key, etag string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, keys, []string{"clusters/prod/object.yaml"})
+	assert.DeepEqual(t, prefixes, []string{"clusters/prod/"})
+}
+
 func TestFGetObject(t *testing.T) {
 	tempDir := t.TempDir()
 	gcpClient := &GCSClient{
@@ -18,8 +18,13 @@ package minio
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -33,10 +38,62 @@ import (
 // storage APIs.
 type MinioClient struct {
 	*minio.Client
+	// PageSize is the maximum number of objects requested per page while
+	// listing objects. The default of the API is used when zero.
+	PageSize int
+	// Prefix limits the listed objects to those with a key starting with
+	// it. All objects are listed when empty.
+	Prefix string
+}
+
+// ErrEndpointNotTLS is returned when a TLS connection is made to an endpoint
+// which only serves plain HTTP.
+var ErrEndpointNotTLS = errors.New("endpoint does not support TLS: set 'insecure' to connect to it over plain HTTP")
+
+// Option is a functional option for configuring the client created by
+// NewClient.
+type Option func(*options)
+
+type options struct {
+	minTLSVersion uint16
+	proxy         func(*http.Request) (*url.URL, error)
+	wrapTransport func(http.RoundTripper) http.RoundTripper
+}
+
+// WithMinTLSVersion configures the minimum TLS version of the client. It has
+// no effect if the version is lower than the default of the client.
+func WithMinTLSVersion(v uint16) Option {
+	return func(o *options) {
+		o.minTLSVersion = v
+	}
+}
+
+// WithProxy configures the proxy function of the transport of the client,
+// instead of the proxy from the environment.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(o *options) {
+		o.proxy = proxy
+	}
+}
+
+// WithTransportWrapper configures a function which wraps the transport of the
+// client, e.g. to bound the number of concurrent requests.
+func WithTransportWrapper(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(o *options) {
+		o.wrapTransport = wrap
+	}
 }
 
 // NewClient creates a new Minio storage client.
-func NewClient(bucket *sourcev1.Bucket, secret *corev1.Secret) (*MinioClient, error) {
+func NewClient(bucket *sourcev1.Bucket, secret *corev1.Secret, opts ...Option) (*MinioClient, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Bucket names are always addressed in the path of the request, as
+	// self-hosted S3 compatible servers (e.g. Minio) commonly do not support
+	// virtual-host-style addressing.
 	opt := minio.Options{
 		Region:       bucket.Spec.Region,
 		Secure:       !bucket.Spec.Insecure,
@@ -55,7 +112,38 @@ func NewClient(bucket *sourcev1.Bucket, secret *corev1.Secret) (*MinioClient, er
 			opt.Creds = credentials.NewStaticV4(accessKey, secretKey, "")
 		}
 	} else if bucket.Spec.Provider == sourcev1.AmazonBucketProvider {
-		opt.Creds = credentials.NewIAM("")
+		opt.Creds = ambientCredentials()
+	}
+
+	var rootCAs *x509.CertPool
+	if secret != nil {
+		var err error
+		if rootCAs, err = caCertPool(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.minTLSVersion != 0 || o.proxy != nil || o.wrapTransport != nil || rootCAs != nil {
+		transport, err := minio.DefaultTransport(opt.Secure)
+		if err != nil {
+			return nil, err
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		if transport.TLSClientConfig.MinVersion < o.minTLSVersion {
+			transport.TLSClientConfig.MinVersion = o.minTLSVersion
+		}
+		if rootCAs != nil {
+			transport.TLSClientConfig.RootCAs = rootCAs
+		}
+		if o.proxy != nil {
+			transport.Proxy = o.proxy
+		}
+		opt.Transport = transport
+		if o.wrapTransport != nil {
+			opt.Transport = o.wrapTransport(transport)
+		}
 	}
 
 	client, err := minio.New(bucket.Spec.Endpoint, &opt)
@@ -65,8 +153,44 @@ func NewClient(bucket *sourcev1.Bucket, secret *corev1.Secret) (*MinioClient, er
 	return &MinioClient{Client: client}, nil
 }
 
-// ValidateSecret validates the credential secret. The provided Secret may
-// be nil.
+// ambientCredentials returns credentials resolved in the order of the default
+// AWS credential chain: the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+// environment variables, the shared credentials file, and finally the IAM
+// role of the workload. The latter includes a web identity token
+// (e.g. IRSA on EKS), the ECS container credentials and the EC2 instance
+// metadata service.
+func ambientCredentials() *credentials.Credentials {
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{
+			Client: &http.Client{
+				Transport: http.DefaultTransport,
+			},
+		},
+	})
+}
+
+// caCertPool returns the system certificate pool with the PEM encoded
+// certificates of the 'caFile' of the given Secret appended to it, or nil if
+// the Secret has no 'caFile'.
+func caCertPool(secret *corev1.Secret) (*x509.CertPool, error) {
+	caBytes, ok := secret.Data["caFile"]
+	if !ok {
+		return nil, nil
+	}
+	cp, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve system certificate pool: %w", err)
+	}
+	if !cp.AppendCertsFromPEM(caBytes) {
+		return nil, fmt.Errorf("invalid '%s' secret data: 'caFile' does not contain a PEM encoded certificate", secret.Name)
+	}
+	return cp, nil
+}
+
+// ValidateSecret validates the credential secret, including the CA
+// certificate in the optional 'caFile'. The provided Secret may be nil.
 func ValidateSecret(secret *corev1.Secret) error {
 	if secret == nil {
 		return nil
@@ -78,9 +202,30 @@ func ValidateSecret(secret *corev1.Secret) error {
 	if _, ok := secret.Data["secretkey"]; !ok {
 		return err
 	}
+	if _, err := caCertPool(secret); err != nil {
+		return err
+	}
 	return nil
 }
 
+// BucketExists returns if an object storage bucket with the provided name
+// exists, or returns a (client) error. The error wraps ErrEndpointNotTLS if
+// the client uses TLS while the endpoint only serves plain HTTP.
+func (c *MinioClient) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	exists, err := c.Client.BucketExists(ctx, bucketName)
+	if err != nil && c.Client.EndpointURL().Scheme == "https" && isHTTPResponseToHTTPSClient(err) {
+		return false, fmt.Errorf("%w (%s)", ErrEndpointNotTLS, err)
+	}
+	return exists, err
+}
+
+// isHTTPResponseToHTTPSClient returns if the error is the result of the
+// endpoint answering a TLS handshake with a plain HTTP response. The HTTP
+// client does not expose a typed error for this.
+func isHTTPResponseToHTTPSClient(err error) bool {
+	return strings.Contains(err.Error(), "server gave HTTP response to HTTPS client")
+}
+
 // FGetObject gets the object from the provided object storage bucket, and
 // writes it to targetPath.
 // It returns the etag of the successfully fetched file, or any error.
@@ -100,13 +245,16 @@ func (c *MinioClient) FGetObject(ctx context.Context, bucketName, objectName, lo
 }
 
 // VisitObjects iterates over the items in the provided object storage
-// bucket, calling visit for every item.
+// bucket with a key starting with Prefix, calling visit for every item. The
+// items are listed page by page, with pages of at most PageSize items.
 // If the underlying client or the visit callback returns an error,
 // it returns early.
 func (c *MinioClient) VisitObjects(ctx context.Context, bucketName string, visit func(key, etag string) error) error {
 	for object := range c.Client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:    c.Prefix,
 		Recursive: true,
 		UseV1:     s3utils.IsGoogleEndpoint(*c.Client.EndpointURL()),
+		MaxKeys:   c.PageSize,
 	}) {
 		if object.Err != nil {
 			err := fmt.Errorf("listing objects from bucket '%s' failed: %w", bucketName, object.Err)
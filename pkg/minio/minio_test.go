@@ -193,6 +193,20 @@ func TestNewClientAwsProvider(t *testing.T) {
 	assert.Assert(t, minioClient != nil)
 }
 
+func TestNewClientAwsProviderAmbientCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "ambient-access-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "ambient-secret-key")
+
+	creds, err := ambientCredentials().Get()
+	assert.NilError(t, err)
+	assert.Equal(t, creds.AccessKeyID, "ambient-access-key")
+	assert.Equal(t, creds.SecretAccessKey, "ambient-secret-key")
+
+	minioClient, err := NewClient(bucketStub(bucketAwsProvider, testMinioAddress), nil)
+	assert.NilError(t, err)
+	assert.Assert(t, minioClient != nil)
+}
+
 func TestBucketExists(t *testing.T) {
 	ctx := context.Background()
 	exists, err := testMinioClient.BucketExists(ctx, bucketName)
@@ -257,10 +271,13 @@ func TestVisitObjectsCallbackErr(t *testing.T) {
 
 func TestValidateSecret(t *testing.T) {
 	t.Parallel()
+	testCA, err := os.ReadFile("testdata/ca.pem")
+	assert.NilError(t, err)
+
 	testCases := []struct {
 		name   string
 		secret *corev1.Secret
-		error  bool
+		error  string
 	}{
 		{
 			name:   "valid secret",
@@ -273,7 +290,24 @@ func TestValidateSecret(t *testing.T) {
 		{
 			name:   "invalid secret",
 			secret: emptySecret.DeepCopy(),
-			error:  true,
+			error:  fmt.Sprintf("invalid '%v' secret data: required fields 'accesskey' and 'secretkey'", emptySecret.Name),
+		},
+		{
+			name: "secret with caFile",
+			secret: func() *corev1.Secret {
+				s := secret.DeepCopy()
+				s.Data["caFile"] = testCA
+				return s
+			}(),
+		},
+		{
+			name: "secret with invalid caFile",
+			secret: func() *corev1.Secret {
+				s := secret.DeepCopy()
+				s.Data["caFile"] = []byte("invalid")
+				return s
+			}(),
+			error: fmt.Sprintf("invalid '%v' secret data: 'caFile' does not contain a PEM encoded certificate", secret.Name),
 		},
 	}
 	for _, testCase := range testCases {
@@ -281,8 +315,8 @@ func TestValidateSecret(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 			err := ValidateSecret(tt.secret)
-			if tt.error {
-				assert.Error(t, err, fmt.Sprintf("invalid '%v' secret data: required fields 'accesskey' and 'secretkey'", tt.secret.Name))
+			if tt.error != "" {
+				assert.Error(t, err, tt.error)
 			} else {
 				assert.NilError(t, err)
 			}